@@ -149,12 +149,11 @@ func main() {
 		case "get-peers":
 			fmt.Println("Peers:\n", node.GetPeers())
 
-		case "stop":
-			node.Stop()
-			return
+		case "stop", "exit":
+			if err := node.Stop(); err != nil {
+				fmt.Println(err)
+			}
 
-		case "exit":
-			node.Stop()
 			return
 
 		default:
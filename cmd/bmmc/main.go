@@ -0,0 +1,299 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command bmmc runs a node of the bimodal multicast protocol and talks to
+// running nodes through their admin endpoints.
+//
+//	bmmc run --addr 10.0.0.1 --port 18999 --peers 10.0.0.2:18999,10.0.0.3:18999
+//	bmmc send --node 10.0.0.1:18999 --msg hello
+//	bmmc peers --node 10.0.0.1:18999
+//	bmmc messages --node 10.0.0.1:18999
+//
+// The admin token is read from the BMMC_ADMIN_TOKEN environment variable or
+// from the --token flag.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/bmmc"
+)
+
+const (
+	adminTokenEnv = "BMMC_ADMIN_TOKEN"
+	defaultNode   = "localhost:18999"
+
+	requestTimeout = 10 * time.Second
+
+	usage = `usage: bmmc <command> [flags]
+
+commands:
+  run       run a node until it is interrupted
+  send      add a message on a running node
+  peers     list the peers of a running node
+  messages  list the messages of a running node
+
+Run 'bmmc <command> -h' for the flags of a command.
+`
+)
+
+var (
+	errMissingMessage = errors.New("--msg is required")
+	errInvalidPeer    = errors.New("peers must be host:port")
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	commands := map[string]func([]string) error{
+		"run":      run,
+		"send":     send,
+		"peers":    peers,
+		"messages": messages,
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "bmmc:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs a node until it receives SIGINT or SIGTERM.
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	addr := fs.String("addr", "localhost", "address of the node")
+	port := fs.String("port", "18999", "port of the node")
+	peerList := fs.String("peers", "", "comma separated host:port of the peers through which the node joins the cluster")
+	token := fs.String("token", os.Getenv(adminTokenEnv), "admin token; the admin endpoints are not served without it")
+	beta := fs.Float64("beta", 0, "expected fanout of the gossip rounds (default: the default beta)")
+	round := fs.Duration("round-duration", 0, "duration of the gossip rounds (default: the default round duration)")
+	bufferSize := fs.Int("buffer-size", 1024, "size of the messages buffer") // nolint: gomnd
+	debug := fs.Bool("debug", false, "serve the runtime profiles on /debug/pprof/ and the expvar variables on /debug/vars")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	seeds, err := parsePeers(*peerList)
+	if err != nil {
+		return err
+	}
+
+	node, err := bmmc.New(&bmmc.Config{
+		Addr:          *addr,
+		Port:          *port,
+		Beta:          *beta,
+		RoundDuration: *round,
+		BufferSize:    *bufferSize,
+		AdminToken:    *token,
+		Seeds:         seeds,
+		Debug:         *debug,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := node.Start(); err != nil {
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	return node.Stop()
+}
+
+// parsePeers parses a comma separated list of host:port.
+func parsePeers(list string) ([]bmmc.Peer, error) {
+	peers := []bmmc.Peer{}
+
+	for _, p := range strings.Split(list, ",") {
+		if p == "" {
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidPeer, p)
+		}
+
+		peers = append(peers, bmmc.Peer{Addr: host, Port: port})
+	}
+
+	return peers, nil
+}
+
+// client sends requests to the admin endpoints of a node.
+type client struct {
+	node  string
+	token string
+	http  *http.Client
+}
+
+// newClientFlags returns the flags of the commands which talk to a running
+// node, and the client configured by them.
+func newClientFlags(name string) (*flag.FlagSet, *client) {
+	c := &client{http: &http.Client{Timeout: requestTimeout}}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&c.node, "node", defaultNode, "host:port of the node")
+	fs.StringVar(&c.token, "token", os.Getenv(adminTokenEnv), "admin token of the node")
+
+	return fs, c
+}
+
+// do sends a request with given body, as json, to given admin endpoint and
+// decodes the response in out, if it is not nil.
+func (c *client) do(method, path string, body, out interface{}) error {
+	var r io.Reader
+
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		r = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequest(method, "http://"+c.node+path, r)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode >= http.StatusBadRequest {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, path, res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// send adds a message on a running node and prints its ID.
+func send(args []string) error {
+	fs, c := newClientFlags("send")
+	msg := fs.String("msg", "", "message to add")
+	cbType := fs.String("type", bmmc.NOCALLBACK, "callback type of the message")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *msg == "" {
+		return errMissingMessage
+	}
+
+	var out struct {
+		ID string `json:"id"`
+	}
+
+	body := map[string]interface{}{"payload": *msg, "callback_type": *cbType}
+	if err := c.do(http.MethodPost, "/admin/messages", body, &out); err != nil {
+		return err
+	}
+
+	fmt.Println(out.ID)
+
+	return nil
+}
+
+// peers prints the peers of a running node.
+func peers(args []string) error {
+	fs, c := newClientFlags("peers")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var statuses []bmmc.PeerStatus
+	if err := c.do(http.MethodGet, "/admin/peers", nil, &statuses); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) // nolint: gomnd
+	fmt.Fprintln(w, "HOST\tNODE ID\tHEALTH\tRTT\tREQUESTS\tFAILURES")
+
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\n",
+			net.JoinHostPort(s.Addr, s.Port), s.NodeID, s.Health, s.RTT, s.Requests, s.Failures)
+	}
+
+	return w.Flush()
+}
+
+// messages prints the messages of a running node.
+func messages(args []string) error {
+	fs, c := newClientFlags("messages")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var out struct {
+		Messages []bmmc.Message `json:"messages"`
+	}
+
+	if err := c.do(http.MethodGet, "/admin/messages", nil, &out); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) // nolint: gomnd
+	fmt.Fprintln(w, "ID\tTYPE\tORIGIN\tTIMESTAMP\tPAYLOAD")
+
+	for _, m := range out.Messages {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\n",
+			m.ID, m.CallbackType, m.Origin, m.Timestamp.Format(time.RFC3339), m.Payload)
+	}
+
+	return w.Flush()
+}
@@ -5,5 +5,7 @@ go 1.13
 require (
 	github.com/onsi/ginkgo v1.13.0
 	github.com/onsi/gomega v1.10.1
+	github.com/vmihailenco/msgpack/v5 v5.0.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/sys v0.0.0-20200622214017-ed371f2e16b4 // indirect
 )
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	deniedPublisherLogFmt  = "BMMC %s:%s dropped message %s, because %s may not publish %s messages"
+	deniedSubscriberLogFmt = "BMMC %s:%s denied the subscription of %s to %s messages"
+)
+
+var errDeniedSubscription = errors.New("subscription is not allowed")
+
+// TopicACL restricts which nodes may publish messages with a callback type,
+// and which clients may subscribe to them.
+type TopicACL struct {
+	// Publishers are the nodes (addr:port) which may add messages with the
+	// callback type. Messages added by other nodes are dropped when they are
+	// synchronized
+	// Optional (default: any node)
+	Publishers []string
+	// Subscribers are the identities of the clients which may stream the
+	// messages with the callback type
+	// Optional (default: any client)
+	Subscribers []string
+}
+
+// mayPublish returns true if the origin of given element may publish messages
+// with its callback type.
+func (b *BMMC) mayPublish(el buffer.Element) bool {
+	acl, ok := b.config.TopicACLs[el.CallbackType]
+	if !ok || len(acl.Publishers) == 0 {
+		return true
+	}
+
+	return containsString(acl.Publishers, el.Origin)
+}
+
+// maySubscribe returns true if the client with given identity may subscribe to
+// the messages with given callback type.
+func (b *BMMC) maySubscribe(identity, cbType string) bool {
+	acl, ok := b.config.TopicACLs[cbType]
+	if !ok || len(acl.Subscribers) == 0 {
+		return true
+	}
+
+	return containsString(acl.Subscribers, identity)
+}
+
+// remoteHost returns the host of the client of given request, without port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// containsString returns true if given strings contain given string.
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
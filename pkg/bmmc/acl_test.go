@@ -0,0 +1,92 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Topic ACLs", func() {
+	var transport *MemoryTransport
+
+	acls := map[string]TopicACL{
+		"restricted": {
+			Publishers:  []string{"localhost:3"},
+			Subscribers: []string{"trusted-client"},
+		},
+	}
+
+	withACLs := func(cfg *Config) {
+		cfg.TopicACLs = acls
+	}
+
+	BeforeEach(func() {
+		transport = NewMemoryTransport()
+	})
+
+	It("checks the publishers and the subscribers of callback types", func() {
+		b := startTestNode("1", withTransport(transport), withACLs)
+		defer b.Stop() // nolint: errcheck
+
+		Expect(b.mayPublish(buffer.Element{CallbackType: "restricted", Origin: "localhost:3"})).To(BeTrue())
+		Expect(b.mayPublish(buffer.Element{CallbackType: "restricted", Origin: "localhost:2"})).To(BeFalse())
+		Expect(b.mayPublish(buffer.Element{CallbackType: "open", Origin: "localhost:2"})).To(BeTrue())
+
+		Expect(b.maySubscribe("trusted-client", "restricted")).To(BeTrue())
+		Expect(b.maySubscribe("other-client", "restricted")).To(BeFalse())
+		Expect(b.maySubscribe("other-client", "open")).To(BeTrue())
+	})
+
+	It("drops the messages of nodes which may not publish them", func() {
+		receiver := startTestNode("1", withTransport(transport), withACLs)
+		defer receiver.Stop() // nolint: errcheck
+
+		sender := startTestNode("2", withTransport(transport))
+		defer sender.Stop() // nolint: errcheck
+
+		Expect(sender.AddPeer("localhost", "1")).To(Succeed())
+		Expect(sender.AddMessage("restricted message", "restricted")).To(Succeed())
+		Expect(sender.AddMessage("open message", "open")).To(Succeed())
+
+		Eventually(receiver.GetMessages, time.Second*5).Should(ContainElement("open message"))
+		Consistently(receiver.GetMessages, time.Millisecond*200).ShouldNot(ContainElement("restricted message"))
+	})
+
+	It("denies the subscriptions of clients which may not stream the messages", func() {
+		b := startTestNode("1", withTransport(transport), withACLs, func(cfg *Config) {
+			cfg.StreamMessages = true
+			cfg.SubscriberIdentity = func(r *http.Request) string {
+				return r.Header.Get("X-Client")
+			}
+		})
+		defer b.Stop() // nolint: errcheck
+
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:1"+streamRoute+"?type=restricted", nil)
+		Expect(err).To(Succeed())
+		req.Header.Set("X-Client", "other-client")
+
+		res, err := transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusForbidden))
+	})
+})
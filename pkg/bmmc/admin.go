@@ -0,0 +1,278 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	adminPeersRoute    = "/admin/peers"
+	adminMessagesRoute = "/admin/messages"
+	adminConfigRoute   = "/admin/config"
+
+	// bearerPrefix is the prefix of the Authorization header with AdminToken
+	bearerPrefix = "Bearer "
+
+	adminHandlerErrLogFmt = "Error in admin handler: %s"
+	adminPeerLogFmt       = "BMMC %s:%s %s peer %s:%s through the admin endpoints"
+	adminMessageLogFmt    = "BMMC %s:%s added message %s through the admin endpoints"
+)
+
+var (
+	errInvalidAdminToken = errors.New("invalid admin token")
+	errInvalidAdminPeer  = errors.New("peer must have an addr and a port")
+	errInvalidAdminMsg   = errors.New("message must have a payload")
+)
+
+// adminPeer is a peer added or removed through the admin endpoints.
+type adminPeer struct {
+	Addr string `json:"addr"`
+	Port string `json:"port"`
+}
+
+// adminMessage is a message added through the admin endpoints. Without
+// callback type, the message has no callback.
+type adminMessage struct {
+	Payload      interface{} `json:"payload"`
+	CallbackType string      `json:"callback_type"`
+}
+
+// adminMessageID is the ID of a message added through the admin endpoints.
+type adminMessageID struct {
+	ID string `json:"id"`
+}
+
+// adminMessages is the state of messages buffer served on the admin endpoints.
+type adminMessages struct {
+	Digest   []string  `json:"digest"`
+	Messages []Message `json:"messages"`
+}
+
+// adminConfig is the effective config served on the admin endpoints.
+// Callbacks, keys and tokens are not served.
+type adminConfig struct {
+	Addr                   string   `json:"addr"`
+	Port                   string   `json:"port"`
+	Beta                   float64  `json:"beta"`
+	AdaptiveBeta           bool     `json:"adaptive_beta"`
+	RoundDuration          string   `json:"round_duration"`
+	MaxRoundDuration       string   `json:"max_round_duration"`
+	RoundJitter            string   `json:"round_jitter"`
+	BufferSize             int      `json:"buffer_size"`
+	MaxBufferBytes         int      `json:"max_buffer_bytes"`
+	MessageTTL             string   `json:"message_ttl"`
+	MaxGossipCount         int64    `json:"max_gossip_count"`
+	MaxSyncMessages        int      `json:"max_sync_messages"`
+	MaxSyncBytes           int      `json:"max_sync_bytes"`
+	CompressionThreshold   int      `json:"compression_threshold"`
+	MaxFragmentSize        int      `json:"max_fragment_size"`
+	Roles                  Role     `json:"roles"`
+	Topics                 []string `json:"topics"`
+	MaxPeers               int      `json:"max_peers"`
+	RequestTimeout         string   `json:"request_timeout"`
+	PeerFailureThreshold   int      `json:"peer_failure_threshold"`
+	RetransmitTimeout      string   `json:"retransmit_timeout"`
+	SuspicionTimeout       string   `json:"suspicion_timeout"`
+	MaxConcurrentRequests  int      `json:"max_concurrent_requests"`
+	MaxConcurrentCallbacks int      `json:"max_concurrent_callbacks"`
+	LogLevel               string   `json:"log_level"`
+	Authenticated          bool     `json:"authenticated"`
+	TLS                    bool     `json:"tls"`
+}
+
+// newAdminConfig returns the effective config served on the admin endpoints.
+func newAdminConfig(cfg *Config) adminConfig {
+	return adminConfig{
+		Addr:                   cfg.Addr,
+		Port:                   cfg.Port,
+		Beta:                   cfg.Beta,
+		AdaptiveBeta:           cfg.AdaptiveBeta,
+		RoundDuration:          cfg.RoundDuration.String(),
+		MaxRoundDuration:       cfg.MaxRoundDuration.String(),
+		RoundJitter:            cfg.RoundJitter.String(),
+		BufferSize:             cfg.BufferSize,
+		MaxBufferBytes:         cfg.MaxBufferBytes,
+		MessageTTL:             cfg.MessageTTL.String(),
+		MaxGossipCount:         cfg.MaxGossipCount,
+		MaxSyncMessages:        cfg.MaxSyncMessages,
+		MaxSyncBytes:           cfg.MaxSyncBytes,
+		CompressionThreshold:   cfg.CompressionThreshold,
+		MaxFragmentSize:        cfg.MaxFragmentSize,
+		Roles:                  cfg.Roles,
+		Topics:                 cfg.Topics,
+		MaxPeers:               cfg.MaxPeers,
+		RequestTimeout:         cfg.RequestTimeout.String(),
+		PeerFailureThreshold:   cfg.PeerFailureThreshold,
+		RetransmitTimeout:      cfg.RetransmitTimeout.String(),
+		SuspicionTimeout:       cfg.SuspicionTimeout.String(),
+		MaxConcurrentRequests:  cfg.MaxConcurrentRequests,
+		MaxConcurrentCallbacks: cfg.MaxConcurrentCallbacks,
+		LogLevel:               cfg.LogLevel.String(),
+		Authenticated:          len(cfg.ClusterKey) > 0 || len(cfg.PeerTokens) > 0,
+		TLS:                    cfg.TLSConfig != nil,
+	}
+}
+
+// verifyAdminToken returns true if given request carries AdminToken as bearer token.
+func (b *BMMC) verifyAdminToken(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, bearerPrefix) {
+		return false
+	}
+
+	token := strings.TrimPrefix(auth, bearerPrefix)
+
+	return subtle.ConstantTimeCompare([]byte(b.config.AdminToken), []byte(token)) == 1
+}
+
+// adminHandler serves the admin endpoints with given handler, to the clients
+// which present AdminToken. The admin endpoints are not served without AdminToken.
+func (b *BMMC) adminHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if b.config.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !b.verifyAdminToken(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, errInvalidAdminToken.Error(), http.StatusUnauthorized)
+
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// writeAdminJSON writes given value as json.
+func (b *BMMC) writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		b.logf(ServerComponent, ErrorLevel, adminHandlerErrLogFmt, err)
+	}
+}
+
+// adminPeersHandler serves the status of the peers on GET, adds the peer from
+// the request body on POST and removes it on DELETE.
+func (b *BMMC) adminPeersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		b.writeAdminJSON(w, http.StatusOK, b.GetPeerStatuses())
+		return
+	}
+
+	var p adminPeer
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, err.Error(), bodyErrStatus(err))
+		return
+	}
+
+	if p.Addr == "" || p.Port == "" {
+		http.Error(w, errInvalidAdminPeer.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var err error
+
+	action := "added"
+
+	switch r.Method {
+	case http.MethodPost:
+		err = b.AddPeer(p.Addr, p.Port)
+	case http.MethodDelete:
+		action = "removed"
+		err = b.RemovePeer(p.Addr, p.Port)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b.logf(ServerComponent, InfoLevel, adminPeerLogFmt, b.config.Addr, b.config.Port, action, p.Addr, p.Port)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminMessagesHandler serves the digest and the messages of messages buffer
+// on GET and adds the message from the request body on POST.
+func (b *BMMC) adminMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		b.adminAddMessage(w, r)
+		return
+	}
+
+	messages := []Message{}
+
+	for _, el := range b.messageBuffer.All() {
+		if el.IsMessage() {
+			messages = append(messages, b.newMessage(el))
+		}
+	}
+
+	b.writeAdminJSON(w, http.StatusOK, adminMessages{
+		Digest:   b.messageBuffer.Digest(),
+		Messages: messages,
+	})
+}
+
+// adminAddMessage adds the message from the request body and serves its ID.
+func (b *BMMC) adminAddMessage(w http.ResponseWriter, r *http.Request) {
+	var m adminMessage
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, err.Error(), bodyErrStatus(err))
+		return
+	}
+
+	if m.Payload == nil {
+		http.Error(w, errInvalidAdminMsg.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if m.CallbackType == "" {
+		m.CallbackType = NOCALLBACK
+	}
+
+	el, err := b.newElement(m.Payload, m.CallbackType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the callbacks of the message are not canceled with the request
+	if _, err := b.addElement(context.Background(), el); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b.logf(ServerComponent, InfoLevel, adminMessageLogFmt, b.config.Addr, b.config.Port, el.ID)
+
+	b.writeAdminJSON(w, http.StatusCreated, adminMessageID{ID: el.ID})
+}
+
+// adminConfigHandler serves the effective config of the node.
+func (b *BMMC) adminConfigHandler(w http.ResponseWriter, _ *http.Request) {
+	b.writeAdminJSON(w, http.StatusOK, newAdminConfig(b.config))
+}
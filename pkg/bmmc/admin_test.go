@@ -0,0 +1,133 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin", func() {
+	const token = "admin-secret"
+
+	var transport *MemoryTransport
+
+	withAdminToken := func(cfg *Config) {
+		cfg.AdminToken = token
+	}
+
+	request := func(method, path, auth string, body io.Reader) *http.Response {
+		req, err := http.NewRequest(method, "http://localhost:1"+path, body)
+		Expect(err).To(Succeed())
+
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+
+		res, err := transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+
+		return res
+	}
+
+	BeforeEach(func() {
+		transport = NewMemoryTransport()
+	})
+
+	It("adds, lists and removes peers", func() {
+		b := startTestNode("1", withTransport(transport), withAdminToken)
+		defer b.Stop() // nolint: errcheck
+
+		res := request(http.MethodPost, adminPeersRoute, token, strings.NewReader(`{"addr":"localhost","port":"2"}`))
+		Expect(res.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(b.GetPeers()).To(ConsistOf("localhost/2"))
+
+		var statuses []PeerStatus
+		Expect(json.NewDecoder(request(http.MethodGet, adminPeersRoute, token, nil).Body).Decode(&statuses)).To(Succeed())
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].Port).To(Equal("2"))
+
+		res = request(http.MethodDelete, adminPeersRoute, token, strings.NewReader(`{"addr":"localhost","port":"2"}`))
+		Expect(res.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(b.GetPeers()).To(BeEmpty())
+
+		res = request(http.MethodPost, adminPeersRoute, token, strings.NewReader(`{"addr":"localhost"}`))
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("serves the messages buffer and the config, without secrets", func() {
+		b := startTestNode("1", withTransport(transport), withAdminToken, func(cfg *Config) {
+			cfg.ClusterKey = []byte("cluster-key")
+		})
+		defer b.Stop() // nolint: errcheck
+
+		Expect(b.AddMessage("admin message", NOCALLBACK)).To(Succeed())
+
+		var messages adminMessages
+		Expect(json.NewDecoder(request(http.MethodGet, adminMessagesRoute, token, nil).Body).Decode(&messages)).To(Succeed())
+		Expect(messages.Digest).To(HaveLen(1))
+		Expect(messages.Messages).To(HaveLen(1))
+		Expect(messages.Messages[0].Payload).To(Equal("admin message"))
+
+		body, err := ioutil.ReadAll(request(http.MethodGet, adminConfigRoute, token, nil).Body)
+		Expect(err).To(Succeed())
+		Expect(string(body)).To(ContainSubstring(`"buffer_size":16`))
+		Expect(string(body)).To(ContainSubstring(`"authenticated":true`))
+		Expect(string(body)).NotTo(ContainSubstring(token))
+	})
+
+	It("adds messages", func() {
+		b := startTestNode("1", withTransport(transport), withAdminToken)
+		defer b.Stop() // nolint: errcheck
+
+		res := request(http.MethodPost, adminMessagesRoute, token, strings.NewReader(`{"payload":"from admin"}`))
+		Expect(res.StatusCode).To(Equal(http.StatusCreated))
+
+		var id adminMessageID
+		Expect(json.NewDecoder(res.Body).Decode(&id)).To(Succeed())
+
+		m, err := b.GetMessage(id.ID)
+		Expect(err).To(Succeed())
+		Expect(m.Payload).To(Equal("from admin"))
+		Expect(m.CallbackType).To(Equal(NOCALLBACK))
+
+		res = request(http.MethodPost, adminMessagesRoute, token, strings.NewReader(`{"callback_type":"x"}`))
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("rejects the requests without the admin token", func() {
+		b := startTestNode("1", withTransport(transport), withAdminToken)
+		defer b.Stop() // nolint: errcheck
+
+		Expect(request(http.MethodGet, adminConfigRoute, "", nil).StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(request(http.MethodGet, adminConfigRoute, "wrong", nil).StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(request(http.MethodPut, adminPeersRoute, token, nil).StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("is not served by default", func() {
+		b := startTestNode("1", withTransport(transport))
+		defer b.Stop() // nolint: errcheck
+
+		Expect(request(http.MethodGet, adminPeersRoute, "", nil).StatusCode).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,110 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/validators"
+)
+
+const (
+	banPeerErrFmt       = "error at banning peer %s:%s: %w"
+	bannedPeerLogErrFmt = "Rejected request from banned peer %s:%s"
+)
+
+var (
+	errInvalidBanDuration = errors.New("ban duration must be positive")
+)
+
+// bans keeps the peers banned until an expiry time.
+type bans struct {
+	until map[string]time.Time
+	mux   sync.Mutex
+}
+
+// newBans creates an empty bans.
+func newBans() *bans {
+	return &bans{
+		until: map[string]time.Time{},
+	}
+}
+
+// ban bans given peer for given duration.
+func (b *bans) ban(addr, port string, duration time.Duration) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.until[fullHost(addr, port)] = time.Now().Add(duration)
+}
+
+// isBanned returns true if given peer is banned. Expired bans are removed.
+func (b *bans) isBanned(addr, port string) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	host := fullHost(addr, port)
+
+	until, ok := b.until[host]
+	if !ok {
+		return false
+	}
+
+	if time.Now().Before(until) {
+		return true
+	}
+
+	delete(b.until, host)
+
+	return false
+}
+
+// withoutBanned returns given peers, except the banned ones.
+func (b *bans) withoutBanned(peers []Peer) []Peer {
+	allowed := make([]Peer, 0, len(peers))
+
+	for _, p := range peers {
+		if !b.isBanned(p.Addr, p.Port) {
+			allowed = append(allowed, p)
+		}
+	}
+
+	return allowed
+}
+
+// BanPeer bans given peer for given duration. Until the ban expires, requests
+// from the peer are rejected and no messages are gossiped to it.
+func (b *BMMC) BanPeer(addr, port string, duration time.Duration) error {
+	if err := validators.AddrValidator()(addr); err != nil {
+		return fmt.Errorf(banPeerErrFmt, addr, port, err)
+	}
+
+	if err := validators.PortAsStringValidator()(port); err != nil {
+		return fmt.Errorf(banPeerErrFmt, addr, port, err)
+	}
+
+	if duration <= 0 {
+		return fmt.Errorf(banPeerErrFmt, addr, port, errInvalidBanDuration)
+	}
+
+	b.bans.ban(addr, port, duration)
+
+	return nil
+}
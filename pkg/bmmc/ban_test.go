@@ -0,0 +1,56 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bans", func() {
+	var b *bans
+
+	BeforeEach(func() {
+		b = newBans()
+	})
+
+	It("bans peers until the ban expires", func() {
+		b.ban("localhost", "10000", time.Millisecond*100)
+
+		Expect(b.isBanned("localhost", "10000")).To(BeTrue())
+		Expect(b.isBanned("localhost", "20000")).To(BeFalse())
+		Eventually(func() bool {
+			return b.isBanned("localhost", "10000")
+		}).Should(BeFalse())
+	})
+
+	It("filters out banned peers", func() {
+		peers := newDummyPeers("10000", "20000", "30000")
+		b.ban("localhost", "20000", time.Minute)
+
+		Expect(b.withoutBanned(peers)).To(Equal([]Peer{peers[0], peers[2]}))
+	})
+
+	It("returns error when ban duration is not positive", func() {
+		node := &BMMC{bans: b}
+		err := node.BanPeer("localhost", "10000", 0)
+		Expect(errors.Is(err, errInvalidBanDuration)).To(BeTrue())
+	})
+})
@@ -0,0 +1,161 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	addMessagesErrFmt = "error at adding messages: %w"
+)
+
+var (
+	errBatchKeyedMessage = errors.New("keyed messages can't be added in batches")
+)
+
+// AddMessages adds given messages in messages buffer under a single lock of
+// the buffer, so they are part of the same digest and are gossiped together.
+// Only the payload, the callback type, the max gossip count and the priority
+// of each message are used. Messages without callback type get NOCALLBACK.
+// Keyed messages are added with AddKeyedMessage. Either all the messages are
+// added, or none of them.
+func (b *BMMC) AddMessages(messages []Message) error {
+	return b.AddMessagesContext(context.Background(), messages)
+}
+
+// AddMessagesContext adds given messages in messages buffer, like AddMessages.
+// With BlockPolicy, it waits for room in buffer until the context is done.
+func (b *BMMC) AddMessagesContext(ctx context.Context, messages []Message) error {
+	type prepared struct {
+		message   buffer.Element
+		fragments []buffer.Element
+	}
+
+	batch := make([]prepared, 0, len(messages))
+	elements := make([]buffer.Element, 0, len(messages))
+
+	for _, msg := range messages {
+		if msg.Key != "" {
+			return fmt.Errorf(addMessagesErrFmt, errBatchKeyedMessage)
+		}
+
+		if msg.Priority < NormalPriority || msg.Priority > HighPriority {
+			return fmt.Errorf(addMessagesErrFmt, errInvalidPriority)
+		}
+
+		cbType := msg.CallbackType
+		if cbType == "" {
+			cbType = NOCALLBACK
+		}
+
+		m, err := b.newElement(msg.Payload, cbType)
+		if err != nil {
+			return fmt.Errorf(addMessagesErrFmt, err)
+		}
+
+		m.MaxGossipCount = msg.MaxGossipCount
+		m.Priority = int(msg.Priority)
+
+		m, fragments, err := b.prepareElement(m)
+		if err != nil {
+			return fmt.Errorf(addMessagesErrFmt, err)
+		}
+
+		batch = append(batch, prepared{message: m, fragments: fragments})
+		elements = append(append(elements, fragments...), m)
+	}
+
+	if err := b.addAllToBufferWithPolicy(ctx, elements); err != nil {
+		return fmt.Errorf(addMessagesErrFmt, err)
+	}
+
+	disseminated := []buffer.Element{}
+	for _, p := range batch {
+		disseminated = append(disseminated, b.deliverAdded(p.message, p.fragments)...)
+	}
+
+	b.multicast(disseminated)
+	b.flushUrgent(disseminated)
+
+	return nil
+}
+
+// addAllToBufferWithPolicy adds given elements in messages buffer, under a
+// single lock, following the configured policy when the buffer is full.
+func (b *BMMC) addAllToBufferWithPolicy(ctx context.Context, elements []buffer.Element) error {
+	var err error
+
+	switch b.config.BufferFullPolicy {
+	case RejectPolicy:
+		err = b.messageBuffer.AddAllIfNotFull(elements)
+
+	case BlockPolicy:
+		for {
+			freed := b.messageBuffer.Freed()
+
+			err = b.messageBuffer.AddAllIfNotFull(elements)
+			if !errors.Is(err, ErrBufferFull) {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf(waitBufferErrFmt, err, ctx.Err())
+			case <-freed:
+			}
+		}
+
+	default:
+		err = b.messageBuffer.AddAll(elements)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	b.messagesAdded()
+
+	return nil
+}
+
+// GetMessagesPage returns at most limit messages, skipping the first offset
+// messages, ordered from the oldest to the newest. Only the returned messages
+// are copied from buffer.
+func (b *BMMC) GetMessagesPage(offset, limit int) ([]Message, error) {
+	if limit <= 0 {
+		return nil, errInvalidLimit
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	return b.newMessageList(b.messageBuffer.ElementsPage(offset, limit)), nil
+}
+
+// GetMessagesSince returns the messages created after given time, ordered
+// from the oldest to the newest, e.g. the messages added since the last read
+// of an application. Only the returned messages are copied from buffer.
+func (b *BMMC) GetMessagesSince(t time.Time) []Message {
+	return b.newMessageList(b.messageBuffer.ElementsSince(t))
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Batches", func() {
+	// withFullPolicy makes the buffer of a node hold 8 messages, with given
+	// policy when it is full
+	withFullPolicy := func(policy BufferFullPolicy) func(*Config) {
+		return func(cfg *Config) {
+			cfg.BufferSize = 8
+			cfg.BufferFullPolicy = policy
+		}
+	}
+
+	It("adds and disseminates batches of messages", func() {
+		transport := NewMemoryTransport()
+
+		nodes := []*BMMC{
+			startTestNode("1", withTransport(transport)),
+			startTestNode("2", withTransport(transport)),
+		}
+		for _, b := range nodes {
+			defer b.Stop() // nolint: errcheck
+		}
+
+		Expect(nodes[0].AddPeer("localhost", "2")).To(Succeed())
+
+		calls := make(chan string, 3)
+		Expect(nodes[1].RegisterCallback("batch", func(_ context.Context, m Message) error {
+			calls <- m.Payload.(string)
+			return nil
+		})).To(Succeed())
+
+		Expect(nodes[0].AddMessages([]Message{
+			{Payload: "first", CallbackType: "batch"},
+			{Payload: "second", CallbackType: "batch"},
+			{Payload: "third"},
+		})).To(Succeed())
+
+		Expect(nodes[0].GetMessagesByType(NOCALLBACK)).To(HaveLen(1))
+		Eventually(nodes[1].GetMessages, time.Second*5).Should(ContainElements("first", "second", "third"))
+		Eventually(calls).Should(Receive())
+		Eventually(calls).Should(Receive())
+	})
+
+	It("rejects the batches which don't fit or have keyed messages", func() {
+		b := newTestNode("1", withFullPolicy(RejectPolicy))
+
+		messages := make([]Message, 9)
+		for i := range messages {
+			messages[i] = Message{Payload: strconv.Itoa(i)}
+		}
+
+		Expect(b.AddMessages(messages)).To(MatchError(ContainSubstring(ErrBufferFull.Error())))
+		Expect(b.BufferLength()).To(BeZero())
+
+		Expect(b.AddMessages([]Message{{Payload: "keyed", Key: "key"}})).To(
+			MatchError(ContainSubstring(errBatchKeyedMessage.Error())))
+	})
+
+	It("waits for room in buffer until the context is done, with BlockPolicy", func() {
+		b := newTestNode("1", withFullPolicy(BlockPolicy))
+
+		for i := 0; i < 8; i++ {
+			Expect(b.AddMessage(strconv.Itoa(i), NOCALLBACK)).To(Succeed())
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		err := b.AddMessagesContext(ctx, []Message{{Payload: "blocked"}})
+		Expect(err).To(MatchError(ContainSubstring(context.DeadlineExceeded.Error())))
+		Expect(b.GetMessages()).NotTo(ContainElement("blocked"))
+	})
+
+	It("returns pages of messages and the messages since a time", func() {
+		b := newTestNode("1")
+
+		Expect(b.AddMessage("old", NOCALLBACK)).To(Succeed())
+
+		since := time.Now()
+
+		time.Sleep(time.Millisecond)
+		Expect(b.AddMessages([]Message{{Payload: "new"}, {Payload: "newer"}})).To(Succeed())
+
+		page, err := b.GetMessagesPage(0, 2)
+		Expect(err).To(Succeed())
+		Expect(page).To(HaveLen(2))
+		Expect(page[0].Payload).To(Equal("old"))
+
+		page, err = b.GetMessagesPage(2, 2)
+		Expect(err).To(Succeed())
+		Expect(page).To(HaveLen(1))
+
+		_, err = b.GetMessagesPage(0, 0)
+		Expect(err).To(MatchError(errInvalidLimit))
+
+		Expect(b.GetMessagesSince(since)).To(ConsistOf(
+			WithTransform(func(m Message) interface{} { return m.Payload }, Equal("new")),
+			WithTransform(func(m Message) interface{} { return m.Payload }, Equal("newer")),
+		))
+	})
+})
@@ -0,0 +1,152 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+)
+
+const (
+	// bloomFalsePositiveRate is the false positive rate of the bloom filters sent instead of digests
+	bloomFalsePositiveRate = 0.01
+	// maxBloomHashes is the maximum number of hash functions accepted in received bloom filters
+	maxBloomHashes = 32
+
+	defaultFullDigestInterval = 10
+)
+
+// HTTPDigestBloom is a bloom filter with the IDs of a digest. It is sent
+// instead of large digests to the peers which support it.
+type HTTPDigestBloom struct {
+	Bits   []byte `json:"bits"`
+	Hashes int    `json:"hashes"`
+	// Count is the number of IDs in the filter
+	Count int `json:"count"`
+}
+
+// newDigestBloom creates a bloom filter sized for given IDs and adds them in it.
+func newDigestBloom(ids []string) *HTTPDigestBloom {
+	n := float64(len(ids))
+	if n < 1 {
+		n = 1
+	}
+
+	bits := math.Ceil(-n * math.Log(bloomFalsePositiveRate) / (math.Ln2 * math.Ln2))
+	hashes := int(math.Round(bits / n * math.Ln2))
+
+	if hashes < 1 {
+		hashes = 1
+	}
+
+	f := &HTTPDigestBloom{
+		Bits:   make([]byte, (int(bits)+7)/8), // nolint: gomnd
+		Hashes: hashes,
+	}
+
+	for _, id := range ids {
+		f.add(id)
+	}
+
+	return f
+}
+
+// positions returns the positions of the bits of given ID, using double hashing.
+func (f *HTTPDigestBloom) positions(id string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(id)) // nolint: errcheck
+	sum := h.Sum64()
+
+	h1, h2 := sum&math.MaxUint32, sum>>32|1 // nolint: gomnd
+	m := uint64(len(f.Bits)) * 8            // nolint: gomnd
+
+	positions := make([]uint64, f.Hashes)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % m
+	}
+
+	return positions
+}
+
+// add adds given ID in filter.
+func (f *HTTPDigestBloom) add(id string) {
+	for _, p := range f.positions(id) {
+		f.Bits[p/8] |= 1 << (p % 8) // nolint: gomnd
+	}
+
+	f.Count++
+}
+
+// has returns true if given ID is probably in filter. Invalid filters contain no ID.
+func (f *HTTPDigestBloom) has(id string) bool {
+	if len(f.Bits) == 0 || f.Hashes < 1 || f.Hashes > maxBloomHashes {
+		return false
+	}
+
+	for _, p := range f.positions(id) {
+		if f.Bits[p/8]&(1<<(p%8)) == 0 { // nolint: gomnd
+			return false
+		}
+	}
+
+	return true
+}
+
+// missingFrom returns the IDs which are not in filter.
+func (f *HTTPDigestBloom) missingFrom(ids []string) []string {
+	missing := []string{}
+
+	for _, id := range ids {
+		if !f.has(id) {
+			missing = append(missing, id)
+		}
+	}
+
+	return missing
+}
+
+// compactDigest returns true if the digest with given size is sent as a bloom
+// filter to given peer. Every FullDigestInterval rounds the full digest is
+// sent, so the messages hidden by false positives are eventually solicited.
+func (b *BMMC) compactDigest(addr, port string, size int) bool {
+	return b.config.CompactDigestThreshold > 0 && size >= b.config.CompactDigestThreshold &&
+		b.gossipRound.GetNumber()%int64(b.config.FullDigestInterval) != 0 &&
+		b.peerProtocols.get(addr, port).has(capDigestBloom)
+}
+
+// solicitWithBloom answers a gossip message with a bloom filter. The digest
+// of the gossiper can't be listed, so the node sends a bloom filter with its
+// own digest and the recently delivered messages, and the gossiper answers
+// with the messages missing from it.
+func (b *BMMC) solicitWithBloom(ctx context.Context, gossipMsg HTTPGossip) error {
+	digest := b.messageBuffer.Digest()
+
+	// the buffers are probably the same
+	if gossipMsg.Bloom.Count == len(digest) && len(gossipMsg.Bloom.missingFrom(digest)) == 0 {
+		return nil
+	}
+
+	return b.sendSolicitation(ctx, HTTPSolicitation{
+		Envelope:    b.envelope(),
+		Addr:        b.config.Addr,
+		Port:        b.config.Port,
+		RoundNumber: gossipMsg.RoundNumber,
+		Digest:      []string{},
+		Bloom:       newDigestBloom(append(digest, b.seen.list()...)),
+	}, gossipMsg.Addr, gossipMsg.Port)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Digest bloom filter", func() {
+	It("contains the added IDs and few others", func() {
+		ids := []string{}
+		for i := 0; i < 1000; i++ {
+			ids = append(ids, fmt.Sprintf("id-%d", i))
+		}
+
+		f := newDigestBloom(ids)
+		Expect(f.Count).To(Equal(1000))
+		Expect(f.missingFrom(ids)).To(BeEmpty())
+
+		others := []string{}
+		for i := 0; i < 1000; i++ {
+			others = append(others, fmt.Sprintf("other-%d", i))
+		}
+
+		Expect(len(f.missingFrom(others))).To(BeNumerically(">", 950))
+		Expect(len(f.Bits)).To(BeNumerically("<", 1300))
+	})
+
+	It("doesn't contain any ID when it is invalid", func() {
+		Expect((&HTTPDigestBloom{}).has("id")).To(BeFalse())
+		Expect((&HTTPDigestBloom{Bits: []byte{0xFF}, Hashes: maxBloomHashes + 1}).has("id")).To(BeFalse())
+	})
+
+	It("disseminates the messages when peers exchange bloom filters", func() {
+		transport := NewMemoryTransport()
+		nodes := []*BMMC{}
+
+		for _, port := range []string{"1", "2"} {
+			node, err := New(&Config{
+				Addr:                   "localhost",
+				Port:                   port,
+				BufferSize:             64,
+				RoundDuration:          time.Millisecond * 20,
+				CompactDigestThreshold: 1,
+				FullDigestInterval:     1 << 30,
+				Transport:              transport,
+				Logger:                 log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+			Expect(node.Start()).To(Succeed())
+
+			defer node.Stop() // nolint: errcheck
+
+			nodes = append(nodes, node)
+		}
+
+		Expect(nodes[0].AddPeer("localhost", "2")).To(Succeed())
+		Expect(nodes[1].AddPeer("localhost", "1")).To(Succeed())
+
+		// the digests are compact once the nodes negotiated their protocols
+		Eventually(func() bool {
+			return nodes[0].compactDigest("localhost", "2", 1)
+		}, time.Second*5).Should(BeTrue())
+
+		messages := []interface{}{}
+
+		for i := 0; i < 10; i++ {
+			msg := fmt.Sprintf("message %d", i)
+			Expect(nodes[0].AddMessage(msg, NOCALLBACK)).To(Succeed())
+
+			messages = append(messages, msg)
+		}
+
+		Eventually(nodes[1].GetMessages, time.Second*5).Should(ContainElements(messages...))
+	})
+})
@@ -17,12 +17,19 @@ limitations under the License.
 package bmmc
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
 	"github.com/rstefan1/bimodal-multicast/pkg/internal/callback"
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/detector"
 	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
 )
 
@@ -36,11 +43,28 @@ const (
 	runDefaultCallbackErrFmt = "error at calling default callback at %s:%s for message %s in round %d"
 	runCustomCallbackErrFmt  = "error at calling custom callback at %s:%s for message %s in round %d"
 
+	waitBufferErrFmt = "%w: %s"
+
 	createCustomCRErrFmt  = "error at creating new custom callbacks registry: %w"
 	createDefaultCRErrFmt = "error at creating new default callbacks registry: %w"
+	createTypedCRErrFmt   = "error at creating new typed callbacks registry: %w"
+	createNodeIDErrFmt    = "error at generating node id: %w"
+
+	// defaultRequestTimeout is the default timeout of the requests sent to peers
+	defaultRequestTimeout = time.Second * 10
+)
 
-	// netClientTimeout is the timeout for http client
-	netClientTimeout = time.Second * 10
+var (
+	// ErrBufferFull is returned by AddMessage when the messages buffer is full.
+	ErrBufferFull = buffer.ErrFull
+	// ErrForcedShutdown is returned by Stop when the in-flight requests didn't
+	// finish before the shutdown timeout and were interrupted.
+	ErrForcedShutdown = errors.New("shutdown timeout exceeded, in-flight requests were interrupted")
+	// ErrPeerUnreachable is reported on the errors channel when
+	// PeerFailureThreshold consecutive requests to a peer failed.
+	ErrPeerUnreachable = errors.New("peer is unreachable")
+
+	errInvalidRounds = errors.New("number of rounds must be positive")
 )
 
 // BMMC is the bimodal multicast protocol.
@@ -59,17 +83,156 @@ type BMMC struct {
 	customCallbacks *callback.CustomRegistry
 	// default callback registry
 	defaultCallbacks *callback.DefaultRegistry
+	// typed callback registry
+	typedCallbacks *callback.TypedRegistry
 	// stop channel
 	stop chan struct{}
+	// ctx is the context of the requests sent to peers and of the gossip
+	// rounds; it is canceled when the node is stopped. It is replaced, and the
+	// previous one is canceled, when the node is started, so it is read with
+	// runContext
+	ctx    context.Context
+	cancel context.CancelFunc
+	ctxMux sync.RWMutex
 	// netClient is the http client
 	netClient *http.Client
-
-	// TODO remove the following field
-	selectedPeers []bool
+	// newMessages is 1 if messages were added in buffer since the last round
+	newMessages int32
+	// wake is signaled when messages are added in buffer, so the wait for
+	// the next round isn't lengthened past RoundDuration
+	wake chan struct{}
+	// adaptiveRoundDuration is the last duration of adaptive gossip rounds
+	adaptiveRoundDuration time.Duration
+	// reassembler collects fragments of fragmented messages
+	reassembler *reassembler
+	// deltaStates keeps the states replicated by deltas
+	deltaStates *deltaStates
+	// peerRoles keeps the roles announced by peers
+	peerRoles *peerRoles
+	// peerTopics keeps the topics announced by peers
+	peerTopics *peerTopics
+	// peerProtocols keeps the protocols negotiated with peers
+	peerProtocols *peerProtocols
+	// passiveView keeps the known peers which are not in the active view
+	passiveView *passiveView
+	// coordinates keeps the network coordinates of this node and of peers
+	coordinates *coordinates
+	// syncBucket limits the outbound synchronization traffic; it is nil if there is no limit
+	syncBucket *tokenBucket
+	// rateLimiter limits the inbound protocol requests, if RateLimit is set
+	rateLimiter *rateLimiter
+	// callbackSlots are the slots of MaxConcurrentCallbacks; it is nil if there is no limit
+	callbackSlots chan struct{}
+	// callbackJobs is the queue of the callback workers; it is nil if there are no workers
+	callbackJobs chan callbackJob
+	// sampler samples uniformly random peers; it is nil if peer sampling is disabled
+	sampler *peerSampler
+	// bans keeps the banned peers
+	bans *bans
+	// peerScores keeps the responsiveness of peers
+	peerScores *peerScores
+	// partitions keeps the unreachable peers
+	partitions *partitions
+	// callbacks keeps the callbacks which receive a context and the messages
+	callbacks *callbacks
+	// acks keeps the messages which wait for the acknowledgements of a quorum of peers
+	acks *acks
+	// configMux guards the config fields which can be updated at runtime
+	configMux sync.RWMutex
+	// nodeIDs keeps the hosts of the peers by their node ID
+	nodeIDs *nodeIDs
+	// multicaster sends and receives the multicast packets, if Multicast is set
+	multicaster *multicaster
+	// clock is the hybrid logical clock which stamps the messages
+	clock *hybridClock
+	// detector detects the dead peers; it is nil if failure detection is disabled
+	detector *detector.Detector
+	// counters keeps the protocol counters
+	counters *counters
+	// hooks keeps the observers of the node events
+	hooks *hooks
+	// roundDurations keeps the distribution of the durations of gossip rounds
+	roundDurations *histogram
+	// syncLatencies keeps the distribution of the durations in which the
+	// synchronizations from peers are handled
+	syncLatencies *histogram
+	// tombstones keeps the IDs of removed messages
+	tombstones *tombstones
+	// seen keeps the IDs of recently delivered messages
+	seen *seenCache
+	// watchers keeps the watchers of keyed messages
+	watchers *watchers
+	// streams keeps the streams of delivered messages
+	streams *streams
+	// subscribers keeps the subscribers to delivered messages
+	subscribers *subscribers
+	// messageStore keeps a copy of the messages buffer which is restored at creation
+	messageStore buffer.Store
+	// storeMux serializes the synchronizations of the message store
+	storeMux sync.Mutex
+	// joinMux serializes the joins handled by this node
+	joinMux sync.Mutex
+	// restored is true if the state of the node was restored from DataDir
+	restored bool
+	// spawn runs the requests sent in background
+	spawn func(func())
+	// errs receives the runtime errors of the http server
+	errs chan error
+	// served is closed when the http server doesn't serve requests anymore
+	served chan struct{}
+	// routes are the endpoints of the protocol, by path
+	routes map[string]route
+	// state is the lifecycle state of the node. It is updated atomically
+	state int32
+	// started is the time when the node was started, in unix nanoseconds.
+	// It is updated atomically
+	started int64
+	// recentDeliveries keeps the last delivered messages, for dashboard
+	recentDeliveries *recentDeliveries
+	// reportedHosts caches the resolutions of the host names reported by peers
+	reportedHosts *reportedHosts
+	// clusterKeys authenticate the protocol requests, if ClusterKey is set
+	clusterKeys *clusterKeys
+	// tlsConfig is the tls config of the server; it is nil if the server doesn't use tls
+	tlsConfig *tls.Config
+	// retransmissions keeps the critical messages which are not acknowledged by all peers
+	retransmissions *retransmissions
+	// loss estimates the effective message loss
+	loss *lossEstimator
+	// miss adapts beta to the miss rate, when MaxBeta is set
+	miss *missEstimator
+	// callbackLogger is the logger passed to callbacks
+	callbackLogger *log.Logger
+	// quotas keeps the usage of OriginQuota; it is nil if there is no quota
+	quotas *originQuotas
+	// causal stamps the messages with vector clocks; it is nil without CausalOrdering
+	causal *causalOrder
+	// order delivers the messages in the configured order; it is nil with NoOrdering
+	order orderer
+	// lastSeq is the sequence number of the last ordered message added by the
+	// node. It is updated atomically
+	lastSeq uint64
+	// seqEpoch is the creation time of the node, in unix nanoseconds, which
+	// distinguishes its sequence numbers from the ones of its previous runs
+	seqEpoch int64
+	// pulling is 1 while a bulk synchronization runs in background. It is
+	// updated atomically
+	pulling int32
+	// initiallySynced is 1 when the messages buffer was synchronized with a
+	// peer after the node was started (see ReadyAfterSync). It is updated atomically
+	initiallySynced int32
+	// inflight is the number of requests received, or sent in background,
+	// which didn't finish. It is updated atomically
+	inflight int64
 }
 
 // New creates a new instance for the protocol.
 func New(cfg *Config) (*BMMC, error) {
+	// set the parameters of the profile which were not given
+	if err := cfg.applyProfile(); err != nil {
+		return nil, err
+	}
+
 	// validate given config
 	if err := cfg.validate(); err != nil {
 		return nil, err
@@ -78,6 +241,15 @@ func New(cfg *Config) (*BMMC, error) {
 	// fill optional fields of the config
 	cfg.fillEmptyFields()
 
+	if cfg.NodeID == "" {
+		id, err := newNodeID()
+		if err != nil {
+			return nil, fmt.Errorf(createNodeIDErrFmt, err)
+		}
+
+		cfg.NodeID = id
+	}
+
 	// set callbacks
 	cbCustomRegistry, err := callback.NewCustomRegistry(cfg.Callbacks)
 	if err != nil {
@@ -89,6 +261,11 @@ func New(cfg *Config) (*BMMC, error) {
 		return nil, fmt.Errorf(createDefaultCRErrFmt, err)
 	}
 
+	cbTypedRegistry, err := callback.NewTypedRegistry(cfg.TypedCallbacks)
+	if err != nil {
+		return nil, fmt.Errorf(createTypedCRErrFmt, err)
+	}
+
 	// create an instance of the protocol
 	b := &BMMC{
 		config:           cfg,
@@ -97,60 +274,482 @@ func New(cfg *Config) (*BMMC, error) {
 		gossipRound:      NewGossipRound(),
 		customCallbacks:  cbCustomRegistry,
 		defaultCallbacks: cbDefaultRegistry,
-		netClient: &http.Client{
-			Timeout: netClientTimeout,
-		},
+		typedCallbacks:   cbTypedRegistry,
+		reassembler:      newReassembler(),
+		deltaStates:      newDeltaStates(cfg.DeltaStates),
+		peerRoles:        newPeerRoles(),
+		peerTopics:       newPeerTopics(),
+		peerProtocols:    newPeerProtocols(),
+		passiveView:      newPassiveView(),
+		coordinates:      newCoordinates(),
+		loss:             newLossEstimator(),
+		retransmissions:  newRetransmissions(),
+		bans:             newBans(),
+		peerScores:       newPeerScores(),
+		partitions:       newPartitions(),
+		acks:             newAcks(),
+		nodeIDs:          newNodeIDs(),
+		callbacks:        newCallbacks(cfg.ContextCallbacks),
+		clock:            newHybridClock(),
+		counters:         &counters{},
+		hooks:            newHooks(),
+		roundDurations:   newHistogram(),
+		syncLatencies:    newHistogram(),
+		tombstones:       newTombstones(),
+		seen:             newSeenCache(cfg.SeenCacheSize),
+		watchers:         newWatchers(),
+		streams:          newStreams(),
+		subscribers:      newSubscribers(cfg.SubscriptionBufferSize, cfg.SubscriptionFullPolicy),
+		recentDeliveries: newRecentDeliveries(),
+		reportedHosts:    newReportedHosts(),
+		errs:             make(chan error, errorsBufferSize),
+		wake:             make(chan struct{}, 1),
+		seqEpoch:         time.Now().UnixNano(),
+	}
+
+	b.spawn = b.spawnInflight
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+
+	if len(cfg.ClusterKey) > 0 {
+		b.clusterKeys = newClusterKeys(cfg.ClusterKey)
+	}
+
+	b.messageBuffer.SetMaxBytes(cfg.MaxBufferBytes)
+	b.peerBuffer.SetMaxPeers(cfg.MaxPeers)
+
+	if cfg.OriginQuota.enabled() {
+		b.quotas = newOriginQuotas(cfg.OriginQuota)
+	}
+
+	switch cfg.Ordering {
+	case CausalOrdering:
+		b.causal = newCausalOrder()
+		b.order = b.causal
+	case FIFOOrdering:
+		b.order = newFIFOOrder()
+	}
+
+	if cfg.SamplerSize > 0 {
+		b.sampler = newPeerSampler(cfg.SamplerSize)
+	}
+
+	if cfg.MaxSyncBytesPerSecond > 0 {
+		b.syncBucket = newTokenBucket(cfg.MaxSyncBytesPerSecond)
+	}
+
+	// the rate limit can be set on a running node, with UpdateConfig
+	b.rateLimiter = newRateLimiter(cfg.RateLimit)
+
+	if cfg.MaxConcurrentCallbacks > 0 {
+		b.callbackSlots = make(chan struct{}, cfg.MaxConcurrentCallbacks)
+	}
+
+	if cfg.CallbackPolicy.Workers > 0 {
+		b.callbackJobs = make(chan callbackJob, cfg.CallbackPolicy.QueueSize)
+	}
+
+	if cfg.SuspicionTimeout > 0 {
+		b.detector = detector.New(cfg.SuspicionTimeout)
+	}
+
+	pooled := newPooledTransport(cfg)
+
+	var transport http.RoundTripper = pooled
+	if cfg.Transport != nil {
+		transport = cfg.Transport
+	}
+
+	if cfg.TLSConfig != nil {
+		server, client, err := cfg.TLSConfig.load()
+		if err != nil {
+			return nil, err
+		}
+
+		b.tlsConfig = server
+		transport = newHTTPSTransport(pooled, client)
+	}
+
+	transport = &poolTransport{next: transport, counters: b.counters}
+
+	if b.clusterKeys != nil {
+		transport = &signingTransport{next: transport, keys: b.clusterKeys}
+	}
 
-		// TODO remove the following line
-		selectedPeers: make([]bool, peer.MAXPEERS),
+	if cfg.NodeToken != "" {
+		transport = &tokenTransport{next: transport, node: fullHost(cfg.Addr, cfg.Port), token: cfg.NodeToken}
 	}
 
+	if cfg.MaxConcurrentRequests > 0 {
+		transport = newLimitingTransport(transport, cfg.MaxConcurrentRequests)
+	}
+
+	if cfg.Recorder != nil {
+		transport = &recordingTransport{
+			next:     transport,
+			recorder: cfg.Recorder,
+			node:     fullHost(cfg.Addr, cfg.Port),
+			logger:   b.loggerFor(GossipComponent, WarnLevel),
+		}
+	}
+
+	b.callbackLogger = b.loggerFor(CallbackComponent, InfoLevel)
+
+	if cfg.AdaptiveBeta && cfg.MaxBeta > 0 {
+		b.miss = newMissEstimator(cfg.Beta, cfg.MinBeta, cfg.MaxBeta)
+	}
+
+	b.netClient = &http.Client{
+		Timeout: cfg.RequestTimeout,
+		// the requests not sent while the node backs off from a peer are
+		// not failures of the peer
+		Transport: newBackoffTransport(&scoringTransport{
+			next:        transport,
+			scores:      b.peerScores,
+			counters:    b.counters,
+			coordinates: b.coordinates,
+			loss:        b.loss,
+			detector:    b.detector,
+			report:      b.reportPeerFailures,
+			reachable:   b.peerReachable,
+			assess:      b.assessPeer,
+		}, b),
+	}
+
+	b.peerBuffer.OnAdded(b.notifyPeerAdded)
+	b.peerBuffer.OnRemoved(b.notifyPeerRemoved)
+
+	b.routes = b.newRoutes()
 	b.server = b.newServer()
 
+	if err := b.persistPeers(); err != nil {
+		return nil, err
+	}
+
+	if err := b.recoverState(); err != nil {
+		return nil, err
+	}
+
 	return b, nil
 }
 
 // Start starts the gossip server and the http server.
 func (b *BMMC) Start() error {
+	return b.StartContext(context.Background())
+}
+
+// StartContext starts the gossip server and the http server. When ctx is
+// done, the gossip rounds stop and the requests sent to peers are canceled;
+// the node must still be stopped. The requests sent to peers before the node
+// was started, e.g. the pushes of high priority messages, are canceled.
+func (b *BMMC) StartContext(ctx context.Context) error {
+	b.setState(StartingState)
 	b.stop = make(chan struct{})
 
+	runCtx, cancel := context.WithCancel(ctx)
+
+	b.ctxMux.Lock()
+	b.cancel()
+	b.ctx, b.cancel = runCtx, cancel
+	b.ctxMux.Unlock()
+
+	// the multicast sockets are closed when ctx is canceled
+	if b.config.Multicast.enabled() {
+		if err := b.startMulticast(runCtx); err != nil {
+			cancel()
+			b.setState(CreatedState)
+
+			return err
+		}
+	}
+
 	// start http server
 	if err := b.startServer(b.stop); err != nil {
+		cancel()
+		b.setState(CreatedState)
+
 		return err
 	}
 
 	// start gossiper
 	go func() {
-		b.startGossiper(b.stop)
+		b.startGossiper(runCtx.Done())
 	}()
 
+	go b.rejoin()
+	go b.bootstrap(b.stop)
+
+	b.startCallbackWorkers(runCtx)
+
+	if b.detector != nil {
+		go b.probePeers(b.stop)
+	}
+
+	if b.config.DiscoveryInterval > 0 && len(b.config.Discoverers) > 0 {
+		go b.refreshPeers(runCtx)
+	}
+
+	atomic.StoreInt32(&b.initiallySynced, 0)
+
+	if b.config.ReadyAfterSync && b.joinsCluster() {
+		go b.syncInitially(runCtx)
+	}
+
+	atomic.StoreInt64(&b.started, time.Now().UnixNano())
+	b.setState(RunningState)
+
 	return nil
 }
 
-// Stop stops the gossip server and the http server.
-func (b *BMMC) Stop() {
+// Stop stops the gossip server and the http server. It waits for the in-flight
+// requests until ShutdownTimeout and returns ErrForcedShutdown if they didn't finish.
+func (b *BMMC) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.ShutdownTimeout)
+	defer cancel()
+
+	return b.StopContext(ctx)
+}
+
+// StopContext stops the gossip server and the http server. It blocks until
+// both servers are down, waiting for the in-flight requests until ctx is done,
+// and returns ErrForcedShutdown if they didn't finish.
+func (b *BMMC) StopContext(ctx context.Context) error {
+	b.setState(StoppingState)
+	b.cancelContext()
 	close(b.stop)
+
+	err := b.gracefullyShutdown(ctx)
+	close(b.errs)
+
+	b.watchers.close()
+	b.subscribers.close()
+	b.saveMessages()
+	b.closeMessageStore()
+
+	b.setState(StoppedState)
+
+	return err
+}
+
+// runContext returns the context of the requests sent to peers, which is
+// canceled when the node is stopped.
+func (b *BMMC) runContext() context.Context {
+	b.ctxMux.RLock()
+	defer b.ctxMux.RUnlock()
+
+	return b.ctx
+}
+
+// cancelContext cancels the context of the requests sent to peers.
+func (b *BMMC) cancelContext() {
+	b.ctxMux.RLock()
+	defer b.ctxMux.RUnlock()
+
+	b.cancel()
+}
+
+// spawnInflight runs given func in background and keeps track of it until it returns.
+func (b *BMMC) spawnInflight(f func()) {
+	atomic.AddInt64(&b.inflight, 1)
+
+	go func() {
+		defer atomic.AddInt64(&b.inflight, -1)
+
+		f()
+	}()
 }
 
 // AddMessage adds new message in messages buffer.
 func (b *BMMC) AddMessage(msg interface{}, callbackType string) error {
-	m, err := buffer.NewElement(msg, callbackType)
+	return b.AddMessageContext(context.Background(), msg, callbackType)
+}
+
+// AddMessageContext adds new message in messages buffer.
+// With BlockPolicy, it waits for room in buffer until the context is done.
+func (b *BMMC) AddMessageContext(ctx context.Context, msg interface{}, callbackType string) error {
+	_, err := b.addMessage(ctx, msg, callbackType)
+
+	return err
+}
+
+// AddMessageWithTTL adds new message in messages buffer, which is gossiped in
+// the digests of each node for at most given number of rounds. After that, it
+// is only sent to the peers which solicit it.
+func (b *BMMC) AddMessageWithTTL(msg interface{}, callbackType string, rounds int64) error {
+	if rounds <= 0 {
+		return errInvalidRounds
+	}
+
+	_, err := b.addMessageWithTTL(context.Background(), "", msg, callbackType, rounds)
+
+	return err
+}
+
+// AddMessageOrdered adds new message in messages buffer, with the next sequence
+// number of the node. The peers with FIFOOrdering deliver it after the ordered
+// messages added before it by this node, and only once.
+func (b *BMMC) AddMessageOrdered(msg interface{}, callbackType string) error {
+	m, err := b.newElement(msg, callbackType)
 	if err != nil {
-		b.config.Logger.Printf(syncBufferLogErrFmt, b.config.Addr, b.config.Port, m.ID, b.gossipRound.GetNumber(), err)
 		return err
 	}
 
-	if err := b.messageBuffer.Add(m); err != nil {
-		b.config.Logger.Printf(syncBufferLogErrFmt, b.config.Addr, b.config.Port, m.ID, b.gossipRound.GetNumber(), err)
-		return err
+	b.sequence(&m)
+
+	_, err = b.addElement(context.Background(), m)
+
+	return err
+}
+
+// addMessage adds new message in messages buffer.
+// It returns the elements which are disseminated: the message or its fragments.
+func (b *BMMC) addMessage(ctx context.Context, msg interface{}, callbackType string) ([]buffer.Element, error) {
+	return b.addKeyedMessage(ctx, "", msg, callbackType)
+}
+
+// addKeyedMessage adds new message with given key in messages buffer.
+// Messages without key are never replaced.
+func (b *BMMC) addKeyedMessage(ctx context.Context, key string, msg interface{},
+	callbackType string) ([]buffer.Element, error) {
+	return b.addMessageWithTTL(ctx, key, msg, callbackType, 0)
+}
+
+// addMessageWithTTL adds new message with given key and given max gossip
+// count in messages buffer. 0 means the MaxGossipCount of config.
+func (b *BMMC) addMessageWithTTL(ctx context.Context, key string, msg interface{},
+	callbackType string, rounds int64) ([]buffer.Element, error) {
+	m, err := b.newElement(msg, callbackType)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Key = key
+	m.MaxGossipCount = rounds
+
+	return b.addElement(ctx, m)
+}
+
+// newElement creates a buffer element with given message, encoded with the codec of the node.
+func (b *BMMC) newElement(msg interface{}, callbackType string) (buffer.Element, error) {
+	payload, codec, err := b.encodePayload(msg)
+	if err != nil {
+		b.logf(GossipComponent, WarnLevel, syncBufferLogErrFmt, b.config.Addr, b.config.Port, "", b.gossipRound.GetNumber(), err)
+		return buffer.Element{}, err
+	}
+
+	m, err := buffer.NewElement(payload, callbackType)
+	if err != nil {
+		b.logf(GossipComponent, WarnLevel, syncBufferLogErrFmt, b.config.Addr, b.config.Port, m.ID, b.gossipRound.GetNumber(), err)
+		return buffer.Element{}, err
+	}
+
+	m.Codec = codec
+
+	return m, nil
+}
+
+// addElement adds given message in messages buffer, fragmenting it if needed.
+// It returns the elements which are disseminated: the message or its fragments.
+func (b *BMMC) addElement(ctx context.Context, m buffer.Element) ([]buffer.Element, error) {
+	m, fragments, err := b.prepareElement(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the fragments are disseminated
+	for _, f := range fragments {
+		if err := b.addToBufferWithPolicy(ctx, f); err != nil {
+			b.logf(GossipComponent, WarnLevel, syncBufferLogErrFmt, b.config.Addr, b.config.Port, f.ID, b.gossipRound.GetNumber(), err)
+			return nil, err
+		}
+	}
+
+	if err := b.addToBufferWithPolicy(ctx, m); err != nil {
+		b.logf(GossipComponent, WarnLevel, syncBufferLogErrFmt, b.config.Addr, b.config.Port, m.ID, b.gossipRound.GetNumber(), err)
+		return nil, err
+	}
+
+	disseminated := b.deliverAdded(m, fragments)
+
+	b.multicast(disseminated)
+
+	return disseminated, nil
+}
+
+// prepareElement stamps given message with the clocks, the sequence number
+// and the signatures of this node, if it is the origin of the message, and
+// fragments it if needed. It returns the message and its fragments.
+func (b *BMMC) prepareElement(m buffer.Element) (buffer.Element, []buffer.Element, error) {
+	if m.Origin == "" {
+		m.Origin = fullHost(b.config.Addr, b.config.Port)
+	}
+
+	if m.HLC == 0 {
+		m.HLC = uint64(b.clock.tick())
+	}
+
+	if m.Origin == fullHost(b.config.Addr, b.config.Port) && b.causal != nil && m.VectorClock == nil {
+		m.VectorClock = b.causal.stamp(m.Origin)
 	}
 
-	b.config.Logger.Printf(bufferSyncedLogFmt,
+	if m.Origin == fullHost(b.config.Addr, b.config.Port) && b.config.Ordering == FIFOOrdering && m.Seq == 0 {
+		b.sequence(&m)
+	}
+
+	if m.Origin == fullHost(b.config.Addr, b.config.Port) && b.config.IdentityKey != nil {
+		sig, err := b.signElement(m)
+		if err != nil {
+			b.logf(GossipComponent, WarnLevel, syncBufferLogErrFmt, b.config.Addr, b.config.Port, m.ID, b.gossipRound.GetNumber(), err)
+			return m, nil, err
+		}
+
+		m.Signature = sig
+	}
+
+	if m.Origin == fullHost(b.config.Addr, b.config.Port) && b.config.MessageKey != nil {
+		mac, err := b.messageMAC(m)
+		if err != nil {
+			b.logf(GossipComponent, WarnLevel, syncBufferLogErrFmt, b.config.Addr, b.config.Port, m.ID, b.gossipRound.GetNumber(), err)
+			return m, nil, err
+		}
+
+		m.MAC = mac
+	}
+
+	m.Sender = b.verifiedSender(m)
+
+	fragments, err := b.fragment(m)
+	if err != nil {
+		b.logf(GossipComponent, WarnLevel, syncBufferLogErrFmt, b.config.Addr, b.config.Port, m.ID, b.gossipRound.GetNumber(), err)
+		return m, nil, err
+	}
+
+	m.Reassembled = len(fragments) > 0
+
+	return m, fragments, nil
+}
+
+// deliverAdded records given message, added in messages buffer with its
+// fragments, and runs its callbacks. It returns the elements which are
+// disseminated: the message or its fragments.
+func (b *BMMC) deliverAdded(m buffer.Element, fragments []buffer.Element) []buffer.Element {
+	atomic.AddInt64(&b.counters.messagesAdded, 1)
+
+	b.seen.add(m.ID)
+
+	for _, f := range fragments {
+		b.seen.add(f.ID)
+	}
+
+	b.logf(GossipComponent, DebugLevel, bufferSyncedLogFmt,
 		b.config.Addr, b.config.Port, m.ID, b.gossipRound.GetNumber())
 
 	b.runCallbacks(m, b.config.Addr, b.config.Port)
 
-	return nil
+	if len(fragments) > 0 {
+		return fragments
+	}
+
+	return []buffer.Element{m}
 }
 
 // AddPeer adds new peer in peers buffer.
@@ -172,10 +771,16 @@ func (b *BMMC) AddPeer(addr, port string) error {
 		return fmt.Errorf(addPeerErrFmt, addr, port, err)
 	}
 
-	if err = b.messageBuffer.Add(msg); err != nil {
+	// membership changes are pushed without waiting for the next round
+	msg.Priority = int(HighPriority)
+
+	if err = b.addToBuffer(msg); err != nil {
 		return fmt.Errorf(addPeerErrFmt, addr, port, err)
 	}
 
+	b.flushUrgent([]buffer.Element{msg})
+	b.balanceViews()
+
 	return nil
 }
 
@@ -186,7 +791,7 @@ func (b *BMMC) RemovePeer(addr, port string) error {
 		return fmt.Errorf(removePeerErrFmt, addr, port, err)
 	}
 
-	b.peerBuffer.RemovePeer(p)
+	b.forgetPeer(p)
 
 	msg, err := buffer.NewElement(
 		callback.ComposeRemovePeerMessage(addr, port),
@@ -196,13 +801,32 @@ func (b *BMMC) RemovePeer(addr, port string) error {
 		return fmt.Errorf(removePeerErrFmt, addr, port, err)
 	}
 
-	if err := b.messageBuffer.Add(msg); err != nil {
+	msg.Priority = int(HighPriority)
+
+	if err := b.addToBuffer(msg); err != nil {
 		return fmt.Errorf(removePeerErrFmt, addr, port, err)
 	}
 
+	b.flushUrgent([]buffer.Element{msg})
+
 	return nil
 }
 
+// forgetPeer removes given peer from peers buffer and from the views of the
+// node, without announcing it to the other nodes.
+func (b *BMMC) forgetPeer(p peer.Peer) {
+	b.peerBuffer.RemovePeer(p)
+
+	if b.config.PartialView.enabled() {
+		b.passiveView.remove(p.Addr(), p.Port())
+		b.balanceViews()
+	}
+
+	if b.sampler != nil {
+		b.sampler.invalidate(p.Addr(), p.Port())
+	}
+}
+
 // GetMessages returns a slice with all messages from messages buffer.
 func (b *BMMC) GetMessages() []interface{} {
 	return b.messageBuffer.Messages()
@@ -213,15 +837,127 @@ func (b *BMMC) GetPeers() []string {
 	return b.peerBuffer.GetPeers()
 }
 
+// addToBuffer adds given element in messages buffer.
+func (b *BMMC) addToBuffer(el buffer.Element) error {
+	if el.Key != "" {
+		return b.upsert(el)
+	}
+
+	if err := b.messageBuffer.Add(el); err != nil {
+		return err
+	}
+
+	b.messagesAdded()
+
+	return nil
+}
+
+// addToBufferWithPolicy adds given element in messages buffer,
+// following the configured policy when the buffer is full.
+func (b *BMMC) addToBufferWithPolicy(ctx context.Context, el buffer.Element) error {
+	// keyed messages replace their older versions, so they don't need room in buffer
+	if el.Key != "" {
+		return b.upsert(el)
+	}
+
+	switch b.config.BufferFullPolicy {
+	case RejectPolicy:
+		return b.addToBufferIfNotFull(el)
+
+	case BlockPolicy:
+		for {
+			freed := b.messageBuffer.Freed()
+
+			err := b.addToBufferIfNotFull(el)
+			if !errors.Is(err, ErrBufferFull) {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf(waitBufferErrFmt, err, ctx.Err())
+			case <-freed:
+			}
+		}
+
+	default:
+		return b.addToBuffer(el)
+	}
+}
+
+// addToBufferIfNotFull adds given element in messages buffer if it isn't full.
+func (b *BMMC) addToBufferIfNotFull(el buffer.Element) error {
+	if err := b.messageBuffer.AddIfNotFull(el); err != nil {
+		return err
+	}
+
+	b.messagesAdded()
+
+	return nil
+}
+
+// callbackContext returns the resources of the node used by default callbacks.
+func (b *BMMC) callbackContext() *callback.DefaultContext {
+	return &callback.DefaultContext{
+		Peers:        b.peerBuffer,
+		Messages:     b.messageBuffer,
+		Round:        b.gossipRound.GetNumber(),
+		Logger:       b.callbackLogger,
+		UpdateConfig: b.applyConfigUpdate,
+	}
+}
+
 func (b *BMMC) runCallbacks(m buffer.Element, hostAddr, hostPort string) {
 	// TODO remove hostAddr and hostport from func args. These are used only for logging
-	if m.CallbackType != callback.NOCALLBACK {
-		if err := b.defaultCallbacks.RunCallbacks(m, b.peerBuffer, b.config.Logger); err != nil {
-			b.config.Logger.Printf(runDefaultCallbackErrFmt, hostAddr, hostPort, m.ID, b.gossipRound.GetNumber())
+	// callbacks run only for the reassembled message, not for its fragments
+	if m.CallbackType != callback.NOCALLBACK && m.Fragment == nil {
+		if m.CallbackType == keyRotationCallbackType {
+			if err := b.applyKeyRotation(m.Msg); err != nil {
+				b.logf(CallbackComponent, ErrorLevel, keyRotationLogErrFmt, m.ID, err)
+			}
 		}
 
-		if err := b.customCallbacks.RunCallbacks(m, b.config.Logger); err != nil {
-			b.config.Logger.Printf(runCustomCallbackErrFmt, hostAddr, hostPort, m.ID, b.gossipRound.GetNumber())
+		// deltas are merged first, so callbacks see the new state
+		if err := b.deltaStates.merge(m); err != nil {
+			b.logf(GossipComponent, ErrorLevel, "%s", err)
 		}
+
+		if err := b.defaultCallbacks.RunCallbacks(m, b.callbackContext()); err != nil {
+			b.logf(CallbackComponent, ErrorLevel, runDefaultCallbackErrFmt, hostAddr, hostPort, m.ID, b.gossipRound.GetNumber())
+		}
+
+		if !b.config.Roles.Has(ObserverRole) {
+			return
+		}
+
+		if cb, ok := b.config.MessageCallbacks[m.CallbackType]; ok {
+			b.dispatchCallback(m, hostAddr, hostPort, func(context.Context) error {
+				return cb(b.newMessage(m), b.callbackLogger)
+			})
+		}
+
+		if cb, ok := b.callbacks.get(m.CallbackType); ok {
+			b.dispatchCallback(m, hostAddr, hostPort, func(ctx context.Context) error {
+				return cb(ctx, b.newMessage(m))
+			})
+		}
+
+		if cb, err := b.typedCallbacks.GetCallback(m.CallbackType); err == nil {
+			decode := func(v interface{}) error {
+				return decodePayload(m.Msg, m.Codec, b.config.Codec, v)
+			}
+
+			b.dispatchCallback(m, hostAddr, hostPort, func(context.Context) error {
+				return cb.RunDecoded(decode, b.callbackLogger)
+			})
+		}
+
+		if _, err := b.customCallbacks.GetCallback(m.CallbackType); err != nil {
+			return
+		}
+
+		b.dispatchCallback(m, hostAddr, hostPort, func(context.Context) error {
+			return b.customCallbacks.RunCallbacks(m, b.callbackLogger)
+		})
 	}
 }
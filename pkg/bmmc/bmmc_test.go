@@ -17,11 +17,17 @@ limitations under the License.
 package bmmc_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"net"
+	"os"
+	"path/filepath"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -84,6 +90,71 @@ func suggestPort() string {
 	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
 }
 
+// newStartedNodes creates and starts a node for each given config.
+// The first node knows all the other nodes.
+func newStartedNodes(cfgs ...*bmmc.Config) []*bmmc.BMMC {
+	nodes := make([]*bmmc.BMMC, len(cfgs))
+
+	for i, cfg := range cfgs {
+		if cfg.Addr == "" {
+			cfg.Addr = "localhost"
+		}
+
+		if cfg.Port == "" {
+			cfg.Port = suggestPort()
+		}
+
+		if cfg.BufferSize == 0 {
+			cfg.BufferSize = 32
+		}
+
+		node, err := bmmc.New(cfg)
+		Expect(err).To(Succeed())
+		Expect(node.Start()).To(Succeed())
+
+		nodes[i] = node
+	}
+
+	for _, cfg := range cfgs[1:] {
+		Expect(nodes[0].AddPeer(cfg.Addr, cfg.Port)).To(Succeed())
+	}
+
+	return nodes
+}
+
+// waitForConvergence waits until all given nodes have the same messages.
+func waitForConvergence(nodes []*bmmc.BMMC) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return bmmc.WaitForConvergence(ctx, nodes...)
+}
+
+func stopNodes(nodes []*bmmc.BMMC) {
+	for _, node := range nodes {
+		node.Stop()
+	}
+}
+
+// counterState is a counter replicated by increments.
+type counterState struct{}
+
+func (counterState) Delta(prev, curr interface{}) (interface{}, error) {
+	if prev == nil {
+		return curr, nil
+	}
+
+	return curr.(float64) - prev.(float64), nil
+}
+
+func (counterState) Merge(state, delta interface{}) (interface{}, error) {
+	if state == nil {
+		return delta, nil
+	}
+
+	return state.(float64) + delta.(float64), nil
+}
+
 func newBMMC(addr, port string, cbCustomRegistry map[string]func(interface{}, *log.Logger) error) *bmmc.BMMC {
 	b, err := bmmc.New(&bmmc.Config{
 		Addr:       addr,
@@ -141,6 +212,701 @@ var _ = Describe("BMMC", func() {
 			[]string{"awesome-message"}),
 	)
 
+	DescribeTable("AddMessage when buffer is full",
+		func(policy bmmc.BufferFullPolicy, expectedErr error, expectedBuf []string) {
+			node, err := bmmc.New(&bmmc.Config{
+				Addr:             "localhost",
+				Port:             suggestPort(),
+				BufferSize:       1,
+				BufferFullPolicy: policy,
+			})
+			Expect(err).To(Succeed())
+
+			Expect(node.AddMessage("first-message", bmmc.NOCALLBACK)).To(Succeed())
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+			defer cancel()
+
+			err = node.AddMessageContext(ctx, "second-message", bmmc.NOCALLBACK)
+			if expectedErr == nil {
+				Expect(err).To(Succeed())
+			} else {
+				Expect(errors.Is(err, expectedErr)).To(BeTrue())
+			}
+
+			Expect(getBuffer(node)).To(Equal(expectedBuf))
+		},
+		Entry("drops the oldest message with drop oldest policy",
+			bmmc.DropOldestPolicy, nil, []string{"second-message"}),
+		Entry("rejects the message with reject policy",
+			bmmc.RejectPolicy, bmmc.ErrBufferFull, []string{"first-message"}),
+		Entry("rejects the message after the context is done with block policy",
+			bmmc.BlockPolicy, bmmc.ErrBufferFull, []string{"first-message"}),
+	)
+
+	It("syncs all messages when synchronizations are limited", func() {
+		nodes := newStartedNodes(&bmmc.Config{MaxSyncMessages: 1}, &bmmc.Config{MaxSyncMessages: 1})
+		defer stopNodes(nodes)
+
+		for i := 0; i < 5; i++ {
+			Expect(nodes[0].AddMessage(i, bmmc.NOCALLBACK)).To(Succeed())
+		}
+
+		Expect(waitForConvergence(nodes)).To(Succeed())
+	})
+
+	It("returns the messages of given callback type", func() {
+		nodes := newStartedNodes(&bmmc.Config{})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("first message", "first-callback")).To(Succeed())
+		Expect(nodes[0].AddMessage("second message", "second-callback")).To(Succeed())
+
+		messages := nodes[0].GetMessagesByType("first-callback")
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0].ID).NotTo(BeEmpty())
+		Expect(messages[0].Payload).To(Equal("first message"))
+		Expect(messages[0].CallbackType).To(Equal("first-callback"))
+	})
+
+	It("returns a message by ID", func() {
+		nodes := newStartedNodes(&bmmc.Config{})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message", bmmc.NOCALLBACK)).To(Succeed())
+
+		id := nodes[0].GetMessagesByType(bmmc.NOCALLBACK)[0].ID
+
+		m, err := nodes[0].GetMessage(id)
+		Expect(err).To(Succeed())
+		Expect(m.Payload).To(Equal("a message"))
+
+		_, err = nodes[0].GetMessage("unknown")
+		Expect(err).To(MatchError(bmmc.ErrMessageNotFound))
+	})
+
+	It("checks whether a message was delivered", func() {
+		nodes := newStartedNodes(&bmmc.Config{}, &bmmc.Config{})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message", bmmc.NOCALLBACK)).To(Succeed())
+
+		id := nodes[0].GetMessagesByType(bmmc.NOCALLBACK)[0].ID
+		Expect(nodes[0].HasMessage(id)).To(BeTrue())
+		Expect(nodes[0].HasMessage("unknown")).To(BeFalse())
+
+		Eventually(func() bool {
+			return nodes[1].HasMessage(id)
+		}, time.Second*5).Should(BeTrue())
+	})
+
+	It("broadcasts messages to all peers immediately", func() {
+		delivered := make(chan interface{}, 2)
+		cfg := &bmmc.Config{
+			// gossip rounds are too slow for the message to be delivered in time
+			RoundDuration: time.Minute,
+			Callbacks: map[string]func(interface{}, *log.Logger) error{
+				"awesome-callback": func(msg interface{}, _ *log.Logger) error {
+					delivered <- msg
+					return nil
+				},
+			},
+		}
+		unreachable := &bmmc.Config{Addr: "localhost", Port: suggestPort()}
+
+		nodes := newStartedNodes(&bmmc.Config{RoundDuration: time.Minute}, cfg)
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddPeer(unreachable.Addr, unreachable.Port)).To(Succeed())
+
+		// wait for the server of the peer to start
+		Eventually(func() error {
+			results, err := nodes[0].Broadcast(context.Background(), "warm up", bmmc.BroadcastOptions{})
+			Expect(err).To(Succeed())
+
+			for _, r := range results {
+				if r.Peer.Port == cfg.Port {
+					return r.Err
+				}
+			}
+
+			return nil
+		}).Should(Succeed())
+
+		results, err := nodes[0].Broadcast(context.Background(), "a message", bmmc.BroadcastOptions{
+			CallbackType: "awesome-callback",
+		})
+		Expect(err).To(Succeed())
+		Expect(results).To(HaveLen(2))
+
+		for _, r := range results {
+			if r.Peer.Port == unreachable.Port {
+				Expect(r.Err).NotTo(Succeed())
+			} else {
+				Expect(r.Err).To(Succeed())
+			}
+		}
+
+		Expect(delivered).To(Receive(Equal("a message")))
+	})
+
+	It("joins the cluster through a peer", func() {
+		seedCfg := &bmmc.Config{JoinToken: "secret"}
+		otherCfg := &bmmc.Config{}
+		cfg := &bmmc.Config{}
+
+		nodes := newStartedNodes(seedCfg, otherCfg, cfg)
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message", bmmc.NOCALLBACK)).To(Succeed())
+
+		// wait for the server of the seed to start
+		Eventually(func() error {
+			return nodes[2].Join(context.Background(), seedCfg.Addr, seedCfg.Port, "wrong")
+		}).Should(MatchError(ContainSubstring("403")))
+
+		Expect(nodes[2].Join(context.Background(), seedCfg.Addr, seedCfg.Port, "secret")).To(Succeed())
+
+		Expect(nodes[2].GetPeers()).To(ContainElements(
+			fmt.Sprintf("%s/%s", seedCfg.Addr, seedCfg.Port),
+			fmt.Sprintf("%s/%s", otherCfg.Addr, otherCfg.Port),
+		))
+		Expect(nodes[0].GetPeers()).To(ContainElement(fmt.Sprintf("%s/%s", cfg.Addr, cfg.Port)))
+		Eventually(getBufferFn(nodes[2]), time.Second*5).Should(ContainElement("a message"))
+	})
+
+	It("retries to join through seeds until they are reachable", func() {
+		seedCfg := &bmmc.Config{Addr: "localhost", Port: suggestPort()}
+		cfg := &bmmc.Config{Seeds: []bmmc.Peer{{Addr: seedCfg.Addr, Port: seedCfg.Port}}}
+
+		nodes := newStartedNodes(cfg)
+		defer stopNodes(nodes)
+
+		time.Sleep(time.Millisecond * 500)
+
+		seeds := newStartedNodes(seedCfg)
+		defer stopNodes(seeds)
+
+		Eventually(nodes[0].GetPeers, time.Second*5).Should(ContainElement(
+			fmt.Sprintf("%s/%s", seedCfg.Addr, seedCfg.Port)))
+		Eventually(seeds[0].GetPeers, time.Second*5).Should(ContainElement(
+			fmt.Sprintf("%s/%s", cfg.Addr, cfg.Port)))
+	})
+
+	It("joins through seeds resolved from SRV records", func() {
+		seedCfg := &bmmc.Config{}
+		seeds := newStartedNodes(seedCfg)
+		defer stopNodes(seeds)
+
+		port, err := strconv.Atoi(seedCfg.Port)
+		Expect(err).To(Succeed())
+
+		cfg := &bmmc.Config{
+			SeedRecords: []string{"_bmmc._tcp.example.com"},
+			LookupSRV: func(_ context.Context, name string) ([]*net.SRV, error) {
+				Expect(name).To(Equal("_bmmc._tcp.example.com"))
+				return []*net.SRV{{Target: seedCfg.Addr + ".", Port: uint16(port)}}, nil
+			},
+		}
+
+		nodes := newStartedNodes(cfg)
+		defer stopNodes(nodes)
+
+		Eventually(nodes[0].GetPeers, time.Second*5).Should(ContainElement(
+			fmt.Sprintf("%s/%s", seedCfg.Addr, seedCfg.Port)))
+	})
+
+	It("announces its leave to peers", func() {
+		peerCfg := &bmmc.Config{}
+		nodes := newStartedNodes(peerCfg)
+		defer stopNodes(nodes)
+
+		cfg := &bmmc.Config{RoundDuration: time.Minute}
+		leaving := newStartedNodes(cfg)[0]
+
+		Expect(leaving.AddPeer(peerCfg.Addr, peerCfg.Port)).To(Succeed())
+		Expect(nodes[0].AddPeer(cfg.Addr, cfg.Port)).To(Succeed())
+
+		// wait for the server of the peer to start
+		Eventually(func() error {
+			results, err := leaving.Broadcast(context.Background(), "warm up", bmmc.BroadcastOptions{})
+			Expect(err).To(Succeed())
+
+			return results[0].Err
+		}).Should(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		Expect(leaving.Leave(ctx)).To(Succeed())
+		Expect(nodes[0].GetPeers()).NotTo(ContainElement(fmt.Sprintf("%s/%s", cfg.Addr, cfg.Port)))
+	})
+
+	It("doesn't deliver again messages dropped from buffer", func() {
+		var delivered int32
+
+		cfg := &bmmc.Config{
+			BufferSize: 2,
+			Callbacks: map[string]func(interface{}, *log.Logger) error{
+				"awesome-callback": func(interface{}, *log.Logger) error {
+					atomic.AddInt32(&delivered, 1)
+					return nil
+				},
+			},
+		}
+		nodes := newStartedNodes(&bmmc.Config{}, cfg)
+		defer stopNodes(nodes)
+
+		for i := 0; i < 4; i++ {
+			Expect(nodes[0].AddMessage(i, "awesome-callback")).To(Succeed())
+
+			Eventually(func() int32 {
+				return atomic.LoadInt32(&delivered)
+			}, time.Second*5).Should(Equal(int32(i + 1)))
+		}
+
+		Consistently(func() int32 {
+			return atomic.LoadInt32(&delivered)
+		}, time.Second).Should(Equal(int32(4)))
+	})
+
+	It("replaces keyed messages with their newer versions", func() {
+		nodes := newStartedNodes(&bmmc.Config{}, &bmmc.Config{})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddKeyedMessage("config", "first version", bmmc.NOCALLBACK)).To(Succeed())
+		Eventually(getBufferFn(nodes[1]), time.Second*5).Should(ContainElement("first version"))
+
+		Expect(nodes[0].AddKeyedMessage("config", "second version", bmmc.NOCALLBACK)).To(Succeed())
+		Expect(getBuffer(nodes[0])).NotTo(ContainElement("first version"))
+
+		Eventually(getBufferFn(nodes[1]), time.Second*5).Should(ContainElement("second version"))
+		Expect(getBuffer(nodes[1])).NotTo(ContainElement("first version"))
+
+		Expect(nodes[0].AddKeyedMessage("", "no key", bmmc.NOCALLBACK)).NotTo(Succeed())
+	})
+
+	It("watches the changes of keyed messages", func() {
+		nodes := newStartedNodes(&bmmc.Config{}, &bmmc.Config{})
+		defer stopNodes(nodes)
+
+		events := nodes[1].Watch("config/")
+
+		Expect(nodes[0].AddKeyedMessage("other", "other message", bmmc.NOCALLBACK)).To(Succeed())
+		Expect(nodes[0].AddKeyedMessage("config/a", "first version", bmmc.NOCALLBACK)).To(Succeed())
+
+		var e bmmc.KeyEvent
+		Eventually(events, time.Second*5).Should(Receive(&e))
+		Expect(e.Type).To(Equal(bmmc.KeyCreated))
+		Expect(e.Key).To(Equal("config/a"))
+		Expect(e.Message.Payload).To(Equal("first version"))
+
+		Expect(nodes[0].AddKeyedMessage("config/a", "second version", bmmc.NOCALLBACK)).To(Succeed())
+		Eventually(events, time.Second*5).Should(Receive(&e))
+		Expect(e.Type).To(Equal(bmmc.KeyUpdated))
+		Expect(e.Message.Payload).To(Equal("second version"))
+
+		Expect(nodes[0].RemoveMessage(e.Message.ID)).To(Succeed())
+		Eventually(events, time.Second*5).Should(Receive(&e))
+		Expect(e.Type).To(Equal(bmmc.KeyDeleted))
+		Expect(e.Key).To(Equal("config/a"))
+	})
+
+	It("reloads the saved peers when it is created again", func() {
+		dir, err := ioutil.TempDir("", "bmmc")
+		Expect(err).To(Succeed())
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		cfg := &bmmc.Config{
+			Addr:       "localhost",
+			Port:       suggestPort(),
+			BufferSize: 32,
+			PeersFile:  filepath.Join(dir, "peers.json"),
+		}
+
+		node, err := bmmc.New(cfg)
+		Expect(err).To(Succeed())
+		Expect(node.AddPeer("localhost", "10000")).To(Succeed())
+
+		restarted, err := bmmc.New(cfg)
+		Expect(err).To(Succeed())
+		Expect(restarted.GetPeers()).To(ConsistOf("localhost/10000"))
+	})
+
+	It("restores its state from data directory and rejoins its peers", func() {
+		dir, err := ioutil.TempDir("", "bmmc")
+		Expect(err).To(Succeed())
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		peerCfg := &bmmc.Config{}
+		peers := newStartedNodes(peerCfg)
+		defer stopNodes(peers)
+		peerHost := fmt.Sprintf("%s/%s", peerCfg.Addr, peerCfg.Port)
+
+		cfg := &bmmc.Config{
+			Addr:       "localhost",
+			Port:       suggestPort(),
+			BufferSize: 32,
+			DataDir:    dir,
+		}
+
+		node, err := bmmc.New(cfg)
+		Expect(err).To(Succeed())
+		Expect(node.Start()).To(Succeed())
+		Expect(node.AddMessage("a message", bmmc.NOCALLBACK)).To(Succeed())
+		node.Stop()
+
+		restarted, err := bmmc.New(cfg)
+		Expect(err).To(Succeed())
+		Expect(getBuffer(restarted)).To(ConsistOf("a message"))
+
+		Expect(restarted.AddPeer(peerCfg.Addr, peerCfg.Port)).To(Succeed())
+
+		again, err := bmmc.New(cfg)
+		Expect(err).To(Succeed())
+		Expect(again.GetPeers()).To(ContainElement(peerHost))
+		Expect(again.Start()).To(Succeed())
+		defer again.Stop()
+
+		// the peer learns about the restored node and receives its messages
+		self := fmt.Sprintf("%s/%s", cfg.Addr, cfg.Port)
+		Eventually(peers[0].GetPeers, time.Second*5).Should(ContainElement(self))
+		Eventually(getBufferFn(peers[0]), time.Second*5).Should(ContainElement("a message"))
+	})
+
+	It("removes messages from all peers", func() {
+		nodes := newStartedNodes(&bmmc.Config{}, &bmmc.Config{})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message", bmmc.NOCALLBACK)).To(Succeed())
+		id := nodes[0].GetMessagesByType(bmmc.NOCALLBACK)[0].ID
+
+		Eventually(func() bool {
+			return nodes[1].HasMessage(id)
+		}, time.Second*5).Should(BeTrue())
+
+		Expect(nodes[0].RemoveMessage(id)).To(Succeed())
+		Expect(nodes[0].HasMessage(id)).To(BeFalse())
+
+		Eventually(func() bool {
+			return nodes[1].HasMessage(id)
+		}, time.Second*5).Should(BeFalse())
+
+		// the message is not synced back
+		Consistently(func() bool {
+			return nodes[0].HasMessage(id) || nodes[1].HasMessage(id)
+		}, time.Second).Should(BeFalse())
+
+		Expect(nodes[0].RemoveMessage(id)).NotTo(Succeed())
+	})
+
+	It("collects tombstones", func() {
+		nodes := newStartedNodes(&bmmc.Config{MaxTombstones: 1, TombstoneTTL: time.Millisecond * 500})
+		defer stopNodes(nodes)
+
+		for i := 0; i < 2; i++ {
+			Expect(nodes[0].AddMessage(i, bmmc.NOCALLBACK)).To(Succeed())
+		}
+
+		for _, m := range nodes[0].GetMessagesByType(bmmc.NOCALLBACK) {
+			Expect(nodes[0].RemoveMessage(m.ID)).To(Succeed())
+		}
+
+		Expect(nodes[0].Stats().Tombstones).To(Equal(1))
+		Expect(nodes[0].Stats().TombstonesCollected).To(Equal(int64(1)))
+
+		Eventually(func() int {
+			return nodes[0].Stats().Tombstones
+		}, time.Second*5).Should(Equal(0))
+		Expect(nodes[0].Stats().TombstonesCollected).To(Equal(int64(2)))
+	})
+
+	It("limits the buffer by bytes", func() {
+		nodes := newStartedNodes(&bmmc.Config{MaxBufferBytes: 512})
+		defer stopNodes(nodes)
+
+		for i := 0; i < 20; i++ {
+			Expect(nodes[0].AddMessage(fmt.Sprintf("message %d", i), bmmc.NOCALLBACK)).To(Succeed())
+		}
+
+		stats := nodes[0].Stats()
+		Expect(stats.BufferBytes).To(BeNumerically(">", 0))
+		Expect(stats.BufferBytes).To(BeNumerically("<=", 512))
+		Expect(stats.Messages).To(BeNumerically("<", 20))
+	})
+
+	It("waits for messages", func() {
+		nodes := newStartedNodes(&bmmc.Config{}, &bmmc.Config{})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message", bmmc.NOCALLBACK)).To(Succeed())
+		id := nodes[0].GetMessagesByType(bmmc.NOCALLBACK)[0].ID
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		Expect(nodes[1].WaitForMessages(ctx, id)).To(Succeed())
+	})
+
+	It("returns error when nodes don't converge in time", func() {
+		nodes := newStartedNodes(&bmmc.Config{Roles: bmmc.GossiperRole}, &bmmc.Config{})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message", bmmc.NOCALLBACK)).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+		defer cancel()
+
+		Expect(errors.Is(bmmc.WaitForConvergence(ctx, nodes...), context.DeadlineExceeded)).To(BeTrue())
+	})
+
+	It("lists messages page by page", func() {
+		nodes := newStartedNodes(&bmmc.Config{})
+		defer stopNodes(nodes)
+
+		for i := 0; i < 5; i++ {
+			Expect(nodes[0].AddMessage(i, bmmc.NOCALLBACK)).To(Succeed())
+			time.Sleep(time.Millisecond)
+		}
+
+		listed := []interface{}{}
+		cursor := ""
+
+		for {
+			messages, next, err := nodes[0].ListMessages(cursor, 2)
+			Expect(err).To(Succeed())
+			Expect(len(messages)).To(BeNumerically("<=", 2))
+
+			for _, m := range messages {
+				listed = append(listed, m.Payload)
+			}
+
+			if next == "" {
+				break
+			}
+
+			cursor = next
+		}
+
+		Expect(listed).To(Equal([]interface{}{0, 1, 2, 3, 4}))
+	})
+
+	It("counts added and delivered messages", func() {
+		cfg := &bmmc.Config{
+			Callbacks: map[string]func(interface{}, *log.Logger) error{
+				"awesome-callback": func(interface{}, *log.Logger) error {
+					return nil
+				},
+			},
+		}
+		nodes := newStartedNodes(&bmmc.Config{}, cfg)
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message", "awesome-callback")).To(Succeed())
+
+		Eventually(func() int64 {
+			return nodes[1].Stats().CallbackSuccesses
+		}, time.Second*5).Should(Equal(int64(1)))
+
+		sender := nodes[0].Stats()
+		Expect(sender.MessagesAdded).To(Equal(int64(1)))
+		Expect(sender.Rounds).To(BeNumerically(">", 0))
+		Expect(sender.BytesSent).To(BeNumerically(">", 0))
+		Expect(sender.Peers).To(Equal(1))
+
+		receiver := nodes[1].Stats()
+		Expect(receiver.MessagesDelivered).To(BeNumerically(">=", 1))
+		Expect(receiver.BytesReceived).To(BeNumerically(">", 0))
+		Expect(receiver.Messages).To(Equal(len(getBuffer(nodes[1]))))
+	})
+
+	It("doesn't sync messages from banned peers", func() {
+		cfg := &bmmc.Config{Addr: "localhost", Port: suggestPort()}
+		nodes := newStartedNodes(cfg, &bmmc.Config{})
+		defer stopNodes(nodes)
+
+		Expect(nodes[1].BanPeer(cfg.Addr, cfg.Port, time.Minute)).To(Succeed())
+		Expect(nodes[0].AddMessage("a message", bmmc.NOCALLBACK)).To(Succeed())
+
+		Consistently(getBufferFn(nodes[1]), time.Second).ShouldNot(ContainElement("a message"))
+	})
+
+	It("syncs messages to nodes without gossiper role", func() {
+		nodes := newStartedNodes(&bmmc.Config{}, &bmmc.Config{Roles: bmmc.StorageRole | bmmc.ObserverRole})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message", bmmc.NOCALLBACK)).To(Succeed())
+
+		Expect(waitForConvergence(nodes)).To(Succeed())
+	})
+
+	It("doesn't sync messages from nodes without storage role", func() {
+		nodes := newStartedNodes(&bmmc.Config{Roles: bmmc.GossiperRole}, &bmmc.Config{})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message", bmmc.NOCALLBACK)).To(Succeed())
+
+		Consistently(getBufferFn(nodes[1]), time.Second).ShouldNot(ContainElement("a message"))
+	})
+
+	It("syncs messages greater than blob threshold", func() {
+		nodes := newStartedNodes(&bmmc.Config{BlobThreshold: 16}, &bmmc.Config{BlobThreshold: 16})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message greater than blob threshold", bmmc.NOCALLBACK)).To(Succeed())
+
+		Expect(waitForConvergence(nodes)).To(Succeed())
+	})
+
+	It("syncs fragmented messages and calls the callback once", func() {
+		delivered := make(chan interface{}, 10)
+		callbacks := map[string]func(interface{}, *log.Logger) error{
+			"my-callback": func(msg interface{}, _ *log.Logger) error {
+				delivered <- msg
+				return nil
+			},
+		}
+
+		nodes := newStartedNodes(
+			&bmmc.Config{MaxFragmentSize: 8},
+			&bmmc.Config{MaxFragmentSize: 8, Callbacks: callbacks})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message greater than max fragment size", "my-callback")).To(Succeed())
+
+		Expect(waitForConvergence(nodes)).To(Succeed())
+		Eventually(delivered).Should(Receive(Equal("a message greater than max fragment size")))
+		Consistently(delivered, time.Millisecond*300).ShouldNot(Receive())
+	})
+
+	It("replicates states by deltas", func() {
+		nodes := newStartedNodes(
+			&bmmc.Config{DeltaStates: map[string]bmmc.DeltaState{"counter": counterState{}}},
+			&bmmc.Config{DeltaStates: map[string]bmmc.DeltaState{"counter": counterState{}}})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].UpdateState("counter", 5.0)).To(Succeed())
+		Expect(nodes[0].UpdateState("counter", 8.0)).To(Succeed())
+		Expect(nodes[0].GetState("counter")).To(Equal(8.0))
+
+		Eventually(func() interface{} {
+			return nodes[1].GetState("counter")
+		}, time.Second*5).Should(Equal(8.0))
+	})
+
+	It("repairs the buffers of two nodes in both directions", func() {
+		// the nodes don't know each other, so they never gossip
+		cfg := &bmmc.Config{}
+		nodes := append(newStartedNodes(&bmmc.Config{}), newStartedNodes(cfg)...)
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("first-message", bmmc.NOCALLBACK)).To(Succeed())
+		Expect(nodes[1].AddMessage("second-message", bmmc.NOCALLBACK)).To(Succeed())
+
+		// wait for the server of second node to start
+		Eventually(func() error {
+			return nodes[0].RepairWith(cfg.Addr, cfg.Port)
+		}).Should(Succeed())
+
+		Eventually(getBufferFn(nodes[0]), time.Second).Should(ContainElements("first-message", "second-message"))
+		Eventually(getBufferFn(nodes[1]), time.Second).Should(ContainElements("first-message", "second-message"))
+	})
+
+	It("syncs the missing messages from a peer in bulk, in pages", func() {
+		// the nodes don't know each other, so they never gossip
+		cfg := &bmmc.Config{}
+		nodes := append(newStartedNodes(&bmmc.Config{SyncPageSize: 2}), newStartedNodes(cfg)...)
+		defer stopNodes(nodes)
+
+		for i := 0; i < 5; i++ {
+			Expect(nodes[1].AddMessage(fmt.Sprintf("message-%d", i), bmmc.NOCALLBACK)).To(Succeed())
+		}
+
+		// wait for the server of second node to start
+		Eventually(func() error {
+			_, err := nodes[0].SyncWith(context.Background(), cfg.Addr, cfg.Port)
+			return err
+		}).Should(Succeed())
+
+		Expect(getBufferFn(nodes[0])()).To(ConsistOf("message-0", "message-1", "message-2", "message-3", "message-4"))
+
+		Expect(nodes[0].SyncWith(context.Background(), cfg.Addr, cfg.Port)).To(Equal(0))
+	})
+
+	It("returns error when syncing with an unreachable peer", func() {
+		nodes := newStartedNodes(&bmmc.Config{})
+		defer stopNodes(nodes)
+
+		_, err := nodes[0].SyncWith(context.Background(), "localhost", suggestPort())
+		Expect(err).NotTo(Succeed())
+	})
+
+	It("replays the filtered messages to a peer", func() {
+		// the nodes don't know each other, so they never gossip
+		cfg := &bmmc.Config{}
+		nodes := append(newStartedNodes(&bmmc.Config{}), newStartedNodes(cfg)...)
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("first-message", "first-callback")).To(Succeed())
+		Expect(nodes[0].AddMessage("second-message", "second-callback")).To(Succeed())
+
+		peer := bmmc.Peer{Addr: cfg.Addr, Port: cfg.Port}
+		filter := func(m bmmc.Message) bool {
+			return m.CallbackType == "second-callback"
+		}
+
+		// wait for the server of second node to start
+		Eventually(func() error {
+			_, err := nodes[0].ReplayTo(context.Background(), peer, filter)
+			return err
+		}).Should(Succeed())
+
+		Expect(nodes[0].ReplayTo(context.Background(), peer, filter)).To(Equal(1))
+		Eventually(getBufferFn(nodes[1]), time.Second).Should(ConsistOf("second-message"))
+	})
+
+	It("returns error when replaying messages to an unreachable peer", func() {
+		nodes := newStartedNodes(&bmmc.Config{})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddMessage("a message", bmmc.NOCALLBACK)).To(Succeed())
+
+		_, err := nodes[0].ReplayTo(context.Background(), bmmc.Peer{Addr: "localhost", Port: suggestPort()}, nil)
+		Expect(err).NotTo(Succeed())
+	})
+
+	It("returns error when repairing with an unreachable peer", func() {
+		nodes := newStartedNodes(&bmmc.Config{})
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].RepairWith("localhost", suggestPort())).NotTo(Succeed())
+	})
+
+	It("syncs the nodes with ipv6 addresses", func() {
+		transport := bmmc.NewMemoryTransport()
+		nodes := []*bmmc.BMMC{}
+
+		for _, port := range []string{"21000", "21001"} {
+			node, err := bmmc.New(&bmmc.Config{
+				Addr:          "::1",
+				Port:          port,
+				BufferSize:    32,
+				RoundDuration: time.Millisecond * 20,
+				Transport:     transport,
+			})
+			Expect(err).To(Succeed())
+			Expect(node.Start()).To(Succeed())
+
+			nodes = append(nodes, node)
+		}
+		defer stopNodes(nodes)
+
+		Expect(nodes[0].AddPeer("[::1]", "21001")).To(Succeed())
+		Expect(nodes[0].AddMessage("ipv6-message", callback.NOCALLBACK)).To(Succeed())
+
+		Eventually(getBufferFn(nodes[1]), time.Second*5).Should(ContainElement("ipv6-message"))
+	})
+
 	When("system has ten nodes", func() {
 		const len = 10
 		var (
@@ -155,16 +921,27 @@ var _ = Describe("BMMC", func() {
 			extraMsgBuffer = make([]interface{}, len)
 			expectedBuf = []interface{}{}
 
+			// the nodes share an in-memory transport, so they don't bind ports
+			transport := bmmc.NewMemoryTransport()
+
 			for i := 0; i < len; i++ {
-				ports[i] = suggestPort()
+				ports[i] = strconv.Itoa(20000 + i)
 				addrs[i] = "localhost"
 				extraMsgBuffer[i] = callback.ComposeAddPeerMessage(addrs[i], ports[i])
 			}
 
 			// create a protocol for each node, and start it
 			for i := 0; i < len; i++ {
-				nodes[i] = newBMMC(addrs[i], ports[i], map[string]func(interface{}, *log.Logger) error{})
-				Expect(nodes[i].Start()).To(Succeed())
+				node, err := bmmc.New(&bmmc.Config{
+					Addr:       addrs[i],
+					Port:       ports[i],
+					BufferSize: 32,
+					Transport:  transport,
+				})
+				Expect(err).To(Succeed())
+				Expect(node.Start()).To(Succeed())
+
+				nodes[i] = node
 			}
 
 			// add peers
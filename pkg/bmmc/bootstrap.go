@@ -0,0 +1,217 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	minBootstrapBackoff = 100 * time.Millisecond
+	maxBootstrapBackoff = 10 * time.Second
+
+	bootstrapLogErrFmt     = "BMMC %s:%s could not join through seeds, retrying in %s: %s"
+	bootstrapTimeoutLogFmt = "BMMC %s:%s gave up joining through seeds after %s"
+	bootstrapLogFmt        = "BMMC %s:%s joined through seed %s:%s"
+	initialSyncLogErrFmt   = "BMMC %s:%s could not sync with a peer, retrying in %s: %v"
+	initialSyncLogFmt      = "BMMC %s:%s synced %d messages with %s:%s, it is ready"
+
+	resolveSeedsErrFmt  = "error at resolving seeds from %s: %w"
+	discoverSeedsErrFmt = "error at discovering seeds: %w"
+)
+
+var (
+	errNoSeeds       = errors.New("no seeds found")
+	errNoStoragePeer = errors.New("no storage peer known")
+)
+
+// lookupSRV resolves given SRV record name with the default DNS resolver.
+func lookupSRV(ctx context.Context, name string) ([]*net.SRV, error) {
+	_, addrs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	return addrs, err
+}
+
+// srvPeers returns the peers from given SRV records.
+func srvPeers(addrs []*net.SRV) []Peer {
+	peers := make([]Peer, len(addrs))
+	for i, srv := range addrs {
+		peers[i] = Peer{
+			Addr: strings.TrimSuffix(srv.Target, "."),
+			Port: strconv.Itoa(int(srv.Port)),
+		}
+	}
+
+	return peers
+}
+
+// resolveSeeds returns the seeds resolved from the SRV records in SeedRecords
+// and the seeds found by Discoverers.
+func (b *BMMC) resolveSeeds(ctx context.Context) ([]Peer, error) {
+	seeds := []Peer{}
+
+	for _, name := range b.config.SeedRecords {
+		addrs, err := b.config.LookupSRV(ctx, name)
+		if err != nil {
+			return seeds, fmt.Errorf(resolveSeedsErrFmt, name, err)
+		}
+
+		seeds = append(seeds, srvPeers(addrs)...)
+	}
+
+	for _, d := range b.config.Discoverers {
+		peers, err := d.Discover(ctx)
+		if err != nil {
+			return seeds, fmt.Errorf(discoverSeedsErrFmt, err)
+		}
+
+		seeds = append(seeds, peers...)
+	}
+
+	return seeds, nil
+}
+
+// joinSeeds tries to join through each seed, in order, and returns nil when
+// the first join succeeds. Resolved and discovered seeds are tried after the
+// static ones.
+func (b *BMMC) joinSeeds(ctx context.Context) error {
+	resolved, err := b.resolveSeeds(ctx)
+
+	seeds := append(append([]Peer{}, b.config.Seeds...), resolved...)
+	if len(seeds) == 0 && err == nil {
+		return errNoSeeds
+	}
+
+	for _, seed := range seeds {
+		if err = b.Join(ctx, seed.Addr, seed.Port, b.config.JoinToken); err == nil {
+			b.logf(MembershipComponent, InfoLevel, bootstrapLogFmt, b.config.Addr, b.config.Port, seed.Addr, seed.Port)
+			return nil
+		}
+	}
+
+	return err
+}
+
+// bootstrap joins the cluster through the configured seeds. Unreachable seeds
+// are retried with exponential backoff, until a join succeeds, the bootstrap
+// timeout expires or the protocol is stopped.
+func (b *BMMC) bootstrap(stop <-chan struct{}) {
+	if !b.joinsCluster() {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var deadline <-chan time.Time
+
+	if b.config.BootstrapTimeout > 0 {
+		timer := time.NewTimer(b.config.BootstrapTimeout)
+		defer timer.Stop()
+
+		deadline = timer.C
+	}
+
+	backoff := minBootstrapBackoff
+
+	for {
+		err := b.joinSeeds(ctx)
+		if err == nil {
+			return
+		}
+
+		b.logf(MembershipComponent, WarnLevel, bootstrapLogErrFmt, b.config.Addr, b.config.Port, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			b.logf(MembershipComponent, WarnLevel, bootstrapTimeoutLogFmt, b.config.Addr, b.config.Port, b.config.BootstrapTimeout)
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBootstrapBackoff {
+			backoff = maxBootstrapBackoff
+		}
+	}
+}
+
+// syncWithPeer pulls the messages missing from this node from the first known
+// storage peer which answers.
+func (b *BMMC) syncWithPeer(ctx context.Context) error {
+	err := errNoStoragePeer
+
+	for _, p := range b.knownPeers() {
+		if !p.Roles.Has(StorageRole) {
+			continue
+		}
+
+		var synced int
+
+		if synced, err = b.SyncWith(ctx, p.Addr, p.Port); err == nil {
+			b.logf(GossipComponent, InfoLevel, initialSyncLogFmt, b.config.Addr, b.config.Port, synced, p.Addr, p.Port)
+			return nil
+		}
+	}
+
+	return err
+}
+
+// syncInitially synchronizes the messages buffer with a peer once, after the
+// node was started, so it becomes ready (see ReadyAfterSync). It retries with
+// exponential backoff, e.g. until the node joined, until a sync succeeds or
+// given context is done.
+func (b *BMMC) syncInitially(ctx context.Context) {
+	backoff := minBootstrapBackoff
+
+	for {
+		err := b.syncWithPeer(ctx)
+		if err == nil {
+			atomic.StoreInt32(&b.initiallySynced, 1)
+			return
+		}
+
+		b.logf(GossipComponent, DebugLevel, initialSyncLogErrFmt, b.config.Addr, b.config.Port, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBootstrapBackoff {
+			backoff = maxBootstrapBackoff
+		}
+	}
+}
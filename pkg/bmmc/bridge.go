@@ -0,0 +1,392 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// BridgedCallbackType is the default callback type of the messages injected by bridges.
+	BridgedCallbackType = "BRIDGED"
+
+	startBridgeErrFmt = "error at starting bridge: %w"
+	stopBridgeErrFmt  = "error at stopping bridge: %w"
+	injectErrFmt      = "error at injecting payload from %s: %w"
+	bridgeLogErrFmt   = "Error in bridge of BMMC %s:%s: %s"
+
+	// recordIDFmt is the format of the hashed positions of injected records
+	recordIDFmt = "%s/%d/%d"
+
+	// topicSeparator separates the levels of topics
+	topicSeparator = "/"
+	// singleLevelWildcard matches one level of topics
+	singleLevelWildcard = "+"
+	// multiLevelWildcard matches the remaining levels of topics
+	multiLevelWildcard = "#"
+)
+
+// Backbone is a messaging system bridged with the mesh, e.g. a NATS connection.
+type Backbone interface {
+	// Publish publishes given payload on given subject.
+	Publish(subject string, payload []byte) error
+	// Subscribe calls handler for each payload published on given subjects, until Close is called.
+	Subscribe(subjects []string, handler func(subject string, payload []byte)) error
+	// Close closes the subscriptions and the connection to the backbone.
+	Close() error
+}
+
+// BackboneRecord is a payload consumed from a partitioned log, e.g. a Kafka topic.
+type BackboneRecord struct {
+	Subject   string
+	Partition int32
+	Offset    int64
+	Payload   []byte
+}
+
+// RecordBackbone is a Backbone which tracks the offsets of consumed records,
+// e.g. a Kafka consumer group. Bridges subscribe to its records instead of its
+// payloads.
+type RecordBackbone interface {
+	Backbone
+	// SubscribeRecords calls handler for each record published on given subjects,
+	// until Close is called. The offset of a record is committed only if handler
+	// returns nil, otherwise the record is consumed again.
+	SubscribeRecords(subjects []string, handler func(BackboneRecord) error) error
+}
+
+// TopicRule maps the subjects of a backbone, e.g. MQTT topics, to a callback type.
+type TopicRule struct {
+	// Subject is the subject of the messages. The subjects of inbound rules can
+	// contain MQTT wildcards: "+" matches a single level and "#" matches the
+	// remaining levels
+	Subject string
+	// CallbackType is the callback type of the messages
+	CallbackType string
+}
+
+// BridgeConfig is the configuration of a bridge.
+type BridgeConfig struct {
+	// Subject returns the subject where a delivered message is republished.
+	// Messages with an empty subject are not republished
+	// Optional (default: the subject of the first outbound rule with the callback
+	// type of the message, or the callback type if there are no outbound rules)
+	Subject func(Message) string
+	// Subjects are the subjects whose payloads are injected in the mesh
+	// Optional (default: no payload is injected)
+	Subjects []string
+	// CallbackType is the callback type of injected payloads. Messages with this
+	// callback type are never republished, so they don't echo back in the backbone
+	// Optional (default: BRIDGED)
+	CallbackType string
+	// Inbound are the rules which map the subjects of injected payloads to their
+	// callback types. Payloads are injected with the callback type of the first
+	// matching rule. Messages with these callback types are never republished
+	// Optional (default: no rules)
+	Inbound []TopicRule
+	// Outbound are the rules which map the callback types of delivered messages
+	// to the subjects where they are republished
+	// Optional (default: no rules)
+	Outbound []TopicRule
+}
+
+// bridgedMessage is a message republished by a bridge. Bridges of any mesh skip
+// the bridged messages which they already know, so messages never loop between
+// the mesh and the backbone.
+type bridgedMessage struct {
+	// Bridge is the node whose bridge republished the message
+	Bridge string `json:"bmmc_bridge"`
+	exportedMessage
+}
+
+// Bridge republishes the messages delivered to a node in a backbone and injects
+// the payloads published in the backbone in the mesh.
+//
+// Messages are republished as json objects, with the schema of exported messages
+// (see ExportMessages) and a "bmmc_bridge" field. The payload of the message is
+// in its "payload" field. Injected payloads are decoded as json, or they are
+// injected as strings if they are not valid json.
+type Bridge struct {
+	node     *BMMC
+	backbone Backbone
+	config   BridgeConfig
+
+	stream *stream
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewBridge creates a bridge between given node and backbone.
+func NewBridge(node *BMMC, backbone Backbone, cfg BridgeConfig) *Bridge {
+	if cfg.Subject == nil {
+		outbound := cfg.Outbound
+		cfg.Subject = func(m Message) string {
+			return outboundSubject(outbound, m)
+		}
+	}
+
+	if cfg.CallbackType == "" {
+		cfg.CallbackType = BridgedCallbackType
+	}
+
+	return &Bridge{
+		node:     node,
+		backbone: backbone,
+		config:   cfg,
+	}
+}
+
+// Start starts republishing the delivered messages and injecting the payloads
+// from backbone.
+func (br *Bridge) Start() error {
+	br.stream = br.node.streams.add(streamFilter{})
+	br.done = make(chan struct{})
+
+	br.wg.Add(1)
+
+	go br.republish()
+
+	if len(br.subjects()) == 0 {
+		return nil
+	}
+
+	if err := br.subscribe(); err != nil {
+		br.stopRepublishing()
+		return fmt.Errorf(startBridgeErrFmt, err)
+	}
+
+	return nil
+}
+
+// subscribe subscribes to the records of the backbone, if it tracks their
+// offsets, or to its payloads otherwise.
+func (br *Bridge) subscribe() error {
+	if rb, ok := br.backbone.(RecordBackbone); ok {
+		return rb.SubscribeRecords(br.subjects(), br.injectRecord)
+	}
+
+	return br.backbone.Subscribe(br.subjects(), br.inject)
+}
+
+// subjects returns the subjects whose payloads are injected in the mesh.
+func (br *Bridge) subjects() []string {
+	subjects := append([]string{}, br.config.Subjects...)
+	for _, rule := range br.config.Inbound {
+		subjects = append(subjects, rule.Subject)
+	}
+
+	return subjects
+}
+
+// outboundSubject returns the subject of the first outbound rule with the
+// callback type of given message, or its callback type if there are no rules.
+func outboundSubject(outbound []TopicRule, m Message) string {
+	if len(outbound) == 0 {
+		return m.CallbackType
+	}
+
+	for _, rule := range outbound {
+		if rule.CallbackType == m.CallbackType {
+			return rule.Subject
+		}
+	}
+
+	return ""
+}
+
+// inboundCallbackType returns the callback type of the payloads injected from
+// given subject.
+func (br *Bridge) inboundCallbackType(subject string) string {
+	for _, rule := range br.config.Inbound {
+		if matchTopic(rule.Subject, subject) {
+			return rule.CallbackType
+		}
+	}
+
+	return br.config.CallbackType
+}
+
+// injected returns true if the messages with given callback type are injected
+// by the bridge.
+func (br *Bridge) injected(cbType string) bool {
+	if cbType == br.config.CallbackType {
+		return true
+	}
+
+	for _, rule := range br.config.Inbound {
+		if rule.CallbackType == cbType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchTopic returns true if given topic matches given filter, which can
+// contain MQTT wildcards.
+func matchTopic(filter, topic string) bool {
+	filterLevels := strings.Split(filter, topicSeparator)
+	topicLevels := strings.Split(topic, topicSeparator)
+
+	for i, level := range filterLevels {
+		if level == multiLevelWildcard {
+			return true
+		}
+
+		if i >= len(topicLevels) || (level != singleLevelWildcard && level != topicLevels[i]) {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
+
+// Stop stops the bridge and closes the backbone.
+func (br *Bridge) Stop() error {
+	br.stopRepublishing()
+
+	if err := br.backbone.Close(); err != nil {
+		return fmt.Errorf(stopBridgeErrFmt, err)
+	}
+
+	return nil
+}
+
+// stopRepublishing stops republishing the delivered messages.
+func (br *Bridge) stopRepublishing() {
+	close(br.done)
+	br.wg.Wait()
+	br.node.streams.remove(br.stream)
+}
+
+// republish publishes the delivered messages in backbone, until the bridge is stopped.
+func (br *Bridge) republish() {
+	defer br.wg.Done()
+
+	for {
+		select {
+		case m := <-br.stream.messages:
+			if err := br.publish(m); err != nil {
+				br.logError(err)
+			}
+		case <-br.done:
+			return
+		}
+	}
+}
+
+// publish publishes given message in backbone, if it wasn't injected by a bridge.
+func (br *Bridge) publish(m Message) error {
+	if br.injected(m.CallbackType) {
+		return nil
+	}
+
+	subject := br.config.Subject(m)
+	if subject == "" {
+		return nil
+	}
+
+	raw, err := json.Marshal(bridgedMessage{
+		Bridge: fullHost(br.node.config.Addr, br.node.config.Port),
+		exportedMessage: exportedMessage{
+			ID:           m.ID,
+			Timestamp:    m.Timestamp,
+			Payload:      m.Payload,
+			CallbackType: m.CallbackType,
+			Key:          m.Key,
+			Origin:       m.Origin,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return br.backbone.Publish(subject, raw)
+}
+
+// inject adds given payload from backbone in the messages buffer of the node.
+func (br *Bridge) inject(subject string, payload []byte) {
+	if err := br.injectPayload(subject, payload, ""); err != nil {
+		br.logError(fmt.Errorf(injectErrFmt, subject, err))
+	}
+}
+
+// injectRecord adds given record from backbone in the messages buffer of the
+// node. The ID of the injected message is derived from the position of the
+// record, so records consumed again are not injected twice.
+func (br *Bridge) injectRecord(r BackboneRecord) error {
+	h := sha256.Sum256([]byte(fmt.Sprintf(recordIDFmt, r.Subject, r.Partition, r.Offset)))
+
+	if err := br.injectPayload(r.Subject, r.Payload, hex.EncodeToString(h[:])); err != nil {
+		err = fmt.Errorf(injectErrFmt, r.Subject, err)
+		br.logError(err)
+
+		return err
+	}
+
+	return nil
+}
+
+// injectPayload adds given payload from given subject in the messages buffer of
+// the node, with given ID or with a new one if the ID is empty. Messages
+// republished by bridges keep their IDs, so the known ones are skipped.
+func (br *Bridge) injectPayload(subject string, payload []byte, id string) error {
+	var bm bridgedMessage
+	if err := json.Unmarshal(payload, &bm); err == nil && bm.Bridge != "" {
+		m, err := bm.element()
+		if err != nil {
+			return err
+		}
+
+		if br.node.knownMessage(m.ID) {
+			return nil
+		}
+
+		_, err = br.node.addElement(context.Background(), m)
+
+		return err
+	}
+
+	var msg interface{}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		msg = string(payload)
+	}
+
+	m, err := exportedMessage{ID: id, Payload: msg, CallbackType: br.inboundCallbackType(subject)}.element()
+	if err != nil {
+		return err
+	}
+
+	if br.node.knownMessage(m.ID) {
+		return nil
+	}
+
+	_, err = br.node.addElement(context.Background(), m)
+
+	return err
+}
+
+// logError logs given error of the bridge.
+func (br *Bridge) logError(err error) {
+	br.node.logf(GossipComponent, ErrorLevel, bridgeLogErrFmt, br.node.config.Addr, br.node.config.Port, err)
+}
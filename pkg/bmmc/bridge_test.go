@@ -0,0 +1,248 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+// memoryBackbone is a Backbone which keeps the published payloads in memory.
+type memoryBackbone struct {
+	published map[string][][]byte
+	handler   func(subject string, payload []byte)
+	mux       sync.Mutex
+}
+
+func newMemoryBackbone() *memoryBackbone {
+	return &memoryBackbone{
+		published: map[string][][]byte{},
+	}
+}
+
+func (mb *memoryBackbone) Publish(subject string, payload []byte) error {
+	mb.mux.Lock()
+	defer mb.mux.Unlock()
+
+	mb.published[subject] = append(mb.published[subject], payload)
+
+	return nil
+}
+
+func (mb *memoryBackbone) Subscribe(subjects []string, handler func(subject string, payload []byte)) error {
+	mb.mux.Lock()
+	defer mb.mux.Unlock()
+
+	mb.handler = handler
+
+	return nil
+}
+
+func (mb *memoryBackbone) Close() error {
+	return nil
+}
+
+func (mb *memoryBackbone) send(subject string, payload []byte) {
+	mb.mux.Lock()
+	handler := mb.handler
+	mb.mux.Unlock()
+
+	handler(subject, payload)
+}
+
+func (mb *memoryBackbone) publishedOn(subject string) func() [][]byte {
+	return func() [][]byte {
+		mb.mux.Lock()
+		defer mb.mux.Unlock()
+
+		return mb.published[subject]
+	}
+}
+
+// memoryRecordBackbone is a RecordBackbone which keeps the committed offsets in memory.
+type memoryRecordBackbone struct {
+	*memoryBackbone
+	handler   func(BackboneRecord) error
+	committed []int64
+}
+
+func (mb *memoryRecordBackbone) SubscribeRecords(subjects []string, handler func(BackboneRecord) error) error {
+	mb.handler = handler
+	return nil
+}
+
+func (mb *memoryRecordBackbone) send(r BackboneRecord) {
+	if err := mb.handler(r); err == nil {
+		mb.committed = append(mb.committed, r.Offset)
+	}
+}
+
+var _ = Describe("Bridge", func() {
+	var (
+		transport *MemoryTransport
+		backbone  *memoryBackbone
+	)
+
+	BeforeEach(func() {
+		transport = NewMemoryTransport()
+		backbone = newMemoryBackbone()
+	})
+
+	DescribeTable("matchTopic function", func(filter, topic string, expected bool) {
+		Expect(matchTopic(filter, topic)).To(Equal(expected))
+	},
+		Entry("matches equal topics", "sensors/kitchen", "sensors/kitchen", true),
+		Entry("skips other topics", "sensors/kitchen", "sensors/garage", false),
+		Entry("matches a single level", "sensors/+/temperature", "sensors/kitchen/temperature", true),
+		Entry("skips more levels for single level wildcard", "sensors/+", "sensors/kitchen/temperature", false),
+		Entry("matches the remaining levels", "sensors/#", "sensors/kitchen/temperature", true),
+		Entry("matches the parent level", "sensors/#", "sensors", true),
+		Entry("skips shorter topics", "sensors/kitchen/temperature", "sensors/kitchen", false),
+	)
+
+	It("maps the subjects to callback types with topic rules", func() {
+		bridged := startTestNode("1", withTransport(transport))
+		defer bridged.Stop() // nolint: errcheck
+
+		sender := startTestNode("2", withTransport(transport))
+		defer sender.Stop() // nolint: errcheck
+
+		bridge := NewBridge(bridged, backbone, BridgeConfig{
+			Inbound:  []TopicRule{{Subject: "sensors/+/temperature", CallbackType: "temperature"}},
+			Outbound: []TopicRule{{Subject: "devices/commands", CallbackType: "command"}},
+		})
+		Expect(bridge.Start()).To(Succeed())
+		defer bridge.Stop() // nolint: errcheck
+
+		backbone.send("sensors/kitchen/temperature", []byte("20"))
+		Expect(bridged.GetMessagesByType("temperature")).To(ConsistOf(
+			WithTransform(func(m Message) interface{} { return m.Payload }, Equal(20.0))))
+
+		Expect(sender.AddPeer("localhost", "1")).To(Succeed())
+		Expect(sender.AddMessage("unmapped", "other")).To(Succeed())
+		Expect(sender.AddMessage("reboot", "command")).To(Succeed())
+
+		Eventually(backbone.publishedOn("devices/commands"), time.Second*5).Should(HaveLen(1))
+		Expect(backbone.publishedOn("other")()).To(BeEmpty())
+	})
+
+	It("republishes the delivered messages", func() {
+		bridged := startTestNode("1", withTransport(transport))
+		defer bridged.Stop() // nolint: errcheck
+
+		sender := startTestNode("2", withTransport(transport))
+		defer sender.Stop() // nolint: errcheck
+
+		bridge := NewBridge(bridged, backbone, BridgeConfig{})
+		Expect(bridge.Start()).To(Succeed())
+		defer bridge.Stop() // nolint: errcheck
+
+		Expect(sender.AddPeer("localhost", "1")).To(Succeed())
+		Expect(sender.AddMessage("a message", "awesome-callback")).To(Succeed())
+
+		Eventually(backbone.publishedOn("awesome-callback"), time.Second*5).Should(HaveLen(1))
+
+		var bm bridgedMessage
+		Expect(json.Unmarshal(backbone.publishedOn("awesome-callback")()[0], &bm)).To(Succeed())
+		Expect(bm.Bridge).To(Equal("localhost:1"))
+		Expect(bm.Payload).To(Equal("a message"))
+	})
+
+	It("injects the payloads from backbone in the mesh", func() {
+		bridged := startTestNode("1", withTransport(transport))
+		defer bridged.Stop() // nolint: errcheck
+
+		receiver := startTestNode("2", withTransport(transport))
+		defer receiver.Stop() // nolint: errcheck
+
+		bridge := NewBridge(bridged, backbone, BridgeConfig{Subjects: []string{"events"}})
+		Expect(bridge.Start()).To(Succeed())
+		defer bridge.Stop() // nolint: errcheck
+
+		Expect(bridged.AddPeer("localhost", "2")).To(Succeed())
+		backbone.send("events", []byte(`{"temperature": 20}`))
+		backbone.send("events", []byte("not json"))
+
+		Eventually(func() []interface{} {
+			payloads := []interface{}{}
+			for _, m := range receiver.GetMessagesByType(BridgedCallbackType) {
+				payloads = append(payloads, m.Payload)
+			}
+
+			return payloads
+		}, time.Second*5).Should(ConsistOf(map[string]interface{}{"temperature": 20.0}, "not json"))
+
+		// injected messages don't echo back in the backbone
+		Consistently(backbone.publishedOn(BridgedCallbackType), time.Millisecond*200).Should(BeEmpty())
+	})
+
+	It("skips the known messages republished by other bridges", func() {
+		bridged := startTestNode("1", withTransport(transport))
+		defer bridged.Stop() // nolint: errcheck
+
+		bridge := NewBridge(bridged, backbone, BridgeConfig{Subjects: []string{"events"}})
+		Expect(bridge.Start()).To(Succeed())
+		defer bridge.Stop() // nolint: errcheck
+
+		raw, err := json.Marshal(bridgedMessage{
+			Bridge: "localhost/3",
+			exportedMessage: exportedMessage{
+				ID:           "an-id",
+				Timestamp:    time.Now(),
+				Payload:      "a message",
+				CallbackType: "awesome-callback",
+			},
+		})
+		Expect(err).To(Succeed())
+
+		backbone.send("events", raw)
+		backbone.send("events", raw)
+
+		messages := bridged.GetMessagesByType("awesome-callback")
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0].ID).To(Equal("an-id"))
+	})
+
+	It("injects the records of a partitioned log once", func() {
+		bridged := startTestNode("1", withTransport(transport))
+		defer bridged.Stop() // nolint: errcheck
+
+		records := &memoryRecordBackbone{memoryBackbone: backbone}
+
+		bridge := NewBridge(bridged, records, BridgeConfig{Subjects: []string{"events"}})
+		Expect(bridge.Start()).To(Succeed())
+		defer bridge.Stop() // nolint: errcheck
+
+		// the second record is consumed again, e.g. after a restart before its commit
+		records.send(BackboneRecord{Subject: "events", Partition: 0, Offset: 1, Payload: []byte(`"first"`)})
+		records.send(BackboneRecord{Subject: "events", Partition: 0, Offset: 2, Payload: []byte(`"second"`)})
+		records.send(BackboneRecord{Subject: "events", Partition: 0, Offset: 2, Payload: []byte(`"second"`)})
+
+		payloads := []interface{}{}
+		for _, m := range bridged.GetMessagesByType(BridgedCallbackType) {
+			payloads = append(payloads, m.Payload)
+		}
+
+		Expect(payloads).To(ConsistOf("first", "second"))
+		Expect(records.committed).To(Equal([]int64{1, 2, 2}))
+	})
+})
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	broadcastErrFmt = "error at broadcasting message: %w"
+)
+
+// BroadcastOptions are the options for Broadcast.
+type BroadcastOptions struct {
+	// CallbackType is the callback type of the message
+	// Optional (default: NOCALLBACK)
+	CallbackType string
+	// Critical messages are pushed again, every RetransmitTimeout, to the
+	// known peers which didn't handle them, until the peers acknowledge them
+	// in their digests or the messages leave the buffer
+	// Optional (default: false)
+	Critical bool
+	// Quorum is the fraction of known peers, between 0 and 1, which must
+	// acknowledge the message before Broadcast returns. With a quorum, the
+	// message is gossiped in the rounds instead of pushed, and Broadcast
+	// returns ErrQuorumNotReached if ctx is done before enough peers
+	// acknowledged it. Peers acknowledge messages in the digests of their
+	// gossip messages and by handling the synchronizations which contain them
+	// Optional (default: the message is pushed to all known peers)
+	Quorum float64
+}
+
+// BroadcastResult is the result of pushing a broadcast message to a peer.
+type BroadcastResult struct {
+	Peer Peer
+	// Err is nil if the peer handled the message
+	Err error
+}
+
+// Broadcast adds the message in messages buffer and pushes it immediately to all
+// known peers, without waiting for gossip rounds. It blocks until every peer
+// handled the message or until ctx is done, and returns the result for each peer.
+// Peers which didn't handle the message still receive it in gossip rounds.
+func (b *BMMC) Broadcast(ctx context.Context, msg interface{}, opts BroadcastOptions) ([]BroadcastResult, error) {
+	if opts.CallbackType == "" {
+		opts.CallbackType = NOCALLBACK
+	}
+
+	if opts.Quorum < 0 || opts.Quorum > 1 {
+		return nil, fmt.Errorf(broadcastErrFmt, errInvalidQuorum)
+	}
+
+	peers := b.bans.withoutBanned(b.knownPeers())
+
+	if opts.Quorum > 0 {
+		return b.broadcastWithQuorum(ctx, msg, opts, peers)
+	}
+
+	elements, err := b.addMessage(ctx, msg, opts.CallbackType)
+	if err != nil {
+		return nil, fmt.Errorf(broadcastErrFmt, err)
+	}
+
+	results := b.push(ctx, elements, peers)
+
+	if opts.Critical {
+		b.retransmissions.track(elements, results, time.Now().Add(b.config.RetransmitTimeout))
+	}
+
+	return results, nil
+}
+
+// push pushes given elements to given peers in parallel and returns the result
+// for each peer, when every peer handled the elements or when ctx is done.
+func (b *BMMC) push(ctx context.Context, elements []buffer.Element, peers []Peer) []BroadcastResult {
+	synchronizationMsg := HTTPSynchronization{
+		Envelope: b.envelope(),
+		Addr:     b.config.Addr,
+		Port:     b.config.Port,
+		Elements: b.referenceBlobs(elements),
+	}
+
+	results := make([]BroadcastResult, len(peers))
+
+	var wg sync.WaitGroup
+
+	for i, p := range peers {
+		wg.Add(1)
+
+		go func(i int, p Peer) {
+			defer wg.Done()
+
+			results[i] = BroadcastResult{
+				Peer: p,
+				Err:  b.postSynchronization(ctx, synchronizationMsg, p.Addr, p.Port),
+			}
+		}(i, p)
+	}
+
+	wg.Wait()
+
+	return results
+}
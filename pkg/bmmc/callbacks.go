@@ -0,0 +1,122 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/callback"
+)
+
+const (
+	registerCallbackErrFmt   = "error at registering callback %s: %w"
+	unregisterCallbackErrFmt = "error at unregistering callback %s: %w"
+)
+
+var (
+	errNilCallback          = errors.New("callback must not be nil")
+	errDefaultCallbackType  = errors.New("default callback types can't be registered")
+	errUnregisteredCallback = errors.New("callback is not registered")
+)
+
+// Callback receives the messages of its callback type with their metadata:
+// ID, callback type, origin and timestamp. Its context is canceled when the
+// node is stopped or when the callback times out (see CallbackPolicy).
+type Callback func(ctx context.Context, msg Message) error
+
+// callbacks keeps the callbacks registered at runtime or in ContextCallbacks,
+// by callback type.
+type callbacks struct {
+	registered map[string]Callback
+	mux        sync.RWMutex
+}
+
+// newCallbacks creates a callbacks with given callbacks.
+func newCallbacks(cbs map[string]Callback) *callbacks {
+	c := &callbacks{
+		registered: make(map[string]Callback, len(cbs)),
+	}
+
+	for cbType, cb := range cbs {
+		c.registered[cbType] = cb
+	}
+
+	return c
+}
+
+// get returns the callback of given callback type.
+func (c *callbacks) get(cbType string) (Callback, bool) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	cb, ok := c.registered[cbType]
+
+	return cb, ok
+}
+
+// register registers given callback for given callback type, replacing the
+// previous one.
+func (c *callbacks) register(cbType string, cb Callback) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.registered[cbType] = cb
+}
+
+// unregister removes the callback of given callback type. It returns false if
+// there was no callback.
+func (c *callbacks) unregister(cbType string) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if _, ok := c.registered[cbType]; !ok {
+		return false
+	}
+
+	delete(c.registered, cbType)
+
+	return true
+}
+
+// RegisterCallback registers given callback for the messages of given callback
+// type, replacing the callback previously registered for it. The callback
+// runs for the messages received after it is registered.
+func (b *BMMC) RegisterCallback(callbackType string, cb Callback) error {
+	if cb == nil {
+		return fmt.Errorf(registerCallbackErrFmt, callbackType, errNilCallback)
+	}
+
+	if callback.IsDefaultCallback(callbackType) {
+		return fmt.Errorf(registerCallbackErrFmt, callbackType, errDefaultCallbackType)
+	}
+
+	b.callbacks.register(callbackType, cb)
+
+	return nil
+}
+
+// UnregisterCallback removes the callback registered for given callback type.
+func (b *BMMC) UnregisterCallback(callbackType string) error {
+	if !b.callbacks.unregister(callbackType) {
+		return fmt.Errorf(unregisterCallbackErrFmt, callbackType, errUnregisteredCallback)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/callback"
+)
+
+var _ = Describe("Callbacks", func() {
+	var b *BMMC
+
+	element := buffer.Element{
+		ID:           "id",
+		Timestamp:    time.Now(),
+		Msg:          "msg",
+		CallbackType: "cb",
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		b, err = New(&Config{
+			Addr:          "localhost",
+			Port:          "1",
+			BufferSize:    16,
+			RoundDuration: time.Millisecond * 20,
+			Transport:     NewMemoryTransport(),
+			Logger:        log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+	})
+
+	It("runs the registered callbacks with the message metadata", func() {
+		var received []Message
+
+		Expect(b.RegisterCallback("cb", func(ctx context.Context, msg Message) error {
+			Expect(ctx).NotTo(BeNil())
+			received = append(received, msg)
+
+			return nil
+		})).To(Succeed())
+
+		b.runCallbacks(element, "localhost", "2")
+
+		Expect(received).To(HaveLen(1))
+		Expect(received[0].ID).To(Equal("id"))
+		Expect(received[0].CallbackType).To(Equal("cb"))
+		Expect(received[0].Payload).To(Equal("msg"))
+		Expect(b.Stats().CallbackSuccesses).To(Equal(int64(1)))
+	})
+
+	It("doesn't run the unregistered callbacks", func() {
+		var calls int
+
+		Expect(b.RegisterCallback("cb", func(context.Context, Message) error {
+			calls++
+
+			return nil
+		})).To(Succeed())
+		Expect(b.UnregisterCallback("cb")).To(Succeed())
+
+		b.runCallbacks(element, "localhost", "2")
+
+		Expect(calls).To(BeZero())
+		Expect(b.UnregisterCallback("cb")).To(MatchError(errUnregisteredCallback))
+	})
+
+	It("cancels the context of the callbacks which time out", func() {
+		b.config.CallbackPolicy.Timeout = time.Millisecond * 10
+
+		Expect(b.RegisterCallback("cb", func(ctx context.Context, _ Message) error {
+			<-ctx.Done()
+
+			return ctx.Err()
+		})).To(Succeed())
+
+		b.runCallbacks(element, "localhost", "2")
+
+		Expect(b.Stats().CallbackFailures).To(Equal(int64(1)))
+	})
+
+	It("returns error for invalid callbacks", func() {
+		Expect(b.RegisterCallback("cb", nil)).To(MatchError(errNilCallback))
+		Expect(b.RegisterCallback(callback.ADDPEER, func(context.Context, Message) error {
+			return nil
+		})).To(MatchError(errDefaultCallbackType))
+	})
+})
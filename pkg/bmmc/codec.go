@@ -0,0 +1,178 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/callback"
+)
+
+const (
+	jsonCodecName = "json"
+	gobCodecName  = "gob"
+
+	unknownCodecErrFmt = "unknown codec %s"
+)
+
+var (
+	errEncodedPayload = errors.New("encoded payload must be bytes or base64")
+
+	// codecs are the registered codecs, by name
+	// nolint: gochecknoglobals
+	codecs = map[string]Codec{
+		jsonCodecName: JSONCodec{},
+		gobCodecName:  GobCodec{},
+	}
+	// nolint: gochecknoglobals
+	codecsMux sync.RWMutex
+)
+
+// Codec encodes the payloads of messages. The payloads are disseminated as
+// encoded bytes and decoded by Message.Decode with the codec of their name.
+type Codec interface {
+	// Name is the name of the codec, which is sent with the messages
+	Name() string
+	// Marshal encodes given payload
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes given data in the value pointed by v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// RegisterCodec registers given codec for all the nodes of the process, so
+// messages encoded with it can be decoded. The codec of Config doesn't have
+// to be registered: each node decodes with it the messages encoded with a codec
+// of the same name, so nodes with different codecs don't overwrite each other.
+func RegisterCodec(c Codec) {
+	codecsMux.Lock()
+	defer codecsMux.Unlock()
+
+	codecs[c.Name()] = c
+}
+
+// getCodec returns the codec with given name: given codec of the node, if it
+// has that name, or the registered codec otherwise.
+func getCodec(name string, local Codec) (Codec, error) {
+	if local != nil && local.Name() == name {
+		return local, nil
+	}
+
+	codecsMux.RLock()
+	defer codecsMux.RUnlock()
+
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf(unknownCodecErrFmt, name)
+	}
+
+	return c, nil
+}
+
+// JSONCodec is the default codec: payloads are embedded as json in the
+// protocol messages, without being encoded apart.
+type JSONCodec struct{}
+
+// Name returns the name of the codec.
+func (JSONCodec) Name() string {
+	return jsonCodecName
+}
+
+// Marshal encodes given payload as json.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes given json in the value pointed by v.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec encodes the payloads with encoding/gob, e.g. to keep the types of
+// their fields.
+type GobCodec struct{}
+
+// Name returns the name of the codec.
+func (GobCodec) Name() string {
+	return gobCodecName
+}
+
+// Marshal encodes given payload with gob.
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes given gob data in the value pointed by v.
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// encodePayload encodes given payload with the codec of the node. It returns
+// the name of the codec, or an empty name if the payload is embedded as json.
+func (b *BMMC) encodePayload(msg interface{}) (interface{}, string, error) {
+	if b.config.Codec == nil || b.config.Codec.Name() == jsonCodecName {
+		return msg, "", nil
+	}
+
+	raw, err := b.config.Codec.Marshal(msg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return raw, b.config.Codec.Name(), nil
+}
+
+// decodePayload decodes given payload, encoded with the codec with given name,
+// in the value pointed by v. Given codec of the node is used if it has that
+// name. Payloads without codec are decoded from json.
+func decodePayload(payload interface{}, codecName string, local Codec, v interface{}) error {
+	if codecName == "" {
+		return callback.Decode(payload, v)
+	}
+
+	c, err := getCodec(codecName, local)
+	if err != nil {
+		return err
+	}
+
+	var raw []byte
+
+	// encoded payloads are base64 strings after they are synced as json
+	switch p := payload.(type) {
+	case []byte:
+		raw = p
+	case string:
+		if raw, err = base64.StdEncoding.DecodeString(p); err != nil {
+			return errEncodedPayload
+		}
+	default:
+		return errEncodedPayload
+	}
+
+	return c.Unmarshal(raw, v)
+}
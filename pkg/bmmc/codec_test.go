@@ -0,0 +1,159 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+type codecOrder struct {
+	ID    string
+	Items map[string]int
+}
+
+// prefixCodec encodes the payloads as json after its prefix, and decodes only
+// the payloads with its prefix.
+type prefixCodec struct {
+	prefix string
+}
+
+func (c prefixCodec) Name() string {
+	return "prefix"
+}
+
+func (c prefixCodec) Marshal(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+
+	return append([]byte(c.prefix), raw...), err
+}
+
+func (c prefixCodec) Unmarshal(data []byte, v interface{}) error {
+	if !bytes.HasPrefix(data, []byte(c.prefix)) {
+		return errEncodedPayload
+	}
+
+	return json.Unmarshal(data[len(c.prefix):], v)
+}
+
+var _ = Describe("Codecs", func() {
+	newNode := func(port string, typed map[string]interface{}) *BMMC {
+		b, err := New(&Config{
+			Addr:           "localhost",
+			Port:           port,
+			BufferSize:     16,
+			RoundDuration:  20 * time.Millisecond,
+			Codec:          GobCodec{},
+			TypedCallbacks: typed,
+			Transport:      NewMemoryTransport(),
+			Logger:         log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+
+		return b
+	}
+
+	It("encodes the payloads with the codec of the node", func() {
+		order := codecOrder{ID: "o-1", Items: map[string]int{"apple": 2}}
+		orders := make(chan codecOrder, 1)
+
+		sender := newNode("1", nil)
+		receiver := newNode("2", map[string]interface{}{
+			"order": func(o codecOrder, _ *log.Logger) error {
+				orders <- o
+				return nil
+			},
+		})
+
+		elements, err := sender.addMessage(context.Background(), order, "order")
+		Expect(err).To(Succeed())
+		Expect(elements[0].Codec).To(Equal(gobCodecName))
+
+		local, err := sender.GetMessage(elements[0].ID)
+		Expect(err).To(Succeed())
+
+		var decoded codecOrder
+		Expect(local.Decode(&decoded)).To(Succeed())
+		Expect(decoded).To(Equal(order))
+
+		// the element is synced as json
+		raw, err := json.Marshal(elements[0])
+		Expect(err).To(Succeed())
+
+		var synced buffer.Element
+		Expect(json.Unmarshal(raw, &synced)).To(Succeed())
+
+		receiver.syncElement(synced, "localhost", "1")
+		Eventually(orders).Should(Receive(Equal(order)))
+
+		remote, err := receiver.GetMessage(synced.ID)
+		Expect(err).To(Succeed())
+		Expect(remote.Codec).To(Equal(gobCodecName))
+
+		decoded = codecOrder{}
+		Expect(remote.Decode(&decoded)).To(Succeed())
+		Expect(decoded).To(Equal(order))
+	})
+
+	It("decodes the payloads with the codec of each node", func() {
+		nodes := []*BMMC{}
+
+		for _, prefix := range []string{"a:", "b:"} {
+			b, err := New(&Config{
+				Addr:       "localhost",
+				Port:       "1",
+				BufferSize: 16,
+				Codec:      prefixCodec{prefix: prefix},
+				Logger:     log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+
+			nodes = append(nodes, b)
+		}
+
+		for i, b := range nodes {
+			elements, err := b.addMessage(context.Background(), "payload", NOCALLBACK)
+			Expect(err).To(Succeed())
+
+			m, err := b.GetMessage(elements[0].ID)
+			Expect(err).To(Succeed())
+
+			var payload string
+			Expect(m.Decode(&payload)).To(Succeed(), "node %d", i)
+			Expect(payload).To(Equal("payload"))
+		}
+
+		// the codecs of nodes are not registered for the process
+		_, err := getCodec("prefix", nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns error for payloads encoded with unknown codecs", func() {
+		var v string
+		Expect(Message{Payload: []byte("x"), Codec: "unknown"}.Decode(&v)).NotTo(Succeed())
+		Expect(Message{Payload: 1, Codec: gobCodecName}.Decode(&v)).To(MatchError(errEncodedPayload))
+	})
+})
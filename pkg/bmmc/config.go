@@ -17,12 +17,18 @@ limitations under the License.
 package bmmc
 
 import (
+	"context"
+	"crypto/ed25519"
 	"errors"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/rstefan1/bimodal-multicast/pkg/internal/callback"
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
 	"github.com/rstefan1/bimodal-multicast/pkg/internal/validators"
 )
 
@@ -31,8 +37,82 @@ const (
 	defaultRoundDuration = time.Millisecond * 100
 )
 
+// BufferFullPolicy is the behaviour of AddMessage when messages buffer is full.
+type BufferFullPolicy int
+
+const (
+	// DropOldestPolicy drops the oldest message from buffer to make room for the new one.
+	DropOldestPolicy BufferFullPolicy = iota
+	// RejectPolicy rejects the new message with ErrBufferFull.
+	RejectPolicy
+	// BlockPolicy blocks until there is room in buffer or until the context is done.
+	BlockPolicy
+)
+
+// MessageStore is the storage backend in which the messages buffer is saved.
+type MessageStore int
+
+const (
+	// DefaultStore uses FileStore when DataDir is set and doesn't save the messages otherwise.
+	DefaultStore MessageStore = iota
+	// MemoryStore keeps a copy of the messages buffer in memory, so it doesn't survive restarts.
+	MemoryStore
+	// FileStore appends the changes of the messages buffer to a log in DataDir,
+	// so a node recovers its buffer after a crash.
+	FileStore
+)
+
 var (
-	errInvalidBufSize = errors.New("invalid buffer size")
+	errInvalidBufSize          = errors.New("invalid buffer size")
+	errInvalidBufBytes         = errors.New("max buffer bytes must not be negative")
+	errInvalidMessageTTL       = errors.New("message ttl must not be negative")
+	errInvalidGossipTTL        = errors.New("max gossip count must not be negative")
+	errInvalidLogLevel         = errors.New("invalid log level")
+	errInvalidWireFormat       = errors.New("invalid wire format")
+	errInvalidGossipMode       = errors.New("invalid gossip mode")
+	errInvalidCompression      = errors.New("compression threshold must not be negative")
+	errInvalidBetaRange        = errors.New("min beta must be positive and not greater than max beta, which must not exceed 1")
+	errInvalidCompactDigest    = errors.New("compact digest threshold and full digest interval must not be negative")
+	errInvalidRoundJitter      = errors.New("round jitter must not be negative")
+	errInvalidMaxRound         = errors.New("max round duration must not be lower than round duration")
+	errInvalidFullPolicy       = errors.New("invalid buffer full policy")
+	errInvalidSubscription     = errors.New("subscription buffer size must not be negative and its policy must be valid")
+	errInvalidSyncLimit        = errors.New("synchronization limits must not be negative")
+	errInvalidDeltaState       = errors.New("delta states must not use default callback types")
+	errInvalidMessageCallback  = errors.New("message callbacks must not use default callback types")
+	errInvalidContextCallback  = errors.New("context callbacks must not be nil and must not use default callback types")
+	errInvalidTLSConfig        = errors.New("tls config must have a certificate and a key, and it can't be used with a transport")
+	errInvalidTypedCallback    = errors.New("typed callbacks must be func(T, *log.Logger) error and must not use default callback types")
+	errInvalidTombstone        = errors.New("tombstone limits must not be negative")
+	errInvalidSeenCache        = errors.New("seen cache size must not be negative")
+	errInvalidBootstrap        = errors.New("bootstrap timeout must not be negative")
+	errInvalidDiscovery        = errors.New("discovery interval must not be negative")
+	errInvalidPeerExchange     = errors.New("peer exchange size must not be negative")
+	errInvalidPartialView      = errors.New("partial view sizes must not be negative")
+	errInvalidSamplerSize      = errors.New("sampler size must not be negative")
+	errInvalidExploration      = errors.New("nearby exploration must be between 0 and 1")
+	errConflictingSelectors    = errors.New("peer selector, prefer responsive peers and prefer nearby peers can't be combined")
+	errInvalidBandwidth        = errors.New("synchronization bandwidth must not be negative")
+	errInvalidConcurrency      = errors.New("concurrent requests limit must not be negative")
+	errInvalidServerLimit      = errors.New("server timeouts and limits must not be negative")
+	errInvalidRequestTimeout   = errors.New("request timeout must not be negative")
+	errInvalidRateLimit        = errors.New("rate limits and concurrent callbacks limit must not be negative")
+	errInvalidCallbackPolicy   = errors.New("callback policy must not be negative")
+	errInvalidFailureThreshold = errors.New("peer failure threshold must not be negative")
+	errInvalidQuarantine       = errors.New("quarantine duration and slow peer rtt must not be negative")
+	errInvalidConnPool         = errors.New("max idle conns per host, dial timeout and idle conn timeout must not be negative")
+	errInvalidKeyRotation      = errors.New("key rotation window must not be negative")
+	errInvalidSignatureWindow  = errors.New("signature window must not be negative")
+	errUnsignedUDP             = errors.New("udp transport requires a cluster key")
+	errUnencryptedUDP          = errors.New("udp transport can't be encrypted: DTLS is not supported, use the cluster key")
+	errInvalidOriginQuota      = errors.New("origin quota must not be negative")
+	errInvalidIdentityKey      = errors.New("invalid identity key")
+	errInvalidMaxPeers         = errors.New("max peers must be between 0 and 4095")
+	errInvalidRetransmit       = errors.New("retransmit timeout must not be negative")
+	errInvalidStaleTimeout     = errors.New("peer stale timeout must not be negative")
+	errInvalidFailureDetector  = errors.New("suspicion timeout and probe interval must not be negative")
+	errInvalidMessageStore     = errors.New("invalid message store or file store without data dir")
+	errInvalidOrdering         = errors.New("invalid ordering or negative max ordering delay")
 )
 
 // Config is the config for the protocol.
@@ -43,21 +123,530 @@ type Config struct {
 	// Port is HTTP port for node which runs http servers
 	// Required
 	Port string
+	// NodeID identifies the node in the cluster, so peers recognize it when
+	// its address changes, e.g. when it is restarted behind NAT or in a
+	// container with another IP. It should be kept when the node is restarted
+	// Optional (default: a random UUID generated when the node is created)
+	NodeID string
+	// Profile sets coherent tuning parameters for a deployment: Beta,
+	// RoundDuration, MaxRoundDuration, RoundJitter, BufferSize and
+	// RetransmitTimeout. The fields which are set override the profile
+	// Optional (default: no profile)
+	Profile Profile
 	// Beta is the expected fanout for gossip rounds
 	// Optional
 	Beta float64
+	// AdaptiveBeta raises Beta to compensate the estimated loss (see
+	// Stats.EstimatedLoss), up to 1
+	// Optional (default: false)
+	AdaptiveBeta bool
+	// MinBeta and MaxBeta bound the beta adapted to the miss rate
+	// (see Stats.MissRate): with AdaptiveBeta, beta is raised in the rounds
+	// in which the node receives solicitations and it is lowered in the
+	// others. MinBeta must be positive and not greater than MaxBeta
+	// Optional (default: 0, beta only compensates the estimated loss)
+	MinBeta float64
+	MaxBeta float64
 	// Logger
 	// Optional
 	Logger *log.Logger
+	// LeveledLogger receives the logs of node with their level and with the
+	// component, addr and port fields, e.g. a *slog.Logger. The callbacks
+	// still receive a *log.Logger, which writes to it
+	// Optional (default: the logs are printed by Logger)
+	LeveledLogger LeveledLogger
+	// LogLevel is the minimum level of the printed logs, e.g. InfoLevel
+	// skips the log of every synced message
+	// Optional (default: DebugLevel)
+	LogLevel LogLevel
+	// ComponentLogLevels overrides LogLevel for given components
+	// Optional
+	ComponentLogLevels map[LogComponent]LogLevel
+	// Codec encodes the payloads of the added messages. All nodes must be
+	// able to decode them, e.g. by using the same codec
+	// Optional (default: JSONCodec, payloads are embedded as json)
+	Codec Codec
+	// WireFormat is the encoding of the gossip and solicitation messages sent
+	// to the peers which negotiated it. Nodes decode all wire formats, so
+	// clusters with mixed wire formats and versions interoperate
+	// Optional (default: JSONWireFormat)
+	WireFormat WireFormat
+	// GossipMode is the way in which the messages are exchanged with the
+	// peers which negotiated it. Nodes answer both modes, so clusters with
+	// mixed modes and versions interoperate
+	// Optional (default: PushGossipMode)
+	GossipMode GossipMode
 	// Callbacks funtions
 	// Optional
 	Callbacks map[string]func(interface{}, *log.Logger) error
+	// MessageCallbacks are callbacks which receive the messages with their
+	// metadata, e.g. their verified sender
+	// Optional (default: no callbacks)
+	MessageCallbacks map[string]func(Message, *log.Logger) error
+	// ContextCallbacks are callbacks which receive a context and the messages
+	// with their metadata. Callbacks can be registered and unregistered at
+	// runtime too, with RegisterCallback and UnregisterCallback
+	// Optional (default: no callbacks)
+	ContextCallbacks map[string]Callback
+	// TypedCallbacks are callbacks which receive the payloads decoded to their
+	// Go type. Each callback must be a func(T, *log.Logger) error, e.g.
+	// func(order Order, logger *log.Logger) error
+	// Optional (default: no callbacks)
+	TypedCallbacks map[string]interface{}
 	// Gossip round duration
 	// Optional
 	RoundDuration time.Duration
+	// MaxRoundDuration enables adaptive gossip rounds: the round duration is
+	// doubled after each round without new messages, up to MaxRoundDuration,
+	// and is reset to RoundDuration when new messages arrive
+	// Optional (default: gossip rounds are not adaptive)
+	MaxRoundDuration time.Duration
+	// RoundJitter is the maximum random duration added to each gossip round,
+	// so nodes started together don't gossip in lockstep
+	// Optional
+	RoundJitter time.Duration
 	// Buffer size
 	// Required
 	BufferSize int
+	// MaxBufferBytes is the maximum approximate size of the messages from buffer,
+	// in bytes. When it is exceeded, the buffer is full
+	// Optional (default: no limit)
+	MaxBufferBytes int
+	// MessageTTL is the duration for which messages are kept in buffer. Expired
+	// messages are evicted at the end of each gossip round and they are not
+	// synced again from peers
+	// Optional (default: messages are evicted only when the buffer is full)
+	MessageTTL time.Duration
+	// MaxGossipCount is the number of rounds for which each node gossips a
+	// message in its digests, as in the aging of the bimodal multicast paper.
+	// Older messages stay in buffer and are sent to the peers which solicit
+	// them. AddMessageWithTTL overrides it for a message
+	// Optional (default: messages are gossiped while they are in buffer)
+	MaxGossipCount int64
+	// CompactDigestThreshold is the digest size from which gossip messages
+	// carry a bloom filter instead of the digest, to the peers which support
+	// it. The receiver answers with a bloom filter of its own buffer and the
+	// gossiper sends the messages missing from it
+	// Optional (default: the full digest is always sent)
+	CompactDigestThreshold int
+	// FullDigestInterval is the number of rounds after which the full digest is
+	// sent instead of a bloom filter, so the messages hidden by false positives
+	// are eventually solicited
+	// Optional (default: 10)
+	FullDigestInterval int
+	// BufferFullPolicy is the behaviour of AddMessage when the buffer is full.
+	// Messages received from peers always replace the oldest messages.
+	// Optional (default: DropOldestPolicy)
+	BufferFullPolicy BufferFullPolicy
+	// MaxSyncMessages is the maximum number of messages sent in a synchronization
+	// message. The remaining messages are solicited again by the receiver.
+	// Received synchronizations are limited too: only the first MaxSyncMessages
+	// messages are processed and the remaining ones are solicited again
+	// Optional (default: no limit)
+	MaxSyncMessages int
+	// MaxSyncBytes is the maximum size of messages sent in a synchronization
+	// message, in bytes. The remaining messages are solicited again by the receiver
+	// Optional (default: no limit)
+	MaxSyncBytes int
+	// SyncPageSize is the maximum number of messages requested in a page of a
+	// bulk synchronization, in which a node pulls all its missing messages
+	// from a peer (see SyncWith)
+	// Optional (default: 256)
+	SyncPageSize int
+	// FullSyncThreshold is the number of missing messages above which a node
+	// pulls them in a bulk synchronization, instead of soliciting them. Nodes
+	// always pull the messages in bulk when they join
+	// Optional (default: 64)
+	FullSyncThreshold int
+	// CompressionThreshold is the approximate size of synchronizations, in
+	// bytes, below which they are not compressed, since compressing small
+	// bodies costs more than it saves. Synchronizations are compressed with
+	// gzip only for the peers which negotiated it
+	// Optional (default: 0, synchronizations are always compressed)
+	CompressionThreshold int
+	// BlobThreshold is the size of json encoded messages, in bytes, above
+	// which messages are not sent in synchronization messages. Only a reference
+	// is sent, and the receivers fetch the message from the blob endpoint
+	// Optional (default: messages are always sent in synchronization messages)
+	BlobThreshold int
+	// MaxFragmentSize is the maximum size of json encoded messages, in bytes.
+	// Greater messages are split in fragments which are disseminated as individual
+	// messages, and reassembled before the callbacks are called
+	// Optional (default: messages are not fragmented)
+	MaxFragmentSize int
+	// FragmentTTL is the maximum duration in which the fragments of a message
+	// must be received. After it, the received fragments are dropped
+	// Optional (default: 1m)
+	FragmentTTL time.Duration
+	// DeltaStates are the states replicated by deltas, by callback type.
+	// Messages of these types are deltas merged in the state of their type
+	// Optional
+	DeltaStates map[string]DeltaState
+	// SeenCacheSize is the number of recently delivered message IDs which are
+	// kept, so messages dropped from buffer are not delivered again when they
+	// are received from peers which still have them
+	// Optional (default: twice the buffer size)
+	SeenCacheSize int
+	// Resolvers decide which version of keyed messages wins, by callback type
+	// Optional (default: LastWriteWins)
+	Resolvers map[string]Resolver
+	// TombstoneTTL is the duration for which removed messages are not synced
+	// again from peers which still have them
+	// Optional (default: 1m)
+	TombstoneTTL time.Duration
+	// MaxTombstones is the maximum number of tombstones. When there are more
+	// tombstones, the ones which expire first are removed
+	// Optional (default: no limit)
+	MaxTombstones int
+	// DataDir is the directory in which the peers and the messages are saved.
+	// When the protocol is created on an existing data directory, it restores
+	// its peers and messages and, when it is started, it announces its return
+	// to its peers and repairs the messages it missed
+	// Optional (default: the state is not saved)
+	DataDir string
+	// MessageStore is the backend in which the messages buffer is saved. The
+	// saved messages are restored when the protocol is created. FileStore
+	// requires DataDir
+	// Optional (default: FileStore when DataDir is set, the messages are not saved otherwise)
+	MessageStore MessageStore
+	// PeersFile is the file in which the peers buffer is saved each time it
+	// changes. The saved peers are loaded when the protocol is created, so a
+	// restarted node rejoins its peers
+	// Optional (default: the peers buffer is not saved)
+	PeersFile string
+	// PreferredPeers are contacted in every gossip round, in addition to the
+	// selected peers, so they never miss messages (e.g. an archive node)
+	// Optional
+	PreferredPeers []Peer
+	// PreferResponsivePeers selects gossip peers randomly, with a probability
+	// proportional to their responsiveness score. It can't be used with
+	// PeerSelector or PreferNearbyPeers
+	// Optional (default: false)
+	PreferResponsivePeers bool
+	// PreferNearbyPeers selects the gossip peers with the lowest round trip time,
+	// estimated with Vivaldi network coordinates. It can't be used with
+	// PeerSelector or PreferResponsivePeers
+	// Optional (default: false)
+	PreferNearbyPeers bool
+	// NearbyExploration is the probability, between 0 and 1, of selecting a
+	// random peer instead of a nearby one, when PreferNearbyPeers is set
+	// Optional (default: 0.1)
+	NearbyExploration float64
+	// Roles are the protocol phases in which the node participates
+	// Optional (default: DefaultRoles)
+	Roles Role
+	// Topics are the topics, i.e. the callback types, of the messages which
+	// the node receives. Peers gossip to the node only the digests of these
+	// topics, and the messages of other topics are ignored. The messages of
+	// the protocol, e.g. the add peer messages, are always received
+	// Optional (default: all topics)
+	Topics []string
+	// SuspicionTimeout enables the failure detector: a peer is suspect when a
+	// request to it fails, and it is removed from peers buffer if it doesn't
+	// answer and it doesn't send any request during the timeout
+	// Optional (default: 0, dead peers are not removed)
+	SuspicionTimeout time.Duration
+	// ProbeInterval is the interval at which a random peer is probed by the
+	// failure detector, besides the gossip requests
+	// Optional (default: 1s)
+	ProbeInterval time.Duration
+	// PeerStaleTimeout is the duration without contact after which a peer is
+	// reported as stale by GetPeerStatuses
+	// Optional (default: 1m)
+	PeerStaleTimeout time.Duration
+	// MaxPeers is the maximum number of peers in peers buffer. When it is
+	// reached, adding a peer evicts the least recently seen peer
+	// Optional (default: adding peers fails at 4096 peers)
+	MaxPeers int
+	// RetransmitTimeout is the duration after which critical messages are
+	// pushed again to the peers which didn't acknowledge them
+	// Optional (default: 1s)
+	RetransmitTimeout time.Duration
+	// Scheduler decides when the gossip rounds run, e.g. to drive them from
+	// the event loop of an embedding system
+	// Optional (default: rounds of RoundDuration, see RoundJitter and MaxRoundDuration)
+	Scheduler Scheduler
+	// PeerSelector selects the peers which receive gossip messages in each round
+	// Optional (default: uniform random selection)
+	PeerSelector PeerSelector
+	// MaxSyncBytesPerSecond is the budget of outbound synchronization traffic,
+	// so the catch up after a partition doesn't starve the application
+	// Optional (default: no limit)
+	MaxSyncBytesPerSecond int
+	// MaxConcurrentRequests is the maximum number of simultaneous outbound
+	// gossip, solicitation and synchronization requests. Other requests wait
+	// for a free slot, so slow peers don't exhaust goroutines and sockets
+	// Optional (default: no limit)
+	MaxConcurrentRequests int
+	// RateLimit limits the requests accepted on the protocol endpoints, per
+	// peer and for all peers, so a misbehaving peer can't flood the node
+	// Optional (default: no limits)
+	RateLimit RateLimit
+	// MaxConcurrentCallbacks is the maximum number of synchronizations whose
+	// messages are synced and whose callbacks run at the same time. Other
+	// synchronizations are answered with 429 Too Many Requests
+	// Optional (default: no limit)
+	MaxConcurrentCallbacks int
+	// CallbackPolicy configures the workers, the timeout and the retries of
+	// the callbacks
+	// Optional (default: the callbacks run once, in the synchronization handler)
+	CallbackPolicy CallbackPolicy
+	// Transport carries the requests between nodes. The node serves the
+	// requests sent to it through the transport, instead of listening on TCP
+	// Optional (default: HTTP over TCP)
+	Transport Transport
+	// Recorder records all the requests sent and received by the node, so the
+	// exchanges can be replayed later with Replay
+	// Optional (default: the exchanges are not recorded)
+	Recorder *Recorder
+	// PeerExchangeSize is the number of random known peers sent in each gossip
+	// message. Receivers add them and the sender in their peers buffer, so the
+	// membership spreads epidemically
+	// Optional (default: PartialView.ActiveSize, or peers are not exchanged
+	// without partial view)
+	PeerExchangeSize int
+	// PartialView bounds the peers buffer to a small active view, keeping the
+	// other known peers in a passive view
+	// Optional (default: disabled)
+	PartialView PartialView
+	// SamplerSize is the number of peers sampled uniformly at random from the
+	// peers observed in gossip messages (Brahms-style). The sampled peers are
+	// selected for gossip in addition to the known peers, so the gossip stays
+	// random even if each node knows only a partial view
+	// Optional (default: peer sampling is disabled)
+	SamplerSize int
+	// JoinToken is the token which newcomers must present to join through this
+	// node, and which this node presents when it joins through Seeds
+	// Optional (default: any newcomer can join)
+	JoinToken string
+	// Seeds are the peers through which the node joins the cluster when it is
+	// started. Unreachable seeds are retried with backoff, in background
+	// Optional
+	Seeds []Peer
+	// SeedRecords are DNS SRV record names (e.g. _bmmc._tcp.example.com) from
+	// which the addresses and the ports of seeds are resolved at each join attempt
+	// Optional
+	SeedRecords []string
+	// LookupSRV resolves the SRV records from SeedRecords
+	// Optional (default: the lookup of the default DNS resolver)
+	LookupSRV func(ctx context.Context, name string) ([]*net.SRV, error)
+	// Discoverers discover seeds at each join attempt (e.g. cloud instances, DNS
+	// names or static files)
+	// Optional
+	Discoverers []Discoverer
+	// DiscoveryInterval is the interval at which the peers found by Discoverers
+	// are added in peers buffer, and the peers which are not found anymore are
+	// removed from it. Discoverers which are DiscoveryWatchers also refresh the
+	// peers as soon as they notify a change
+	// Optional (default: Discoverers only find seeds)
+	DiscoveryInterval time.Duration
+	// ReadyAfterSync makes the node ready (see /readyz) only after it pulled
+	// the messages missing from it from a peer, once after it was started, so
+	// it doesn't serve traffic while it is behind the cluster. The nodes which
+	// join no cluster are ready as soon as they are running
+	// Optional (default: the node is ready as soon as it knows a peer)
+	ReadyAfterSync bool
+	// BootstrapTimeout is the time after which the node stops retrying to join
+	// through Seeds
+	// Optional (default: it retries until the protocol is stopped)
+	BootstrapTimeout time.Duration
+	// ServerReadTimeout is the maximum duration for reading a whole request,
+	// so slow peers can't keep the handlers busy
+	// Optional (default: 10s)
+	ServerReadTimeout time.Duration
+	// ServerWriteTimeout is the maximum duration of a request, from the end of
+	// its headers until the response is written
+	// Optional (default: 10s)
+	ServerWriteTimeout time.Duration
+	// ServerIdleTimeout is the maximum duration for which idle keep-alive
+	// connections are kept open
+	// Optional (default: 1m)
+	ServerIdleTimeout time.Duration
+	// ServerMaxHeaderBytes is the maximum size of request headers, in bytes
+	// Optional (default: 1MB)
+	ServerMaxHeaderBytes int
+	// ServerMaxBodyBytes is the maximum size of request bodies, in bytes. The
+	// larger requests are rejected with 413 Request Entity Too Large
+	// Optional (default: 32MB)
+	ServerMaxBodyBytes int
+	// RequestTimeout is the maximum duration of each request sent to peers,
+	// so slow peers can't block the node
+	// Optional (default: 10s)
+	RequestTimeout time.Duration
+	// PeerFailureThreshold is the number of consecutive failed requests to a
+	// peer after which ErrPeerUnreachable is reported on the errors channel
+	// Optional (default: 5)
+	PeerFailureThreshold int
+	// QuarantineDuration is the duration in which the peers which failed
+	// PeerFailureThreshold consecutive requests, or which answer slower than
+	// SlowPeerRTT, are not selected for gossip, so the fanout is not wasted
+	// on them. After it, they are selected again and put back in quarantine
+	// if they still fail or answer slowly
+	// Optional (default: peers are not put in quarantine)
+	QuarantineDuration time.Duration
+	// SlowPeerRTT is the smoothed round trip time above which peers are put
+	// in quarantine, when QuarantineDuration is set
+	// Optional (default: slow peers are not put in quarantine)
+	SlowPeerRTT time.Duration
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept
+	// alive to each peer, so the requests of next rounds reuse them. It is
+	// used only when Transport is not set, as DialTimeout and IdleConnTimeout
+	// Optional (default: 16)
+	MaxIdleConnsPerHost int
+	// DialTimeout is the maximum duration of opening a connection to a peer
+	// Optional (default: 5s)
+	DialTimeout time.Duration
+	// IdleConnTimeout is the duration after which idle connections to peers
+	// are closed
+	// Optional (default: 90s)
+	IdleConnTimeout time.Duration
+	// ShutdownTimeout is the maximum duration for which Stop waits for the
+	// in-flight requests to finish, before interrupting them
+	// Optional (default: 5s)
+	ShutdownTimeout time.Duration
+	// OnRequest is called after each request served by the node, e.g. to log
+	// the requests or to collect metrics
+	// Optional (default: the requests are not reported)
+	OnRequest func(RequestLog)
+	// Tracer traces the gossip rounds and the exchanges with peers, e.g. with
+	// an OpenTelemetry tracer (see Tracer)
+	// Optional (default: no tracing)
+	Tracer Tracer
+	// OnRoundStart is called at the start of each gossip round, after the
+	// gossip targets are selected, e.g. to instrument the dissemination
+	// Optional (default: the rounds are not reported)
+	OnRoundStart func(RoundInfo)
+	// OnRoundEnd is called at the end of each gossip round
+	// Optional (default: the rounds are not reported)
+	OnRoundEnd func(RoundInfo)
+	// Middlewares wrap the handler of the protocol requests, e.g. for
+	// authentication, tracing or IP filtering. The first middleware is the
+	// outermost one
+	// Optional
+	Middlewares []func(http.Handler) http.Handler
+	// CORSOrigins are the origins from which browsers may call the inspection
+	// endpoints of the node, e.g. from dashboards, and connect to /stream. "*"
+	// allows any origin
+	// Optional (default: cross-origin requests are not allowed)
+	CORSOrigins []string
+	// StreamMessages serves the /stream endpoint, which streams the messages
+	// delivered to the node to WebSocket clients. The messages can be filtered
+	// by callback type (type parameter, repeatable) and by key prefix (key parameter)
+	// Optional (default: false)
+	StreamMessages bool
+	// Dashboard serves a web page on /dashboard, showing the peers, the buffer,
+	// the round rate and the recent deliveries of the node
+	// Optional (default: false)
+	Dashboard bool
+	// OnDelivery is called with each message delivered from peers, once,
+	// before the callbacks of the message. The messages of the protocol, e.g.
+	// the add peer messages, are not delivered
+	// Optional
+	OnDelivery func(Message)
+	// Ordering is the order in which the messages received from peers are
+	// delivered to subscribers, streams and callbacks. All nodes must have the
+	// same ordering
+	// Optional (default: NoOrdering)
+	Ordering Ordering
+	// MaxOrderingDelay is the maximum duration for which a message waits for
+	// the messages which precede it. After it, the message is delivered and
+	// the missing messages are delivered whenever they arrive
+	// Optional (default: 10s)
+	MaxOrderingDelay time.Duration
+	// SubscriptionBufferSize is the number of delivered messages buffered
+	// for each subscriber, see Subscribe
+	// Optional (default: 64)
+	SubscriptionBufferSize int
+	// SubscriptionFullPolicy is the behaviour of deliveries when the channel of
+	// a subscriber is full. RejectPolicy drops the new message for the
+	// subscriber and BlockPolicy waits until the subscriber reads a message
+	// Optional (default: DropOldestPolicy)
+	SubscriptionFullPolicy BufferFullPolicy
+	// Metrics serves the metrics of the node on /metrics, in the Prometheus
+	// text format. See also MetricsHandler
+	// Optional (default: false)
+	Metrics bool
+	// Debug serves the runtime profiles of net/http/pprof on /debug/pprof/
+	// and the variables published with expvar, with the stats of the node, on
+	// /debug/vars. When AdminToken is set, the clients must present it
+	// Optional (default: false)
+	Debug bool
+	// AdminToken serves the admin endpoints /admin/peers, /admin/messages and
+	// /admin/config to the clients which present it as bearer token. They
+	// inspect the peers, the messages buffer and the effective config, add
+	// (POST) or remove (DELETE) peers and add (POST) messages at runtime
+	// Optional (default: the admin endpoints are not served)
+	AdminToken string
+	// ClusterKey authenticates the protocol requests between nodes with
+	// HMAC-SHA256. Nodes reject the requests which are not signed with the
+	// cluster key. It can be replaced on all nodes with RotateClusterKey.
+	// It is required with the UDPTransport
+	// Optional (default: requests are not authenticated)
+	ClusterKey []byte
+	// NodeToken is attached to the protocol requests sent by the node, so the
+	// peers which have it in their PeerTokens accept them
+	// Optional (default: no token is sent)
+	NodeToken string
+	// PeerTokens are the tokens of the cluster members, by addr:port. When it
+	// is set, nodes reject the protocol requests which don't carry the token
+	// of the node which sent them
+	// Optional (default: requests are not authenticated with tokens)
+	PeerTokens map[string]string
+	// KeyRotationWindow is the duration for which the previous cluster key is
+	// still accepted after a rotation
+	// Optional (default: 1m)
+	KeyRotationWindow time.Duration
+	// SignatureWindow is the maximum difference between the time at which a
+	// request is signed with the cluster key and the time at which it is
+	// verified, so captured requests can't be replayed after it. The clocks of
+	// the nodes must be synchronized within it
+	// Optional (default: 1m)
+	SignatureWindow time.Duration
+	// TopicACLs restrict, by callback type, which nodes may publish messages
+	// and which clients may stream them
+	// Optional (default: no restrictions)
+	TopicACLs map[string]TopicACL
+	// SubscriberIdentity returns the identity of the client of a stream, which
+	// is checked against the subscribers of TopicACLs, e.g. from a token
+	// Optional (default: the host of the client)
+	SubscriberIdentity func(*http.Request) string
+	// OriginQuota limits the messages accepted from each origin node in a
+	// time window
+	// Optional (default: no limits)
+	OriginQuota OriginQuota
+	// IdentityKey signs the messages added by the node, so peers can verify
+	// their sender
+	// Optional (default: messages are not signed)
+	IdentityKey ed25519.PrivateKey
+	// Identities are the public identity keys of nodes, by addr:port. The
+	// messages signed with these keys have a verified Sender
+	// Optional (default: no sender is verified, except this node)
+	Identities map[string]ed25519.PublicKey
+	// RequireSignedMessages rejects the messages received from peers which
+	// don't have a verified Sender, before they are added in buffer and
+	// before their callbacks run
+	// Optional (default: false)
+	RequireSignedMessages bool
+	// MessageKey authenticates the messages with HMAC-SHA256 over their ID,
+	// payload and metadata. The messages received from peers without a valid
+	// MAC are rejected, before they are added in buffer and before their
+	// callbacks run. All nodes must have the same message key
+	// Optional (default: messages are not authenticated)
+	MessageKey []byte
+	// TrustReportedAddrs replies to the addresses reported in the protocol
+	// requests even if they are not the addresses of the connections, e.g.
+	// for nodes behind NAT or proxies
+	// Optional (default: false)
+	TrustReportedAddrs bool
+	// TLSConfig serves the protocol over https and sends the requests to
+	// peers over https, with the certificate of the node. It can't be used
+	// with a Transport
+	// Optional (default: plain http)
+	TLSConfig *TLSConfig
+	// Multicast sends the messages added on the node to a UDP multicast or
+	// broadcast group before they are gossiped, for LAN deployments
+	// Optional (default: messages are only gossiped)
+	Multicast MulticastConfig
 }
 
 // validate validates given config.
@@ -74,10 +663,247 @@ func (cfg *Config) validate() error {
 		return errInvalidBufSize
 	}
 
+	if cfg.MessageTTL < 0 {
+		return errInvalidMessageTTL
+	}
+
+	if cfg.MaxGossipCount < 0 {
+		return errInvalidGossipTTL
+	}
+
+	if cfg.WireFormat < JSONWireFormat || cfg.WireFormat > MsgpackWireFormat {
+		return errInvalidWireFormat
+	}
+
+	if cfg.GossipMode < PushGossipMode || cfg.GossipMode > PushPullGossipMode {
+		return errInvalidGossipMode
+	}
+
+	if !validLogLevel(cfg.LogLevel) {
+		return errInvalidLogLevel
+	}
+
+	for _, l := range cfg.ComponentLogLevels {
+		if !validLogLevel(l) {
+			return errInvalidLogLevel
+		}
+	}
+
+	if (cfg.MinBeta != 0 || cfg.MaxBeta != 0) &&
+		(cfg.MinBeta <= 0 || cfg.MinBeta > cfg.MaxBeta || cfg.MaxBeta > 1) {
+		return errInvalidBetaRange
+	}
+
+	if cfg.CompactDigestThreshold < 0 || cfg.FullDigestInterval < 0 {
+		return errInvalidCompactDigest
+	}
+
+	if cfg.CompressionThreshold < 0 {
+		return errInvalidCompression
+	}
+
+	if cfg.MaxBufferBytes < 0 {
+		return errInvalidBufBytes
+	}
+
+	if cfg.RoundJitter < 0 {
+		return errInvalidRoundJitter
+	}
+
+	if cfg.BufferFullPolicy < DropOldestPolicy || cfg.BufferFullPolicy > BlockPolicy {
+		return errInvalidFullPolicy
+	}
+
+	if cfg.SubscriptionBufferSize < 0 ||
+		cfg.SubscriptionFullPolicy < DropOldestPolicy || cfg.SubscriptionFullPolicy > BlockPolicy {
+		return errInvalidSubscription
+	}
+
+	if cfg.MaxSyncMessages < 0 || cfg.MaxSyncBytes < 0 || cfg.BlobThreshold < 0 ||
+		cfg.MaxFragmentSize < 0 || cfg.FragmentTTL < 0 || cfg.SyncPageSize < 0 || cfg.FullSyncThreshold < 0 {
+		return errInvalidSyncLimit
+	}
+
+	if cfg.MaxRoundDuration != 0 && cfg.MaxRoundDuration < cfg.RoundDuration {
+		return errInvalidMaxRound
+	}
+
+	if cfg.SeenCacheSize < 0 {
+		return errInvalidSeenCache
+	}
+
+	if cfg.TombstoneTTL < 0 || cfg.MaxTombstones < 0 {
+		return errInvalidTombstone
+	}
+
+	if cfg.BootstrapTimeout < 0 {
+		return errInvalidBootstrap
+	}
+
+	if cfg.DiscoveryInterval < 0 {
+		return errInvalidDiscovery
+	}
+
+	if cfg.PeerExchangeSize < 0 {
+		return errInvalidPeerExchange
+	}
+
+	if cfg.PartialView.ActiveSize < 0 || cfg.PartialView.PassiveSize < 0 {
+		return errInvalidPartialView
+	}
+
+	if cfg.MaxPeers < 0 || cfg.MaxPeers >= peer.MAXPEERS {
+		return errInvalidMaxPeers
+	}
+
+	if cfg.SamplerSize < 0 {
+		return errInvalidSamplerSize
+	}
+
+	if cfg.MaxSyncBytesPerSecond < 0 {
+		return errInvalidBandwidth
+	}
+
+	if cfg.MaxConcurrentRequests < 0 {
+		return errInvalidConcurrency
+	}
+
+	if cfg.RateLimit.PeerRequests < 0 || cfg.RateLimit.Requests < 0 || cfg.MaxConcurrentCallbacks < 0 {
+		return errInvalidRateLimit
+	}
+
+	if p := cfg.CallbackPolicy; p.Workers < 0 || p.QueueSize < 0 || p.Timeout < 0 || p.Retries < 0 || p.Backoff < 0 {
+		return errInvalidCallbackPolicy
+	}
+
+	if cfg.ServerReadTimeout < 0 || cfg.ServerWriteTimeout < 0 || cfg.ServerIdleTimeout < 0 ||
+		cfg.ServerMaxHeaderBytes < 0 || cfg.ServerMaxBodyBytes < 0 || cfg.ShutdownTimeout < 0 {
+		return errInvalidServerLimit
+	}
+
+	if cfg.RequestTimeout < 0 {
+		return errInvalidRequestTimeout
+	}
+
+	if cfg.PeerFailureThreshold < 0 {
+		return errInvalidFailureThreshold
+	}
+
+	if cfg.QuarantineDuration < 0 || cfg.SlowPeerRTT < 0 {
+		return errInvalidQuarantine
+	}
+
+	if err := cfg.Multicast.validate(); err != nil {
+		return err
+	}
+
+	if cfg.MaxIdleConnsPerHost < 0 || cfg.DialTimeout < 0 || cfg.IdleConnTimeout < 0 {
+		return errInvalidConnPool
+	}
+
+	if cfg.KeyRotationWindow < 0 {
+		return errInvalidKeyRotation
+	}
+
+	if cfg.SignatureWindow < 0 {
+		return errInvalidSignatureWindow
+	}
+
+	// the source of datagrams can be spoofed, so their requests are answered
+	// only if they are signed
+	if _, ok := cfg.Transport.(*UDPTransport); ok && len(cfg.ClusterKey) == 0 {
+		return errUnsignedUDP
+	}
+
+	if cfg.RetransmitTimeout < 0 {
+		return errInvalidRetransmit
+	}
+
+	if cfg.PeerStaleTimeout < 0 {
+		return errInvalidStaleTimeout
+	}
+
+	if cfg.SuspicionTimeout < 0 || cfg.ProbeInterval < 0 {
+		return errInvalidFailureDetector
+	}
+
+	if cfg.MessageStore < DefaultStore || cfg.MessageStore > FileStore ||
+		(cfg.MessageStore == FileStore && cfg.DataDir == "") {
+		return errInvalidMessageStore
+	}
+
+	if cfg.OriginQuota.Messages < 0 || cfg.OriginQuota.Bytes < 0 || cfg.OriginQuota.Window < 0 {
+		return errInvalidOriginQuota
+	}
+
+	if cfg.NearbyExploration < 0 || cfg.NearbyExploration > 1 {
+		return errInvalidExploration
+	}
+
+	// the preferences replace the peer selector, so they are not combined silently
+	selectors := 0
+	for _, set := range []bool{cfg.PeerSelector != nil, cfg.PreferResponsivePeers, cfg.PreferNearbyPeers} {
+		if set {
+			selectors++
+		}
+	}
+
+	if selectors > 1 {
+		return errConflictingSelectors
+	}
+
+	if cfg.Ordering < NoOrdering || cfg.Ordering > FIFOOrdering || cfg.MaxOrderingDelay < 0 {
+		return errInvalidOrdering
+	}
+
 	if err := callback.ValidateCustomCallbacks(cfg.Callbacks); err != nil {
 		return err
 	}
 
+	if err := validatePeers(cfg.PreferredPeers); err != nil {
+		return err
+	}
+
+	if err := validatePeers(cfg.Seeds); err != nil {
+		return err
+	}
+
+	if cfg.IdentityKey != nil && len(cfg.IdentityKey) != ed25519.PrivateKeySize {
+		return errInvalidIdentityKey
+	}
+
+	for cbType := range cfg.MessageCallbacks {
+		if callback.IsDefaultCallback(cbType) {
+			return errInvalidMessageCallback
+		}
+	}
+
+	for cbType, cb := range cfg.ContextCallbacks {
+		if cb == nil || callback.IsDefaultCallback(cbType) {
+			return errInvalidContextCallback
+		}
+	}
+
+	// the datagrams are authenticated with the cluster key, but they are not
+	// encrypted, so the tls config would be silently ignored
+	if _, ok := cfg.Transport.(*UDPTransport); ok && cfg.TLSConfig != nil {
+		return errUnencryptedUDP
+	}
+
+	if cfg.TLSConfig != nil && (cfg.TLSConfig.CertFile == "" || cfg.TLSConfig.KeyFile == "" || cfg.Transport != nil) {
+		return errInvalidTLSConfig
+	}
+
+	if _, err := callback.NewTypedRegistry(cfg.TypedCallbacks); err != nil {
+		return errInvalidTypedCallback
+	}
+
+	for cbType := range cfg.DeltaStates {
+		if callback.IsDefaultCallback(cbType) {
+			return errInvalidDeltaState
+		}
+	}
+
 	return nil
 }
 
@@ -95,7 +921,174 @@ func (cfg *Config) fillEmptyFields() {
 		cfg.RoundDuration = defaultRoundDuration
 	}
 
+	if cfg.SeenCacheSize == 0 {
+		cfg.SeenCacheSize = 2 * cfg.BufferSize // nolint: gomnd
+	}
+
+	if cfg.FullDigestInterval == 0 {
+		cfg.FullDigestInterval = defaultFullDigestInterval
+	}
+
+	if cfg.TombstoneTTL == 0 {
+		cfg.TombstoneTTL = defaultTombstoneTTL
+	}
+
 	if cfg.Callbacks == nil {
 		cfg.Callbacks = map[string]func(interface{}, *log.Logger) error{}
 	}
+
+	if cfg.DeltaStates == nil {
+		cfg.DeltaStates = map[string]DeltaState{}
+	}
+
+	if cfg.Roles == 0 {
+		cfg.Roles = DefaultRoles
+	}
+
+	if cfg.DataDir != "" && cfg.PeersFile == "" {
+		cfg.PeersFile = filepath.Join(cfg.DataDir, peersFileName)
+	}
+
+	if cfg.DataDir != "" && cfg.MessageStore == DefaultStore {
+		cfg.MessageStore = FileStore
+	}
+
+	if cfg.PartialView.enabled() && cfg.PartialView.PassiveSize == 0 {
+		cfg.PartialView.PassiveSize = defaultPassiveViewFactor * cfg.PartialView.ActiveSize
+	}
+
+	if cfg.PartialView.enabled() && cfg.PeerExchangeSize == 0 {
+		cfg.PeerExchangeSize = cfg.PartialView.ActiveSize
+	}
+
+	if cfg.NearbyExploration == 0 {
+		cfg.NearbyExploration = defaultNearbyExploration
+	}
+
+	if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = defaultRequestTimeout
+	}
+
+	if cfg.CallbackPolicy.Workers > 0 && cfg.CallbackPolicy.QueueSize == 0 {
+		cfg.CallbackPolicy.QueueSize = defaultCallbackQueueSize
+	}
+
+	if cfg.CallbackPolicy.Retries > 0 && cfg.CallbackPolicy.Backoff == 0 {
+		cfg.CallbackPolicy.Backoff = defaultCallbackBackoff
+	}
+
+	if cfg.PeerFailureThreshold == 0 {
+		cfg.PeerFailureThreshold = defaultPeerFailureThreshold
+	}
+
+	if cfg.MaxIdleConnsPerHost == 0 {
+		cfg.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+
+	if cfg.IdleConnTimeout == 0 {
+		cfg.IdleConnTimeout = defaultIdleConnTimeout
+	}
+
+	if cfg.ServerReadTimeout == 0 {
+		cfg.ServerReadTimeout = defaultServerReadTimeout
+	}
+
+	if cfg.ServerWriteTimeout == 0 {
+		cfg.ServerWriteTimeout = defaultServerWriteTimeout
+	}
+
+	if cfg.ServerIdleTimeout == 0 {
+		cfg.ServerIdleTimeout = defaultServerIdleTimeout
+	}
+
+	if cfg.ServerMaxHeaderBytes == 0 {
+		cfg.ServerMaxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+
+	if cfg.ServerMaxBodyBytes == 0 {
+		cfg.ServerMaxBodyBytes = defaultServerMaxBodyBytes
+	}
+
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	if cfg.KeyRotationWindow == 0 {
+		cfg.KeyRotationWindow = defaultKeyRotationWindow
+	}
+
+	if cfg.SignatureWindow == 0 {
+		cfg.SignatureWindow = defaultSignatureWindow
+	}
+
+	if cfg.RetransmitTimeout == 0 {
+		cfg.RetransmitTimeout = defaultRetransmitTimeout
+	}
+
+	if cfg.PeerStaleTimeout == 0 {
+		cfg.PeerStaleTimeout = defaultPeerStaleTimeout
+	}
+
+	if cfg.ProbeInterval == 0 {
+		cfg.ProbeInterval = defaultProbeInterval
+	}
+
+	if cfg.SubscriptionBufferSize == 0 {
+		cfg.SubscriptionBufferSize = defaultSubscriptionBufferSize
+	}
+
+	if cfg.FragmentTTL == 0 {
+		cfg.FragmentTTL = defaultFragmentTTL
+	}
+
+	if cfg.SyncPageSize == 0 {
+		cfg.SyncPageSize = defaultSyncPageSize
+	}
+
+	if cfg.FullSyncThreshold == 0 {
+		cfg.FullSyncThreshold = defaultFullSyncThreshold
+	}
+
+	if cfg.MaxOrderingDelay == 0 {
+		cfg.MaxOrderingDelay = defaultMaxOrderingDelay
+	}
+
+	if cfg.OriginQuota.enabled() && cfg.OriginQuota.Window == 0 {
+		cfg.OriginQuota.Window = defaultQuotaWindow
+	}
+
+	if cfg.Multicast.enabled() && cfg.Multicast.MaxPacketSize == 0 {
+		cfg.Multicast.MaxPacketSize = defaultMulticastPacketSize
+	}
+
+	if cfg.SubscriberIdentity == nil {
+		cfg.SubscriberIdentity = remoteHost
+	}
+
+	if cfg.LookupSRV == nil {
+		cfg.LookupSRV = lookupSRV
+	}
+
+	if cfg.PeerSelector == nil {
+		cfg.PeerSelector = NewRandomSelector()
+	}
+}
+
+// validatePeers returns error if any of given peers has an invalid address or port.
+func validatePeers(peers []Peer) error {
+	for _, p := range peers {
+		if err := validators.AddrValidator()(p.Addr); err != nil {
+			return err
+		}
+
+		if err := validators.PortAsStringValidator()(p.Port); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -19,6 +19,7 @@ package bmmc
 import (
 	"errors"
 	"log"
+	"net/http"
 	"os"
 	"time"
 
@@ -70,6 +71,341 @@ var _ = Describe("BMMC Config", func() {
 			Expect(cfg.validate()).To(MatchError(errInvalidBufSize))
 		})
 
+		It("returns error when max buffer bytes is negative", func() {
+			cfg.MaxBufferBytes = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidBufBytes))
+		})
+
+		It("returns error when round jitter is negative", func() {
+			cfg.RoundJitter = -time.Millisecond
+			Expect(cfg.validate()).To(MatchError(errInvalidRoundJitter))
+		})
+
+		It("returns error when max round duration is lower than round duration", func() {
+			cfg.MaxRoundDuration = cfg.RoundDuration - time.Millisecond
+			Expect(cfg.validate()).To(MatchError(errInvalidMaxRound))
+		})
+
+		It("returns error when buffer full policy is invalid", func() {
+			cfg.BufferFullPolicy = BlockPolicy + 1
+			Expect(cfg.validate()).To(MatchError(errInvalidFullPolicy))
+		})
+
+		It("returns error when synchronization limits are negative", func() {
+			cfg.MaxSyncMessages = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidSyncLimit))
+
+			cfg.MaxSyncMessages = 0
+			cfg.FragmentTTL = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidSyncLimit))
+
+			cfg.FragmentTTL = 0
+			cfg.SyncPageSize = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidSyncLimit))
+		})
+
+		It("returns error when seen cache size is negative", func() {
+			cfg.SeenCacheSize = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidSeenCache))
+		})
+
+		It("returns error when tombstone ttl is negative", func() {
+			cfg.TombstoneTTL = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidTombstone))
+		})
+
+		It("returns error when a preferred peer has an invalid port", func() {
+			cfg.PreferredPeers = []Peer{{Addr: "localhost", Port: "invalid"}}
+			Expect(cfg.validate()).NotTo(Succeed())
+		})
+
+		It("returns error when a seed has an invalid port", func() {
+			cfg.Seeds = []Peer{{Addr: "localhost", Port: "invalid"}}
+			Expect(cfg.validate()).NotTo(Succeed())
+		})
+
+		It("returns error when peer exchange size is negative", func() {
+			cfg.PeerExchangeSize = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidPeerExchange))
+		})
+
+		It("returns error when partial view sizes are negative", func() {
+			cfg.PartialView = PartialView{ActiveSize: -1}
+			Expect(cfg.validate()).To(MatchError(errInvalidPartialView))
+		})
+
+		It("returns error when sampler size is negative", func() {
+			cfg.SamplerSize = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidSamplerSize))
+		})
+
+		It("returns error when server timeouts are negative", func() {
+			cfg.ServerReadTimeout = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidServerLimit))
+		})
+
+		It("returns error when max body bytes is negative", func() {
+			cfg.ServerMaxBodyBytes = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidServerLimit))
+		})
+
+		It("returns error when shutdown timeout is negative", func() {
+			cfg.ShutdownTimeout = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidServerLimit))
+		})
+
+		It("returns error when request timeout is negative", func() {
+			cfg.RequestTimeout = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidRequestTimeout))
+		})
+
+		It("returns error when peer failure threshold is negative", func() {
+			cfg.PeerFailureThreshold = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidFailureThreshold))
+		})
+
+		It("returns error when quarantine settings are negative", func() {
+			cfg.QuarantineDuration = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidQuarantine))
+		})
+
+		It("returns error when connection pool settings are negative", func() {
+			cfg.MaxIdleConnsPerHost = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidConnPool))
+
+			cfg.MaxIdleConnsPerHost = 0
+			cfg.DialTimeout = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidConnPool))
+		})
+
+		It("returns error when key rotation window is negative", func() {
+			cfg.KeyRotationWindow = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidKeyRotation))
+		})
+
+		It("returns error when signature window is negative", func() {
+			cfg.SignatureWindow = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidSignatureWindow))
+		})
+
+		It("returns error when nearby exploration is greater than 1", func() {
+			cfg.NearbyExploration = 1.5
+			Expect(cfg.validate()).To(MatchError(errInvalidExploration))
+		})
+
+		It("returns error when peer selectors are combined", func() {
+			cfg.PeerSelector = NewRoundRobinSelector()
+			cfg.PreferResponsivePeers = true
+			Expect(cfg.validate()).To(MatchError(errConflictingSelectors))
+
+			cfg.PeerSelector = nil
+			cfg.PreferNearbyPeers = true
+			Expect(cfg.validate()).To(MatchError(errConflictingSelectors))
+
+			cfg.PreferResponsivePeers = false
+			Expect(cfg.validate()).To(Succeed())
+		})
+
+		It("returns error when synchronization bandwidth is negative", func() {
+			cfg.MaxSyncBytesPerSecond = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidBandwidth))
+		})
+
+		It("returns error when concurrent requests limit is negative", func() {
+			cfg.MaxConcurrentRequests = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidConcurrency))
+		})
+
+		It("returns error when rate limits are negative", func() {
+			cfg.RateLimit.PeerRequests = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidRateLimit))
+
+			cfg.RateLimit.PeerRequests = 0
+			cfg.MaxConcurrentCallbacks = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidRateLimit))
+		})
+
+		It("returns error when callback policy is negative", func() {
+			cfg.CallbackPolicy.Workers = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidCallbackPolicy))
+
+			cfg.CallbackPolicy.Workers = 0
+			cfg.CallbackPolicy.Timeout = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidCallbackPolicy))
+		})
+
+		It("returns error when subscription config is invalid", func() {
+			cfg.SubscriptionBufferSize = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidSubscription))
+
+			cfg.SubscriptionBufferSize = 0
+			cfg.SubscriptionFullPolicy = BlockPolicy + 1
+			Expect(cfg.validate()).To(MatchError(errInvalidSubscription))
+		})
+
+		It("returns error when failure detector timeouts are negative", func() {
+			cfg.SuspicionTimeout = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidFailureDetector))
+
+			cfg.SuspicionTimeout = time.Second
+			cfg.ProbeInterval = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidFailureDetector))
+		})
+
+		It("returns error when max gossip count is negative", func() {
+			cfg.MaxGossipCount = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidGossipTTL))
+		})
+
+		It("returns error when compression threshold is negative", func() {
+			cfg.CompressionThreshold = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidCompression))
+		})
+
+		It("returns error when wire format is invalid", func() {
+			cfg.WireFormat = MsgpackWireFormat + 1
+			Expect(cfg.validate()).To(MatchError(errInvalidWireFormat))
+		})
+
+		It("returns error when gossip mode is invalid", func() {
+			cfg.GossipMode = PushPullGossipMode + 1
+			Expect(cfg.validate()).To(MatchError(errInvalidGossipMode))
+		})
+
+		It("returns error when log level is invalid", func() {
+			cfg.LogLevel = ErrorLevel + 1
+			Expect(cfg.validate()).To(MatchError(errInvalidLogLevel))
+
+			cfg.LogLevel = InfoLevel
+			cfg.ComponentLogLevels = map[LogComponent]LogLevel{GossipComponent: -1}
+			Expect(cfg.validate()).To(MatchError(errInvalidLogLevel))
+		})
+
+		It("returns error when beta range is invalid", func() {
+			cfg.MaxBeta = 0.5
+			Expect(cfg.validate()).To(MatchError(errInvalidBetaRange))
+
+			cfg.MinBeta = 0.6
+			Expect(cfg.validate()).To(MatchError(errInvalidBetaRange))
+
+			cfg.MinBeta, cfg.MaxBeta = 0.1, 1.5
+			Expect(cfg.validate()).To(MatchError(errInvalidBetaRange))
+		})
+
+		It("returns error when message ttl is negative", func() {
+			cfg.MessageTTL = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidMessageTTL))
+		})
+
+		It("returns error when compact digest options are negative", func() {
+			cfg.CompactDigestThreshold = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidCompactDigest))
+
+			cfg.CompactDigestThreshold = 0
+			cfg.FullDigestInterval = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidCompactDigest))
+		})
+
+		It("returns error when message store is invalid", func() {
+			cfg.MessageStore = FileStore + 1
+			Expect(cfg.validate()).To(MatchError(errInvalidMessageStore))
+
+			cfg.MessageStore = FileStore
+			cfg.DataDir = ""
+			Expect(cfg.validate()).To(MatchError(errInvalidMessageStore))
+		})
+
+		It("returns error when ordering is invalid", func() {
+			cfg.Ordering = FIFOOrdering + 1
+			Expect(cfg.validate()).To(MatchError(errInvalidOrdering))
+
+			cfg.Ordering = CausalOrdering
+			cfg.MaxOrderingDelay = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidOrdering))
+		})
+
+		It("returns error when peer stale timeout is negative", func() {
+			cfg.PeerStaleTimeout = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidStaleTimeout))
+		})
+
+		It("returns error when retransmit timeout is negative", func() {
+			cfg.RetransmitTimeout = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidRetransmit))
+		})
+
+		It("returns error when max peers is out of range", func() {
+			cfg.MaxPeers = 5000
+			Expect(cfg.validate()).To(MatchError(errInvalidMaxPeers))
+		})
+
+		It("returns error when origin quota is negative", func() {
+			cfg.OriginQuota.Messages = -1
+			Expect(cfg.validate()).To(MatchError(errInvalidOriginQuota))
+		})
+
+		It("returns error when bootstrap timeout is negative", func() {
+			cfg.BootstrapTimeout = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidBootstrap))
+		})
+
+		It("returns error when discovery interval is negative", func() {
+			cfg.DiscoveryInterval = -time.Second
+			Expect(cfg.validate()).To(MatchError(errInvalidDiscovery))
+		})
+
+		It("returns error when message callbacks use a default callback type", func() {
+			cfg.MessageCallbacks = map[string]func(Message, *log.Logger) error{"add-peer": nil}
+			Expect(cfg.validate()).To(MatchError(errInvalidMessageCallback))
+		})
+
+		It("returns error when multicast config is invalid", func() {
+			cfg.Multicast = MulticastConfig{Group: "239.1.2.3"}
+			Expect(cfg.validate()).To(MatchError(errInvalidMulticast))
+
+			cfg.Multicast = MulticastConfig{Group: "239.1.2.3:7946", MaxPacketSize: -1}
+			Expect(cfg.validate()).To(MatchError(errInvalidMulticast))
+		})
+
+		It("returns error when context callbacks are invalid", func() {
+			cfg.ContextCallbacks = map[string]Callback{"cb": nil}
+			Expect(cfg.validate()).To(MatchError(errInvalidContextCallback))
+		})
+
+		It("returns error when tls config is invalid", func() {
+			cfg.TLSConfig = &TLSConfig{CertFile: "node.pem"}
+			Expect(cfg.validate()).To(MatchError(errInvalidTLSConfig))
+
+			cfg.TLSConfig = &TLSConfig{CertFile: "node.pem", KeyFile: "node-key.pem"}
+			cfg.Transport = NewMemoryTransport()
+			Expect(cfg.validate()).To(MatchError(errInvalidTLSConfig))
+		})
+
+		It("returns error when udp transport should be encrypted with tls", func() {
+			cfg.TLSConfig = &TLSConfig{CertFile: "node.pem", KeyFile: "node-key.pem"}
+			cfg.Transport = NewUDPTransport(time.Second)
+			cfg.ClusterKey = []byte("secret")
+			Expect(cfg.validate()).To(MatchError(errUnencryptedUDP))
+		})
+
+		It("returns error when typed callbacks are invalid", func() {
+			cfg.TypedCallbacks = map[string]interface{}{"my-callback": func(string) error { return nil }}
+			Expect(cfg.validate()).To(MatchError(errInvalidTypedCallback))
+
+			cfg.TypedCallbacks = map[string]interface{}{"add-peer": func(string, *log.Logger) error { return nil }}
+			Expect(cfg.validate()).To(MatchError(errInvalidTypedCallback))
+		})
+
+		It("returns error when identity key is invalid", func() {
+			cfg.IdentityKey = []byte("short")
+			Expect(cfg.validate()).To(MatchError(errInvalidIdentityKey))
+		})
+
+		It("returns error when delta states use a default callback type", func() {
+			cfg.DeltaStates = map[string]DeltaState{"add-peer": nil}
+			Expect(cfg.validate()).To(MatchError(errInvalidDeltaState))
+		})
+
 		It("returns error when callback map contains an invalid callback (a default callback)", func() {
 			cfg.Callbacks = map[string]func(interface{}, *log.Logger) error{
 				"add-peer": func(_ interface{}, _ *log.Logger) error {
@@ -86,6 +422,30 @@ var _ = Describe("BMMC Config", func() {
 			cfg.RoundDuration = 0
 			cfg.Logger = nil
 			cfg.Callbacks = nil
+			cfg.PeerSelector = nil
+			cfg.DeltaStates = nil
+			cfg.Roles = 0
+			cfg.TombstoneTTL = 0
+			cfg.SeenCacheSize = 0
+			cfg.ServerReadTimeout = 0
+			cfg.ServerWriteTimeout = 0
+			cfg.ServerIdleTimeout = 0
+			cfg.ServerMaxHeaderBytes = 0
+			cfg.ShutdownTimeout = 0
+			cfg.KeyRotationWindow = 0
+			cfg.SubscriberIdentity = nil
+			cfg.OriginQuota = OriginQuota{Messages: 1}
+			cfg.RetransmitTimeout = 0
+			cfg.PeerStaleTimeout = 0
+			cfg.ProbeInterval = 0
+			cfg.SubscriptionBufferSize = 0
+			cfg.FullDigestInterval = 0
+			cfg.RequestTimeout = 0
+			cfg.PeerFailureThreshold = 0
+			cfg.MaxIdleConnsPerHost = 0
+			cfg.DialTimeout = 0
+			cfg.IdleConnTimeout = 0
+			cfg.CallbackPolicy = CallbackPolicy{Workers: 1, Retries: 1}
 
 			cfg.fillEmptyFields()
 
@@ -93,6 +453,31 @@ var _ = Describe("BMMC Config", func() {
 			Expect(cfg.RoundDuration).To(Equal(defaultRoundDuration))
 			Expect(cfg.Logger).NotTo(BeNil())
 			Expect(cfg.Callbacks).NotTo(BeNil())
+			Expect(cfg.PeerSelector).To(Equal(NewRandomSelector()))
+			Expect(cfg.DeltaStates).NotTo(BeNil())
+			Expect(cfg.Roles).To(Equal(DefaultRoles))
+			Expect(cfg.TombstoneTTL).To(Equal(defaultTombstoneTTL))
+			Expect(cfg.SeenCacheSize).To(Equal(2 * cfg.BufferSize))
+			Expect(cfg.ServerReadTimeout).To(Equal(defaultServerReadTimeout))
+			Expect(cfg.ServerWriteTimeout).To(Equal(defaultServerWriteTimeout))
+			Expect(cfg.ServerIdleTimeout).To(Equal(defaultServerIdleTimeout))
+			Expect(cfg.ServerMaxHeaderBytes).To(Equal(http.DefaultMaxHeaderBytes))
+			Expect(cfg.ShutdownTimeout).To(Equal(defaultShutdownTimeout))
+			Expect(cfg.KeyRotationWindow).To(Equal(defaultKeyRotationWindow))
+			Expect(cfg.SubscriberIdentity).NotTo(BeNil())
+			Expect(cfg.OriginQuota.Window).To(Equal(defaultQuotaWindow))
+			Expect(cfg.RetransmitTimeout).To(Equal(defaultRetransmitTimeout))
+			Expect(cfg.PeerStaleTimeout).To(Equal(defaultPeerStaleTimeout))
+			Expect(cfg.ProbeInterval).To(Equal(defaultProbeInterval))
+			Expect(cfg.SubscriptionBufferSize).To(Equal(defaultSubscriptionBufferSize))
+			Expect(cfg.FullDigestInterval).To(Equal(defaultFullDigestInterval))
+			Expect(cfg.RequestTimeout).To(Equal(defaultRequestTimeout))
+			Expect(cfg.PeerFailureThreshold).To(Equal(defaultPeerFailureThreshold))
+			Expect(cfg.MaxIdleConnsPerHost).To(Equal(defaultMaxIdleConnsPerHost))
+			Expect(cfg.DialTimeout).To(Equal(defaultDialTimeout))
+			Expect(cfg.IdleConnTimeout).To(Equal(defaultIdleConnTimeout))
+			Expect(cfg.CallbackPolicy.QueueSize).To(Equal(defaultCallbackQueueSize))
+			Expect(cfg.CallbackPolicy.Backoff).To(Equal(defaultCallbackBackoff))
 		})
 	})
 })
@@ -0,0 +1,79 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	// convergencePollInterval is the interval at which digests are compared
+	convergencePollInterval = time.Millisecond * 10
+
+	waitConvergenceErrFmt = "error at waiting for convergence: %w"
+)
+
+// waitFor calls done at each poll interval, until it returns true or ctx is done.
+func waitFor(ctx context.Context, done func() bool) error {
+	ticker := time.NewTicker(convergencePollInterval)
+	defer ticker.Stop()
+
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf(waitConvergenceErrFmt, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// sameDigest returns true if given digests contain the same IDs.
+func sameDigest(a, b []string) bool {
+	return len(a) == len(b) && len(buffer.MissingStrings(a, b)) == 0
+}
+
+// WaitForMessages blocks until the buffer contains all messages with given IDs,
+// or until ctx is done.
+func (b *BMMC) WaitForMessages(ctx context.Context, ids ...string) error {
+	return waitFor(ctx, func() bool {
+		return len(b.messageBuffer.Missing(ids)) == 0
+	})
+}
+
+// WaitForConvergence blocks until all given nodes have the same messages,
+// or until ctx is done.
+func WaitForConvergence(ctx context.Context, nodes ...*BMMC) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	return waitFor(ctx, func() bool {
+		for _, n := range nodes[1:] {
+			if !sameDigest(nodes[0].messageBuffer.Digest(), n.messageBuffer.Digest()) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// coordinateDimensions is the number of dimensions of network coordinates
+	coordinateDimensions = 3
+	// coordinateMaxError is the error of a new coordinate
+	coordinateMaxError = 1.5
+	// coordinateMinHeight is the minimum height of a coordinate, in seconds
+	coordinateMinHeight = 1e-5
+	// vivaldiCE limits the change of the error on each observation
+	vivaldiCE = 0.25
+	// vivaldiCC limits the change of the coordinate on each observation
+	vivaldiCC = 0.25
+
+	// defaultNearbyExploration is the default probability of selecting a random peer
+	defaultNearbyExploration = 0.1
+)
+
+// Coordinate is a Vivaldi network coordinate. The distance between the
+// coordinates of two nodes estimates the round trip time between them.
+type Coordinate struct {
+	// Vec is the position in the euclidean space, in seconds
+	Vec []float64 `json:"vec"`
+	// Height models the latency of the access link of the node, in seconds
+	Height float64 `json:"height"`
+	// Error is the confidence in the coordinate; lower is better
+	Error float64 `json:"error"`
+}
+
+// newCoordinate creates a coordinate in the origin, with maximum error.
+func newCoordinate() Coordinate {
+	return Coordinate{
+		Vec:    make([]float64, coordinateDimensions),
+		Height: coordinateMinHeight,
+		Error:  coordinateMaxError,
+	}
+}
+
+// valid returns true if the coordinate can be compared with local coordinates.
+func (c Coordinate) valid() bool {
+	return len(c.Vec) == coordinateDimensions && c.Error > 0
+}
+
+// distance returns the estimated round trip time between given coordinates, in seconds.
+func (c Coordinate) distance(other Coordinate) float64 {
+	sum := 0.0
+
+	for i := range c.Vec {
+		d := c.Vec[i] - other.Vec[i]
+		sum += d * d
+	}
+
+	return math.Sqrt(sum) + c.Height + other.Height
+}
+
+// update moves the coordinate after observing given rtt to a node with given coordinate.
+func (c Coordinate) update(other Coordinate, rtt float64) Coordinate {
+	dist := c.distance(other)
+
+	w := c.Error / (c.Error + other.Error)
+	sampleErr := math.Abs(dist-rtt) / rtt
+
+	next := Coordinate{
+		Vec:   make([]float64, len(c.Vec)),
+		Error: math.Min(sampleErr*vivaldiCE*w+c.Error*(1-vivaldiCE*w), coordinateMaxError),
+	}
+
+	force := vivaldiCC * w * (rtt - dist)
+
+	// unit vector from the other node to this node; random if they overlap
+	unit := make([]float64, len(c.Vec))
+	norm := 0.0
+
+	for i := range unit {
+		unit[i] = c.Vec[i] - other.Vec[i]
+		norm += unit[i] * unit[i]
+	}
+
+	if norm = math.Sqrt(norm); norm == 0 {
+		for i := range unit {
+			unit[i] = rand.Float64() - 0.5 // nolint: gomnd
+			norm += unit[i] * unit[i]
+		}
+
+		norm = math.Sqrt(norm)
+	}
+
+	for i := range next.Vec {
+		next.Vec[i] = c.Vec[i] + unit[i]/norm*force
+	}
+
+	next.Height = math.Max((c.Height+other.Height)*force/dist+c.Height, coordinateMinHeight)
+
+	return next
+}
+
+// coordinates keeps the local network coordinate and the coordinates of peers.
+type coordinates struct {
+	local Coordinate
+	peers map[string]Coordinate
+	mux   sync.Mutex
+}
+
+// newCoordinates creates a coordinates.
+func newCoordinates() *coordinates {
+	return &coordinates{
+		local: newCoordinate(),
+		peers: map[string]Coordinate{},
+	}
+}
+
+// get returns the local coordinate.
+func (c *coordinates) get() Coordinate {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.local
+}
+
+// set sets the coordinate announced by given peer.
+func (c *coordinates) set(addr, port string, coord *Coordinate) {
+	if coord == nil || !coord.valid() {
+		return
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.peers[fullHost(addr, port)] = *coord
+}
+
+// observe updates the local coordinate with the rtt of a request sent to given peer.
+func (c *coordinates) observe(addr, port string, rtt time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	other, ok := c.peers[fullHost(addr, port)]
+	if !ok || rtt <= 0 {
+		return
+	}
+
+	c.local = c.local.update(other, rtt.Seconds())
+}
+
+// localCoordinate returns the local coordinate, to be sent in gossip messages.
+func (b *BMMC) localCoordinate() *Coordinate {
+	c := b.coordinates.get()
+	return &c
+}
+
+// estimate returns the estimated round trip time to given peer.
+// Peers without coordinate have an estimate of 0, so they are measured soon.
+func (c *coordinates) estimate(p Peer) time.Duration {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	other, ok := c.peers[fullHost(p.Addr, p.Port)]
+	if !ok {
+		return 0
+	}
+
+	return time.Duration(c.local.distance(other) * float64(time.Second))
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"math"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Network coordinates", func() {
+	It("converge to the observed round trip times", func() {
+		// two clusters of nodes, 10ms apart, with 1ms inside each cluster
+		rtt := func(i, j int) float64 {
+			if i/2 == j/2 {
+				return 0.001
+			}
+
+			return 0.010
+		}
+
+		coords := make([]Coordinate, 4)
+		for i := range coords {
+			coords[i] = newCoordinate()
+		}
+
+		for round := 0; round < 1000; round++ {
+			for i := range coords {
+				for j := range coords {
+					if i != j {
+						coords[i] = coords[i].update(coords[j], rtt(i, j))
+					}
+				}
+			}
+		}
+
+		for i := range coords {
+			for j := range coords {
+				if i != j {
+					Expect(math.Abs(coords[i].distance(coords[j])-rtt(i, j)) / rtt(i, j)).To(BeNumerically("<", 0.5))
+				}
+			}
+		}
+	})
+
+	It("estimates the round trip time to peers with known coordinates", func() {
+		c := newCoordinates()
+		p := Peer{Addr: "localhost", Port: "10000"}
+
+		Expect(c.estimate(p)).To(Equal(time.Duration(0)))
+
+		remote := newCoordinate()
+		c.set(p.Addr, p.Port, &remote)
+
+		for i := 0; i < 100; i++ {
+			c.observe(p.Addr, p.Port, time.Millisecond*20)
+		}
+
+		Expect(c.estimate(p)).To(BeNumerically("~", time.Millisecond*20, time.Millisecond*5))
+	})
+
+	It("ignores invalid coordinates", func() {
+		c := newCoordinates()
+		c.set("localhost", "10000", &Coordinate{Vec: []float64{1}})
+		c.set("localhost", "10001", nil)
+
+		Expect(c.peers).To(BeEmpty())
+	})
+})
@@ -0,0 +1,79 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	anyOrigin = "*"
+
+	// corsMaxAge is the duration for which browsers cache the preflight responses
+	corsMaxAge = time.Hour
+)
+
+// allowedOrigin returns the value of Access-Control-Allow-Origin for a request
+// from given origin, or an empty string if the origin is not allowed.
+func (b *BMMC) allowedOrigin(origin string) string {
+	for _, o := range b.config.CORSOrigins {
+		if o == anyOrigin {
+			return anyOrigin
+		}
+
+		if o == origin {
+			return origin
+		}
+	}
+
+	return ""
+}
+
+// serveCORS sets the CORS headers for requests from browsers on the inspection
+// endpoints of the node, which are served with GET. It answers the preflight
+// requests and returns true if the request was answered.
+func (b *BMMC) serveCORS(w http.ResponseWriter, r *http.Request, rt route) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || rt.method != http.MethodGet {
+		return false
+	}
+
+	allowed := b.allowedOrigin(origin)
+	if allowed == "" {
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", allowed)
+	w.Header().Add("Vary", "Origin")
+
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", rt.method)
+	w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+
+	if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return true
+}
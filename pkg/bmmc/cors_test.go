@@ -0,0 +1,65 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CORS", func() {
+	DescribeTable("serves requests from browsers",
+		func(method, path, origin string, expectedStatus int, expectedOrigin, expectedMethods string) {
+			b, err := New(&Config{
+				Addr:        "localhost",
+				Port:        "1",
+				BufferSize:  16,
+				Logger:      log.New(ioutil.Discard, "", 0),
+				CORSOrigins: []string{"http://dashboard.local"},
+			})
+			Expect(err).To(Succeed())
+
+			req := httptest.NewRequest(method, "http://localhost:1"+path, nil)
+			req.Header.Set("Origin", origin)
+
+			if method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+
+			w := httptest.NewRecorder()
+			b.serveProtocol(w, req)
+
+			Expect(w.Code).To(Equal(expectedStatus))
+			Expect(w.Header().Get("Access-Control-Allow-Origin")).To(Equal(expectedOrigin))
+			Expect(w.Header().Get("Access-Control-Allow-Methods")).To(Equal(expectedMethods))
+		},
+		Entry("allows the configured origins", http.MethodGet, digestRoute, "http://dashboard.local",
+			http.StatusOK, "http://dashboard.local", ""),
+		Entry("answers the preflight requests", http.MethodOptions, digestRoute, "http://dashboard.local",
+			http.StatusNoContent, "http://dashboard.local", http.MethodGet),
+		Entry("doesn't allow other origins", http.MethodGet, digestRoute, "http://other.local",
+			http.StatusOK, "", ""),
+		Entry("doesn't allow the protocol exchanges", http.MethodOptions, gossipRoute, "http://dashboard.local",
+			http.StatusMethodNotAllowed, "", ""),
+	)
+})
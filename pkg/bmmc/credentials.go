@@ -0,0 +1,64 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+const (
+	// nodeHeader is the header with the addr:port of the node which sent a protocol request
+	nodeHeader = "X-BMMC-Node"
+	// tokenHeader is the header with the token of the node which sent a protocol request
+	tokenHeader = "X-BMMC-Token"
+)
+
+var errInvalidToken = errors.New("invalid node token")
+
+// tokenTransport attaches the node and its token to the protocol requests
+// sent by the node.
+type tokenTransport struct {
+	next  http.RoundTripper
+	node  string
+	token string
+}
+
+// RoundTrip attaches the node and its token to given request and sends it.
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Header.Set(nodeHeader, t.node)
+	r.Header.Set(tokenHeader, t.token)
+
+	return t.next.RoundTrip(r)
+}
+
+// verifyToken returns true if given request carries the token of the node
+// which sent it, or if the node has no peer tokens.
+func (b *BMMC) verifyToken(r *http.Request) bool {
+	if len(b.config.PeerTokens) == 0 {
+		return true
+	}
+
+	expected, ok := b.config.PeerTokens[r.Header.Get(nodeHeader)]
+	if !ok || expected == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(r.Header.Get(tokenHeader))) == 1
+}
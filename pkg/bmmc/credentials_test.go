@@ -0,0 +1,89 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Node tokens", func() {
+	var transport *MemoryTransport
+
+	tokens := map[string]string{
+		"localhost:1": "first token",
+		"localhost:2": "second token",
+	}
+
+	withToken := func(token string) func(*Config) {
+		return func(cfg *Config) {
+			cfg.NodeToken = token
+			cfg.PeerTokens = tokens
+		}
+	}
+
+	BeforeEach(func() {
+		transport = NewMemoryTransport()
+	})
+
+	It("rejects the requests without the token of their node", func() {
+		b := startTestNode("1", withTransport(transport), withToken("first token"))
+		defer b.Stop() // nolint: errcheck
+
+		send := func(rt http.RoundTripper) int {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost:1"+gossipRoute, strings.NewReader("{}"))
+			Expect(err).To(Succeed())
+
+			res, err := rt.RoundTrip(req)
+			Expect(err).To(Succeed())
+
+			return res.StatusCode
+		}
+
+		Expect(send(transport)).To(Equal(http.StatusUnauthorized))
+		Expect(send(&tokenTransport{next: transport, node: "localhost:2", token: "first token"})).
+			To(Equal(http.StatusUnauthorized))
+		Expect(send(&tokenTransport{next: transport, node: "localhost:3", token: "third token"})).
+			To(Equal(http.StatusUnauthorized))
+		Expect(send(&tokenTransport{next: transport, node: "localhost:2", token: "second token"})).
+			NotTo(Equal(http.StatusUnauthorized))
+	})
+
+	It("disseminates messages only between cluster members", func() {
+		first := startTestNode("1", withTransport(transport), withToken("first token"))
+		defer first.Stop() // nolint: errcheck
+
+		second := startTestNode("2", withTransport(transport), withToken("second token"))
+		defer second.Stop() // nolint: errcheck
+
+		other := startTestNode("3", withTransport(transport), withToken("third token"))
+		defer other.Stop() // nolint: errcheck
+
+		Expect(other.AddPeer("localhost", "1")).To(Succeed())
+		Expect(other.AddMessage("injected", NOCALLBACK)).To(Succeed())
+
+		Expect(first.AddPeer("localhost", "2")).To(Succeed())
+		Expect(first.AddMessage("a message", NOCALLBACK)).To(Succeed())
+
+		Eventually(second.GetMessages, time.Second*5).Should(ContainElement("a message"))
+		Consistently(first.GetMessages, time.Millisecond*200).ShouldNot(ContainElement("injected"))
+	})
+})
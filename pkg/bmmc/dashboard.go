@@ -0,0 +1,201 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	dashboardRoute       = "/dashboard"
+	dashboardStatusRoute = "/dashboard/status"
+
+	// recentDeliveriesSize is the number of recently delivered messages shown in dashboard
+	recentDeliveriesSize = 20
+
+	dashboardHandlerErrLogFmt = "Error in dashboard handler: %s"
+)
+
+// dashboardStatus is the state of the node shown in dashboard.
+type dashboardStatus struct {
+	Node             string    `json:"node"`
+	State            string    `json:"state"`
+	Round            int64     `json:"round"`
+	RoundsPerSecond  float64   `json:"rounds_per_second"`
+	Peers            []string  `json:"peers"`
+	Messages         []Message `json:"messages"`
+	RecentDeliveries []Message `json:"recent_deliveries"`
+	Stats            Stats     `json:"stats"`
+}
+
+// recentDeliveries keeps the last delivered messages.
+type recentDeliveries struct {
+	messages []Message
+	mux      sync.Mutex
+}
+
+// newRecentDeliveries creates an empty recentDeliveries.
+func newRecentDeliveries() *recentDeliveries {
+	return &recentDeliveries{}
+}
+
+// add adds given message, dropping the oldest one if there are too many messages.
+func (d *recentDeliveries) add(m Message) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.messages = append(d.messages, m)
+	if len(d.messages) > recentDeliveriesSize {
+		d.messages = d.messages[len(d.messages)-recentDeliveriesSize:]
+	}
+}
+
+// list returns the delivered messages, the most recent first.
+func (d *recentDeliveries) list() []Message {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	messages := make([]Message, len(d.messages))
+	for i, m := range d.messages {
+		messages[len(messages)-1-i] = m
+	}
+
+	return messages
+}
+
+// dashboardStatus returns the state of the node shown in dashboard.
+func (b *BMMC) dashboardStatus() dashboardStatus {
+	stats := b.Stats()
+
+	rate := 0.0
+	if uptime := time.Since(b.startTime()); !b.startTime().IsZero() && uptime > 0 {
+		rate = float64(stats.Rounds) / uptime.Seconds()
+	}
+
+	messages := []Message{}
+
+	for _, el := range b.messageBuffer.All() {
+		if el.IsMessage() {
+			messages = append(messages, b.newMessage(el))
+		}
+	}
+
+	return dashboardStatus{
+		Node:             fullHost(b.config.Addr, b.config.Port),
+		State:            b.State().String(),
+		Round:            b.gossipRound.GetNumber(),
+		RoundsPerSecond:  rate,
+		Peers:            b.GetPeers(),
+		Messages:         messages,
+		RecentDeliveries: b.recentDeliveries.list(),
+		Stats:            stats,
+	}
+}
+
+// dashboardHandler serves the web page of dashboard.
+func (b *BMMC) dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if !b.config.Dashboard {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if _, err := w.Write([]byte(dashboardPage)); err != nil {
+		b.logf(ServerComponent, ErrorLevel, dashboardHandlerErrLogFmt, err)
+	}
+}
+
+// dashboardStatusHandler serves the state of the node shown in dashboard.
+func (b *BMMC) dashboardStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if !b.config.Dashboard {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(b.dashboardStatus()); err != nil {
+		b.logf(ServerComponent, ErrorLevel, dashboardHandlerErrLogFmt, err)
+	}
+}
+
+// dashboardPage is the web page of dashboard. It polls the status of the node.
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>BMMC node</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+</style>
+</head>
+<body>
+<h1 id="node">BMMC node</h1>
+<p>State: <b id="state"></b>, round <b id="round"></b> (<span id="rate"></span> rounds/s),
+<span id="delivered"></span> messages delivered</p>
+<h2>Peers</h2>
+<table><tbody id="peers"></tbody></table>
+<h2>Recent deliveries</h2>
+<table><thead><tr><th>ID</th><th>Type</th><th>Payload</th></tr></thead><tbody id="deliveries"></tbody></table>
+<h2>Buffer</h2>
+<table><thead><tr><th>ID</th><th>Type</th><th>Payload</th></tr></thead><tbody id="messages"></tbody></table>
+<script>
+function cell(row, text) {
+  var td = document.createElement("td");
+  td.textContent = text;
+  row.appendChild(td);
+}
+
+function fill(id, items, columns) {
+  var body = document.getElementById(id);
+  body.innerHTML = "";
+  (items || []).forEach(function (item) {
+    var row = document.createElement("tr");
+    columns(item).forEach(function (text) { cell(row, text); });
+    body.appendChild(row);
+  });
+}
+
+function message(m) {
+  return [m.ID, m.CallbackType, JSON.stringify(m.Payload)];
+}
+
+function refresh() {
+  fetch("/dashboard/status").then(function (res) { return res.json(); }).then(function (s) {
+    document.getElementById("node").textContent = "BMMC node " + s.node;
+    document.getElementById("state").textContent = s.state;
+    document.getElementById("round").textContent = s.round;
+    document.getElementById("rate").textContent = s.rounds_per_second.toFixed(1);
+    document.getElementById("delivered").textContent = s.stats.MessagesDelivered;
+    fill("peers", s.peers, function (p) { return [p]; });
+    fill("deliveries", s.recent_deliveries, message);
+    fill("messages", s.messages, message);
+  });
+}
+
+refresh();
+setInterval(refresh, 1000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,94 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dashboard", func() {
+	var transport *MemoryTransport
+
+	get := func(path string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:1"+path, nil)
+		Expect(err).To(Succeed())
+
+		res, err := transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+
+		return res
+	}
+
+	BeforeEach(func() {
+		transport = NewMemoryTransport()
+	})
+
+	It("keeps the most recent deliveries first", func() {
+		d := newRecentDeliveries()
+		for i := 0; i < recentDeliveriesSize+5; i++ {
+			d.add(Message{ID: strconv.Itoa(i)})
+		}
+
+		messages := d.list()
+		Expect(messages).To(HaveLen(recentDeliveriesSize))
+		Expect(messages[0].ID).To(Equal(strconv.Itoa(recentDeliveriesSize + 4)))
+		Expect(messages[recentDeliveriesSize-1].ID).To(Equal("5"))
+	})
+
+	It("serves the state of the node", func() {
+		receiver := startTestNode("1", withTransport(transport), func(cfg *Config) {
+			cfg.Dashboard = true
+		})
+		defer receiver.Stop() // nolint: errcheck
+
+		sender := startTestNode("2", withTransport(transport))
+		defer sender.Stop() // nolint: errcheck
+
+		Expect(sender.AddPeer("localhost", "1")).To(Succeed())
+		Expect(sender.AddMessage("shown message", NOCALLBACK)).To(Succeed())
+
+		page := get(dashboardRoute)
+		Expect(page.StatusCode).To(Equal(http.StatusOK))
+		Expect(page.Header.Get("Content-Type")).To(ContainSubstring("text/html"))
+
+		Eventually(func() []interface{} {
+			var status dashboardStatus
+			Expect(json.NewDecoder(get(dashboardStatusRoute).Body).Decode(&status)).To(Succeed())
+
+			payloads := []interface{}{}
+			for _, m := range status.RecentDeliveries {
+				payloads = append(payloads, m.Payload)
+			}
+
+			return payloads
+		}, time.Second*5).Should(ContainElement("shown message"))
+	})
+
+	It("is not served by default", func() {
+		b := startTestNode("1", withTransport(transport))
+		defer b.Stop() // nolint: errcheck
+
+		Expect(get(dashboardRoute).StatusCode).To(Equal(http.StatusNotFound))
+		Expect(get(dashboardStatusRoute).StatusCode).To(Equal(http.StatusNotFound))
+	})
+})
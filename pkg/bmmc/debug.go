@@ -0,0 +1,191 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	debugPprofRoute = "/debug/pprof/"
+	debugVarsRoute  = "/debug/vars"
+
+	// expvarName is the name of the node stats in /debug/vars
+	expvarName = "bmmc"
+
+	debugHandlerErrLogFmt = "Error in debug handler: %s"
+
+	defaultCPUProfileDuration = time.Second * 30
+	defaultTraceDuration      = time.Second
+)
+
+// routePath returns the path of the route which serves given request path.
+// All the profiles are served by the pprof route.
+func routePath(path string) string {
+	if strings.HasPrefix(path, debugPprofRoute) {
+		return debugPprofRoute
+	}
+
+	return path
+}
+
+// debugHandler serves the debug endpoints with given handler, if Debug is
+// enabled. When the node has an AdminToken, the clients must present it.
+func (b *BMMC) debugHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !b.config.Debug {
+			http.NotFound(w, r)
+			return
+		}
+
+		if b.config.AdminToken != "" && !b.verifyAdminToken(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, errInvalidAdminToken.Error(), http.StatusUnauthorized)
+
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// pprofHandler serves the runtime profiles in the format of net/http/pprof,
+// which is not imported because it registers its handlers on the default mux.
+func (b *BMMC) pprofHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, debugPprofRoute)
+
+	var err error
+
+	switch name {
+	case "":
+		err = writeProfileIndex(w)
+	case "profile":
+		err = writeTimedProfile(w, r, defaultCPUProfileDuration, pprof.StartCPUProfile, pprof.StopCPUProfile)
+	case "trace":
+		err = writeTimedProfile(w, r, defaultTraceDuration, trace.Start, trace.Stop)
+	default:
+		err = writeProfile(w, r, name)
+	}
+
+	if err != nil {
+		b.logf(ServerComponent, ErrorLevel, debugHandlerErrLogFmt, err)
+	}
+}
+
+// writeProfileIndex writes the names of the profiles and their counts.
+func writeProfileIndex(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	for _, p := range pprof.Profiles() {
+		if _, err := fmt.Fprintf(w, "%s %d\n", p.Name(), p.Count()); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "profile\ntrace")
+
+	return err
+}
+
+// writeProfile writes the profile with given name. The debug parameter selects
+// the text format and the gc parameter runs a garbage collection first.
+func writeProfile(w http.ResponseWriter, r *http.Request, name string) error {
+	p := pprof.Lookup(name)
+	if p == nil {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	debug, _ := strconv.Atoi(r.URL.Query().Get("debug")) // nolint: errcheck
+
+	if gc, _ := strconv.Atoi(r.URL.Query().Get("gc")); gc > 0 { // nolint: errcheck
+		runtime.GC()
+	}
+
+	if debug > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+
+	return p.WriteTo(w, debug)
+}
+
+// writeTimedProfile runs a profile for the duration of the seconds parameter,
+// or for given duration, and writes it.
+func writeTimedProfile(w http.ResponseWriter, r *http.Request, duration time.Duration,
+	start func(io.Writer) error, stop func()) error {
+	if sec, err := strconv.ParseFloat(r.URL.Query().Get("seconds"), 64); err == nil && sec > 0 {
+		duration = time.Duration(sec * float64(time.Second))
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if err := start(w); err != nil {
+		// e.g. another profile is running
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+
+	select {
+	case <-time.After(duration):
+	case <-r.Context().Done():
+	}
+
+	stop()
+
+	return nil
+}
+
+// varsHandler serves the variables published with expvar, e.g. memstats, and
+// the stats of the node, in the format of expvar.Handler.
+func (b *BMMC) varsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	vars := map[string]json.RawMessage{}
+
+	expvar.Do(func(kv expvar.KeyValue) {
+		vars[kv.Key] = json.RawMessage(kv.Value.String())
+	})
+
+	// the stats of a node published by the application are not served twice
+	if _, ok := vars[expvarName]; !ok {
+		vars[expvarName] = json.RawMessage(b.Var().String())
+	}
+
+	if err := json.NewEncoder(w).Encode(vars); err != nil {
+		b.logf(ServerComponent, ErrorLevel, debugHandlerErrLogFmt, err)
+	}
+}
+
+// Var returns the stats of the node as an expvar variable, which can be
+// published by the application, e.g. expvar.Publish("bmmc", b.Var()).
+func (b *BMMC) Var() expvar.Var {
+	return expvar.Func(func() interface{} {
+		return b.Stats()
+	})
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Debug endpoints", func() {
+	var transport *MemoryTransport
+
+	withDebug := func(cfg *Config) {
+		cfg.Debug = true
+	}
+
+	get := func(path, auth string) (int, []byte) {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:1"+path, nil)
+		Expect(err).To(Succeed())
+
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+
+		res, err := transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+
+		defer res.Body.Close() // nolint: errcheck
+
+		body, err := ioutil.ReadAll(res.Body)
+		Expect(err).To(Succeed())
+
+		return res.StatusCode, body
+	}
+
+	BeforeEach(func() {
+		transport = NewMemoryTransport()
+	})
+
+	It("serves the runtime profiles", func() {
+		b := startTestNode("1", withTransport(transport), withDebug)
+		defer b.Stop() // nolint: errcheck
+
+		status, body := get(debugPprofRoute, "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(string(body)).To(ContainSubstring("goroutine "))
+		Expect(string(body)).To(ContainSubstring("heap "))
+
+		status, body = get(debugPprofRoute+"goroutine?debug=1", "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(string(body)).To(ContainSubstring("goroutine profile:"))
+
+		status, body = get(debugPprofRoute+"heap?gc=1", "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).NotTo(BeEmpty())
+
+		status, body = get(debugPprofRoute+"profile?seconds=0.1", "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).NotTo(BeEmpty())
+
+		status, _ = get(debugPprofRoute+"unknown", "")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+
+	It("serves the expvar variables with the stats of the node", func() {
+		b := startTestNode("1", withTransport(transport), withDebug)
+		defer b.Stop() // nolint: errcheck
+
+		Eventually(func() int64 { return b.Stats().RoundDurations.Count }, time.Second*5).
+			Should(BeNumerically(">", 0))
+
+		status, body := get(debugVarsRoute, "")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var vars map[string]json.RawMessage
+		Expect(json.Unmarshal(body, &vars)).To(Succeed())
+		Expect(vars).To(HaveKey("memstats"))
+		Expect(vars).To(HaveKey(expvarName))
+
+		var stats Stats
+		Expect(json.Unmarshal(vars[expvarName], &stats)).To(Succeed())
+		Expect(stats.Rounds).To(BeNumerically(">", 0))
+		Expect(stats.RoundDurations.Count).To(BeNumerically(">", 0))
+	})
+
+	It("doesn't serve the debug endpoints if they are disabled", func() {
+		b := startTestNode("1", withTransport(transport))
+		defer b.Stop() // nolint: errcheck
+
+		status, _ := get(debugPprofRoute, "")
+		Expect(status).To(Equal(http.StatusNotFound))
+
+		status, _ = get(debugVarsRoute, "")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+
+	It("requires the admin token, if it is set", func() {
+		b := startTestNode("1", withTransport(transport), withDebug, func(cfg *Config) {
+			cfg.AdminToken = "admin-secret"
+		})
+		defer b.Stop() // nolint: errcheck
+
+		status, _ := get(debugVarsRoute, "")
+		Expect(status).To(Equal(http.StatusUnauthorized))
+
+		status, _ = get(debugVarsRoute, "admin-secret")
+		Expect(status).To(Equal(http.StatusOK))
+	})
+})
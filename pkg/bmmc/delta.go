@@ -0,0 +1,119 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	mergeDeltaErrFmt  = "error at merging delta %s for %s state: %w"
+	updateStateErrFmt = "error at updating %s state: %w"
+)
+
+var (
+	errInexistentDeltaState = errors.New("delta state doesn't exist for given callback type")
+)
+
+// DeltaState replicates a state object by disseminating only its deltas.
+// Deltas can be delivered in any order, so Merge should be commutative.
+type DeltaState interface {
+	// Delta returns the delta from prev state to curr state.
+	// The prev state is nil for the first update.
+	Delta(prev, curr interface{}) (interface{}, error)
+	// Merge merges given delta in given state and returns the new state.
+	// The state is nil for the first delta.
+	Merge(state, delta interface{}) (interface{}, error)
+}
+
+// deltaStates keeps the replicated states, by callback type.
+type deltaStates struct {
+	producers map[string]DeltaState
+	states    map[string]interface{}
+	mux       sync.Mutex
+}
+
+// newDeltaStates creates the delta states for given producers.
+func newDeltaStates(producers map[string]DeltaState) *deltaStates {
+	return &deltaStates{
+		producers: producers,
+		states:    map[string]interface{}{},
+	}
+}
+
+// delta returns the delta from current state of given type to given state.
+func (d *deltaStates) delta(cbType string, state interface{}) (interface{}, error) {
+	p, ok := d.producers[cbType]
+	if !ok {
+		return nil, errInexistentDeltaState
+	}
+
+	d.mux.Lock()
+	prev := d.states[cbType]
+	d.mux.Unlock()
+
+	return p.Delta(prev, state)
+}
+
+// merge merges the delta from given element in state of its type.
+// Elements of other types are ignored.
+func (d *deltaStates) merge(m buffer.Element) error {
+	p, ok := d.producers[m.CallbackType]
+	if !ok {
+		return nil
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	state, err := p.Merge(d.states[m.CallbackType], m.Msg)
+	if err != nil {
+		return fmt.Errorf(mergeDeltaErrFmt, m.ID, m.CallbackType, err)
+	}
+
+	d.states[m.CallbackType] = state
+
+	return nil
+}
+
+// get returns the state of given type.
+func (d *deltaStates) get(cbType string) interface{} {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	return d.states[cbType]
+}
+
+// UpdateState disseminates the delta from the current state of given type
+// to given state. The callback type must have a DeltaState in config.
+func (b *BMMC) UpdateState(cbType string, state interface{}) error {
+	delta, err := b.deltaStates.delta(cbType, state)
+	if err != nil {
+		return fmt.Errorf(updateStateErrFmt, cbType, err)
+	}
+
+	return b.AddMessage(delta, cbType)
+}
+
+// GetState returns the state of given type, merged from all delivered deltas.
+func (b *BMMC) GetState(cbType string) interface{} {
+	return b.deltaStates.get(cbType)
+}
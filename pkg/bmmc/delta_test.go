@@ -0,0 +1,72 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+// counterState is a counter replicated by increments.
+type counterState struct{}
+
+func (counterState) Delta(prev, curr interface{}) (interface{}, error) {
+	if prev == nil {
+		return curr, nil
+	}
+
+	return curr.(float64) - prev.(float64), nil
+}
+
+func (counterState) Merge(state, delta interface{}) (interface{}, error) {
+	if state == nil {
+		return delta, nil
+	}
+
+	return state.(float64) + delta.(float64), nil
+}
+
+var _ = Describe("Delta states", func() {
+	var d *deltaStates
+
+	BeforeEach(func() {
+		d = newDeltaStates(map[string]DeltaState{"counter": counterState{}})
+	})
+
+	It("merges deltas in the state of their type", func() {
+		Expect(d.merge(buffer.Element{CallbackType: "counter", Msg: 5.0})).To(Succeed())
+		Expect(d.merge(buffer.Element{CallbackType: "counter", Msg: 3.0})).To(Succeed())
+		Expect(d.get("counter")).To(Equal(8.0))
+	})
+
+	It("ignores elements without delta state", func() {
+		Expect(d.merge(buffer.Element{CallbackType: "another-type", Msg: 5.0})).To(Succeed())
+		Expect(d.get("another-type")).To(BeNil())
+	})
+
+	It("returns the delta from the current state", func() {
+		Expect(d.merge(buffer.Element{CallbackType: "counter", Msg: 5.0})).To(Succeed())
+		Expect(d.delta("counter", 12.0)).To(Equal(7.0))
+	})
+
+	It("returns error when the type doesn't have a delta state", func() {
+		_, err := d.delta("another-type", 12.0)
+		Expect(err).To(MatchError(errInexistentDeltaState))
+	})
+})
@@ -0,0 +1,294 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+const (
+	discoveryFileErrFmt    = "invalid peer %q in %s: %w"
+	discoveryLogErrFmt     = "BMMC %s:%s could not discover peers: %s"
+	discoveredPeerLogFmt   = "BMMC %s:%s discovered peer %s"
+	undiscoveredPeerLogFmt = "BMMC %s:%s removed peer %s, which is not discovered anymore"
+)
+
+// Discoverer discovers the peers through which the node joins the cluster.
+type Discoverer interface {
+	// Discover returns the discovered peers.
+	Discover(ctx context.Context) ([]Peer, error)
+}
+
+// DiscoveryWatcher is a Discoverer which notifies when the discovered peers
+// may have changed, e.g. from the watch of a service registry, so they are
+// discovered again without waiting for DiscoveryInterval, which must be set.
+type DiscoveryWatcher interface {
+	Discoverer
+	// Watch returns a channel which receives a value each time the peers may
+	// have changed, until ctx is done or the channel is closed.
+	Watch(ctx context.Context) <-chan struct{}
+}
+
+// DiscovererFunc is a func which implements Discoverer.
+type DiscovererFunc func(ctx context.Context) ([]Peer, error)
+
+// Discover calls the func.
+func (f DiscovererFunc) Discover(ctx context.Context) ([]Peer, error) {
+	return f(ctx)
+}
+
+// EC2API lists EC2 instances. It is usually implemented with the AWS SDK.
+type EC2API interface {
+	// InstanceAddrsByTag returns the private addresses of the running instances
+	// which have given tag.
+	InstanceAddrsByTag(ctx context.Context, key, value string) ([]string, error)
+}
+
+// GCEAPI lists GCE instances. It is usually implemented with the GCP client libraries.
+type GCEAPI interface {
+	// InstanceGroupAddrs returns the internal addresses of the instances from
+	// given instance group.
+	InstanceGroupAddrs(ctx context.Context, project, zone, group string) ([]string, error)
+}
+
+// NewEC2Discoverer creates a Discoverer which discovers the EC2 instances with
+// given tag. All the instances listen on given port.
+func NewEC2Discoverer(api EC2API, tagKey, tagValue, port string) Discoverer {
+	return DiscovererFunc(func(ctx context.Context) ([]Peer, error) {
+		addrs, err := api.InstanceAddrsByTag(ctx, tagKey, tagValue)
+		if err != nil {
+			return nil, err
+		}
+
+		return peersOnPort(addrs, port), nil
+	})
+}
+
+// NewGCEDiscoverer creates a Discoverer which discovers the instances from given
+// GCE instance group. All the instances listen on given port.
+func NewGCEDiscoverer(api GCEAPI, project, zone, group, port string) Discoverer {
+	return DiscovererFunc(func(ctx context.Context) ([]Peer, error) {
+		addrs, err := api.InstanceGroupAddrs(ctx, project, zone, group)
+		if err != nil {
+			return nil, err
+		}
+
+		return peersOnPort(addrs, port), nil
+	})
+}
+
+// peersOnPort returns a peer for each given address, on given port.
+func peersOnPort(addrs []string, port string) []Peer {
+	peers := make([]Peer, len(addrs))
+	for i, addr := range addrs {
+		peers[i] = Peer{
+			Addr: addr,
+			Port: port,
+		}
+	}
+
+	return peers
+}
+
+// NewDNSDiscoverer creates a Discoverer which resolves the addresses of given
+// host name (A and AAAA records, e.g. a Kubernetes headless service). All the
+// addresses listen on given port.
+func NewDNSDiscoverer(name, port string) Discoverer {
+	return DiscovererFunc(func(ctx context.Context) ([]Peer, error) {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		return peersOnPort(addrs, port), nil
+	})
+}
+
+// NewSRVDiscoverer creates a Discoverer which resolves the addresses and the
+// ports of peers from given SRV record name (e.g. a Consul service).
+func NewSRVDiscoverer(name string) Discoverer {
+	return DiscovererFunc(func(ctx context.Context) ([]Peer, error) {
+		addrs, err := lookupSRV(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		return srvPeers(addrs), nil
+	})
+}
+
+// NewFileDiscoverer creates a Discoverer which reads the peers from given file,
+// at each discovery. The file has a host:port peer on each line; empty lines
+// and lines starting with # are skipped.
+func NewFileDiscoverer(path string) Discoverer {
+	return DiscovererFunc(func(ctx context.Context) ([]Peer, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close() // nolint: errcheck
+
+		peers := []Peer{}
+		scanner := bufio.NewScanner(f)
+
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			addr, port, err := net.SplitHostPort(line)
+			if err != nil {
+				return nil, fmt.Errorf(discoveryFileErrFmt, line, path, err)
+			}
+
+			peers = append(peers, Peer{Addr: addr, Port: port})
+		}
+
+		return peers, scanner.Err()
+	})
+}
+
+// discover returns the peers found by all Discoverers, by host.
+func (b *BMMC) discover(ctx context.Context) (map[string]Peer, error) {
+	found := map[string]Peer{}
+
+	for _, d := range b.config.Discoverers {
+		peers, err := d.Discover(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range peers {
+			if p.Addr != b.config.Addr || p.Port != b.config.Port {
+				found[fullHost(p.Addr, p.Port)] = p
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// syncDiscoveredPeers adds the peers found by Discoverers in peers buffer and
+// removes the peers discovered before which are not found anymore. The peers
+// which were added otherwise are kept. It returns the discovered peers. When a
+// discovery fails, the peers buffer is not changed.
+func (b *BMMC) syncDiscoveredPeers(ctx context.Context, previous map[string]Peer) map[string]Peer {
+	found, err := b.discover(ctx)
+	if err != nil {
+		b.logf(MembershipComponent, WarnLevel, discoveryLogErrFmt, b.config.Addr, b.config.Port, err)
+		return previous
+	}
+
+	for host, dp := range found {
+		if _, ok := previous[host]; ok || b.bans.isBanned(dp.Addr, dp.Port) {
+			continue
+		}
+
+		p, err := peer.NewPeer(dp.Addr, dp.Port)
+		if err != nil {
+			continue
+		}
+
+		// peers which are already known are kept
+		if b.peerBuffer.AddPeer(p) == nil {
+			b.logf(MembershipComponent, InfoLevel, discoveredPeerLogFmt, b.config.Addr, b.config.Port, host)
+		}
+	}
+
+	for host, dp := range previous {
+		if _, ok := found[host]; ok {
+			continue
+		}
+
+		p, err := peer.NewPeer(dp.Addr, dp.Port)
+		if err != nil {
+			continue
+		}
+
+		b.forgetPeer(p)
+		b.logf(MembershipComponent, InfoLevel, undiscoveredPeerLogFmt, b.config.Addr, b.config.Port, host)
+	}
+
+	b.balanceViews()
+
+	return found
+}
+
+// watchDiscoverers returns a channel which receives a value each time one of
+// the Discoverers which are DiscoveryWatchers notifies a change, until ctx is
+// done. The notifications received while a discovery runs are coalesced.
+func (b *BMMC) watchDiscoverers(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	for _, d := range b.config.Discoverers {
+		w, ok := d.(DiscoveryWatcher)
+		if !ok {
+			continue
+		}
+
+		go func(watch <-chan struct{}) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case _, ok := <-watch:
+					if !ok {
+						return
+					}
+				}
+
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}(w.Watch(ctx))
+	}
+
+	return changes
+}
+
+// refreshPeers keeps the peers buffer in sync with Discoverers, every
+// DiscoveryInterval and each time a DiscoveryWatcher notifies a change, until
+// the protocol is stopped.
+func (b *BMMC) refreshPeers(ctx context.Context) {
+	ticker := time.NewTicker(b.config.DiscoveryInterval)
+	defer ticker.Stop()
+
+	changes := b.watchDiscoverers(ctx)
+	discovered := b.syncDiscoveredPeers(ctx, map[string]Peer{})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changes:
+		}
+
+		discovered = b.syncDiscoveredPeers(ctx, discovered)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeEC2 struct {
+	addrs map[string][]string
+	err   error
+}
+
+func (f *fakeEC2) InstanceAddrsByTag(_ context.Context, key, value string) ([]string, error) {
+	return f.addrs[key+"="+value], f.err
+}
+
+type fakeGCE struct {
+	addrs []string
+}
+
+func (f *fakeGCE) InstanceGroupAddrs(_ context.Context, project, zone, group string) ([]string, error) {
+	if project != "project" || zone != "zone" || group != "group" {
+		return nil, nil
+	}
+
+	return f.addrs, nil
+}
+
+type fakeWatcher struct {
+	peers   []Peer
+	changes chan struct{}
+	mux     sync.Mutex
+}
+
+func (f *fakeWatcher) Discover(context.Context) ([]Peer, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	return f.peers, nil
+}
+
+func (f *fakeWatcher) Watch(context.Context) <-chan struct{} {
+	return f.changes
+}
+
+func (f *fakeWatcher) set(peers []Peer) {
+	f.mux.Lock()
+	f.peers = peers
+	f.mux.Unlock()
+
+	f.changes <- struct{}{}
+}
+
+var _ = Describe("Discovery", func() {
+	It("discovers EC2 instances by tag", func() {
+		d := NewEC2Discoverer(&fakeEC2{
+			addrs: map[string][]string{"cluster=bmmc": {"10.0.0.1", "10.0.0.2"}},
+		}, "cluster", "bmmc", "14999")
+
+		peers, err := d.Discover(context.Background())
+		Expect(err).To(Succeed())
+		Expect(peers).To(Equal([]Peer{
+			{Addr: "10.0.0.1", Port: "14999"},
+			{Addr: "10.0.0.2", Port: "14999"},
+		}))
+	})
+
+	It("returns the errors of EC2 API", func() {
+		d := NewEC2Discoverer(&fakeEC2{err: errors.New("unauthorized")}, "cluster", "bmmc", "14999")
+
+		_, err := d.Discover(context.Background())
+		Expect(err).To(MatchError("unauthorized"))
+	})
+
+	It("discovers GCE instances from instance group", func() {
+		d := NewGCEDiscoverer(&fakeGCE{addrs: []string{"10.0.0.1"}}, "project", "zone", "group", "14999")
+
+		peers, err := d.Discover(context.Background())
+		Expect(err).To(Succeed())
+		Expect(peers).To(Equal([]Peer{{Addr: "10.0.0.1", Port: "14999"}}))
+	})
+
+	It("adds the discovered peers to the resolved seeds", func() {
+		b := &BMMC{config: &Config{
+			Discoverers: []Discoverer{
+				DiscovererFunc(func(context.Context) ([]Peer, error) {
+					return []Peer{{Addr: "10.0.0.1", Port: "14999"}}, nil
+				}),
+			},
+		}}
+
+		seeds, err := b.resolveSeeds(context.Background())
+		Expect(err).To(Succeed())
+		Expect(seeds).To(Equal([]Peer{{Addr: "10.0.0.1", Port: "14999"}}))
+	})
+
+	It("discovers the addresses of a DNS name", func() {
+		peers, err := NewDNSDiscoverer("localhost", "14999").Discover(context.Background())
+		Expect(err).To(Succeed())
+		Expect(peers).NotTo(BeEmpty())
+		Expect(peers[0].Port).To(Equal("14999"))
+	})
+
+	It("reads the peers from a static file", func() {
+		dir, err := ioutil.TempDir("", "bmmc")
+		Expect(err).To(Succeed())
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		path := filepath.Join(dir, "peers")
+		Expect(ioutil.WriteFile(path, []byte("# seeds\n10.0.0.1:14999\n\n[::1]:15000\n"), 0600)).To(Succeed())
+
+		peers, err := NewFileDiscoverer(path).Discover(context.Background())
+		Expect(err).To(Succeed())
+		Expect(peers).To(Equal([]Peer{
+			{Addr: "10.0.0.1", Port: "14999"},
+			{Addr: "::1", Port: "15000"},
+		}))
+
+		Expect(ioutil.WriteFile(path, []byte("invalid\n"), 0600)).To(Succeed())
+
+		_, err = NewFileDiscoverer(path).Discover(context.Background())
+		Expect(err).NotTo(Succeed())
+	})
+
+	It("keeps the peers buffer in sync with the discovered peers", func() {
+		found := []Peer{{Addr: "localhost", Port: "2"}, {Addr: "localhost", Port: "3"}}
+
+		b, err := New(&Config{
+			Addr:          "localhost",
+			Port:          "1",
+			BufferSize:    16,
+			RoundDuration: time.Millisecond * 20,
+			Transport:     NewMemoryTransport(),
+			Logger:        log.New(ioutil.Discard, "", 0),
+			Discoverers: []Discoverer{
+				DiscovererFunc(func(context.Context) ([]Peer, error) {
+					return found, nil
+				}),
+			},
+		})
+		Expect(err).To(Succeed())
+		Expect(b.AddPeer("localhost", "4")).To(Succeed())
+
+		discovered := b.syncDiscoveredPeers(context.Background(), map[string]Peer{})
+		Expect(b.GetPeers()).To(ConsistOf("localhost/2", "localhost/3", "localhost/4"))
+
+		// the peers added otherwise are kept
+		found = []Peer{{Addr: "localhost", Port: "3"}}
+		b.syncDiscoveredPeers(context.Background(), discovered)
+		Expect(b.GetPeers()).To(ConsistOf("localhost/3", "localhost/4"))
+	})
+
+	It("discovers the peers again when a watcher notifies a change", func() {
+		w := &fakeWatcher{
+			peers:   []Peer{{Addr: "localhost", Port: "2"}},
+			changes: make(chan struct{}),
+		}
+
+		b, err := New(&Config{
+			Addr:              "localhost",
+			Port:              "1",
+			BufferSize:        16,
+			RoundDuration:     time.Millisecond * 20,
+			Transport:         NewMemoryTransport(),
+			Logger:            log.New(ioutil.Discard, "", 0),
+			Discoverers:       []Discoverer{w},
+			DiscoveryInterval: time.Hour,
+		})
+		Expect(err).To(Succeed())
+
+		Expect(b.Start()).To(Succeed())
+		defer b.Stop() // nolint: errcheck
+
+		Eventually(b.GetPeers, time.Second*5).Should(ContainElement("localhost/2"))
+
+		w.set([]Peer{{Addr: "localhost", Port: "3"}})
+
+		Eventually(b.GetPeers, time.Second*5).Should(ContainElement("localhost/3"))
+		Eventually(b.GetPeers, time.Second*5).ShouldNot(ContainElement("localhost/2"))
+	})
+})
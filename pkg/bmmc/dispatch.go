@@ -0,0 +1,198 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	retryCallbackLogErrFmt   = "BMMC %s:%s retries callback for message %s in %s: %s"
+	droppedCallbackLogErrFmt = "BMMC %s:%s dropped callback for message %s, because the node is stopped"
+
+	defaultCallbackQueueSize = 1024
+	defaultCallbackBackoff   = time.Millisecond * 100
+
+	// maxCallbackBackoff is the maximum duration between the retries of a callback
+	maxCallbackBackoff = time.Second * 10
+)
+
+var (
+	errCallbackTimeout = errors.New("callback timed out")
+)
+
+// CallbackPolicy configures how the callbacks of the application run: the
+// messages callbacks, the typed callbacks and the custom callbacks. The
+// callbacks of the protocol, e.g. for peers and key rotations, always run in
+// the synchronization handler.
+type CallbackPolicy struct {
+	// Workers is the number of goroutines which run the callbacks. With
+	// workers, the callbacks are queued and the synchronization handler
+	// doesn't wait for them
+	// Optional (default: the callbacks run in the synchronization handler)
+	Workers int
+	// QueueSize is the number of callbacks queued for the workers. When the
+	// queue is full, the synchronization handler waits for room in it
+	// Optional (default: 1024)
+	QueueSize int
+	// Timeout is the maximum duration of a callback, after which it fails.
+	// The callbacks which timed out keep running in background, so they may
+	// run at the same time as their retries
+	// Optional (default: no timeout)
+	Timeout time.Duration
+	// Retries is the number of times a failed callback is run again
+	// Optional (default: 0)
+	Retries int
+	// Backoff is the duration before the first retry of a callback, doubled
+	// after each retry
+	// Optional (default: 100ms)
+	Backoff time.Duration
+	// DeadLetter receives the messages whose callback failed after all
+	// retries, with the last error
+	// Optional (default: the failures are only logged)
+	DeadLetter func(Message, error)
+}
+
+// callbackJob is a callback of a message, run by the dispatcher.
+type callbackJob struct {
+	m        buffer.Element
+	hostAddr string
+	hostPort string
+	run      func(ctx context.Context) error
+}
+
+// dispatchCallback runs given callback of m, by the workers if there are any.
+func (b *BMMC) dispatchCallback(m buffer.Element, hostAddr, hostPort string, run func(ctx context.Context) error) {
+	job := callbackJob{
+		m:        m,
+		hostAddr: hostAddr,
+		hostPort: hostPort,
+		run:      run,
+	}
+
+	if b.callbackJobs == nil {
+		b.runCallbackJob(b.runContext(), job)
+		return
+	}
+
+	select {
+	case b.callbackJobs <- job:
+	case <-b.runContext().Done():
+		b.logf(CallbackComponent, WarnLevel, droppedCallbackLogErrFmt, hostAddr, hostPort, m.ID)
+	}
+}
+
+// startCallbackWorkers starts the workers of CallbackPolicy, until ctx is done.
+func (b *BMMC) startCallbackWorkers(ctx context.Context) {
+	for i := 0; i < b.config.CallbackPolicy.Workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-b.callbackJobs:
+					b.runCallbackJob(ctx, job)
+				}
+			}
+		}()
+	}
+}
+
+// runCallbackJob runs given callback, retrying it with backoff while it fails.
+// The callbacks which fail after all retries are sent to the DeadLetter hook.
+func (b *BMMC) runCallbackJob(ctx context.Context, job callbackJob) {
+	policy := b.config.CallbackPolicy
+	backoff := policy.Backoff
+
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		if err = b.callWithTimeout(ctx, job.run); err == nil {
+			atomic.AddInt64(&b.counters.callbackSuccesses, 1)
+			return
+		}
+
+		if attempt >= policy.Retries {
+			break
+		}
+
+		atomic.AddInt64(&b.counters.callbackRetries, 1)
+		b.logf(CallbackComponent, WarnLevel, retryCallbackLogErrFmt, job.hostAddr, job.hostPort, job.m.ID, backoff, err)
+
+		if err = sleepContext(ctx, backoff); err != nil {
+			break
+		}
+
+		backoff *= 2
+		if backoff > maxCallbackBackoff {
+			backoff = maxCallbackBackoff
+		}
+	}
+
+	atomic.AddInt64(&b.counters.callbackFailures, 1)
+	b.logf(CallbackComponent, ErrorLevel, runCustomCallbackErrFmt, job.hostAddr, job.hostPort, job.m.ID, b.gossipRound.GetNumber())
+
+	if policy.DeadLetter != nil {
+		policy.DeadLetter(b.newMessage(job.m), err)
+	}
+}
+
+// callWithTimeout runs given callback, failing with errCallbackTimeout if it
+// doesn't return in the Timeout of CallbackPolicy. The context of the
+// callback is canceled when it times out.
+func (b *BMMC) callWithTimeout(ctx context.Context, run func(ctx context.Context) error) error {
+	if b.config.CallbackPolicy.Timeout == 0 {
+		return run(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.config.CallbackPolicy.Timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- run(ctx)
+	}()
+
+	timer := time.NewTimer(b.config.CallbackPolicy.Timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errCallbackTimeout
+	}
+}
+
+// sleepContext waits for given duration or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
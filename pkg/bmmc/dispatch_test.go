@@ -0,0 +1,134 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Callback dispatcher", func() {
+	var errFailed = errors.New("failed")
+
+	newNode := func(policy CallbackPolicy, cb func(Message, *log.Logger) error) *BMMC {
+		b, err := New(&Config{
+			Addr:             "localhost",
+			Port:             "1",
+			BufferSize:       16,
+			RoundDuration:    time.Millisecond * 20,
+			MessageCallbacks: map[string]func(Message, *log.Logger) error{"cb": cb},
+			CallbackPolicy:   policy,
+			Transport:        NewMemoryTransport(),
+			Logger:           log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+
+		return b
+	}
+
+	element := buffer.Element{
+		ID:           "id",
+		Timestamp:    time.Now(),
+		Msg:          "msg",
+		CallbackType: "cb",
+	}
+
+	It("retries the failed callbacks", func() {
+		var calls int64
+
+		b := newNode(CallbackPolicy{Retries: 2, Backoff: time.Millisecond}, func(Message, *log.Logger) error {
+			if atomic.AddInt64(&calls, 1) < 3 {
+				return errFailed
+			}
+
+			return nil
+		})
+
+		b.runCallbacks(element, "localhost", "2")
+
+		Expect(atomic.LoadInt64(&calls)).To(Equal(int64(3)))
+		Expect(b.Stats().CallbackRetries).To(Equal(int64(2)))
+		Expect(b.Stats().CallbackSuccesses).To(Equal(int64(1)))
+		Expect(b.Stats().CallbackFailures).To(BeZero())
+	})
+
+	It("sends the messages whose callback permanently fails to the dead letter hook", func() {
+		var dead []error
+
+		b := newNode(CallbackPolicy{
+			Retries: 1,
+			Backoff: time.Millisecond,
+			DeadLetter: func(m Message, err error) {
+				Expect(m.ID).To(Equal("id"))
+				dead = append(dead, err)
+			},
+		}, func(Message, *log.Logger) error {
+			return errFailed
+		})
+
+		b.runCallbacks(element, "localhost", "2")
+
+		Expect(dead).To(ConsistOf(errFailed))
+		Expect(b.Stats().CallbackFailures).To(Equal(int64(1)))
+	})
+
+	It("fails the callbacks which time out", func() {
+		dead := make(chan error, 1)
+
+		b := newNode(CallbackPolicy{
+			Timeout:    time.Millisecond * 10,
+			DeadLetter: func(m Message, err error) { dead <- err },
+		}, func(Message, *log.Logger) error {
+			time.Sleep(time.Second)
+			return nil
+		})
+
+		b.runCallbacks(element, "localhost", "2")
+
+		Expect(<-dead).To(MatchError(errCallbackTimeout))
+	})
+
+	It("runs the callbacks in workers, without blocking the synchronization", func() {
+		release := make(chan struct{})
+
+		var calls int64
+
+		b := newNode(CallbackPolicy{Workers: 1}, func(Message, *log.Logger) error {
+			<-release
+			atomic.AddInt64(&calls, 1)
+
+			return nil
+		})
+		Expect(b.Start()).To(Succeed())
+
+		defer b.Stop() // nolint: errcheck
+
+		b.runCallbacks(element, "localhost", "2")
+		Expect(atomic.LoadInt64(&calls)).To(BeZero())
+
+		close(release)
+		Eventually(func() int64 { return atomic.LoadInt64(&calls) }).Should(Equal(int64(1)))
+	})
+})
@@ -0,0 +1,168 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	encodingGzip    = "gzip"
+
+	unsupportedEncodingErrFmt = "unsupported content encoding %s"
+)
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// gzipWriters reuses the gzip writers, since each of them allocates large
+// compression tables.
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// newRequest creates a request which posts the body written by write to given
+// peer. The body is encoded with the best format negotiated with the peer,
+// and it is streamed while the request is sent.
+func (b *BMMC) newRequest(ctx context.Context, url, addr, port string,
+	write func(io.Writer) error) (*http.Request, error) {
+	return b.newSizedRequest(ctx, url, addr, port, -1, write)
+}
+
+// newSizedRequest creates a request as newRequest, given the approximate size
+// of the body. Bodies smaller than CompressionThreshold are not compressed.
+// A negative size means that the size is unknown.
+func (b *BMMC) newSizedRequest(ctx context.Context, url, addr, port string, size int,
+	write func(io.Writer) error) (*http.Request, error) {
+	proto := b.peerProtocols.get(addr, port)
+	pr, pw := io.Pipe()
+
+	compress := proto.has(capCompressionGzip) && (size < 0 || size >= b.config.CompressionThreshold)
+
+	go func() {
+		var w io.WriteCloser = nopWriteCloser{pw}
+		if compress {
+			gw := gzipWriters.Get().(*gzip.Writer)
+			gw.Reset(pw)
+
+			defer gzipWriters.Put(gw)
+
+			w = gw
+		}
+
+		if err := write(w); err != nil {
+			pw.CloseWithError(err) // nolint: errcheck
+			return
+		}
+
+		pw.CloseWithError(w.Close()) // nolint: errcheck
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, pr)
+	if err != nil {
+		pr.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	if compress {
+		req.Header.Set("Content-Encoding", encodingGzip)
+	}
+
+	b.injectTrace(ctx, req)
+
+	return req, nil
+}
+
+// decodeBody replaces the body of given request with its decoded content,
+// limited to given number of bytes, so small compressed bodies can't expand
+// without bound.
+func decodeBody(w http.ResponseWriter, r *http.Request, limit int64) error {
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "":
+		return nil
+	case encodingGzip:
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return err
+		}
+
+		r.Body = newLimitedBody(w, gr, limit)
+
+		return nil
+	default:
+		return fmt.Errorf(unsupportedEncodingErrFmt, encoding) // nolint: goerr113
+	}
+}
+
+// limitedBody is a request body limited by http.MaxBytesReader, which fails
+// with errBodyTooLarge after the limit.
+type limitedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+// newLimitedBody limits given body to n bytes. The connection of the requests
+// whose body exceeds the limit is closed after the response.
+func newLimitedBody(w http.ResponseWriter, body io.ReadCloser, n int64) io.ReadCloser {
+	return &limitedBody{
+		ReadCloser: http.MaxBytesReader(w, body, n),
+		left:       n,
+	}
+}
+
+// Read reads from the body, failing with errBodyTooLarge after the limit.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+
+	// the error of http.MaxBytesReader is not exported before Go 1.19
+	if err != nil && err != io.EOF && b.left <= 0 {
+		err = errBodyTooLarge
+	}
+
+	return n, err
+}
+
+// bodyErrStatus returns the status of the response to a request whose body
+// can't be decoded because of given error.
+func bodyErrStatus(err error) int {
+	if errors.Is(err, errBodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusBadRequest
+}
+
+// nopWriteCloser is a writer with a Close method which does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopWriteCloser) Close() error {
+	return nil
+}
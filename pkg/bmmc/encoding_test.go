@@ -0,0 +1,131 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encoding", func() {
+	var b *BMMC
+
+	write := func(w io.Writer) error {
+		_, err := io.WriteString(w, `{"addr":"localhost"}`)
+		return err
+	}
+
+	// readBody decodes the body of given request, as the server does
+	readBody := func(req *http.Request) string {
+		Expect(decodeBody(httptest.NewRecorder(), req, 1024)).To(Succeed())
+
+		raw, err := ioutil.ReadAll(req.Body)
+		Expect(err).To(Succeed())
+
+		return string(raw)
+	}
+
+	BeforeEach(func() {
+		b = &BMMC{config: &Config{}, peerProtocols: newPeerProtocols()}
+	})
+
+	It("sends plain bodies to legacy peers", func() {
+		req, err := b.newRequest(context.Background(), "http://localhost:10000", "localhost", "10000", write)
+		Expect(err).To(Succeed())
+
+		Expect(req.Header.Get("Content-Encoding")).To(BeEmpty())
+		Expect(readBody(req)).To(Equal(`{"addr":"localhost"}`))
+	})
+
+	It("sends compressed bodies to peers which accept them", func() {
+		b.peerProtocols.set("localhost", "10000", ProtocolVersion, localCapabilities)
+
+		req, err := b.newRequest(context.Background(), "http://localhost:10000", "localhost", "10000", write)
+		Expect(err).To(Succeed())
+
+		Expect(req.Header.Get("Content-Encoding")).To(Equal(encodingGzip))
+		Expect(readBody(req)).To(Equal(`{"addr":"localhost"}`))
+	})
+
+	It("sends plain bodies smaller than compression threshold", func() {
+		b.config.CompressionThreshold = 1024
+		b.peerProtocols.set("localhost", "10000", ProtocolVersion, localCapabilities)
+
+		req, err := b.newSizedRequest(context.Background(), "http://localhost:10000", "localhost", "10000", 20, write)
+		Expect(err).To(Succeed())
+
+		Expect(req.Header.Get("Content-Encoding")).To(BeEmpty())
+		Expect(readBody(req)).To(Equal(`{"addr":"localhost"}`))
+
+		req, err = b.newSizedRequest(context.Background(), "http://localhost:10000", "localhost", "10000", 2048, write)
+		Expect(err).To(Succeed())
+
+		Expect(req.Header.Get("Content-Encoding")).To(Equal(encodingGzip))
+		Expect(readBody(req)).To(Equal(`{"addr":"localhost"}`))
+	})
+
+	It("returns error for unsupported encodings", func() {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:10000", strings.NewReader("{}"))
+		Expect(err).To(Succeed())
+		req.Header.Set("Content-Encoding", "br")
+
+		Expect(decodeBody(httptest.NewRecorder(), req, 1024)).NotTo(Succeed())
+	})
+
+	It("limits the size of decompressed bodies", func() {
+		// a small body which expands to 1MB of whitespace, which is valid json
+		compressed := &bytes.Buffer{}
+		gw := gzip.NewWriter(compressed)
+		_, err := gw.Write(bytes.Repeat([]byte(" "), 1<<20))
+		Expect(err).To(Succeed())
+		Expect(gw.Close()).To(Succeed())
+
+		newBombRequest := func(url string) *http.Request {
+			req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(compressed.Bytes()))
+			Expect(err).To(Succeed())
+			req.Header.Set("Content-Encoding", encodingGzip)
+
+			return req
+		}
+
+		req := newBombRequest("http://localhost:10000")
+		Expect(decodeBody(httptest.NewRecorder(), req, 1024)).To(Succeed())
+
+		_, err = ioutil.ReadAll(req.Body)
+		Expect(err).To(MatchError(errBodyTooLarge))
+
+		transport := NewMemoryTransport()
+
+		node := startTestNode("1", withTransport(transport), func(cfg *Config) {
+			cfg.ServerMaxBodyBytes = 1024
+		})
+		defer node.Stop() // nolint: errcheck
+
+		res, err := transport.RoundTrip(newBombRequest("http://localhost:1" + gossipRoute))
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+	})
+})
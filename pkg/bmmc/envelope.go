@@ -0,0 +1,113 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Envelope contains the fields shared by all wire messages.
+// Decoders ignore unknown fields, so newer peers can add fields to the
+// envelope or to the messages without breaking older peers.
+type Envelope struct {
+	// Version is the protocol version of the sender
+	Version int `json:"version,omitempty"`
+	// NodeID is the ID of the sender, which doesn't change with its address.
+	// Legacy peers don't send it
+	NodeID string `json:"nodeId,omitempty"`
+	// Headers contains optional metadata of the message
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// newEnvelope creates the envelope of a message sent by this node.
+func newEnvelope() Envelope {
+	return Envelope{
+		Version: ProtocolVersion,
+	}
+}
+
+// shim converts a decoded message from a protocol version to the next one.
+type shim func(fields map[string]json.RawMessage) error
+
+// gossipShims converts the gossip messages sent by older peers,
+// indexed by the version they convert from.
+var gossipShims = map[int]shim{
+	0: func(fields map[string]json.RawMessage) error {
+		// legacy peers don't announce their capabilities
+		if _, ok := fields["capabilities"]; ok {
+			return nil
+		}
+
+		raw, err := json.Marshal(legacyProtocol.capabilities)
+		if err != nil {
+			return err
+		}
+
+		fields["capabilities"] = raw
+
+		return nil
+	},
+}
+
+// decodeMessage decodes a wire message from r in v, converting it from the
+// version of the sender to the current version with given shims.
+// Messages sent by newer peers are decoded as they are.
+func decodeMessage(r io.Reader, shims map[int]shim, v interface{}) error {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return err
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return err
+	}
+
+	converts := false
+
+	for version := env.Version; version < ProtocolVersion; version++ {
+		if _, ok := shims[version]; ok {
+			converts = true
+		}
+	}
+
+	// the messages of peers with the current version are decoded only once
+	if !converts {
+		return json.Unmarshal(raw, v)
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return err
+	}
+
+	for version := env.Version; version < ProtocolVersion; version++ {
+		if s, ok := shims[version]; ok {
+			if err := s(fields); err != nil {
+				return err
+			}
+		}
+	}
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, v)
+}
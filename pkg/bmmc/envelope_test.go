@@ -0,0 +1,62 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Envelope", func() {
+	It("converts gossip messages from legacy peers", func() {
+		var t HTTPGossip
+		Expect(decodeMessage(strings.NewReader(`{"addr":"localhost","port":"10000","digest":["first"]}`),
+			gossipShims, &t)).To(Succeed())
+
+		Expect(t.Version).To(Equal(0))
+		Expect(t.Capabilities).To(Equal(legacyProtocol.capabilities))
+		Expect(t.Digest).To(Equal([]string{"first"}))
+	})
+
+	It("doesn't convert gossip messages from current peers", func() {
+		var t HTTPGossip
+		Expect(decodeMessage(strings.NewReader(`{"version":1,"capabilities":["codec/json"],"addr":"localhost"}`),
+			gossipShims, &t)).To(Succeed())
+
+		Expect(t.Capabilities).To(Equal([]string{capCodecJSON}))
+	})
+
+	It("ignores unknown fields from newer peers", func() {
+		raw := `{"version":99,"headers":{"trace":"abc"},"signature":"xyz","addr":"localhost","digest":["first"]}`
+
+		var t HTTPSolicitation
+		Expect(decodeMessage(strings.NewReader(raw), nil, &t)).To(Succeed())
+
+		Expect(t.Version).To(Equal(99))
+		Expect(t.Headers).To(Equal(map[string]string{"trace": "abc"}))
+		Expect(t.Addr).To(Equal("localhost"))
+		Expect(t.Digest).To(Equal([]string{"first"}))
+	})
+
+	It("returns error for invalid messages", func() {
+		var t HTTPGossip
+		Expect(decodeMessage(strings.NewReader(`[]`), gossipShims, &t)).NotTo(Succeed())
+		Expect(decodeMessage(strings.NewReader(`{"version":"one"}`), gossipShims, &t)).NotTo(Succeed())
+	})
+})
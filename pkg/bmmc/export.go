@@ -0,0 +1,175 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+// The messages are exported as a json object, in the following schema:
+//
+//	{
+//	  "version": 1,
+//	  "messages": [
+//	    {
+//	      "id": "<unique ID of the message>",
+//	      "timestamp": "<RFC 3339 time when the message was created>",
+//	      "payload": <any json value>,
+//	      "callback_type": "<callback type of the message>",
+//	      "key": "<application key, only for keyed messages>",
+//	      "origin": "<node which added the keyed message>",
+//	      "codec": "<codec of the base64 payload, only for encoded payloads>"
+//	    }
+//	  ]
+//	}
+//
+// On import, only payload is required: messages without ID get a new one,
+// messages without timestamp are created now and messages without callback
+// type get NOCALLBACK.
+const (
+	// exportVersion is the version of the export schema
+	exportVersion = 1
+
+	exportMessagesErrFmt = "error at exporting messages: %w"
+	importMessagesErrFmt = "error at importing messages: %w"
+)
+
+var errUnsupportedExportVersion = errors.New("unsupported export version")
+
+// messagesExport is the export of messages buffer.
+type messagesExport struct {
+	Version  int               `json:"version"`
+	Messages []exportedMessage `json:"messages"`
+}
+
+// exportedMessage is a message, as it is exported.
+type exportedMessage struct {
+	ID           string      `json:"id,omitempty"`
+	Timestamp    time.Time   `json:"timestamp"`
+	Payload      interface{} `json:"payload"`
+	CallbackType string      `json:"callback_type,omitempty"`
+	Key          string      `json:"key,omitempty"`
+	Origin       string      `json:"origin,omitempty"`
+	Codec        string      `json:"codec,omitempty"`
+}
+
+// ExportMessages writes the messages from buffer in w, as json. Fragments and
+// tombstones are not exported.
+func (b *BMMC) ExportMessages(w io.Writer) error {
+	export := messagesExport{
+		Version:  exportVersion,
+		Messages: []exportedMessage{},
+	}
+
+	for _, el := range b.messageBuffer.All() {
+		if !el.IsMessage() {
+			continue
+		}
+
+		export.Messages = append(export.Messages, exportedMessage{
+			ID:           el.ID,
+			Timestamp:    el.Timestamp,
+			Payload:      el.Msg,
+			CallbackType: el.CallbackType,
+			Key:          el.Key,
+			Origin:       el.Origin,
+			Codec:        el.Codec,
+		})
+	}
+
+	if err := json.NewEncoder(w).Encode(export); err != nil {
+		return fmt.Errorf(exportMessagesErrFmt, err)
+	}
+
+	return nil
+}
+
+// ImportMessages adds the messages exported by ExportMessages in buffer, as if
+// they were added by AddMessage, but keeping their IDs and timestamps. Messages
+// which are already in buffer, or which were removed, are skipped.
+// It returns the number of imported messages.
+func (b *BMMC) ImportMessages(r io.Reader) (int, error) {
+	var export messagesExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return 0, fmt.Errorf(importMessagesErrFmt, err)
+	}
+
+	if export.Version != exportVersion {
+		return 0, fmt.Errorf(importMessagesErrFmt, errUnsupportedExportVersion)
+	}
+
+	imported := 0
+
+	for _, em := range export.Messages {
+		m, err := em.element()
+		if err != nil {
+			return imported, fmt.Errorf(importMessagesErrFmt, err)
+		}
+
+		if b.knownMessage(m.ID) {
+			continue
+		}
+
+		if _, err := b.addElement(context.Background(), m); err != nil {
+			return imported, fmt.Errorf(importMessagesErrFmt, err)
+		}
+
+		imported++
+	}
+
+	return imported, nil
+}
+
+// knownMessage returns true if given message is in buffer, or if it was
+// delivered or removed recently.
+func (b *BMMC) knownMessage(id string) bool {
+	return b.tombstones.has(id) || b.seen.has(id) || b.HasMessage(id)
+}
+
+// element creates the buffer element of the exported message.
+func (em exportedMessage) element() (buffer.Element, error) {
+	cbType := em.CallbackType
+	if cbType == "" {
+		cbType = NOCALLBACK
+	}
+
+	m, err := buffer.NewElement(em.Payload, cbType)
+	if err != nil {
+		return buffer.Element{}, err
+	}
+
+	if em.ID != "" {
+		m.ID = em.ID
+	}
+
+	if !em.Timestamp.IsZero() {
+		m.Timestamp = em.Timestamp
+	}
+
+	m.Key = em.Key
+	m.Origin = em.Origin
+	m.Codec = em.Codec
+
+	return m, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Export", func() {
+	It("imports the exported messages", func() {
+		source := newTestNode("1")
+		Expect(source.AddMessage("first-message", "first-callback")).To(Succeed())
+		Expect(source.AddKeyedMessage("a-key", "second-message", NOCALLBACK)).To(Succeed())
+
+		var raw bytes.Buffer
+		Expect(source.ExportMessages(&raw)).To(Succeed())
+
+		target := newTestNode("2")
+		Expect(target.ImportMessages(bytes.NewReader(raw.Bytes()))).To(Equal(2))
+
+		for _, m := range source.GetMessagesByType("first-callback") {
+			imported, err := target.GetMessage(m.ID)
+			Expect(err).To(Succeed())
+			Expect(imported.Payload).To(Equal("first-message"))
+			Expect(imported.Timestamp.Equal(m.Timestamp)).To(BeTrue())
+		}
+
+		Expect(target.GetMessagesByType(NOCALLBACK)).To(ConsistOf(
+			WithTransform(func(m Message) string { return m.Key }, Equal("a-key"))))
+
+		// messages already in buffer are skipped
+		Expect(target.ImportMessages(bytes.NewReader(raw.Bytes()))).To(Equal(0))
+	})
+
+	It("fills the missing fields of imported messages", func() {
+		target := newTestNode("1")
+		Expect(target.ImportMessages(strings.NewReader(
+			`{"version": 1, "messages": [{"payload": "a message"}]}`))).To(Equal(1))
+
+		messages := target.GetMessagesByType(NOCALLBACK)
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0].ID).NotTo(BeEmpty())
+		Expect(messages[0].Payload).To(Equal("a message"))
+		Expect(messages[0].Timestamp.IsZero()).To(BeFalse())
+	})
+
+	It("returns error for unsupported versions", func() {
+		target := newTestNode("1")
+
+		_, err := target.ImportMessages(strings.NewReader(`{"version": 2, "messages": []}`))
+		Expect(err).To(MatchError(ContainSubstring(errUnsupportedExportVersion.Error())))
+	})
+})
@@ -0,0 +1,107 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+const (
+	pingRoute = "/ping"
+
+	defaultProbeInterval = time.Second
+
+	peerDeadLogFmt = "BMMC %s:%s evicted dead peer %s"
+	probeLogErrFmt = "Error at probing peer %s:%s: %s"
+	pingStatusFmt  = "unexpected ping status %s"
+)
+
+// pingHTTPPath returns the url of the ping endpoint of given peer.
+func pingHTTPPath(addr, port string) string {
+	return peerURL(addr, port, pingRoute)
+}
+
+// pingHandler answers the probes of the failure detectors of peers.
+func (b *BMMC) pingHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ping probes given peer. The result is recorded by the failure detector
+// when the response is received.
+func (b *BMMC) ping(addr, port string) error {
+	resp, err := b.netClient.Get(pingHTTPPath(addr, port))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf(pingStatusFmt, resp.Status) // nolint: goerr113
+	}
+
+	return nil
+}
+
+// probePeers probes a random peer every ProbeInterval and evicts the dead
+// peers, until stop is closed.
+func (b *BMMC) probePeers(stop <-chan struct{}) {
+	ticker := time.NewTicker(b.config.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if peers := b.knownPeers(); len(peers) > 0 {
+			p := peers[rand.Intn(len(peers))] // nolint: gosec
+
+			if err := b.ping(p.Addr, p.Port); err != nil {
+				b.logf(MembershipComponent, WarnLevel, probeLogErrFmt, p.Addr, p.Port, err)
+			}
+		}
+
+		b.evictDeadPeers()
+	}
+}
+
+// evictDeadPeers removes the dead peers from peers buffer. The peers are not
+// removed from the buffers of the other nodes, which detect them on their own.
+func (b *BMMC) evictDeadPeers() {
+	for _, host := range b.detector.Dead(time.Now()) {
+		addr, port, err := net.SplitHostPort(host)
+		if err != nil {
+			continue
+		}
+
+		p, err := peer.NewPeer(addr, port)
+		if err != nil {
+			continue
+		}
+
+		b.forgetPeer(p)
+		b.logf(MembershipComponent, WarnLevel, peerDeadLogFmt, b.config.Addr, b.config.Port, host)
+	}
+}
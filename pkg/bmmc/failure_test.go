@@ -0,0 +1,59 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Failure detector", func() {
+	It("evicts the dead peers", func() {
+		transport := NewMemoryTransport()
+		nodes := []*BMMC{}
+
+		for _, port := range []string{"1", "2"} {
+			node, err := New(&Config{
+				Addr:             "localhost",
+				Port:             port,
+				BufferSize:       16,
+				RoundDuration:    time.Millisecond * 20,
+				SuspicionTimeout: time.Millisecond * 100,
+				ProbeInterval:    time.Millisecond * 10,
+				Transport:        transport,
+				Logger:           log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+			Expect(node.Start()).To(Succeed())
+
+			defer node.Stop() // nolint: errcheck
+
+			nodes = append(nodes, node)
+		}
+
+		Expect(nodes[0].AddPeer("localhost", "2")).To(Succeed())
+		// no node is served on port 3
+		Expect(nodes[0].AddPeer("localhost", "3")).To(Succeed())
+
+		Eventually(nodes[0].GetPeers, time.Second*5).Should(Equal([]string{"localhost/2"}))
+		Consistently(nodes[0].GetPeers, time.Millisecond*300).Should(Equal([]string{"localhost/2"}))
+	})
+})
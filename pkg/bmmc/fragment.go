@@ -0,0 +1,216 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	fragmentIDSep = "-fragment-"
+	fragmentIDFmt = "%s" + fragmentIDSep + "%d"
+
+	reassembleErrFmt       = "error at reassembling message %s: %w"
+	invalidFragmentErrFmt  = "invalid fragment %d of %d"
+	fragmentTotalErrFmt    = "fragment is one of %d fragments, instead of %d"
+	tooManyFragmentsErrFmt = "message has %d fragments, more than %d"
+
+	incompleteMessageLogFmt = "BMMC %s:%s dropped the fragments of message %s, which was not reassembled in %s"
+
+	defaultFragmentTTL = time.Minute
+
+	// maxFragments is the maximum number of fragments of a message, which
+	// bounds the memory used to reassemble the messages received from peers
+	maxFragments = 1 << 16
+)
+
+// partialMessage is the collected fragments of a message.
+type partialMessage struct {
+	// fragments by index
+	fragments map[int][]byte
+	// total is the number of fragments of the message, from its first fragment
+	total int
+	// started is the time when the first fragment was collected
+	started time.Time
+}
+
+// reassembler collects the fragments of fragmented messages.
+type reassembler struct {
+	// groups of fragments, by message ID
+	groups map[string]*partialMessage
+	mux    sync.Mutex
+}
+
+// newReassembler creates a reassembler.
+func newReassembler() *reassembler {
+	return &reassembler{
+		groups: map[string]*partialMessage{},
+	}
+}
+
+// expire forgets the messages which were not reassembled in given ttl and
+// returns their IDs.
+func (r *reassembler) expire(ttl time.Duration) []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	expired := []string{}
+
+	for id, group := range r.groups {
+		if time.Since(group.started) > ttl {
+			delete(r.groups, id)
+			expired = append(expired, id)
+		}
+	}
+
+	return expired
+}
+
+// add collects given fragment element. When all fragments of a message are
+// collected, it returns the reassembled message element and true.
+func (r *reassembler) add(el buffer.Element) (buffer.Element, bool, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	f := el.Fragment
+
+	// the fragments are received from peers, so they are not trusted
+	if f.Total <= 0 || f.Total > maxFragments || f.Index < 0 || f.Index >= f.Total {
+		return buffer.Element{}, false, fmt.Errorf(reassembleErrFmt, f.Group,
+			fmt.Errorf(invalidFragmentErrFmt, f.Index, f.Total)) // nolint: goerr113
+	}
+
+	group, ok := r.groups[f.Group]
+	if !ok {
+		group = &partialMessage{fragments: map[int][]byte{}, total: f.Total, started: time.Now()}
+		r.groups[f.Group] = group
+	}
+
+	if f.Total != group.total {
+		return buffer.Element{}, false, fmt.Errorf(reassembleErrFmt, f.Group,
+			fmt.Errorf(fragmentTotalErrFmt, f.Total, group.total)) // nolint: goerr113
+	}
+
+	group.fragments[f.Index] = f.Data
+
+	if len(group.fragments) < f.Total {
+		return buffer.Element{}, false, nil
+	}
+
+	delete(r.groups, f.Group)
+
+	raw := make([][]byte, f.Total)
+	for i := range raw {
+		raw[i] = group.fragments[i]
+	}
+
+	m := buffer.Element{
+		ID:             f.Group,
+		Timestamp:      el.Timestamp,
+		CallbackType:   el.CallbackType,
+		Key:            el.Key,
+		Origin:         el.Origin,
+		Signature:      el.Signature,
+		MAC:            el.MAC,
+		HLC:            el.HLC,
+		Codec:          el.Codec,
+		MaxGossipCount: el.MaxGossipCount,
+		VectorClock:    el.VectorClock,
+		Seq:            el.Seq,
+		SeqEpoch:       el.SeqEpoch,
+		Priority:       el.Priority,
+		Reassembled:    true,
+	}
+
+	if err := json.Unmarshal(bytes.Join(raw, nil), &m.Msg); err != nil {
+		return buffer.Element{}, false, fmt.Errorf(reassembleErrFmt, f.Group, err)
+	}
+
+	return m, true, nil
+}
+
+// fragment splits given element in fragments with at most MaxFragmentSize
+// bytes of json encoded message. It returns nil if the element doesn't need
+// to be fragmented.
+func (b *BMMC) fragment(el buffer.Element) ([]buffer.Element, error) {
+	if b.config.MaxFragmentSize <= 0 {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(el.Msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) <= b.config.MaxFragmentSize {
+		return nil, nil
+	}
+
+	total := (len(raw) + b.config.MaxFragmentSize - 1) / b.config.MaxFragmentSize
+	if total > maxFragments {
+		return nil, fmt.Errorf(tooManyFragmentsErrFmt, total, maxFragments) // nolint: goerr113
+	}
+
+	fragments := make([]buffer.Element, total)
+
+	for i := range fragments {
+		end := (i + 1) * b.config.MaxFragmentSize
+		if end > len(raw) {
+			end = len(raw)
+		}
+
+		fragments[i] = buffer.Element{
+			ID:             fmt.Sprintf(fragmentIDFmt, el.ID, i),
+			Timestamp:      el.Timestamp,
+			CallbackType:   el.CallbackType,
+			Key:            el.Key,
+			Origin:         el.Origin,
+			Signature:      el.Signature,
+			MAC:            el.MAC,
+			HLC:            el.HLC,
+			Codec:          el.Codec,
+			MaxGossipCount: el.MaxGossipCount,
+			VectorClock:    el.VectorClock,
+			Seq:            el.Seq,
+			SeqEpoch:       el.SeqEpoch,
+			Priority:       el.Priority,
+			Fragment: &buffer.Fragment{
+				Group: el.ID,
+				Index: i,
+				Total: total,
+				Data:  raw[i*b.config.MaxFragmentSize : end],
+			},
+		}
+	}
+
+	return fragments, nil
+}
+
+// collectFragments removes from messages buffer the fragments of the messages
+// which were not reassembled in FragmentTTL, e.g. because a fragment was lost.
+func (b *BMMC) collectFragments() {
+	for _, id := range b.reassembler.expire(b.config.FragmentTTL) {
+		b.messageBuffer.RemoveFragments(id)
+		b.logf(GossipComponent, WarnLevel, incompleteMessageLogFmt, b.config.Addr, b.config.Port, id, b.config.FragmentTTL)
+	}
+}
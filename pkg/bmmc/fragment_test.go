@@ -0,0 +1,176 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Fragmentation", func() {
+	var (
+		b  *BMMC
+		el buffer.Element
+	)
+
+	BeforeEach(func() {
+		b = &BMMC{config: &Config{MaxFragmentSize: 4}}
+
+		var err error
+		el, err = buffer.NewElement("awesome message", "awesome-callback")
+		Expect(err).To(Succeed())
+	})
+
+	It("doesn't fragment messages smaller than max fragment size", func() {
+		b.config.MaxFragmentSize = 64
+		Expect(b.fragment(el)).To(BeNil())
+	})
+
+	It("doesn't fragment messages when max fragment size is 0", func() {
+		b.config.MaxFragmentSize = 0
+		Expect(b.fragment(el)).To(BeNil())
+	})
+
+	It("splits the message in fragments", func() {
+		fragments, err := b.fragment(el)
+		Expect(err).To(Succeed())
+		// `"awesome message"` has 17 bytes
+		Expect(fragments).To(HaveLen(5))
+
+		for i, f := range fragments {
+			Expect(f.Msg).To(BeNil())
+			Expect(f.CallbackType).To(Equal(el.CallbackType))
+			Expect(f.Fragment.Group).To(Equal(el.ID))
+			Expect(f.Fragment.Index).To(Equal(i))
+			Expect(f.Fragment.Total).To(Equal(5))
+		}
+	})
+
+	It("reassembles the message from fragments in any order", func() {
+		fragments, err := b.fragment(el)
+		Expect(err).To(Succeed())
+
+		r := newReassembler()
+		for _, i := range []int{3, 0, 4, 1} {
+			_, ok, err := r.add(fragments[i])
+			Expect(err).To(Succeed())
+			Expect(ok).To(BeFalse())
+		}
+
+		m, ok, err := r.add(fragments[2])
+		Expect(err).To(Succeed())
+		Expect(ok).To(BeTrue())
+		Expect(m.ID).To(Equal(el.ID))
+		Expect(m.Msg).To(Equal(el.Msg))
+		Expect(m.CallbackType).To(Equal(el.CallbackType))
+		Expect(m.Reassembled).To(BeTrue())
+		Expect(r.groups).To(BeEmpty())
+	})
+
+	It("rejects the fragments with an invalid index or total", func() {
+		r := newReassembler()
+
+		for _, f := range []buffer.Fragment{
+			{Group: "group", Index: 0, Total: -1},
+			{Group: "group", Index: 0, Total: 0},
+			{Group: "group", Index: 0, Total: maxFragments + 1},
+			{Group: "group", Index: 0, Total: math.MaxInt32},
+			{Group: "group", Index: -1, Total: 2},
+			{Group: "group", Index: 2, Total: 2},
+		} {
+			f := f
+			_, ok, err := r.add(buffer.Element{ID: "fragment", Fragment: &f})
+			Expect(err).To(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		}
+
+		Expect(r.groups).To(BeEmpty())
+	})
+
+	It("rejects the fragments whose total differs from the first fragment of the message", func() {
+		fragments, err := b.fragment(el)
+		Expect(err).To(Succeed())
+
+		r := newReassembler()
+		_, _, err = r.add(fragments[0])
+		Expect(err).To(Succeed())
+
+		forged := fragments[1]
+		forged.Fragment = &buffer.Fragment{Group: el.ID, Index: 1, Total: 2, Data: fragments[1].Fragment.Data}
+
+		_, ok, err := r.add(forged)
+		Expect(err).To(HaveOccurred())
+		Expect(ok).To(BeFalse())
+
+		for _, f := range fragments[1:] {
+			_, _, err = r.add(f)
+			Expect(err).To(Succeed())
+		}
+
+		Expect(r.groups).To(BeEmpty())
+	})
+
+	It("doesn't split the messages in more than the maximum number of fragments", func() {
+		b.config.MaxFragmentSize = 1
+
+		big, err := buffer.NewElement(strings.Repeat("a", maxFragments), "awesome-callback")
+		Expect(err).To(Succeed())
+
+		_, err = b.fragment(big)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("drops the messages which are not reassembled in time", func() {
+		fragments, err := b.fragment(el)
+		Expect(err).To(Succeed())
+
+		r := newReassembler()
+		_, _, err = r.add(fragments[0])
+		Expect(err).To(Succeed())
+
+		Expect(r.expire(time.Hour)).To(BeEmpty())
+		Expect(r.expire(0)).To(ConsistOf(el.ID))
+		Expect(r.groups).To(BeEmpty())
+	})
+
+	It("removes the fragments of the messages which are not reassembled in time", func() {
+		b.config.Logger = log.New(ioutil.Discard, "", 0)
+		b.messageBuffer = buffer.NewBuffer(16)
+		b.reassembler = newReassembler()
+
+		fragments, err := b.fragment(el)
+		Expect(err).To(Succeed())
+
+		for _, f := range fragments[:2] {
+			Expect(b.messageBuffer.Add(f)).To(Succeed())
+
+			_, _, err := b.reassembler.add(f)
+			Expect(err).To(Succeed())
+		}
+
+		b.collectFragments()
+		Expect(b.messageBuffer.Length()).To(Equal(0))
+	})
+})
@@ -17,7 +17,12 @@ limitations under the License.
 package bmmc
 
 import (
+	"context"
+	"math/rand"
+	"sync/atomic"
 	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
 )
 
 const (
@@ -25,76 +30,222 @@ const (
 	stopGossiperLogFmt  = "End of gossip round from %s:%s"
 )
 
-// randomlySelectPeer is a helper func that returns a random peer.
-func (b *BMMC) randomlySelectPeer() (string, string) {
-	for {
-		addr, port, i := b.peerBuffer.GetRandom()
+// RoundInfo describes a gossip round, for round observers.
+type RoundInfo struct {
+	// Number is the number of the round
+	Number int64
+	// Peers are the peers selected to receive gossip messages in the round
+	Peers []Peer
+	// DigestSize is the number of message IDs in the digest gossiped in the round
+	DigestSize int
+	// Duration is the time spent in the round, without the wait for the
+	// next round. It is set only at the end of the round
+	Duration time.Duration
+}
+
+// knownPeers returns the peers from peers buffer.
+func (b *BMMC) knownPeers() []Peer {
+	buf := b.peerBuffer.Peers()
 
-		if b.selectedPeers[i] {
-			continue
+	peers := make([]Peer, len(buf))
+	for i, p := range buf {
+		peers[i] = Peer{
+			Addr:  p.Addr(),
+			Port:  p.Port(),
+			Roles: b.peerRoles.get(p.Addr(), p.Port()),
 		}
+	}
 
-		b.selectedPeers[i] = true
+	return peers
+}
 
-		return addr, port
+// touchPeer marks given peer as seen, so it is the last evicted from peers
+// buffer, and as reachable.
+func (b *BMMC) touchPeer(addr, port string) {
+	if p, err := peer.NewPeer(addr, port); err == nil {
+		b.peerBuffer.Touch(p)
 	}
-}
 
-// resetSelectedPeers is a helper func that clear slice with selected peers in gossip round.
-func (b *BMMC) resetSelectedPeers() {
-	for i := range b.selectedPeers {
-		b.selectedPeers[i] = false
+	if b.detector != nil {
+		b.detector.Alive(fullHost(addr, port))
 	}
+
+	b.peerReachable(addr, port)
 }
 
 // gossipLen is number of nodes which will receive gossip message.
 // It will be 0 if the node has empty peers buffer or if the node has
 // empty message buffer.
 func (b *BMMC) computeGossipLen() int {
-	if b.peerBuffer.Length() == 0 || b.messageBuffer.Length() == 0 || b.config.Beta == 0 {
+	if b.peerBuffer.Length() == 0 || b.messageBuffer.Length() == 0 || b.configBeta() == 0 {
 		return 0
 	}
 
-	return int(b.config.Beta*float64(b.peerBuffer.Length())) + 1
+	return int(b.beta()*float64(b.peerBuffer.Length())) + 1
 }
 
-func (b *BMMC) round(stop <-chan struct{}) {
-	for {
-		select {
-		case <-stop:
-			b.config.Logger.Printf(stopGossiperLogFmt, b.config.Addr, b.config.Port)
-			return
-		default:
-			b.gossipRound.Increment()
-
-			gossipLen := b.computeGossipLen()
-
-			// send gossip messages
-			for i := 0; i < gossipLen; i++ {
-				destAddr, destPort := b.randomlySelectPeer()
-
-				gossipMsg := HTTPGossip{
-					Addr:        b.config.Addr,
-					Port:        b.config.Port,
-					RoundNumber: b.gossipRound,
-					Digest:      b.messageBuffer.Digest(),
-				}
-
-				err := b.sendGossip(gossipMsg, destAddr, destPort)
-				if err != nil {
-					b.config.Logger.Printf("%s", err)
-				}
-			}
-
-			(*b.messageBuffer).IncrementGossipCount()
-			b.resetSelectedPeers()
-
-			time.Sleep(b.config.RoundDuration)
+// roundDuration returns the duration of the next gossip round.
+// A random jitter up to RoundJitter is added to the configured round duration.
+func (b *BMMC) roundDuration() time.Duration {
+	d := b.configRoundDuration()
+
+	if b.config.MaxRoundDuration > d {
+		d = b.adaptRoundDuration()
+	}
+
+	if b.config.RoundJitter > 0 {
+		d += time.Duration(rand.Int63n(int64(b.config.RoundJitter)))
+	}
+
+	return d
+}
+
+// adaptRoundDuration lengthens the round duration when there are no new
+// messages in buffer and resets it when new messages arrive.
+func (b *BMMC) adaptRoundDuration() time.Duration {
+	switch {
+	case atomic.SwapInt32(&b.newMessages, 0) == 1 || b.adaptiveRoundDuration == 0:
+		b.adaptiveRoundDuration = b.configRoundDuration()
+	case b.adaptiveRoundDuration*2 > b.config.MaxRoundDuration:
+		b.adaptiveRoundDuration = b.config.MaxRoundDuration
+	default:
+		b.adaptiveRoundDuration *= 2
+	}
+
+	return b.adaptiveRoundDuration
+}
+
+// messagesAdded marks that messages were added in buffer since the last round
+// and wakes the gossiper, so a lengthened wait for the next round is cut to
+// RoundDuration.
+func (b *BMMC) messagesAdded() {
+	atomic.StoreInt32(&b.newMessages, 1)
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// gossipTargets returns the peers which receive gossip messages in current
+// round: the preferred peers and the peers chosen by the peer selector.
+func (b *BMMC) gossipTargets() []Peer {
+	preferred := make(map[string]struct{}, len(b.config.PreferredPeers))
+	targets := make([]Peer, 0, len(b.config.PreferredPeers))
+
+	for _, p := range b.config.PreferredPeers {
+		if _, ok := preferred[fullHost(p.Addr, p.Port)]; ok {
+			continue
 		}
+
+		preferred[fullHost(p.Addr, p.Port)] = struct{}{}
+		targets = append(targets, p)
 	}
+
+	candidates := []Peer{}
+
+	for _, p := range b.withoutQuarantined(messageReceivers(b.bans.withoutBanned(b.candidatePeers()))) {
+		if _, ok := preferred[fullHost(p.Addr, p.Port)]; !ok {
+			candidates = append(candidates, p)
+		}
+	}
+
+	selector := b.config.PeerSelector
+
+	switch {
+	case b.config.PreferResponsivePeers:
+		selector = NewWeightedSelector(b.peerScores.score)
+	case b.config.PreferNearbyPeers:
+		selector = NewLatencyAwareSelector(b.coordinates.estimate, b.config.NearbyExploration)
+	}
+
+	targets = append(targets, selector.Select(candidates, b.computeGossipLen())...)
+
+	return b.bans.withoutBanned(targets)
+}
+
+// gossip sends gossip messages to given peers.
+func (b *BMMC) gossip(ctx context.Context, peers []Peer) {
+	for _, p := range peers {
+		digest := b.gossipDigest(p.Addr, p.Port)
+
+		gossipMsg := HTTPGossip{
+			Envelope:     b.envelope(),
+			Capabilities: localCapabilities,
+			Addr:         b.config.Addr,
+			Port:         b.config.Port,
+			Roles:        b.config.Roles,
+			Topics:       b.config.Topics,
+			RoundNumber:  b.gossipRound,
+			Digest:       digest,
+			Peers:        b.peerSample(p),
+			Coordinate:   b.localCoordinate(),
+			PushPull:     b.pushPull(p.Addr, p.Port),
+		}
+
+		if b.compactDigest(p.Addr, p.Port, len(digest)) {
+			gossipMsg.Digest = []string{}
+			gossipMsg.Bloom = newDigestBloom(digest)
+		}
+
+		err := b.sendGossip(ctx, gossipMsg, p.Addr, p.Port)
+		if err != nil {
+			b.logf(GossipComponent, WarnLevel, "%s", err)
+		}
+	}
+}
+
+// runRound runs a gossip round.
+func (b *BMMC) runRound() {
+	start := time.Now()
+
+	b.gossipRound.Increment()
+	atomic.AddInt64(&b.counters.rounds, 1)
+
+	ctx, span := b.startRoundSpan()
+	defer span.End(nil)
+
+	info := RoundInfo{
+		Number: b.gossipRound.GetNumber(),
+		Peers:  []Peer{},
+	}
+
+	if b.config.Roles.Has(GossiperRole) {
+		info.Peers = b.gossipTargets()
+	}
+
+	if b.config.OnRoundStart != nil || b.config.OnRoundEnd != nil || b.hooks.has(roundCompleteHook) {
+		info.DigestSize = len(b.messageBuffer.Digest())
+	}
+
+	if b.config.OnRoundStart != nil {
+		b.config.OnRoundStart(info)
+	}
+
+	b.gossip(ctx, info.Peers)
+	b.adaptBeta()
+
+	(*b.messageBuffer).IncrementGossipCount()
+	b.removeExpiredMessages()
+	b.removeExpiredTombstones()
+	b.retransmit()
+	b.releaseDelayed()
+	b.collectFragments()
+	b.balanceViews()
+	b.saveMessages()
+
+	info.Duration = time.Since(start)
+	b.roundDurations.observe(info.Duration)
+
+	if b.config.OnRoundEnd != nil {
+		b.config.OnRoundEnd(info)
+	}
+
+	b.notifyRoundComplete(info)
 }
 
 func (b *BMMC) startGossiper(stop <-chan struct{}) {
-	b.config.Logger.Printf(startGossiperLogFmt, b.config.Addr, b.config.Port)
-	b.round(stop)
+	b.logf(GossipComponent, InfoLevel, startGossiperLogFmt, b.config.Addr, b.config.Port)
+	b.scheduler().Run(stop, b.runRound)
+	b.logf(GossipComponent, InfoLevel, stopGossiperLogFmt, b.config.Addr, b.config.Port)
 }
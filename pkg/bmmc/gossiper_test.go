@@ -17,6 +17,11 @@ limitations under the License.
 package bmmc
 
 import (
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -70,4 +75,190 @@ var _ = Describe("Gossiper", func() {
 			Expect(b.computeGossipLen()).To(Equal(int(b.config.Beta*float64(b.peerBuffer.Length())) + 1))
 		})
 	})
+
+	Describe("roundDuration function", func() {
+		It("returns the round duration if there is no jitter", func() {
+			b := &BMMC{config: &Config{RoundDuration: time.Second}}
+			Expect(b.roundDuration()).To(Equal(time.Second))
+		})
+
+		It("adds a jitter lower than the configured one", func() {
+			b := &BMMC{config: &Config{RoundDuration: time.Second, RoundJitter: time.Millisecond * 100}}
+			for i := 0; i < 10; i++ {
+				Expect(b.roundDuration()).To(And(
+					BeNumerically(">=", time.Second),
+					BeNumerically("<", time.Second+time.Millisecond*100)))
+			}
+		})
+	})
+
+	Describe("adaptRoundDuration function", func() {
+		var b *BMMC
+
+		BeforeEach(func() {
+			b = &BMMC{config: &Config{
+				RoundDuration:    time.Millisecond * 100,
+				MaxRoundDuration: time.Millisecond * 300,
+			}}
+		})
+
+		It("lengthens the round duration up to max round duration while there are no new messages", func() {
+			Expect(b.adaptRoundDuration()).To(Equal(time.Millisecond * 100))
+			Expect(b.adaptRoundDuration()).To(Equal(time.Millisecond * 200))
+			Expect(b.adaptRoundDuration()).To(Equal(time.Millisecond * 300))
+			Expect(b.adaptRoundDuration()).To(Equal(time.Millisecond * 300))
+		})
+
+		It("resets the round duration when new messages arrive", func() {
+			b.adaptiveRoundDuration = time.Millisecond * 300
+			b.newMessages = 1
+			Expect(b.adaptRoundDuration()).To(Equal(time.Millisecond * 100))
+			Expect(b.newMessages).To(Equal(int32(0)))
+		})
+
+		It("delivers the messages added after an idle period in about a round duration", func() {
+			transport := NewMemoryTransport()
+
+			nodes := make([]*BMMC, 2)
+			for i, port := range []string{"1", "2"} {
+				nodes[i] = startTestNode(port, withTransport(transport), func(cfg *Config) {
+					cfg.MaxRoundDuration = time.Second * 5
+				})
+				defer nodes[i].Stop() // nolint: errcheck
+			}
+
+			Expect(nodes[0].AddPeer("localhost", "2")).To(Succeed())
+
+			// the rounds are lengthened up to seconds while the nodes are idle
+			time.Sleep(time.Millisecond * 700)
+
+			Expect(nodes[0].AddMessage("awesome message", NOCALLBACK)).To(Succeed())
+			Eventually(nodes[1].GetMessages, time.Millisecond*500, time.Millisecond*10).Should(
+				ContainElement("awesome message"))
+		})
+	})
+
+	Describe("gossipTargets function", func() {
+		It("always includes the preferred peers", func() {
+			peerBuf := peer.NewPeerBuffer()
+			for _, port := range []string{"10000", "20000", "30000"} {
+				p, err := peer.NewPeer("localhost", port)
+				Expect(err).To(Succeed())
+				Expect(peerBuf.AddPeer(p)).To(Succeed())
+			}
+
+			msgBuf := buffer.NewBuffer(25)
+			msg, err := buffer.NewElement("awesome message", "awesome-callback")
+			Expect(err).To(Succeed())
+			Expect(msgBuf.Add(msg)).To(Succeed())
+
+			preferred := Peer{Addr: "localhost", Port: "40000"}
+
+			b := &BMMC{
+				peerBuffer:    peerBuf,
+				messageBuffer: msgBuf,
+				peerRoles:     newPeerRoles(),
+				bans:          newBans(),
+				config: &Config{
+					Beta:           0.3,
+					PeerSelector:   NewRandomSelector(),
+					PreferredPeers: []Peer{preferred, preferred},
+				},
+			}
+
+			for i := 0; i < 10; i++ {
+				targets := b.gossipTargets()
+				Expect(targets).To(HaveLen(1 + b.computeGossipLen()))
+				Expect(targets[0]).To(Equal(preferred))
+			}
+		})
+	})
+
+	Describe("round observers", func() {
+		It("report the start and the end of gossip rounds", func() {
+			var (
+				starts []RoundInfo
+				ends   []RoundInfo
+				mux    sync.Mutex
+			)
+
+			b, err := New(&Config{
+				Addr:          "localhost",
+				Port:          "1",
+				BufferSize:    16,
+				RoundDuration: time.Millisecond * 20,
+				Transport:     NewMemoryTransport(),
+				Logger:        log.New(ioutil.Discard, "", 0),
+				OnRoundStart: func(info RoundInfo) {
+					mux.Lock()
+					defer mux.Unlock()
+
+					starts = append(starts, info)
+				},
+				OnRoundEnd: func(info RoundInfo) {
+					mux.Lock()
+					defer mux.Unlock()
+
+					ends = append(ends, info)
+				},
+			})
+			Expect(err).To(Succeed())
+
+			Expect(b.AddPeer("localhost", "2")).To(Succeed())
+			Expect(b.AddMessage("awesome message", "awesome-callback")).To(Succeed())
+
+			Expect(b.Start()).To(Succeed())
+			defer b.Stop() // nolint: errcheck
+
+			Eventually(func() int {
+				mux.Lock()
+				defer mux.Unlock()
+
+				return len(ends)
+			}).Should(BeNumerically(">=", 2))
+
+			mux.Lock()
+			defer mux.Unlock()
+
+			Expect(starts[0].Number).To(Equal(int64(1)))
+			Expect(starts[0].Peers).To(ConsistOf(Peer{Addr: "localhost", Port: "2", Roles: DefaultRoles}))
+			Expect(starts[0].DigestSize).To(BeNumerically(">=", 1))
+			Expect(starts[0].Duration).To(BeZero())
+
+			Expect(ends[0].Number).To(Equal(starts[0].Number))
+			Expect(ends[0].Peers).To(Equal(starts[0].Peers))
+			Expect(ends[0].Duration).To(BeNumerically(">", 0))
+			Expect(ends[1].Number).To(Equal(int64(2)))
+		})
+	})
+
+	Describe("message aging", func() {
+		It("stops gossiping the messages after their max gossip count", func() {
+			b, err := New(&Config{
+				Addr:           "localhost",
+				Port:           "1",
+				BufferSize:     16,
+				RoundDuration:  time.Millisecond * 20,
+				MaxGossipCount: 3,
+				Transport:      NewMemoryTransport(),
+				Logger:         log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+
+			Expect(b.AddMessage("aged", NOCALLBACK)).To(Succeed())
+			Expect(b.AddMessageWithTTL("short", NOCALLBACK, 1)).To(Succeed())
+			Expect(b.AddMessageWithTTL("invalid", NOCALLBACK, 0)).To(MatchError(errInvalidRounds))
+			Expect(b.messageBuffer.GossipDigest(b.config.MaxGossipCount)).To(HaveLen(2))
+
+			b.messageBuffer.IncrementGossipCount()
+			Expect(b.messageBuffer.GossipDigest(b.config.MaxGossipCount)).To(HaveLen(1))
+
+			b.messageBuffer.IncrementGossipCount()
+			b.messageBuffer.IncrementGossipCount()
+			Expect(b.messageBuffer.GossipDigest(b.config.MaxGossipCount)).To(BeEmpty())
+
+			// aged messages stay in buffer, so they are still sent when solicited
+			Expect(b.GetMessages()).To(ConsistOf("aged", "short"))
+		})
+	})
 })
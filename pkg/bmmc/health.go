@@ -0,0 +1,146 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	healthRoute    = "/healthz"
+	readinessRoute = "/readyz"
+
+	notHealthyFmt = "node is %s"
+	notReadyFmt   = "node is %s, with %d peers"
+
+	healthHandlerErrLogFmt = "Error in health handler: %s"
+)
+
+// Status is a snapshot of the state of the node, e.g. for dashboards.
+type Status struct {
+	// State is the lifecycle state of the node
+	State State
+	// Round is the number of the current gossip round
+	Round int64
+	// Peers is the number of peers
+	Peers int
+	// Messages is the number of messages in buffer
+	Messages int
+	// BufferBytes is the approximate size of the messages in buffer, in bytes
+	BufferBytes int
+	// LastGossip is the time of the last successful request sent to each
+	// peer, by host. Peers to which no request succeeded are not included
+	LastGossip map[string]time.Time
+	// Uptime is the time since the node was started, or 0 if it is not running
+	Uptime time.Duration
+	// Ready is true if the node can serve traffic (see ready)
+	Ready bool
+	// PeerStatuses are the statuses of the known peers, with the requests
+	// sent to them and their quarantine
+	PeerStatuses []PeerStatus
+	// Unreachable are the hosts of the peers to which PeerFailureThreshold
+	// consecutive requests failed, which may be in another partition
+	Unreachable []string
+}
+
+// Status returns a snapshot of the state of the node.
+func (b *BMMC) Status() Status {
+	lastGossip := map[string]time.Time{}
+
+	for _, s := range b.peerScores.list() {
+		if !s.LastSuccess.IsZero() {
+			lastGossip[fullHost(s.Addr, s.Port)] = s.LastSuccess
+		}
+	}
+
+	uptime := time.Duration(0)
+	if b.IsRunning() && !b.startTime().IsZero() {
+		uptime = time.Since(b.startTime())
+	}
+
+	return Status{
+		State:        b.State(),
+		Round:        b.gossipRound.GetNumber(),
+		Peers:        b.peerBuffer.Length(),
+		Messages:     b.messageBuffer.Length(),
+		BufferBytes:  b.messageBuffer.Bytes(),
+		LastGossip:   lastGossip,
+		Uptime:       uptime,
+		Ready:        b.ready(),
+		PeerStatuses: b.GetPeerStatuses(),
+		Unreachable:  b.partitions.list(),
+	}
+}
+
+// ready returns true if the node is running and knows at least a peer, and,
+// with ReadyAfterSync, if it synchronized its messages buffer with a peer.
+// Nodes without seeds to join are ready as soon as they are running, since
+// they may be the first node of the cluster.
+func (b *BMMC) ready() bool {
+	if !b.IsRunning() {
+		return false
+	}
+
+	if !b.joinsCluster() {
+		return true
+	}
+
+	if b.config.ReadyAfterSync && atomic.LoadInt32(&b.initiallySynced) == 0 {
+		return false
+	}
+
+	return b.peerBuffer.Length() > 0
+}
+
+// joinsCluster returns true if the node has seeds through which it joins a cluster.
+func (b *BMMC) joinsCluster() bool {
+	return len(b.config.Seeds) > 0 || len(b.config.SeedRecords) > 0 || len(b.config.Discoverers) > 0
+}
+
+// healthHandler answers 200 OK while the node serves requests, e.g. for
+// liveness probes.
+func (b *BMMC) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if s := b.State(); s != StartingState && s != RunningState {
+		http.Error(w, fmt.Sprintf(notHealthyFmt, s), http.StatusServiceUnavailable)
+		return
+	}
+
+	b.writeOK(w)
+}
+
+// readinessHandler answers 200 OK when the node is ready to serve traffic,
+// e.g. for load balancers and readiness probes.
+func (b *BMMC) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	if !b.ready() {
+		http.Error(w, fmt.Sprintf(notReadyFmt, b.State(), b.peerBuffer.Length()), http.StatusServiceUnavailable)
+		return
+	}
+
+	b.writeOK(w)
+}
+
+// writeOK writes the body of the successful health checks.
+func (b *BMMC) writeOK(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if _, err := w.Write([]byte("ok\n")); err != nil {
+		b.logf(ServerComponent, ErrorLevel, healthHandlerErrLogFmt, err)
+	}
+}
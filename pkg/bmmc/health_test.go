@@ -0,0 +1,113 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health", func() {
+	var transport *MemoryTransport
+
+	get := func(path string) int {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:1"+path, nil)
+		Expect(err).To(Succeed())
+
+		res, err := transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+
+		return res.StatusCode
+	}
+
+	BeforeEach(func() {
+		transport = NewMemoryTransport()
+	})
+
+	It("is healthy and ready while running, without seeds", func() {
+		b := newTestNode("1", withTransport(transport))
+		Expect(b.Status().Ready).To(BeFalse())
+
+		Expect(b.Start()).To(Succeed())
+		defer b.Stop() // nolint: errcheck
+
+		Expect(get(healthRoute)).To(Equal(http.StatusOK))
+		Expect(get(readinessRoute)).To(Equal(http.StatusOK))
+	})
+
+	It("is not ready until it knows a peer, with seeds", func() {
+		b := startTestNode("1", withTransport(transport), func(cfg *Config) {
+			cfg.Seeds = []Peer{{Addr: "localhost", Port: "9"}}
+		})
+		defer b.Stop() // nolint: errcheck
+
+		Expect(get(healthRoute)).To(Equal(http.StatusOK))
+		Expect(get(readinessRoute)).To(Equal(http.StatusServiceUnavailable))
+
+		Expect(b.AddPeer("localhost", "2")).To(Succeed())
+		Expect(get(readinessRoute)).To(Equal(http.StatusOK))
+	})
+
+	It("is not ready until it synced with a peer, with ReadyAfterSync", func() {
+		b := startTestNode("1", withTransport(transport), func(cfg *Config) {
+			cfg.Seeds = []Peer{{Addr: "localhost", Port: "2"}}
+			cfg.ReadyAfterSync = true
+		})
+		defer b.Stop() // nolint: errcheck
+
+		// the seed isn't running yet
+		Expect(b.AddPeer("localhost", "2")).To(Succeed())
+		Consistently(func() int {
+			return get(readinessRoute)
+		}, time.Millisecond*200).Should(Equal(http.StatusServiceUnavailable))
+
+		seed := newTestNode("2", withTransport(transport))
+		Expect(seed.AddMessage("synced message", NOCALLBACK)).To(Succeed())
+		Expect(seed.Start()).To(Succeed())
+		defer seed.Stop() // nolint: errcheck
+
+		Eventually(func() int {
+			return get(readinessRoute)
+		}, time.Second*15).Should(Equal(http.StatusOK))
+		Expect(b.GetMessages()).To(ContainElement("synced message"))
+	})
+
+	It("returns the status of the node", func() {
+		receiver := startTestNode("1", withTransport(transport))
+		defer receiver.Stop() // nolint: errcheck
+
+		sender := startTestNode("2", withTransport(transport))
+		defer sender.Stop() // nolint: errcheck
+
+		Expect(sender.AddPeer("localhost", "1")).To(Succeed())
+		Expect(sender.AddMessage("status message", NOCALLBACK)).To(Succeed())
+
+		Eventually(func() map[string]time.Time {
+			return sender.Status().LastGossip
+		}, time.Second*5).Should(HaveKey("localhost:1"))
+
+		s := sender.Status()
+		Expect(s.State).To(Equal(RunningState))
+		Expect(s.Ready).To(BeTrue())
+		Expect(s.Peers).To(Equal(1))
+		Expect(s.Messages).To(BeNumerically(">=", 1))
+		Expect(s.Uptime).To(BeNumerically(">", 0))
+	})
+})
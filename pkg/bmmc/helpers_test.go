@@ -0,0 +1,74 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// newTestNode creates a node on given port of localhost, over an in-memory
+// transport, with a small buffer and short gossip rounds. The options set the
+// fields of the config exercised by a test.
+func newTestNode(port string, opts ...func(*Config)) *BMMC {
+	cfg := &Config{
+		Addr:          "localhost",
+		Port:          port,
+		BufferSize:    16,
+		RoundDuration: time.Millisecond * 20,
+		Transport:     NewMemoryTransport(),
+		Logger:        log.New(ioutil.Discard, "", 0),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	b, err := New(cfg)
+	Expect(err).To(Succeed())
+
+	return b
+}
+
+// startTestNode creates a node like newTestNode and starts it.
+func startTestNode(port string, opts ...func(*Config)) *BMMC {
+	b := newTestNode(port, opts...)
+	Expect(b.Start()).To(Succeed())
+
+	return b
+}
+
+// withTransport makes a test node use given transport, e.g. the in-memory
+// transport shared by the nodes of a test.
+func withTransport(transport Transport) func(*Config) {
+	return func(cfg *Config) {
+		cfg.Transport = transport
+	}
+}
+
+// overHTTP makes a test node serve over HTTP on a free port of localhost,
+// instead of an in-memory transport.
+func overHTTP(cfg *Config) {
+	port, err := freePort()
+	Expect(err).To(Succeed())
+
+	cfg.Port = port
+	cfg.Transport = nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bufio"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the buckets of latency histograms.
+var latencyBuckets = []time.Duration{ // nolint: gochecknoglobals
+	time.Millisecond,
+	time.Millisecond * 5,
+	time.Millisecond * 10,
+	time.Millisecond * 25,
+	time.Millisecond * 50,
+	time.Millisecond * 100,
+	time.Millisecond * 250,
+	time.Millisecond * 500,
+	time.Second,
+	time.Second * 5,
+	time.Second * 10,
+}
+
+// HistogramBucket is a bucket of a histogram.
+type HistogramBucket struct {
+	// UpperBound is the inclusive upper bound of the bucket
+	UpperBound time.Duration
+	// Count is the number of observations less than or equal to UpperBound
+	Count int64
+}
+
+// Histogram is a snapshot of the distribution of some durations.
+type Histogram struct {
+	// Buckets are cumulative, ordered by their upper bound
+	Buckets []HistogramBucket
+	// Count is the number of observations
+	Count int64
+	// Sum is the sum of the observations
+	Sum time.Duration
+}
+
+// histogram keeps the distribution of some durations in latencyBuckets.
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    time.Duration
+	mux    sync.Mutex
+}
+
+// newHistogram creates an empty histogram.
+func newHistogram() *histogram {
+	return &histogram{
+		counts: make([]int64, len(latencyBuckets)),
+	}
+}
+
+// observe adds given duration in histogram.
+func (h *histogram) observe(d time.Duration) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	for i, bound := range latencyBuckets {
+		if d <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+
+	h.count++
+	h.sum += d
+}
+
+// snapshot returns the cumulative buckets of histogram.
+func (h *histogram) snapshot() Histogram {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	s := Histogram{
+		Buckets: make([]HistogramBucket, len(latencyBuckets)),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+
+	cumulative := int64(0)
+
+	for i, bound := range latencyBuckets {
+		cumulative += h.counts[i]
+		s.Buckets[i] = HistogramBucket{UpperBound: bound, Count: cumulative}
+	}
+
+	return s
+}
+
+// writeHistogram writes given histogram in w, in the Prometheus text format.
+func writeHistogram(w *bufio.Writer, name, help string, h Histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+
+	for _, bucket := range h.Buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, bucket.UpperBound.Seconds(), bucket.Count)
+	}
+
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %g\n%s_count %d\n", name, h.Count, name, h.Sum.Seconds(), name, h.Count)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bufio"
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Histogram", func() {
+	It("counts the observations in cumulative buckets", func() {
+		h := newHistogram()
+		h.observe(time.Millisecond)
+		h.observe(time.Millisecond * 20)
+		h.observe(time.Minute)
+
+		s := h.snapshot()
+		Expect(s.Count).To(Equal(int64(3)))
+		Expect(s.Sum).To(Equal(time.Minute + time.Millisecond*21))
+		Expect(s.Buckets).To(HaveLen(len(latencyBuckets)))
+		Expect(s.Buckets[0]).To(Equal(HistogramBucket{UpperBound: time.Millisecond, Count: 1}))
+		Expect(s.Buckets[3]).To(Equal(HistogramBucket{UpperBound: time.Millisecond * 25, Count: 2}))
+		Expect(s.Buckets[len(s.Buckets)-1].Count).To(Equal(int64(2)))
+	})
+
+	It("is written in the Prometheus text format", func() {
+		h := newHistogram()
+		h.observe(time.Millisecond * 2)
+
+		var buf bytes.Buffer
+
+		w := bufio.NewWriter(&buf)
+		writeHistogram(w, "latency_seconds", "Latencies.", h.snapshot())
+		Expect(w.Flush()).To(Succeed())
+
+		Expect(buf.String()).To(ContainSubstring("# TYPE latency_seconds histogram\n"))
+		Expect(buf.String()).To(ContainSubstring("latency_seconds_bucket{le=\"0.001\"} 0\n"))
+		Expect(buf.String()).To(ContainSubstring("latency_seconds_bucket{le=\"0.005\"} 1\n"))
+		Expect(buf.String()).To(ContainSubstring("latency_seconds_bucket{le=\"+Inf\"} 1\n"))
+		Expect(buf.String()).To(ContainSubstring("latency_seconds_sum 0.002\nlatency_seconds_count 1\n"))
+	})
+})
@@ -0,0 +1,100 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// hlcLogicalBits is the number of low bits of a HLC timestamp kept for the logical counter
+const hlcLogicalBits = 16
+
+// HLCTimestamp is a hybrid logical clock timestamp: the wall time in
+// milliseconds in the high bits and a logical counter in the low 16 bits.
+// Timestamps of causally related messages are ordered, even if the wall
+// clocks of their nodes are skewed.
+type HLCTimestamp uint64
+
+// newHLCTimestamp creates a HLCTimestamp with given wall time and no logical counter.
+func newHLCTimestamp(t time.Time) HLCTimestamp {
+	return HLCTimestamp(uint64(t.UnixNano()/int64(time.Millisecond)) << hlcLogicalBits)
+}
+
+// Time returns the wall time of the timestamp.
+func (t HLCTimestamp) Time() time.Time {
+	ms := int64(t >> hlcLogicalBits)
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// Logical returns the logical counter of the timestamp.
+func (t HLCTimestamp) Logical() uint16 {
+	return uint16(t)
+}
+
+// String returns the wall time and the logical counter of the timestamp.
+func (t HLCTimestamp) String() string {
+	return fmt.Sprintf("%s+%d", t.Time().UTC().Format(time.RFC3339Nano), t.Logical())
+}
+
+// hybridClock is the hybrid logical clock of a node. It never goes backwards
+// and it is always after the timestamps of the received messages.
+type hybridClock struct {
+	last HLCTimestamp
+	now  func() time.Time
+	mux  sync.Mutex
+}
+
+// newHybridClock creates a hybridClock on the wall clock.
+func newHybridClock() *hybridClock {
+	return &hybridClock{now: time.Now}
+}
+
+// tick returns a new timestamp for a local event.
+func (c *hybridClock) tick() HLCTimestamp {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.advance(c.last + 1)
+
+	return c.last
+}
+
+// update moves the clock after the timestamp of a received message.
+func (c *hybridClock) update(remote HLCTimestamp) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.advance(remote + 1)
+}
+
+// advance sets the clock to the latest of given timestamp and the wall clock.
+func (c *hybridClock) advance(t HLCTimestamp) {
+	if wall := newHLCTimestamp(c.now()); wall > t {
+		t = wall
+	}
+
+	if t > c.last {
+		c.last = t
+	}
+}
+
+// Clock returns a new timestamp of the hybrid logical clock of the node.
+func (b *BMMC) Clock() HLCTimestamp {
+	return b.clock.tick()
+}
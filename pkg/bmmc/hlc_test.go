@@ -0,0 +1,99 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Hybrid logical clock", func() {
+	var (
+		clock *hybridClock
+		wall  time.Time
+	)
+
+	BeforeEach(func() {
+		wall = time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+		clock = &hybridClock{now: func() time.Time { return wall }}
+	})
+
+	It("keeps the wall time and the logical counter", func() {
+		t := newHLCTimestamp(wall) + 3
+		Expect(t.Time().Equal(wall)).To(BeTrue())
+		Expect(t.Logical()).To(Equal(uint16(3)))
+	})
+
+	It("never goes backwards", func() {
+		first := clock.tick()
+		Expect(first.Time().Equal(wall)).To(BeTrue())
+
+		wall = wall.Add(-time.Second)
+		second := clock.tick()
+		Expect(second).To(BeNumerically(">", first))
+		Expect(second.Logical()).To(Equal(uint16(1)))
+
+		wall = wall.Add(time.Minute)
+		third := clock.tick()
+		Expect(third.Time().Equal(wall)).To(BeTrue())
+		Expect(third.Logical()).To(BeZero())
+	})
+
+	It("moves after the timestamps of received messages", func() {
+		remote := newHLCTimestamp(wall.Add(time.Second)) + 5
+
+		clock.update(remote)
+		Expect(clock.tick()).To(BeNumerically(">", remote))
+	})
+
+	It("stamps the added and the synchronized messages", func() {
+		b, err := New(&Config{
+			Addr:          "localhost",
+			Port:          "1",
+			BufferSize:    16,
+			RoundDuration: 20 * time.Millisecond,
+			Transport:     NewMemoryTransport(),
+			Logger:        log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+
+		elements, err := b.addMessage(context.Background(), "local", "my-callback")
+		Expect(err).To(Succeed())
+
+		local, err := b.GetMessage(elements[0].ID)
+		Expect(err).To(Succeed())
+		Expect(local.HLC).NotTo(BeZero())
+
+		remote := newHLCTimestamp(time.Now().Add(time.Hour))
+		b.syncElement(buffer.Element{
+			ID:           "remote-message",
+			Timestamp:    time.Now(),
+			Msg:          "remote",
+			CallbackType: "my-callback",
+			HLC:          uint64(remote),
+		}, "localhost", "2")
+
+		Expect(b.Clock()).To(BeNumerically(">", remote))
+	})
+})
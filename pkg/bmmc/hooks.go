@@ -0,0 +1,222 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+// PeerEvent is the addition or the removal of a peer.
+type PeerEvent struct {
+	// Peer is the added or removed peer, with its last known roles
+	Peer Peer
+	// Peers is the number of peers after the event
+	Peers int
+	// Time is the time of the event
+	Time time.Time
+}
+
+// SendErrorEvent is a request to a peer which failed or was answered with a
+// server error.
+type SendErrorEvent struct {
+	// Peer is the peer to which the request was sent
+	Peer Peer
+	// Route is the protocol endpoint of the request, e.g. /gossip
+	Route string
+	// ConsecutiveFailures is the number of requests to the peer which failed
+	// in a row, including this one
+	ConsecutiveFailures int
+	// Err is the cause of the failure
+	Err error
+	// Time is the time of the event
+	Time time.Time
+}
+
+// hookKind is the kind of events observed by a hook.
+type hookKind int
+
+const (
+	peerAddedHook hookKind = iota
+	peerRemovedHook
+	roundCompleteHook
+	messageDeliveredHook
+	sendErrorHook
+)
+
+// hook is an observer of the events of a kind.
+type hook struct {
+	id int
+	fn interface{}
+}
+
+// hooks keeps the observers of the node events, in the order in which they
+// were added.
+type hooks struct {
+	next  int
+	hooks map[hookKind][]hook
+	mux   sync.RWMutex
+}
+
+// newHooks creates a hooks without observers.
+func newHooks() *hooks {
+	return &hooks{
+		hooks: map[hookKind][]hook{},
+	}
+}
+
+// add adds given observer of the events of given kind and returns the func
+// which removes it.
+func (h *hooks) add(kind hookKind, fn interface{}) func() {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	id := h.next
+	h.next++
+
+	h.hooks[kind] = append(h.hooks[kind], hook{id: id, fn: fn})
+
+	return func() {
+		h.mux.Lock()
+		defer h.mux.Unlock()
+
+		for i, o := range h.hooks[kind] {
+			if o.id == id {
+				h.hooks[kind] = append(h.hooks[kind][:i:i], h.hooks[kind][i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// has returns true if there are observers of the events of given kind.
+func (h *hooks) has(kind hookKind) bool {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+
+	return len(h.hooks[kind]) > 0
+}
+
+// list returns the observers of the events of given kind.
+func (h *hooks) list(kind hookKind) []interface{} {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+
+	fns := make([]interface{}, len(h.hooks[kind]))
+	for i, o := range h.hooks[kind] {
+		fns[i] = o.fn
+	}
+
+	return fns
+}
+
+// OnPeerAdded adds an observer which is called with each peer added in peers
+// buffer, e.g. when a peer joins or is discovered. It returns the func which
+// removes the observer. The observers are called synchronously, so they must
+// not block.
+func (b *BMMC) OnPeerAdded(fn func(PeerEvent)) func() {
+	return b.hooks.add(peerAddedHook, fn)
+}
+
+// OnPeerRemoved adds an observer which is called with each peer removed from
+// peers buffer, e.g. when a peer leaves, is dead or is evicted. It returns the
+// func which removes the observer. See OnPeerAdded.
+func (b *BMMC) OnPeerRemoved(fn func(PeerEvent)) func() {
+	return b.hooks.add(peerRemovedHook, fn)
+}
+
+// OnRoundComplete adds an observer which is called at the end of each gossip
+// round, with the peers gossiped to and the duration of the round. It returns
+// the func which removes the observer. See OnPeerAdded.
+func (b *BMMC) OnRoundComplete(fn func(RoundInfo)) func() {
+	return b.hooks.add(roundCompleteHook, fn)
+}
+
+// OnMessageDelivered adds an observer which is called with each message
+// delivered from peers, once, like OnDelivery. It returns the func which
+// removes the observer. See OnPeerAdded.
+func (b *BMMC) OnMessageDelivered(fn func(Message)) func() {
+	return b.hooks.add(messageDeliveredHook, fn)
+}
+
+// OnSendError adds an observer which is called with each request to a peer
+// which failed. It returns the func which removes the observer. See OnPeerAdded.
+func (b *BMMC) OnSendError(fn func(SendErrorEvent)) func() {
+	return b.hooks.add(sendErrorHook, fn)
+}
+
+// peerEvent returns the event of given peer, added or removed now.
+func (b *BMMC) peerEvent(p peer.Peer) PeerEvent {
+	return PeerEvent{
+		Peer: Peer{
+			Addr:  p.Addr(),
+			Port:  p.Port(),
+			Roles: b.peerRoles.get(p.Addr(), p.Port()),
+		},
+		Peers: b.peerBuffer.Length(),
+		Time:  time.Now(),
+	}
+}
+
+// notifyPeerAdded calls the observers of added peers.
+func (b *BMMC) notifyPeerAdded(p peer.Peer) {
+	if !b.hooks.has(peerAddedHook) {
+		return
+	}
+
+	e := b.peerEvent(p)
+
+	for _, fn := range b.hooks.list(peerAddedHook) {
+		fn.(func(PeerEvent))(e)
+	}
+}
+
+// notifyPeerRemoved calls the observers of removed peers.
+func (b *BMMC) notifyPeerRemoved(p peer.Peer) {
+	if !b.hooks.has(peerRemovedHook) {
+		return
+	}
+
+	e := b.peerEvent(p)
+
+	for _, fn := range b.hooks.list(peerRemovedHook) {
+		fn.(func(PeerEvent))(e)
+	}
+}
+
+// notifyRoundComplete calls the observers of completed rounds.
+func (b *BMMC) notifyRoundComplete(info RoundInfo) {
+	for _, fn := range b.hooks.list(roundCompleteHook) {
+		fn.(func(RoundInfo))(info)
+	}
+}
+
+// notifyMessageDelivered calls the observers of delivered messages.
+func (b *BMMC) notifyMessageDelivered(m Message) {
+	for _, fn := range b.hooks.list(messageDeliveredHook) {
+		fn.(func(Message))(m)
+	}
+}
+
+// notifySendError calls the observers of failed requests.
+func (b *BMMC) notifySendError(e SendErrorEvent) {
+	for _, fn := range b.hooks.list(sendErrorHook) {
+		fn.(func(SendErrorEvent))(e)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hooks", func() {
+	var (
+		transport *MemoryTransport
+		nodes     []*BMMC
+	)
+
+	start := func(b *BMMC) {
+		Expect(b.Start()).To(Succeed())
+
+		nodes = append(nodes, b)
+	}
+
+	BeforeEach(func() {
+		transport = NewMemoryTransport()
+		nodes = []*BMMC{}
+	})
+
+	AfterEach(func() {
+		for _, b := range nodes {
+			Expect(b.Stop()).To(Succeed())
+		}
+	})
+
+	It("notifies the added and removed peers", func() {
+		b := newTestNode("1", withTransport(transport))
+
+		var (
+			added   []PeerEvent
+			removed []PeerEvent
+		)
+
+		b.OnPeerAdded(func(e PeerEvent) { added = append(added, e) })
+		b.OnPeerRemoved(func(e PeerEvent) { removed = append(removed, e) })
+
+		Expect(b.AddPeer("localhost", "2")).To(Succeed())
+		Expect(b.RemovePeer("localhost", "2")).To(Succeed())
+
+		Expect(added).To(HaveLen(1))
+		Expect(added[0].Peer.Addr).To(Equal("localhost"))
+		Expect(added[0].Peer.Port).To(Equal("2"))
+		Expect(added[0].Peers).To(Equal(1))
+		Expect(added[0].Time).NotTo(BeZero())
+
+		Expect(removed).To(HaveLen(1))
+		Expect(removed[0].Peer.Port).To(Equal("2"))
+		Expect(removed[0].Peers).To(BeZero())
+	})
+
+	It("doesn't call the removed observers", func() {
+		b := newTestNode("1", withTransport(transport))
+
+		calls := 0
+		remove := b.OnPeerAdded(func(PeerEvent) { calls++ })
+
+		Expect(b.AddPeer("localhost", "2")).To(Succeed())
+		remove()
+		remove()
+		Expect(b.AddPeer("localhost", "3")).To(Succeed())
+
+		Expect(calls).To(Equal(1))
+	})
+
+	It("notifies the completed rounds and the delivered messages", func() {
+		sender := newTestNode("1", withTransport(transport))
+		receiver := newTestNode("2", withTransport(transport))
+
+		var (
+			mux       sync.Mutex
+			rounds    []RoundInfo
+			delivered []Message
+		)
+
+		sender.OnRoundComplete(func(info RoundInfo) {
+			mux.Lock()
+			defer mux.Unlock()
+
+			rounds = append(rounds, info)
+		})
+
+		receiver.OnMessageDelivered(func(m Message) {
+			mux.Lock()
+			defer mux.Unlock()
+
+			delivered = append(delivered, m)
+		})
+
+		start(sender)
+		start(receiver)
+		Expect(sender.AddPeer("localhost", "2")).To(Succeed())
+		Expect(sender.AddMessage("observed", NOCALLBACK)).To(Succeed())
+
+		Eventually(func() []Message {
+			mux.Lock()
+			defer mux.Unlock()
+
+			return delivered
+		}, time.Second*5).Should(HaveLen(1))
+
+		mux.Lock()
+		defer mux.Unlock()
+
+		Expect(delivered[0].Payload).To(Equal("observed"))
+		Expect(delivered[0].Origin).To(Equal("localhost:1"))
+
+		Expect(rounds).NotTo(BeEmpty())
+		Expect(rounds[0].Number).To(BeNumerically(">", 0))
+		Expect(rounds[0].Duration).To(BeNumerically(">", 0))
+	})
+
+	It("notifies the failed requests", func() {
+		b := newTestNode("1", withTransport(transport))
+
+		errs := make(chan SendErrorEvent, 16)
+		b.OnSendError(func(e SendErrorEvent) {
+			select {
+			case errs <- e:
+			default:
+			}
+		})
+
+		start(b)
+
+		// no node listens on port 2
+		Expect(b.AddPeer("localhost", "2")).To(Succeed())
+
+		var e SendErrorEvent
+		Eventually(errs, time.Second*5).Should(Receive(&e))
+
+		Expect(e.Peer.Addr).To(Equal("localhost"))
+		Expect(e.Peer.Port).To(Equal("2"))
+		Expect(e.Route).NotTo(BeEmpty())
+		Expect(e.ConsecutiveFailures).To(BeNumerically(">", 0))
+		Expect(e.Err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,135 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	httpBlobFetchErrFmt = "error at fetching blob %s from %s:%s: %w"
+	httpBlobStatusFmt   = "unexpected status %s"
+
+	blobIDParam = "id"
+)
+
+var (
+	errBlobMismatch = errors.New("blob doesn't match its reference")
+)
+
+func blobHTTPPath(addr, port, id string) string {
+	return fmt.Sprintf("%s?%s=%s", peerURL(addr, port, blobRoute), blobIDParam, url.QueryEscape(id))
+}
+
+// newBlobRef returns a reference to the given json encoded message.
+func newBlobRef(raw []byte) *buffer.BlobRef {
+	hash := sha256.Sum256(raw)
+
+	return &buffer.BlobRef{
+		Hash: hex.EncodeToString(hash[:]),
+		Size: len(raw),
+	}
+}
+
+// referenceBlobs replaces the messages greater than blob threshold with
+// references to them. Receivers fetch these messages from the blob endpoint.
+func (b *BMMC) referenceBlobs(elements []buffer.Element) []buffer.Element {
+	if b.config.BlobThreshold <= 0 {
+		return elements
+	}
+
+	refs := make([]buffer.Element, len(elements))
+
+	for i, el := range elements {
+		refs[i] = el
+
+		raw, err := json.Marshal(el.Msg)
+		if err != nil || len(raw) <= b.config.BlobThreshold {
+			continue
+		}
+
+		refs[i].Msg = nil
+		refs[i].Blob = newBlobRef(raw)
+	}
+
+	return refs
+}
+
+// fetchBlob fetches the referenced message of given element from given peer.
+func (b *BMMC) fetchBlob(el buffer.Element, addr, port string) (buffer.Element, error) {
+	resp, err := b.netClient.Get(blobHTTPPath(addr, port, el.ID))
+	if err != nil {
+		return el, fmt.Errorf(httpBlobFetchErrFmt, el.ID, addr, port, err)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return el, fmt.Errorf(httpBlobFetchErrFmt, el.ID, addr, port,
+			fmt.Errorf(httpBlobStatusFmt, resp.Status)) // nolint: goerr113
+	}
+
+	// don't read more than the referenced size
+	raw, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(el.Blob.Size)+1))
+	if err != nil {
+		return el, fmt.Errorf(httpBlobFetchErrFmt, el.ID, addr, port, err)
+	}
+
+	if *newBlobRef(raw) != *el.Blob {
+		return el, fmt.Errorf(httpBlobFetchErrFmt, el.ID, addr, port, errBlobMismatch)
+	}
+
+	if err := json.Unmarshal(raw, &el.Msg); err != nil {
+		return el, fmt.Errorf(httpBlobFetchErrFmt, el.ID, addr, port, err)
+	}
+
+	el.Blob = nil
+
+	return el, nil
+}
+
+func (b *BMMC) blobHandler(w http.ResponseWriter, r *http.Request) {
+	elements := b.messageBuffer.ElementsFromIDs([]string{r.URL.Query().Get(blobIDParam)})
+	if len(elements) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the blob must be encoded exactly as its reference
+	raw, err := json.Marshal(elements[0].Msg)
+	if err != nil {
+		b.logf(ServerComponent, ErrorLevel, blobHandlerErrLogFmt, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, err := w.Write(raw); err != nil {
+		b.logf(ServerComponent, ErrorLevel, blobHandlerErrLogFmt, err)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("HTTP Blob", func() {
+	Describe("referenceBlobs function", func() {
+		elements := []buffer.Element{
+			{ID: "small", Msg: "abc"},
+			{ID: "large", Msg: "abcdefghijklmnopqrstuvwxyz"},
+		}
+
+		It("doesn't change the elements when blob threshold is 0", func() {
+			b := &BMMC{config: &Config{}}
+			Expect(b.referenceBlobs(elements)).To(Equal(elements))
+		})
+
+		It("replaces the messages greater than blob threshold with references", func() {
+			b := &BMMC{config: &Config{BlobThreshold: 10}}
+
+			refs := b.referenceBlobs(elements)
+			Expect(refs[0]).To(Equal(elements[0]))
+			Expect(refs[1].ID).To(Equal("large"))
+			Expect(refs[1].Msg).To(BeNil())
+			Expect(refs[1].Blob).To(Equal(newBlobRef([]byte(`"abcdefghijklmnopqrstuvwxyz"`))))
+
+			// the given elements are not changed
+			Expect(elements[1].Msg).To(Equal("abcdefghijklmnopqrstuvwxyz"))
+		})
+	})
+})
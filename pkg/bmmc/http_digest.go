@@ -0,0 +1,68 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	httpDigestFetchErrFmt = "error at fetching digest from %s:%s: %w"
+	httpDigestStatusFmt   = "unexpected status %s"
+)
+
+// HTTPDigest is the digest of a node, returned by the digest endpoint.
+type HTTPDigest struct {
+	Version int      `json:"version,omitempty"`
+	Digest  []string `json:"digest"`
+}
+
+func digestHTTPPath(addr, port string) string {
+	return peerURL(addr, port, digestRoute)
+}
+
+// fetchDigest fetches the digest of given peer.
+func (b *BMMC) fetchDigest(addr, port string) ([]string, error) {
+	resp, err := b.netClient.Get(digestHTTPPath(addr, port))
+	if err != nil {
+		return nil, fmt.Errorf(httpDigestFetchErrFmt, addr, port, err)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(httpDigestFetchErrFmt, addr, port,
+			fmt.Errorf(httpDigestStatusFmt, resp.Status)) // nolint: goerr113
+	}
+
+	var t HTTPDigest
+
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return nil, fmt.Errorf(httpDigestFetchErrFmt, addr, port, err)
+	}
+
+	return t.Digest, nil
+}
+
+func (b *BMMC) digestHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(HTTPDigest{Version: ProtocolVersion, Digest: b.messageBuffer.Digest()}); err != nil {
+		b.logf(ServerComponent, ErrorLevel, digestHandlerErrLogFmt, err)
+	}
+}
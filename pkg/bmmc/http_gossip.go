@@ -17,10 +17,11 @@ limitations under the License.
 package bmmc
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"sync/atomic"
 )
 
 const (
@@ -31,43 +32,88 @@ const (
 
 // HTTPGossip is gossip message for http server.
 type HTTPGossip struct {
-	Addr        string       `json:"addr"`
-	Port        string       `json:"port"`
+	Envelope
+	Capabilities []string `json:"capabilities,omitempty"`
+	Addr         string   `json:"addr"`
+	Port         string   `json:"port"`
+	Roles        Role     `json:"roles,omitempty"`
+	// Topics are the topics received by the sender, if it doesn't receive all topics
+	Topics      []string     `json:"topics,omitempty"`
 	RoundNumber *GossipRound `json:"roundNumber"`
 	Digest      []string     `json:"digest"`
+	// Bloom replaces the digest, when it is large and the peer supports it
+	Bloom *HTTPDigestBloom `json:"bloom,omitempty"`
+	// Peers is a random sample of the peers known by the sender
+	Peers []HTTPJoinPeer `json:"peers,omitempty"`
+	// Coordinate is the network coordinate of the sender
+	Coordinate *Coordinate `json:"coordinate,omitempty"`
+	// PushPull asks the receiver to answer with a gossip reply (see HTTPGossipReply)
+	PushPull bool `json:"pushPull,omitempty"`
 }
 
 func gossipHTTPPath(addr, port string) string {
-	return fmt.Sprintf("http://%s:%s%s", addr, port, gossipRoute)
+	return peerURL(addr, port, gossipRoute)
 }
 
 // receiveGossip receives a HTPP gossip message.
-func (b *BMMC) receiveGossip(r *http.Request) ([]string, string, string, *GossipRound, error) {
+func (b *BMMC) receiveGossip(r *http.Request) (HTTPGossip, error) {
 	var t HTTPGossip
 
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&t); err != nil {
-		return nil, "", "", nil, fmt.Errorf(httpGossipDecodingErrFmt, err)
+	if err := decodeWireMessage(r, gossipShims, &t); err != nil {
+		return t, fmt.Errorf(httpGossipDecodingErrFmt, err)
 	}
 
-	return t.Digest, t.Addr, t.Port, t.RoundNumber, nil
+	atomic.AddInt64(&b.counters.gossipsReceived, 1)
+
+	// peers which don't announce their roles have the default roles
+	if t.Roles == 0 {
+		t.Roles = DefaultRoles
+	}
+
+	return t, nil
 }
 
 // sendGossip sends a HTTP gossip message.
-func (b *BMMC) sendGossip(gossipMsg HTTPGossip, addr, port string) error {
-	jsonGossip, err := json.Marshal(gossipMsg)
+func (b *BMMC) sendGossip(ctx context.Context, gossipMsg HTTPGossip, addr, port string) error {
+	body, contentType, err := b.marshalMessage(gossipMsg, addr, port)
 	if err != nil {
 		return fmt.Errorf(httpGossipMarshalErrFmt, gossipMsg.Addr, gossipMsg.Port, err)
 	}
 
-	go func() {
-		resp, err := b.netClient.Post(gossipHTTPPath(addr, port), "json", bytes.NewBuffer(jsonGossip))
+	atomic.AddInt64(&b.counters.gossipsSent, 1)
+
+	b.spawn(func() {
+		ctx, span := b.startPeerSpan(ctx, GossipSpan, addr, port)
+
+		var err error
+		defer func() { span.End(err) }()
+
+		req, err := b.newRequest(ctx, gossipHTTPPath(addr, port), addr, port, func(w io.Writer) error {
+			_, err := w.Write(body)
+			return err
+		})
+		if err != nil {
+			b.logf(GossipComponent, WarnLevel, httpGossipSendLogFmt, gossipMsg.Addr, gossipMsg.Port, err)
+			return
+		}
+
+		req.Header.Set("Content-Type", contentType)
+
+		resp, err := b.netClient.Do(req)
 		if err != nil {
-			b.config.Logger.Printf(httpGossipSendLogFmt, gossipMsg.Addr, gossipMsg.Port, err)
+			b.logf(GossipComponent, WarnLevel, httpGossipSendLogFmt, gossipMsg.Addr, gossipMsg.Port, err)
 			return
 		}
 		defer resp.Body.Close() // nolint:errcheck
-	}()
+
+		if !gossipMsg.PushPull || resp.StatusCode != http.StatusOK {
+			return
+		}
+
+		if err = b.receiveGossipReply(ctx, resp.Body, addr, port); err != nil {
+			b.logf(GossipComponent, WarnLevel, httpGossipSendLogFmt, gossipMsg.Addr, gossipMsg.Port, err)
+		}
+	})
 
 	return nil
 }
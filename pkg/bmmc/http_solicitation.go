@@ -17,10 +17,11 @@ limitations under the License.
 package bmmc
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"sync/atomic"
 )
 
 const (
@@ -31,43 +32,67 @@ const (
 
 // HTTPSolicitation is solicitation message for http server.
 type HTTPSolicitation struct {
+	Envelope
 	Addr        string       `json:"addr"`
 	Port        string       `json:"port"`
 	RoundNumber *GossipRound `json:"roundNumber"`
 	Digest      []string     `json:"digest"`
+	// Bloom solicits the messages which are not in it, instead of the digest
+	Bloom *HTTPDigestBloom `json:"bloom,omitempty"`
 }
 
 func solicitationHTTPPath(addr, port string) string {
-	return fmt.Sprintf("http://%s:%s%s", addr, port, solicitationRoute)
+	return peerURL(addr, port, solicitationRoute)
 }
 
 // receiveSolicitation receives http solicitation message.
-func (b *BMMC) receiveSolicitation(r *http.Request) ([]string, string, string, *GossipRound, error) {
+func (b *BMMC) receiveSolicitation(r *http.Request) (HTTPSolicitation, error) {
 	var t HTTPSolicitation
 
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&t); err != nil {
-		return nil, "", "", nil, fmt.Errorf(httpSolicitationDecodingErrFmt, err)
+	if err := decodeWireMessage(r, nil, &t); err != nil {
+		return t, fmt.Errorf(httpSolicitationDecodingErrFmt, err)
 	}
 
-	return t.Digest, t.Addr, t.Port, t.RoundNumber, nil
+	atomic.AddInt64(&b.counters.solicitationsReceived, 1)
+
+	return t, nil
 }
 
 // sendSolicitation send http solicitation message.
-func (b *BMMC) sendSolicitation(solicitation HTTPSolicitation, addr, port string) error {
-	jsonSolicitation, err := json.Marshal(solicitation)
+func (b *BMMC) sendSolicitation(ctx context.Context, solicitation HTTPSolicitation, addr, port string) error {
+	body, contentType, err := b.marshalMessage(solicitation, addr, port)
 	if err != nil {
 		return fmt.Errorf(httpSolicitationMarshalErrFmt, err)
 	}
 
-	go func() {
-		resp, err := b.netClient.Post(solicitationHTTPPath(addr, port), "json", bytes.NewBuffer(jsonSolicitation))
+	b.loss.solicit(solicitation.Digest)
+	atomic.AddInt64(&b.counters.solicitationsSent, 1)
+
+	b.spawn(func() {
+		ctx, span := b.startPeerSpan(ctx, SolicitationSpan, addr, port)
+
+		var err error
+		defer func() { span.End(err) }()
+
+		req, err := b.newRequest(ctx, solicitationHTTPPath(addr, port), addr, port,
+			func(w io.Writer) error {
+				_, err := w.Write(body)
+				return err
+			})
+		if err != nil {
+			b.logf(GossipComponent, WarnLevel, httpSolicitationSendLogFmt, err)
+			return
+		}
+
+		req.Header.Set("Content-Type", contentType)
+
+		resp, err := b.netClient.Do(req)
 		if err != nil {
-			b.config.Logger.Printf(httpSolicitationSendLogFmt, err)
+			b.logf(GossipComponent, WarnLevel, httpSolicitationSendLogFmt, err)
 			return
 		}
 		defer resp.Body.Close() // nolint:errcheck
-	}()
+	})
 
 	return nil
 }
@@ -0,0 +1,245 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	syncRoute = "/sync"
+
+	defaultSyncPageSize      = 256
+	defaultFullSyncThreshold = 64
+
+	bulkSyncErrFmt        = "error at syncing with %s:%s: %w"
+	httpSyncStatusFmt     = "unexpected status %s"
+	syncHandlerErrLogFmt  = "Error in sync handler: %s"
+	bulkSyncLogErrFmt     = "BMMC %s:%s could not sync with %s:%s: %s"
+	bulkSyncLogFmt        = "BMMC %s:%s synced %d messages with %s:%s"
+	bannedSyncPeerErrFmt  = "peer %s is banned"
+	httpSyncDecodeErrFmt  = "error at decoding http sync response: %w"
+	httpSyncMarshalErrFmt = "error at marshal http sync request: %w"
+)
+
+// HTTPSyncRequest is the request of a page of messages in a bulk
+// synchronization. The messages are sent in the response, as a synchronization
+// message (see HTTPSynchronization).
+type HTTPSyncRequest struct {
+	Envelope
+	Addr string `json:"addr"`
+	Port string `json:"port"`
+	// Digest contains the IDs of the requested messages
+	Digest []string `json:"digest"`
+}
+
+func syncHTTPPath(addr, port string) string {
+	return peerURL(addr, port, syncRoute)
+}
+
+// SyncWith fetches the digest of given peer and pulls all the messages missing
+// from this node in bulk, in pages of SyncPageSize messages, instead of
+// soliciting them round by round. It returns the number of synced messages.
+func (b *BMMC) SyncWith(ctx context.Context, addr, port string) (int, error) {
+	digest, err := b.fetchDigest(addr, port)
+	if err != nil {
+		return 0, fmt.Errorf(bulkSyncErrFmt, addr, port, err)
+	}
+
+	return b.pullMissing(ctx, addr, port, b.missingFrom(digest))
+}
+
+// pullMissing pulls given messages from given peer, page by page. It returns
+// the number of synced messages.
+func (b *BMMC) pullMissing(ctx context.Context, addr, port string, missing []string) (int, error) {
+	if b.bans.isBanned(addr, port) {
+		return 0, fmt.Errorf(bulkSyncErrFmt, addr, port, fmt.Errorf(bannedSyncPeerErrFmt, fullHost(addr, port))) // nolint: goerr113
+	}
+
+	synced := 0
+
+	for len(missing) > 0 {
+		n := len(missing)
+		if n > b.config.SyncPageSize {
+			n = b.config.SyncPageSize
+		}
+
+		received, err := b.pullPage(ctx, addr, port, missing[:n])
+		synced += received
+
+		if err != nil {
+			return synced, fmt.Errorf(bulkSyncErrFmt, addr, port, err)
+		}
+
+		missing = missing[n:]
+	}
+
+	b.touchPeer(addr, port)
+
+	return synced, nil
+}
+
+// pullPage requests given messages from given peer and syncs the messages
+// received in the response. It returns the number of synced messages.
+func (b *BMMC) pullPage(ctx context.Context, addr, port string, digest []string) (int, error) {
+	req, err := b.newRequest(ctx, syncHTTPPath(addr, port), addr, port, func(w io.Writer) error {
+		if err := json.NewEncoder(w).Encode(HTTPSyncRequest{
+			Envelope: b.envelope(),
+			Addr:     b.config.Addr,
+			Port:     b.config.Port,
+			Digest:   digest,
+		}); err != nil {
+			return fmt.Errorf(httpSyncMarshalErrFmt, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := b.netClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf(httpSyncStatusFmt, resp.Status) // nolint: goerr113
+	}
+
+	synced := 0
+
+	// messages sent out of band are fetched after the page is received
+	blobs := []buffer.Element{}
+
+	_, err = readSynchronization(resp.Body, func(_, _ string, m buffer.Element) {
+		if !b.acceptSynced(m) {
+			return
+		}
+
+		if m.Blob != nil {
+			blobs = append(blobs, m)
+			return
+		}
+
+		b.syncElement(m, b.config.Addr, b.config.Port)
+		synced++
+	})
+	if err != nil {
+		return synced, fmt.Errorf(httpSyncDecodeErrFmt, err)
+	}
+
+	atomic.AddInt64(&b.counters.synchronizationsReceived, 1)
+
+	for _, ref := range blobs {
+		m, err := b.fetchBlob(ref, addr, port)
+		if err != nil {
+			return synced, err
+		}
+
+		b.syncElement(m, b.config.Addr, b.config.Port)
+		synced++
+	}
+
+	return synced, nil
+}
+
+// pullInBackground pulls given messages from given peer in background, if the
+// peer supports bulk synchronizations and no other bulk synchronization runs.
+// It returns false if the messages must be solicited instead.
+func (b *BMMC) pullInBackground(addr, port string, missing []string) bool {
+	if !b.peerProtocols.get(addr, port).has(capSyncBulk) {
+		return false
+	}
+
+	if !atomic.CompareAndSwapInt32(&b.pulling, 0, 1) {
+		return false
+	}
+
+	b.spawn(func() {
+		defer atomic.StoreInt32(&b.pulling, 0)
+
+		synced, err := b.pullMissing(b.runContext(), addr, port, missing)
+		if err != nil {
+			b.logf(GossipComponent, WarnLevel, bulkSyncLogErrFmt, b.config.Addr, b.config.Port, addr, port, err)
+			return
+		}
+
+		b.logf(GossipComponent, DebugLevel, bulkSyncLogFmt, b.config.Addr, b.config.Port, synced, addr, port)
+	})
+
+	return true
+}
+
+// syncHandler answers a page of a bulk synchronization with the requested
+// messages, in a synchronization message.
+func (b *BMMC) syncHandler(w http.ResponseWriter, r *http.Request) {
+	if !b.config.Roles.Has(StorageRole) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var t HTTPSyncRequest
+	if err := decodeMessage(r.Body, nil, &t); err != nil {
+		b.logf(ServerComponent, WarnLevel, syncHandlerErrLogFmt, err)
+		http.Error(w, err.Error(), bodyErrStatus(err))
+
+		return
+	}
+
+	if b.rejectSpoofedAddr(w, r, t.Addr, t.Port) {
+		return
+	}
+
+	if b.bans.isBanned(t.Addr, t.Port) {
+		b.logf(ServerComponent, WarnLevel, bannedPeerLogErrFmt, t.Addr, t.Port)
+		w.WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	b.touchPeer(t.Addr, t.Port)
+	b.identifyPeer(t.NodeID, t.Addr, t.Port)
+
+	digest := t.Digest
+	if len(digest) > b.config.SyncPageSize {
+		digest = digest[:b.config.SyncPageSize]
+	}
+
+	synchronization := HTTPSynchronization{
+		Envelope: b.envelope(),
+		Addr:     b.config.Addr,
+		Port:     b.config.Port,
+		Elements: b.messageBuffer.ElementsFromIDs(digest),
+	}
+
+	atomic.AddInt64(&b.counters.synchronizationsSent, 1)
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+
+	if err := writeSynchronization(b.throttle(r.Context(), w), synchronization); err != nil {
+		b.logf(ServerComponent, WarnLevel, syncHandlerErrLogFmt, err)
+	}
+}
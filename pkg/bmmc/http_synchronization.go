@@ -17,10 +17,12 @@ limitations under the License.
 package bmmc
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
 )
@@ -29,46 +31,263 @@ const (
 	httpSynchronizationDecodeErrFmt  = "error at decoding http synchronization message in HTTP Server: %w"
 	httpSynchronizationMarshalErrFmt = "error at marshal http synchronization message in HTTP Server: %w"
 	httpSynchronizationSendErrFmt    = "error at sending HTTPSynchronization message in HTTP Server: %s"
+	httpSynchronizationStatusFmt     = "unexpected status %s"
+
+	unexpectedTokenErrFmt = "unexpected token %v, expected %v"
 )
 
 // HTTPSynchronization is synchronization message for http server.
 type HTTPSynchronization struct {
+	Envelope
 	Addr     string           `json:"addr"`
 	Port     string           `json:"port"`
 	Elements []buffer.Element `json:"elements"`
+	// Continuation contains the IDs of solicited messages which were not sent
+	// because of synchronization limits. The receiver solicits them again.
+	Continuation []string `json:"continuation,omitempty"`
 }
 
 func synchronizationHTTPPath(addr, port string) string {
-	return fmt.Sprintf("http://%s:%s%s", addr, port, synchronizationRoute)
+	return peerURL(addr, port, synchronizationRoute)
+}
+
+// limitSynchronization splits given elements in elements which fit in a
+// synchronization message with given limits, and IDs of remaining elements.
+// A limit equal to 0 means no limit. At least one element is always kept,
+// so the synchronization makes progress.
+func limitSynchronization(elements []buffer.Element, maxMessages, maxBytes int) ([]buffer.Element, []string) {
+	n := len(elements)
+	if maxMessages > 0 && n > maxMessages {
+		n = maxMessages
+	}
+
+	if maxBytes > 0 {
+		size := 0
+
+		for i := 0; i < n; i++ {
+			// marshal errors are reported when the synchronization is sent
+			raw, _ := json.Marshal(elements[i]) // nolint: errcheck
+			size += len(raw)
+
+			if size > maxBytes && i > 0 {
+				n = i
+				break
+			}
+		}
+	}
+
+	continuation := make([]string, 0, len(elements)-n)
+	for _, el := range elements[n:] {
+		continuation = append(continuation, el.ID)
+	}
+
+	return elements[:n], continuation
 }
 
-// receiveSynchronization receives http solicitation message.
-func (b *BMMC) receiveSynchronization(r *http.Request) ([]buffer.Element, string, string, error) {
+// writeSynchronization encodes given synchronization message in w, element
+// by element, so the whole encoded message is never kept in memory.
+func writeSynchronization(w io.Writer, synchronization HTTPSynchronization) error {
+	enc := json.NewEncoder(w)
+
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{name: "version", value: synchronization.Version},
+		{name: "nodeId", value: synchronization.NodeID},
+		{name: "headers", value: synchronization.Headers},
+		{name: "addr", value: synchronization.Addr},
+		{name: "port", value: synchronization.Port},
+		{name: "continuation", value: synchronization.Continuation},
+	}
+
+	if _, err := io.WriteString(w, "{"); err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		if _, err := fmt.Fprintf(w, "%q:", f.name); err != nil {
+			return err
+		}
+
+		if err := enc.Encode(f.value); err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, ","); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, `"elements":[`); err != nil {
+		return err
+	}
+
+	for i := range synchronization.Elements {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+
+		if err := enc.Encode(synchronization.Elements[i]); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "]}")
+
+	return err
+}
+
+// expectDelim reads the next token from decoder and checks that it is given delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf(unexpectedTokenErrFmt, tok, delim) // nolint: goerr113
+	}
+
+	return nil
+}
+
+// readSynchronization decodes a synchronization message from r, element by
+// element. The onElement func is called with the sender decoded so far and
+// each decoded element, so the returned message doesn't contain any element.
+func readSynchronization(r io.Reader, onElement func(addr, port string, el buffer.Element)) (HTTPSynchronization, error) {
 	var t HTTPSynchronization
 
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&t); err != nil {
-		return nil, "", "", fmt.Errorf(httpSynchronizationDecodeErrFmt, err)
+	dec := json.NewDecoder(r)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return t, err
 	}
 
-	return t.Elements, t.Addr, t.Port, nil
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return t, err
+		}
+
+		switch tok {
+		case "version":
+			err = dec.Decode(&t.Version)
+		case "nodeId":
+			err = dec.Decode(&t.NodeID)
+		case "headers":
+			err = dec.Decode(&t.Headers)
+		case "addr":
+			err = dec.Decode(&t.Addr)
+		case "port":
+			err = dec.Decode(&t.Port)
+		case "continuation":
+			err = dec.Decode(&t.Continuation)
+		case "elements":
+			err = readElements(dec, func(el buffer.Element) {
+				onElement(t.Addr, t.Port, el)
+			})
+		default:
+			// skip unknown fields
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+
+		if err != nil {
+			return t, err
+		}
+	}
+
+	return t, expectDelim(dec, '}')
 }
 
-// sendSynchronization send http synchronization message.
-func (b *BMMC) sendSynchronization(synchronization HTTPSynchronization, addr, port string) error {
-	jsonSynchronization, err := json.Marshal(synchronization)
+// readElements decodes an array of elements, calling onElement for each of them.
+func readElements(dec *json.Decoder, onElement func(buffer.Element)) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		var el buffer.Element
+		if err := dec.Decode(&el); err != nil {
+			return err
+		}
+
+		onElement(el)
+	}
+
+	return expectDelim(dec, ']')
+}
+
+// receiveSynchronization receives http synchronization message.
+// The onElement func is called for each received element, as soon as it is decoded.
+func (b *BMMC) receiveSynchronization(r *http.Request,
+	onElement func(addr, port string, el buffer.Element)) (HTTPSynchronization, error) {
+	t, err := readSynchronization(r.Body, onElement)
 	if err != nil {
-		return fmt.Errorf(httpSynchronizationMarshalErrFmt, err)
+		return t, fmt.Errorf(httpSynchronizationDecodeErrFmt, err)
 	}
 
-	go func() {
-		resp, err := b.netClient.Post(synchronizationHTTPPath(addr, port), "json", bytes.NewBuffer(jsonSynchronization))
+	atomic.AddInt64(&b.counters.synchronizationsReceived, 1)
+
+	return t, nil
+}
+
+// sendSynchronization send http synchronization message.
+// The message is streamed to the peer, using chunked transfer encoding.
+func (b *BMMC) sendSynchronization(ctx context.Context, synchronization HTTPSynchronization, addr, port string) error {
+	atomic.AddInt64(&b.counters.synchronizationsSent, 1)
+
+	b.spawn(func() {
+		ctx, span := b.startPeerSpan(ctx, SynchronizationSpan, addr, port)
+
+		err := b.postSynchronization(ctx, synchronization, addr, port)
+		span.End(err)
+
 		if err != nil {
-			b.config.Logger.Printf(httpSynchronizationSendErrFmt, err)
+			b.logf(GossipComponent, WarnLevel, httpSynchronizationSendErrFmt, err)
 			return
 		}
-		defer resp.Body.Close() // nolint:errcheck
-	}()
+
+		b.acks.ack(addr, port, elementIDs(synchronization.Elements))
+	})
+
+	return nil
+}
+
+// postSynchronization streams http synchronization message to the peer and
+// waits until the peer handled it.
+func (b *BMMC) postSynchronization(ctx context.Context, synchronization HTTPSynchronization, addr, port string) error {
+	size := -1
+	if b.config.CompressionThreshold > 0 {
+		size = 0
+		for _, el := range synchronization.Elements {
+			size += el.Size()
+		}
+	}
+
+	req, err := b.newSizedRequest(ctx, synchronizationHTTPPath(addr, port), addr, port, size, func(w io.Writer) error {
+		if err := writeSynchronization(b.throttle(ctx, w), synchronization); err != nil {
+			return fmt.Errorf(httpSynchronizationMarshalErrFmt, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.netClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf(httpSynchronizationStatusFmt, resp.Status) // nolint: goerr113
+	}
 
 	return nil
 }
@@ -0,0 +1,108 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("HTTP Synchronization", func() {
+	elements := []buffer.Element{{ID: "first"}, {ID: "second"}, {ID: "third"}}
+
+	// size of first two elements
+	raw, err := json.Marshal(elements[:2])
+	if err != nil {
+		panic(err)
+	}
+
+	size := len(raw)
+
+	DescribeTable("limitSynchronization helper function",
+		func(maxMessages, maxBytes int, expectedElements []buffer.Element, expectedContinuation []string) {
+			el, continuation := limitSynchronization(elements, maxMessages, maxBytes)
+			Expect(el).To(Equal(expectedElements))
+			Expect(continuation).To(Equal(expectedContinuation))
+		},
+		Entry("keeps all elements when there are no limits",
+			0, 0, elements, []string{}),
+		Entry("keeps at most max messages",
+			2, 0, elements[:2], []string{"third"}),
+		Entry("keeps at most max bytes",
+			0, size, elements[:2], []string{"third"}),
+		Entry("keeps one element even if it is greater than max bytes",
+			0, 1, elements[:1], []string{"second", "third"}),
+	)
+
+	Describe("writeSynchronization and readSynchronization helper functions", func() {
+		It("stream the synchronization message element by element", func() {
+			msg := HTTPSynchronization{
+				Envelope:     newEnvelope(),
+				Addr:         "localhost",
+				Port:         "19999",
+				Elements:     elements,
+				Continuation: []string{"fourth"},
+			}
+
+			buf := &bytes.Buffer{}
+			Expect(writeSynchronization(buf, msg)).To(Succeed())
+
+			// the streamed message is a regular synchronization message
+			var decoded HTTPSynchronization
+			Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+			Expect(decoded).To(Equal(msg))
+
+			received := []buffer.Element{}
+			t, err := readSynchronization(bytes.NewReader(buf.Bytes()), func(addr, port string, el buffer.Element) {
+				// the sender is written before the elements
+				Expect(addr).To(Equal(msg.Addr))
+				Expect(port).To(Equal(msg.Port))
+				received = append(received, el)
+			})
+			Expect(err).To(Succeed())
+			Expect(received).To(Equal(elements))
+			Expect(t.Version).To(Equal(msg.Version))
+			Expect(t.Addr).To(Equal(msg.Addr))
+			Expect(t.Port).To(Equal(msg.Port))
+			Expect(t.Continuation).To(Equal(msg.Continuation))
+		})
+
+		It("skips unknown fields", func() {
+			raw := `{"unknown":{"a":[1,2]},"addr":"localhost","elements":[{"id":"first"}]}`
+
+			received := []buffer.Element{}
+			t, err := readSynchronization(strings.NewReader(raw), func(_, _ string, el buffer.Element) {
+				received = append(received, el)
+			})
+			Expect(err).To(Succeed())
+			Expect(t.Addr).To(Equal("localhost"))
+			Expect(received).To(HaveLen(1))
+		})
+
+		It("returns error when the message is not an object", func() {
+			_, err := readSynchronization(strings.NewReader(`[]`), func(string, string, buffer.Element) {})
+			Expect(err).NotTo(Succeed())
+		})
+	})
+})
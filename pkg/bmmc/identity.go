@@ -0,0 +1,153 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+// signedMessage is the part of a message covered by the signature of its origin.
+type signedMessage struct {
+	ID             string            `json:"id"`
+	Timestamp      string            `json:"timestamp"`
+	CallbackType   string            `json:"callback_type"`
+	Key            string            `json:"key"`
+	Origin         string            `json:"origin"`
+	HLC            uint64            `json:"hlc,omitempty"`
+	Codec          string            `json:"codec,omitempty"`
+	MaxGossipCount int64             `json:"max_gossip_count,omitempty"`
+	VectorClock    map[string]uint64 `json:"vector_clock,omitempty"`
+	Seq            uint64            `json:"seq,omitempty"`
+	SeqEpoch       int64             `json:"seq_epoch,omitempty"`
+	Priority       int               `json:"priority,omitempty"`
+	Msg            json.RawMessage   `json:"msg"`
+}
+
+// signedBytes returns the bytes of given element covered by the signature of
+// its origin. The message is encoded as it is decoded by peers, so struct
+// payloads and the maps decoded from them have the same signature.
+func signedBytes(el buffer.Element) ([]byte, error) {
+	raw, err := json.Marshal(el.Msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, err
+	}
+
+	if raw, err = json.Marshal(decoded); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(signedMessage{
+		ID:             el.ID,
+		Timestamp:      el.Timestamp.UTC().Format(time.RFC3339Nano),
+		CallbackType:   el.CallbackType,
+		Key:            el.Key,
+		Origin:         el.Origin,
+		HLC:            el.HLC,
+		Codec:          el.Codec,
+		MaxGossipCount: el.MaxGossipCount,
+		VectorClock:    el.VectorClock,
+		Seq:            el.Seq,
+		SeqEpoch:       el.SeqEpoch,
+		Priority:       el.Priority,
+		Msg:            raw,
+	})
+}
+
+// signElement signs given element with the identity key of the node.
+func (b *BMMC) signElement(el buffer.Element) (string, error) {
+	data, err := signedBytes(el)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(ed25519.Sign(b.config.IdentityKey, data)), nil
+}
+
+// identityKey returns the public key of given origin, or nil if it is unknown.
+func (b *BMMC) identityKey(origin string) ed25519.PublicKey {
+	if origin == fullHost(b.config.Addr, b.config.Port) && b.config.IdentityKey != nil {
+		return b.config.IdentityKey.Public().(ed25519.PublicKey)
+	}
+
+	return b.config.Identities[origin]
+}
+
+// verifiedSender returns the origin of given element if it is signed with the
+// identity key of its origin, or an empty string otherwise.
+func (b *BMMC) verifiedSender(el buffer.Element) string {
+	key := b.identityKey(el.Origin)
+	if key == nil || el.Signature == "" {
+		return ""
+	}
+
+	sig, err := hex.DecodeString(el.Signature)
+	if err != nil {
+		return ""
+	}
+
+	data, err := signedBytes(el)
+	if err != nil || !ed25519.Verify(key, data, sig) {
+		return ""
+	}
+
+	return el.Origin
+}
+
+// messageMAC returns the HMAC-SHA256 of given element with the message key.
+func (b *BMMC) messageMAC(el buffer.Element) (string, error) {
+	data, err := signedBytes(el)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, b.config.MessageKey)
+	mac.Write(data) // nolint: errcheck
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// authentic returns true if given message received from a peer is accepted:
+// it has a valid MAC if the node has a message key and a verified sender if
+// RequireSignedMessages is set.
+func (b *BMMC) authentic(el buffer.Element) bool {
+	if b.config.RequireSignedMessages && el.Sender == "" {
+		return false
+	}
+
+	if b.config.MessageKey == nil {
+		return true
+	}
+
+	expected, err := b.messageMAC(el)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(expected), []byte(el.MAC))
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"log"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Sender identity", func() {
+	var (
+		transport *MemoryTransport
+		pub       ed25519.PublicKey
+		priv      ed25519.PrivateKey
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		transport = NewMemoryTransport()
+
+		pub, priv, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).To(Succeed())
+	})
+
+	It("verifies the signatures of decoded payloads", func() {
+		b := &BMMC{config: &Config{Addr: "localhost", Port: "1", Identities: map[string]ed25519.PublicKey{"localhost:2": pub}}}
+		signer := &BMMC{config: &Config{Addr: "localhost", Port: "2", IdentityKey: priv}}
+
+		el := buffer.Element{
+			ID:        "id",
+			Timestamp: time.Now(),
+			Msg:       struct{ B, A int }{B: 1, A: 2},
+			Origin:    "localhost:2",
+		}
+
+		sig, err := signer.signElement(el)
+		Expect(err).To(Succeed())
+
+		el.Signature = sig
+		Expect(b.verifiedSender(el)).To(Equal("localhost:2"))
+
+		el.Msg = map[string]interface{}{"A": 2.0, "B": 1.0}
+		Expect(b.verifiedSender(el)).To(Equal("localhost:2"))
+
+		el.Msg = map[string]interface{}{"A": 3.0, "B": 1.0}
+		Expect(b.verifiedSender(el)).To(BeEmpty())
+
+		el.Msg = map[string]interface{}{"A": 2.0, "B": 1.0}
+		el.Origin = "localhost:3"
+		Expect(b.verifiedSender(el)).To(BeEmpty())
+	})
+
+	It("rejects the messages without a valid MAC or a verified sender", func() {
+		key := []byte("message key")
+		b := newTestNode("1", func(cfg *Config) {
+			cfg.MessageKey = key
+			cfg.Identities = map[string]ed25519.PublicKey{"localhost:2": pub}
+		})
+
+		var err error
+
+		signer := &BMMC{config: &Config{Addr: "localhost", Port: "2", IdentityKey: priv, MessageKey: key}}
+
+		newElement := func(id string) buffer.Element {
+			el := buffer.Element{
+				ID:           id,
+				Timestamp:    time.Now(),
+				Msg:          id,
+				CallbackType: NOCALLBACK,
+				Origin:       "localhost:2",
+			}
+
+			el.MAC, err = signer.messageMAC(el)
+			Expect(err).To(Succeed())
+
+			return el
+		}
+
+		b.syncElement(newElement("authenticated"), "localhost", "1")
+
+		forged := newElement("forged")
+		forged.Msg = "injected"
+		b.syncElement(forged, "localhost", "1")
+
+		Expect(b.GetMessages()).To(ConsistOf("authenticated"))
+		Expect(b.Stats().MessagesRejected).To(Equal(int64(1)))
+
+		// the messages must also be signed by their origin
+		b.config.RequireSignedMessages = true
+
+		b.syncElement(newElement("unsigned"), "localhost", "1")
+
+		signed := newElement("signed")
+		signed.Signature, err = signer.signElement(signed)
+		Expect(err).To(Succeed())
+		b.syncElement(signed, "localhost", "1")
+
+		Expect(b.GetMessages()).To(ConsistOf("authenticated", "signed"))
+		Expect(b.Stats().MessagesRejected).To(Equal(int64(2)))
+	})
+
+	It("gives the verified sender of messages to message callbacks", func() {
+		var (
+			senders []string
+			mux     sync.Mutex
+		)
+
+		callbacks := map[string]func(Message, *log.Logger) error{
+			"signed": func(m Message, _ *log.Logger) error {
+				mux.Lock()
+				defer mux.Unlock()
+
+				senders = append(senders, m.Sender)
+
+				return nil
+			},
+		}
+
+		getSenders := func() []string {
+			mux.Lock()
+			defer mux.Unlock()
+
+			return append([]string{}, senders...)
+		}
+
+		receiver := startTestNode("1", withTransport(transport), func(cfg *Config) {
+			cfg.Identities = map[string]ed25519.PublicKey{"localhost:2": pub}
+			cfg.MessageCallbacks = callbacks
+		})
+		defer receiver.Stop() // nolint: errcheck
+
+		sender := startTestNode("2", withTransport(transport), func(cfg *Config) {
+			cfg.IdentityKey = priv
+		})
+		defer sender.Stop() // nolint: errcheck
+
+		unsigned := startTestNode("3", withTransport(transport))
+		defer unsigned.Stop() // nolint: errcheck
+
+		Expect(sender.AddPeer("localhost", "1")).To(Succeed())
+		Expect(sender.AddMessage("signed message", "signed")).To(Succeed())
+
+		Eventually(getSenders, time.Second*5).Should(Equal([]string{"localhost:2"}))
+
+		Expect(unsigned.AddPeer("localhost", "1")).To(Succeed())
+		Expect(unsigned.AddMessage("unsigned message", "signed")).To(Succeed())
+
+		Eventually(getSenders, time.Second*5).Should(Equal([]string{"localhost:2", ""}))
+	})
+})
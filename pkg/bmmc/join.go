@@ -0,0 +1,212 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+const (
+	joinErrFmt        = "error at joining through %s:%s: %w"
+	httpJoinStatusFmt = "unexpected status %s"
+	joinHandlerLogFmt = "Error in join handler: %s"
+)
+
+// HTTPJoin is the join request sent by a newcomer.
+type HTTPJoin struct {
+	Envelope
+	Addr         string   `json:"addr"`
+	Port         string   `json:"port"`
+	Roles        Role     `json:"roles,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	Token        string   `json:"token,omitempty"`
+}
+
+// HTTPJoinPeer is a peer sent to a newcomer.
+type HTTPJoinPeer struct {
+	Addr string `json:"addr"`
+	Port string `json:"port"`
+}
+
+// HTTPJoinResponse is the state sent to a newcomer which joined.
+type HTTPJoinResponse struct {
+	Envelope
+	Peers        []HTTPJoinPeer `json:"peers"`
+	Capabilities []string       `json:"capabilities,omitempty"`
+	Digest       []string       `json:"digest"`
+}
+
+func joinHTTPPath(addr, port string) string {
+	return peerURL(addr, port, joinRoute)
+}
+
+// Join joins the cluster through given peer. The peer adds this node in its
+// peers buffer and gossips its arrival, and this node learns the peers, the
+// protocol capabilities and the messages of the peer.
+// The token is checked by peers which have a JoinToken.
+func (b *BMMC) Join(ctx context.Context, addr, port, token string) error {
+	req, err := b.newRequest(ctx, joinHTTPPath(addr, port), addr, port, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(HTTPJoin{
+			Envelope:     b.envelope(),
+			Addr:         b.config.Addr,
+			Port:         b.config.Port,
+			Roles:        b.config.Roles,
+			Capabilities: localCapabilities,
+			Token:        token,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf(joinErrFmt, addr, port, err)
+	}
+
+	resp, err := b.netClient.Do(req)
+	if err != nil {
+		return fmt.Errorf(joinErrFmt, addr, port, err)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf(joinErrFmt, addr, port,
+			fmt.Errorf(httpJoinStatusFmt, resp.Status)) // nolint: goerr113
+	}
+
+	var t HTTPJoinResponse
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return fmt.Errorf(joinErrFmt, addr, port, err)
+	}
+
+	b.peerProtocols.set(addr, port, t.Version, t.Capabilities)
+
+	self := fullHost(b.config.Addr, b.config.Port)
+	peers := append([]HTTPJoinPeer{{Addr: addr, Port: port}}, t.Peers...)
+
+	for _, jp := range peers {
+		if fullHost(jp.Addr, jp.Port) == self {
+			continue
+		}
+
+		p, err := peer.NewPeer(jp.Addr, jp.Port)
+		if err != nil {
+			continue
+		}
+
+		// peers which are already known are kept
+		b.peerBuffer.AddPeer(p) // nolint: errcheck
+	}
+
+	// pull the messages of the peer in bulk, or solicit them if it doesn't support it
+	if missingDigest := b.missingFrom(t.Digest); len(missingDigest) > 0 && !b.pullInBackground(addr, port, missingDigest) {
+		solicitationMsg := HTTPSolicitation{
+			Envelope:    b.envelope(),
+			Addr:        b.config.Addr,
+			Port:        b.config.Port,
+			RoundNumber: b.gossipRound,
+			Digest:      missingDigest,
+		}
+
+		if err := b.sendSolicitation(b.runContext(), solicitationMsg, addr, port); err != nil {
+			return fmt.Errorf(joinErrFmt, addr, port, err)
+		}
+	}
+
+	return nil
+}
+
+// isKnownPeer returns true if given peer is in peers buffer.
+func (b *BMMC) isKnownPeer(addr, port string) bool {
+	for _, p := range b.knownPeers() {
+		if p.Addr == addr && p.Port == port {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *BMMC) joinHandler(w http.ResponseWriter, r *http.Request) {
+	var t HTTPJoin
+	if err := decodeMessage(r.Body, nil, &t); err != nil {
+		b.logf(MembershipComponent, WarnLevel, joinHandlerLogFmt, err)
+		http.Error(w, err.Error(), bodyErrStatus(err))
+
+		return
+	}
+
+	if b.config.JoinToken != "" && subtle.ConstantTimeCompare([]byte(t.Token), []byte(b.config.JoinToken)) != 1 {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if b.rejectSpoofedAddr(w, r, t.Addr, t.Port) {
+		return
+	}
+
+	if b.bans.isBanned(t.Addr, t.Port) {
+		b.logf(MembershipComponent, WarnLevel, bannedPeerLogErrFmt, t.Addr, t.Port)
+		w.WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	if t.Roles == 0 {
+		t.Roles = DefaultRoles
+	}
+
+	// joins are handled one by one, so each newcomer learns the previous ones
+	b.joinMux.Lock()
+	defer b.joinMux.Unlock()
+
+	resp := HTTPJoinResponse{
+		Envelope:     b.envelope(),
+		Peers:        []HTTPJoinPeer{},
+		Capabilities: localCapabilities,
+		Digest:       b.messageBuffer.Digest(),
+	}
+
+	for _, p := range b.knownPeers() {
+		if p.Addr != t.Addr || p.Port != t.Port {
+			resp.Peers = append(resp.Peers, HTTPJoinPeer{Addr: p.Addr, Port: p.Port})
+		}
+	}
+
+	if !b.isKnownPeer(t.Addr, t.Port) {
+		if err := b.AddPeer(t.Addr, t.Port); err != nil {
+			b.logf(MembershipComponent, WarnLevel, joinHandlerLogFmt, err)
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	b.touchPeer(t.Addr, t.Port)
+	b.identifyPeer(t.NodeID, t.Addr, t.Port)
+	b.peerRoles.set(t.Addr, t.Port, t.Roles)
+	b.peerProtocols.set(t.Addr, t.Port, t.Version, t.Capabilities)
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		b.logf(MembershipComponent, WarnLevel, joinHandlerLogFmt, err)
+	}
+}
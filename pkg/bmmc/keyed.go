@@ -0,0 +1,105 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var (
+	errEmptyKey = errors.New("key must not be empty")
+)
+
+// Resolver decides which version of a keyed message wins, when a node receives
+// a candidate version of a message it already has. It returns true if the
+// candidate wins. Resolvers must give the same result on all nodes, so all
+// nodes keep the same version.
+type Resolver func(candidate, existing Message) bool
+
+// LastWriteWins is the default Resolver. The version with the newest timestamp
+// wins. Concurrent versions are ordered by the node which added them.
+func LastWriteWins(candidate, existing Message) bool {
+	if !candidate.Timestamp.Equal(existing.Timestamp) {
+		return candidate.Timestamp.After(existing.Timestamp)
+	}
+
+	if candidate.Origin != existing.Origin {
+		return candidate.Origin > existing.Origin
+	}
+
+	return candidate.ID > existing.ID
+}
+
+// newerVersion returns true if el wins against existing, according to the
+// resolver of its callback type.
+func (b *BMMC) newerVersion(el, existing buffer.Element) bool {
+	resolve, ok := b.config.Resolvers[el.CallbackType]
+	if !ok {
+		resolve = LastWriteWins
+	}
+
+	return resolve(b.newMessage(el), b.newMessage(existing))
+}
+
+// upsert adds given keyed element in messages buffer, replacing the older
+// version of the message. Replaced and stale versions are marked as seen, so
+// they are not synced again from peers which still have them.
+func (b *BMMC) upsert(el buffer.Element) error {
+	old, replaced, err := b.messageBuffer.Upsert(el, b.newerVersion)
+	if errors.Is(err, buffer.ErrStale) {
+		b.seen.add(el.ID)
+		b.messageBuffer.RemoveFragments(el.ID)
+
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if replaced {
+		b.seen.add(old.ID)
+		b.messageBuffer.RemoveFragments(old.ID)
+	}
+
+	b.messagesAdded()
+
+	if el.IsMessage() {
+		if replaced {
+			b.notifyKeyEvent(KeyUpdated, b.newMessage(el))
+		} else {
+			b.notifyKeyEvent(KeyCreated, b.newMessage(el))
+		}
+	}
+
+	return nil
+}
+
+// AddKeyedMessage adds new message with given key in messages buffer.
+// The message replaces the older version with the same key, in all buffers.
+func (b *BMMC) AddKeyedMessage(key string, msg interface{}, callbackType string) error {
+	if key == "" {
+		return errEmptyKey
+	}
+
+	_, err := b.addKeyedMessage(context.Background(), key, msg, callbackType)
+
+	return err
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Keyed messages", func() {
+	now := time.Now()
+
+	DescribeTable("LastWriteWins func",
+		func(candidate, existing Message, expected bool) {
+			Expect(LastWriteWins(candidate, existing)).To(Equal(expected))
+		},
+		Entry("newer timestamp", Message{ID: "a", Timestamp: now.Add(time.Second)},
+			Message{ID: "b", Timestamp: now}, true),
+		Entry("older timestamp", Message{ID: "b", Timestamp: now},
+			Message{ID: "a", Timestamp: now.Add(time.Second)}, false),
+		Entry("same timestamp, greater origin", Message{ID: "a", Origin: "localhost:20000", Timestamp: now},
+			Message{ID: "b", Origin: "localhost:10000", Timestamp: now}, true),
+		Entry("same timestamp and origin, greater ID", Message{ID: "b", Timestamp: now},
+			Message{ID: "a", Timestamp: now}, true),
+		Entry("same timestamp and origin, lower ID", Message{ID: "a", Timestamp: now},
+			Message{ID: "b", Timestamp: now}, false),
+	)
+
+	It("uses the resolver of the callback type", func() {
+		b := &BMMC{config: &Config{
+			Resolvers: map[string]Resolver{
+				"first-wins": func(candidate, existing Message) bool {
+					return candidate.Timestamp.Before(existing.Timestamp)
+				},
+			},
+		}}
+
+		older := buffer.Element{ID: "a", Timestamp: now, CallbackType: "first-wins"}
+		newer := buffer.Element{ID: "b", Timestamp: now.Add(time.Second), CallbackType: "first-wins"}
+		Expect(b.newerVersion(older, newer)).To(BeTrue())
+
+		older.CallbackType, newer.CallbackType = NOCALLBACK, NOCALLBACK
+		Expect(b.newerVersion(older, newer)).To(BeFalse())
+	})
+})
@@ -0,0 +1,286 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// keyRotationCallbackType is the callback type of key rotation messages
+	keyRotationCallbackType = "key-rotation"
+
+	// signatureHeader is the header with the HMAC-SHA256 of a protocol request
+	signatureHeader = "X-BMMC-Signature"
+	// timestampHeader is the header with the time at which a protocol request
+	// is signed, in nanoseconds since the epoch
+	timestampHeader = "X-BMMC-Timestamp"
+
+	// keyRotationContext separates the keys which seal the rotated keys from the signing keys
+	keyRotationContext = "bmmc key rotation"
+
+	rotateKeyErrFmt      = "error at rotating cluster key: %w"
+	keyRotationLogErrFmt = "Error at applying key rotation %s: %s"
+	keyRotationLogFmt    = "BMMC %s:%s rotated the cluster key"
+
+	defaultKeyRotationWindow = time.Minute
+	defaultSignatureWindow   = time.Minute
+)
+
+var (
+	errNoClusterKey     = errors.New("node has no cluster key")
+	errInvalidSignature = errors.New("invalid request signature")
+	errExpiredSignature = errors.New("request signature is outside the signature window")
+	errUnknownKey       = errors.New("rotated key is sealed with an unknown cluster key")
+)
+
+// clusterKeys are the keys which authenticate the protocol requests. After a
+// rotation, the previous key is accepted until the end of the rotation window.
+type clusterKeys struct {
+	current       []byte
+	previous      []byte
+	previousUntil time.Time
+	mux           sync.RWMutex
+}
+
+// newClusterKeys creates clusterKeys with given key.
+func newClusterKeys(key []byte) *clusterKeys {
+	return &clusterKeys{current: key}
+}
+
+// inWindow returns true if the previous key is still accepted.
+func (k *clusterKeys) inWindow() bool {
+	return k.previous != nil && time.Now().Before(k.previousUntil)
+}
+
+// signingKey returns the key which signs the requests. During the rotation
+// window requests are signed with the previous key, so peers which didn't
+// receive the rotation yet still accept them.
+func (k *clusterKeys) signingKey() []byte {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+
+	if k.inWindow() {
+		return k.previous
+	}
+
+	return k.current
+}
+
+// accepted returns the keys whose signatures are accepted.
+func (k *clusterKeys) accepted() [][]byte {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+
+	if k.inWindow() {
+		return [][]byte{k.current, k.previous}
+	}
+
+	return [][]byte{k.current}
+}
+
+// rotate replaces the current key with given key, accepting the previous key
+// for given window.
+func (k *clusterKeys) rotate(key []byte, window time.Duration) bool {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+
+	if bytes.Equal(key, k.current) {
+		return false
+	}
+
+	k.previous = k.current
+	k.previousUntil = time.Now().Add(window)
+	k.current = key
+
+	return true
+}
+
+// signature returns the HMAC-SHA256 of given request parts with given key.
+func signature(key []byte, method, uri, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", method, uri, timestamp) // nolint: errcheck
+	mac.Write(body)                                          // nolint: errcheck
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signingTransport signs the protocol requests sent by the node.
+type signingTransport struct {
+	next http.RoundTripper
+	keys *clusterKeys
+}
+
+// RoundTrip signs given request, with the current time, and sends it. The
+// body is read in memory.
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rc := req.Body
+
+	body, err := readBody(&rc)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	r := req.Clone(req.Context())
+	r.Body = rc
+	r.Header.Set(timestampHeader, timestamp)
+	r.Header.Set(signatureHeader, signature(t.keys.signingKey(), r.Method, r.URL.RequestURI(), timestamp, body))
+
+	return t.next.RoundTrip(r)
+}
+
+// verifySignature returns error if given request is not signed with an
+// accepted cluster key, or if it is signed outside the SignatureWindow, e.g.
+// it is replayed. Requests are not verified if the node has no cluster key.
+func (b *BMMC) verifySignature(r *http.Request) error {
+	if b.clusterKeys == nil {
+		return nil
+	}
+
+	timestamp := r.Header.Get(timestampHeader)
+	if !b.inSignatureWindow(timestamp) {
+		return errExpiredSignature
+	}
+
+	// the body is limited by ServerMaxBodyBytes
+	body, err := readBody(&r.Body)
+	if err != nil {
+		return err
+	}
+
+	got := []byte(r.Header.Get(signatureHeader))
+
+	for _, key := range b.clusterKeys.accepted() {
+		if hmac.Equal(got, []byte(signature(key, r.Method, r.URL.RequestURI(), timestamp, body))) {
+			return nil
+		}
+	}
+
+	return errInvalidSignature
+}
+
+// inSignatureWindow returns true if given signing time, in nanoseconds since
+// the epoch, is in the SignatureWindow around the current time.
+func (b *BMMC) inSignatureWindow(timestamp string) bool {
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	skew := time.Since(time.Unix(0, signedAt))
+
+	return skew <= b.config.SignatureWindow && skew >= -b.config.SignatureWindow
+}
+
+// sealingCipher returns the cipher which seals the keys rotated from given key.
+func sealingCipher(key []byte) (cipher.AEAD, error) {
+	sealingKey := sha256.Sum256(append([]byte(keyRotationContext), key...))
+
+	block, err := aes.NewCipher(sealingKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// RotateClusterKey replaces the cluster key of all nodes with given key. The key
+// is sealed with the current cluster key and gossiped in a key rotation message.
+// The previous key is accepted for KeyRotationWindow, so the peers which didn't
+// receive the rotation yet are not partitioned. A single rotation should run
+// per window.
+func (b *BMMC) RotateClusterKey(key []byte) error {
+	if b.clusterKeys == nil {
+		return fmt.Errorf(rotateKeyErrFmt, errNoClusterKey)
+	}
+
+	aead, err := sealingCipher(b.clusterKeys.accepted()[0])
+	if err != nil {
+		return fmt.Errorf(rotateKeyErrFmt, err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf(rotateKeyErrFmt, err)
+	}
+
+	sealed := base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, key, nil))
+
+	if _, err := b.addMessage(context.Background(), sealed, keyRotationCallbackType); err != nil {
+		return fmt.Errorf(rotateKeyErrFmt, err)
+	}
+
+	return nil
+}
+
+// applyKeyRotation rotates the cluster key to the key sealed in given message.
+func (b *BMMC) applyKeyRotation(msg interface{}) error {
+	if b.clusterKeys == nil {
+		return errNoClusterKey
+	}
+
+	sealed, ok := msg.(string)
+	if !ok {
+		return errUnknownKey
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return err
+	}
+
+	for _, current := range b.clusterKeys.accepted() {
+		aead, err := sealingCipher(current)
+		if err != nil {
+			return err
+		}
+
+		if len(raw) < aead.NonceSize() {
+			return errUnknownKey
+		}
+
+		key, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+		if err != nil {
+			continue
+		}
+
+		if b.clusterKeys.rotate(key, b.config.KeyRotationWindow) {
+			b.logf(GossipComponent, InfoLevel, keyRotationLogFmt, b.config.Addr, b.config.Port)
+		}
+
+		return nil
+	}
+
+	return errUnknownKey
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cluster keys", func() {
+	var transport *MemoryTransport
+
+	withClusterKey := func(key string) func(*Config) {
+		return func(cfg *Config) {
+			cfg.ClusterKey = []byte(key)
+		}
+	}
+
+	BeforeEach(func() {
+		transport = NewMemoryTransport()
+	})
+
+	It("accepts the previous key during the rotation window", func() {
+		keys := newClusterKeys([]byte("first"))
+		Expect(keys.rotate([]byte("first"), time.Minute)).To(BeFalse())
+
+		Expect(keys.rotate([]byte("second"), time.Millisecond*50)).To(BeTrue())
+		Expect(keys.signingKey()).To(Equal([]byte("first")))
+		Expect(keys.accepted()).To(ConsistOf([]byte("first"), []byte("second")))
+
+		Eventually(keys.accepted).Should(Equal([][]byte{[]byte("second")}))
+		Expect(keys.signingKey()).To(Equal([]byte("second")))
+	})
+
+	It("rejects the requests which are not signed with the cluster key", func() {
+		b := startTestNode("1", withTransport(transport), withClusterKey("secret"))
+		defer b.Stop() // nolint: errcheck
+
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:1"+gossipRoute, strings.NewReader("{}"))
+		Expect(err).To(Succeed())
+
+		res, err := transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		req, err = http.NewRequest(http.MethodPost, "http://localhost:1"+gossipRoute, strings.NewReader("{}"))
+		Expect(err).To(Succeed())
+
+		res, err = (&signingTransport{next: transport, keys: newClusterKeys([]byte("other"))}).RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("rejects the requests signed outside the signature window", func() {
+		b := startTestNode("1", withTransport(transport), withClusterKey("secret"), func(cfg *Config) {
+			cfg.SignatureWindow = time.Second
+		})
+		defer b.Stop() // nolint: errcheck
+
+		// e.g. a captured request, replayed later
+		timestamp := strconv.FormatInt(time.Now().Add(-time.Minute).UnixNano(), 10)
+
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:1"+gossipRoute, strings.NewReader("{}"))
+		Expect(err).To(Succeed())
+		req.Header.Set(timestampHeader, timestamp)
+		req.Header.Set(signatureHeader, signature([]byte("secret"), http.MethodPost, gossipRoute, timestamp, []byte("{}")))
+
+		res, err := transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		// the signed time can't be replaced without the cluster key
+		timestamp = strconv.FormatInt(time.Now().UnixNano(), 10)
+		req.Header.Set(timestampHeader, timestamp)
+		req.Body = ioutil.NopCloser(strings.NewReader("{}"))
+
+		res, err = transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("rejects the signed requests with bodies larger than ServerMaxBodyBytes", func() {
+		b := startTestNode("1", withTransport(transport), withClusterKey("secret"), func(cfg *Config) {
+			cfg.ServerMaxBodyBytes = 64
+		})
+		defer b.Stop() // nolint: errcheck
+
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:1"+gossipRoute, strings.NewReader(strings.Repeat(" ", 1024)))
+		Expect(err).To(Succeed())
+
+		res, err := (&signingTransport{next: transport, keys: newClusterKeys([]byte("secret"))}).RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+	})
+
+	It("disseminates messages only between nodes with the same key", func() {
+		first := startTestNode("1", withTransport(transport), withClusterKey("secret"))
+		defer first.Stop() // nolint: errcheck
+
+		second := startTestNode("2", withTransport(transport), withClusterKey("secret"))
+		defer second.Stop() // nolint: errcheck
+
+		other := startTestNode("3", withTransport(transport), withClusterKey("other"))
+		defer other.Stop() // nolint: errcheck
+
+		Expect(first.AddPeer("localhost", "2")).To(Succeed())
+		Expect(first.AddPeer("localhost", "3")).To(Succeed())
+		Expect(first.AddMessage("a message", NOCALLBACK)).To(Succeed())
+
+		Eventually(second.GetMessages, time.Second*5).Should(ContainElement("a message"))
+		Consistently(other.GetMessages, time.Millisecond*200).ShouldNot(ContainElement("a message"))
+	})
+
+	It("rotates the cluster key of all nodes through gossip", func() {
+		rotationWindow := func(cfg *Config) {
+			cfg.KeyRotationWindow = time.Millisecond * 500
+		}
+
+		first := startTestNode("1", withTransport(transport), withClusterKey("secret"), rotationWindow)
+		defer first.Stop() // nolint: errcheck
+
+		second := startTestNode("2", withTransport(transport), withClusterKey("secret"), rotationWindow)
+		defer second.Stop() // nolint: errcheck
+
+		Expect(first.AddPeer("localhost", "2")).To(Succeed())
+		Expect(first.RotateClusterKey([]byte("rotated"))).To(Succeed())
+
+		Eventually(func() [][]byte {
+			return second.clusterKeys.accepted()
+		}, time.Second*5).Should(ContainElement([]byte("rotated")))
+		Expect(first.clusterKeys.accepted()).To(ContainElement([]byte("rotated")))
+
+		// after the window, the nodes use the rotated key only
+		Eventually(second.clusterKeys.accepted, time.Second*2).Should(Equal([][]byte{[]byte("rotated")}))
+		Expect(first.AddMessage("after rotation", NOCALLBACK)).To(Succeed())
+		Eventually(second.GetMessages, time.Second*5).Should(ContainElement("after rotation"))
+	})
+
+	It("returns error when rotating without cluster key", func() {
+		b := newTestNode("1")
+		Expect(b.RotateClusterKey([]byte("rotated"))).To(MatchError(ContainSubstring(errNoClusterKey.Error())))
+	})
+})
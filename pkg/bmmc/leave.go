@@ -0,0 +1,76 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/callback"
+)
+
+const (
+	leaveErrFmt    = "error at leaving the cluster: %w"
+	leaveLogErrFmt = "BMMC %s:%s could not announce its leave to %s:%s: %s"
+)
+
+// Leave announces to all known peers that this node leaves the cluster, so they
+// remove it from their peers buffer, and then it stops the protocol.
+// The announcement is pushed to the peers directly and it is also gossiped,
+// so peers which are not reached before ctx is done still receive it.
+// It returns the error of Stop if the announcement succeeded.
+func (b *BMMC) Leave(ctx context.Context) (err error) {
+	defer func() {
+		if stopErr := b.Stop(); err == nil {
+			err = stopErr
+		}
+	}()
+
+	msg, err := buffer.NewElement(
+		callback.ComposeRemovePeerMessage(b.config.Addr, b.config.Port),
+		callback.REMOVEPEER,
+	)
+	if err != nil {
+		return fmt.Errorf(leaveErrFmt, err)
+	}
+
+	if err := b.addToBuffer(msg); err != nil {
+		return fmt.Errorf(leaveErrFmt, err)
+	}
+
+	self := fullHost(b.config.Addr, b.config.Port)
+	peers := []Peer{}
+
+	for _, p := range b.bans.withoutBanned(b.knownPeers()) {
+		if fullHost(p.Addr, p.Port) != self {
+			peers = append(peers, p)
+		}
+	}
+
+	for _, res := range b.push(ctx, []buffer.Element{msg}, peers) {
+		if res.Err != nil {
+			b.logf(MembershipComponent, WarnLevel, leaveLogErrFmt, b.config.Addr, b.config.Port, res.Peer.Addr, res.Peer.Port, res.Err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf(leaveErrFmt, err)
+	}
+
+	return nil
+}
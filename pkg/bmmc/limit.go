@@ -0,0 +1,76 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// limitingTransport bounds the number of simultaneous outbound requests.
+// A request holds its slot until its response body is closed.
+type limitingTransport struct {
+	next http.RoundTripper
+	sem  chan struct{}
+}
+
+// newLimitingTransport creates a limitingTransport with given number of slots.
+func newLimitingTransport(next http.RoundTripper, limit int) *limitingTransport {
+	return &limitingTransport{
+		next: next,
+		sem:  make(chan struct{}, limit),
+	}
+}
+
+// RoundTrip waits for a free slot, or until the request is canceled, and sends the request.
+func (t *limitingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case t.sem <- struct{}{}:
+	case <-req.Context().Done():
+		if req.Body != nil {
+			req.Body.Close() // nolint: errcheck
+		}
+
+		return nil, req.Context().Err()
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		<-t.sem
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { <-t.sem }}
+
+	return resp, nil
+}
+
+// releasingBody is a response body which releases a slot when it is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+// Close closes the body and releases the slot.
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+
+	return err
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var _ = Describe("Concurrency limit", func() {
+	var (
+		inFlight int32
+		maxSeen  int32
+	)
+
+	next := roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			m := atomic.LoadInt32(&maxSeen)
+			if n <= m || atomic.CompareAndSwapInt32(&maxSeen, m, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond * 20)
+
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+
+	BeforeEach(func() {
+		inFlight, maxSeen = 0, 0
+	})
+
+	It("bounds the simultaneous requests", func() {
+		t := newLimitingTransport(next, 2)
+		done := make(chan struct{})
+
+		for i := 0; i < 6; i++ {
+			go func() {
+				defer GinkgoRecover()
+
+				req, err := http.NewRequest(http.MethodGet, "http://localhost:10000", nil)
+				Expect(err).To(Succeed())
+
+				resp, err := t.RoundTrip(req)
+				Expect(err).To(Succeed())
+
+				atomic.AddInt32(&inFlight, -1)
+				Expect(resp.Body.Close()).To(Succeed())
+
+				done <- struct{}{}
+			}()
+		}
+
+		for i := 0; i < 6; i++ {
+			Eventually(done).Should(Receive())
+		}
+
+		Expect(maxSeen).To(BeNumerically("<=", 2))
+	})
+
+	It("stops waiting when the request is canceled", func() {
+		t := newLimitingTransport(next, 1)
+		t.sem <- struct{}{}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:10000", nil)
+		Expect(err).To(Succeed())
+
+		_, err = t.RoundTrip(req)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
@@ -0,0 +1,200 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// LogLevel is the level of a log.
+type LogLevel int
+
+const (
+	// DebugLevel is the level of the logs for every message, e.g. synced
+	// messages and retransmissions
+	DebugLevel LogLevel = iota
+	// InfoLevel is the level of the logs for the changes of node, e.g. the
+	// start of servers and the membership changes
+	InfoLevel
+	// WarnLevel is the level of the failures expected in a lossy network,
+	// e.g. unreachable peers and dropped messages
+	WarnLevel
+	// ErrorLevel is the level of the failures of node
+	ErrorLevel
+)
+
+// String returns the name of level.
+func (l LogLevel) String() string {
+	switch l {
+	case DebugLevel:
+		return "DEBUG"
+	case InfoLevel:
+		return "INFO"
+	case WarnLevel:
+		return "WARN"
+	case ErrorLevel:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+}
+
+// validLogLevel returns true if given level is one of the defined levels.
+func validLogLevel(l LogLevel) bool {
+	return l >= DebugLevel && l <= ErrorLevel
+}
+
+// LogComponent is the component of node which logs.
+type LogComponent string
+
+const (
+	// ServerComponent logs the requests received by the http server
+	ServerComponent LogComponent = "server"
+	// GossipComponent logs the gossip rounds and the synced messages
+	GossipComponent LogComponent = "gossip"
+	// CallbackComponent logs the callbacks, including the logs of callbacks
+	// with the *log.Logger they receive
+	CallbackComponent LogComponent = "callback"
+	// MembershipComponent logs the changes of peers
+	MembershipComponent LogComponent = "membership"
+	// StoreComponent logs the persistence of messages
+	StoreComponent LogComponent = "store"
+)
+
+// LeveledLogger receives structured logs: a message and fields as
+// alternating keys and values. It is implemented by *slog.Logger and it is
+// easily implemented for other loggers, e.g. zap.SugaredLogger.Debugw.
+type LeveledLogger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// stdLogger is a LeveledLogger which prints the logs with a *log.Logger.
+type stdLogger struct {
+	logger *log.Logger
+}
+
+// NewStdLogger returns a LeveledLogger which prints the logs with given
+// logger, as the level, the message and the fields as key=value pairs.
+func NewStdLogger(logger *log.Logger) LeveledLogger {
+	return &stdLogger{
+		logger: logger,
+	}
+}
+
+func (l *stdLogger) print(level LogLevel, msg string, args ...interface{}) {
+	var sb strings.Builder
+
+	sb.WriteString(level.String())
+	sb.WriteString(" ")
+	sb.WriteString(msg)
+
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fmt.Fprintf(&sb, " %v", args[i])
+			break
+		}
+
+		fmt.Fprintf(&sb, " %v=%v", args[i], args[i+1])
+	}
+
+	l.logger.Print(sb.String())
+}
+
+// Debug prints a log with DebugLevel.
+func (l *stdLogger) Debug(msg string, args ...interface{}) {
+	l.print(DebugLevel, msg, args...)
+}
+
+// Info prints a log with InfoLevel.
+func (l *stdLogger) Info(msg string, args ...interface{}) {
+	l.print(InfoLevel, msg, args...)
+}
+
+// Warn prints a log with WarnLevel.
+func (l *stdLogger) Warn(msg string, args ...interface{}) {
+	l.print(WarnLevel, msg, args...)
+}
+
+// Error prints a log with ErrorLevel.
+func (l *stdLogger) Error(msg string, args ...interface{}) {
+	l.print(ErrorLevel, msg, args...)
+}
+
+// logEnabled returns true if the logs of given component and level are printed.
+func (b *BMMC) logEnabled(component LogComponent, level LogLevel) bool {
+	min := b.config.LogLevel
+	if l, ok := b.config.ComponentLogLevels[component]; ok {
+		min = l
+	}
+
+	return level >= min
+}
+
+// logf logs a message of given component and level. Without LeveledLogger,
+// the message is printed by Logger, as before the levels existed.
+func (b *BMMC) logf(component LogComponent, level LogLevel, format string, args ...interface{}) {
+	if !b.logEnabled(component, level) {
+		return
+	}
+
+	if b.config.LeveledLogger == nil {
+		b.config.Logger.Printf(format, args...)
+		return
+	}
+
+	msg := fmt.Sprintf(format, args...)
+	fields := []interface{}{"component", string(component), "addr", b.config.Addr, "port", b.config.Port}
+
+	switch level {
+	case DebugLevel:
+		b.config.LeveledLogger.Debug(msg, fields...)
+	case InfoLevel:
+		b.config.LeveledLogger.Info(msg, fields...)
+	case WarnLevel:
+		b.config.LeveledLogger.Warn(msg, fields...)
+	default:
+		b.config.LeveledLogger.Error(msg, fields...)
+	}
+}
+
+// logWriter writes the lines of a *log.Logger as logs of a component.
+type logWriter struct {
+	b         *BMMC
+	component LogComponent
+	level     LogLevel
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.b.logf(w.component, w.level, "%s", strings.TrimSuffix(string(p), "\n"))
+
+	return len(p), nil
+}
+
+// loggerFor returns a *log.Logger, e.g. for callbacks, whose logs have given
+// component and level.
+func (b *BMMC) loggerFor(component LogComponent, level LogLevel) *log.Logger {
+	return log.New(&logWriter{
+		b:         b,
+		component: component,
+		level:     level,
+	}, "", 0)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"log"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Leveled logging", func() {
+	var (
+		buf *bytes.Buffer
+		b   *BMMC
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		b = &BMMC{
+			config: &Config{
+				Addr:   "localhost",
+				Port:   "1",
+				Logger: log.New(buf, "", 0),
+			},
+		}
+	})
+
+	It("prints all logs with Logger by default", func() {
+		b.logf(GossipComponent, DebugLevel, bufferSyncedLogFmt, "localhost", "1", "id", 1)
+
+		Expect(buf.String()).To(Equal("BMMC localhost:1 synced buffer with message id in round 1\n"))
+	})
+
+	It("skips the logs below the level of their component", func() {
+		b.config.LogLevel = InfoLevel
+		b.config.ComponentLogLevels = map[LogComponent]LogLevel{ServerComponent: ErrorLevel}
+
+		b.logf(GossipComponent, DebugLevel, "skipped")
+		b.logf(ServerComponent, WarnLevel, "skipped")
+		b.logf(GossipComponent, InfoLevel, "printed")
+		b.logf(ServerComponent, ErrorLevel, "printed")
+
+		Expect(buf.String()).To(Equal("printed\nprinted\n"))
+	})
+
+	It("sends the logs with their fields to LeveledLogger", func() {
+		b.config.LeveledLogger = NewStdLogger(b.config.Logger)
+
+		b.logf(MembershipComponent, WarnLevel, "peer %s is dead", "localhost/2")
+		b.loggerFor(CallbackComponent, InfoLevel).Printf("callback log")
+
+		Expect(buf.String()).To(Equal(
+			"WARN peer localhost/2 is dead component=membership addr=localhost port=1\n" +
+				"INFO callback log component=callback addr=localhost port=1\n"))
+	})
+})
@@ -0,0 +1,234 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// lossSmoothing is the weight of the last observation in the estimated loss
+	lossSmoothing = 0.05
+	// maxSolicited is the maximum number of solicited messages tracked by the
+	// loss estimator. The oldest are forgotten when it is exceeded
+	maxSolicited = 4096
+	// maxAdaptiveLoss is the maximum loss compensated by adaptive beta
+	maxAdaptiveLoss = 0.9
+	// missSmoothing is the weight of the last round in the estimated miss rate
+	missSmoothing = 0.2
+	// betaStep is the factor by which adaptive beta is raised or lowered in a round
+	betaStep = 1.25
+)
+
+// lossEstimator estimates the effective loss from the outcome of the requests
+// sent by the node and from the solicited messages which never arrive: a
+// message still missing from a later digest was lost.
+type lossEstimator struct {
+	loss      float64
+	observed  bool
+	solicited map[string]struct{}
+	order     []string
+	mux       sync.Mutex
+}
+
+// newLossEstimator creates a lossEstimator without observations.
+func newLossEstimator() *lossEstimator {
+	return &lossEstimator{
+		solicited: map[string]struct{}{},
+	}
+}
+
+// observe adds an observation to the estimated loss.
+func (e *lossEstimator) observe(lost bool) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	e.observeLocked(lost)
+}
+
+// observeLocked adds an observation to the estimated loss. Whoever calls this
+// func must lock the estimator.
+func (e *lossEstimator) observeLocked(lost bool) {
+	sample := 0.0
+	if lost {
+		sample = 1
+	}
+
+	if !e.observed {
+		e.loss = sample
+		e.observed = true
+
+		return
+	}
+
+	e.loss = (1-lossSmoothing)*e.loss + lossSmoothing*sample
+}
+
+// solicit records that given messages are solicited. The messages which were
+// already solicited were lost.
+func (e *lossEstimator) solicit(ids []string) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	for _, id := range ids {
+		if _, ok := e.solicited[id]; ok {
+			e.observeLocked(true)
+			continue
+		}
+
+		e.solicited[id] = struct{}{}
+		e.order = append(e.order, id)
+	}
+
+	for len(e.order) > maxSolicited {
+		delete(e.solicited, e.order[0])
+		e.order = e.order[1:]
+	}
+}
+
+// received records that given message arrived. It is an observation without
+// loss if the message was solicited.
+func (e *lossEstimator) received(id string) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	if _, ok := e.solicited[id]; ok {
+		delete(e.solicited, id)
+		e.observeLocked(false)
+	}
+}
+
+// forget stops tracking given messages, e.g. because they were not sent on
+// purpose and they are solicited again.
+func (e *lossEstimator) forget(ids []string) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	for _, id := range ids {
+		delete(e.solicited, id)
+	}
+}
+
+// estimate returns the estimated loss, between 0 and 1.
+func (e *lossEstimator) estimate() float64 {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	return e.loss
+}
+
+// missEstimator adapts beta to the miss rate, i.e. the number of
+// solicitations received per round. Solicitations show that peers miss the
+// messages of the node, so beta is raised while the node receives them and it
+// is lowered in the rounds without solicitations.
+type missEstimator struct {
+	beta              float64
+	rate              float64
+	lastSolicitations int64
+	minBeta           float64
+	maxBeta           float64
+	mux               sync.Mutex
+}
+
+// newMissEstimator creates a missEstimator which starts from given beta and
+// keeps it between given bounds.
+func newMissEstimator(beta, minBeta, maxBeta float64) *missEstimator {
+	e := &missEstimator{
+		minBeta: minBeta,
+		maxBeta: maxBeta,
+	}
+	e.beta = e.clamp(beta)
+
+	return e
+}
+
+// clamp returns given beta between the bounds of estimator.
+func (e *missEstimator) clamp(beta float64) float64 {
+	if beta < e.minBeta {
+		return e.minBeta
+	}
+
+	if beta > e.maxBeta {
+		return e.maxBeta
+	}
+
+	return beta
+}
+
+// observe adapts beta at the end of a round, given the total number of
+// solicitations received by the node.
+func (e *missEstimator) observe(solicitations int64) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	missed := solicitations - e.lastSolicitations
+	e.lastSolicitations = solicitations
+
+	e.rate = (1-missSmoothing)*e.rate + missSmoothing*float64(missed)
+
+	if missed > 0 {
+		e.beta = e.clamp(e.beta * betaStep)
+	} else {
+		e.beta = e.clamp(e.beta / betaStep)
+	}
+}
+
+// estimate returns the adapted beta and the estimated miss rate.
+func (e *missEstimator) estimate() (float64, float64) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	return e.beta, e.rate
+}
+
+// adaptBeta adapts beta to the solicitations received in the last round.
+func (b *BMMC) adaptBeta() {
+	if b.miss == nil {
+		return
+	}
+
+	b.miss.observe(atomic.LoadInt64(&b.counters.solicitationsReceived))
+}
+
+// beta returns the beta of the next round. With AdaptiveBeta, the configured
+// beta is raised to compensate the estimated loss. When MaxBeta is also set,
+// beta starts from the one adapted to the miss rate and stays between MinBeta
+// and MaxBeta.
+func (b *BMMC) beta() float64 {
+	if !b.config.AdaptiveBeta || b.loss == nil {
+		return b.configBeta()
+	}
+
+	beta, maxBeta := b.configBeta(), 1.0
+	if b.miss != nil {
+		beta, _ = b.miss.estimate()
+		maxBeta = b.config.MaxBeta
+	}
+
+	loss := b.loss.estimate()
+	if loss > maxAdaptiveLoss {
+		loss = maxAdaptiveLoss
+	}
+
+	beta /= 1 - loss
+	if beta > maxBeta {
+		beta = maxBeta
+	}
+
+	return beta
+}
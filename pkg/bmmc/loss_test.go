@@ -0,0 +1,111 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Loss estimator", func() {
+	It("estimates the loss from the outcome of requests", func() {
+		e := newLossEstimator()
+		Expect(e.estimate()).To(BeZero())
+
+		e.observe(true)
+		Expect(e.estimate()).To(Equal(1.0))
+
+		for i := 0; i < 100; i++ {
+			e.observe(false)
+		}
+
+		Expect(e.estimate()).To(BeNumerically("<", 0.01))
+	})
+
+	It("counts the messages solicited again as lost", func() {
+		e := newLossEstimator()
+
+		e.solicit([]string{"a", "b"})
+		e.received("a")
+		Expect(e.estimate()).To(BeZero())
+
+		e.solicit([]string{"b"})
+		Expect(e.estimate()).To(BeNumerically(">", 0))
+	})
+
+	It("doesn't count the forgotten messages as lost", func() {
+		e := newLossEstimator()
+
+		e.solicit([]string{"a"})
+		e.forget([]string{"a"})
+		e.solicit([]string{"a"})
+		e.received("a")
+
+		Expect(e.estimate()).To(BeZero())
+	})
+
+	It("raises beta with the estimated loss when beta is adaptive", func() {
+		b := &BMMC{
+			config: &Config{Beta: 0.3},
+			loss:   newLossEstimator(),
+		}
+		b.loss.observe(true)
+
+		for i := 0; i < 20; i++ {
+			b.loss.observe(false)
+		}
+
+		Expect(b.beta()).To(Equal(0.3))
+
+		b.config.AdaptiveBeta = true
+		Expect(b.beta()).To(BeNumerically("~", 0.3/(1-b.loss.estimate()), 1e-9))
+
+		b.loss.observe(true)
+		b.config.Beta = 0.9
+		Expect(b.beta()).To(Equal(1.0))
+	})
+
+	It("adapts beta to the miss rate between min and max beta", func() {
+		b := &BMMC{
+			config:   &Config{Beta: 0.3, AdaptiveBeta: true, MinBeta: 0.1, MaxBeta: 0.6},
+			loss:     newLossEstimator(),
+			miss:     newMissEstimator(0.3, 0.1, 0.6),
+			counters: &counters{},
+		}
+
+		// the node receives solicitations in every round
+		for i := 0; i < 10; i++ {
+			atomic.AddInt64(&b.counters.solicitationsReceived, 2)
+			b.adaptBeta()
+		}
+
+		Expect(b.beta()).To(Equal(0.6))
+		_, rate := b.miss.estimate()
+		Expect(rate).To(BeNumerically(">", 1))
+
+		// the node receives no solicitation
+		for i := 0; i < 20; i++ {
+			b.adaptBeta()
+		}
+
+		Expect(b.beta()).To(Equal(0.1))
+		_, rate = b.miss.estimate()
+		Expect(rate).To(BeNumerically("<", 0.1))
+	})
+})
@@ -0,0 +1,110 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+)
+
+const (
+	membershipLogErrFmt = "Error at syncing peers with membership event for %s: %s"
+)
+
+// MembershipNode is a node of an external membership cluster,
+// e.g. the Addr and the Meta of a memberlist.Node.
+type MembershipNode struct {
+	Addr string
+	Meta []byte
+}
+
+// membershipMeta is the metadata announced by a node in the external membership cluster.
+type membershipMeta struct {
+	Port string `json:"bmmcPort"`
+}
+
+// MembershipAdapter sources the peers buffer from an external membership
+// cluster, like hashicorp/memberlist: the join and the leave events of the
+// membership are mapped to AddPeer and RemovePeer.
+// A memberlist.EventDelegate and a memberlist.Delegate forward their
+// NotifyJoin, NotifyLeave, NotifyUpdate and NodeMeta calls to the adapter.
+type MembershipAdapter struct {
+	b *BMMC
+	// defaultPort is the port of the nodes which don't announce their port
+	defaultPort string
+}
+
+// NewMembershipAdapter creates a MembershipAdapter for given protocol instance.
+// Nodes which don't announce their port in metadata use defaultPort.
+func NewMembershipAdapter(b *BMMC, defaultPort string) *MembershipAdapter {
+	return &MembershipAdapter{
+		b:           b,
+		defaultPort: defaultPort,
+	}
+}
+
+// NodeMeta returns the metadata which announces the port of this node,
+// to be sent by the external membership.
+func (a *MembershipAdapter) NodeMeta() []byte {
+	// marshaling a struct of strings never fails
+	meta, _ := json.Marshal(membershipMeta{Port: a.b.config.Port}) // nolint: errcheck
+
+	return meta
+}
+
+// port returns the port announced by given node.
+func (a *MembershipAdapter) port(n MembershipNode) string {
+	var meta membershipMeta
+	if err := json.Unmarshal(n.Meta, &meta); err != nil || meta.Port == "" {
+		return a.defaultPort
+	}
+
+	return meta.Port
+}
+
+// isSelf returns true if given node is this node.
+func (a *MembershipAdapter) isSelf(addr, port string) bool {
+	return addr == a.b.config.Addr && port == a.b.config.Port
+}
+
+// NotifyJoin adds the node which joined the membership in peers buffer.
+func (a *MembershipAdapter) NotifyJoin(n MembershipNode) {
+	port := a.port(n)
+	if a.isSelf(n.Addr, port) || a.b.isKnownPeer(n.Addr, port) {
+		return
+	}
+
+	if err := a.b.AddPeer(n.Addr, port); err != nil {
+		a.b.logf(MembershipComponent, WarnLevel, membershipLogErrFmt, n.Addr, err)
+	}
+}
+
+// NotifyLeave removes the node which left the membership from peers buffer.
+func (a *MembershipAdapter) NotifyLeave(n MembershipNode) {
+	port := a.port(n)
+	if a.isSelf(n.Addr, port) || !a.b.isKnownPeer(n.Addr, port) {
+		return
+	}
+
+	if err := a.b.RemovePeer(n.Addr, port); err != nil {
+		a.b.logf(MembershipComponent, WarnLevel, membershipLogErrFmt, n.Addr, err)
+	}
+}
+
+// NotifyUpdate adds the updated node in peers buffer, if it is not known yet.
+func (a *MembershipAdapter) NotifyUpdate(n MembershipNode) {
+	a.NotifyJoin(n)
+}
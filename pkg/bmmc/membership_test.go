@@ -0,0 +1,59 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Membership adapter", func() {
+	var (
+		b       *BMMC
+		adapter *MembershipAdapter
+	)
+
+	BeforeEach(func() {
+		var err error
+		b, err = New(&Config{Addr: "localhost", Port: "14999", BufferSize: 32})
+		Expect(err).To(Succeed())
+
+		adapter = NewMembershipAdapter(b, "15000")
+	})
+
+	It("adds and removes peers on join and leave events", func() {
+		other := NewMembershipAdapter(&BMMC{config: &Config{Port: "15001"}}, "")
+		node := MembershipNode{Addr: "localhost", Meta: other.NodeMeta()}
+
+		adapter.NotifyJoin(node)
+		adapter.NotifyUpdate(node)
+		Expect(b.GetPeers()).To(Equal([]string{"localhost/15001"}))
+
+		adapter.NotifyLeave(node)
+		Expect(b.GetPeers()).To(BeEmpty())
+	})
+
+	It("uses the default port for nodes without metadata", func() {
+		adapter.NotifyJoin(MembershipNode{Addr: "localhost"})
+		Expect(b.GetPeers()).To(Equal([]string{"localhost/15000"}))
+	})
+
+	It("ignores the events of this node", func() {
+		adapter.NotifyJoin(MembershipNode{Addr: "localhost", Meta: adapter.NodeMeta()})
+		Expect(b.GetPeers()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,199 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	// cursorFmt is the format of decoded cursors: timestamp in nanoseconds and message ID
+	cursorFmt = "%d/%s"
+	// cursorParts is the number of parts of decoded cursors
+	cursorParts = 2
+)
+
+var (
+	// ErrMessageNotFound is returned when the buffer doesn't contain the requested message.
+	ErrMessageNotFound = errors.New("message not found")
+
+	errInvalidCursor = errors.New("invalid cursor")
+	errInvalidLimit  = errors.New("limit must be positive")
+)
+
+// Message is a message from buffer, with its metadata.
+type Message struct {
+	// ID is the unique ID of the message
+	ID string
+	// Payload is the message, as given to AddMessage. The payloads of
+	// messages encoded with a codec are their encoded bytes
+	Payload interface{}
+	// Codec is the name of the codec which encoded the payload, if the
+	// payload is not embedded as json
+	Codec string
+	// CallbackType is the callback type of the message
+	CallbackType string
+	// Key is the application key of keyed messages
+	Key string
+	// Origin is the node which added the message
+	Origin string
+	// Sender is the origin of the message, if the message is signed with the
+	// identity key of its origin; it is empty otherwise
+	Sender string
+	// Timestamp is the time when the message was created
+	Timestamp time.Time
+	// HLC is the hybrid logical clock timestamp of the message. It is after
+	// the timestamps of the messages delivered to its origin before it was added
+	HLC HLCTimestamp
+	// GossipCount is the number of rounds since the message is in buffer
+	GossipCount int64
+	// MaxGossipCount is the number of rounds for which the message is gossiped,
+	// if it was added with a TTL
+	MaxGossipCount int64
+	// VectorClock is the number of messages delivered to the origin from each
+	// node when the message was added, including the message itself. It is
+	// set only with CausalOrdering
+	VectorClock map[string]uint64
+	// Seq is the sequence number of the message among the ordered messages of
+	// its origin, or 0 if the message is not ordered (see AddMessageOrdered)
+	Seq uint64
+	// Priority is the priority of the message (see AddMessageWithPriority)
+	Priority Priority
+
+	// codec is the codec of the node which created the message
+	codec Codec
+}
+
+// newMessage creates a Message from given buffer element.
+func (b *BMMC) newMessage(el buffer.Element) Message {
+	return Message{
+		ID:             el.ID,
+		Payload:        el.Msg,
+		Codec:          el.Codec,
+		CallbackType:   el.CallbackType,
+		Key:            el.Key,
+		Origin:         el.Origin,
+		Sender:         el.Sender,
+		Timestamp:      el.Timestamp,
+		HLC:            HLCTimestamp(el.HLC),
+		GossipCount:    el.GossipCount,
+		MaxGossipCount: el.MaxGossipCount,
+		VectorClock:    el.VectorClock,
+		Seq:            el.Seq,
+		Priority:       Priority(el.Priority),
+		codec:          b.config.Codec,
+	}
+}
+
+// Decode decodes the payload of the message in the value pointed by v, e.g. the
+// payloads received from peers, which are decoded from json as maps, or the
+// payloads encoded with a codec.
+func (m Message) Decode(v interface{}) error {
+	return decodePayload(m.Payload, m.Codec, m.codec, v)
+}
+
+// newMessageList creates a Message for each given buffer element.
+func (b *BMMC) newMessageList(elements []buffer.Element) []Message {
+	messages := make([]Message, len(elements))
+	for i, el := range elements {
+		messages[i] = b.newMessage(el)
+	}
+
+	return messages
+}
+
+// GetMessage returns the message with given ID.
+// It returns ErrMessageNotFound if the buffer doesn't contain such message.
+func (b *BMMC) GetMessage(id string) (Message, error) {
+	el, ok := b.messageBuffer.Get(id)
+	if !ok || !el.IsMessage() {
+		return Message{}, ErrMessageNotFound
+	}
+
+	return b.newMessage(el), nil
+}
+
+// HasMessage returns true if the buffer contains the message with given ID.
+func (b *BMMC) HasMessage(id string) bool {
+	_, err := b.GetMessage(id)
+	return err == nil
+}
+
+// GetMessagesByType returns the messages with given callback type.
+func (b *BMMC) GetMessagesByType(cbType string) []Message {
+	return b.newMessageList(b.messageBuffer.ElementsByType(cbType))
+}
+
+// encodeCursor encodes the position of given message in a cursor.
+func encodeCursor(m Message) string {
+	s := fmt.Sprintf(cursorFmt, m.Timestamp.UnixNano(), m.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// decodeCursor decodes the position encoded in given cursor.
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), "/", cursorParts)
+	if len(parts) != cursorParts {
+		return time.Time{}, "", errInvalidCursor
+	}
+
+	nsec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+
+	return time.Unix(0, nsec), parts[1], nil
+}
+
+// ListMessages returns at most limit messages, ordered by timestamp, starting
+// after given cursor. An empty cursor starts from the oldest message.
+// It returns the cursor of the next page, which is empty for the last page.
+func (b *BMMC) ListMessages(cursor string, limit int) ([]Message, string, error) {
+	if limit <= 0 {
+		return nil, "", errInvalidLimit
+	}
+
+	after, id := time.Time{}, ""
+
+	if cursor != "" {
+		var err error
+		if after, id, err = decodeCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	elements, more := b.messageBuffer.ElementsAfter(after, id, limit)
+	messages := b.newMessageList(elements)
+
+	if !more {
+		return messages, "", nil
+	}
+
+	return messages, encodeCursor(messages[len(messages)-1]), nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Messages", func() {
+	It("decodes encoded cursors", func() {
+		m := Message{ID: "awesome/id", Timestamp: time.Now()}
+
+		t, id, err := decodeCursor(encodeCursor(m))
+		Expect(err).To(Succeed())
+		Expect(t.Equal(m.Timestamp)).To(BeTrue())
+		Expect(id).To(Equal(m.ID))
+	})
+
+	DescribeTable("returns error for invalid cursors",
+		func(cursor string) {
+			_, _, err := decodeCursor(cursor)
+			Expect(err).To(MatchError(errInvalidCursor))
+		},
+		Entry("not base64", "!!!"),
+		Entry("without separator", "MTIz"),
+		Entry("invalid timestamp", "YWJjL2lk"),
+	)
+
+	It("decodes the payloads received from peers", func() {
+		type order struct {
+			ID    string
+			Total int
+		}
+
+		var o order
+		Expect(Message{Payload: map[string]interface{}{"ID": "o-1", "Total": 3.0}}.Decode(&o)).To(Succeed())
+		Expect(o).To(Equal(order{ID: "o-1", Total: 3}))
+
+		o = order{}
+		Expect(Message{Payload: order{ID: "o-2"}}.Decode(&o)).To(Succeed())
+		Expect(o).To(Equal(order{ID: "o-2"}))
+	})
+
+	It("runs typed callbacks with decoded payloads", func() {
+		type order struct {
+			ID string
+		}
+
+		orders := make(chan order, 1)
+
+		b, err := New(&Config{
+			Addr:          "localhost",
+			Port:          "1",
+			BufferSize:    16,
+			RoundDuration: 20 * time.Millisecond,
+			Transport:     NewMemoryTransport(),
+			Logger:        log.New(ioutil.Discard, "", 0),
+			TypedCallbacks: map[string]interface{}{
+				"order": func(o order, _ *log.Logger) error {
+					orders <- o
+					return nil
+				},
+			},
+		})
+		Expect(err).To(Succeed())
+
+		b.syncElement(buffer.Element{
+			ID:           "order-message",
+			Timestamp:    time.Now(),
+			Msg:          map[string]interface{}{"ID": "o-1"},
+			CallbackType: "order",
+		}, "localhost", "2")
+
+		Eventually(orders).Should(Receive(Equal(order{ID: "o-1"})))
+		Expect(b.Stats().CallbackSuccesses).To(Equal(int64(1)))
+	})
+})
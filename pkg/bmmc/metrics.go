@@ -0,0 +1,430 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSpecTimeout = 10 * time.Second
+	specPollInterval   = 10 * time.Millisecond
+
+	runWithSpecErrFmt = "error at running spec: %w"
+)
+
+var (
+	errInvalidSpec   = errors.New("spec must have at least 2 nodes, 1 retry and 1 message and loss between 0 and 1")
+	errSimulatedLoss = errors.New("simulated message loss")
+)
+
+// Spec describes the cluster and the workload used to measure the protocol.
+type Spec struct {
+	// Nodes is the number of nodes in the cluster
+	Nodes int
+	// Beta is the beta of each node
+	// Optional (default: the default beta)
+	Beta float64
+	// Loss is the probability, between 0 and 1, that a request between nodes is lost
+	Loss float64
+	// Retries is the number of independent runs
+	Retries int
+	// Workers is the number of runs at the same time
+	// Optional (default: 1)
+	Workers int
+	// Messages is the number of messages added by the first node in each run
+	Messages int
+	// RoundDuration is the round duration of each node
+	// Optional (default: the default round duration)
+	RoundDuration time.Duration
+	// Timeout is the time after which a run which didn't converge is stopped
+	// Optional (default: 10s)
+	Timeout time.Duration
+	// Topology restricts which nodes can send requests to which nodes. Each node
+	// knows its neighbours in topology at the start of a run
+	// Optional (default: full mesh, first node knows all the other nodes)
+	Topology Topology
+	// OutputDir is the directory in which the results are written as JSON and CSV
+	// Optional (default: the results are only returned)
+	OutputDir string
+}
+
+// NodeResult is the state of a node at the end of a run.
+type NodeResult struct {
+	Addr string
+	Port string
+	// Messages is the number of messages in the buffer of the node
+	Messages int
+	// BufferBytes is the approximate size of the messages in the buffer of the node
+	BufferBytes int
+	// MessagesDelivered is the number of messages received from peers
+	MessagesDelivered int64
+	// Rounds is the number of gossip rounds run by the node
+	Rounds int64
+	// MessagesSent is the number of gossips, solicitations and
+	// synchronizations sent by the node
+	MessagesSent int64
+}
+
+// RunResult is the result of a run.
+type RunResult struct {
+	// Converged is true if all nodes received all messages before the timeout
+	Converged bool
+	// ConvergenceTime is the time until all nodes received all messages
+	ConvergenceTime time.Duration
+	// Rounds is the number of rounds run by the first node until all nodes
+	// received all messages
+	Rounds int64
+	// Reached contains, for each round run by the first node, the fraction of
+	// nodes which had all messages at the end of the round
+	Reached []float64
+	// MessagesSent is the number of gossips, solicitations and
+	// synchronizations sent by all nodes
+	MessagesSent int64
+	// Nodes contains the state of each node
+	Nodes []NodeResult
+}
+
+// Results are the results of all the runs of a spec.
+type Results struct {
+	Spec Spec
+	Runs []RunResult
+}
+
+// lossyTransport loses requests with a given probability.
+type lossyTransport struct {
+	next http.RoundTripper
+	loss float64
+	rand *rand.Rand
+	mux  sync.Mutex
+}
+
+// RoundTrip loses the request or sends it.
+func (t *lossyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mux.Lock()
+	lost := t.rand.Float64() < t.loss
+	t.mux.Unlock()
+
+	if lost {
+		if req.Body != nil {
+			req.Body.Close() // nolint: errcheck
+		}
+
+		return nil, errSimulatedLoss
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// reservedPorts are the ports of the nodes of the runs in progress, so the
+// runs at the same time don't get the same ports.
+var reservedPorts = struct {
+	ports map[string]bool
+	mux   sync.Mutex
+}{ports: map[string]bool{}}
+
+// reservePorts returns n unused ports, which are not reserved by other runs.
+func reservePorts(n int) ([]string, error) {
+	reservedPorts.mux.Lock()
+	defer reservedPorts.mux.Unlock()
+
+	ports := make([]string, 0, n)
+
+	for len(ports) < n {
+		port, err := freePort()
+		if err != nil {
+			for _, p := range ports {
+				delete(reservedPorts.ports, p)
+			}
+
+			return nil, err
+		}
+
+		if reservedPorts.ports[port] {
+			continue
+		}
+
+		reservedPorts.ports[port] = true
+		ports = append(ports, port)
+	}
+
+	return ports, nil
+}
+
+// releasePorts releases given reserved ports.
+func releasePorts(ports []string) {
+	reservedPorts.mux.Lock()
+	defer reservedPorts.mux.Unlock()
+
+	for _, p := range ports {
+		delete(reservedPorts.ports, p)
+	}
+}
+
+// newSpecRand creates the random source of a node, from given offset.
+func newSpecRand(offset int64) *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano() + offset)) // nolint: gosec
+}
+
+// freePort returns an unused port.
+func freePort() (string, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close() // nolint: errcheck
+
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port), nil
+}
+
+// RunWithSpec measures the dissemination of messages in local clusters
+// described by given spec, and returns the results of each run.
+func RunWithSpec(spec Spec) (Results, error) {
+	if spec.Nodes < 2 || spec.Retries < 1 || spec.Messages < 1 || spec.Loss < 0 || spec.Loss > 1 {
+		return Results{}, fmt.Errorf(runWithSpecErrFmt, errInvalidSpec)
+	}
+
+	if spec.Topology != nil {
+		if err := spec.Topology.validate(spec.Nodes); err != nil {
+			return Results{}, fmt.Errorf(runWithSpecErrFmt, err)
+		}
+	}
+
+	if spec.Timeout == 0 {
+		spec.Timeout = defaultSpecTimeout
+	}
+
+	results := Results{
+		Spec: spec,
+		Runs: make([]RunResult, spec.Retries),
+	}
+
+	workers := spec.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	errs := make([]error, spec.Retries)
+	sem := make(chan struct{}, workers)
+
+	var wg sync.WaitGroup
+
+	for i := range results.Runs {
+		wg.Add(1)
+
+		sem <- struct{}{}
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results.Runs[i], errs[i] = runOnce(spec)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return results, fmt.Errorf(runWithSpecErrFmt, err)
+		}
+	}
+
+	if spec.OutputDir != "" {
+		if err := results.WriteFiles(spec.OutputDir); err != nil {
+			return results, fmt.Errorf(runWithSpecErrFmt, err)
+		}
+	}
+
+	return results, nil
+}
+
+// newSpecNodes creates and starts the nodes of a run, on given ports.
+// Without a topology, the first node knows all the other nodes.
+func newSpecNodes(spec Spec, ports []string) ([]*BMMC, error) {
+	nodes := make([]*BMMC, 0, spec.Nodes)
+
+	// each node has the messages and an add peer message for each peer
+	bufferSize := spec.Messages + spec.Nodes
+	if spec.Topology != nil {
+		bufferSize += spec.Topology.edges()
+	}
+
+	for i, port := range ports {
+		node, err := New(&Config{
+			Addr:          "localhost",
+			Port:          port,
+			Beta:          spec.Beta,
+			RoundDuration: spec.RoundDuration,
+			BufferSize:    bufferSize,
+			Logger:        log.New(ioutil.Discard, "", 0),
+		})
+		if err != nil {
+			return nodes, err
+		}
+
+		if t, ok := node.clientTransport(); ok && spec.Loss > 0 {
+			t.next = &lossyTransport{
+				next: t.next,
+				loss: spec.Loss,
+				rand: newSpecRand(int64(i)),
+			}
+		}
+
+		if t, ok := node.clientTransport(); ok && spec.Topology != nil {
+			reachable := map[string]bool{}
+			for _, j := range spec.Topology[i] {
+				reachable[net.JoinHostPort("localhost", ports[j])] = true
+			}
+
+			t.next = &topologyTransport{
+				next:      t.next,
+				reachable: reachable,
+			}
+		}
+
+		if err := node.Start(); err != nil {
+			return nodes, err
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	if spec.Topology != nil {
+		for i, node := range nodes {
+			for _, j := range spec.Topology[i] {
+				// the peer may be already known from the gossip of other nodes
+				if node.isKnownPeer(nodes[j].config.Addr, nodes[j].config.Port) {
+					continue
+				}
+
+				if err := node.AddPeer(nodes[j].config.Addr, nodes[j].config.Port); err != nil {
+					return nodes, err
+				}
+			}
+		}
+
+		return nodes, nil
+	}
+
+	for _, node := range nodes[1:] {
+		if err := nodes[0].AddPeer(node.config.Addr, node.config.Port); err != nil {
+			return nodes, err
+		}
+	}
+
+	return nodes, nil
+}
+
+// runOnce runs the spec once. The nodes of each run have their own ports and
+// loggers, so runs can run at the same time.
+func runOnce(spec Spec) (RunResult, error) {
+	ports, err := reservePorts(spec.Nodes)
+	if err != nil {
+		return RunResult{}, err
+	}
+	defer releasePorts(ports)
+
+	nodes, err := newSpecNodes(spec, ports)
+
+	defer func() {
+		for _, node := range nodes {
+			node.Stop()
+		}
+	}()
+
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	start := time.Now()
+	ids := make([]string, spec.Messages)
+
+	for i := range ids {
+		elements, err := nodes[0].addMessage(context.Background(), fmt.Sprintf("message %d", i), NOCALLBACK)
+		if err != nil {
+			return RunResult{}, err
+		}
+
+		ids[i] = elements[0].ID
+	}
+
+	run := RunResult{}
+	deadline := start.Add(spec.Timeout)
+
+	for time.Now().Before(deadline) {
+		reached := reached(nodes, ids)
+		rounds := nodes[0].Stats().Rounds
+
+		// the rounds run between polls reached the same nodes
+		for int64(len(run.Reached)) < rounds {
+			run.Reached = append(run.Reached, reached)
+		}
+
+		if reached == 1 {
+			run.Converged = true
+			run.ConvergenceTime = time.Since(start)
+			run.Rounds = rounds
+
+			break
+		}
+
+		time.Sleep(specPollInterval)
+	}
+
+	for _, node := range nodes {
+		stats := node.Stats()
+		sent := stats.GossipsSent + stats.SolicitationsSent + stats.SynchronizationsSent
+
+		run.Nodes = append(run.Nodes, NodeResult{
+			Addr:              node.config.Addr,
+			Port:              node.config.Port,
+			Messages:          stats.Messages,
+			BufferBytes:       stats.BufferBytes,
+			MessagesDelivered: stats.MessagesDelivered,
+			Rounds:            stats.Rounds,
+			MessagesSent:      sent,
+		})
+
+		run.MessagesSent += sent
+	}
+
+	return run, nil
+}
+
+// reached returns the fraction of given nodes which have all given messages.
+func reached(nodes []*BMMC, ids []string) float64 {
+	complete := 0
+
+	for _, node := range nodes {
+		if node.hasAll(ids) {
+			complete++
+		}
+	}
+
+	return float64(complete) / float64(len(nodes))
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	resultsJSONFile      = "results.json"
+	resultsCSVFile       = "results.csv"
+	resultsRoundsCSVFile = "rounds.csv"
+
+	writeResultsErrFmt = "error at writing results in %s: %w"
+)
+
+// resultsCSVHeader is the header of the CSV summary, with a row for each run.
+var resultsCSVHeader = []string{
+	"run", "nodes", "beta", "loss", "messages", "converged", "convergence_ms", "rounds", "nodes_with_all_messages",
+	"messages_sent",
+}
+
+// roundsCSVHeader is the header of the CSV with the nodes reached in each
+// round, with a row for each round of each run.
+var roundsCSVHeader = []string{"run", "round", "reached"}
+
+// WriteJSON writes the results in w, as JSON.
+func (r Results) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+// WriteCSV writes a summary of the results in w, as CSV, with a row for each run.
+func (r Results) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(resultsCSVHeader); err != nil {
+		return err
+	}
+
+	for i, run := range r.Runs {
+		complete := 0
+
+		for _, n := range run.Nodes {
+			if n.Messages >= r.Spec.Messages {
+				complete++
+			}
+		}
+
+		row := []string{
+			strconv.Itoa(i),
+			strconv.Itoa(r.Spec.Nodes),
+			strconv.FormatFloat(r.Spec.Beta, 'f', -1, 64),
+			strconv.FormatFloat(r.Spec.Loss, 'f', -1, 64),
+			strconv.Itoa(r.Spec.Messages),
+			strconv.FormatBool(run.Converged),
+			strconv.FormatInt(run.ConvergenceTime.Milliseconds(), 10),
+			strconv.FormatInt(run.Rounds, 10),
+			strconv.Itoa(complete),
+			strconv.FormatInt(run.MessagesSent, 10),
+		}
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// WriteRoundsCSV writes the fraction of nodes reached in each round in w, as
+// CSV, with a row for each round of each run, so the dissemination can be
+// plotted.
+func (r Results) WriteRoundsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(roundsCSVHeader); err != nil {
+		return err
+	}
+
+	for i, run := range r.Runs {
+		for round, reached := range run.Reached {
+			row := []string{
+				strconv.Itoa(i),
+				strconv.Itoa(round + 1),
+				strconv.FormatFloat(reached, 'f', -1, 64),
+			}
+
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// WriteFiles writes the results in given directory, as results.json,
+// results.csv and rounds.csv.
+func (r Results) WriteFiles(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf(writeResultsErrFmt, dir, err)
+	}
+
+	for name, write := range map[string]func(io.Writer) error{
+		resultsJSONFile:      r.WriteJSON,
+		resultsCSVFile:       r.WriteCSV,
+		resultsRoundsCSVFile: r.WriteRoundsCSV,
+	} {
+		buf := &bytes.Buffer{}
+		if err := write(buf); err != nil {
+			return fmt.Errorf(writeResultsErrFmt, dir, err)
+		}
+
+		if err := writeFileAtomic(filepath.Join(dir, name), buf.Bytes()); err != nil {
+			return fmt.Errorf(writeResultsErrFmt, dir, err)
+		}
+	}
+
+	return nil
+}
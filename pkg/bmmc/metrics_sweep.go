@@ -0,0 +1,187 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	runSweepErrFmt = "error at running sweep for %d nodes, beta %g and loss %g: %w"
+)
+
+// Sweep is a grid of specs. A spec is run for each combination of nodes, beta
+// and loss values; the other fields are taken from Base.
+type Sweep struct {
+	Base   Spec
+	Nodes  []int
+	Betas  []float64
+	Losses []float64
+	// Parallel is the number of specs run at the same time
+	// Optional (default: 1)
+	Parallel int
+}
+
+// SweepPoint is the aggregated result of a spec from a sweep.
+type SweepPoint struct {
+	Nodes int
+	Beta  float64
+	Loss  float64
+	// Reliability is the fraction of runs in which all nodes received all messages
+	Reliability float64
+	// DeliveryRatio is the mean fraction of nodes which received all messages
+	DeliveryRatio float64
+	// MeanConvergenceTime is the mean convergence time of the converged runs
+	MeanConvergenceTime time.Duration
+	// MeanRounds is the mean number of rounds of the converged runs
+	MeanRounds float64
+	Results    Results
+}
+
+// specs returns the specs of the sweep grid.
+func (s Sweep) specs() []Spec {
+	nodes, betas, losses := s.Nodes, s.Betas, s.Losses
+
+	if len(nodes) == 0 {
+		nodes = []int{s.Base.Nodes}
+	}
+
+	if len(betas) == 0 {
+		betas = []float64{s.Base.Beta}
+	}
+
+	if len(losses) == 0 {
+		losses = []float64{s.Base.Loss}
+	}
+
+	specs := make([]Spec, 0, len(nodes)*len(betas)*len(losses))
+
+	for _, n := range nodes {
+		for _, beta := range betas {
+			for _, loss := range losses {
+				spec := s.Base
+				spec.Nodes = n
+				spec.Beta = beta
+				spec.Loss = loss
+
+				specs = append(specs, spec)
+			}
+		}
+	}
+
+	return specs
+}
+
+// aggregate returns the sweep point of given results.
+func aggregate(results Results) SweepPoint {
+	p := SweepPoint{
+		Nodes:   results.Spec.Nodes,
+		Beta:    results.Spec.Beta,
+		Loss:    results.Spec.Loss,
+		Results: results,
+	}
+
+	if len(results.Runs) == 0 {
+		return p
+	}
+
+	converged := 0
+	delivery := 0.0
+
+	var (
+		convergenceTime time.Duration
+		rounds          int64
+	)
+
+	for _, run := range results.Runs {
+		complete := 0
+
+		for _, n := range run.Nodes {
+			if n.Messages >= results.Spec.Messages {
+				complete++
+			}
+		}
+
+		if len(run.Nodes) > 0 {
+			delivery += float64(complete) / float64(len(run.Nodes))
+		}
+
+		if run.Converged {
+			converged++
+			convergenceTime += run.ConvergenceTime
+			rounds += run.Rounds
+		}
+	}
+
+	p.Reliability = float64(converged) / float64(len(results.Runs))
+	p.DeliveryRatio = delivery / float64(len(results.Runs))
+
+	if converged > 0 {
+		p.MeanConvergenceTime = convergenceTime / time.Duration(converged)
+		p.MeanRounds = float64(rounds) / float64(converged)
+	}
+
+	return p
+}
+
+// RunSweep runs RunWithSpec for each spec of the sweep grid and returns the
+// aggregated results, in grid order: by nodes, then by beta, then by loss.
+func RunSweep(s Sweep) ([]SweepPoint, error) {
+	specs := s.specs()
+	points := make([]SweepPoint, len(specs))
+	errs := make([]error, len(specs))
+
+	parallel := s.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	sem := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+
+	for i, spec := range specs {
+		wg.Add(1)
+
+		sem <- struct{}{}
+
+		go func(i int, spec Spec) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results, err := RunWithSpec(spec)
+			if err != nil {
+				errs[i] = fmt.Errorf(runSweepErrFmt, spec.Nodes, spec.Beta, spec.Loss, err)
+				return
+			}
+
+			points[i] = aggregate(results)
+		}(i, spec)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return points, err
+		}
+	}
+
+	return points, nil
+}
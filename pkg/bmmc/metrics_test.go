@@ -0,0 +1,233 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RunWithSpec", func() {
+	It("returns the results of each run", func() {
+		spec := Spec{
+			Nodes:    3,
+			Retries:  2,
+			Messages: 2,
+			Timeout:  time.Second * 5,
+		}
+
+		results, err := RunWithSpec(spec)
+		Expect(err).To(Succeed())
+		Expect(results.Spec).To(Equal(spec))
+		Expect(results.Runs).To(HaveLen(2))
+
+		for _, run := range results.Runs {
+			Expect(run.Converged).To(BeTrue())
+			Expect(run.ConvergenceTime).To(BeNumerically(">", 0))
+			Expect(run.Reached).To(HaveLen(int(run.Rounds)))
+			Expect(run.MessagesSent).To(BeNumerically(">", 0))
+			Expect(run.Nodes).To(HaveLen(3))
+
+			for _, n := range run.Nodes {
+				Expect(n.Messages).To(BeNumerically(">=", 2))
+			}
+		}
+	})
+
+	It("runs the retries in parallel on their own ports", func() {
+		results, err := RunWithSpec(Spec{
+			Nodes:    3,
+			Retries:  4,
+			Workers:  4,
+			Messages: 1,
+			Timeout:  time.Second * 5,
+		})
+		Expect(err).To(Succeed())
+		Expect(results.Runs).To(HaveLen(4))
+
+		for _, run := range results.Runs {
+			Expect(run.Converged).To(BeTrue())
+		}
+
+		// the ports are released at the end of the runs
+		Expect(reservedPorts.ports).To(BeEmpty())
+	})
+
+	It("writes the results as JSON and CSV", func() {
+		results := Results{
+			Spec: Spec{Nodes: 2, Beta: 0.5, Loss: 0.1, Retries: 1, Messages: 1},
+			Runs: []RunResult{{
+				Converged:       true,
+				ConvergenceTime: time.Millisecond * 250,
+				Rounds:          3,
+				Reached:         []float64{0.5, 0.5, 1},
+				MessagesSent:    7,
+				Nodes:           []NodeResult{{Messages: 2}, {Messages: 0}},
+			}},
+		}
+
+		buf := &bytes.Buffer{}
+		Expect(results.WriteCSV(buf)).To(Succeed())
+		Expect(buf.String()).To(Equal(
+			"run,nodes,beta,loss,messages,converged,convergence_ms,rounds,nodes_with_all_messages,messages_sent\n" +
+				"0,2,0.5,0.1,1,true,250,3,1,7\n"))
+
+		buf.Reset()
+		Expect(results.WriteRoundsCSV(buf)).To(Succeed())
+		Expect(buf.String()).To(Equal("run,round,reached\n0,1,0.5\n0,2,0.5\n0,3,1\n"))
+
+		dir, err := ioutil.TempDir("", "bmmc")
+		Expect(err).To(Succeed())
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		Expect(results.WriteFiles(dir)).To(Succeed())
+
+		raw, err := ioutil.ReadFile(filepath.Join(dir, "results.json"))
+		Expect(err).To(Succeed())
+
+		var decoded Results
+		Expect(json.Unmarshal(raw, &decoded)).To(Succeed())
+		Expect(decoded).To(Equal(results))
+		Expect(filepath.Join(dir, "results.csv")).To(BeARegularFile())
+		Expect(filepath.Join(dir, "rounds.csv")).To(BeARegularFile())
+	})
+
+	It("returns error for invalid specs", func() {
+		_, err := RunWithSpec(Spec{Nodes: 1, Retries: 1, Messages: 1})
+		Expect(err).NotTo(Succeed())
+
+		_, err = RunWithSpec(Spec{Nodes: 2, Retries: 1, Messages: 1, Loss: 2})
+		Expect(err).NotTo(Succeed())
+	})
+
+	It("loses requests with given probability", func() {
+		t := &lossyTransport{loss: 1, rand: newSpecRand(0)}
+
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:10000", nil)
+		Expect(err).To(Succeed())
+
+		_, err = t.RoundTrip(req)
+		Expect(err).To(MatchError(errSimulatedLoss))
+	})
+})
+
+var _ = Describe("RunSweep", func() {
+	It("runs a spec for each point of the grid", func() {
+		points, err := RunSweep(Sweep{
+			Base:     Spec{Retries: 1, Messages: 1, Timeout: time.Second * 5},
+			Nodes:    []int{2, 3},
+			Betas:    []float64{0.5},
+			Losses:   []float64{0, 0.1},
+			Parallel: 2,
+		})
+		Expect(err).To(Succeed())
+		Expect(points).To(HaveLen(4))
+
+		Expect(points[0].Nodes).To(Equal(2))
+		Expect(points[1].Loss).To(Equal(0.1))
+		Expect(points[2].Nodes).To(Equal(3))
+
+		for _, p := range points {
+			Expect(p.Beta).To(Equal(0.5))
+			Expect(p.Results.Runs).To(HaveLen(1))
+		}
+	})
+
+	It("aggregates the reliability of runs", func() {
+		p := aggregate(Results{
+			Spec: Spec{Nodes: 2, Messages: 1},
+			Runs: []RunResult{
+				{Converged: true, ConvergenceTime: time.Second, Rounds: 4, Nodes: []NodeResult{{Messages: 1}, {Messages: 1}}},
+				{Converged: false, Nodes: []NodeResult{{Messages: 1}, {Messages: 0}}},
+			},
+		})
+
+		Expect(p.Reliability).To(Equal(0.5))
+		Expect(p.DeliveryRatio).To(Equal(0.75))
+		Expect(p.MeanConvergenceTime).To(Equal(time.Second))
+		Expect(p.MeanRounds).To(Equal(4.0))
+	})
+
+	It("returns error for invalid specs", func() {
+		_, err := RunSweep(Sweep{Base: Spec{Retries: 1, Messages: 1}, Nodes: []int{1}})
+		Expect(err).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("Topology", func() {
+	It("builds rings", func() {
+		Expect(RingTopology(4)).To(Equal(Topology{{1, 3}, {0, 2}, {1, 3}, {2, 0}}))
+	})
+
+	It("builds trees", func() {
+		Expect(TreeTopology(5, 2)).To(Equal(Topology{{1, 2}, {0, 3, 4}, {0}, {1}, {1}}))
+	})
+
+	It("builds clustered topologies", func() {
+		t := ClusteredTopology(6, 2)
+		Expect(t.reaches(0, 2)).To(BeTrue())
+		Expect(t.reaches(0, 1)).To(BeTrue())
+		Expect(t.reaches(2, 3)).To(BeFalse())
+		Expect(t.validate(6)).To(Succeed())
+	})
+
+	It("builds full meshes", func() {
+		Expect(FullMeshTopology(3)).To(Equal(Topology{{1, 2}, {0, 2}, {0, 1}}))
+	})
+
+	It("returns error for invalid topologies", func() {
+		Expect(Topology{{1}}.validate(2)).NotTo(Succeed())
+		Expect(Topology{{2}, {0}}.validate(2)).NotTo(Succeed())
+		Expect(Topology{{0}, {0}}.validate(2)).NotTo(Succeed())
+
+		_, err := RunWithSpec(Spec{Nodes: 3, Retries: 1, Messages: 1, Topology: RingTopology(4)})
+		Expect(err).NotTo(Succeed())
+	})
+
+	It("converges on a ring", func() {
+		results, err := RunWithSpec(Spec{
+			Nodes:    5,
+			Retries:  1,
+			Messages: 1,
+			Timeout:  time.Second * 10,
+			Topology: RingTopology(5),
+		})
+		Expect(err).To(Succeed())
+		Expect(results.Runs[0].Converged).To(BeTrue())
+	})
+
+	It("doesn't deliver messages to unreachable nodes", func() {
+		results, err := RunWithSpec(Spec{
+			Nodes:    3,
+			Retries:  1,
+			Messages: 1,
+			Timeout:  time.Second,
+			Topology: Topology{{1}, {0}, {}},
+		})
+		Expect(err).To(Succeed())
+		Expect(results.Runs[0].Converged).To(BeFalse())
+		Expect(results.Runs[0].Nodes[2].Messages).To(Equal(0))
+	})
+})
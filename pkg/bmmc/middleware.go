@@ -0,0 +1,92 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// RequestLog describes a request served by the node.
+type RequestLog struct {
+	Method string
+	// Peer is the network address which sent the request
+	Peer string
+	Path string
+	// Latency is the time spent serving the request
+	Latency time.Duration
+	Status  int
+	// BodySize is the number of bytes read from the request body, before decoding
+	BodySize int64
+}
+
+// RequestLogger returns a middleware which calls fn after each request is served.
+func RequestLogger(fn func(RequestLog)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var size int64
+
+			r.Body = countReads(r.Body, &size)
+
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(sw, r)
+
+			fn(RequestLog{
+				Method:   r.Method,
+				Peer:     r.RemoteAddr,
+				Path:     r.URL.Path,
+				Latency:  time.Since(start),
+				Status:   sw.status,
+				BodySize: atomic.LoadInt64(&size),
+			})
+		})
+	}
+}
+
+// limitBodies limits the size of request bodies to ServerMaxBodyBytes.
+func (b *BMMC) limitBodies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = newLimitedBody(w, r.Body, int64(b.config.ServerMaxBodyBytes))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newHandler creates the handler of the protocol requests, wrapped in the
+// middlewares of the node. The first middleware is the outermost one: the
+// request bodies are limited before any middleware reads them, the requests
+// are reported, then they pass the configured middlewares and the requests
+// which reach the protocol are recorded.
+func (b *BMMC) newHandler() http.Handler {
+	middlewares := []func(http.Handler) http.Handler{b.limitBodies}
+
+	if b.config.OnRequest != nil {
+		middlewares = append(middlewares, RequestLogger(b.config.OnRequest))
+	}
+
+	middlewares = append(middlewares, b.config.Middlewares...)
+	middlewares = append(middlewares, b.recordInbound)
+
+	var handler http.Handler = http.HandlerFunc(b.serveProtocol)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
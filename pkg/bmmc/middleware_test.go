@@ -0,0 +1,154 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Middleware", func() {
+	It("logs the served requests", func() {
+		var logged RequestLog
+
+		handler := RequestLogger(func(l RequestLog) {
+			logged = l
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := ioutil.ReadAll(r.Body)
+			Expect(err).To(Succeed())
+
+			w.WriteHeader(http.StatusAccepted)
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:1/gossip", strings.NewReader("hello"))
+		req.RemoteAddr = "localhost:2"
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		Expect(logged.Method).To(Equal(http.MethodPost))
+		Expect(logged.Peer).To(Equal("localhost:2"))
+		Expect(logged.Path).To(Equal(gossipRoute))
+		Expect(logged.Status).To(Equal(http.StatusAccepted))
+		Expect(logged.BodySize).To(Equal(int64(len("hello"))))
+	})
+
+	It("wraps the protocol handler in the configured middlewares", func() {
+		transport := NewMemoryTransport()
+
+		order := []string{}
+		middleware := func(name string, status int) func(http.Handler) http.Handler {
+			return func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					order = append(order, name)
+
+					if status != 0 {
+						w.WriteHeader(status)
+						return
+					}
+
+					next.ServeHTTP(w, r)
+				})
+			}
+		}
+
+		var logged RequestLog
+
+		b, err := New(&Config{
+			Addr:       "localhost",
+			Port:       "1",
+			BufferSize: 16,
+			Transport:  transport,
+			Logger:     log.New(ioutil.Discard, "", 0),
+			OnRequest:  func(l RequestLog) { logged = l },
+			Middlewares: []func(http.Handler) http.Handler{
+				middleware("first", 0),
+				middleware("second", http.StatusForbidden),
+			},
+		})
+		Expect(err).To(Succeed())
+		Expect(b.Start()).To(Succeed())
+
+		defer b.Stop() // nolint: errcheck
+
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:1/gossip", strings.NewReader("{}"))
+
+		res, err := transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusForbidden))
+		Expect(order).To(Equal([]string{"first", "second"}))
+		Expect(logged.Status).To(Equal(http.StatusForbidden))
+	})
+
+	It("reports the requests served by the node", func() {
+		var (
+			logs []RequestLog
+			mux  sync.Mutex
+		)
+
+		transport := NewMemoryTransport()
+
+		newNode := func(port string, onRequest func(RequestLog)) *BMMC {
+			b, err := New(&Config{
+				Addr:          "localhost",
+				Port:          port,
+				BufferSize:    16,
+				RoundDuration: time.Millisecond * 20,
+				Transport:     transport,
+				Logger:        log.New(ioutil.Discard, "", 0),
+				OnRequest:     onRequest,
+			})
+			Expect(err).To(Succeed())
+			Expect(b.Start()).To(Succeed())
+
+			return b
+		}
+
+		receiver := newNode("1", func(l RequestLog) {
+			mux.Lock()
+			defer mux.Unlock()
+
+			logs = append(logs, l)
+		})
+		defer receiver.Stop() // nolint: errcheck
+
+		sender := newNode("2", nil)
+		defer sender.Stop() // nolint: errcheck
+
+		Expect(sender.AddPeer("localhost", "1")).To(Succeed())
+		Expect(sender.AddMessage("logged message", NOCALLBACK)).To(Succeed())
+
+		Eventually(func() []string {
+			mux.Lock()
+			defer mux.Unlock()
+
+			paths := []string{}
+			for _, l := range logs {
+				paths = append(paths, l.Path)
+			}
+
+			return paths
+		}, time.Second*5).Should(ContainElement(synchronizationRoute))
+	})
+})
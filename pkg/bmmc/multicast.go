@@ -0,0 +1,303 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	multicastStartErrFmt   = "error at starting udp multicast on %s: %w"
+	multicastSendLogErrFmt = "BMMC %s:%s could not multicast message %s: %s"
+	multicastRecvLogErrFmt = "BMMC %s:%s dropped multicast packet: %s"
+	multicastLogFmt        = "BMMC %s:%s received message %s by multicast from %s:%s"
+
+	// multicastMethod is the method with which the multicast packets are signed
+	multicastMethod = "MULTICAST"
+
+	defaultMulticastPacketSize = 1400
+)
+
+var (
+	errInvalidMulticast       = errors.New("multicast group must be a valid udp host:port and packet size must not be negative")
+	errMulticastNotSigned     = errors.New("multicast packet is not signed with the cluster key")
+	errMulticastPacketTooLong = errors.New("message doesn't fit in a multicast packet")
+)
+
+// MulticastConfig sends the messages added on the node to a UDP multicast or
+// broadcast group before they are gossiped, so in LANs most nodes receive them
+// without waiting for the rounds. The multicast is unreliable: the gossip
+// rounds only repair the messages lost by some nodes. All the nodes of the
+// cluster must use the same group.
+type MulticastConfig struct {
+	// Group is the host:port of the UDP multicast group (e.g. 239.1.1.1:7946)
+	// or of the broadcast address of the LAN (e.g. 192.168.1.255:7946)
+	// Optional (default: messages are not multicast)
+	Group string
+	// Interface is the name of the network interface which joins the
+	// multicast group
+	// Optional (default: the interface chosen by the system)
+	Interface string
+	// MaxPacketSize is the maximum size of multicast packets, in bytes. The
+	// messages which don't fit in a packet are only gossiped
+	// Optional (default: 1400, which fits in an ethernet frame)
+	MaxPacketSize int
+}
+
+// enabled returns true if the messages are multicast.
+func (c MulticastConfig) enabled() bool {
+	return c.Group != ""
+}
+
+// validate returns error if the multicast config is invalid.
+func (c MulticastConfig) validate() error {
+	if c.MaxPacketSize < 0 {
+		return errInvalidMulticast
+	}
+
+	if !c.enabled() {
+		return nil
+	}
+
+	if _, err := net.ResolveUDPAddr("udp", c.Group); err != nil {
+		return errInvalidMulticast
+	}
+
+	return nil
+}
+
+// multicastPacket contains a message multicast by its origin.
+type multicastPacket struct {
+	Envelope
+	Addr    string         `json:"addr"`
+	Port    string         `json:"port"`
+	Element buffer.Element `json:"element"`
+}
+
+// multicastDatagram is the datagram sent to the multicast group. The packet
+// is signed with the cluster key, if it is set, with the time at which it is sent.
+type multicastDatagram struct {
+	Packet    json.RawMessage `json:"packet"`
+	Timestamp string          `json:"timestamp,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+}
+
+// multicaster sends and receives the multicast packets.
+type multicaster struct {
+	group *net.UDPAddr
+	send  *net.UDPConn
+	recv  *net.UDPConn
+}
+
+// startMulticast joins the multicast group and receives its packets until ctx
+// is done.
+func (b *BMMC) startMulticast(ctx context.Context) error {
+	cfg := b.config.Multicast
+
+	group, err := net.ResolveUDPAddr("udp", cfg.Group)
+	if err != nil {
+		return fmt.Errorf(multicastStartErrFmt, cfg.Group, err)
+	}
+
+	var iface *net.Interface
+
+	if cfg.Interface != "" {
+		if iface, err = net.InterfaceByName(cfg.Interface); err != nil {
+			return fmt.Errorf(multicastStartErrFmt, cfg.Group, err)
+		}
+	}
+
+	m := &multicaster{group: group}
+
+	// broadcast packets are received by all sockets bound on the port
+	if group.IP.IsMulticast() {
+		m.recv, err = net.ListenMulticastUDP("udp", iface, group)
+	} else {
+		m.recv, err = net.ListenUDP("udp", &net.UDPAddr{Port: group.Port})
+	}
+
+	if err != nil {
+		return fmt.Errorf(multicastStartErrFmt, cfg.Group, err)
+	}
+
+	if m.send, err = net.DialUDP("udp", nil, group); err != nil {
+		m.recv.Close() // nolint: errcheck
+		return fmt.Errorf(multicastStartErrFmt, cfg.Group, err)
+	}
+
+	b.multicaster = m
+
+	go func() {
+		<-ctx.Done()
+
+		m.recv.Close() // nolint: errcheck
+		m.send.Close() // nolint: errcheck
+	}()
+
+	go b.receiveMulticasts(ctx, m.recv)
+
+	return nil
+}
+
+// receiveMulticasts receives the packets of the multicast group until ctx is done.
+func (b *BMMC) receiveMulticasts(ctx context.Context, conn *net.UDPConn) {
+	buf := make([]byte, b.config.Multicast.MaxPacketSize)
+
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			b.logf(GossipComponent, DebugLevel, multicastRecvLogErrFmt, b.config.Addr, b.config.Port, err)
+
+			continue
+		}
+
+		if err := b.receiveMulticast(buf[:n]); err != nil {
+			b.logf(GossipComponent, DebugLevel, multicastRecvLogErrFmt, b.config.Addr, b.config.Port, err)
+		}
+	}
+}
+
+// encodeMulticast returns the datagram with given element, signed with the
+// cluster key.
+func (b *BMMC) encodeMulticast(m buffer.Element) ([]byte, error) {
+	raw, err := json.Marshal(multicastPacket{
+		Envelope: b.envelope(),
+		Addr:     b.config.Addr,
+		Port:     b.config.Port,
+		Element:  m,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	d := multicastDatagram{Packet: raw}
+
+	if b.clusterKeys != nil {
+		d.Timestamp = strconv.FormatInt(time.Now().UnixNano(), 10)
+		d.Signature = signature(b.clusterKeys.signingKey(), multicastMethod, b.config.Multicast.Group, d.Timestamp, raw)
+	}
+
+	datagram, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(datagram) > b.config.Multicast.MaxPacketSize {
+		return nil, errMulticastPacketTooLong
+	}
+
+	return datagram, nil
+}
+
+// multicast sends given elements, added on this node, to the multicast group.
+func (b *BMMC) multicast(elements []buffer.Element) {
+	m := b.multicaster
+	if m == nil || !b.config.Roles.Has(GossiperRole) {
+		return
+	}
+
+	for _, el := range elements {
+		if el.Reassembled || el.Blob != nil {
+			continue
+		}
+
+		datagram, err := b.encodeMulticast(el)
+		if err == nil {
+			_, err = m.send.Write(datagram)
+		}
+
+		if err != nil {
+			b.logf(GossipComponent, DebugLevel, multicastSendLogErrFmt, b.config.Addr, b.config.Port, el.ID, err)
+			continue
+		}
+
+		atomic.AddInt64(&b.counters.multicastsSent, 1)
+	}
+}
+
+// receiveMulticast adds the message from given datagram in messages buffer
+// and runs its callbacks, as if it was received in a synchronization.
+func (b *BMMC) receiveMulticast(datagram []byte) error {
+	var d multicastDatagram
+	if err := json.Unmarshal(datagram, &d); err != nil {
+		return err
+	}
+
+	if !b.verifyMulticast(d) {
+		return errMulticastNotSigned
+	}
+
+	var p multicastPacket
+	if err := json.Unmarshal(d.Packet, &p); err != nil {
+		return err
+	}
+
+	// the packets sent by this node are received by it too
+	if p.Addr == b.config.Addr && p.Port == b.config.Port {
+		return nil
+	}
+
+	if b.bans.isBanned(p.Addr, p.Port) {
+		return nil
+	}
+
+	atomic.AddInt64(&b.counters.multicastsReceived, 1)
+
+	if !b.acceptSynced(p.Element) {
+		return nil
+	}
+
+	b.logf(GossipComponent, DebugLevel, multicastLogFmt, b.config.Addr, b.config.Port, p.Element.ID, p.Addr, p.Port)
+
+	b.syncElement(p.Element, b.config.Addr, b.config.Port)
+
+	return nil
+}
+
+// verifyMulticast returns true if given datagram is signed with an accepted
+// cluster key in the SignatureWindow, or if the node has no cluster key.
+func (b *BMMC) verifyMulticast(d multicastDatagram) bool {
+	if b.clusterKeys == nil {
+		return true
+	}
+
+	if !b.inSignatureWindow(d.Timestamp) {
+		return false
+	}
+
+	for _, key := range b.clusterKeys.accepted() {
+		if hmac.Equal([]byte(d.Signature), []byte(signature(key, multicastMethod, b.config.Multicast.Group, d.Timestamp, d.Packet))) {
+			return true
+		}
+	}
+
+	return false
+}
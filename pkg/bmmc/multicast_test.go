@@ -0,0 +1,87 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/callback"
+)
+
+var _ = Describe("Multicast", func() {
+	withMulticast := func(cfg *Config) {
+		cfg.Multicast = MulticastConfig{Group: "239.1.2.3:17946"}
+	}
+
+	withClusterKey := func(key string) func(*Config) {
+		return func(cfg *Config) {
+			cfg.ClusterKey = []byte(key)
+		}
+	}
+
+	encode := func(b *BMMC, msg interface{}) []byte {
+		m, err := b.newElement(msg, callback.NOCALLBACK)
+		Expect(err).To(Succeed())
+
+		m.Origin = fullHost(b.config.Addr, b.config.Port)
+
+		datagram, err := b.encodeMulticast(m)
+		Expect(err).To(Succeed())
+
+		return datagram
+	}
+
+	It("adds the messages received from the multicast group", func() {
+		sender := newTestNode("1", withMulticast, withClusterKey("cluster-key"))
+		receiver := newTestNode("2", withMulticast, withClusterKey("cluster-key"))
+
+		Expect(receiver.receiveMulticast(encode(sender, "a message"))).To(Succeed())
+
+		Expect(receiver.GetMessages()).To(ContainElement("a message"))
+		Expect(receiver.Stats().MulticastsReceived).To(Equal(int64(1)))
+	})
+
+	It("ignores the packets sent by the node", func() {
+		b := newTestNode("1", withMulticast)
+
+		Expect(b.receiveMulticast(encode(b, "a message"))).To(Succeed())
+
+		Expect(b.GetMessages()).NotTo(ContainElement("a message"))
+		Expect(b.Stats().MulticastsReceived).To(BeZero())
+	})
+
+	It("drops the packets which are not signed with the cluster key", func() {
+		sender := newTestNode("1", withMulticast, withClusterKey("other-key"))
+		receiver := newTestNode("2", withMulticast, withClusterKey("cluster-key"))
+
+		Expect(receiver.receiveMulticast(encode(sender, "a message"))).To(MatchError(errMulticastNotSigned))
+		Expect(receiver.GetMessages()).NotTo(ContainElement("a message"))
+	})
+
+	It("doesn't multicast the messages which don't fit in a packet", func() {
+		b := newTestNode("1", withMulticast)
+
+		m, err := b.newElement(strings.Repeat("x", defaultMulticastPacketSize), callback.NOCALLBACK)
+		Expect(err).To(Succeed())
+
+		_, err = b.encodeMulticast(m)
+		Expect(err).To(MatchError(errMulticastPacketTooLong))
+	})
+})
@@ -0,0 +1,145 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+const (
+	peerMovedLogFmt = "BMMC %s:%s peer %s moved from %s to %s"
+)
+
+// newNodeID returns a random version 4 UUID, which identifies a node.
+func newNodeID() (string, error) {
+	id := make([]byte, 16) // nolint: gomnd
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	id[6] = (id[6] & 0x0f) | 0x40 // nolint: gomnd
+	id[8] = (id[8] & 0x3f) | 0x80 // nolint: gomnd
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]), nil
+}
+
+// nodeIDs keeps the host of the peers by their node ID. The host of a node
+// may change, e.g. when it is restarted in a container, while its ID doesn't.
+type nodeIDs struct {
+	hosts map[string]string
+	ids   map[string]string
+	mux   sync.RWMutex
+}
+
+// newNodeIDs creates an empty nodeIDs.
+func newNodeIDs() *nodeIDs {
+	return &nodeIDs{
+		hosts: map[string]string{},
+		ids:   map[string]string{},
+	}
+}
+
+// observe records that the node with given ID is at given host. It returns
+// the previous host of the node, if the node moved.
+func (n *nodeIDs) observe(id, host string) (string, bool) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	previous, ok := n.hosts[id]
+	if ok && previous == host {
+		return "", false
+	}
+
+	if ok {
+		delete(n.ids, previous)
+	}
+
+	// another node may have been at the host before
+	if other, ok := n.ids[host]; ok {
+		delete(n.hosts, other)
+	}
+
+	n.hosts[id] = host
+	n.ids[host] = id
+
+	return previous, ok
+}
+
+// id returns the node ID of the peer at given host.
+func (n *nodeIDs) id(host string) string {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+
+	return n.ids[host]
+}
+
+// NodeID returns the ID of the node, which identifies it in the cluster even
+// if its address changes.
+func (b *BMMC) NodeID() string {
+	return b.config.NodeID
+}
+
+// envelope creates the envelope of a message sent by this node, with its node ID.
+func (b *BMMC) envelope() Envelope {
+	env := newEnvelope()
+	env.NodeID = b.config.NodeID
+
+	return env
+}
+
+// identifyPeer records the node ID reported by the peer at given address. When
+// a known node reports another address, the peer with its previous address is
+// replaced in peers buffer, so the node is not gossiped to twice and its old
+// address is not probed anymore. Peers without node ID are identified by their
+// address only.
+func (b *BMMC) identifyPeer(id, addr, port string) {
+	if id == "" || id == b.config.NodeID {
+		return
+	}
+
+	host := fullHost(addr, port)
+
+	previous, moved := b.nodeIDs.observe(id, host)
+	if !moved {
+		return
+	}
+
+	prevAddr, prevPort, err := net.SplitHostPort(previous)
+	if err != nil {
+		return
+	}
+
+	old, err := peer.NewPeer(prevAddr, prevPort)
+	if err != nil || !b.isKnownPeer(prevAddr, prevPort) {
+		return
+	}
+
+	b.forgetPeer(old)
+
+	if p, err := peer.NewPeer(addr, port); err == nil && !b.isKnownPeer(addr, port) {
+		if err := b.peerBuffer.AddPeer(p); err != nil {
+			return
+		}
+	}
+
+	b.logf(MembershipComponent, InfoLevel, peerMovedLogFmt, b.config.Addr, b.config.Port, id, previous, host)
+}
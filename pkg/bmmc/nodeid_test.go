@@ -0,0 +1,106 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Node IDs", func() {
+	withNodeID := func(id string) func(*Config) {
+		return func(cfg *Config) {
+			cfg.NodeID = id
+		}
+	}
+
+	hosts := func(b *BMMC) func() []string {
+		return func() []string {
+			hosts := []string{}
+			for _, p := range b.knownPeers() {
+				hosts = append(hosts, fullHost(p.Addr, p.Port))
+			}
+
+			return hosts
+		}
+	}
+
+	It("generates random node ids", func() {
+		a := newTestNode("1")
+		b := newTestNode("1")
+
+		Expect(a.NodeID()).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+		Expect(a.NodeID()).NotTo(Equal(b.NodeID()))
+	})
+
+	It("keeps the host of the nodes by their id", func() {
+		ids := newNodeIDs()
+
+		_, moved := ids.observe("a", "localhost:1")
+		Expect(moved).To(BeFalse())
+
+		_, moved = ids.observe("a", "localhost:1")
+		Expect(moved).To(BeFalse())
+
+		previous, moved := ids.observe("a", "localhost:2")
+		Expect(moved).To(BeTrue())
+		Expect(previous).To(Equal("localhost:1"))
+		Expect(ids.id("localhost:1")).To(BeEmpty())
+		Expect(ids.id("localhost:2")).To(Equal("a"))
+
+		// another node takes the host
+		_, moved = ids.observe("b", "localhost:2")
+		Expect(moved).To(BeFalse())
+		Expect(ids.id("localhost:2")).To(Equal("b"))
+	})
+
+	It("replaces the peers whose address changed", func() {
+		b := newTestNode("1")
+		Expect(b.AddPeer("localhost", "2")).To(Succeed())
+
+		b.identifyPeer("node-2", "localhost", "2")
+		Expect(hosts(b)()).To(ConsistOf("localhost:2"))
+
+		b.identifyPeer("node-2", "localhost", "3")
+		Expect(hosts(b)()).To(ConsistOf("localhost:3"))
+
+		statuses := b.GetPeerStatuses()
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].NodeID).To(Equal("node-2"))
+	})
+
+	It("recognizes a node which rejoins with another address", func() {
+		transport := NewMemoryTransport()
+
+		a := startTestNode("1", withTransport(transport), withNodeID("node-1"))
+		defer a.Stop() // nolint: errcheck
+
+		before := startTestNode("2", withTransport(transport), withNodeID("node-2"))
+		Expect(a.AddPeer("localhost", "2")).To(Succeed())
+		Expect(before.AddPeer("localhost", "1")).To(Succeed())
+
+		Eventually(func() string { return a.nodeIDs.id("localhost:2") }).Should(Equal("node-2"))
+		Expect(before.Stop()).To(Succeed())
+
+		after := startTestNode("3", withTransport(transport), withNodeID("node-2"))
+		defer after.Stop() // nolint: errcheck
+		Expect(after.AddPeer("localhost", "1")).To(Succeed())
+
+		Eventually(hosts(a)).Should(ContainElement("localhost:3"))
+		Expect(hosts(a)()).NotTo(ContainElement("localhost:2"))
+	})
+})
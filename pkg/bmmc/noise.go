@@ -0,0 +1,729 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+// The Noise_XX_25519_ChaChaPoly_SHA256 handshake (https://noiseprotocol.org/noise.html)
+// authenticates both peers by their static keys and establishes the keys of
+// the session. Each Noise message is prefixed by its length, on 2 bytes.
+const (
+	noiseProtocolName = "Noise_XX_25519_ChaChaPoly_SHA256"
+
+	// noiseKeySize is the size of keys and hashes
+	noiseKeySize = 32
+	// noiseTagSize is the size of the authentication tag of encrypted messages
+	noiseTagSize = 16
+	// noiseMaxMessageSize is the maximum size of Noise messages
+	noiseMaxMessageSize = 65535
+	// noiseMaxPayloadSize is the maximum size of the payload of transport messages
+	noiseMaxPayloadSize = noiseMaxMessageSize - noiseTagSize
+	// noiseHandshakeTimeout is the default timeout of the handshake
+	noiseHandshakeTimeout = time.Second * 10
+
+	noiseHandshakeErrFmt = "error at noise handshake: %w"
+)
+
+var (
+	errUntrustedPeer     = errors.New("peer static key is not trusted")
+	errShortNoiseMessage = errors.New("noise message is too short")
+	errInvalidNoiseKey   = errors.New("noise private key must have 32 bytes")
+)
+
+// NoiseConfig is the configuration of the Noise handshake.
+type NoiseConfig struct {
+	// PrivateKey is the X25519 static private key of the node
+	PrivateKey []byte
+	// TrustedKeys are the static public keys of the peers allowed to connect
+	// Optional (default: all peers are allowed, so the sessions are encrypted,
+	// but the peers are not authenticated)
+	TrustedKeys [][]byte
+	// HandshakeTimeout is the maximum duration of the handshake, so the peers
+	// which don't complete it can't hold the streams
+	// Optional (default: 10 seconds)
+	HandshakeTimeout time.Duration
+}
+
+// GenerateNoiseKey generates a static key pair for the Noise handshake.
+func GenerateNoiseKey() (privateKey, publicKey []byte, err error) {
+	key, err := generateNoiseKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key.private, key.public, nil
+}
+
+// NoisePublicKey returns the static public key of given static private key.
+func NoisePublicKey(privateKey []byte) ([]byte, error) {
+	key, err := newNoiseKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.public, nil
+}
+
+// noiseKey is a X25519 key pair.
+type noiseKey struct {
+	private []byte
+	public  []byte
+}
+
+// newNoiseKey creates the key pair of given private key.
+func newNoiseKey(private []byte) (*noiseKey, error) {
+	if len(private) != noiseKeySize {
+		return nil, errInvalidNoiseKey
+	}
+
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &noiseKey{
+		private: private,
+		public:  public,
+	}, nil
+}
+
+// copyPublic returns a copy of the public key, which can be appended to.
+func (k *noiseKey) copyPublic() []byte {
+	return append([]byte{}, k.public...)
+}
+
+// generateNoiseKey generates a key pair with the private key read from given
+// source of randomness.
+func generateNoiseKey(random io.Reader) (*noiseKey, error) {
+	private := make([]byte, noiseKeySize)
+	if _, err := io.ReadFull(random, private); err != nil {
+		return nil, err
+	}
+
+	return newNoiseKey(private)
+}
+
+// NoiseNetwork is a StreamNetwork which runs the Noise handshake on the streams
+// of another network and encrypts them with the keys of the session.
+type NoiseNetwork struct {
+	network StreamNetwork
+	static  *noiseKey
+	trusted [][]byte
+	timeout time.Duration
+}
+
+// NewNoiseNetwork creates a NoiseNetwork over given network.
+func NewNoiseNetwork(network StreamNetwork, cfg NoiseConfig) (*NoiseNetwork, error) {
+	static, err := newNoiseKey(cfg.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.HandshakeTimeout
+	if timeout == 0 {
+		timeout = noiseHandshakeTimeout
+	}
+
+	return &NoiseNetwork{
+		network: network,
+		static:  static,
+		trusted: cfg.TrustedKeys,
+		timeout: timeout,
+	}, nil
+}
+
+// Dial opens a stream to given host and runs the handshake as initiator.
+func (n *NoiseNetwork) Dial(ctx context.Context, host string) (net.Conn, error) {
+	conn, err := n.network.Dial(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	nc := n.newConn(conn, true)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.handshakeDeadline = deadline
+	}
+
+	if err := nc.handshake(); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	return nc, nil
+}
+
+// Listen returns a listener for the streams opened to given host. The handshake
+// runs as responder on the first read or write of accepted streams.
+func (n *NoiseNetwork) Listen(host string) (net.Listener, error) {
+	ln, err := n.network.Listen(host)
+	if err != nil {
+		return nil, err
+	}
+
+	return &noiseListener{Listener: ln, network: n}, nil
+}
+
+// newConn creates a noiseConn over given conn.
+func (n *NoiseNetwork) newConn(conn net.Conn, initiator bool) *noiseConn {
+	return &noiseConn{
+		Conn:      conn,
+		network:   n,
+		initiator: initiator,
+	}
+}
+
+// trusts returns true if the peer with given static public key is allowed to connect.
+func (n *NoiseNetwork) trusts(key []byte) bool {
+	if len(n.trusted) == 0 {
+		return true
+	}
+
+	for _, t := range n.trusted {
+		if bytes.Equal(t, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// noiseListener accepts the streams of a NoiseNetwork.
+type noiseListener struct {
+	net.Listener
+	network *NoiseNetwork
+}
+
+// Accept waits for the next stream.
+func (l *noiseListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return l.network.newConn(conn, false), nil
+}
+
+// noiseConn is a stream encrypted with the keys of a Noise session.
+type noiseConn struct {
+	net.Conn
+	network   *NoiseNetwork
+	initiator bool
+
+	handshakeMux      sync.Mutex
+	handshakeErr      error
+	handshaken        bool
+	handshakeDeadline time.Time
+
+	// deadlines set by the users of the stream, restored after the handshake
+	deadlineMux   sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	readMux sync.Mutex
+	recv    *noiseCipher
+	pending []byte
+
+	writeMux sync.Mutex
+	send     *noiseCipher
+}
+
+// Read reads decrypted data from the stream.
+func (c *noiseConn) Read(p []byte) (int, error) {
+	if err := c.handshake(); err != nil || len(p) == 0 {
+		return 0, err
+	}
+
+	c.readMux.Lock()
+	defer c.readMux.Unlock()
+
+	for len(c.pending) == 0 {
+		msg, err := readNoiseMessage(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+
+		if c.pending, err = c.recv.decrypt(nil, msg); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+
+	return n, nil
+}
+
+// Write encrypts given data and writes it in the stream.
+func (c *noiseConn) Write(p []byte) (int, error) {
+	if err := c.handshake(); err != nil {
+		return 0, err
+	}
+
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	written := 0
+
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > noiseMaxPayloadSize {
+			chunk = chunk[:noiseMaxPayloadSize]
+		}
+
+		if err := writeNoiseMessage(c.Conn, c.send.encrypt(nil, chunk)); err != nil {
+			return written, err
+		}
+
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+
+	return written, nil
+}
+
+// handshake runs the handshake once, as initiator or responder.
+func (c *noiseConn) handshake() error {
+	c.handshakeMux.Lock()
+	defer c.handshakeMux.Unlock()
+
+	if c.handshaken {
+		return c.handshakeErr
+	}
+
+	c.handshaken = true
+
+	// a peer which doesn't complete the handshake can't hold the stream
+	deadline := time.Now().Add(c.network.timeout)
+	if !c.handshakeDeadline.IsZero() && c.handshakeDeadline.Before(deadline) {
+		deadline = c.handshakeDeadline
+	}
+
+	c.Conn.SetDeadline(deadline) // nolint: errcheck
+	defer c.restoreDeadlines()
+
+	hs := newNoiseHandshake(c.network.static, rand.Reader)
+	if c.initiator {
+		c.send, c.recv, c.handshakeErr = hs.initiate(c.Conn)
+	} else {
+		c.recv, c.send, c.handshakeErr = hs.respond(c.Conn)
+	}
+
+	if c.handshakeErr == nil && !c.network.trusts(hs.rs) {
+		c.handshakeErr = errUntrustedPeer
+	}
+
+	if c.handshakeErr != nil {
+		c.handshakeErr = fmt.Errorf(noiseHandshakeErrFmt, c.handshakeErr)
+	}
+
+	return c.handshakeErr
+}
+
+// SetDeadline sets the read and write deadlines of the stream.
+func (c *noiseConn) SetDeadline(t time.Time) error {
+	c.deadlineMux.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.deadlineMux.Unlock()
+
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the stream.
+func (c *noiseConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMux.Lock()
+	c.readDeadline = t
+	c.deadlineMux.Unlock()
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the stream.
+func (c *noiseConn) SetWriteDeadline(t time.Time) error {
+	c.deadlineMux.Lock()
+	c.writeDeadline = t
+	c.deadlineMux.Unlock()
+
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// restoreDeadlines restores the deadlines set by the users of the stream,
+// after the deadline of the handshake.
+func (c *noiseConn) restoreDeadlines() {
+	c.deadlineMux.Lock()
+	defer c.deadlineMux.Unlock()
+
+	c.Conn.SetReadDeadline(c.readDeadline)   // nolint: errcheck
+	c.Conn.SetWriteDeadline(c.writeDeadline) // nolint: errcheck
+}
+
+// readNoiseMessage reads a Noise message prefixed by its length.
+func readNoiseMessage(r io.Reader) ([]byte, error) {
+	size := make([]byte, 2) // nolint: gomnd
+	if _, err := io.ReadFull(r, size); err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, binary.BigEndian.Uint16(size))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// writeNoiseMessage writes given Noise message prefixed by its length.
+func writeNoiseMessage(w io.Writer, msg []byte) error {
+	framed := make([]byte, 2, 2+len(msg)) // nolint: gomnd
+	binary.BigEndian.PutUint16(framed, uint16(len(msg)))
+
+	_, err := w.Write(append(framed, msg...))
+
+	return err
+}
+
+// noiseCipher is the CipherState of Noise: a ChaCha20-Poly1305 key and a nonce.
+type noiseCipher struct {
+	aead  cipher.AEAD
+	nonce uint64
+}
+
+// newNoiseCipher creates a noiseCipher with given key.
+func newNoiseCipher(key []byte) (*noiseCipher, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &noiseCipher{aead: aead}, nil
+}
+
+// nextNonce returns the next nonce: 4 zero bytes and the little-endian counter.
+func (c *noiseCipher) nextNonce() []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], c.nonce)
+	c.nonce++
+
+	return nonce
+}
+
+// encrypt encrypts given plaintext with given associated data.
+func (c *noiseCipher) encrypt(ad, plaintext []byte) []byte {
+	return c.aead.Seal(nil, c.nextNonce(), plaintext, ad)
+}
+
+// decrypt decrypts given ciphertext with given associated data.
+func (c *noiseCipher) decrypt(ad, ciphertext []byte) ([]byte, error) {
+	return c.aead.Open(nil, c.nextNonce(), ciphertext, ad)
+}
+
+// noiseHandshake is the HandshakeState of Noise for the XX pattern:
+//
+//	-> e
+//	<- e, ee, s, es
+//	-> s, se
+type noiseHandshake struct {
+	ck     []byte
+	h      []byte
+	cipher *noiseCipher
+
+	// random is the source of the ephemeral key
+	random io.Reader
+
+	s  *noiseKey
+	e  *noiseKey
+	re []byte
+	// rs is the static public key of the peer
+	rs []byte
+}
+
+// newNoiseHandshake creates a noiseHandshake with given static key, which
+// generates the ephemeral key from given source of randomness.
+func newNoiseHandshake(s *noiseKey, random io.Reader) *noiseHandshake {
+	h := make([]byte, noiseKeySize)
+	copy(h, noiseProtocolName)
+
+	hs := &noiseHandshake{
+		ck:     h,
+		h:      h,
+		random: random,
+		s:      s,
+	}
+
+	// the prologue is empty
+	hs.mixHash(nil)
+
+	return hs
+}
+
+// initiate runs the handshake as initiator. It returns the cipher for the
+// messages sent to the responder and the cipher for its messages.
+func (hs *noiseHandshake) initiate(rw io.ReadWriter) (*noiseCipher, *noiseCipher, error) {
+	// -> e
+	if err := hs.writeEphemeral(); err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeNoiseMessage(rw, append(hs.e.copyPublic(), hs.encryptAndHash(nil)...)); err != nil {
+		return nil, nil, err
+	}
+
+	// <- e, ee, s, es
+	msg, err := readNoiseMessage(rw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if msg, err = hs.readEphemeral(msg); err != nil {
+		return nil, nil, err
+	}
+
+	if err := hs.mixDH(hs.e.private, hs.re); err != nil {
+		return nil, nil, err
+	}
+
+	if err := hs.readStatic(msg); err != nil {
+		return nil, nil, err
+	}
+
+	if err := hs.mixDH(hs.e.private, hs.rs); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := hs.decryptAndHash(msg[noiseKeySize+noiseTagSize:]); err != nil {
+		return nil, nil, err
+	}
+
+	// -> s, se
+	reply := hs.encryptAndHash(hs.s.public)
+
+	if err := hs.mixDH(hs.s.private, hs.re); err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeNoiseMessage(rw, append(reply, hs.encryptAndHash(nil)...)); err != nil {
+		return nil, nil, err
+	}
+
+	return hs.split()
+}
+
+// respond runs the handshake as responder. It returns the cipher for the
+// messages of the initiator and the cipher for the messages sent to it.
+func (hs *noiseHandshake) respond(rw io.ReadWriter) (*noiseCipher, *noiseCipher, error) {
+	// -> e
+	msg, err := readNoiseMessage(rw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if msg, err = hs.readEphemeral(msg); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := hs.decryptAndHash(msg); err != nil {
+		return nil, nil, err
+	}
+
+	// <- e, ee, s, es
+	if err := hs.writeEphemeral(); err != nil {
+		return nil, nil, err
+	}
+
+	reply := hs.e.copyPublic()
+
+	if err := hs.mixDH(hs.e.private, hs.re); err != nil {
+		return nil, nil, err
+	}
+
+	reply = append(reply, hs.encryptAndHash(hs.s.public)...)
+
+	if err := hs.mixDH(hs.s.private, hs.re); err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeNoiseMessage(rw, append(reply, hs.encryptAndHash(nil)...)); err != nil {
+		return nil, nil, err
+	}
+
+	// -> s, se
+	if msg, err = readNoiseMessage(rw); err != nil {
+		return nil, nil, err
+	}
+
+	if err := hs.readStatic(msg); err != nil {
+		return nil, nil, err
+	}
+
+	if err := hs.mixDH(hs.e.private, hs.rs); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := hs.decryptAndHash(msg[noiseKeySize+noiseTagSize:]); err != nil {
+		return nil, nil, err
+	}
+
+	return hs.split()
+}
+
+// writeEphemeral generates the ephemeral key and mixes its public key.
+func (hs *noiseHandshake) writeEphemeral() error {
+	e, err := generateNoiseKey(hs.random)
+	if err != nil {
+		return err
+	}
+
+	hs.e = e
+	hs.mixHash(e.public)
+
+	return nil
+}
+
+// readEphemeral reads the ephemeral public key of the peer from given message
+// and returns the rest of the message.
+func (hs *noiseHandshake) readEphemeral(msg []byte) ([]byte, error) {
+	if len(msg) < noiseKeySize {
+		return nil, errShortNoiseMessage
+	}
+
+	hs.re = msg[:noiseKeySize]
+	hs.mixHash(hs.re)
+
+	return msg[noiseKeySize:], nil
+}
+
+// readStatic decrypts the static public key of the peer from given message.
+func (hs *noiseHandshake) readStatic(msg []byte) error {
+	if len(msg) < noiseKeySize+noiseTagSize {
+		return errShortNoiseMessage
+	}
+
+	rs, err := hs.decryptAndHash(msg[:noiseKeySize+noiseTagSize])
+	if err != nil {
+		return err
+	}
+
+	hs.rs = rs
+
+	return nil
+}
+
+// mixDH mixes the result of the Diffie-Hellman between given keys in the
+// chaining key.
+func (hs *noiseHandshake) mixDH(private, public []byte) error {
+	// X25519 fails for the public keys of low order, which give an all-zero secret
+	secret, err := curve25519.X25519(private, public)
+	if err != nil {
+		return err
+	}
+
+	var key []byte
+
+	hs.ck, key = noiseHKDF(hs.ck, secret)
+	hs.cipher, err = newNoiseCipher(key)
+
+	return err
+}
+
+// mixHash mixes given data in the handshake hash.
+func (hs *noiseHandshake) mixHash(data []byte) {
+	h := sha256.New()
+	h.Write(hs.h) // nolint: errcheck
+	h.Write(data) // nolint: errcheck
+	hs.h = h.Sum(nil)
+}
+
+// encryptAndHash encrypts given plaintext, if there is a key, and mixes the
+// result in the handshake hash.
+func (hs *noiseHandshake) encryptAndHash(plaintext []byte) []byte {
+	ciphertext := plaintext
+	if hs.cipher != nil {
+		ciphertext = hs.cipher.encrypt(hs.h, plaintext)
+	}
+
+	hs.mixHash(ciphertext)
+
+	return ciphertext
+}
+
+// decryptAndHash decrypts given ciphertext, if there is a key, and mixes it in
+// the handshake hash.
+func (hs *noiseHandshake) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	plaintext := ciphertext
+
+	if hs.cipher != nil {
+		var err error
+		if plaintext, err = hs.cipher.decrypt(hs.h, ciphertext); err != nil {
+			return nil, err
+		}
+	}
+
+	hs.mixHash(ciphertext)
+
+	return plaintext, nil
+}
+
+// split returns the ciphers for the messages of the initiator and of the responder.
+func (hs *noiseHandshake) split() (*noiseCipher, *noiseCipher, error) {
+	k1, k2 := noiseHKDF(hs.ck, nil)
+
+	c1, err := newNoiseCipher(k1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c2, err := newNoiseCipher(k2)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c1, c2, nil
+}
+
+// noiseHKDF derives two keys from given chaining key and input key material.
+func noiseHKDF(ck, ikm []byte) ([]byte, []byte) {
+	temp := noiseHMAC(ck, ikm)
+	out1 := noiseHMAC(temp, []byte{1})
+	out2 := noiseHMAC(temp, append(append([]byte{}, out1...), 2)) // nolint: gomnd
+
+	return out1, out2
+}
+
+// noiseHMAC returns the HMAC-SHA256 of given data.
+func noiseHMAC(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data) // nolint: errcheck
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,287 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// noiseRecorder records the Noise messages written in a stream.
+type noiseRecorder struct {
+	io.ReadWriter
+	messages [][]byte
+}
+
+func (r *noiseRecorder) Write(p []byte) (int, error) {
+	// the messages are written at once, after their length
+	r.messages = append(r.messages, append([]byte{}, p[2:]...))
+
+	return r.ReadWriter.Write(p)
+}
+
+// mustDecodeHex decodes given hex string.
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	Expect(err).To(Succeed())
+
+	return b
+}
+
+var _ = Describe("NoiseNetwork", func() {
+	var (
+		pipes *pipeNetwork
+
+		firstKey, firstPub   []byte
+		secondKey, secondPub []byte
+	)
+
+	newNoiseNetwork := func(key []byte, trusted ...[]byte) *NoiseNetwork {
+		n, err := NewNoiseNetwork(pipes, NoiseConfig{PrivateKey: key, TrustedKeys: trusted})
+		Expect(err).To(Succeed())
+
+		return n
+	}
+
+	// connect opens a stream from first network to second one and returns both
+	// ends, with the handshake errors of the initiator and of the responder
+	connect := func(first, second *NoiseNetwork) (net.Conn, net.Conn, error, error) {
+		ln, err := second.Listen("node:2")
+		Expect(err).To(Succeed())
+
+		defer ln.Close() // nolint: errcheck
+
+		accepted := make(chan net.Conn, 1)
+		acceptErr := make(chan error, 1)
+
+		go func() {
+			conn, err := ln.Accept()
+			Expect(err).To(Succeed())
+
+			// the responder runs the handshake on its first read
+			_, err = conn.Read(nil)
+			if err != nil {
+				conn.Close() // nolint: errcheck
+			}
+
+			accepted <- conn
+			acceptErr <- err
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		client, err := first.Dial(ctx, "node:2")
+
+		return client, <-accepted, err, <-acceptErr
+	}
+
+	BeforeEach(func() {
+		pipes = &pipeNetwork{listeners: map[string]*pipeListener{}}
+
+		var err error
+
+		firstKey, firstPub, err = GenerateNoiseKey()
+		Expect(err).To(Succeed())
+
+		secondKey, secondPub, err = GenerateNoiseKey()
+		Expect(err).To(Succeed())
+	})
+
+	It("derives the public key from the private key", func() {
+		Expect(NoisePublicKey(firstKey)).To(Equal(firstPub))
+	})
+
+	It("encrypts the streams between trusted peers", func() {
+		client, server, dialErr, acceptErr := connect(newNoiseNetwork(firstKey, secondPub), newNoiseNetwork(secondKey, firstPub))
+		Expect(dialErr).To(Succeed())
+		Expect(acceptErr).To(Succeed())
+
+		defer client.Close() // nolint: errcheck
+		defer server.Close() // nolint: errcheck
+
+		// larger than a Noise message
+		data := bytes.Repeat([]byte("bmmc"), noiseMaxMessageSize)
+
+		go client.Write(data) // nolint: errcheck
+
+		received := make([]byte, len(data))
+		_, err := io.ReadFull(server, received)
+		Expect(err).To(Succeed())
+		Expect(received).To(Equal(data))
+
+		go server.Write([]byte("reply")) // nolint: errcheck
+
+		reply := make([]byte, 5)
+		_, err = io.ReadFull(client, reply)
+		Expect(err).To(Succeed())
+		Expect(string(reply)).To(Equal("reply"))
+	})
+
+	It("rejects untrusted peers", func() {
+		_, otherPub, err := GenerateNoiseKey()
+		Expect(err).To(Succeed())
+
+		// the responder doesn't trust the initiator
+		_, _, _, acceptErr := connect(newNoiseNetwork(firstKey, secondPub), newNoiseNetwork(secondKey, otherPub))
+		Expect(acceptErr).To(MatchError(ContainSubstring(errUntrustedPeer.Error())))
+
+		// the initiator doesn't trust the responder
+		_, _, dialErr, _ := connect(newNoiseNetwork(firstKey, otherPub), newNoiseNetwork(secondKey, firstPub))
+		Expect(dialErr).To(MatchError(ContainSubstring(errUntrustedPeer.Error())))
+	})
+
+	It("follows the Noise_XX_25519_ChaChaPoly_SHA256 test vectors", func() {
+		// the vector with empty handshake payloads from the test vectors of
+		// github.com/flynn/noise (vectors.txt)
+		initStatic, err := newNoiseKey(mustDecodeHex("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"))
+		Expect(err).To(Succeed())
+
+		respStatic, err := newNoiseKey(mustDecodeHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"))
+		Expect(err).To(Succeed())
+
+		initEphemeral := mustDecodeHex("202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f")
+		respEphemeral := mustDecodeHex("4142434445464748494a4b4c4d4e4f505152535455565758595a5b5c5d5e5f60")
+
+		first, second := net.Pipe()
+		defer first.Close()  // nolint: errcheck
+		defer second.Close() // nolint: errcheck
+
+		initiator := &noiseRecorder{ReadWriter: first}
+		responder := &noiseRecorder{ReadWriter: second}
+
+		type ciphers struct {
+			recv, send *noiseCipher
+			err        error
+		}
+
+		responded := make(chan ciphers, 1)
+
+		go func() {
+			var c ciphers
+			c.recv, c.send, c.err = newNoiseHandshake(respStatic, bytes.NewReader(respEphemeral)).respond(responder)
+			responded <- c
+		}()
+
+		initSend, initRecv, err := newNoiseHandshake(initStatic, bytes.NewReader(initEphemeral)).initiate(initiator)
+		Expect(err).To(Succeed())
+
+		resp := <-responded
+		Expect(resp.err).To(Succeed())
+
+		Expect(initiator.messages).To(HaveLen(2))
+		Expect(responder.messages).To(HaveLen(1))
+
+		// handshake messages
+		Expect(initiator.messages[0]).To(Equal(mustDecodeHex(
+			"358072d6365880d1aeea329adf9121383851ed21a28e3b75e965d0d2cd166254")))
+		Expect(responder.messages[0]).To(Equal(mustDecodeHex(
+			"64b101b1d0be5a8704bd078f9895001fc03e8e9f9522f188dd128d9846d48466" +
+				"3414af878d3e46a2f58911a816d6e8346d4ea17a6f2a0bb4ef4ed56c133cff45" +
+				"60a34e36ea82109f26cf2e5a5caf992b608d55c747f615e5a3425a7a19eefb8f")))
+		Expect(initiator.messages[1]).To(Equal(mustDecodeHex(
+			"87f864c11ba449f46a0a4f4e2eacbb7b0457784f4fca1937f572c93603e9c4d9" +
+				"7e5ea11b16f3968710b23a3be3202dc1b5e1ce3c963347491e74f5c0768a9b42")))
+
+		// transport messages, from the initiator and from the responder
+		payload := mustDecodeHex("79656c6c6f777375626d6172696e65")
+		msg := initSend.encrypt(nil, payload)
+		Expect(msg).To(Equal(mustDecodeHex("a52ef02ba60e12696d1d6b9ef4245c88fca757b6134ad6e76b56e310a6adf6")))
+		Expect(resp.recv.decrypt(nil, msg)).To(Equal(payload))
+
+		payload = mustDecodeHex("7375626d6172696e6579656c6c6f77")
+		msg = resp.send.encrypt(nil, payload)
+		Expect(msg).To(Equal(mustDecodeHex("2445aa438ebd649281c636cc7269ca82f1d9023d72520943aeabf909cdf521")))
+		Expect(initRecv.decrypt(nil, msg)).To(Equal(payload))
+	})
+
+	It("closes the streams of peers which don't complete the handshake", func() {
+		n, err := NewNoiseNetwork(pipes, NoiseConfig{
+			PrivateKey:       firstKey,
+			HandshakeTimeout: time.Millisecond * 50,
+		})
+		Expect(err).To(Succeed())
+
+		ln, err := n.Listen("node:2")
+		Expect(err).To(Succeed())
+
+		defer ln.Close() // nolint: errcheck
+
+		// the peer opens a stream, but doesn't start the handshake
+		go func() {
+			conn, err := pipes.Dial(context.Background(), "node:2")
+			if err == nil {
+				defer conn.Close() // nolint: errcheck
+
+				time.Sleep(time.Second)
+			}
+		}()
+
+		conn, err := ln.Accept()
+		Expect(err).To(Succeed())
+
+		defer conn.Close() // nolint: errcheck
+
+		start := time.Now()
+
+		_, err = conn.Read(make([]byte, 1))
+		Expect(err).To(MatchError(ContainSubstring("noise handshake")))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Millisecond*500))
+	})
+
+	It("returns error for invalid private keys", func() {
+		_, err := NewNoiseNetwork(pipes, NoiseConfig{PrivateKey: []byte("short")})
+		Expect(err).To(MatchError(errInvalidNoiseKey))
+	})
+
+	It("disseminates messages over noise sessions", func() {
+		network := newNoiseNetwork(firstKey)
+		t := NewStreamTransport(network)
+		nodes := []*BMMC{}
+
+		for _, port := range []string{"1", "2"} {
+			node, err := New(&Config{
+				Addr:          "node",
+				Port:          port,
+				BufferSize:    16,
+				RoundDuration: time.Millisecond * 20,
+				Transport:     t,
+				Logger:        log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+			Expect(node.Start()).To(Succeed())
+
+			defer node.Stop() // nolint: errcheck
+
+			nodes = append(nodes, node)
+		}
+
+		Expect(nodes[0].AddPeer("node", "2")).To(Succeed())
+		Expect(nodes[0].AddMessage("over noise", NOCALLBACK)).To(Succeed())
+
+		Eventually(nodes[1].GetMessages, time.Second*5).Should(ContainElement("over noise"))
+	})
+})
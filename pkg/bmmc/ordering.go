@@ -0,0 +1,338 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	defaultMaxOrderingDelay = time.Second * 10
+
+	orderingDelayLogFmt = "BMMC %s:%s delivered message %s from %s out of order, after waiting %s for the messages which precede it"
+
+	// sequenceSourceFmt is the format of the sources of sequence numbers: origin and epoch
+	sequenceSourceFmt = "%s/%d"
+)
+
+// Ordering is the order in which the messages received from peers are delivered.
+type Ordering int
+
+const (
+	// NoOrdering delivers the messages as soon as they are received.
+	NoOrdering Ordering = iota
+	// CausalOrdering delivers each message after the messages which were
+	// delivered to its origin before it was added. The messages are stamped
+	// with vector clocks.
+	CausalOrdering
+	// FIFOOrdering delivers the messages with sequence numbers (see
+	// AddMessageOrdered) in the order in which their origin added them, and
+	// drops the duplicates. All messages added by nodes with FIFOOrdering
+	// have sequence numbers.
+	FIFOOrdering
+)
+
+// orderer delivers the messages received from peers in an order.
+type orderer interface {
+	// receive returns the messages which can be delivered after given
+	// message is received, in order
+	receive(el buffer.Element) []buffer.Element
+	// expire returns the pending messages which waited longer than given
+	// delay, and the messages released by delivering them, in order
+	expire(delay time.Duration) ([]buffer.Element, []buffer.Element)
+}
+
+// pendingElement is a message which waits for the messages which precede it.
+type pendingElement struct {
+	el       buffer.Element
+	received time.Time
+}
+
+// causalOrder delivers the messages in causal order, by their vector clocks.
+type causalOrder struct {
+	// clock counts the messages delivered from each origin
+	clock   map[string]uint64
+	pending []pendingElement
+	mux     sync.Mutex
+}
+
+// newCausalOrder creates an empty causalOrder.
+func newCausalOrder() *causalOrder {
+	return &causalOrder{
+		clock: map[string]uint64{},
+	}
+}
+
+// stamp returns the vector clock of a new message added by given origin. The
+// message is delivered by its origin, so it is counted in the clock.
+func (o *causalOrder) stamp(origin string) map[string]uint64 {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	o.clock[origin]++
+
+	vc := make(map[string]uint64, len(o.clock))
+	for k, v := range o.clock {
+		vc[k] = v
+	}
+
+	return vc
+}
+
+// deliverable returns true if the messages which precede given message were delivered.
+func (o *causalOrder) deliverable(el buffer.Element) bool {
+	for origin, n := range el.VectorClock {
+		if origin == el.Origin {
+			if n != o.clock[origin]+1 {
+				return false
+			}
+
+			continue
+		}
+
+		if n > o.clock[origin] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// deliver counts given message in the clock.
+func (o *causalOrder) deliver(el buffer.Element) {
+	for origin, n := range el.VectorClock {
+		if n > o.clock[origin] {
+			o.clock[origin] = n
+		}
+	}
+}
+
+// receive returns the messages which can be delivered after given message is
+// received, in causal order. Messages without vector clock, and messages which
+// were skipped because they arrived too late, are delivered right away.
+func (o *causalOrder) receive(el buffer.Element) []buffer.Element {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	if len(el.VectorClock) == 0 || el.VectorClock[el.Origin] <= o.clock[el.Origin] {
+		return []buffer.Element{el}
+	}
+
+	o.pending = append(o.pending, pendingElement{el: el, received: time.Now()})
+
+	return o.release()
+}
+
+// expire delivers the oldest pending messages which waited longer than given
+// delay, skipping the messages which precede them, and returns them together
+// with the messages which can be delivered after them, in causal order.
+func (o *causalOrder) expire(delay time.Duration) ([]buffer.Element, []buffer.Element) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	expired := []buffer.Element{}
+	released := []buffer.Element{}
+
+	for len(o.pending) > 0 && time.Since(o.pending[0].received) > delay {
+		p := o.pending[0]
+		o.pending = o.pending[1:]
+
+		o.deliver(p.el)
+		expired = append(expired, p.el)
+		released = append(released, p.el)
+		released = append(released, o.release()...)
+	}
+
+	return expired, released
+}
+
+// release removes from pending and returns the messages which can be delivered, in causal order.
+func (o *causalOrder) release() []buffer.Element {
+	released := []buffer.Element{}
+
+	for i := 0; i < len(o.pending); {
+		el := o.pending[i].el
+		if !o.deliverable(el) {
+			i++
+			continue
+		}
+
+		o.pending = append(o.pending[:i], o.pending[i+1:]...)
+		o.deliver(el)
+		released = append(released, el)
+
+		// the delivered message may precede the previous pending messages
+		i = 0
+	}
+
+	return released
+}
+
+// sequenceSource returns the source of the sequence number of given message.
+func sequenceSource(el buffer.Element) string {
+	return fmt.Sprintf(sequenceSourceFmt, el.Origin, el.SeqEpoch)
+}
+
+// fifoOrder delivers the messages of each source in the order of their
+// sequence numbers.
+type fifoOrder struct {
+	// next is the sequence number of the next message delivered from each source
+	next    map[string]uint64
+	pending []pendingElement
+	mux     sync.Mutex
+}
+
+// newFIFOOrder creates an empty fifoOrder.
+func newFIFOOrder() *fifoOrder {
+	return &fifoOrder{
+		next: map[string]uint64{},
+	}
+}
+
+// expected returns the sequence number of the next message delivered from given source.
+func (o *fifoOrder) expected(source string) uint64 {
+	if n, ok := o.next[source]; ok {
+		return n
+	}
+
+	return 1
+}
+
+// receive returns the messages which can be delivered after given message is
+// received, in the order of their sequence numbers. Messages without sequence
+// number are delivered right away, and the duplicates, or the messages which
+// were skipped because they arrived too late, are dropped.
+func (o *fifoOrder) receive(el buffer.Element) []buffer.Element {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	if el.Seq == 0 {
+		return []buffer.Element{el}
+	}
+
+	if el.Seq < o.expected(sequenceSource(el)) {
+		return nil
+	}
+
+	for _, p := range o.pending {
+		if p.el.SameSequence(el) {
+			return nil
+		}
+	}
+
+	o.pending = append(o.pending, pendingElement{el: el, received: time.Now()})
+
+	return o.release()
+}
+
+// expire delivers the pending messages of the sources whose oldest pending
+// message waited longer than given delay, skipping the missing messages which
+// precede them. It returns the messages delivered after a skip, and all the
+// delivered messages, in the order of their sequence numbers.
+func (o *fifoOrder) expire(delay time.Duration) ([]buffer.Element, []buffer.Element) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	expired := []buffer.Element{}
+	released := []buffer.Element{}
+
+	for len(o.pending) > 0 && time.Since(o.pending[0].received) > delay {
+		el := o.lowestPending(sequenceSource(o.pending[0].el))
+		o.next[sequenceSource(el)] = el.Seq
+
+		expired = append(expired, el)
+		released = append(released, o.release()...)
+	}
+
+	return expired, released
+}
+
+// lowestPending returns the pending message with the lowest sequence number
+// from given source.
+func (o *fifoOrder) lowestPending(source string) buffer.Element {
+	lowest := buffer.Element{}
+
+	for _, p := range o.pending {
+		if sequenceSource(p.el) == source && (lowest.Seq == 0 || p.el.Seq < lowest.Seq) {
+			lowest = p.el
+		}
+	}
+
+	return lowest
+}
+
+// release removes from pending and returns the messages which can be
+// delivered, in the order of their sequence numbers.
+func (o *fifoOrder) release() []buffer.Element {
+	released := []buffer.Element{}
+
+	for i := 0; i < len(o.pending); {
+		el := o.pending[i].el
+		if el.Seq != o.expected(sequenceSource(el)) {
+			i++
+			continue
+		}
+
+		o.pending = append(o.pending[:i], o.pending[i+1:]...)
+		o.next[sequenceSource(el)] = el.Seq + 1
+		released = append(released, el)
+
+		// the delivered message may precede the previous pending messages
+		i = 0
+	}
+
+	return released
+}
+
+// sequence sets the next sequence number of the node on given message.
+func (b *BMMC) sequence(m *buffer.Element) {
+	m.Seq = atomic.AddUint64(&b.lastSeq, 1)
+	m.SeqEpoch = b.seqEpoch
+}
+
+// ordered returns the messages which can be delivered after given element is
+// received, in the configured order.
+func (b *BMMC) ordered(el buffer.Element) []buffer.Element {
+	if b.order == nil || !el.IsMessage() {
+		return []buffer.Element{el}
+	}
+
+	return b.order.receive(el)
+}
+
+// releaseDelayed delivers the messages which waited longer than
+// MaxOrderingDelay for the messages which precede them.
+func (b *BMMC) releaseDelayed() {
+	if b.order == nil {
+		return
+	}
+
+	expired, released := b.order.expire(b.config.MaxOrderingDelay)
+
+	for _, el := range expired {
+		b.logf(GossipComponent, WarnLevel, orderingDelayLogFmt, b.config.Addr, b.config.Port, el.ID, el.Origin, b.config.MaxOrderingDelay)
+	}
+
+	for _, el := range released {
+		b.release(el, b.config.Addr, b.config.Port)
+	}
+}
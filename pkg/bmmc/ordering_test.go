@@ -0,0 +1,193 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Causal ordering", func() {
+	ids := func(elements []buffer.Element) []string {
+		result := []string{}
+		for _, el := range elements {
+			result = append(result, el.ID)
+		}
+
+		return result
+	}
+
+	causalElement := func(id, origin string, vc map[string]uint64) buffer.Element {
+		return buffer.Element{ID: id, Origin: origin, VectorClock: vc}
+	}
+
+	It("stamps the messages with the clock of their origin", func() {
+		o := newCausalOrder()
+
+		Expect(o.stamp("a")).To(Equal(map[string]uint64{"a": 1}))
+		Expect(o.receive(causalElement("b1", "b", map[string]uint64{"b": 1}))).To(HaveLen(1))
+		Expect(o.stamp("a")).To(Equal(map[string]uint64{"a": 2, "b": 1}))
+	})
+
+	It("delivers the messages after the messages which precede them", func() {
+		o := newCausalOrder()
+
+		a1 := causalElement("a1", "a", map[string]uint64{"a": 1})
+		a2 := causalElement("a2", "a", map[string]uint64{"a": 2})
+		b1 := causalElement("b1", "b", map[string]uint64{"a": 2, "b": 1})
+
+		Expect(ids(o.receive(b1))).To(BeEmpty())
+		Expect(ids(o.receive(a2))).To(BeEmpty())
+		Expect(ids(o.receive(a1))).To(Equal([]string{"a1", "a2", "b1"}))
+	})
+
+	It("delivers the concurrent messages as they arrive", func() {
+		o := newCausalOrder()
+
+		Expect(ids(o.receive(causalElement("b1", "b", map[string]uint64{"b": 1})))).To(Equal([]string{"b1"}))
+		Expect(ids(o.receive(causalElement("a1", "a", map[string]uint64{"a": 1})))).To(Equal([]string{"a1"}))
+		Expect(ids(o.receive(buffer.Element{ID: "c1", Origin: "c"}))).To(Equal([]string{"c1"}))
+	})
+
+	It("delivers the messages which waited too long", func() {
+		o := newCausalOrder()
+
+		a2 := causalElement("a2", "a", map[string]uint64{"a": 2})
+		b1 := causalElement("b1", "b", map[string]uint64{"a": 2, "b": 1})
+
+		Expect(o.receive(a2)).To(BeEmpty())
+		Expect(o.receive(b1)).To(BeEmpty())
+
+		expired, released := o.expire(time.Hour)
+		Expect(expired).To(BeEmpty())
+		Expect(released).To(BeEmpty())
+
+		expired, released = o.expire(0)
+		Expect(ids(expired)).To(Equal([]string{"a2"}))
+		Expect(ids(released)).To(Equal([]string{"a2", "b1"}))
+
+		// the skipped message is delivered when it arrives
+		Expect(ids(o.receive(causalElement("a1", "a", map[string]uint64{"a": 1})))).To(Equal([]string{"a1"}))
+	})
+
+	It("stamps the messages added with causal ordering", func() {
+		b := newTestNode("19999", func(cfg *Config) {
+			cfg.Ordering = CausalOrdering
+		})
+
+		Expect(b.AddMessage("first", NOCALLBACK)).To(Succeed())
+		Expect(b.AddMessage("second", NOCALLBACK)).To(Succeed())
+
+		clocks := []uint64{}
+		for _, m := range b.GetMessagesByType(NOCALLBACK) {
+			clocks = append(clocks, m.VectorClock["localhost:19999"])
+		}
+
+		Expect(clocks).To(ConsistOf(uint64(1), uint64(2)))
+	})
+})
+
+var _ = Describe("FIFO ordering", func() {
+	ids := func(elements []buffer.Element) []string {
+		result := []string{}
+		for _, el := range elements {
+			result = append(result, el.ID)
+		}
+
+		return result
+	}
+
+	sequenced := func(id, origin string, seq uint64) buffer.Element {
+		return buffer.Element{ID: id, Origin: origin, Seq: seq, SeqEpoch: 1}
+	}
+
+	It("delivers the messages of each origin in order", func() {
+		o := newFIFOOrder()
+
+		Expect(ids(o.receive(sequenced("a3", "a", 3)))).To(BeEmpty())
+		Expect(ids(o.receive(sequenced("b1", "b", 1)))).To(Equal([]string{"b1"}))
+		Expect(ids(o.receive(sequenced("a2", "a", 2)))).To(BeEmpty())
+		Expect(ids(o.receive(sequenced("a1", "a", 1)))).To(Equal([]string{"a1", "a2", "a3"}))
+		Expect(ids(o.receive(buffer.Element{ID: "c", Origin: "c"}))).To(Equal([]string{"c"}))
+	})
+
+	It("drops the duplicates", func() {
+		o := newFIFOOrder()
+
+		Expect(o.receive(sequenced("a2", "a", 2))).To(BeEmpty())
+		Expect(o.receive(sequenced("a2-again", "a", 2))).To(BeEmpty())
+		Expect(ids(o.receive(sequenced("a1", "a", 1)))).To(Equal([]string{"a1", "a2"}))
+		Expect(o.receive(sequenced("a1-again", "a", 1))).To(BeEmpty())
+	})
+
+	It("starts again when the origin restarts", func() {
+		o := newFIFOOrder()
+
+		Expect(o.receive(sequenced("a1", "a", 1))).To(HaveLen(1))
+
+		restarted := sequenced("a1-restarted", "a", 1)
+		restarted.SeqEpoch = 2
+		Expect(ids(o.receive(restarted))).To(Equal([]string{"a1-restarted"}))
+	})
+
+	It("skips the missing messages after the max delay", func() {
+		o := newFIFOOrder()
+
+		Expect(o.receive(sequenced("a4", "a", 4))).To(BeEmpty())
+		Expect(o.receive(sequenced("a2", "a", 2))).To(BeEmpty())
+
+		expired, released := o.expire(0)
+		Expect(ids(expired)).To(Equal([]string{"a2", "a4"}))
+		Expect(ids(released)).To(Equal([]string{"a2", "a4"}))
+
+		// the skipped messages are dropped when they arrive
+		Expect(o.receive(sequenced("a3", "a", 3))).To(BeEmpty())
+		Expect(ids(o.receive(sequenced("a5", "a", 5)))).To(Equal([]string{"a5"}))
+	})
+
+	It("delivers the ordered messages in the order in which they were added", func() {
+		transport := NewMemoryTransport()
+		fifo := func(cfg *Config) {
+			cfg.Ordering = FIFOOrdering
+		}
+
+		sender := startTestNode("1", withTransport(transport), fifo)
+		defer sender.Stop() // nolint: errcheck
+
+		receiver := startTestNode("2", withTransport(transport), fifo)
+		defer receiver.Stop() // nolint: errcheck
+
+		deliveries := receiver.Subscribe()
+
+		for i := 0; i < 10; i++ {
+			Expect(sender.AddMessageOrdered(i, NOCALLBACK)).To(Succeed())
+		}
+
+		Expect(sender.AddPeer("localhost", "2")).To(Succeed())
+
+		for i := 0; i < 10; i++ {
+			var m Message
+			Eventually(deliveries, time.Second*5).Should(Receive(&m))
+			Expect(m.Seq).To(Equal(uint64(i + 1)))
+			Expect(m.Payload).To(BeNumerically("==", i))
+		}
+	})
+})
@@ -0,0 +1,158 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+// defaultPassiveViewFactor is the size of the passive view, relative to the active view.
+const defaultPassiveViewFactor = 6
+
+// PartialView configures the partial view membership (HyParView-style): the
+// peers buffer is the active view, bounded to ActiveSize peers, and the other
+// known peers are kept in a passive view, from which failed active peers are
+// replaced. Both views are refreshed by the peer exchange of gossip messages.
+type PartialView struct {
+	// ActiveSize is the maximum number of peers in the active view
+	// Optional (default: the partial view is disabled)
+	ActiveSize int
+	// PassiveSize is the maximum number of peers in the passive view
+	// Optional (default: 6 * ActiveSize)
+	PassiveSize int
+}
+
+// enabled returns true if the partial view is enabled.
+func (v PartialView) enabled() bool {
+	return v.ActiveSize > 0
+}
+
+// passiveView keeps the known peers which are not in the active view.
+type passiveView struct {
+	peers []Peer
+	mux   sync.Mutex
+}
+
+// newPassiveView creates a passiveView.
+func newPassiveView() *passiveView {
+	return &passiveView{
+		peers: []Peer{},
+	}
+}
+
+// add adds given peer in the passive view. When the view is full, a random peer is replaced.
+func (v *passiveView) add(p Peer, size int) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	p.Roles = 0
+
+	for _, q := range v.peers {
+		if q == p {
+			return
+		}
+	}
+
+	if len(v.peers) < size {
+		v.peers = append(v.peers, p)
+		return
+	}
+
+	if size > 0 {
+		v.peers[rand.Intn(len(v.peers))] = p
+	}
+}
+
+// remove removes given peer from the passive view.
+func (v *passiveView) remove(addr, port string) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	for i, q := range v.peers {
+		if q.Addr == addr && q.Port == port {
+			v.peers = append(v.peers[:i], v.peers[i+1:]...)
+			return
+		}
+	}
+}
+
+// pop removes and returns a random peer from the passive view.
+func (v *passiveView) pop() (Peer, bool) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	if len(v.peers) == 0 {
+		return Peer{}, false
+	}
+
+	i := rand.Intn(len(v.peers))
+	p := v.peers[i]
+	v.peers = append(v.peers[:i], v.peers[i+1:]...)
+
+	return p, true
+}
+
+// list returns the peers from the passive view.
+func (v *passiveView) list() []Peer {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	return append([]Peer{}, v.peers...)
+}
+
+// toPassiveView adds given peer in the passive view, if it is not this node or an active peer.
+func (b *BMMC) toPassiveView(p Peer) {
+	if !b.config.PartialView.enabled() ||
+		(p.Addr == b.config.Addr && p.Port == b.config.Port) || b.isKnownPeer(p.Addr, p.Port) {
+		return
+	}
+
+	b.passiveView.add(p, b.config.PartialView.PassiveSize)
+}
+
+// balanceViews keeps the active view at its size: extra active peers are moved
+// at random in the passive view, and missing active peers are replaced with
+// random passive peers.
+func (b *BMMC) balanceViews() {
+	if !b.config.PartialView.enabled() {
+		return
+	}
+
+	for active := b.knownPeers(); len(active) > b.config.PartialView.ActiveSize; active = b.knownPeers() {
+		p := active[rand.Intn(len(active))]
+
+		if pp, err := peer.NewPeer(p.Addr, p.Port); err == nil {
+			b.peerBuffer.RemovePeer(pp)
+		}
+
+		b.passiveView.add(p, b.config.PartialView.PassiveSize)
+	}
+
+	for b.peerBuffer.Length() < b.config.PartialView.ActiveSize {
+		p, ok := b.passiveView.pop()
+		if !ok {
+			return
+		}
+
+		if pp, err := peer.NewPeer(p.Addr, p.Port); err == nil && !b.bans.isBanned(p.Addr, p.Port) {
+			b.peerBuffer.AddPeer(pp) // nolint: errcheck
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Partial view", func() {
+	var b *BMMC
+
+	BeforeEach(func() {
+		var err error
+		b, err = New(&Config{
+			Addr:        "localhost",
+			Port:        "19999",
+			BufferSize:  32,
+			PartialView: PartialView{ActiveSize: 2, PassiveSize: 3},
+		})
+		Expect(err).To(Succeed())
+	})
+
+	It("moves the extra active peers in the passive view", func() {
+		for i := 0; i < 4; i++ {
+			Expect(b.AddPeer("localhost", fmt.Sprintf("1000%d", i))).To(Succeed())
+		}
+
+		Expect(b.GetPeers()).To(HaveLen(2))
+		Expect(b.passiveView.list()).To(HaveLen(2))
+	})
+
+	It("bounds the passive view", func() {
+		for i := 0; i < 3; i++ {
+			Expect(b.AddPeer("localhost", fmt.Sprintf("1000%d", i))).To(Succeed())
+		}
+
+		b.mergePeers("localhost", "10000", []HTTPJoinPeer{
+			{Addr: "localhost", Port: "10005"},
+			{Addr: "localhost", Port: "10006"},
+			{Addr: "localhost", Port: "10007"},
+		})
+
+		Expect(b.GetPeers()).To(HaveLen(2))
+		Expect(b.passiveView.list()).To(HaveLen(3))
+	})
+
+	It("replaces removed active peers with passive peers", func() {
+		for i := 0; i < 3; i++ {
+			Expect(b.AddPeer("localhost", fmt.Sprintf("1000%d", i))).To(Succeed())
+		}
+
+		passive := b.passiveView.list()
+		Expect(passive).To(HaveLen(1))
+
+		for _, p := range b.knownPeers() {
+			Expect(b.RemovePeer(p.Addr, p.Port)).To(Succeed())
+			break
+		}
+
+		Expect(b.GetPeers()).To(HaveLen(2))
+		Expect(b.GetPeers()).To(ContainElement(fmt.Sprintf("%s/%s", passive[0].Addr, passive[0].Port)))
+		Expect(b.passiveView.list()).To(BeEmpty())
+	})
+
+	It("fills the default sizes", func() {
+		cfg := &Config{PartialView: PartialView{ActiveSize: 4}}
+		cfg.fillEmptyFields()
+
+		Expect(cfg.PartialView.PassiveSize).To(Equal(24))
+		Expect(cfg.PeerExchangeSize).To(Equal(4))
+	})
+})
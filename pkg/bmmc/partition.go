@@ -0,0 +1,120 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	partitionLogFmt        = "BMMC %s:%s lost peer %s:%s, which may be in another partition"
+	partitionHealLogFmt    = "BMMC %s:%s reached peer %s:%s again after %s, reconciling the messages buffers"
+	partitionHealErrLogFmt = "BMMC %s:%s could not reconcile the messages buffers with %s:%s: %s"
+)
+
+// partitions keeps the peers which are unreachable, i.e. to which
+// PeerFailureThreshold consecutive requests failed, with the time since when
+// they are unreachable.
+type partitions struct {
+	unreachable map[string]time.Time
+	mux         sync.Mutex
+}
+
+// newPartitions creates an empty partitions.
+func newPartitions() *partitions {
+	return &partitions{
+		unreachable: map[string]time.Time{},
+	}
+}
+
+// markUnreachable marks given peer as unreachable. It returns false if the
+// peer was already unreachable.
+func (p *partitions) markUnreachable(addr, port string) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if _, ok := p.unreachable[fullHost(addr, port)]; ok {
+		return false
+	}
+
+	p.unreachable[fullHost(addr, port)] = time.Now()
+
+	return true
+}
+
+// markReachable marks given peer as reachable. It returns the duration in
+// which the peer was unreachable, and false if the peer was not unreachable.
+func (p *partitions) markReachable(addr, port string) (time.Duration, bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	since, ok := p.unreachable[fullHost(addr, port)]
+	if !ok {
+		return 0, false
+	}
+
+	delete(p.unreachable, fullHost(addr, port))
+
+	return time.Since(since), true
+}
+
+// list returns the hosts of the unreachable peers, sorted.
+func (p *partitions) list() []string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	hosts := make([]string, 0, len(p.unreachable))
+	for h := range p.unreachable {
+		hosts = append(hosts, h)
+	}
+
+	sort.Strings(hosts)
+
+	return hosts
+}
+
+// peerUnreachable marks given peer as unreachable, since it may be in another
+// partition.
+func (b *BMMC) peerUnreachable(addr, port string) {
+	if b.partitions.markUnreachable(addr, port) {
+		b.logf(GossipComponent, WarnLevel, partitionLogFmt, b.config.Addr, b.config.Port, addr, port)
+	}
+}
+
+// peerReachable marks given peer as reachable. When the peer was unreachable,
+// the partition healed, so the messages buffers are reconciled with the peer
+// immediately, in both directions, instead of waiting for the peer to be
+// selected in a round.
+func (b *BMMC) peerReachable(addr, port string) {
+	d, ok := b.partitions.markReachable(addr, port)
+	if !ok {
+		return
+	}
+
+	atomic.AddInt64(&b.counters.partitionsHealed, 1)
+
+	b.logf(GossipComponent, InfoLevel, partitionHealLogFmt, b.config.Addr, b.config.Port, addr, port, d)
+
+	b.spawn(func() {
+		if err := b.RepairWith(addr, port); err != nil {
+			b.logf(GossipComponent, WarnLevel, partitionHealErrLogFmt, b.config.Addr, b.config.Port, addr, port, err)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Partitions", func() {
+	It("keeps the unreachable peers until they are reachable again", func() {
+		p := newPartitions()
+
+		Expect(p.markUnreachable("localhost", "2")).To(BeTrue())
+		Expect(p.markUnreachable("localhost", "2")).To(BeFalse())
+		Expect(p.markUnreachable("localhost", "1")).To(BeTrue())
+		Expect(p.list()).To(Equal([]string{"localhost:1", "localhost:2"}))
+
+		_, ok := p.markReachable("localhost", "2")
+		Expect(ok).To(BeTrue())
+		_, ok = p.markReachable("localhost", "2")
+		Expect(ok).To(BeFalse())
+		Expect(p.list()).To(Equal([]string{"localhost:1"}))
+	})
+
+	It("reconciles the messages buffers with a peer when the partition heals", func() {
+		transport := NewMemoryTransport()
+
+		first := startTestNode("1", withTransport(transport), func(cfg *Config) {
+			cfg.PeerFailureThreshold = 1
+		})
+		defer first.Stop() // nolint: errcheck
+
+		Expect(first.AddPeer("localhost", "2")).To(Succeed())
+		Expect(first.AddMessage("first-message", NOCALLBACK)).To(Succeed())
+
+		// the second node is not started, so it is unreachable
+		Eventually(func() []string {
+			return first.Status().Unreachable
+		}, time.Second*5).Should(ConsistOf("localhost:2"))
+
+		// the second node doesn't know the first one, so it never gossips to it
+		second := newTestNode("2", withTransport(transport))
+		Expect(second.AddMessage("second-message", NOCALLBACK)).To(Succeed())
+		Expect(second.Start()).To(Succeed())
+		defer second.Stop() // nolint: errcheck
+
+		Eventually(func() []string {
+			return first.Status().Unreachable
+		}, time.Second*5).Should(BeEmpty())
+		Expect(first.Stats().PartitionsHealed).To(Equal(int64(1)))
+
+		Eventually(func() []interface{} {
+			return first.GetMessages()
+		}, time.Second*5).Should(ContainElements("first-message", "second-message"))
+		Eventually(func() []interface{} {
+			return second.GetMessages()
+		}, time.Second*5).Should(ContainElements("first-message", "second-message"))
+	})
+})
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+const defaultPeerStaleTimeout = time.Minute
+
+// PeerHealth is the health of a peer, as seen by this node.
+type PeerHealth string
+
+const (
+	// HealthyPeer peers answered the last request sent to them.
+	HealthyPeer PeerHealth = "healthy"
+	// SuspectPeer peers failed the last request sent to them.
+	SuspectPeer PeerHealth = "suspect"
+	// StalePeer peers had no contact with this node for PeerStaleTimeout.
+	StalePeer PeerHealth = "stale"
+)
+
+// PeerStatus is the state of the contact with a known peer.
+type PeerStatus struct {
+	Addr string
+	Port string
+	// NodeID is the ID of the peer, if it sent a request with it
+	NodeID string
+	// Health is the health of the peer
+	Health PeerHealth
+	// LastSeen is the time when the peer was added or last sent a request
+	LastSeen time.Time
+	// LastSuccess is the time of the last successful request sent to the peer
+	LastSuccess time.Time
+	// LastFailure is the time of the last failed request sent to the peer
+	LastFailure time.Time
+	// RTT is the smoothed round trip time of successful requests
+	RTT time.Duration
+	// Requests is the number of requests sent to the peer
+	Requests int
+	// Failures is the number of failed requests sent to the peer
+	Failures int
+	// Quarantined is true if the peer is not selected for gossip, because it
+	// failed consistently or answered slowly (see QuarantineDuration)
+	Quarantined bool
+}
+
+// health returns the health of a peer with given status.
+func (s PeerStatus) health(now time.Time, staleTimeout time.Duration) PeerHealth {
+	last := s.LastSeen
+	if s.LastSuccess.After(last) {
+		last = s.LastSuccess
+	}
+
+	switch {
+	case s.LastFailure.After(s.LastSuccess):
+		if now.Sub(last) > staleTimeout {
+			return StalePeer
+		}
+
+		return SuspectPeer
+	case now.Sub(last) > staleTimeout:
+		return StalePeer
+	default:
+		return HealthyPeer
+	}
+}
+
+// GetPeerStatuses returns the status of the known peers, sorted by host.
+func (b *BMMC) GetPeerStatuses() []PeerStatus {
+	scores := map[string]PeerScore{}
+	for _, s := range b.peerScores.list() {
+		scores[fullHost(s.Addr, s.Port)] = s
+	}
+
+	now := time.Now()
+	statuses := []PeerStatus{}
+
+	for _, p := range b.knownPeers() {
+		s := PeerStatus{Addr: p.Addr, Port: p.Port, NodeID: b.nodeIDs.id(fullHost(p.Addr, p.Port))}
+
+		if pp, err := peer.NewPeer(p.Addr, p.Port); err == nil {
+			s.LastSeen = b.peerBuffer.LastSeen(pp)
+		}
+
+		if score, ok := scores[fullHost(p.Addr, p.Port)]; ok {
+			s.LastSuccess = score.LastSuccess
+			s.LastFailure = score.LastFailure
+			s.RTT = score.RTT
+			s.Requests = score.Requests
+			s.Failures = score.Failures
+			s.Quarantined = score.Quarantined(now)
+		}
+
+		s.Health = s.health(now, b.config.PeerStaleTimeout)
+		statuses = append(statuses, s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return fullHost(statuses[i].Addr, statuses[i].Port) < fullHost(statuses[j].Addr, statuses[j].Port)
+	})
+
+	return statuses
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Peer statuses", func() {
+	It("reports the health of peers", func() {
+		now := time.Now()
+		timeout := time.Minute
+
+		Expect(PeerStatus{LastSeen: now}.health(now, timeout)).To(Equal(HealthyPeer))
+		Expect(PeerStatus{LastSeen: now.Add(-time.Hour), LastSuccess: now}.health(now, timeout)).To(Equal(HealthyPeer))
+		Expect(PeerStatus{LastSuccess: now.Add(-time.Second), LastFailure: now}.health(now, timeout)).To(Equal(SuspectPeer))
+		Expect(PeerStatus{LastSeen: now.Add(-time.Hour)}.health(now, timeout)).To(Equal(StalePeer))
+		Expect(PeerStatus{LastSuccess: now.Add(-time.Hour), LastFailure: now}.health(now, timeout)).To(Equal(StalePeer))
+	})
+
+	It("returns the status of known peers", func() {
+		b, err := New(&Config{
+			Addr:          "localhost",
+			Port:          "1",
+			BufferSize:    16,
+			RoundDuration: 20 * time.Millisecond,
+			Transport:     NewMemoryTransport(),
+			Logger:        log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+
+		Expect(b.AddPeer("localhost", "3")).To(Succeed())
+		Expect(b.AddPeer("localhost", "2")).To(Succeed())
+
+		b.peerScores.record("localhost", "2", time.Millisecond, false)
+		b.peerScores.record("localhost", "3", time.Millisecond, false)
+		b.peerScores.record("localhost", "3", time.Millisecond, true)
+
+		statuses := b.GetPeerStatuses()
+		Expect(statuses).To(HaveLen(2))
+
+		Expect(statuses[0].Port).To(Equal("2"))
+		Expect(statuses[0].Health).To(Equal(HealthyPeer))
+		Expect(statuses[0].LastSeen).NotTo(BeZero())
+		Expect(statuses[0].LastSuccess).NotTo(BeZero())
+		Expect(statuses[0].RTT).To(Equal(time.Millisecond))
+
+		Expect(statuses[1].Port).To(Equal("3"))
+		Expect(statuses[1].Health).To(Equal(SuspectPeer))
+		Expect(statuses[1].LastFailure).NotTo(BeZero())
+	})
+})
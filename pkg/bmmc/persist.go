@@ -0,0 +1,154 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+const (
+	// persistFileMode is the mode of persisted files
+	persistFileMode = 0o600
+
+	loadPeersErrFmt    = "error at loading peers from %s: %w"
+	savePeersLogErrFmt = "Error at saving peers in %s: %s"
+)
+
+// persistedPeer is a peer, as it is saved on disk.
+type persistedPeer struct {
+	Addr string `json:"addr"`
+	Port string `json:"port"`
+}
+
+// writeFileAtomic writes given data in a temporary file which replaces the
+// given file, so readers never see partially written files.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() // nolint: errcheck
+		return err
+	}
+
+	if err := tmp.Chmod(persistFileMode); err != nil {
+		tmp.Close() // nolint: errcheck
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadPeers adds the peers saved in given file in peers buffer.
+// A missing file means there are no saved peers.
+func loadPeers(path string, peerBuffer *peer.Buffer) error {
+	raw, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf(loadPeersErrFmt, path, err)
+	}
+
+	var peers []persistedPeer
+	if err := json.Unmarshal(raw, &peers); err != nil {
+		return fmt.Errorf(loadPeersErrFmt, path, err)
+	}
+
+	for _, pp := range peers {
+		p, err := peer.NewPeer(pp.Addr, pp.Port)
+		if err != nil {
+			return fmt.Errorf(loadPeersErrFmt, path, err)
+		}
+
+		if err := peerBuffer.AddPeer(p); err != nil {
+			return fmt.Errorf(loadPeersErrFmt, path, err)
+		}
+	}
+
+	return nil
+}
+
+// peersSaver saves the peers buffer in a file, each time it changes.
+type peersSaver struct {
+	path       string
+	peerBuffer *peer.Buffer
+	mux        sync.Mutex
+}
+
+// save saves the peers from peers buffer.
+func (s *peersSaver) save() error {
+	// peers are read under lock, so concurrent saves don't write older peers last
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	bufPeers := s.peerBuffer.Peers()
+
+	peers := make([]persistedPeer, len(bufPeers))
+	for i, p := range bufPeers {
+		peers[i] = persistedPeer{Addr: p.Addr(), Port: p.Port()}
+	}
+
+	raw, err := json.Marshal(peers)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, raw)
+}
+
+// persistPeers loads the peers saved in PeersFile and saves the peers buffer
+// each time it changes.
+func (b *BMMC) persistPeers() error {
+	if b.config.PeersFile == "" {
+		return nil
+	}
+
+	if err := loadPeers(b.config.PeersFile, b.peerBuffer); err != nil {
+		return err
+	}
+
+	saver := &peersSaver{
+		path:       b.config.PeersFile,
+		peerBuffer: b.peerBuffer,
+	}
+
+	b.peerBuffer.OnChange(func() {
+		if err := saver.save(); err != nil {
+			b.logf(StoreComponent, ErrorLevel, savePeersLogErrFmt, b.config.PeersFile, err)
+		}
+	})
+
+	return nil
+}
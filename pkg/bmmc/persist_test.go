@@ -0,0 +1,69 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+var _ = Describe("Persistence", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "bmmc")
+		Expect(err).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("loads the saved peers", func() {
+		path := filepath.Join(dir, "peers.json")
+
+		saved := peer.NewPeerBuffer()
+		p, err := peer.NewPeer("localhost", "10000")
+		Expect(err).To(Succeed())
+		Expect(saved.AddPeer(p)).To(Succeed())
+		Expect((&peersSaver{path: path, peerBuffer: saved}).save()).To(Succeed())
+
+		loaded := peer.NewPeerBuffer()
+		Expect(loadPeers(path, loaded)).To(Succeed())
+		Expect(loaded.Peers()).To(Equal(saved.Peers()))
+	})
+
+	It("doesn't load any peer when the file doesn't exist", func() {
+		loaded := peer.NewPeerBuffer()
+		Expect(loadPeers(filepath.Join(dir, "missing.json"), loaded)).To(Succeed())
+		Expect(loaded.Length()).To(Equal(0))
+	})
+
+	It("returns error when the file is invalid", func() {
+		path := filepath.Join(dir, "peers.json")
+		Expect(ioutil.WriteFile(path, []byte("invalid"), persistFileMode)).To(Succeed())
+
+		Expect(loadPeers(path, peer.NewPeerBuffer())).NotTo(Succeed())
+	})
+})
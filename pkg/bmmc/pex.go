@@ -0,0 +1,89 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+// peerSample returns a random sample of known peers, without given target,
+// to be sent in the gossip message for the target.
+func (b *BMMC) peerSample(target Peer) []HTTPJoinPeer {
+	if b.config.PeerExchangeSize == 0 {
+		return nil
+	}
+
+	known := b.knownPeers()
+	if b.config.PartialView.enabled() {
+		known = append(known, b.passiveView.list()...)
+	}
+
+	candidates := []Peer{}
+
+	for _, p := range b.bans.withoutBanned(known) {
+		if p.Addr != target.Addr || p.Port != target.Port {
+			candidates = append(candidates, p)
+		}
+	}
+
+	sample := NewRandomSelector().Select(candidates, b.config.PeerExchangeSize)
+
+	peers := make([]HTTPJoinPeer, len(sample))
+	for i, p := range sample {
+		peers[i] = HTTPJoinPeer{Addr: p.Addr, Port: p.Port}
+	}
+
+	return peers
+}
+
+// mergePeers adds the sender of a gossip message and the peers sampled by it in
+// peers buffer. Peers are merged only if peer exchange is enabled.
+// With partial view, the sampled peers are added in the passive view.
+func (b *BMMC) mergePeers(addr, port string, sample []HTTPJoinPeer) {
+	if b.sampler != nil {
+		b.sampler.observe(Peer{Addr: addr, Port: port})
+
+		for _, jp := range sample {
+			b.sampler.observe(Peer{Addr: jp.Addr, Port: jp.Port})
+		}
+	}
+
+	if b.config.PeerExchangeSize == 0 {
+		return
+	}
+
+	for i, jp := range append([]HTTPJoinPeer{{Addr: addr, Port: port}}, sample...) {
+		if (jp.Addr == b.config.Addr && jp.Port == b.config.Port) || b.bans.isBanned(jp.Addr, jp.Port) {
+			continue
+		}
+
+		if i > 0 && b.config.PartialView.enabled() {
+			b.toPassiveView(Peer{Addr: jp.Addr, Port: jp.Port})
+			continue
+		}
+
+		p, err := peer.NewPeer(jp.Addr, jp.Port)
+		if err != nil {
+			continue
+		}
+
+		// peers which are already known are kept
+		b.peerBuffer.AddPeer(p) // nolint: errcheck
+	}
+
+	b.balanceViews()
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+var _ = Describe("Peer exchange", func() {
+	var b *BMMC
+
+	BeforeEach(func() {
+		b = &BMMC{
+			config:     &Config{Addr: "localhost", Port: "19999", PeerExchangeSize: 2},
+			peerBuffer: peer.NewPeerBuffer(),
+			peerRoles:  newPeerRoles(),
+			bans:       newBans(),
+		}
+
+		for _, port := range []string{"10001", "10002", "10003"} {
+			p, err := peer.NewPeer("localhost", port)
+			Expect(err).To(Succeed())
+			Expect(b.peerBuffer.AddPeer(p)).To(Succeed())
+		}
+	})
+
+	It("samples known peers without the target", func() {
+		target := Peer{Addr: "localhost", Port: "10001"}
+
+		for i := 0; i < 10; i++ {
+			sample := b.peerSample(target)
+			Expect(sample).To(HaveLen(2))
+			Expect(sample).NotTo(ContainElement(HTTPJoinPeer{Addr: target.Addr, Port: target.Port}))
+		}
+	})
+
+	It("doesn't sample peers if peer exchange is disabled", func() {
+		b.config.PeerExchangeSize = 0
+		Expect(b.peerSample(Peer{Addr: "localhost", Port: "10001"})).To(BeNil())
+	})
+
+	It("merges the sender and the sampled peers", func() {
+		b.mergePeers("localhost", "10004", []HTTPJoinPeer{
+			{Addr: "localhost", Port: "10001"},
+			{Addr: "localhost", Port: "10005"},
+			{Addr: "localhost", Port: "19999"},
+		})
+
+		Expect(b.GetPeers()).To(ConsistOf(
+			"localhost/10001", "localhost/10002", "localhost/10003", "localhost/10004", "localhost/10005"))
+	})
+
+	It("doesn't merge banned peers", func() {
+		Expect(b.BanPeer("localhost", "10005", time.Minute)).To(Succeed())
+
+		b.mergePeers("localhost", "10004", []HTTPJoinPeer{{Addr: "localhost", Port: "10005"}})
+		Expect(b.GetPeers()).NotTo(ContainElement("localhost/10005"))
+	})
+})
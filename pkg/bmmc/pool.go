@@ -0,0 +1,72 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMaxIdleConnsPerHost = 16
+	defaultDialTimeout         = time.Second * 5
+	defaultIdleConnTimeout     = time.Second * 90
+
+	// tcpKeepAlive is the interval of the keep-alive probes of the connections to peers
+	tcpKeepAlive = time.Second * 30
+)
+
+// newPooledTransport creates the transport of the requests sent to peers,
+// which keeps the connections alive and reuses them across requests.
+func newPooledTransport(cfg *Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: tcpKeepAlive,
+	}
+
+	t.DialContext = dialer.DialContext
+	t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	t.IdleConnTimeout = cfg.IdleConnTimeout
+
+	return t
+}
+
+// poolTransport counts the connections opened and reused by the requests sent to peers.
+type poolTransport struct {
+	next     http.RoundTripper
+	counters *counters
+}
+
+// RoundTrip sends given request, tracing the connection it gets.
+func (t *poolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&t.counters.connectionsReused, 1)
+			} else {
+				atomic.AddInt64(&t.counters.connectionsOpened, 1)
+			}
+		},
+	}
+
+	return t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection pool", func() {
+	It("reuses the connections to peers", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		cfg := &Config{}
+		cfg.fillEmptyFields()
+
+		c := &counters{}
+		client := &http.Client{
+			Transport: &poolTransport{next: newPooledTransport(cfg), counters: c},
+			Timeout:   time.Second * 5,
+		}
+
+		for i := 0; i < 3; i++ {
+			resp, err := client.Get(server.URL)
+			Expect(err).To(Succeed())
+
+			_, err = io.Copy(ioutil.Discard, resp.Body)
+			Expect(err).To(Succeed())
+			Expect(resp.Body.Close()).To(Succeed())
+		}
+
+		Expect(c.connectionsOpened).To(Equal(int64(1)))
+		Expect(c.connectionsReused).To(Equal(int64(2)))
+	})
+})
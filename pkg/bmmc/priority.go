@@ -0,0 +1,98 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	urgentGossipLogErrFmt = "BMMC %s:%s could not push urgent message %s to %s:%s: %s"
+)
+
+var (
+	errInvalidPriority = errors.New("invalid priority")
+)
+
+// Priority is the priority of a message.
+type Priority int
+
+const (
+	// NormalPriority messages are gossiped in the regular rounds.
+	NormalPriority Priority = iota
+	// HighPriority messages are pushed immediately to a beta fraction of the
+	// peers, outside the regular rounds, e.g. for control plane events. Each
+	// node which receives a high priority message for the first time pushes it
+	// further in the same way, and the message is gossiped in the rounds too.
+	HighPriority
+)
+
+// AddMessageWithPriority adds new message with given priority in messages
+// buffer. High priority messages are pushed immediately, without waiting for
+// the next round.
+func (b *BMMC) AddMessageWithPriority(msg interface{}, callbackType string, priority Priority) error {
+	if priority < NormalPriority || priority > HighPriority {
+		return errInvalidPriority
+	}
+
+	m, err := b.newElement(msg, callbackType)
+	if err != nil {
+		return err
+	}
+
+	m.Priority = int(priority)
+
+	elements, err := b.addElement(context.Background(), m)
+	if err != nil {
+		return err
+	}
+
+	b.flushUrgent(elements)
+
+	return nil
+}
+
+// flushUrgent pushes given elements in background to the peers selected for
+// gossip, if they have high priority.
+func (b *BMMC) flushUrgent(elements []buffer.Element) {
+	urgent := []buffer.Element{}
+
+	for _, el := range elements {
+		if Priority(el.Priority) == HighPriority && !el.Reassembled {
+			urgent = append(urgent, el)
+		}
+	}
+
+	if len(urgent) == 0 || !b.config.Roles.Has(GossiperRole) {
+		return
+	}
+
+	ctx := b.runContext()
+	peers := b.gossipTargets()
+
+	b.spawn(func() {
+		for _, r := range b.push(ctx, urgent, peers) {
+			if r.Err != nil {
+				b.logf(GossipComponent, DebugLevel, urgentGossipLogErrFmt,
+					b.config.Addr, b.config.Port, urgent[0].ID, r.Peer.Addr, r.Peer.Port, r.Err)
+			}
+		}
+	})
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Priorities", func() {
+	var nodes []*BMMC
+
+	BeforeEach(func() {
+		transport := NewMemoryTransport()
+		nodes = []*BMMC{}
+
+		// the rounds are never run, so only the pushed messages are disseminated
+		for _, port := range []string{"1", "2", "3"} {
+			b, err := New(&Config{
+				Addr:       "localhost",
+				Port:       port,
+				BufferSize: 16,
+				Scheduler:  NewManualScheduler(),
+				Transport:  transport,
+				Logger:     log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+			Expect(b.Start()).To(Succeed())
+
+			nodes = append(nodes, b)
+		}
+
+		// the nodes form a chain
+		Expect(nodes[0].AddPeer("localhost", "2")).To(Succeed())
+		Expect(nodes[1].AddPeer("localhost", "3")).To(Succeed())
+	})
+
+	AfterEach(func() {
+		for _, b := range nodes {
+			Expect(b.Stop()).To(Succeed())
+		}
+	})
+
+	It("pushes the high priority messages immediately, from node to node", func() {
+		Expect(nodes[0].AddMessageWithPriority("urgent message", NOCALLBACK, HighPriority)).To(Succeed())
+
+		for _, b := range nodes[1:] {
+			Eventually(b.GetMessages, time.Second).Should(ContainElement("urgent message"))
+		}
+
+		m := nodes[2].GetMessagesByType(NOCALLBACK)
+		Expect(m).To(HaveLen(1))
+		Expect(m[0].Priority).To(Equal(HighPriority))
+	})
+
+	It("gossips the normal priority messages in the rounds", func() {
+		Expect(nodes[0].AddMessageWithPriority("normal message", NOCALLBACK, NormalPriority)).To(Succeed())
+
+		Consistently(nodes[1].GetMessages, time.Millisecond*300).ShouldNot(ContainElement("normal message"))
+	})
+
+	It("returns error for invalid priorities", func() {
+		Expect(nodes[0].AddMessageWithPriority("message", NOCALLBACK, HighPriority+1)).To(MatchError(errInvalidPriority))
+	})
+})
@@ -0,0 +1,131 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"errors"
+	"time"
+)
+
+// Profile is a named set of tuning parameters for a deployment.
+type Profile string
+
+const (
+	// LANSmallProfile is for a few tens of nodes on a local network: high
+	// fanout and short rounds.
+	LANSmallProfile Profile = "lan-small"
+	// LANLargeProfile is for hundreds of nodes or more on a local network:
+	// low fanout, and rounds lengthened while there are no new messages.
+	LANLargeProfile Profile = "lan-large"
+	// WANProfile is for nodes spread over regions: longer, jittered rounds
+	// and retransmissions.
+	WANProfile Profile = "wan"
+	// LossyEdgeProfile is for unreliable edge networks: long rounds, a small
+	// buffer, and a fanout raised with the estimated loss.
+	LossyEdgeProfile Profile = "lossy-edge"
+)
+
+var errUnknownProfile = errors.New("unknown profile")
+
+// profileParams are the parameters set by a profile.
+type profileParams struct {
+	beta              float64
+	adaptiveBeta      bool
+	roundDuration     time.Duration
+	maxRoundDuration  time.Duration
+	roundJitter       time.Duration
+	bufferSize        int
+	retransmitTimeout time.Duration
+}
+
+// profiles are the parameters of each profile.
+var profiles = map[Profile]profileParams{
+	LANSmallProfile: {
+		beta:              0.5,
+		roundDuration:     time.Millisecond * 100,
+		bufferSize:        1024,
+		retransmitTimeout: time.Millisecond * 500,
+	},
+	LANLargeProfile: {
+		beta:              0.1,
+		roundDuration:     time.Millisecond * 200,
+		maxRoundDuration:  time.Second * 2,
+		roundJitter:       time.Millisecond * 50,
+		bufferSize:        4096,
+		retransmitTimeout: time.Second,
+	},
+	WANProfile: {
+		beta:              0.3,
+		roundDuration:     time.Millisecond * 500,
+		maxRoundDuration:  time.Second * 5,
+		roundJitter:       time.Millisecond * 200,
+		bufferSize:        2048,
+		retransmitTimeout: time.Second * 3,
+	},
+	LossyEdgeProfile: {
+		beta:              0.5,
+		adaptiveBeta:      true,
+		roundDuration:     time.Second,
+		maxRoundDuration:  time.Second * 10,
+		roundJitter:       time.Millisecond * 500,
+		bufferSize:        512,
+		retransmitTimeout: time.Second * 5,
+	},
+}
+
+// applyProfile sets the parameters of the configured profile in the fields
+// which were not set.
+func (cfg *Config) applyProfile() error {
+	if cfg.Profile == "" {
+		return nil
+	}
+
+	p, ok := profiles[cfg.Profile]
+	if !ok {
+		return errUnknownProfile
+	}
+
+	if cfg.Beta == 0 {
+		cfg.Beta = p.beta
+	}
+
+	if p.adaptiveBeta {
+		cfg.AdaptiveBeta = true
+	}
+
+	if cfg.RoundDuration == 0 {
+		cfg.RoundDuration = p.roundDuration
+	}
+
+	if cfg.MaxRoundDuration == 0 && p.maxRoundDuration > cfg.RoundDuration {
+		cfg.MaxRoundDuration = p.maxRoundDuration
+	}
+
+	if cfg.RoundJitter == 0 {
+		cfg.RoundJitter = p.roundJitter
+	}
+
+	if cfg.BufferSize == 0 {
+		cfg.BufferSize = p.bufferSize
+	}
+
+	if cfg.RetransmitTimeout == 0 {
+		cfg.RetransmitTimeout = p.retransmitTimeout
+	}
+
+	return nil
+}
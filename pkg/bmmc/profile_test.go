@@ -0,0 +1,81 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profiles", func() {
+	DescribeTable("set valid parameters",
+		func(profile Profile) {
+			cfg := &Config{Addr: "localhost", Port: "1", Profile: profile}
+
+			Expect(cfg.applyProfile()).To(Succeed())
+			Expect(cfg.validate()).To(Succeed())
+
+			Expect(cfg.Beta).To(Equal(profiles[profile].beta))
+			Expect(cfg.RoundDuration).To(Equal(profiles[profile].roundDuration))
+			Expect(cfg.BufferSize).To(Equal(profiles[profile].bufferSize))
+			Expect(cfg.RetransmitTimeout).To(Equal(profiles[profile].retransmitTimeout))
+		},
+		Entry("lan-small", LANSmallProfile),
+		Entry("lan-large", LANLargeProfile),
+		Entry("wan", WANProfile),
+		Entry("lossy-edge", LossyEdgeProfile),
+	)
+
+	It("doesn't override the given parameters", func() {
+		cfg := &Config{
+			Profile:       WANProfile,
+			Beta:          0.7,
+			RoundDuration: time.Second * 10,
+			BufferSize:    8,
+		}
+
+		Expect(cfg.applyProfile()).To(Succeed())
+
+		Expect(cfg.Beta).To(Equal(0.7))
+		Expect(cfg.RoundDuration).To(Equal(time.Second * 10))
+		Expect(cfg.BufferSize).To(Equal(8))
+		Expect(cfg.MaxRoundDuration).To(BeZero())
+		Expect(cfg.RoundJitter).To(Equal(profiles[WANProfile].roundJitter))
+	})
+
+	It("returns error for unknown profiles", func() {
+		_, err := New(&Config{Addr: "localhost", Port: "1", Profile: "unknown"})
+		Expect(err).To(MatchError(errUnknownProfile))
+	})
+
+	It("creates nodes without buffer size", func() {
+		b, err := New(&Config{
+			Addr:      "localhost",
+			Port:      "1",
+			Profile:   LossyEdgeProfile,
+			Transport: NewMemoryTransport(),
+			Logger:    log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+		Expect(b.config.AdaptiveBeta).To(BeTrue())
+	})
+})
@@ -0,0 +1,160 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	metricsRoute = "/metrics"
+
+	// metricsContentType is the content type of the Prometheus text format
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	metricsHandlerErrLogFmt = "Error in metrics handler: %s"
+)
+
+// metric is a sample in the Prometheus text format.
+type metric struct {
+	name  string
+	help  string
+	kind  string
+	value float64
+}
+
+// peerMetric is a metric with a sample for each peer.
+type peerMetric struct {
+	name  string
+	help  string
+	kind  string
+	value func(PeerScore) float64
+}
+
+// labelEscaper escapes the values of Prometheus labels.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`) // nolint: gochecknoglobals
+
+// WriteMetrics writes the protocol counters and the per-peer counters in w, in
+// the Prometheus text format.
+func (b *BMMC) WriteMetrics(w io.Writer) error {
+	s := b.Stats()
+
+	metrics := []metric{
+		{"bmmc_rounds_total", "Gossip rounds run.", "counter", float64(s.Rounds)},
+		{"bmmc_messages_added_total", "Messages added on this node.", "counter", float64(s.MessagesAdded)},
+		{"bmmc_messages_delivered_total", "Messages received from peers.", "counter", float64(s.MessagesDelivered)},
+		{"bmmc_messages_rejected_total", "Messages from peers rejected because they were not authenticated.", "counter",
+			float64(s.MessagesRejected)},
+		{"bmmc_buffer_messages", "Messages in buffer.", "gauge", float64(s.Messages)},
+		{"bmmc_buffer_bytes", "Approximate size of the messages in buffer.", "gauge", float64(s.BufferBytes)},
+		{"bmmc_tombstones", "Tombstones of removed messages.", "gauge", float64(s.Tombstones)},
+		{"bmmc_peers", "Peers in peers buffer.", "gauge", float64(s.Peers)},
+		{"bmmc_gossips_sent_total", "Gossip messages sent to peers.", "counter", float64(s.GossipsSent)},
+		{"bmmc_gossips_received_total", "Gossip messages received from peers.", "counter", float64(s.GossipsReceived)},
+		{"bmmc_solicitations_sent_total", "Solicitations sent to peers.", "counter", float64(s.SolicitationsSent)},
+		{"bmmc_solicitations_received_total", "Solicitations received from peers.", "counter",
+			float64(s.SolicitationsReceived)},
+		{"bmmc_synchronizations_sent_total", "Synchronizations sent to peers.", "counter",
+			float64(s.SynchronizationsSent)},
+		{"bmmc_synchronizations_received_total", "Synchronizations received from peers.", "counter",
+			float64(s.SynchronizationsReceived)},
+		{"bmmc_partitions_healed_total", "Unreachable peers which became reachable again.", "counter",
+			float64(s.PartitionsHealed)},
+		{"bmmc_peers_quarantined_total", "Peers put in quarantine.", "counter", float64(s.PeersQuarantined)},
+		{"bmmc_multicasts_sent_total", "Messages sent to the multicast group.", "counter", float64(s.MulticastsSent)},
+		{"bmmc_multicasts_received_total", "Messages of peers received from the multicast group.", "counter",
+			float64(s.MulticastsReceived)},
+		{"bmmc_callback_successes_total", "Callbacks run successfully.", "counter", float64(s.CallbackSuccesses)},
+		{"bmmc_callback_failures_total", "Callbacks which returned errors.", "counter", float64(s.CallbackFailures)},
+		{"bmmc_callback_retries_total", "Failed callbacks run again.", "counter", float64(s.CallbackRetries)},
+		{"bmmc_bytes_sent_total", "Bytes sent in requests to peers.", "counter", float64(s.BytesSent)},
+		{"bmmc_bytes_received_total", "Bytes received from peers.", "counter", float64(s.BytesReceived)},
+		{"bmmc_requests_limited_total", "Protocol requests answered with 429 Too Many Requests.", "counter",
+			float64(s.RequestsLimited)},
+		{"bmmc_connections_opened_total", "Connections opened to peers.", "counter", float64(s.ConnectionsOpened)},
+		{"bmmc_connections_reused_total", "Requests sent to peers on kept alive connections.", "counter",
+			float64(s.ConnectionsReused)},
+		{"bmmc_estimated_loss", "Estimated rate of lost requests and messages.", "gauge", s.EstimatedLoss},
+	}
+
+	bw := bufio.NewWriter(w)
+
+	for _, m := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+
+	writeHistogram(bw, "bmmc_round_duration_seconds", "Durations of gossip rounds.", s.RoundDurations)
+	writeHistogram(bw, "bmmc_synchronization_handler_seconds",
+		"Durations in which the synchronizations from peers were handled.", s.SyncLatencies)
+
+	scores := b.peerScores.list()
+	now := time.Now()
+
+	peerMetrics := []peerMetric{
+		{"bmmc_peer_requests_total", "Requests sent to the peer.", "counter",
+			func(p PeerScore) float64 { return float64(p.Requests) }},
+		{"bmmc_peer_send_errors_total", "Failed requests sent to the peer.", "counter",
+			func(p PeerScore) float64 { return float64(p.Failures) }},
+		{"bmmc_peer_rtt_seconds", "Smoothed round trip time of the requests sent to the peer.", "gauge",
+			func(p PeerScore) float64 { return p.RTT.Seconds() }},
+		{"bmmc_peer_quarantined", "Whether the peer is in quarantine.", "gauge",
+			func(p PeerScore) float64 {
+				if p.Quarantined(now) {
+					return 1
+				}
+
+				return 0
+			}},
+	}
+
+	for _, m := range peerMetrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+		for _, p := range scores {
+			fmt.Fprintf(bw, "%s{peer=\"%s\"} %g\n", m.name, labelEscaper.Replace(fullHost(p.Addr, p.Port)), m.value(p))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// MetricsHandler returns a handler which serves the metrics of the node to
+// Prometheus, e.g. on the http server of the application.
+func (b *BMMC) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", metricsContentType)
+
+		if err := b.WriteMetrics(w); err != nil {
+			b.logf(ServerComponent, ErrorLevel, metricsHandlerErrLogFmt, err)
+		}
+	})
+}
+
+// metricsHandler serves the metrics of the node on the protocol server.
+func (b *BMMC) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !b.config.Metrics {
+		http.NotFound(w, r)
+		return
+	}
+
+	b.MetricsHandler().ServeHTTP(w, r)
+}
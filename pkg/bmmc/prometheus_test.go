@@ -0,0 +1,92 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prometheus metrics", func() {
+	var transport *MemoryTransport
+
+	withMetrics := func(cfg *Config) {
+		cfg.Metrics = true
+	}
+
+	get := func(host string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, "http://"+host+metricsRoute, nil)
+		Expect(err).To(Succeed())
+
+		res, err := transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+
+		defer res.Body.Close() // nolint: errcheck
+
+		body, err := ioutil.ReadAll(res.Body)
+		Expect(err).To(Succeed())
+
+		return res.StatusCode, string(body)
+	}
+
+	BeforeEach(func() {
+		transport = NewMemoryTransport()
+	})
+
+	It("serves the protocol and per-peer counters", func() {
+		sender := startTestNode("1", withTransport(transport), withMetrics)
+		defer sender.Stop() // nolint: errcheck
+
+		receiver := startTestNode("2", withTransport(transport), withMetrics)
+		defer receiver.Stop() // nolint: errcheck
+
+		Expect(sender.AddPeer("localhost", "2")).To(Succeed())
+		Expect(sender.AddMessage("measured", NOCALLBACK)).To(Succeed())
+
+		Eventually(receiver.GetMessages, time.Second*5).Should(ContainElement("measured"))
+		Eventually(func() int64 { return sender.Stats().SynchronizationsSent }, time.Second*5).
+			Should(BeNumerically(">", 0))
+
+		status, body := get("localhost:1")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(ContainSubstring("# TYPE bmmc_rounds_total counter"))
+		Expect(body).To(ContainSubstring("bmmc_messages_added_total 1\n"))
+		Expect(body).To(MatchRegexp(`bmmc_gossips_sent_total [1-9]`))
+		Expect(body).To(MatchRegexp(`bmmc_synchronizations_sent_total [1-9]`))
+		Expect(body).To(MatchRegexp(`bmmc_peer_requests_total\{peer="localhost:2"\} [1-9]`))
+		Expect(body).To(ContainSubstring("# TYPE bmmc_round_duration_seconds histogram"))
+		Expect(body).To(MatchRegexp(`bmmc_round_duration_seconds_bucket\{le="\+Inf"\} [1-9]`))
+
+		_, body = get("localhost:2")
+		Expect(body).To(MatchRegexp(`bmmc_gossips_received_total [1-9]`))
+		Expect(body).To(MatchRegexp(`bmmc_solicitations_sent_total [1-9]`))
+		Expect(body).To(MatchRegexp(`bmmc_synchronizations_received_total [1-9]`))
+		Expect(body).To(MatchRegexp(`bmmc_synchronization_handler_seconds_count [1-9]`))
+	})
+
+	It("doesn't serve the metrics if they are disabled", func() {
+		b := startTestNode("1", withTransport(transport))
+		defer b.Stop() // nolint: errcheck
+
+		status, _ := get("localhost:1")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+})
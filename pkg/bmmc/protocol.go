@@ -0,0 +1,143 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync"
+)
+
+// ProtocolVersion is the version of the wire protocol sent in all messages.
+// Peers which don't send a version use the legacy version 0.
+const ProtocolVersion = 1
+
+const (
+	// capCodecJSON means that the peer encodes the messages in JSON.
+	capCodecJSON = "codec/json"
+	// capDigestFull means that the peer sends all its message IDs in gossip digests.
+	capDigestFull = "digest/full"
+	// capDigestBloom means that the peer answers gossip messages with bloom filters instead of digests.
+	capDigestBloom = "digest/bloom"
+	// capCodecMsgpack means that the peer decodes the gossip and solicitation messages encoded with msgpack.
+	capCodecMsgpack = "codec/msgpack"
+	// capCompressionGzip means that the peer accepts gzip compressed bodies.
+	capCompressionGzip = "compression/gzip"
+	// capSyncBulk means that the peer serves the missing messages in bulk, on the sync route.
+	capSyncBulk = "sync/bulk"
+	// capGossipPushPull means that the peer answers push-pull gossip messages with a gossip reply.
+	capGossipPushPull = "gossip/push-pull"
+)
+
+// localCapabilities are the capabilities announced by this node in gossip messages.
+var localCapabilities = []string{capCodecJSON, capDigestFull, capCompressionGzip, capDigestBloom, capCodecMsgpack, capSyncBulk,
+	capGossipPushPull}
+
+// protocol is the protocol version and the capabilities of a peer.
+type protocol struct {
+	version      int
+	capabilities []string
+}
+
+// legacyProtocol is the protocol of peers which don't announce their version.
+var legacyProtocol = protocol{
+	version:      0,
+	capabilities: []string{capCodecJSON, capDigestFull},
+}
+
+// localProtocol returns the protocol of this node.
+func localProtocol() protocol {
+	return protocol{
+		version:      ProtocolVersion,
+		capabilities: localCapabilities,
+	}
+}
+
+// negotiate returns the protocol used with a remote peer: the lowest version
+// and the capabilities supported by both nodes.
+func negotiate(local, remote protocol) protocol {
+	version := local.version
+	if remote.version < version {
+		version = remote.version
+	}
+
+	supported := make(map[string]struct{}, len(remote.capabilities))
+	for _, c := range remote.capabilities {
+		supported[c] = struct{}{}
+	}
+
+	capabilities := []string{}
+
+	for _, c := range local.capabilities {
+		if _, ok := supported[c]; ok {
+			capabilities = append(capabilities, c)
+		}
+	}
+
+	return protocol{
+		version:      version,
+		capabilities: capabilities,
+	}
+}
+
+// has returns true if given capability was negotiated.
+func (p protocol) has(capability string) bool {
+	for _, c := range p.capabilities {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
+}
+
+// peerProtocols keeps the protocols negotiated with peers in the gossip phase.
+type peerProtocols struct {
+	protocols map[string]protocol
+	mux       sync.Mutex
+}
+
+// newPeerProtocols creates a peerProtocols.
+func newPeerProtocols() *peerProtocols {
+	return &peerProtocols{
+		protocols: map[string]protocol{},
+	}
+}
+
+// set negotiates the protocol with given peer, from its announced version and capabilities.
+func (p *peerProtocols) set(addr, port string, version int, capabilities []string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	remote := protocol{
+		version:      version,
+		capabilities: capabilities,
+	}
+
+	p.protocols[fullHost(addr, port)] = negotiate(localProtocol(), remote)
+}
+
+// get returns the protocol negotiated with given peer.
+// The legacy protocol is used with peers which haven't gossiped yet.
+func (p *peerProtocols) get(addr, port string) protocol {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if proto, ok := p.protocols[fullHost(addr, port)]; ok {
+		return proto
+	}
+
+	return negotiate(localProtocol(), legacyProtocol)
+}
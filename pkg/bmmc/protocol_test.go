@@ -0,0 +1,49 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Protocol negotiation", func() {
+	It("uses the lowest version and the common capabilities", func() {
+		local := protocol{version: 2, capabilities: []string{capCodecJSON, capDigestFull, "compression/gzip"}}
+		remote := protocol{version: 1, capabilities: []string{"compression/gzip", capCodecJSON, "codec/unknown"}}
+
+		negotiated := negotiate(local, remote)
+		Expect(negotiated.version).To(Equal(1))
+		Expect(negotiated.capabilities).To(Equal([]string{capCodecJSON, "compression/gzip"}))
+		Expect(negotiated.has(capDigestFull)).To(BeFalse())
+	})
+
+	It("uses the legacy protocol with peers which haven't gossiped yet", func() {
+		proto := newPeerProtocols().get("localhost", "10000")
+		Expect(proto.version).To(Equal(0))
+		Expect(proto.has(capCodecJSON)).To(BeTrue())
+	})
+
+	It("keeps the protocol negotiated with each peer", func() {
+		protocols := newPeerProtocols()
+		protocols.set("localhost", "10000", ProtocolVersion+1, []string{capCodecJSON})
+
+		proto := protocols.get("localhost", "10000")
+		Expect(proto.version).To(Equal(ProtocolVersion))
+		Expect(proto.capabilities).To(Equal([]string{capCodecJSON}))
+	})
+})
@@ -0,0 +1,187 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	gossipReplyDecodeErrFmt = "error at decoding gossip reply from %s:%s: %w"
+	gossipReplyLogErrFmt    = "BMMC %s:%s could not reply to gossip from %s:%s: %s"
+)
+
+// GossipMode is the way in which the messages are exchanged after a gossip.
+type GossipMode int
+
+const (
+	// PushGossipMode answers a gossip with a solicitation of the messages
+	// missing from the receiver, which are pushed by the gossiper in a
+	// synchronization: three one-way requests per exchange
+	PushGossipMode GossipMode = iota
+	// PushPullGossipMode answers a gossip directly with the messages missing
+	// from the gossiper and the IDs of the messages missing from the receiver,
+	// which the gossiper pushes in a synchronization. It is used only with the
+	// peers which negotiated it, PushGossipMode is used otherwise
+	PushPullGossipMode
+)
+
+// HTTPGossipReply is the response of a push-pull gossip message.
+type HTTPGossipReply struct {
+	Envelope
+	Addr string `json:"addr"`
+	Port string `json:"port"`
+	// Elements are the messages missing from the gossiper
+	Elements []buffer.Element `json:"elements,omitempty"`
+	// Missing contains the IDs of the messages from the digest of the
+	// gossiper which are missing from the receiver
+	Missing []string `json:"missing,omitempty"`
+}
+
+// pushPull returns true if the gossip messages sent to given peer are answered
+// directly, in the push-pull mode.
+func (b *BMMC) pushPull(addr, port string) bool {
+	return b.config.GossipMode == PushPullGossipMode && b.peerProtocols.get(addr, port).has(capGossipPushPull)
+}
+
+// gossipReply returns the reply of given push-pull gossip message.
+func (b *BMMC) gossipReply(gossipMsg HTTPGossip) HTTPGossipReply {
+	reply := HTTPGossipReply{
+		Envelope: b.envelope(),
+		Addr:     b.config.Addr,
+		Port:     b.config.Port,
+	}
+
+	tAddr, tPort := gossipMsg.Addr, gossipMsg.Port
+
+	// only storage nodes send messages to the nodes which receive them
+	if b.config.Roles.Has(StorageRole) && gossipMsg.Roles&(StorageRole|ObserverRole|BridgeRole) != 0 {
+		digest := b.gossipDigest(tAddr, tPort)
+
+		var ids []string
+		if gossipMsg.Bloom != nil {
+			ids = gossipMsg.Bloom.missingFrom(digest)
+		} else {
+			ids = buffer.MissingStrings(digest, gossipMsg.Digest)
+		}
+
+		// the messages over the synchronization limits are sent in next rounds
+		reply.Elements, _ = limitSynchronization(b.referenceBlobs(b.messageBuffer.ElementsFromIDs(ids)),
+			b.config.MaxSyncMessages, b.config.MaxSyncBytes)
+	}
+
+	// only storage nodes are solicited, and bloom filters can't be listed
+	if !gossipMsg.Roles.Has(StorageRole) || gossipMsg.Bloom != nil {
+		return reply
+	}
+
+	missingDigest := b.missingFrom(gossipMsg.Digest)
+
+	// nodes which are far behind pull the missing messages in bulk
+	if len(missingDigest) > b.config.FullSyncThreshold && b.pullInBackground(tAddr, tPort, missingDigest) {
+		return reply
+	}
+
+	reply.Missing = missingDigest
+
+	return reply
+}
+
+// replyGossip answers given push-pull gossip message. A gossip with a bloom
+// filter is solicited as in the push mode, since its digest can't be listed.
+func (b *BMMC) replyGossip(w http.ResponseWriter, r *http.Request, gossipMsg HTTPGossip) {
+	if gossipMsg.Bloom != nil && gossipMsg.Roles.Has(StorageRole) {
+		if err := b.solicitWithBloom(b.traceContext(r), gossipMsg); err != nil {
+			b.logf(ServerComponent, WarnLevel, gossipHandlerErrLogFmt, err)
+		}
+	}
+
+	reply := b.gossipReply(gossipMsg)
+
+	if len(reply.Elements) > 0 {
+		atomic.AddInt64(&b.counters.synchronizationsSent, 1)
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+
+	if err := json.NewEncoder(b.throttle(r.Context(), w)).Encode(reply); err != nil {
+		b.logf(ServerComponent, WarnLevel, gossipReplyLogErrFmt, b.config.Addr, b.config.Port,
+			gossipMsg.Addr, gossipMsg.Port, err)
+	}
+}
+
+// receiveGossipReply syncs the messages from the reply of a push-pull gossip
+// message sent to given peer, and pushes the messages missing from the peer.
+// Peers which don't reply, e.g. because they were downgraded, are ignored.
+func (b *BMMC) receiveGossipReply(ctx context.Context, body io.Reader, addr, port string) error {
+	var reply HTTPGossipReply
+	if err := json.NewDecoder(body).Decode(&reply); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		return fmt.Errorf(gossipReplyDecodeErrFmt, addr, port, err)
+	}
+
+	if b.bans.isBanned(addr, port) {
+		return nil
+	}
+
+	b.touchPeer(addr, port)
+	b.identifyPeer(reply.NodeID, addr, port)
+
+	if len(reply.Elements) > 0 {
+		atomic.AddInt64(&b.counters.synchronizationsReceived, 1)
+	}
+
+	for _, m := range reply.Elements {
+		if !b.acceptSynced(m) {
+			continue
+		}
+
+		if m.Blob != nil {
+			var err error
+			if m, err = b.fetchBlob(m, addr, port); err != nil {
+				return err
+			}
+		}
+
+		b.syncElement(m, b.config.Addr, b.config.Port)
+	}
+
+	if len(reply.Missing) == 0 {
+		return nil
+	}
+
+	elements, _ := limitSynchronization(b.referenceBlobs(b.messageBuffer.ElementsFromIDs(reply.Missing)),
+		b.config.MaxSyncMessages, b.config.MaxSyncBytes)
+
+	return b.sendSynchronization(ctx, HTTPSynchronization{
+		Envelope: b.envelope(),
+		Addr:     b.config.Addr,
+		Port:     b.config.Port,
+		Elements: elements,
+	}, addr, port)
+}
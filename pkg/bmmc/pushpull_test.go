@@ -0,0 +1,160 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Push-pull gossip", func() {
+	newNode := func(port string, mode GossipMode, transport *MemoryTransport) *BMMC {
+		node, err := New(&Config{
+			Addr:          "localhost",
+			Port:          port,
+			BufferSize:    64,
+			RoundDuration: time.Millisecond * 20,
+			GossipMode:    mode,
+			Transport:     transport,
+			Logger:        log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+
+		return node
+	}
+
+	It("replies with the messages missing from the gossiper and the IDs missing from the receiver", func() {
+		node := newNode("1", PushPullGossipMode, NewMemoryTransport())
+
+		Expect(node.AddMessage("known", NOCALLBACK)).To(Succeed())
+		Expect(node.AddMessage("unknown", NOCALLBACK)).To(Succeed())
+
+		digest := node.messageBuffer.Digest()
+		Expect(digest).To(HaveLen(2))
+
+		reply := node.gossipReply(HTTPGossip{
+			Addr:   "localhost",
+			Port:   "2",
+			Roles:  DefaultRoles,
+			Digest: []string{digest[0], "missing-id"},
+		})
+
+		Expect(reply.Elements).To(HaveLen(1))
+		Expect(reply.Elements[0].ID).To(Equal(digest[1]))
+		Expect(reply.Missing).To(ConsistOf("missing-id"))
+	})
+
+	It("is used only with the peers which negotiated it", func() {
+		node := newNode("1", PushPullGossipMode, NewMemoryTransport())
+
+		Expect(node.pushPull("localhost", "2")).To(BeFalse())
+
+		node.peerProtocols.set("localhost", "2", ProtocolVersion, legacyProtocol.capabilities)
+		Expect(node.pushPull("localhost", "2")).To(BeFalse())
+
+		node.peerProtocols.set("localhost", "2", ProtocolVersion, localCapabilities)
+		Expect(node.pushPull("localhost", "2")).To(BeTrue())
+
+		pushNode := newNode("3", PushGossipMode, NewMemoryTransport())
+		pushNode.peerProtocols.set("localhost", "2", ProtocolVersion, localCapabilities)
+		Expect(pushNode.pushPull("localhost", "2")).To(BeFalse())
+	})
+
+	It("disseminates the messages both ways without solicitations", func() {
+		transport := NewMemoryTransport()
+		nodes := []*BMMC{}
+
+		for _, port := range []string{"1", "2"} {
+			node := newNode(port, PushPullGossipMode, transport)
+			Expect(node.Start()).To(Succeed())
+
+			defer node.Stop() // nolint: errcheck
+
+			nodes = append(nodes, node)
+		}
+
+		Expect(nodes[0].AddPeer("localhost", "2")).To(Succeed())
+		Expect(nodes[1].AddPeer("localhost", "1")).To(Succeed())
+
+		Eventually(func() bool {
+			return nodes[0].pushPull("localhost", "2") && nodes[1].pushPull("localhost", "1")
+		}, time.Second*5).Should(BeTrue())
+
+		// gossips sent before the negotiation may still be answered with solicitations
+		time.Sleep(time.Millisecond * 100)
+
+		solicitations := []int64{}
+		for _, node := range nodes {
+			solicitations = append(solicitations, atomic.LoadInt64(&node.counters.solicitationsSent))
+		}
+
+		messages := []interface{}{}
+
+		for i, node := range nodes {
+			for j := 0; j < 5; j++ {
+				msg := fmt.Sprintf("message %d from node %d", j, i)
+				Expect(node.AddMessage(msg, NOCALLBACK)).To(Succeed())
+
+				messages = append(messages, msg)
+			}
+		}
+
+		for _, node := range nodes {
+			Eventually(node.GetMessages, time.Second*5).Should(ContainElements(messages...))
+		}
+
+		for i, node := range nodes {
+			Expect(atomic.LoadInt64(&node.counters.solicitationsSent)).To(Equal(solicitations[i]))
+		}
+	})
+
+	It("interoperates with nodes in push mode", func() {
+		transport := NewMemoryTransport()
+		nodes := []*BMMC{}
+
+		for port, mode := range map[string]GossipMode{"1": PushPullGossipMode, "2": PushGossipMode} {
+			node := newNode(port, mode, transport)
+			Expect(node.Start()).To(Succeed())
+
+			defer node.Stop() // nolint: errcheck
+
+			nodes = append(nodes, node)
+		}
+
+		Expect(nodes[0].AddPeer("localhost", nodes[1].config.Port)).To(Succeed())
+		Expect(nodes[1].AddPeer("localhost", nodes[0].config.Port)).To(Succeed())
+
+		messages := []interface{}{}
+
+		for i, node := range nodes {
+			msg := fmt.Sprintf("message from node %d", i)
+			Expect(node.AddMessage(msg, NOCALLBACK)).To(Succeed())
+
+			messages = append(messages, msg)
+		}
+
+		for _, node := range nodes {
+			Eventually(node.GetMessages, time.Second*5).Should(ContainElements(messages...))
+		}
+	})
+})
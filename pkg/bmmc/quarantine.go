@@ -0,0 +1,72 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync/atomic"
+)
+
+const (
+	failingPeerLogFmt = "BMMC %s:%s put peer %s:%s in quarantine for %s, after %d consecutive failed requests"
+	slowPeerLogFmt    = "BMMC %s:%s put peer %s:%s in quarantine for %s, because its round trip time is %s"
+)
+
+// assessPeer puts given peer in quarantine for QuarantineDuration if it failed
+// PeerFailureThreshold consecutive requests or if it answers slower than SlowPeerRTT.
+func (b *BMMC) assessPeer(s PeerScore) {
+	if b.config.QuarantineDuration == 0 {
+		return
+	}
+
+	failing := s.ConsecutiveFailures >= b.config.PeerFailureThreshold
+	slow := b.config.SlowPeerRTT > 0 && s.RTT > b.config.SlowPeerRTT
+
+	if !failing && !slow {
+		return
+	}
+
+	if !b.peerScores.quarantine(s.Addr, s.Port, b.config.QuarantineDuration) {
+		return
+	}
+
+	atomic.AddInt64(&b.counters.peersQuarantined, 1)
+
+	if failing {
+		b.logf(GossipComponent, WarnLevel, failingPeerLogFmt,
+			b.config.Addr, b.config.Port, s.Addr, s.Port, b.config.QuarantineDuration, s.ConsecutiveFailures)
+	} else {
+		b.logf(GossipComponent, WarnLevel, slowPeerLogFmt,
+			b.config.Addr, b.config.Port, s.Addr, s.Port, b.config.QuarantineDuration, s.RTT)
+	}
+}
+
+// withoutQuarantined returns given peers, except the ones in quarantine.
+func (b *BMMC) withoutQuarantined(peers []Peer) []Peer {
+	if b.config.QuarantineDuration == 0 {
+		return peers
+	}
+
+	allowed := make([]Peer, 0, len(peers))
+
+	for _, p := range peers {
+		if !b.peerScores.quarantined(p) {
+			allowed = append(allowed, p)
+		}
+	}
+
+	return allowed
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Quarantine", func() {
+	var b *BMMC
+
+	withQuarantine := func(quarantine time.Duration) func(*Config) {
+		return func(cfg *Config) {
+			cfg.PeerFailureThreshold = 2
+			cfg.QuarantineDuration = quarantine
+		}
+	}
+
+	addPeers := func() {
+		Expect(b.AddPeer("localhost", "2")).To(Succeed())
+		Expect(b.AddPeer("localhost", "3")).To(Succeed())
+	}
+
+	assess := func(port string, rtt time.Duration, failed bool) {
+		b.assessPeer(b.peerScores.record("localhost", port, rtt, failed))
+	}
+
+	It("puts in quarantine the peers which fail consistently", func() {
+		b = newTestNode("1", withQuarantine(time.Minute))
+		addPeers()
+
+		assess("2", time.Millisecond, true)
+		Expect(b.peerScores.quarantined(Peer{Addr: "localhost", Port: "2"})).To(BeFalse())
+
+		assess("2", time.Millisecond, true)
+		Expect(b.peerScores.quarantined(Peer{Addr: "localhost", Port: "2"})).To(BeTrue())
+
+		// the quarantine is not extended while it lasts
+		assess("2", time.Millisecond, true)
+		Expect(b.Stats().PeersQuarantined).To(Equal(int64(1)))
+
+		Expect(b.AddMessage("a message", NOCALLBACK)).To(Succeed())
+
+		targets := b.gossipTargets()
+		Expect(targets).To(HaveLen(1))
+		Expect(targets[0].Port).To(Equal("3"))
+	})
+
+	It("puts in quarantine the slow peers", func() {
+		b = newTestNode("1", withQuarantine(time.Minute), func(cfg *Config) {
+			cfg.SlowPeerRTT = time.Millisecond * 100
+		})
+		addPeers()
+
+		assess("2", time.Millisecond, false)
+		assess("3", time.Second, false)
+
+		statuses := b.Status().PeerStatuses
+		Expect(statuses).To(HaveLen(2))
+		Expect(statuses[0].Quarantined).To(BeFalse())
+		Expect(statuses[0].Requests).To(Equal(1))
+		Expect(statuses[1].Quarantined).To(BeTrue())
+	})
+
+	It("selects the peers again when the quarantine ends", func() {
+		b = newTestNode("1", withQuarantine(time.Millisecond*50))
+		addPeers()
+
+		assess("2", time.Millisecond, true)
+		assess("2", time.Millisecond, true)
+		Expect(b.withoutQuarantined(b.knownPeers())).To(HaveLen(1))
+
+		Eventually(func() []Peer {
+			return b.withoutQuarantined(b.knownPeers())
+		}).Should(HaveLen(2))
+	})
+
+	It("doesn't put peers in quarantine without quarantine duration", func() {
+		b = newTestNode("1", func(cfg *Config) {
+			cfg.PeerFailureThreshold = 2
+		})
+		addPeers()
+
+		assess("2", time.Millisecond, true)
+		assess("2", time.Millisecond, true)
+		Expect(b.withoutQuarantined(b.knownPeers())).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,162 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var (
+	// ErrQuorumNotReached is returned by Broadcast when the context is done
+	// before the quorum of peers acknowledged the message.
+	ErrQuorumNotReached = errors.New("quorum not reached")
+	// ErrNotAcknowledged is the error of the peers which didn't acknowledge a
+	// message broadcast with a quorum.
+	ErrNotAcknowledged = errors.New("peer did not acknowledge the message")
+
+	errInvalidQuorum = errors.New("quorum must be between 0 and 1")
+)
+
+// quorumWait waits for the acknowledgements of a message.
+type quorumWait struct {
+	acked  map[string]struct{}
+	needed int
+	done   chan struct{}
+}
+
+// acks keeps the messages broadcast with a quorum which wait for
+// acknowledgements, by message ID. Peers acknowledge messages piggybacked on
+// the protocol: in the digests of their gossip messages, and by handling the
+// synchronizations which contain them.
+type acks struct {
+	waits map[string]*quorumWait
+	mux   sync.Mutex
+}
+
+// newAcks creates an empty acks.
+func newAcks() *acks {
+	return &acks{
+		waits: map[string]*quorumWait{},
+	}
+}
+
+// wait starts waiting for given number of acknowledgements of given message.
+func (a *acks) wait(id string, needed int) *quorumWait {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	w := &quorumWait{
+		acked:  map[string]struct{}{},
+		needed: needed,
+		done:   make(chan struct{}),
+	}
+	a.waits[id] = w
+
+	return w
+}
+
+// ack records that given peer acknowledged given messages.
+func (a *acks) ack(addr, port string, ids []string) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	for _, id := range ids {
+		w, ok := a.waits[id]
+		if !ok {
+			continue
+		}
+
+		w.acked[fullHost(addr, port)] = struct{}{}
+
+		if len(w.acked) >= w.needed {
+			close(w.done)
+			delete(a.waits, id)
+		}
+	}
+}
+
+// forget stops waiting for the acknowledgements of given message and returns
+// the peers which acknowledged it.
+func (a *acks) forget(id string, w *quorumWait) map[string]struct{} {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	delete(a.waits, id)
+
+	acked := make(map[string]struct{}, len(w.acked))
+	for host := range w.acked {
+		acked[host] = struct{}{}
+	}
+
+	return acked
+}
+
+// elementIDs returns the IDs of given elements.
+func elementIDs(elements []buffer.Element) []string {
+	ids := make([]string, len(elements))
+	for i, el := range elements {
+		ids[i] = el.ID
+	}
+
+	return ids
+}
+
+// broadcastWithQuorum adds the message in messages buffer, which is gossiped
+// in the rounds, and waits until the quorum of given peers acknowledged it or
+// until ctx is done.
+func (b *BMMC) broadcastWithQuorum(ctx context.Context, msg interface{}, opts BroadcastOptions,
+	peers []Peer) ([]BroadcastResult, error) {
+	elements, err := b.addMessage(ctx, msg, opts.CallbackType)
+	if err != nil {
+		return nil, fmt.Errorf(broadcastErrFmt, err)
+	}
+
+	// fragmented messages are acknowledged by their first fragment
+	id := elements[0].ID
+	needed := int(math.Ceil(opts.Quorum * float64(len(peers))))
+	w := b.acks.wait(id, needed)
+
+	if needed > 0 {
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+		}
+	}
+
+	acked := b.acks.forget(id, w)
+
+	results := make([]BroadcastResult, len(peers))
+	for i, p := range peers {
+		results[i] = BroadcastResult{Peer: p}
+
+		if _, ok := acked[fullHost(p.Addr, p.Port)]; !ok {
+			results[i].Err = ErrNotAcknowledged
+		}
+	}
+
+	if len(acked) < needed {
+		return results, fmt.Errorf(broadcastErrFmt, ErrQuorumNotReached)
+	}
+
+	return results, nil
+}
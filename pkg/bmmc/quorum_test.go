@@ -0,0 +1,94 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Quorum", func() {
+	It("waits until the needed peers acknowledged a message", func() {
+		a := newAcks()
+		w := a.wait("id", 2)
+
+		a.ack("localhost", "2", []string{"other-id", "id"})
+		a.ack("localhost", "2", []string{"id"})
+		Consistently(w.done).ShouldNot(BeClosed())
+
+		a.ack("localhost", "3", []string{"id"})
+		Eventually(w.done).Should(BeClosed())
+		Expect(a.forget("id", w)).To(HaveLen(2))
+	})
+
+	When("a message is broadcast with a quorum", func() {
+		var (
+			sender *BMMC
+			nodes  []*BMMC
+		)
+
+		BeforeEach(func() {
+			transport := NewMemoryTransport()
+
+			sender = startTestNode("1", withTransport(transport))
+			nodes = []*BMMC{sender, startTestNode("2", withTransport(transport))}
+
+			Expect(sender.AddPeer("localhost", "2")).To(Succeed())
+			// the third peer is not started, so it never acknowledges messages
+			Expect(sender.AddPeer("localhost", "3")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			for _, b := range nodes {
+				Expect(b.Stop()).To(Succeed())
+			}
+		})
+
+		It("returns when the quorum acknowledged it", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			results, err := sender.Broadcast(ctx, "a message", BroadcastOptions{Quorum: 0.5})
+			Expect(err).To(Succeed())
+			Expect(results).To(HaveLen(2))
+
+			for _, r := range results {
+				if r.Peer.Port == "2" {
+					Expect(r.Err).To(Succeed())
+				} else {
+					Expect(r.Err).To(MatchError(ErrNotAcknowledged))
+				}
+			}
+		})
+
+		It("returns error when the quorum is not reached in time", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+			defer cancel()
+
+			_, err := sender.Broadcast(ctx, "a message", BroadcastOptions{Quorum: 1})
+			Expect(err).To(MatchError(ErrQuorumNotReached))
+		})
+
+		It("returns error for invalid quorums", func() {
+			_, err := sender.Broadcast(context.Background(), "a message", BroadcastOptions{Quorum: 2})
+			Expect(err).To(MatchError(errInvalidQuorum))
+		})
+	})
+})
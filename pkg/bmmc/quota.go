@@ -0,0 +1,116 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	overQuotaLogFmt = "BMMC %s:%s dropped message %s, because %s exceeded its quota"
+
+	defaultQuotaWindow = time.Minute
+)
+
+// OriginQuota limits the messages accepted from each origin node in a time
+// window, so a single node can't fill the buffers of the cluster. The messages
+// over the quota are dropped; they are received again in the next rounds,
+// while their origin still keeps them in its buffer.
+type OriginQuota struct {
+	// Messages is the maximum number of messages accepted from an origin in a window
+	// Optional (default: no limit)
+	Messages int
+	// Bytes is the maximum size of the messages accepted from an origin in a window
+	// Optional (default: no limit)
+	Bytes int
+	// Window is the duration of the quota windows
+	// Optional (default: 1m)
+	Window time.Duration
+}
+
+// enabled returns true if the quota limits the messages or their size.
+func (q OriginQuota) enabled() bool {
+	return q.Messages > 0 || q.Bytes > 0
+}
+
+// originUsage is the usage of the quota by an origin in the current window.
+type originUsage struct {
+	messages int
+	bytes    int
+}
+
+// originQuotas keeps the usage of the quota by each origin. All origins share
+// the same window, so the usages are reset together.
+type originQuotas struct {
+	quota       OriginQuota
+	windowStart time.Time
+	usage       map[string]originUsage
+	mux         sync.Mutex
+}
+
+// newOriginQuotas creates an originQuotas with given quota.
+func newOriginQuotas(quota OriginQuota) *originQuotas {
+	return &originQuotas{
+		quota:       quota,
+		windowStart: time.Now(),
+		usage:       map[string]originUsage{},
+	}
+}
+
+// allow counts a message with given size from given origin and returns true
+// if it fits in the quota of the origin.
+func (q *originQuotas) allow(origin string, size int) bool {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if now := time.Now(); now.Sub(q.windowStart) >= q.quota.Window {
+		q.windowStart = now
+		q.usage = map[string]originUsage{}
+	}
+
+	u := q.usage[origin]
+
+	if q.quota.Messages > 0 && u.messages+1 > q.quota.Messages {
+		return false
+	}
+
+	if q.quota.Bytes > 0 && u.bytes+size > q.quota.Bytes {
+		return false
+	}
+
+	q.usage[origin] = originUsage{messages: u.messages + 1, bytes: u.bytes + size}
+
+	return true
+}
+
+// withinQuota returns true if given element fits in the quota of its origin.
+// The size of messages sent out of band is their blob size.
+func (b *BMMC) withinQuota(el buffer.Element) bool {
+	if b.quotas == nil {
+		return true
+	}
+
+	size := el.Size()
+	if el.Blob != nil {
+		size = el.Blob.Size
+	}
+
+	return b.quotas.allow(el.Origin, size)
+}
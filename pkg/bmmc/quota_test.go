@@ -0,0 +1,64 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Origin quotas", func() {
+	It("limits the number of messages of each origin", func() {
+		q := newOriginQuotas(OriginQuota{Messages: 2, Window: time.Minute})
+
+		Expect(q.allow("a:1", 10)).To(BeTrue())
+		Expect(q.allow("a:1", 10)).To(BeTrue())
+		Expect(q.allow("a:1", 10)).To(BeFalse())
+		Expect(q.allow("b:1", 10)).To(BeTrue())
+	})
+
+	It("limits the size of the messages of each origin", func() {
+		q := newOriginQuotas(OriginQuota{Bytes: 100, Window: time.Minute})
+
+		Expect(q.allow("a:1", 60)).To(BeTrue())
+		Expect(q.allow("a:1", 60)).To(BeFalse())
+		Expect(q.allow("a:1", 40)).To(BeTrue())
+	})
+
+	It("resets the quotas in each window", func() {
+		q := newOriginQuotas(OriginQuota{Messages: 1, Window: time.Millisecond * 50})
+
+		Expect(q.allow("a:1", 10)).To(BeTrue())
+		Expect(q.allow("a:1", 10)).To(BeFalse())
+		Eventually(func() bool { return q.allow("a:1", 10) }).Should(BeTrue())
+	})
+
+	It("uses the blob size of messages sent out of band", func() {
+		b := &BMMC{quotas: newOriginQuotas(OriginQuota{Bytes: 100, Window: time.Minute})}
+
+		Expect(b.withinQuota(buffer.Element{Origin: "a:1", Blob: &buffer.BlobRef{Size: 200}})).To(BeFalse())
+		Expect(b.withinQuota(buffer.Element{Origin: "a:1", Blob: &buffer.BlobRef{Size: 50}})).To(BeTrue())
+	})
+
+	It("doesn't limit the messages without a quota", func() {
+		Expect((&BMMC{}).withinQuota(buffer.Element{Origin: "a:1"})).To(BeTrue())
+	})
+})
@@ -0,0 +1,247 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	rateLimitedLogFmt    = "BMMC %s:%s rejected request on %s from %s, because of rate limit"
+	overloadedLogFmt     = "BMMC %s:%s rejected synchronization from %s, because all callback slots are busy"
+	peerBackoffLogErrFmt = "BMMC %s:%s backs off from %s for %s, because it is overloaded"
+
+	retryAfterHeader = "Retry-After"
+
+	// maxLimitedPeers is the maximum number of peers whose rate limits are
+	// kept. The limits are reset when it is reached, so spoofed hosts can't
+	// grow them indefinitely
+	maxLimitedPeers = 4096
+)
+
+var (
+	errPeerOverloaded = errors.New("peer is overloaded")
+)
+
+// RateLimit limits the requests accepted on the protocol endpoints. The
+// requests over the limits are answered with 429 Too Many Requests and
+// their senders don't send other requests until the Retry-After duration of
+// the response passed. The limits are token buckets which allow bursts of
+// one second of requests.
+type RateLimit struct {
+	// PeerRequests is the maximum number of requests per second accepted from the host of a peer
+	// Optional (default: no limit)
+	PeerRequests int
+	// Requests is the maximum number of requests per second accepted from all peers
+	// Optional (default: no limit)
+	Requests int
+}
+
+// enabled returns true if the rate limit limits any request.
+func (l RateLimit) enabled() bool {
+	return l.PeerRequests > 0 || l.Requests > 0
+}
+
+// rateLimiter keeps the token buckets of RateLimit.
+type rateLimiter struct {
+	limit  RateLimit
+	global *tokenBucket
+	peers  map[string]*tokenBucket
+	mux    sync.Mutex
+}
+
+// newRateLimiter creates a rateLimiter with given limit.
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	l := &rateLimiter{
+		limit: limit,
+		peers: map[string]*tokenBucket{},
+	}
+
+	if limit.Requests > 0 {
+		l.global = newTokenBucket(limit.Requests)
+	}
+
+	return l
+}
+
+// peer returns the token bucket of given host.
+func (l *rateLimiter) peer(host string) *tokenBucket {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	t, ok := l.peers[host]
+	if !ok {
+		if len(l.peers) >= maxLimitedPeers {
+			l.peers = map[string]*tokenBucket{}
+		}
+
+		t = newTokenBucket(l.limit.PeerRequests)
+		l.peers[host] = t
+	}
+
+	return t
+}
+
+// setLimit replaces the limit. The token buckets are full again.
+func (l *rateLimiter) setLimit(limit RateLimit) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.limit = limit
+	l.peers = map[string]*tokenBucket{}
+	l.global = nil
+
+	if limit.Requests > 0 {
+		l.global = newTokenBucket(limit.Requests)
+	}
+}
+
+// allow counts a request from given host and returns how long the host must
+// wait before sending it, if it is over the limits.
+func (l *rateLimiter) allow(host string) time.Duration {
+	l.mux.Lock()
+	limit, global := l.limit, l.global
+	l.mux.Unlock()
+
+	if limit.PeerRequests > 0 {
+		if d := l.peer(host).take(1); d > 0 {
+			return d
+		}
+	}
+
+	if global != nil {
+		return global.take(1)
+	}
+
+	return 0
+}
+
+// rejectOverLimit answers given request with 429 Too Many Requests if it is
+// over the rate limit, and returns true if it was rejected.
+func (b *BMMC) rejectOverLimit(w http.ResponseWriter, r *http.Request) bool {
+	d := b.rateLimiter.allow(remoteHost(r))
+	if d == 0 {
+		return false
+	}
+
+	atomic.AddInt64(&b.counters.requestsLimited, 1)
+	b.logf(ServerComponent, WarnLevel, rateLimitedLogFmt, b.config.Addr, b.config.Port, r.URL.Path, remoteHost(r))
+	tooManyRequests(w, d)
+
+	return true
+}
+
+// acquireCallbackSlot takes a slot of MaxConcurrentCallbacks for a
+// synchronization. When all slots are busy, the synchronization is answered
+// with 429 Too Many Requests and its messages are synced in next rounds.
+func (b *BMMC) acquireCallbackSlot(w http.ResponseWriter, r *http.Request) (func(), bool) {
+	if b.callbackSlots == nil {
+		return func() {}, true
+	}
+
+	select {
+	case b.callbackSlots <- struct{}{}:
+		return func() { <-b.callbackSlots }, true
+	default:
+	}
+
+	atomic.AddInt64(&b.counters.requestsLimited, 1)
+	b.logf(ServerComponent, WarnLevel, overloadedLogFmt, b.config.Addr, b.config.Port, remoteHost(r))
+	tooManyRequests(w, b.configRoundDuration())
+
+	return nil, false
+}
+
+// tooManyRequests answers with 429 Too Many Requests, asking the sender to
+// retry after given duration, rounded up to seconds.
+func tooManyRequests(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set(retryAfterHeader, strconv.Itoa(int(math.Ceil(d.Seconds()))))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
+
+// backoffTransport stops sending requests to the peers which answered with
+// 429 Too Many Requests, until their Retry-After duration passed.
+type backoffTransport struct {
+	next http.RoundTripper
+	b    *BMMC
+	// until is the time until which the node backs off from a peer, by host
+	until map[string]time.Time
+	mux   sync.Mutex
+}
+
+// newBackoffTransport creates a backoffTransport of given node.
+func newBackoffTransport(next http.RoundTripper, b *BMMC) *backoffTransport {
+	return &backoffTransport{
+		next:  next,
+		b:     b,
+		until: map[string]time.Time{},
+	}
+}
+
+// RoundTrip sends given request, unless the node backs off from its peer.
+func (t *backoffTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	t.mux.Lock()
+	until, ok := t.until[host]
+
+	if ok && time.Now().After(until) {
+		delete(t.until, host)
+		ok = false
+	}
+	t.mux.Unlock()
+
+	if ok {
+		if req.Body != nil {
+			req.Body.Close() // nolint: errcheck
+		}
+
+		return nil, errPeerOverloaded
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+
+	d := retryAfter(resp.Header, t.b.configRoundDuration())
+
+	t.mux.Lock()
+	t.until[host] = time.Now().Add(d)
+	t.mux.Unlock()
+
+	t.b.logf(GossipComponent, WarnLevel, peerBackoffLogErrFmt, t.b.config.Addr, t.b.config.Port, host, d)
+
+	return resp, nil
+}
+
+// retryAfter returns the duration of the Retry-After header, in seconds, or
+// def if the header is missing or invalid.
+func retryAfter(header http.Header, def time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(header.Get(retryAfterHeader))
+	if err != nil || seconds <= 0 {
+		return def
+	}
+
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rate limit", func() {
+	newNode := func(cfg *Config) *BMMC {
+		cfg.Addr = "localhost"
+		cfg.Port = "1"
+		cfg.BufferSize = 16
+		cfg.RoundDuration = time.Millisecond * 20
+		cfg.Transport = NewMemoryTransport()
+		cfg.Logger = log.New(ioutil.Discard, "", 0)
+
+		b, err := New(cfg)
+		Expect(err).To(Succeed())
+
+		return b
+	}
+
+	post := func(b *BMMC, route string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, route, strings.NewReader("{}"))
+		r.RemoteAddr = "10.0.0.1:1234"
+		b.server.Handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	It("limits the requests of each peer and of all peers", func() {
+		l := newRateLimiter(RateLimit{PeerRequests: 2, Requests: 3})
+
+		Expect(l.allow("a")).To(BeZero())
+		Expect(l.allow("a")).To(BeZero())
+		Expect(l.allow("a")).To(BeNumerically(">", 0))
+
+		Expect(l.allow("b")).To(BeZero())
+		Expect(l.allow("c")).To(BeNumerically(">", 0))
+	})
+
+	It("answers the requests over the limit with 429", func() {
+		b := newNode(&Config{RateLimit: RateLimit{PeerRequests: 1}})
+
+		Expect(post(b, gossipRoute).Code).NotTo(Equal(http.StatusTooManyRequests))
+
+		w := post(b, gossipRoute)
+		Expect(w.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(w.Header().Get(retryAfterHeader)).To(Equal("1"))
+		Expect(b.Stats().RequestsLimited).To(Equal(int64(1)))
+	})
+
+	It("answers the synchronizations with 429 when all callback slots are busy", func() {
+		b := newNode(&Config{MaxConcurrentCallbacks: 1})
+
+		b.callbackSlots <- struct{}{}
+		Expect(post(b, synchronizationRoute).Code).To(Equal(http.StatusTooManyRequests))
+
+		<-b.callbackSlots
+		Expect(post(b, synchronizationRoute).Code).NotTo(Equal(http.StatusTooManyRequests))
+		Expect(b.callbackSlots).To(BeEmpty())
+	})
+
+	It("backs off from the overloaded peers", func() {
+		var hits int64
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&hits, 1)
+			tooManyRequests(w, time.Second)
+		}))
+		defer server.Close()
+
+		b := newNode(&Config{})
+		client := &http.Client{Transport: newBackoffTransport(http.DefaultTransport, b)}
+
+		resp, err := client.Get(server.URL)
+		Expect(err).To(Succeed())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+
+		_, err = client.Get(server.URL) // nolint: bodyclose
+		Expect(err).To(MatchError(ContainSubstring(errPeerOverloaded.Error())))
+		Expect(atomic.LoadInt64(&hits)).To(Equal(int64(1)))
+	})
+})
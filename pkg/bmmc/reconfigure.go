@@ -0,0 +1,172 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/callback"
+)
+
+const (
+	updateConfigErrFmt  = "error at updating config: %w"
+	configUpdatedLogFmt = "BMMC %s:%s updated config in round %d"
+)
+
+var (
+	errInvalidConfigPatch = errors.New("beta must be between 0 and 1, round duration must be positive and not " +
+		"greater than max round duration, and buffer bytes, message ttl and rate limits must not be negative")
+)
+
+// ConfigPatch contains the tunables changed on a running node. The nil fields
+// are not changed.
+type ConfigPatch struct {
+	// Beta replaces the expected fanout for gossip rounds
+	Beta *float64 `json:"beta,omitempty"`
+	// RoundDuration replaces the duration of gossip rounds, from the next round
+	RoundDuration *time.Duration `json:"roundDuration,omitempty"`
+	// MaxBufferBytes replaces the maximum size of the messages from buffer.
+	// The messages over it are evicted when the next message is added
+	MaxBufferBytes *int `json:"maxBufferBytes,omitempty"`
+	// MessageTTL replaces the duration for which messages are kept in buffer
+	MessageTTL *time.Duration `json:"messageTTL,omitempty"`
+	// RateLimit replaces the limits of the requests accepted on the protocol endpoints
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+}
+
+// validate returns error if given patch is invalid for given config.
+func (p ConfigPatch) validate(cfg *Config) error {
+	if p.Beta != nil && (*p.Beta <= 0 || *p.Beta > 1) {
+		return errInvalidConfigPatch
+	}
+
+	if p.RoundDuration != nil && (*p.RoundDuration <= 0 ||
+		(cfg.MaxRoundDuration != 0 && *p.RoundDuration > cfg.MaxRoundDuration)) {
+		return errInvalidConfigPatch
+	}
+
+	if p.MaxBufferBytes != nil && *p.MaxBufferBytes < 0 {
+		return errInvalidConfigPatch
+	}
+
+	if p.MessageTTL != nil && *p.MessageTTL < 0 {
+		return errInvalidConfigPatch
+	}
+
+	if p.RateLimit != nil && (p.RateLimit.PeerRequests < 0 || p.RateLimit.Requests < 0) {
+		return errInvalidConfigPatch
+	}
+
+	return nil
+}
+
+// UpdateConfig applies given patch on the running node, without restarting
+// it. The patch is applied atomically: if it is invalid, no field changes.
+func (b *BMMC) UpdateConfig(patch ConfigPatch) error {
+	b.configMux.Lock()
+
+	if err := patch.validate(b.config); err != nil {
+		b.configMux.Unlock()
+		return fmt.Errorf(updateConfigErrFmt, err)
+	}
+
+	if patch.Beta != nil {
+		b.config.Beta = *patch.Beta
+	}
+
+	if patch.RoundDuration != nil {
+		b.config.RoundDuration = *patch.RoundDuration
+	}
+
+	if patch.MaxBufferBytes != nil {
+		b.config.MaxBufferBytes = *patch.MaxBufferBytes
+		b.messageBuffer.SetMaxBytes(*patch.MaxBufferBytes)
+	}
+
+	if patch.MessageTTL != nil {
+		b.config.MessageTTL = *patch.MessageTTL
+	}
+
+	if patch.RateLimit != nil {
+		b.config.RateLimit = *patch.RateLimit
+		b.rateLimiter.setLimit(*patch.RateLimit)
+	}
+
+	b.configMux.Unlock()
+
+	b.logf(MembershipComponent, InfoLevel, configUpdatedLogFmt, b.config.Addr, b.config.Port, b.gossipRound.GetNumber())
+
+	return nil
+}
+
+// UpdateClusterConfig gossips given patch to all nodes, which apply it when
+// they receive it. It is applied on this node right away.
+func (b *BMMC) UpdateClusterConfig(patch ConfigPatch) error {
+	b.configMux.RLock()
+	err := patch.validate(b.config)
+	b.configMux.RUnlock()
+
+	if err != nil {
+		return fmt.Errorf(updateConfigErrFmt, err)
+	}
+
+	if _, err := b.addMessage(context.Background(), patch, callback.CONFIGUPDATE); err != nil {
+		return fmt.Errorf(updateConfigErrFmt, err)
+	}
+
+	return nil
+}
+
+// applyConfigUpdate applies the patch from given config update message.
+func (b *BMMC) applyConfigUpdate(m buffer.Element) error {
+	var patch ConfigPatch
+	if err := decodePayload(m.Msg, m.Codec, b.config.Codec, &patch); err != nil {
+		return err
+	}
+
+	return b.UpdateConfig(patch)
+}
+
+// configBeta returns the configured beta, which can be updated at runtime.
+func (b *BMMC) configBeta() float64 {
+	b.configMux.RLock()
+	defer b.configMux.RUnlock()
+
+	return b.config.Beta
+}
+
+// configRoundDuration returns the configured round duration, which can be
+// updated at runtime.
+func (b *BMMC) configRoundDuration() time.Duration {
+	b.configMux.RLock()
+	defer b.configMux.RUnlock()
+
+	return b.config.RoundDuration
+}
+
+// configMessageTTL returns the configured message ttl, which can be updated
+// at runtime.
+func (b *BMMC) configMessageTTL() time.Duration {
+	b.configMux.RLock()
+	defer b.configMux.RUnlock()
+
+	return b.config.MessageTTL
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reconfiguration", func() {
+	It("updates the tunables of a running node", func() {
+		b := newTestNode("1")
+
+		beta := 0.8
+		round := time.Millisecond * 50
+		ttl := time.Minute
+		limit := RateLimit{Requests: 1}
+
+		Expect(b.UpdateConfig(ConfigPatch{
+			Beta:          &beta,
+			RoundDuration: &round,
+			MessageTTL:    &ttl,
+			RateLimit:     &limit,
+		})).To(Succeed())
+
+		Expect(b.beta()).To(Equal(0.8))
+		Expect(b.roundDuration()).To(Equal(time.Millisecond * 50))
+		Expect(b.configMessageTTL()).To(Equal(time.Minute))
+
+		Expect(b.rateLimiter.allow("10.0.0.1")).To(BeZero())
+		Expect(b.rateLimiter.allow("10.0.0.1")).NotTo(BeZero())
+	})
+
+	It("doesn't change any tunable when the patch is invalid", func() {
+		b := newTestNode("1", func(cfg *Config) {
+			cfg.Beta = 0.5
+		})
+
+		beta := 0.8
+		round := -time.Second
+
+		Expect(b.UpdateConfig(ConfigPatch{
+			Beta:          &beta,
+			RoundDuration: &round,
+		})).To(MatchError(errInvalidConfigPatch))
+
+		Expect(b.beta()).To(Equal(0.5))
+		Expect(b.roundDuration()).To(Equal(time.Millisecond * 20))
+	})
+
+	It("gossips the config updates to the cluster", func() {
+		transport := NewMemoryTransport()
+
+		nodes := []*BMMC{startTestNode("1", withTransport(transport)), startTestNode("2", withTransport(transport))}
+		for _, b := range nodes {
+			defer b.Stop() // nolint: errcheck
+		}
+
+		Expect(nodes[0].AddPeer("localhost", "2")).To(Succeed())
+
+		beta := 0.9
+		Expect(nodes[0].UpdateClusterConfig(ConfigPatch{Beta: &beta})).To(Succeed())
+
+		for _, b := range nodes {
+			Eventually(b.beta, time.Second*5).Should(Equal(0.9))
+		}
+
+		// config updates are internal messages
+		Expect(nodes[1].GetMessagesByType(NOCALLBACK)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,250 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// InboundExchange is the direction of the requests received by a node.
+	InboundExchange = "inbound"
+	// OutboundExchange is the direction of the requests sent by a node.
+	OutboundExchange = "outbound"
+
+	recordExchangeLogErrFmt = "Error at recording exchange: %s"
+
+	readExchangesErrFmt  = "error at reading exchanges: %w"
+	replayExchangeErrFmt = "error at replaying exchange %d: %w"
+)
+
+// Exchange is a recorded protocol request and its response.
+type Exchange struct {
+	Time time.Time `json:"time"`
+	// Node is the address of the node which recorded the exchange
+	Node      string      `json:"node"`
+	Direction string      `json:"direction"`
+	Method    string      `json:"method"`
+	Host      string      `json:"host"`
+	Path      string      `json:"path"`
+	Header    http.Header `json:"header,omitempty"`
+	Body      []byte      `json:"body,omitempty"`
+	Status    int         `json:"status"`
+}
+
+// Recorder records protocol exchanges as JSON lines in a writer.
+// A recorder can be shared by all the nodes of a cluster.
+type Recorder struct {
+	enc *json.Encoder
+	mux sync.Mutex
+}
+
+// NewRecorder creates a recorder which writes in given writer.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// record writes given exchange.
+func (r *Recorder) record(e Exchange) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.enc.Encode(e)
+}
+
+// ReadExchanges reads the exchanges written by a recorder.
+func ReadExchanges(r io.Reader) ([]Exchange, error) {
+	dec := json.NewDecoder(r)
+	exchanges := []Exchange{}
+
+	for {
+		e := Exchange{}
+
+		err := dec.Decode(&e)
+		if errors.Is(err, io.EOF) {
+			return exchanges, nil
+		}
+
+		if err != nil {
+			return exchanges, fmt.Errorf(readExchangesErrFmt, err)
+		}
+
+		exchanges = append(exchanges, e)
+	}
+}
+
+// recordingTransport records the requests sent by a node. The bodies are read
+// before the requests are sent, so they are not streamed anymore.
+type recordingTransport struct {
+	next     http.RoundTripper
+	recorder *Recorder
+	node     string
+	logger   *log.Logger
+}
+
+// RoundTrip records and sends the request.
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	e := Exchange{
+		Time:      time.Now(),
+		Node:      t.node,
+		Direction: OutboundExchange,
+		Method:    req.Method,
+		Host:      req.URL.Host,
+		Path:      req.URL.Path,
+		Header:    req.Header.Clone(),
+		Body:      body,
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		e.Status = resp.StatusCode
+	}
+
+	if rErr := t.recorder.record(e); rErr != nil {
+		t.logger.Printf(recordExchangeLogErrFmt, rErr)
+	}
+
+	return resp, err
+}
+
+// readBody reads the whole given body and replaces it with a reader of
+// the read content.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadAll(*body)
+	(*body).Close() // nolint: errcheck
+
+	if err != nil {
+		return nil, err
+	}
+
+	*body = ioutil.NopCloser(bytes.NewReader(b))
+
+	return b, nil
+}
+
+// statusWriter keeps the status written in a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader keeps and writes the status.
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// recordInbound records the requests received by the node, if it has a recorder.
+func (b *BMMC) recordInbound(next http.Handler) http.Handler {
+	if b.config.Recorder == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := readBody(&r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		e := Exchange{
+			Time:      time.Now(),
+			Node:      fullHost(b.config.Addr, b.config.Port),
+			Direction: InboundExchange,
+			Method:    r.Method,
+			Host:      r.Host,
+			Path:      r.URL.Path,
+			Header:    r.Header.Clone(),
+			Body:      body,
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		e.Status = sw.status
+
+		if err := b.config.Recorder.record(e); err != nil {
+			b.logf(GossipComponent, WarnLevel, recordExchangeLogErrFmt, err)
+		}
+	})
+}
+
+// discardWriter is a response writer which discards the response.
+type discardWriter struct {
+	header http.Header
+}
+
+// Header returns the header of the response.
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+// Write discards given content.
+func (w *discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// WriteHeader discards given status.
+func (w *discardWriter) WriteHeader(int) {}
+
+// Replay feeds the inbound exchanges to the protocol handlers, in order, as if
+// they were received from peers. The responses of the node, like solicitations
+// sent to the recorded peers, are sent as usual. The outbound exchanges are
+// skipped; exchanges recorded by other nodes are replayed too, so the exchanges
+// of a shared recorder must be filtered by Node.
+func (b *BMMC) Replay(exchanges []Exchange) error {
+	for i, e := range exchanges {
+		if e.Direction != InboundExchange {
+			continue
+		}
+
+		host := fullHost(b.config.Addr, b.config.Port)
+
+		req, err := http.NewRequest(e.Method, fmt.Sprintf("http://%s%s", host, e.Path), bytes.NewReader(e.Body))
+		if err != nil {
+			return fmt.Errorf(replayExchangeErrFmt, i, err)
+		}
+
+		for k, v := range e.Header {
+			req.Header[k] = v
+		}
+
+		b.serveProtocol(&discardWriter{header: http.Header{}}, req)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// lockedBuffer is a buffer which can be written by the nodes while it is read.
+type lockedBuffer struct {
+	buf bytes.Buffer
+	mux sync.Mutex
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) bytes() []byte {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	return append([]byte{}, b.buf.Bytes()...)
+}
+
+var _ = Describe("Record and replay", func() {
+	It("records the outbound requests", func() {
+		buf := &bytes.Buffer{}
+		t := &recordingTransport{
+			next: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				body, err := ioutil.ReadAll(req.Body)
+				Expect(err).To(Succeed())
+				Expect(string(body)).To(Equal("hello"))
+
+				return &http.Response{StatusCode: http.StatusAccepted}, nil
+			}),
+			recorder: NewRecorder(buf),
+			node:     "localhost:1",
+		}
+
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:2/gossip", strings.NewReader("hello"))
+		Expect(err).To(Succeed())
+
+		_, err = t.RoundTrip(req)
+		Expect(err).To(Succeed())
+
+		exchanges, err := ReadExchanges(buf)
+		Expect(err).To(Succeed())
+		Expect(exchanges).To(HaveLen(1))
+		Expect(exchanges[0].Node).To(Equal("localhost:1"))
+		Expect(exchanges[0].Direction).To(Equal(OutboundExchange))
+		Expect(exchanges[0].Host).To(Equal("localhost:2"))
+		Expect(exchanges[0].Path).To(Equal(gossipRoute))
+		Expect(string(exchanges[0].Body)).To(Equal("hello"))
+		Expect(exchanges[0].Status).To(Equal(http.StatusAccepted))
+	})
+
+	It("replays the recorded exchanges in a new node", func() {
+		buf := &lockedBuffer{}
+
+		transport := NewMemoryTransport()
+		sender := newTestNode("1", withTransport(transport))
+		receiver := newTestNode("2", withTransport(transport), func(cfg *Config) {
+			cfg.Recorder = NewRecorder(buf)
+		})
+
+		Expect(sender.Start()).To(Succeed())
+		Expect(receiver.Start()).To(Succeed())
+		Expect(sender.AddPeer(receiver.config.Addr, receiver.config.Port)).To(Succeed())
+
+		elements, err := sender.addMessage(context.Background(), "replayed message", NOCALLBACK)
+		Expect(err).To(Succeed())
+
+		Eventually(func() bool {
+			return receiver.HasMessage(elements[0].ID)
+		}, time.Second*5).Should(BeTrue())
+
+		sender.Stop()
+		receiver.Stop()
+
+		exchanges, err := ReadExchanges(bytes.NewReader(buf.bytes()))
+		Expect(err).To(Succeed())
+
+		paths := []string{}
+		for _, e := range exchanges {
+			paths = append(paths, e.Direction+" "+e.Path)
+		}
+
+		Expect(paths).To(ContainElement(InboundExchange + " " + synchronizationRoute))
+
+		replayer := newTestNode("3")
+		Expect(replayer.Replay(exchanges)).To(Succeed())
+		Expect(replayer.HasMessage(elements[0].ID)).To(BeTrue())
+	})
+})
@@ -0,0 +1,216 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/callback"
+)
+
+const (
+	peersFileName    = "peers.json"
+	messagesFileName = "messages.log"
+
+	loadMessagesErrFmt     = "error at loading messages from %s: %w"
+	saveMessagesLogErrFmt  = "Error at saving messages in message store: %s"
+	closeStoreLogErrFmt    = "Error at closing message store: %s"
+	rejoinLogErrFmt        = "Error at rejoining the peers: %s"
+	rejoinLogFmt           = "BMMC %s:%s restored %d peers and %d messages"
+	messageStoreMemoryName = "memory"
+)
+
+// openMessageStore opens the message store selected in config, if any.
+func (b *BMMC) openMessageStore() error {
+	switch b.config.MessageStore {
+	case MemoryStore:
+		b.messageStore = buffer.NewMemoryStore()
+	case FileStore:
+		if err := os.MkdirAll(b.config.DataDir, os.ModePerm); err != nil {
+			return fmt.Errorf(loadMessagesErrFmt, b.config.DataDir, err)
+		}
+
+		path := filepath.Join(b.config.DataDir, messagesFileName)
+
+		s, err := buffer.NewFileStore(path)
+		if err != nil {
+			return fmt.Errorf(loadMessagesErrFmt, path, err)
+		}
+
+		b.messageStore = s
+	}
+
+	return nil
+}
+
+// loadMessages adds the messages saved in message store in messages buffer.
+// Loaded messages are delivered already, so their callbacks don't run again.
+// It returns the number of loaded messages.
+func (b *BMMC) loadMessages() (int, error) {
+	digest, err := b.messageStore.Digest()
+	if err != nil {
+		return 0, fmt.Errorf(loadMessagesErrFmt, b.messageStoreName(), err)
+	}
+
+	loaded := 0
+
+	for _, id := range digest {
+		el, ok, err := b.messageStore.Get(id)
+		if err != nil {
+			return 0, fmt.Errorf(loadMessagesErrFmt, b.messageStoreName(), err)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := b.messageBuffer.Add(el); err != nil {
+			return 0, fmt.Errorf(loadMessagesErrFmt, b.messageStoreName(), err)
+		}
+
+		b.seen.add(el.ID)
+
+		if el.Tombstone != "" {
+			b.tombstones.add(el.Tombstone, b.config.TombstoneTTL, b.config.MaxTombstones)
+		}
+
+		loaded++
+	}
+
+	return loaded, nil
+}
+
+// messageStoreName returns the name of message store, used in errors.
+func (b *BMMC) messageStoreName() string {
+	if b.config.MessageStore == FileStore {
+		return filepath.Join(b.config.DataDir, messagesFileName)
+	}
+
+	return messageStoreMemoryName
+}
+
+// recoverState opens the message store and restores the messages saved in it.
+func (b *BMMC) recoverState() error {
+	if err := b.openMessageStore(); err != nil {
+		return err
+	}
+
+	if b.messageStore == nil {
+		return nil
+	}
+
+	loaded, err := b.loadMessages()
+	if err != nil {
+		b.closeMessageStore()
+		return err
+	}
+
+	b.restored = loaded > 0 || (b.config.DataDir != "" && b.peerBuffer.Length() > 0)
+
+	if b.restored {
+		b.logf(StoreComponent, InfoLevel, rejoinLogFmt, b.config.Addr, b.config.Port, b.peerBuffer.Length(), loaded)
+	}
+
+	return nil
+}
+
+// saveMessages puts the new elements of messages buffer in message store and
+// prunes the elements which were removed from buffer, if there is a store.
+func (b *BMMC) saveMessages() {
+	if b.messageStore == nil {
+		return
+	}
+
+	if err := b.syncMessageStore(); err != nil {
+		b.logf(StoreComponent, ErrorLevel, saveMessagesLogErrFmt, err)
+	}
+}
+
+// syncMessageStore makes the message store contain the elements of messages buffer.
+func (b *BMMC) syncMessageStore() error {
+	b.storeMux.Lock()
+	defer b.storeMux.Unlock()
+
+	stored, err := b.messageStore.Digest()
+	if err != nil {
+		return err
+	}
+
+	saved := make(map[string]struct{}, len(stored))
+	for _, id := range stored {
+		saved[id] = struct{}{}
+	}
+
+	elements := b.messageBuffer.All()
+	ids := make([]string, len(elements))
+
+	for i, el := range elements {
+		ids[i] = el.ID
+
+		if _, ok := saved[el.ID]; ok {
+			continue
+		}
+
+		if err := b.messageStore.Put(el); err != nil {
+			return err
+		}
+	}
+
+	return b.messageStore.Prune(buffer.MissingStrings(stored, ids))
+}
+
+// closeMessageStore closes the message store, if there is one.
+func (b *BMMC) closeMessageStore() {
+	if b.messageStore == nil {
+		return
+	}
+
+	if err := b.messageStore.Close(); err != nil {
+		b.logf(StoreComponent, ErrorLevel, closeStoreLogErrFmt, err)
+	}
+}
+
+// rejoin announces the return of a restored node to its peers, so peers which
+// removed it add it again, and repairs the messages missed while it was stopped.
+func (b *BMMC) rejoin() {
+	if !b.restored {
+		return
+	}
+
+	msg, err := buffer.NewElement(
+		callback.ComposeAddPeerMessage(b.config.Addr, b.config.Port),
+		callback.ADDPEER,
+	)
+	if err != nil {
+		b.logf(StoreComponent, ErrorLevel, rejoinLogErrFmt, err)
+		return
+	}
+
+	if err := b.addToBuffer(msg); err != nil {
+		b.logf(StoreComponent, ErrorLevel, rejoinLogErrFmt, err)
+		return
+	}
+
+	for _, p := range b.knownPeers() {
+		if err := b.RepairWith(p.Addr, p.Port); err != nil {
+			b.logf(StoreComponent, ErrorLevel, rejoinLogErrFmt, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Message store", func() {
+	var (
+		dir string
+		cfg *Config
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "bmmc")
+		Expect(err).To(Succeed())
+
+		cfg = &Config{
+			Addr:          "localhost",
+			Port:          "1",
+			BufferSize:    16,
+			RoundDuration: time.Millisecond * 20,
+			DataDir:       dir,
+			Transport:     NewMemoryTransport(),
+			Logger:        log.New(ioutil.Discard, "", 0),
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("recovers the buffer of a crashed node", func() {
+		b, err := New(cfg)
+		Expect(err).To(Succeed())
+		Expect(b.messageStore).NotTo(BeNil())
+
+		kept, err := b.addMessage(context.Background(), "kept", NOCALLBACK)
+		Expect(err).To(Succeed())
+		removed, err := b.addMessage(context.Background(), "removed", NOCALLBACK)
+		Expect(err).To(Succeed())
+		b.saveMessages()
+
+		Expect(b.messageBuffer.Remove(removed[0].ID)).To(BeTrue())
+		b.saveMessages()
+
+		// the node is not stopped, as if it crashed after the round
+		recovered, err := New(cfg)
+		Expect(err).To(Succeed())
+		defer recovered.closeMessageStore()
+
+		Expect(recovered.messageBuffer.Digest()).To(Equal([]string{kept[0].ID}))
+		Expect(recovered.restored).To(BeTrue())
+	})
+
+	It("doesn't save the messages in memory store after restart", func() {
+		cfg.MessageStore = MemoryStore
+
+		b, err := New(cfg)
+		Expect(err).To(Succeed())
+
+		_, err = b.addMessage(context.Background(), "lost", NOCALLBACK)
+		Expect(err).To(Succeed())
+		b.saveMessages()
+
+		Expect(b.messageStore.Digest()).To(HaveLen(1))
+
+		restarted, err := New(cfg)
+		Expect(err).To(Succeed())
+		Expect(restarted.messageBuffer.Length()).To(Equal(0))
+	})
+})
@@ -0,0 +1,97 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	repairErrFmt = "error at repairing with %s:%s: %w"
+	replayErrFmt = "error at replaying messages to %s:%s: %w"
+)
+
+// RepairWith synchronizes the messages buffer with given peer immediately,
+// in both directions, without waiting for the peer to be selected in a round.
+func (b *BMMC) RepairWith(addr, port string) error {
+	peerDigest, err := b.fetchDigest(addr, port)
+	if err != nil {
+		return fmt.Errorf(repairErrFmt, addr, port, err)
+	}
+
+	digest := b.messageBuffer.Digest()
+
+	// solicit the messages missing from this node
+	if missingDigest := b.missingFrom(peerDigest); len(missingDigest) > 0 {
+		solicitationMsg := HTTPSolicitation{
+			Envelope:    b.envelope(),
+			Addr:        b.config.Addr,
+			Port:        b.config.Port,
+			RoundNumber: b.gossipRound,
+			Digest:      missingDigest,
+		}
+
+		if err := b.sendSolicitation(b.runContext(), solicitationMsg, addr, port); err != nil {
+			return fmt.Errorf(repairErrFmt, addr, port, err)
+		}
+	}
+
+	// let the peer solicit the messages missing from it
+	if len(buffer.MissingStrings(digest, peerDigest)) > 0 {
+		gossipMsg := HTTPGossip{
+			Envelope:     b.envelope(),
+			Capabilities: localCapabilities,
+			Addr:         b.config.Addr,
+			Port:         b.config.Port,
+			RoundNumber:  b.gossipRound,
+			Digest:       digest,
+		}
+
+		if err := b.sendGossip(b.runContext(), gossipMsg, addr, port); err != nil {
+			return fmt.Errorf(repairErrFmt, addr, port, err)
+		}
+	}
+
+	return nil
+}
+
+// ReplayTo pushes the messages from buffer accepted by filter directly to given
+// peer, through a synchronization message, e.g. to restore a node which missed
+// messages already dropped by the other peers. A nil filter accepts all messages.
+// It returns the number of replayed messages.
+func (b *BMMC) ReplayTo(ctx context.Context, peer Peer, filter func(Message) bool) (int, error) {
+	elements := []buffer.Element{}
+
+	for _, el := range b.messageBuffer.All() {
+		if el.IsMessage() && (filter == nil || filter(b.newMessage(el))) {
+			elements = append(elements, el)
+		}
+	}
+
+	if len(elements) == 0 {
+		return 0, nil
+	}
+
+	if err := b.push(ctx, elements, []Peer{peer})[0].Err; err != nil {
+		return 0, fmt.Errorf(replayErrFmt, peer.Addr, peer.Port, err)
+	}
+
+	return len(elements), nil
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	spoofedAddrLogErrFmt = "Request from %s reported address %s:%s: %s"
+
+	// reportedHostTTL is the time for which the resolution of a host name
+	// reported by a peer is cached, so each request doesn't cause a DNS lookup
+	reportedHostTTL = time.Minute
+	// maxReportedHosts is the maximum number of cached host names, which bounds
+	// the DNS lookups caused by peers to maxReportedHosts per reportedHostTTL
+	maxReportedHosts = 1024
+)
+
+var (
+	errSpoofedAddr          = errors.New("reported address doesn't match the address of the connection")
+	errTooManyReportedHosts = errors.New("too many reported host names to resolve")
+)
+
+// resolvedHost is the cached resolution of a host name.
+type resolvedHost struct {
+	ips     []net.IPAddr
+	err     error
+	expires time.Time
+}
+
+// reportedHosts caches the resolutions of the host names reported by peers,
+// including the failed ones. The lookups are done without holding the lock,
+// and the concurrent resolutions of a host name share a single lookup.
+type reportedHosts struct {
+	hosts map[string]resolvedHost
+	// pending are the host names being looked up, with the channels closed
+	// when their lookups are done
+	pending map[string]chan struct{}
+	lookup  func(ctx context.Context, host string) ([]net.IPAddr, error)
+	mux     sync.Mutex
+}
+
+// newReportedHosts creates a reportedHosts which resolves the host names with
+// the default resolver.
+func newReportedHosts() *reportedHosts {
+	return &reportedHosts{
+		hosts:   map[string]resolvedHost{},
+		pending: map[string]chan struct{}{},
+		lookup:  net.DefaultResolver.LookupIPAddr,
+	}
+}
+
+// resolve returns the addresses of given host name, from cache if it was
+// resolved in the last reportedHostTTL. If the host name is being looked up
+// by another request, it waits for that lookup and checks the cache again.
+func (h *reportedHosts) resolve(ctx context.Context, host string) ([]net.IPAddr, error) {
+	for {
+		h.mux.Lock()
+
+		now := time.Now()
+
+		if r, ok := h.hosts[host]; ok && now.Before(r.expires) {
+			h.mux.Unlock()
+			return r.ips, r.err
+		}
+
+		if done, ok := h.pending[host]; ok {
+			h.mux.Unlock()
+
+			select {
+			case <-done:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if len(h.hosts)+len(h.pending) >= maxReportedHosts {
+			for name, r := range h.hosts {
+				if !now.Before(r.expires) {
+					delete(h.hosts, name)
+				}
+			}
+
+			if len(h.hosts)+len(h.pending) >= maxReportedHosts {
+				h.mux.Unlock()
+				return nil, errTooManyReportedHosts
+			}
+		}
+
+		done := make(chan struct{})
+		h.pending[host] = done
+
+		h.mux.Unlock()
+
+		ips, err := h.lookup(ctx, host)
+
+		h.mux.Lock()
+
+		delete(h.pending, host)
+
+		// a lookup stopped by the request is not cached, so the waiting
+		// requests look the host name up again
+		if ctx.Err() == nil {
+			h.hosts[host] = resolvedHost{ips: ips, err: err, expires: time.Now().Add(reportedHostTTL)}
+		}
+
+		close(done)
+
+		h.mux.Unlock()
+
+		return ips, err
+	}
+}
+
+// verifyReportedAddr checks that the address reported in the body of given
+// request is the address of the connection which sent it, so the replies
+// can't be redirected to other hosts. Only the host is checked: the port of
+// the connection is the ephemeral port of the client, not the port on which
+// the peer listens, so it can't be compared with the reported port. A peer
+// can therefore redirect the replies only to other ports of its own host.
+// Requests which don't carry the address of their connection, e.g. from custom
+// transports, are not checked. Host names are resolved through the
+// reportedHosts cache.
+func (b *BMMC) verifyReportedAddr(r *http.Request, addr string) error {
+	if b.config.TrustReportedAddrs {
+		return nil
+	}
+
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+
+	remoteIP := net.ParseIP(remote)
+	if remoteIP == nil {
+		return nil
+	}
+
+	if ip := net.ParseIP(addr); ip != nil {
+		if ip.Equal(remoteIP) {
+			return nil
+		}
+
+		return errSpoofedAddr
+	}
+
+	ips, err := b.reportedHosts.resolve(r.Context(), addr)
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range ips {
+		if ip.IP.Equal(remoteIP) {
+			return nil
+		}
+	}
+
+	return errSpoofedAddr
+}
+
+// rejectSpoofedAddr answers given request with 403 and returns true if the
+// address reported in its body is not the address of its connection.
+func (b *BMMC) rejectSpoofedAddr(w http.ResponseWriter, r *http.Request, addr, port string) bool {
+	err := b.verifyReportedAddr(r, addr)
+	if err == nil {
+		return false
+	}
+
+	b.replySpoofedAddr(w, r, addr, port, err)
+
+	return true
+}
+
+// replySpoofedAddr answers given request with 403, because the address reported
+// in its body is not the address of its connection.
+func (b *BMMC) replySpoofedAddr(w http.ResponseWriter, r *http.Request, addr, port string, err error) {
+	b.logf(ServerComponent, WarnLevel, spoofedAddrLogErrFmt, r.RemoteAddr, addr, port, err)
+	http.Error(w, err.Error(), http.StatusForbidden)
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Reported addresses", func() {
+	newRequest := func(remoteAddr, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:1"+joinRoute, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+
+		return req
+	}
+
+	DescribeTable("verifyReportedAddr func",
+		func(cfg Config, remoteAddr, addr string, expected error) {
+			b := &BMMC{config: &cfg, reportedHosts: newReportedHosts()}
+			err := b.verifyReportedAddr(newRequest(remoteAddr, ""), addr)
+
+			if expected == nil {
+				Expect(err).To(Succeed())
+			} else {
+				Expect(err).To(MatchError(expected))
+			}
+		},
+		Entry("accepts the address of the connection", Config{}, "10.0.0.1:40000", "10.0.0.1", nil),
+		Entry("accepts host names resolved to the address of the connection", Config{}, "127.0.0.1:40000", "localhost", nil),
+		Entry("rejects other addresses", Config{}, "10.0.0.1:40000", "10.0.0.2", errSpoofedAddr),
+		Entry("rejects host names resolved to other addresses", Config{}, "10.0.0.1:40000", "localhost", errSpoofedAddr),
+		Entry("accepts requests without the address of their connection", Config{}, "", "10.0.0.2", nil),
+		Entry("accepts any address if reported addresses are trusted", Config{TrustReportedAddrs: true},
+			"10.0.0.1:40000", "10.0.0.2", nil),
+	)
+
+	It("rejects the joins of nodes which report other addresses", func() {
+		b := &BMMC{config: &Config{Logger: log.New(ioutil.Discard, "", 0)}}
+
+		raw, err := json.Marshal(HTTPJoin{Envelope: newEnvelope(), Addr: "10.0.0.2", Port: "7000"})
+		Expect(err).To(Succeed())
+
+		w := httptest.NewRecorder()
+		b.joinHandler(w, newRequest("10.0.0.1:40000", string(raw)))
+
+		Expect(w.Code).To(Equal(http.StatusForbidden))
+		Expect(b.peerBuffer).To(BeNil())
+	})
+
+	It("caches the resolutions of the reported host names", func() {
+		lookups := 0
+		h := newReportedHosts()
+		h.lookup = func(_ context.Context, host string) ([]net.IPAddr, error) {
+			lookups++
+
+			if host == "unknown" {
+				return nil, errors.New("no such host")
+			}
+
+			return []net.IPAddr{{IP: net.ParseIP("10.0.0.1")}}, nil
+		}
+
+		for i := 0; i < 3; i++ {
+			ips, err := h.resolve(context.Background(), "peer")
+			Expect(err).To(Succeed())
+			Expect(ips).To(HaveLen(1))
+
+			_, err = h.resolve(context.Background(), "unknown")
+			Expect(err).To(HaveOccurred())
+		}
+
+		Expect(lookups).To(Equal(2))
+
+		for i := len(h.hosts); i < maxReportedHosts; i++ {
+			_, err := h.resolve(context.Background(), "peer-"+strconv.Itoa(i))
+			Expect(err).To(Succeed())
+		}
+
+		_, err := h.resolve(context.Background(), "another-peer")
+		Expect(err).To(MatchError(errTooManyReportedHosts))
+		Expect(lookups).To(Equal(maxReportedHosts))
+	})
+
+	It("resolves the host names without blocking the other resolutions", func() {
+		var lookups int32
+
+		release := make(chan struct{})
+		h := newReportedHosts()
+		h.lookup = func(_ context.Context, host string) ([]net.IPAddr, error) {
+			atomic.AddInt32(&lookups, 1)
+
+			if host == "slow-peer" {
+				<-release
+			}
+
+			return []net.IPAddr{{IP: net.ParseIP("10.0.0.1")}}, nil
+		}
+
+		results := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				_, err := h.resolve(context.Background(), "slow-peer")
+				results <- err
+			}()
+		}
+
+		// the other host names are resolved while the slow lookup runs
+		Eventually(func() int32 { return atomic.LoadInt32(&lookups) }, time.Second*5).Should(BeEquivalentTo(1))
+		_, err := h.resolve(context.Background(), "peer")
+		Expect(err).To(Succeed())
+
+		close(release)
+
+		Eventually(results, time.Second*5).Should(Receive(Succeed()))
+		Eventually(results, time.Second*5).Should(Receive(Succeed()))
+
+		// the concurrent resolutions of the slow host name share its lookup
+		Expect(atomic.LoadInt32(&lookups)).To(BeEquivalentTo(2))
+	})
+
+	It("doesn't sync the messages of synchronizations which report other addresses", func() {
+		b := newTestNode("1")
+
+		el, err := buffer.NewElement("spoofed message", NOCALLBACK)
+		Expect(err).To(Succeed())
+
+		raw, err := json.Marshal(HTTPSynchronization{
+			Envelope: newEnvelope(),
+			Addr:     "10.0.0.2",
+			Port:     "7000",
+			Elements: []buffer.Element{el},
+		})
+		Expect(err).To(Succeed())
+
+		w := httptest.NewRecorder()
+		b.synchronizationHandler(w, newRequest("10.0.0.1:40000", string(raw)))
+
+		Expect(w.Code).To(Equal(http.StatusForbidden))
+		Expect(b.GetMessages()).NotTo(ContainElement("spoofed message"))
+	})
+})
@@ -0,0 +1,67 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const expiredMessagesLogFmt = "BMMC %s:%s evicted %d expired messages in round %d"
+
+// expired returns true if given element is older than MessageTTL.
+// Tombstones never expire this way, since they have their own TTL.
+func (b *BMMC) expired(el buffer.Element) bool {
+	ttl := b.configMessageTTL()
+
+	return ttl > 0 && el.Tombstone == "" && el.Timestamp.Before(time.Now().Add(-ttl))
+}
+
+// removeExpiredMessages evicts the messages older than MessageTTL from buffer.
+// Evicted messages are kept in seen cache, so they are not solicited again
+// when they still are in the digests of peers.
+func (b *BMMC) removeExpiredMessages() {
+	ttl := b.configMessageTTL()
+	if ttl == 0 {
+		return
+	}
+
+	ids := b.messageBuffer.RemoveOlderThan(time.Now().Add(-ttl))
+	if len(ids) == 0 {
+		return
+	}
+
+	for _, id := range ids {
+		b.seen.add(id)
+	}
+
+	atomic.AddInt64(&b.counters.messagesExpired, int64(len(ids)))
+
+	b.logf(GossipComponent, DebugLevel, expiredMessagesLogFmt, b.config.Addr, b.config.Port, len(ids), b.gossipRound.GetNumber())
+}
+
+// BufferLength returns the current number of elements in messages buffer.
+func (b *BMMC) BufferLength() int {
+	return b.messageBuffer.Length()
+}
+
+// BufferBytes returns the approximate size of the elements in messages buffer, in bytes.
+func (b *BMMC) BufferBytes() int {
+	return b.messageBuffer.Bytes()
+}
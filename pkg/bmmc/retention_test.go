@@ -0,0 +1,81 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Message retention", func() {
+	var b *BMMC
+
+	BeforeEach(func() {
+		var err error
+		b, err = New(&Config{
+			Addr:          "localhost",
+			Port:          "1",
+			BufferSize:    16,
+			RoundDuration: time.Millisecond * 20,
+			MessageTTL:    time.Minute,
+			Transport:     NewMemoryTransport(),
+			Logger:        log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+	})
+
+	It("evicts the expired messages", func() {
+		Expect(b.messageBuffer.Add(buffer.Element{
+			ID:           "expired",
+			Timestamp:    time.Now().Add(-time.Hour),
+			Msg:          "expired",
+			CallbackType: NOCALLBACK,
+		})).To(Succeed())
+
+		_, err := b.addMessage(context.Background(), "fresh", NOCALLBACK)
+		Expect(err).To(Succeed())
+		Expect(b.BufferLength()).To(Equal(2))
+
+		b.removeExpiredMessages()
+
+		Expect(b.GetMessages()).To(ConsistOf("fresh"))
+		Expect(b.BufferLength()).To(Equal(1))
+		Expect(b.BufferBytes()).To(BeNumerically(">", 0))
+		Expect(b.Stats().MessagesExpired).To(Equal(int64(1)))
+
+		// the evicted message is not solicited again from peers
+		Expect(b.missingFrom([]string{"expired"})).To(BeEmpty())
+	})
+
+	It("doesn't sync the expired messages from peers", func() {
+		b.syncElement(buffer.Element{
+			ID:           "expired",
+			Timestamp:    time.Now().Add(-time.Hour),
+			Msg:          "expired",
+			CallbackType: NOCALLBACK,
+		}, "localhost", "2")
+
+		Expect(b.BufferLength()).To(Equal(0))
+	})
+})
@@ -0,0 +1,191 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	retransmitLogFmt = "BMMC %s:%s retransmits critical message %s to %d peers"
+
+	defaultRetransmitTimeout = time.Second
+)
+
+// criticalMessage is a critical message which some peers didn't acknowledge.
+type criticalMessage struct {
+	elements []buffer.Element
+	unacked  map[string]Peer
+	next     time.Time
+}
+
+// retransmissions keeps the critical messages which are not acknowledged by
+// all peers, by message ID.
+type retransmissions struct {
+	messages map[string]*criticalMessage
+	mux      sync.Mutex
+}
+
+// newRetransmissions creates an empty retransmissions.
+func newRetransmissions() *retransmissions {
+	return &retransmissions{
+		messages: map[string]*criticalMessage{},
+	}
+}
+
+// messageID returns the ID of the message disseminated as given elements.
+func messageID(elements []buffer.Element) string {
+	if f := elements[0].Fragment; f != nil {
+		return f.Group
+	}
+
+	return elements[0].ID
+}
+
+// track tracks given critical message until the peers which didn't handle its
+// push acknowledge it.
+func (r *retransmissions) track(elements []buffer.Element, results []BroadcastResult, next time.Time) {
+	unacked := map[string]Peer{}
+
+	for _, res := range results {
+		if res.Err != nil {
+			unacked[fullHost(res.Peer.Addr, res.Peer.Port)] = res.Peer
+		}
+	}
+
+	if len(elements) == 0 || len(unacked) == 0 {
+		return
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.messages[messageID(elements)] = &criticalMessage{
+		elements: elements,
+		unacked:  unacked,
+		next:     next,
+	}
+}
+
+// ack records that given peer acknowledged given messages, e.g. because they
+// are in its digest.
+func (r *retransmissions) ack(addr, port string, ids []string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for _, id := range ids {
+		m, ok := r.messages[id]
+		if !ok {
+			continue
+		}
+
+		delete(m.unacked, fullHost(addr, port))
+
+		if len(m.unacked) == 0 {
+			delete(r.messages, id)
+		}
+	}
+}
+
+// due returns the critical messages whose retransmission timeout expired and
+// schedules their next retransmission.
+func (r *retransmissions) due(now, next time.Time) map[string]*criticalMessage {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	due := map[string]*criticalMessage{}
+
+	for id, m := range r.messages {
+		if now.Before(m.next) {
+			continue
+		}
+
+		m.next = next
+		due[id] = &criticalMessage{
+			elements: m.elements,
+			unacked:  make(map[string]Peer, len(m.unacked)),
+		}
+
+		for host, p := range m.unacked {
+			due[id].unacked[host] = p
+		}
+	}
+
+	return due
+}
+
+// forget stops retransmitting given message.
+func (r *retransmissions) forget(id string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	delete(r.messages, id)
+}
+
+// pending returns the number of critical messages which are not acknowledged by all peers.
+func (r *retransmissions) pending() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return len(r.messages)
+}
+
+// retransmit pushes the critical messages again to the known peers which didn't
+// acknowledge them before RetransmitTimeout. The messages which left the buffer
+// are not retransmitted anymore.
+func (b *BMMC) retransmit() {
+	now := time.Now()
+
+	for id, m := range b.retransmissions.due(now, now.Add(b.config.RetransmitTimeout)) {
+		if _, ok := b.messageBuffer.Get(id); !ok {
+			b.retransmissions.forget(id)
+			continue
+		}
+
+		peers := []Peer{}
+
+		for _, p := range b.bans.withoutBanned(b.knownPeers()) {
+			if _, ok := m.unacked[fullHost(p.Addr, p.Port)]; ok {
+				peers = append(peers, p)
+			}
+		}
+
+		if len(peers) == 0 {
+			b.retransmissions.forget(id)
+			continue
+		}
+
+		b.logf(GossipComponent, DebugLevel, retransmitLogFmt, b.config.Addr, b.config.Port, id, len(peers))
+
+		elements := m.elements
+
+		b.spawn(func() {
+			ctx, cancel := context.WithTimeout(b.runContext(), b.config.RequestTimeout)
+			defer cancel()
+
+			for _, res := range b.push(ctx, elements, peers) {
+				if res.Err == nil {
+					b.retransmissions.ack(res.Peer.Addr, res.Peer.Port, []string{messageID(elements)})
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+var _ = Describe("Retransmissions", func() {
+	It("tracks the critical messages until all peers acknowledge them", func() {
+		r := newRetransmissions()
+
+		a := Peer{Addr: "localhost", Port: "2"}
+		c := Peer{Addr: "localhost", Port: "3"}
+
+		r.track([]buffer.Element{{ID: "id"}}, []BroadcastResult{
+			{Peer: a, Err: errors.New("unreachable")},
+			{Peer: c, Err: errors.New("unreachable")},
+			{Peer: Peer{Addr: "localhost", Port: "4"}},
+		}, time.Now())
+		Expect(r.pending()).To(Equal(1))
+
+		due := r.due(time.Now(), time.Now().Add(time.Hour))
+		Expect(due).To(HaveKey("id"))
+		Expect(due["id"].unacked).To(HaveLen(2))
+		Expect(r.due(time.Now(), time.Now().Add(time.Hour))).To(BeEmpty())
+
+		r.ack("localhost", "2", []string{"id", "other"})
+		Expect(r.pending()).To(Equal(1))
+
+		r.ack("localhost", "3", []string{"id"})
+		Expect(r.pending()).To(BeZero())
+	})
+
+	It("pushes the critical messages again to the peers which didn't handle them", func() {
+		transport := NewMemoryTransport()
+
+		newNode := func(port string, roles Role) *BMMC {
+			b, err := New(&Config{
+				Addr:              "localhost",
+				Port:              port,
+				BufferSize:        16,
+				RoundDuration:     time.Millisecond * 20,
+				RetransmitTimeout: time.Millisecond * 50,
+				Transport:         transport,
+				Logger:            log.New(ioutil.Discard, "", 0),
+				Roles:             roles,
+			})
+			Expect(err).To(Succeed())
+
+			return b
+		}
+
+		// the sender doesn't gossip, so the message is received only by retransmission
+		sender := newNode("1", StorageRole|ObserverRole)
+		Expect(sender.Start()).To(Succeed())
+		defer sender.Stop() // nolint: errcheck
+
+		Expect(sender.AddPeer("localhost", "2")).To(Succeed())
+
+		results, err := sender.Broadcast(context.Background(), "critical message", BroadcastOptions{Critical: true})
+		Expect(err).To(Succeed())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Err).To(HaveOccurred())
+		Expect(sender.retransmissions.pending()).To(Equal(1))
+
+		receiver := newNode("2", DefaultRoles)
+		Expect(receiver.Start()).To(Succeed())
+		defer receiver.Stop() // nolint: errcheck
+
+		Eventually(receiver.GetMessages, time.Second*5).Should(ContainElement("critical message"))
+		Eventually(sender.retransmissions.pending).Should(BeZero())
+	})
+})
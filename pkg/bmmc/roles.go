@@ -0,0 +1,92 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync"
+)
+
+// Role is a set of protocol phases in which a node participates.
+type Role uint8
+
+const (
+	// GossiperRole nodes start gossip rounds, sending their digest to peers.
+	GossiperRole Role = 1 << iota
+	// StorageRole nodes answer solicitations with synchronization messages.
+	StorageRole
+	// ObserverRole nodes run custom callbacks for delivered messages.
+	ObserverRole
+	// BridgeRole nodes gossip new messages to all their peers as soon as they
+	// receive them, connecting meshes which don't know each other.
+	BridgeRole
+
+	// DefaultRoles are the roles of a node, if no roles are configured.
+	DefaultRoles = GossiperRole | StorageRole | ObserverRole
+)
+
+// Has returns true if role contains all given roles.
+func (r Role) Has(roles Role) bool {
+	return r&roles == roles
+}
+
+// peerRoles keeps the roles announced by peers in their gossip messages.
+type peerRoles struct {
+	roles map[string]Role
+	mux   sync.Mutex
+}
+
+// newPeerRoles creates a peerRoles.
+func newPeerRoles() *peerRoles {
+	return &peerRoles{
+		roles: map[string]Role{},
+	}
+}
+
+// set sets the roles of given peer.
+func (p *peerRoles) set(addr, port string, roles Role) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.roles[fullHost(addr, port)] = roles
+}
+
+// get returns the roles of given peer.
+// Peers which haven't announced their roles have the default roles.
+func (p *peerRoles) get(addr, port string) Role {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if r, ok := p.roles[fullHost(addr, port)]; ok {
+		return r
+	}
+
+	return DefaultRoles
+}
+
+// messageReceivers returns the peers which use the messages, so they are
+// worth gossiping to.
+func messageReceivers(peers []Peer) []Peer {
+	receivers := make([]Peer, 0, len(peers))
+
+	for _, p := range peers {
+		if p.Roles&(StorageRole|ObserverRole|BridgeRole) != 0 {
+			receivers = append(receivers, p)
+		}
+	}
+
+	return receivers
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Roles", func() {
+	DescribeTable("Has func",
+		func(r, roles Role, expected bool) {
+			Expect(r.Has(roles)).To(Equal(expected))
+		},
+		Entry("contains the role", DefaultRoles, StorageRole, true),
+		Entry("contains all roles", DefaultRoles, GossiperRole|ObserverRole, true),
+		Entry("doesn't contain the role", DefaultRoles, BridgeRole, false),
+		Entry("contains only some roles", GossiperRole, GossiperRole|StorageRole, false),
+	)
+
+	It("returns default roles for unknown peers", func() {
+		p := newPeerRoles()
+		p.set("localhost", "10000", ObserverRole)
+
+		Expect(p.get("localhost", "10000")).To(Equal(ObserverRole))
+		Expect(p.get("localhost", "20000")).To(Equal(DefaultRoles))
+	})
+
+	It("selects only peers which use messages", func() {
+		peers := []Peer{
+			{Addr: "localhost", Port: "10000", Roles: GossiperRole},
+			{Addr: "localhost", Port: "20000", Roles: StorageRole},
+			{Addr: "localhost", Port: "30000", Roles: ObserverRole},
+			{Addr: "localhost", Port: "40000", Roles: BridgeRole},
+		}
+
+		Expect(messageReceivers(peers)).To(Equal(peers[1:]))
+	})
+})
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+)
+
+// samplerSlot keeps the observed peer with the lowest hash for its seed.
+// Since the hash is random for each seed, the kept peer is a uniformly random
+// sample of all observed peers, no matter how often each peer is observed.
+type samplerSlot struct {
+	seed uint64
+	peer Peer
+	hash uint64
+	set  bool
+}
+
+// peerSampler is a Brahms-style sampling layer: it provides uniformly random
+// samples from the stream of peers observed in membership exchanges, even if
+// the node only knows a partial view.
+type peerSampler struct {
+	slots []samplerSlot
+	mux   sync.Mutex
+}
+
+// newPeerSampler creates a peerSampler with given number of slots.
+func newPeerSampler(size int) *peerSampler {
+	slots := make([]samplerSlot, size)
+	for i := range slots {
+		slots[i].seed = rand.Uint64()
+	}
+
+	return &peerSampler{
+		slots: slots,
+	}
+}
+
+// samplerHash returns the hash of given peer for given seed.
+func samplerHash(seed uint64, p Peer) uint64 {
+	h := fnv.New64a()
+
+	var s [8]byte
+
+	binary.LittleEndian.PutUint64(s[:], seed)
+	h.Write(s[:])                             // nolint: errcheck
+	h.Write([]byte(fullHost(p.Addr, p.Port))) // nolint: errcheck
+
+	return h.Sum64()
+}
+
+// observe offers given peers to all slots.
+func (s *peerSampler) observe(peers ...Peer) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, p := range peers {
+		p.Roles = 0
+
+		for i := range s.slots {
+			if hash := samplerHash(s.slots[i].seed, p); !s.slots[i].set || hash < s.slots[i].hash {
+				s.slots[i].peer = p
+				s.slots[i].hash = hash
+				s.slots[i].set = true
+			}
+		}
+	}
+}
+
+// invalidate resets the slots which keep given peer, so they sample again.
+func (s *peerSampler) invalidate(addr, port string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for i := range s.slots {
+		if s.slots[i].set && s.slots[i].peer.Addr == addr && s.slots[i].peer.Port == port {
+			s.slots[i] = samplerSlot{seed: rand.Uint64()}
+		}
+	}
+}
+
+// sample returns the distinct peers kept by slots.
+func (s *peerSampler) sample() []Peer {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	seen := map[Peer]struct{}{}
+	peers := []Peer{}
+
+	for _, slot := range s.slots {
+		if _, ok := seen[slot.peer]; slot.set && !ok {
+			seen[slot.peer] = struct{}{}
+			peers = append(peers, slot.peer)
+		}
+	}
+
+	return peers
+}
+
+// candidatePeers returns the peers from which gossip targets are selected:
+// the known peers and, if peer sampling is enabled, the sampled peers.
+func (b *BMMC) candidatePeers() []Peer {
+	known := b.knownPeers()
+	if b.sampler == nil {
+		return known
+	}
+
+	b.sampler.observe(known...)
+
+	candidates := known
+	self := fullHost(b.config.Addr, b.config.Port)
+
+	for _, p := range b.sampler.sample() {
+		if host := fullHost(p.Addr, p.Port); host != self && !b.isKnownPeer(p.Addr, p.Port) {
+			p.Roles = b.peerRoles.get(p.Addr, p.Port)
+			candidates = append(candidates, p)
+		}
+	}
+
+	return candidates
+}
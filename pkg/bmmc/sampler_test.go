@@ -0,0 +1,78 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Peer sampler", func() {
+	peers := newDummyPeers("10000", "10001", "10002", "10003", "10004",
+		"10005", "10006", "10007", "10008", "10009")
+
+	It("samples all observed peers", func() {
+		s := newPeerSampler(200)
+		s.observe(peers...)
+
+		Expect(s.sample()).To(ConsistOf(peers))
+	})
+
+	It("is not biased by peers which are observed more often", func() {
+		s := newPeerSampler(1000)
+
+		for i := 0; i < 100; i++ {
+			s.observe(peers[0])
+		}
+
+		s.observe(peers...)
+
+		slots := 0
+
+		for _, slot := range s.slots {
+			if slot.peer == peers[0] {
+				slots++
+			}
+		}
+
+		// the peer is expected in 1/10 of the slots
+		Expect(slots).To(BeNumerically("<", 200))
+	})
+
+	It("forgets invalidated peers", func() {
+		s := newPeerSampler(50)
+		s.observe(peers[0], peers[1])
+		s.invalidate(peers[0].Addr, peers[0].Port)
+
+		Expect(s.sample()).NotTo(ContainElement(peers[0]))
+	})
+
+	It("adds the sampled peers to gossip candidates", func() {
+		b, err := New(&Config{Addr: "localhost", Port: "19999", BufferSize: 32, SamplerSize: 50})
+		Expect(err).To(Succeed())
+		Expect(b.AddPeer("localhost", "10000")).To(Succeed())
+
+		b.mergePeers("localhost", "10001", nil)
+
+		candidates := []string{}
+		for _, p := range b.candidatePeers() {
+			candidates = append(candidates, fullHost(p.Addr, p.Port))
+		}
+
+		Expect(candidates).To(ConsistOf("localhost:10000", "localhost:10001"))
+	})
+})
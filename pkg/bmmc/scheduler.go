@@ -0,0 +1,158 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Scheduler decides when the gossip rounds of a node run.
+type Scheduler interface {
+	// Run calls round for each gossip round, until stop is closed. The rounds
+	// must not run concurrently.
+	Run(stop <-chan struct{}, round func())
+}
+
+// delayScheduler runs the rounds one after another, waiting between them for
+// the duration returned by delay. A signal on wake cuts the wait to the
+// duration returned by wakeDelay, if it is shorter.
+type delayScheduler struct {
+	delay     func() time.Duration
+	wake      <-chan struct{}
+	wakeDelay func() time.Duration
+}
+
+// Run runs the rounds until stop is closed.
+func (s delayScheduler) Run(stop <-chan struct{}, round func()) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		round()
+
+		if !s.wait(stop) {
+			return
+		}
+	}
+}
+
+// wait waits for the next round. It returns false if stop is closed.
+func (s delayScheduler) wait(stop <-chan struct{}) bool {
+	d := s.delay()
+	deadline := time.Now().Add(d)
+	timer := time.NewTimer(d)
+
+	for {
+		select {
+		case <-stop:
+			timer.Stop()
+			return false
+		case <-timer.C:
+			return true
+		case <-s.wake:
+			d = s.wakeDelay()
+			if time.Until(deadline) <= d {
+				continue
+			}
+
+			if !timer.Stop() {
+				<-timer.C
+			}
+
+			deadline = time.Now().Add(d)
+			timer.Reset(d)
+		}
+	}
+}
+
+// NewIntervalScheduler creates a Scheduler which runs a round every interval,
+// plus a random jitter up to given jitter.
+func NewIntervalScheduler(interval, jitter time.Duration) Scheduler {
+	return delayScheduler{
+		delay: func() time.Duration {
+			if jitter <= 0 {
+				return interval
+			}
+
+			return interval + time.Duration(rand.Int63n(int64(jitter)))
+		},
+	}
+}
+
+// ManualScheduler runs a round each time Tick is called, e.g. from the event
+// loop of an embedding system or from a test clock.
+type ManualScheduler struct {
+	ticks chan chan struct{}
+}
+
+// NewManualScheduler creates a ManualScheduler.
+func NewManualScheduler() *ManualScheduler {
+	return &ManualScheduler{
+		ticks: make(chan chan struct{}),
+	}
+}
+
+// Run runs a round for each tick, until stop is closed.
+func (s *ManualScheduler) Run(stop <-chan struct{}, round func()) {
+	for {
+		select {
+		case <-stop:
+			return
+		case done := <-s.ticks:
+			round()
+			close(done)
+		}
+	}
+}
+
+// Tick runs a gossip round and waits for it to finish. It returns the error of
+// ctx if the round didn't start before ctx is done, e.g. because the node is
+// not running.
+func (s *ManualScheduler) Tick(ctx context.Context) error {
+	done := make(chan struct{})
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case s.ticks <- done:
+	}
+
+	<-done
+
+	return nil
+}
+
+// scheduler returns the configured scheduler. By default, the rounds last
+// RoundDuration plus RoundJitter, and they are lengthened up to
+// MaxRoundDuration while there are no new messages. When new messages are
+// added, the next round waits at most RoundDuration.
+func (b *BMMC) scheduler() Scheduler {
+	if b.config.Scheduler != nil {
+		return b.config.Scheduler
+	}
+
+	return delayScheduler{
+		delay:     b.roundDuration,
+		wake:      b.wake,
+		wakeDelay: b.configRoundDuration,
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scheduler", func() {
+	It("runs rounds at fixed intervals until it is stopped", func() {
+		var rounds int32
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+
+		go func() {
+			NewIntervalScheduler(time.Millisecond*10, time.Millisecond).Run(stop, func() {
+				atomic.AddInt32(&rounds, 1)
+			})
+			close(done)
+		}()
+
+		Eventually(func() int32 { return atomic.LoadInt32(&rounds) }).Should(BeNumerically(">=", 3))
+
+		close(stop)
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("runs a round for each tick of a manual scheduler", func() {
+		scheduler := NewManualScheduler()
+
+		b, err := New(&Config{
+			Addr:          "localhost",
+			Port:          "1",
+			BufferSize:    16,
+			RoundDuration: time.Millisecond * 20,
+			Transport:     NewMemoryTransport(),
+			Logger:        log.New(ioutil.Discard, "", 0),
+			Scheduler:     scheduler,
+		})
+		Expect(err).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		Expect(scheduler.Tick(ctx)).To(MatchError(context.DeadlineExceeded))
+
+		Expect(b.Start()).To(Succeed())
+		defer b.Stop() // nolint: errcheck
+
+		for i := 0; i < 3; i++ {
+			Expect(scheduler.Tick(context.Background())).To(Succeed())
+		}
+
+		Expect(b.Stats().Rounds).To(Equal(int64(3)))
+		Expect(b.gossipRound.GetNumber()).To(Equal(int64(3)))
+	})
+})
@@ -0,0 +1,271 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/detector"
+)
+
+const (
+	peerStatusErrFmt = "peer answered with status %s"
+
+	// scoreSmoothing is the weight of the last request in RTT and failure rate
+	scoreSmoothing = 0.2
+	// minScore is the score of the least responsive peers, so they are still
+	// selected from time to time and can recover
+	minScore = 0.01
+)
+
+// PeerScore is the responsiveness of a peer, measured on requests sent to it.
+type PeerScore struct {
+	Addr string
+	Port string
+	// RTT is the smoothed round trip time of successful requests
+	RTT time.Duration
+	// FailureRate is the smoothed rate of failed requests, between 0 and 1
+	FailureRate float64
+	// Requests is the number of requests sent to the peer
+	Requests int
+	// Failures is the number of failed requests
+	Failures int
+	// ConsecutiveFailures is the number of failed requests since the last successful request
+	ConsecutiveFailures int
+	// LastSuccess is the time of the last successful request
+	LastSuccess time.Time
+	// LastFailure is the time of the last failed request
+	LastFailure time.Time
+	// Score is between 0 and 1. Responsive peers have higher scores.
+	Score float64
+	// QuarantinedUntil is the time until which the peer is not selected for
+	// gossip, because it failed consistently or answered slowly (see
+	// QuarantineDuration)
+	QuarantinedUntil time.Time
+}
+
+// Quarantined returns true if the peer is in quarantine at given time.
+func (s PeerScore) Quarantined(now time.Time) bool {
+	return now.Before(s.QuarantinedUntil)
+}
+
+// peerScores keeps the responsiveness of peers.
+type peerScores struct {
+	scores map[string]*PeerScore
+	mux    sync.Mutex
+}
+
+// newPeerScores creates an empty peerScores.
+func newPeerScores() *peerScores {
+	return &peerScores{
+		scores: map[string]*PeerScore{},
+	}
+}
+
+// record records a request sent to given peer and returns its score.
+func (p *peerScores) record(addr, port string, rtt time.Duration, failed bool) PeerScore {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	s, ok := p.scores[fullHost(addr, port)]
+	if !ok {
+		s = &PeerScore{Addr: addr, Port: port}
+		p.scores[fullHost(addr, port)] = s
+	}
+
+	s.Requests++
+
+	failure := 0.0
+
+	switch {
+	case failed:
+		failure = 1
+		s.Failures++
+		s.ConsecutiveFailures++
+		s.LastFailure = time.Now()
+	case s.RTT == 0:
+		s.RTT = rtt
+		s.ConsecutiveFailures = 0
+		s.LastSuccess = time.Now()
+	default:
+		s.RTT = time.Duration((1-scoreSmoothing)*float64(s.RTT) + scoreSmoothing*float64(rtt))
+		s.ConsecutiveFailures = 0
+		s.LastSuccess = time.Now()
+	}
+
+	if s.Requests == 1 {
+		s.FailureRate = failure
+	} else {
+		s.FailureRate = (1-scoreSmoothing)*s.FailureRate + scoreSmoothing*failure
+	}
+
+	s.Score = (1 - s.FailureRate) / (1 + s.RTT.Seconds())
+	if s.Score < minScore {
+		s.Score = minScore
+	}
+
+	return *s
+}
+
+// score returns the score of given peer. Unknown peers have the highest score.
+func (p *peerScores) score(peer Peer) float64 {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if s, ok := p.scores[fullHost(peer.Addr, peer.Port)]; ok {
+		return s.Score
+	}
+
+	return 1
+}
+
+// quarantine puts given peer in quarantine for given duration. It returns
+// false if the peer is unknown or already in quarantine.
+func (p *peerScores) quarantine(addr, port string, d time.Duration) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	s, ok := p.scores[fullHost(addr, port)]
+	if !ok || s.Quarantined(time.Now()) {
+		return false
+	}
+
+	s.QuarantinedUntil = time.Now().Add(d)
+
+	return true
+}
+
+// quarantined returns true if given peer is in quarantine.
+func (p *peerScores) quarantined(peer Peer) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	s, ok := p.scores[fullHost(peer.Addr, peer.Port)]
+
+	return ok && s.Quarantined(time.Now())
+}
+
+// list returns the scores of all peers, sorted by host.
+func (p *peerScores) list() []PeerScore {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	scores := make([]PeerScore, 0, len(p.scores))
+	for _, s := range p.scores {
+		scores = append(scores, *s)
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		return fullHost(scores[i].Addr, scores[i].Port) < fullHost(scores[j].Addr, scores[j].Port)
+	})
+
+	return scores
+}
+
+// scoringTransport records the responsiveness of peers and the transferred
+// bytes for each request.
+type scoringTransport struct {
+	next        http.RoundTripper
+	scores      *peerScores
+	counters    *counters
+	coordinates *coordinates
+	loss        *lossEstimator
+	detector    *detector.Detector
+	// report receives the consecutive failures of a peer and the last failure,
+	// with the route of the failed request
+	report func(addr, port, route string, failures int, cause error)
+	// reachable receives the peers which answered a request
+	reachable func(addr, port string)
+	// assess receives the score of a peer after each request
+	assess func(s PeerScore)
+}
+
+// RoundTrip sends the request and records its round trip time.
+func (t *scoringTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.counters != nil && req.Body != nil {
+		req = req.Clone(req.Context())
+		req.Body = countReads(req.Body, &t.counters.bytesSent)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	rtt := time.Since(start)
+	score := t.scores.record(req.URL.Hostname(), req.URL.Port(), rtt, failed)
+
+	if t.report != nil && failed {
+		cause := err
+		if cause == nil {
+			cause = fmt.Errorf(peerStatusErrFmt, resp.Status) // nolint: goerr113
+		}
+
+		t.report(req.URL.Hostname(), req.URL.Port(), req.URL.Path, score.ConsecutiveFailures, cause)
+	}
+
+	if t.assess != nil {
+		t.assess(score)
+	}
+
+	if t.reachable != nil && !failed {
+		t.reachable(req.URL.Hostname(), req.URL.Port())
+	}
+
+	if t.loss != nil {
+		t.loss.observe(failed)
+	}
+
+	if t.detector != nil {
+		if failed {
+			t.detector.Failed(req.URL.Host, time.Now())
+		} else {
+			t.detector.Alive(req.URL.Host)
+		}
+	}
+
+	if t.coordinates != nil && !failed {
+		t.coordinates.observe(req.URL.Hostname(), req.URL.Port(), rtt)
+	}
+
+	if t.counters != nil && err == nil {
+		resp.Body = countReads(resp.Body, &t.counters.bytesReceived)
+	}
+
+	return resp, err
+}
+
+// clientTransport returns the scoringTransport of the requests sent to peers,
+// whose next transport is replaced by the simulations.
+func (b *BMMC) clientTransport() (*scoringTransport, bool) {
+	bt, ok := b.netClient.Transport.(*backoffTransport)
+	if !ok {
+		return nil, false
+	}
+
+	t, ok := bt.next.(*scoringTransport)
+
+	return t, ok
+}
+
+// PeerScores returns the responsiveness of peers to which requests were sent.
+func (b *BMMC) PeerScores() []PeerScore {
+	return b.peerScores.list()
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Peer scores", func() {
+	var scores *peerScores
+
+	BeforeEach(func() {
+		scores = newPeerScores()
+	})
+
+	It("gives the highest score to unknown peers", func() {
+		Expect(scores.score(Peer{Addr: "localhost", Port: "10000"})).To(Equal(1.0))
+	})
+
+	It("gives lower scores to slow and failing peers", func() {
+		for i := 0; i < 5; i++ {
+			scores.record("localhost", "10000", time.Millisecond, false)
+			scores.record("localhost", "20000", time.Second, false)
+			scores.record("localhost", "30000", time.Millisecond, true)
+		}
+
+		fast := scores.score(Peer{Addr: "localhost", Port: "10000"})
+		slow := scores.score(Peer{Addr: "localhost", Port: "20000"})
+		failing := scores.score(Peer{Addr: "localhost", Port: "30000"})
+
+		Expect(fast).To(BeNumerically(">", slow))
+		Expect(slow).To(BeNumerically(">", failing))
+		Expect(failing).To(BeNumerically(">=", minScore))
+
+		list := scores.list()
+		Expect(list).To(HaveLen(3))
+		Expect(list[2].Requests).To(Equal(5))
+		Expect(list[2].Failures).To(Equal(5))
+	})
+
+	It("records the requests sent through the transport", func() {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		client := &http.Client{Transport: &scoringTransport{next: http.DefaultTransport, scores: scores}}
+
+		resp, err := client.Get(srv.URL)
+		Expect(err).To(Succeed())
+		Expect(resp.Body.Close()).To(Succeed())
+
+		u, err := url.Parse(srv.URL)
+		Expect(err).To(Succeed())
+
+		list := scores.list()
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Addr).To(Equal(u.Hostname()))
+		Expect(list[0].Port).To(Equal(u.Port()))
+		Expect(list[0].Failures).To(Equal(1))
+	})
+})
@@ -0,0 +1,81 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync"
+)
+
+// seenCache keeps the IDs of the most recently delivered messages, so messages
+// dropped from buffer, which still circulate among peers, are not delivered again.
+type seenCache struct {
+	ids   map[string]struct{}
+	order []string
+	next  int
+	mux   sync.Mutex
+}
+
+// newSeenCache creates a seenCache with given capacity.
+func newSeenCache(size int) *seenCache {
+	return &seenCache{
+		ids:   make(map[string]struct{}, size),
+		order: make([]string, size),
+	}
+}
+
+// add adds given ID in cache. If the cache is full, the oldest ID is dropped.
+func (c *seenCache) add(id string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if len(c.order) == 0 {
+		return
+	}
+
+	if _, ok := c.ids[id]; ok {
+		return
+	}
+
+	delete(c.ids, c.order[c.next])
+
+	c.order[c.next] = id
+	c.ids[id] = struct{}{}
+	c.next = (c.next + 1) % len(c.order)
+}
+
+// list returns the IDs from cache.
+func (c *seenCache) list() []string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	ids := make([]string, 0, len(c.ids))
+	for id := range c.ids {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// has returns true if given ID is in cache.
+func (c *seenCache) has(id string) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	_, ok := c.ids[id]
+
+	return ok
+}
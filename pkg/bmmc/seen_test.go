@@ -0,0 +1,43 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Seen cache", func() {
+	It("keeps the most recently added IDs", func() {
+		c := newSeenCache(2)
+		c.add("first")
+		c.add("second")
+		c.add("second")
+		c.add("third")
+
+		Expect(c.has("first")).To(BeFalse())
+		Expect(c.has("second")).To(BeTrue())
+		Expect(c.has("third")).To(BeTrue())
+	})
+
+	It("doesn't keep any ID when its size is 0", func() {
+		c := newSeenCache(0)
+		c.add("first")
+
+		Expect(c.has("first")).To(BeFalse())
+	})
+})
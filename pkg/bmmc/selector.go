@@ -0,0 +1,328 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Peer is a node known by the protocol.
+type Peer struct {
+	Addr  string
+	Port  string
+	Roles Role
+}
+
+// PeerSelector selects the peers which receive gossip messages in a round.
+type PeerSelector interface {
+	// Select returns at most n distinct peers from the given peers.
+	Select(peers []Peer, n int) []Peer
+}
+
+// RandomSelector selects peers uniformly at random.
+type RandomSelector struct{}
+
+// NewRandomSelector creates a RandomSelector.
+func NewRandomSelector() *RandomSelector {
+	return &RandomSelector{}
+}
+
+// Select returns n random peers.
+func (s *RandomSelector) Select(peers []Peer, n int) []Peer {
+	n = selectLen(peers, n)
+
+	selected := make([]Peer, n)
+	for i, j := range rand.Perm(len(peers))[:n] {
+		selected[i] = peers[j]
+	}
+
+	return selected
+}
+
+// RoundRobinSelector selects peers in the order in which they are given,
+// continuing from where the previous round stopped.
+type RoundRobinSelector struct {
+	next int
+	mux  sync.Mutex
+}
+
+// NewRoundRobinSelector creates a RoundRobinSelector.
+func NewRoundRobinSelector() *RoundRobinSelector {
+	return &RoundRobinSelector{}
+}
+
+// Select returns the next n peers.
+func (s *RoundRobinSelector) Select(peers []Peer, n int) []Peer {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	n = selectLen(peers, n)
+
+	selected := make([]Peer, n)
+	for i := 0; i < n; i++ {
+		selected[i] = peers[(s.next+i)%len(peers)]
+	}
+
+	if len(peers) > 0 {
+		s.next = (s.next + n) % len(peers)
+	}
+
+	return selected
+}
+
+// LeastRecentlyGossipedSelector selects the peers which have not been
+// selected for the longest time. Peers never selected come first.
+type LeastRecentlyGossipedSelector struct {
+	lastSelected map[Peer]time.Time
+	mux          sync.Mutex
+}
+
+// NewLeastRecentlyGossipedSelector creates a LeastRecentlyGossipedSelector.
+func NewLeastRecentlyGossipedSelector() *LeastRecentlyGossipedSelector {
+	return &LeastRecentlyGossipedSelector{
+		lastSelected: map[Peer]time.Time{},
+	}
+}
+
+// Select returns the n least recently selected peers.
+func (s *LeastRecentlyGossipedSelector) Select(peers []Peer, n int) []Peer {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	n = selectLen(peers, n)
+
+	// shuffle first, so peers with equal timestamps are picked randomly
+	candidates := NewRandomSelector().Select(peers, len(peers))
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return s.lastSelected[candidates[i]].Before(s.lastSelected[candidates[j]])
+	})
+
+	selected := candidates[:n]
+
+	now := time.Now()
+	for _, p := range selected {
+		s.lastSelected[p] = now
+	}
+
+	// forget peers which are no longer known
+	known := make(map[Peer]struct{}, len(peers))
+	for _, p := range peers {
+		known[p] = struct{}{}
+	}
+
+	for p := range s.lastSelected {
+		if _, ok := known[p]; !ok {
+			delete(s.lastSelected, p)
+		}
+	}
+
+	return selected
+}
+
+// WeightedSelector selects peers randomly, with a probability proportional
+// to their weight. Peers with a weight lower or equal to 0 are never selected.
+type WeightedSelector struct {
+	weight func(Peer) float64
+}
+
+// NewWeightedSelector creates a WeightedSelector with given weight func.
+// Without a weight func, all peers have the same weight.
+func NewWeightedSelector(weight func(Peer) float64) *WeightedSelector {
+	if weight == nil {
+		weight = func(Peer) float64 { return 1 }
+	}
+
+	return &WeightedSelector{
+		weight: weight,
+	}
+}
+
+// Select returns n weighted random peers.
+func (s *WeightedSelector) Select(peers []Peer, n int) []Peer {
+	type keyedPeer struct {
+		peer Peer
+		key  float64
+	}
+
+	// weighted random sampling without replacement (Efraimidis-Spirakis)
+	keyed := make([]keyedPeer, 0, len(peers))
+
+	for _, p := range peers {
+		w := s.weight(p)
+		if w <= 0 {
+			continue
+		}
+
+		keyed = append(keyed, keyedPeer{
+			peer: p,
+			key:  math.Pow(rand.Float64(), 1/w),
+		})
+	}
+
+	sort.Slice(keyed, func(i, j int) bool {
+		return keyed[i].key > keyed[j].key
+	})
+
+	if n > len(keyed) {
+		n = len(keyed)
+	}
+
+	selected := make([]Peer, n)
+	for i := range selected {
+		selected[i] = keyed[i].peer
+	}
+
+	return selected
+}
+
+// LatencyAwareSelector prefers the peers with the lowest estimated round trip
+// time. Each selected peer is picked at random with the exploration probability,
+// so the estimates of the other peers are refreshed too.
+type LatencyAwareSelector struct {
+	estimate    func(Peer) time.Duration
+	exploration float64
+}
+
+// NewLatencyAwareSelector creates a LatencyAwareSelector.
+func NewLatencyAwareSelector(estimate func(Peer) time.Duration, exploration float64) *LatencyAwareSelector {
+	return &LatencyAwareSelector{
+		estimate:    estimate,
+		exploration: exploration,
+	}
+}
+
+// Select returns n peers, preferring the nearest ones.
+func (s *LatencyAwareSelector) Select(peers []Peer, n int) []Peer {
+	n = selectLen(peers, n)
+
+	// shuffle first, so peers with equal estimates are picked randomly
+	candidates := NewRandomSelector().Select(peers, len(peers))
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return s.estimate(candidates[i]) < s.estimate(candidates[j])
+	})
+
+	selected := make([]Peer, 0, n)
+
+	for len(selected) < n {
+		i := 0
+		if rand.Float64() < s.exploration {
+			i = rand.Intn(len(candidates))
+		}
+
+		selected = append(selected, candidates[i])
+		candidates = append(candidates[:i], candidates[i+1:]...)
+	}
+
+	return selected
+}
+
+// ZoneAwareSelector prefers peers from the local zone. In each round, every
+// selected peer is picked from other zones with the given probability, and
+// at least one peer from other zones is selected every crossZoneRounds rounds,
+// so the zones never drift apart.
+type ZoneAwareSelector struct {
+	zone                 func(Peer) string
+	localZone            string
+	crossZoneProbability float64
+	crossZoneRounds      int
+
+	roundsWithoutCrossZone int
+	mux                    sync.Mutex
+}
+
+// NewZoneAwareSelector creates a ZoneAwareSelector.
+// Without a zone func, all peers are in the local zone.
+func NewZoneAwareSelector(zone func(Peer) string, localZone string,
+	crossZoneProbability float64, crossZoneRounds int) *ZoneAwareSelector {
+	if zone == nil {
+		zone = func(Peer) string { return localZone }
+	}
+
+	return &ZoneAwareSelector{
+		zone:                 zone,
+		localZone:            localZone,
+		crossZoneProbability: crossZoneProbability,
+		crossZoneRounds:      crossZoneRounds,
+	}
+}
+
+// Select returns n peers, preferring the ones from local zone.
+func (s *ZoneAwareSelector) Select(peers []Peer, n int) []Peer {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	n = selectLen(peers, n)
+
+	local := []Peer{}
+	remote := []Peer{}
+
+	for _, p := range NewRandomSelector().Select(peers, len(peers)) {
+		if s.zone(p) == s.localZone {
+			local = append(local, p)
+		} else {
+			remote = append(remote, p)
+		}
+	}
+
+	selected := make([]Peer, 0, n)
+	crossZone := false
+
+	// force a cross zone peer if the zones were isolated for too long
+	if len(remote) > 0 && s.crossZoneRounds > 0 && s.roundsWithoutCrossZone+1 >= s.crossZoneRounds && n > 0 {
+		selected = append(selected, remote[0])
+		remote = remote[1:]
+		crossZone = true
+	}
+
+	for len(selected) < n {
+		pickRemote := len(local) == 0 || (len(remote) > 0 && rand.Float64() < s.crossZoneProbability)
+
+		if pickRemote {
+			selected = append(selected, remote[0])
+			remote = remote[1:]
+			crossZone = true
+		} else {
+			selected = append(selected, local[0])
+			local = local[1:]
+		}
+	}
+
+	if crossZone {
+		s.roundsWithoutCrossZone = 0
+	} else {
+		s.roundsWithoutCrossZone++
+	}
+
+	return selected
+}
+
+// selectLen returns the number of peers that can be selected from given peers.
+func selectLen(peers []Peer, n int) int {
+	if n > len(peers) {
+		return len(peers)
+	}
+
+	if n < 0 {
+		return 0
+	}
+
+	return n
+}
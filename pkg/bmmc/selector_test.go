@@ -0,0 +1,112 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+func newDummyPeers(ports ...string) []Peer {
+	peers := make([]Peer, len(ports))
+	for i, port := range ports {
+		peers[i] = Peer{Addr: "localhost", Port: port}
+	}
+
+	return peers
+}
+
+var _ = Describe("Peer selectors", func() {
+	var peers []Peer
+
+	BeforeEach(func() {
+		peers = newDummyPeers("10000", "20000", "30000", "40000")
+	})
+
+	DescribeTable("select distinct peers from given peers",
+		func(s PeerSelector) {
+			for n := 0; n <= len(peers)+1; n++ {
+				selected := s.Select(peers, n)
+
+				Expect(len(selected)).To(Equal(selectLen(peers, n)))
+				Expect(peers).To(ContainElements(selected))
+
+				seen := map[Peer]bool{}
+				for _, p := range selected {
+					Expect(seen[p]).To(BeFalse())
+					seen[p] = true
+				}
+			}
+		},
+		Entry("random selector", NewRandomSelector()),
+		Entry("round robin selector", NewRoundRobinSelector()),
+		Entry("least recently gossiped selector", NewLeastRecentlyGossipedSelector()),
+		Entry("weighted selector", NewWeightedSelector(func(Peer) float64 { return 1 })),
+		Entry("weighted selector without weight func", NewWeightedSelector(nil)),
+		Entry("zone aware selector", NewZoneAwareSelector(func(Peer) string { return "a" }, "a", 0.1, 2)),
+		Entry("zone aware selector without zone func", NewZoneAwareSelector(nil, "a", 0.1, 2)),
+		Entry("latency aware selector", NewLatencyAwareSelector(func(Peer) time.Duration { return 0 }, 0.5)),
+	)
+
+	It("round robin selector continues from the last selected peer", func() {
+		s := NewRoundRobinSelector()
+		Expect(s.Select(peers, 3)).To(Equal(peers[:3]))
+		Expect(s.Select(peers, 3)).To(Equal([]Peer{peers[3], peers[0], peers[1]}))
+	})
+
+	It("least recently gossiped selector prefers peers which were not selected", func() {
+		s := NewLeastRecentlyGossipedSelector()
+		first := s.Select(peers, 2)
+		second := s.Select(peers, 2)
+		Expect(append(first, second...)).To(ConsistOf(peers))
+	})
+
+	It("weighted selector never selects peers without weight", func() {
+		s := NewWeightedSelector(func(p Peer) float64 {
+			if p.Port == "10000" {
+				return 0
+			}
+
+			return 1
+		})
+		Expect(s.Select(peers, len(peers))).To(ConsistOf(peers[1:]))
+	})
+
+	It("zone aware selector periodically selects a peer from other zones", func() {
+		zones := map[string]string{"10000": "a", "20000": "a", "30000": "b", "40000": "b"}
+		s := NewZoneAwareSelector(func(p Peer) string { return zones[p.Port] }, "a", 0, 3)
+
+		Expect(s.Select(peers, 1)).To(ConsistOf(BeElementOf(peers[:2])))
+		Expect(s.Select(peers, 1)).To(ConsistOf(BeElementOf(peers[:2])))
+		Expect(s.Select(peers, 1)).To(ConsistOf(BeElementOf(peers[2:])))
+	})
+
+	It("latency aware selector prefers the nearest peers without exploration", func() {
+		rtts := map[Peer]time.Duration{
+			peers[0]: time.Millisecond * 40,
+			peers[1]: time.Millisecond * 10,
+			peers[2]: time.Millisecond * 30,
+			peers[3]: time.Millisecond * 20,
+		}
+
+		s := NewLatencyAwareSelector(func(p Peer) time.Duration { return rtts[p] }, 0)
+		Expect(s.Select(peers, 2)).To(Equal([]Peer{peers[1], peers[3]}))
+	})
+})
@@ -18,12 +18,17 @@ package bmmc
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
 )
 
 const (
@@ -31,167 +36,658 @@ const (
 	stopServerLogFmt        = "End of server round from %s"
 	unableStartServerLogFmt = "Unable to start  server: %s"
 	unableStopServerLogFmt  = "Unable to shutdown server properly: %s"
+	serveLogErrFmt          = "Error at serving requests: %s"
+
+	startServerErrFmt  = "error at starting the server: %w"
+	serveErrFmt        = "error at serving requests: %w"
+	peerFailuresErrFmt = "%w: %d consecutive requests to %s failed, the last one with: %s"
 
 	gossipHandlerErrLogFmt          = "Error in gossip handler: %s"
 	solicitationHandlerErrLogFmt    = "Error in solicitation handler: %s"
 	synchronizationHandlerErrLogFmt = "Error in synchronization handler: %s"
+	blobHandlerErrLogFmt            = "Error in blob handler: %s"
+	digestHandlerErrLogFmt          = "Error in digest handler: %s"
+	decodeBodyErrLogFmt             = "Error at decoding request body: %s"
+
+	unknownRouteFmt     = "unknown route %s"
+	methodNotAllowedFmt = "method %s is not allowed on %s"
 
-	syncBufferLogErrFmt = "BMMC %s:%s error at syncing buffer with message %s in round %d: %s"
-	bufferSyncedLogFmt  = "BMMC %s:%s synced buffer with message %s in round %d"
+	syncBufferLogErrFmt   = "BMMC %s:%s error at syncing buffer with message %s in round %d: %s"
+	rejectedMessageLogFmt = "BMMC %s:%s rejected message %s from %s, which is not authenticated"
+	bufferSyncedLogFmt    = "BMMC %s:%s synced buffer with message %s in round %d"
 
 	gossipRoute          = "/gossip"
 	solicitationRoute    = "/solicitation"
 	synchronizationRoute = "/synchronization"
+	blobRoute            = "/blob"
+	digestRoute          = "/digest"
+	joinRoute            = "/join"
+
+	defaultServerReadTimeout  = time.Second * 10
+	defaultServerWriteTimeout = time.Second * 10
+	defaultServerIdleTimeout  = time.Minute
+	defaultShutdownTimeout    = time.Second * 5
+	defaultServerMaxBodyBytes = 32 << 20
+
+	defaultPeerFailureThreshold = 5
+
+	// inflightPollInterval is the interval at which the in-flight requests are
+	// checked while the server is shut down
+	inflightPollInterval = time.Millisecond * 10
+
+	// errorsBufferSize is the number of runtime errors kept until they are read
+	errorsBufferSize = 16
 )
 
 var (
 	errInvalidHost = errors.New("invalid host")
 )
 
+// addrPort splits given host:port, e.g. a Host header, in address and port.
+// IPv6 addresses must be enclosed in brackets. Hosts without port are invalid,
+// because the nodes are identified by their address and port.
 func addrPort(s string) (string, string, error) {
-	host := strings.Split(s, ":")
-	if len(host) != 2 { // nolint: gomnd
+	addr, port, err := net.SplitHostPort(s)
+	if err != nil || addr == "" || port == "" {
 		return "", "", errInvalidHost
 	}
 
-	addr := host[0]
-	port := host[1]
-
 	return addr, port, nil
 }
 
+// fullHost returns the canonical host:port of given address and port.
 func fullHost(addr, port string) string {
-	return fmt.Sprintf("%s:%s", addr, port)
+	return peer.Host(addr, port)
 }
 
-func (b *BMMC) gossipHandler(_ http.ResponseWriter, r *http.Request) {
-	gossipDigest, tAddr, tPort, tRoundNumber, err := b.receiveGossip(r)
+// peerURL returns the url of given route on given node.
+func peerURL(addr, port, route string) string {
+	return "http://" + fullHost(addr, port) + route
+}
+
+func (b *BMMC) gossipHandler(w http.ResponseWriter, r *http.Request) {
+	gossipMsg, err := b.receiveGossip(r)
 	if err != nil {
-		b.config.Logger.Printf("%s", err)
+		b.logf(ServerComponent, WarnLevel, "%s", err)
+		http.Error(w, err.Error(), bodyErrStatus(err))
+
 		return
 	}
 
-	digest := b.messageBuffer.Digest()
-	missingDigest := buffer.MissingStrings(gossipDigest, digest)
+	tAddr, tPort := gossipMsg.Addr, gossipMsg.Port
+	if b.rejectSpoofedAddr(w, r, tAddr, tPort) {
+		return
+	}
 
-	hostAddr, hostPort, err := addrPort(r.Host)
-	if err != nil {
-		b.config.Logger.Printf(gossipHandlerErrLogFmt, err)
+	if b.bans.isBanned(tAddr, tPort) {
+		b.logf(ServerComponent, WarnLevel, bannedPeerLogErrFmt, tAddr, tPort)
+		return
+	}
+
+	b.touchPeer(tAddr, tPort)
+	b.identifyPeer(gossipMsg.NodeID, tAddr, tPort)
+	b.retransmissions.ack(tAddr, tPort, gossipMsg.Digest)
+	b.acks.ack(tAddr, tPort, gossipMsg.Digest)
+	b.peerRoles.set(tAddr, tPort, gossipMsg.Roles)
+	b.peerTopics.set(tAddr, tPort, gossipMsg.Topics)
+	b.peerProtocols.set(tAddr, tPort, gossipMsg.Version, gossipMsg.Capabilities)
+	b.mergePeers(tAddr, tPort, gossipMsg.Peers)
+	b.coordinates.set(tAddr, tPort, gossipMsg.Coordinate)
+
+	if gossipMsg.PushPull {
+		b.replyGossip(w, r, gossipMsg)
+		return
+	}
+
+	// only storage nodes answer solicitations
+	if !gossipMsg.Roles.Has(StorageRole) {
+		return
+	}
+
+	if gossipMsg.Bloom != nil {
+		if err := b.solicitWithBloom(b.traceContext(r), gossipMsg); err != nil {
+			b.logf(ServerComponent, WarnLevel, gossipHandlerErrLogFmt, err)
+		}
+
+		return
+	}
+
+	missingDigest := b.missingFrom(gossipMsg.Digest)
+
+	// nodes which are far behind pull the missing messages in bulk
+	if len(missingDigest) > b.config.FullSyncThreshold && b.pullInBackground(tAddr, tPort, missingDigest) {
 		return
 	}
 
 	if len(missingDigest) > 0 {
 		solicitationMsg := HTTPSolicitation{
-			Addr:        hostAddr,
-			Port:        hostPort,
-			RoundNumber: tRoundNumber,
+			Envelope:    b.envelope(),
+			Addr:        b.config.Addr,
+			Port:        b.config.Port,
+			RoundNumber: gossipMsg.RoundNumber,
 			Digest:      missingDigest,
 		}
 
-		if err = b.sendSolicitation(solicitationMsg, tAddr, tPort); err != nil {
-			b.config.Logger.Printf(gossipHandlerErrLogFmt, err)
+		if err := b.sendSolicitation(b.traceContext(r), solicitationMsg, tAddr, tPort); err != nil {
+			b.logf(ServerComponent, WarnLevel, gossipHandlerErrLogFmt, err)
 			return
 		}
 	}
 }
 
-func (b *BMMC) solicitationHandler(_ http.ResponseWriter, r *http.Request) {
-	missingDigest, tAddr, tPort, _, err := b.receiveSolicitation(r)
+func (b *BMMC) solicitationHandler(w http.ResponseWriter, r *http.Request) {
+	if !b.config.Roles.Has(StorageRole) {
+		return
+	}
+
+	solicitation, err := b.receiveSolicitation(r)
 	if err != nil {
-		b.config.Logger.Printf(solicitationHandlerErrLogFmt, err)
+		b.logf(ServerComponent, WarnLevel, solicitationHandlerErrLogFmt, err)
+		http.Error(w, err.Error(), bodyErrStatus(err))
+
 		return
 	}
 
-	missingElements := b.messageBuffer.ElementsFromIDs(missingDigest)
+	tAddr, tPort := solicitation.Addr, solicitation.Port
+	if b.rejectSpoofedAddr(w, r, tAddr, tPort) {
+		return
+	}
 
-	hostAddr, hostPort, err := addrPort(r.Host)
-	if err != nil {
-		b.config.Logger.Printf(solicitationHandlerErrLogFmt, err)
+	if b.bans.isBanned(tAddr, tPort) {
+		b.logf(ServerComponent, WarnLevel, bannedPeerLogErrFmt, tAddr, tPort)
 		return
 	}
 
+	b.touchPeer(tAddr, tPort)
+	b.identifyPeer(solicitation.NodeID, tAddr, tPort)
+
+	missingDigest := solicitation.Digest
+	if solicitation.Bloom != nil {
+		missingDigest = solicitation.Bloom.missingFrom(b.gossipDigest(tAddr, tPort))
+	}
+
+	missingElements := b.messageBuffer.ElementsFromIDs(missingDigest)
+
+	elements, continuation := limitSynchronization(b.referenceBlobs(missingElements), b.config.MaxSyncMessages, b.config.MaxSyncBytes)
+
 	synchronizationMsg := HTTPSynchronization{
-		Addr:     hostAddr,
-		Port:     hostPort,
-		Elements: missingElements,
+		Envelope:     b.envelope(),
+		Addr:         b.config.Addr,
+		Port:         b.config.Port,
+		Elements:     elements,
+		Continuation: continuation,
 	}
 
-	if err = b.sendSynchronization(synchronizationMsg, tAddr, tPort); err != nil {
-		b.config.Logger.Printf(solicitationHandlerErrLogFmt, err)
+	if err = b.sendSynchronization(b.traceContext(r), synchronizationMsg, tAddr, tPort); err != nil {
+		b.logf(ServerComponent, WarnLevel, solicitationHandlerErrLogFmt, err)
 		return
 	}
 }
 
-func (b *BMMC) synchronizationHandler(_ http.ResponseWriter, r *http.Request) {
-	hostAddr, hostPort, err := addrPort(r.Host)
-	if err != nil {
-		b.config.Logger.Printf(synchronizationHandlerErrLogFmt, err)
+func (b *BMMC) synchronizationHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() { b.syncLatencies.observe(time.Since(start)) }()
+
+	release, ok := b.acquireCallbackSlot(w, r)
+	if !ok {
 		return
 	}
+	defer release()
+
+	hostAddr, hostPort := b.config.Addr, b.config.Port
+
+	syncElement := func(m buffer.Element) {
+		b.syncElement(m, hostAddr, hostPort)
+	}
+
+	knownDigest := b.messageBuffer.Digest()
+
+	// messages sent out of band are fetched after the synchronization is received
+	blobs := []buffer.Element{}
+
+	banned := false
+
+	// the address reported by the sender is verified before its messages are
+	// synced, for each address decoded before them
+	verified, verifiedAddr, spoofErr := false, "", error(nil)
+	verifyAddr := func(addr string) error {
+		if spoofErr == nil && (!verified || addr != verifiedAddr) {
+			verified, verifiedAddr, spoofErr = true, addr, b.verifyReportedAddr(r, addr)
+		}
+
+		return spoofErr
+	}
 
-	rcvElements, _, _, err := b.receiveSynchronization(r)
+	// messages over the synchronization limit are solicited again
+	deferred := []string{}
+	received := 0
+
+	t, err := b.receiveSynchronization(r, func(addr, port string, m buffer.Element) {
+		if banned || b.bans.isBanned(addr, port) {
+			banned = true
+			return
+		}
+
+		if verifyAddr(addr) != nil {
+			return
+		}
+
+		if b.config.MaxSyncMessages > 0 && received >= b.config.MaxSyncMessages {
+			deferred = append(deferred, m.ID)
+			return
+		}
+
+		received++
+
+		if !b.acceptSynced(m) {
+			return
+		}
+
+		if m.Blob != nil {
+			blobs = append(blobs, m)
+			return
+		}
+
+		syncElement(m)
+	})
 	if err != nil {
-		b.config.Logger.Printf(synchronizationHandlerErrLogFmt, err)
+		b.logf(ServerComponent, WarnLevel, synchronizationHandlerErrLogFmt, err)
+		http.Error(w, err.Error(), bodyErrStatus(err))
+
+		return
+	}
+
+	tAddr, tPort := t.Addr, t.Port
+
+	if banned || b.bans.isBanned(tAddr, tPort) {
+		b.logf(ServerComponent, WarnLevel, bannedPeerLogErrFmt, tAddr, tPort)
+		w.WriteHeader(http.StatusForbidden)
+
 		return
 	}
 
-	for _, m := range rcvElements {
-		err = b.messageBuffer.Add(m)
+	if verifyAddr(tAddr) != nil {
+		b.replySpoofedAddr(w, r, tAddr, tPort, spoofErr)
+		return
+	}
+
+	b.touchPeer(tAddr, tPort)
+	b.identifyPeer(t.NodeID, tAddr, tPort)
+
+	for _, ref := range blobs {
+		m, err := b.fetchBlob(ref, tAddr, tPort)
 		if err != nil {
-			b.config.Logger.Printf(syncBufferLogErrFmt, hostAddr, hostPort, m.ID, b.gossipRound.GetNumber(), err)
-		} else {
-			b.config.Logger.Printf(bufferSyncedLogFmt, hostAddr, hostPort, m.ID, b.gossipRound.GetNumber())
-			b.runCallbacks(m, hostAddr, hostPort)
+			b.logf(ServerComponent, WarnLevel, synchronizationHandlerErrLogFmt, err)
+			continue
+		}
+
+		syncElement(m)
+	}
+
+	// bridges forward new messages to all their peers
+	if b.config.Roles.Has(BridgeRole) && len(buffer.MissingStrings(b.messageBuffer.Digest(), knownDigest)) > 0 {
+		b.gossip(b.traceContext(r), messageReceivers(b.knownPeers()))
+	}
+
+	// solicit the remaining messages, which were not sent because of limits
+	b.loss.forget(deferred)
+	b.loss.forget(t.Continuation)
+
+	missingDigest := b.missingFrom(append(deferred, t.Continuation...))
+	if len(missingDigest) > 0 {
+		solicitationMsg := HTTPSolicitation{
+			Envelope:    b.envelope(),
+			Addr:        hostAddr,
+			Port:        hostPort,
+			RoundNumber: b.gossipRound,
+			Digest:      missingDigest,
+		}
+
+		if err = b.sendSolicitation(b.traceContext(r), solicitationMsg, tAddr, tPort); err != nil {
+			b.logf(ServerComponent, WarnLevel, synchronizationHandlerErrLogFmt, err)
+		}
+	}
+}
+
+// acceptSynced returns true if given element, received in a synchronization,
+// is from an allowed publisher and within the quota of its origin.
+func (b *BMMC) acceptSynced(m buffer.Element) bool {
+	if !b.mayPublish(m) {
+		b.logf(GossipComponent, WarnLevel, deniedPublisherLogFmt, b.config.Addr, b.config.Port, m.ID, m.Origin, m.CallbackType)
+		return false
+	}
+
+	if !b.withinQuota(m) {
+		b.logf(GossipComponent, WarnLevel, overQuotaLogFmt, b.config.Addr, b.config.Port, m.ID, m.Origin)
+		return false
+	}
+
+	return true
+}
+
+// syncElement adds an element received from a peer in messages buffer and runs its callbacks.
+// When the last fragment of a fragmented message is received, the reassembled message is added too.
+func (b *BMMC) syncElement(m buffer.Element, hostAddr, hostPort string) {
+	if m.Tombstone != "" {
+		if err := b.applyTombstone(m); err != nil {
+			b.logf(GossipComponent, WarnLevel, syncBufferLogErrFmt, hostAddr, hostPort, m.ID, b.gossipRound.GetNumber(), err)
+			return
+		}
+
+		b.logf(GossipComponent, DebugLevel, tombstoneLogFmt, hostAddr, hostPort, m.Tombstone, b.gossipRound.GetNumber())
+
+		return
+	}
+
+	// removed, recently delivered and expired messages are not synced again
+	if b.tombstones.has(m.ID) || b.seen.has(m.ID) || b.expired(m) {
+		return
+	}
+
+	// the messages of other topics are ignored, and they are not solicited again
+	if !b.subscribed(m) {
+		b.seen.add(m.ID)
+		return
+	}
+
+	if m.IsMessage() {
+		m.Sender = b.verifiedSender(m)
+
+		if !b.authentic(m) {
+			atomic.AddInt64(&b.counters.messagesRejected, 1)
+			b.logf(GossipComponent, WarnLevel, rejectedMessageLogFmt, hostAddr, hostPort, m.ID, m.Origin)
+
+			return
+		}
+	}
+
+	if m.HLC != 0 {
+		b.clock.update(HLCTimestamp(m.HLC))
+	}
+
+	if err := b.addToBuffer(m); err != nil {
+		b.logf(GossipComponent, WarnLevel, syncBufferLogErrFmt, hostAddr, hostPort, m.ID, b.gossipRound.GetNumber(), err)
+		return
+	}
+
+	b.seen.add(m.ID)
+	b.loss.received(m.ID)
+
+	// urgent messages are pushed further as soon as they are received
+	b.flushUrgent([]buffer.Element{m})
+
+	if m.Fragment == nil {
+		atomic.AddInt64(&b.counters.messagesDelivered, 1)
+	}
+
+	for _, el := range b.ordered(m) {
+		b.release(el, hostAddr, hostPort)
+	}
+
+	if m.Fragment == nil {
+		return
+	}
+
+	reassembled, ok, err := b.reassembler.add(m)
+	if err != nil {
+		b.logf(GossipComponent, WarnLevel, syncBufferLogErrFmt, hostAddr, hostPort, m.ID, b.gossipRound.GetNumber(), err)
+		return
+	}
+
+	if ok {
+		b.syncElement(reassembled, hostAddr, hostPort)
+	}
+}
+
+// release delivers given element received from a peer to the subscribers,
+// streams and callbacks.
+func (b *BMMC) release(m buffer.Element, hostAddr, hostPort string) {
+	if m.IsMessage() {
+		b.deliver(b.newMessage(m))
+		b.notifyStreams(b.newMessage(m))
+
+		if b.config.Dashboard {
+			b.recentDeliveries.add(b.newMessage(m))
 		}
 	}
+
+	b.logf(GossipComponent, DebugLevel, bufferSyncedLogFmt, hostAddr, hostPort, m.ID, b.gossipRound.GetNumber())
+	b.runCallbacks(m, hostAddr, hostPort)
 }
 
-func (b *BMMC) gracefullyShutdown() {
-	if err := b.server.Shutdown(context.TODO()); err != nil {
-		b.config.Logger.Printf(unableStopServerLogFmt, err)
+// gracefullyShutdown stops the http server and waits for the in-flight requests,
+// received and sent, until the context is done. The requests which are still
+// running are interrupted.
+func (b *BMMC) gracefullyShutdown(ctx context.Context) error {
+	if b.config.Transport == nil {
+		// Shutdown stops accepting connections, but it also waits for the
+		// connections on which no request was sent yet, so the connections
+		// are closed as soon as the in-flight requests are finished
+		go b.server.Shutdown(ctx) // nolint: errcheck
+
+		defer func() {
+			b.server.Close() // nolint: errcheck
+			<-b.served
+			b.logf(ServerComponent, InfoLevel, stopServerLogFmt, b.server.Addr)
+		}()
+	}
+
+	ticker := time.NewTicker(inflightPollInterval)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&b.inflight) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			b.logf(ServerComponent, ErrorLevel, unableStopServerLogFmt, ctx.Err())
+
+			return ErrForcedShutdown
+		}
 	}
+
+	return nil
 }
 
 func (b *BMMC) newServer() *http.Server {
 	return &http.Server{
-		Addr: fullHost("0.0.0.0", b.config.Port),
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			switch path := r.URL.Path; path {
-			case gossipRoute:
-				b.gossipHandler(w, r)
-			case solicitationRoute:
-				b.solicitationHandler(w, r)
-			case synchronizationRoute:
-				b.synchronizationHandler(w, r)
-			}
-		}),
+		Addr:           fullHost("", b.config.Port),
+		Handler:        b.newHandler(),
+		ReadTimeout:    b.config.ServerReadTimeout,
+		WriteTimeout:   b.config.ServerWriteTimeout,
+		IdleTimeout:    b.config.ServerIdleTimeout,
+		MaxHeaderBytes: b.config.ServerMaxHeaderBytes,
+		// e.g. the failed tls handshakes
+		ErrorLog: b.loggerFor(ServerComponent, ErrorLevel),
 	}
 }
 
-func (b *BMMC) startServer(stop <-chan struct{}) error {
-	errChan := make(chan error)
+// serveProtocol decodes the request and calls the handler of its route.
+func (b *BMMC) serveProtocol(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&b.inflight, 1)
+	defer atomic.AddInt64(&b.inflight, -1)
 
-	go func() {
-		b.config.Logger.Printf(startServerLogFmt, b.server.Addr)
+	r.Body = countReads(r.Body, &b.counters.bytesReceived)
+
+	rt, ok := b.routes[routePath(r.URL.Path)]
+	if !ok {
+		http.Error(w, fmt.Sprintf(unknownRouteFmt, r.URL.Path), http.StatusNotFound)
+		return
+	}
+
+	// the source of datagrams can be spoofed, so only the signed routes are
+	// served over UDP, e.g. not the large dashboard
+	if !rt.signed && fromDatagram(r) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if b.serveCORS(w, r, rt) {
+		return
+	}
 
-		if err := b.server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-			b.config.Logger.Printf(unableStartServerLogFmt, err)
-			errChan <- err
+	if !rt.allows(r.Method) {
+		w.Header().Set("Allow", strings.Join(append([]string{rt.method}, rt.otherMethods...), ", "))
+		http.Error(w, fmt.Sprintf(methodNotAllowedFmt, r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if rt.signed && b.rejectOverLimit(w, r) {
+		return
+	}
+
+	if rt.signed {
+		if err := b.verifySignature(r); err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, errBodyTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+
+			http.Error(w, err.Error(), status)
 
 			return
 		}
+	}
 
-		errChan <- nil
-	}()
+	if rt.signed && !b.verifyToken(r) {
+		http.Error(w, errInvalidToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := decodeBody(w, r, int64(b.config.ServerMaxBodyBytes)); err != nil {
+		b.logf(ServerComponent, WarnLevel, decodeBodyErrLogFmt, err)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+
+		return
+	}
+
+	rt.handler(w, r)
+}
+
+// route is an endpoint of the protocol.
+type route struct {
+	method  string
+	handler http.HandlerFunc
+	// signed routes are called by peers, so their requests are signed with the cluster key
+	signed bool
+	// otherMethods are the methods allowed besides method, e.g. on the admin endpoints
+	otherMethods []string
+}
+
+// allows returns true if given method is allowed on the route.
+func (rt route) allows(method string) bool {
+	if method == rt.method {
+		return true
+	}
+
+	for _, m := range rt.otherMethods {
+		if method == m {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newRoutes returns the endpoints of the protocol, by path.
+func (b *BMMC) newRoutes() map[string]route {
+	return map[string]route{
+		gossipRoute:          {method: http.MethodPost, handler: b.gossipHandler, signed: true},
+		solicitationRoute:    {method: http.MethodPost, handler: b.solicitationHandler, signed: true},
+		synchronizationRoute: {method: http.MethodPost, handler: b.synchronizationHandler, signed: true},
+		syncRoute:            {method: http.MethodPost, handler: b.syncHandler, signed: true},
+		blobRoute:            {method: http.MethodGet, handler: b.blobHandler, signed: true},
+		digestRoute:          {method: http.MethodGet, handler: b.digestHandler, signed: true},
+		joinRoute:            {method: http.MethodPost, handler: b.joinHandler, signed: true},
+		pingRoute:            {method: http.MethodGet, handler: b.pingHandler, signed: true},
+		streamRoute:          {method: http.MethodGet, handler: b.streamHandler},
+		dashboardRoute:       {method: http.MethodGet, handler: b.dashboardHandler},
+		metricsRoute:         {method: http.MethodGet, handler: b.metricsHandler},
+		dashboardStatusRoute: {method: http.MethodGet, handler: b.dashboardStatusHandler},
+		healthRoute:          {method: http.MethodGet, handler: b.healthHandler},
+		readinessRoute:       {method: http.MethodGet, handler: b.readinessHandler},
+		adminPeersRoute: {
+			method:       http.MethodGet,
+			handler:      b.adminHandler(b.adminPeersHandler),
+			otherMethods: []string{http.MethodPost, http.MethodDelete},
+		},
+		adminMessagesRoute: {
+			method:       http.MethodGet,
+			handler:      b.adminHandler(b.adminMessagesHandler),
+			otherMethods: []string{http.MethodPost},
+		},
+		adminConfigRoute: {method: http.MethodGet, handler: b.adminHandler(b.adminConfigHandler)},
+		debugPprofRoute:  {method: http.MethodGet, handler: b.debugHandler(b.pprofHandler)},
+		debugVarsRoute:   {method: http.MethodGet, handler: b.debugHandler(b.varsHandler)},
+	}
+}
+
+func (b *BMMC) startServer(stop <-chan struct{}) error {
+	if b.config.Transport != nil {
+		b.logf(ServerComponent, InfoLevel, startServerLogFmt, fullHost(b.config.Addr, b.config.Port))
+
+		return b.config.Transport.Serve(fullHost(b.config.Addr, b.config.Port), b.server.Handler, stop)
+	}
+
+	b.logf(ServerComponent, InfoLevel, startServerLogFmt, b.server.Addr)
+
+	b.served = make(chan struct{})
+
+	ln, err := net.Listen("tcp", b.server.Addr)
+	if err != nil {
+		b.logf(ServerComponent, ErrorLevel, unableStartServerLogFmt, err)
+		close(b.served)
+
+		return fmt.Errorf(startServerErrFmt, err)
+	}
+
+	if b.tlsConfig != nil {
+		ln = tls.NewListener(ln, b.tlsConfig)
+	}
 
 	go func() {
-		<-stop
-		b.gracefullyShutdown()
-		b.config.Logger.Printf(stopServerLogFmt, b.server.Addr)
-	}()
+		defer close(b.served)
 
-	// TODO return err chan
-	// return <-errChan
+		if err := b.server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			b.logf(ServerComponent, ErrorLevel, serveLogErrFmt, err)
+			b.reportError(fmt.Errorf(serveErrFmt, err))
+		}
+	}()
 
 	return nil
 }
+
+// Errors returns the channel on which the runtime errors of the http server
+// are sent. Errors are dropped when the channel is full. The channel is closed
+// when the protocol is stopped.
+func (b *BMMC) Errors() <-chan error {
+	return b.errs
+}
+
+// reportPeerFailures notifies the observers of each failed request, and
+// reports the peers to which PeerFailureThreshold consecutive requests failed,
+// once for each series of failures, and marks them as unreachable.
+func (b *BMMC) reportPeerFailures(addr, port, route string, failures int, cause error) {
+	b.notifySendError(SendErrorEvent{
+		Peer:                Peer{Addr: addr, Port: port, Roles: b.peerRoles.get(addr, port)},
+		Route:               route,
+		ConsecutiveFailures: failures,
+		Err:                 cause,
+		Time:                time.Now(),
+	})
+
+	if failures != b.config.PeerFailureThreshold {
+		return
+	}
+
+	b.peerUnreachable(addr, port)
+	b.reportError(fmt.Errorf(peerFailuresErrFmt, ErrPeerUnreachable, failures, fullHost(addr, port), cause))
+}
+
+// reportError sends given error on the errors channel, without blocking.
+func (b *BMMC) reportError(err error) {
+	select {
+	case b.errs <- err:
+	default:
+	}
+}
@@ -17,6 +17,15 @@ limitations under the License.
 package bmmc
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
@@ -28,6 +37,8 @@ var _ = Describe("Server", func() {
 	},
 		Entry("returns proper address and port", "127.168.0.100", "8080", "127.168.0.100:8080"),
 		Entry("returns proper localhost address and port", "localhost", "7070", "localhost:7070"),
+		Entry("returns ipv6 address in brackets", "::1", "7070", "[::1]:7070"),
+		Entry("returns canonical ipv6 address", "[0:0::0001]", "7070", "[::1]:7070"),
 	)
 
 	DescribeTable("addrPort helper function", func(host, expectedAddr, expectedPort string) {
@@ -38,6 +49,9 @@ var _ = Describe("Server", func() {
 	},
 		Entry("returns proper address and port", "127.168.0.100:8080", "127.168.0.100", "8080"),
 		Entry("returns proper localhost address and port", "localhost:7070", "localhost", "7070"),
+		Entry("returns proper ipv6 address and port", "[::1]:7070", "::1", "7070"),
+		Entry("returns proper address and port of proxied host header", "node.example.com:443",
+			"node.example.com", "443"),
 	)
 
 	DescribeTable("addrPort helper function", func(host string, expectedErr error) {
@@ -46,5 +60,215 @@ var _ = Describe("Server", func() {
 	},
 		Entry("returns error when full host contains only addr or only port", "127.168.0.100", errInvalidHost),
 		Entry("returns error when full host contains to much elements", "localhost:127.168.0.100:7070", errInvalidHost),
+		Entry("returns error when host name has no port", "node.example.com", errInvalidHost),
+		Entry("returns error when ipv6 address is not in brackets", "::1:7070", errInvalidHost),
+		Entry("returns error when port is empty", "localhost:", errInvalidHost),
 	)
+
+	DescribeTable("routes the requests", func(method, path, encoding, body string, expectedStatus int) {
+		transport := NewMemoryTransport()
+
+		b := startTestNode("1", withTransport(transport))
+		defer b.Stop() // nolint: errcheck
+
+		req, err := http.NewRequest(method, "http://localhost:1"+path, strings.NewReader(body))
+		Expect(err).To(Succeed())
+
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+
+		res, err := transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(expectedStatus))
+
+		if expectedStatus == http.StatusMethodNotAllowed {
+			Expect(res.Header.Get("Allow")).To(Equal(http.MethodPost))
+		}
+
+		if expectedStatus != http.StatusOK {
+			details, err := ioutil.ReadAll(res.Body)
+			Expect(err).To(Succeed())
+			Expect(details).NotTo(BeEmpty())
+		}
+	},
+		Entry("serves the digest", http.MethodGet, digestRoute, "", "", http.StatusOK),
+		Entry("rejects unknown paths", http.MethodPost, "/unknown", "", "{}", http.StatusNotFound),
+		Entry("rejects other methods", http.MethodGet, gossipRoute, "", "", http.StatusMethodNotAllowed),
+		Entry("rejects unknown encodings", http.MethodPost, gossipRoute, "br", "{}", http.StatusUnsupportedMediaType),
+		Entry("rejects invalid gossip messages", http.MethodPost, gossipRoute, "", "not json", http.StatusBadRequest),
+		Entry("rejects invalid solicitation messages", http.MethodPost, solicitationRoute, "", "not json",
+			http.StatusBadRequest),
+	)
+
+	It("rejects the request bodies larger than ServerMaxBodyBytes", func() {
+		transport := NewMemoryTransport()
+
+		b := startTestNode("1", withTransport(transport), func(cfg *Config) {
+			cfg.ServerMaxBodyBytes = 64
+		})
+		defer b.Stop() // nolint: errcheck
+
+		body := `{"addr": "localhost", "port": "2", "padding": "` + strings.Repeat("a", 64) + `"}`
+
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:1"+gossipRoute, strings.NewReader(body))
+		Expect(err).To(Succeed())
+
+		res, err := transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+	})
+
+	It("closes the connections of slow peers", func() {
+		b := startTestNode("", overHTTP, func(cfg *Config) {
+			cfg.ServerReadTimeout = time.Millisecond * 100
+		})
+		defer b.Stop()
+
+		var (
+			conn net.Conn
+			err  error
+		)
+
+		Eventually(func() error {
+			conn, err = net.Dial("tcp", fullHost(b.config.Addr, b.config.Port))
+			return err
+		}, time.Second*5).Should(Succeed())
+
+		defer conn.Close()
+
+		// the request headers are never finished
+		_, err = conn.Write([]byte("POST /gossip HTTP/1.1\r\nHost: localhost\r\n"))
+		Expect(err).To(Succeed())
+
+		Expect(conn.SetReadDeadline(time.Now().Add(time.Second * 5))).To(Succeed())
+
+		_, err = ioutil.ReadAll(conn)
+		Expect(err).To(Succeed())
+	})
+
+	Describe("Stop function", func() {
+		It("reports the errors at starting the server", func() {
+			b := startTestNode("", overHTTP)
+			defer b.Stop() // nolint: errcheck
+
+			other, err := New(&Config{
+				Addr:       "localhost",
+				Port:       b.config.Port,
+				BufferSize: 16,
+				Logger:     log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+			Expect(other.Start()).NotTo(Succeed())
+			Expect(other.Stop()).To(Succeed())
+		})
+
+		It("drops the runtime errors which are not read", func() {
+			b := startTestNode("", overHTTP)
+			defer b.Stop() // nolint: errcheck
+
+			for i := 0; i <= errorsBufferSize; i++ {
+				b.reportError(errInvalidHost)
+			}
+
+			Expect(b.Errors()).To(HaveLen(errorsBufferSize))
+			Expect(<-b.Errors()).To(MatchError(errInvalidHost))
+		})
+
+		It("reports the peers to which requests fail repeatedly", func() {
+			b := startTestNode("", overHTTP, func(cfg *Config) {
+				cfg.PeerFailureThreshold = 2
+			})
+			defer b.Stop() // nolint: errcheck
+
+			// the peer is not listening
+			port, err := freePort()
+			Expect(err).To(Succeed())
+			Expect(b.AddPeer("localhost", port)).To(Succeed())
+
+			var reported error
+			Eventually(b.Errors(), time.Second*5).Should(Receive(&reported))
+			Expect(errors.Is(reported, ErrPeerUnreachable)).To(BeTrue())
+			Expect(reported.Error()).To(ContainSubstring(fullHost("localhost", port)))
+
+			// the failures are reported once until a request succeeds
+			Consistently(b.Errors(), b.config.RoundDuration*10).ShouldNot(Receive())
+		})
+
+		It("reports a clean shutdown", func() {
+			b := startTestNode("", overHTTP)
+			Expect(b.Stop()).To(Succeed())
+			Expect(b.Errors()).To(BeClosed())
+		})
+
+		It("reports a forced shutdown when requests don't finish in time", func() {
+			started := make(chan struct{})
+			release := make(chan struct{})
+
+			defer close(release)
+
+			receiver := startTestNode("", overHTTP, func(cfg *Config) {
+				cfg.ShutdownTimeout = time.Millisecond * 100
+				cfg.Callbacks = map[string]func(interface{}, *log.Logger) error{
+					"blocking-callback": func(interface{}, *log.Logger) error {
+						close(started)
+						<-release
+
+						return nil
+					},
+				}
+			})
+
+			sender := startTestNode("", overHTTP)
+			defer sender.Stop() // nolint: errcheck
+
+			Expect(sender.AddPeer(receiver.config.Addr, receiver.config.Port)).To(Succeed())
+			Expect(sender.AddMessage("blocking message", "blocking-callback")).To(Succeed())
+
+			Eventually(started, time.Second*5).Should(BeClosed())
+			Expect(receiver.Stop()).To(MatchError(ErrForcedShutdown))
+		})
+
+		It("stops until given context is done", func() {
+			b := startTestNode("", overHTTP)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			// an idle node stops even when the context is already done
+			Expect(b.StopContext(ctx)).To(Succeed())
+			Expect(b.State()).To(Equal(StoppedState))
+		})
+
+		It("cancels the requests sent before it was started or after it was stopped", func() {
+			b := newTestNode("1")
+
+			created := b.runContext()
+			Expect(b.Start()).To(Succeed())
+			Expect(created.Err()).To(MatchError(context.Canceled))
+
+			started := b.runContext()
+			Expect(started.Err()).To(Succeed())
+
+			Expect(b.Stop()).To(Succeed())
+			Expect(started.Err()).To(MatchError(context.Canceled))
+		})
+
+		It("stops the gossip rounds when the start context is done", func() {
+			b := newTestNode("1")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			Expect(b.StartContext(ctx)).To(Succeed())
+			defer b.Stop() // nolint: errcheck
+
+			Eventually(b.gossipRound.GetNumber, time.Second*5).Should(BeNumerically(">", 0))
+
+			cancel()
+			Expect(b.runContext().Err()).To(MatchError(context.Canceled))
+
+			time.Sleep(time.Millisecond * 50)
+			round := b.gossipRound.GetNumber()
+			Consistently(b.gossipRound.GetNumber, time.Millisecond*200).Should(Equal(round))
+		})
+	})
 })
@@ -0,0 +1,247 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+const (
+	defaultSimulationBufferSize = 64
+	simulationPort              = "1"
+
+	newSimulationErrFmt = "error at creating simulation: %w"
+)
+
+var (
+	errInvalidSimulation = errors.New("simulation must have at least 2 nodes, loss between 0 and 1 and a positive number of peers")
+	errUnknownSimNode    = errors.New("unknown simulation node")
+)
+
+// SimulationConfig describes the cluster of a simulation.
+type SimulationConfig struct {
+	// Nodes is the number of nodes in the cluster
+	Nodes int
+	// Peers is the number of random nodes known by each node
+	// Optional (default: all the other nodes)
+	Peers int
+	// Beta is the beta of each node
+	// Optional (default: the default beta)
+	Beta float64
+	// Loss is the probability, between 0 and 1, that a request between nodes is lost
+	Loss float64
+	// BufferSize is the size of the messages buffer of each node
+	// Optional (default: 64)
+	BufferSize int
+	// RoundDuration is the simulated duration of a gossip round
+	// Optional (default: the default round duration)
+	RoundDuration time.Duration
+	// Seed is the seed of the random choices of the simulation
+	// Optional (default: 0)
+	Seed int64
+}
+
+// Simulation is a cluster of nodes which run in process, on a simulated clock
+// and a simulated network. The nodes are not started: they don't listen on
+// sockets and they don't sleep between rounds. Each step runs a gossip round
+// on every node, waits until all the exchanges of the round are handled and
+// then advances the clock with a round duration.
+type Simulation struct {
+	nodes         []*BMMC
+	hosts         map[string]*BMMC
+	roundDuration time.Duration
+	rounds        int64
+	inflight      sync.WaitGroup
+}
+
+// NewSimulation creates a simulation with given config.
+func NewSimulation(cfg SimulationConfig) (*Simulation, error) {
+	if cfg.Nodes < 2 || cfg.Loss < 0 || cfg.Loss > 1 || cfg.Peers < 0 {
+		return nil, fmt.Errorf(newSimulationErrFmt, errInvalidSimulation)
+	}
+
+	if cfg.Peers == 0 || cfg.Peers > cfg.Nodes-1 {
+		cfg.Peers = cfg.Nodes - 1
+	}
+
+	if cfg.BufferSize == 0 {
+		cfg.BufferSize = defaultSimulationBufferSize
+	}
+
+	s := &Simulation{
+		nodes: make([]*BMMC, cfg.Nodes),
+		hosts: make(map[string]*BMMC, cfg.Nodes),
+	}
+
+	r := rand.New(rand.NewSource(cfg.Seed)) // nolint: gosec
+
+	for i := range s.nodes {
+		node, err := New(&Config{
+			Addr:          fmt.Sprintf("node-%d", i),
+			Port:          simulationPort,
+			Beta:          cfg.Beta,
+			RoundDuration: cfg.RoundDuration,
+			BufferSize:    cfg.BufferSize,
+			Logger:        log.New(ioutil.Discard, "", 0),
+		})
+		if err != nil {
+			return nil, fmt.Errorf(newSimulationErrFmt, err)
+		}
+
+		node.spawn = s.spawn
+
+		var transport http.RoundTripper = simTransport{sim: s}
+		if cfg.Loss > 0 {
+			transport = &lossyTransport{
+				next: transport,
+				loss: cfg.Loss,
+				rand: rand.New(rand.NewSource(r.Int63())), // nolint: gosec
+			}
+		}
+
+		if t, ok := node.clientTransport(); ok {
+			t.next = transport
+		}
+
+		s.nodes[i] = node
+		s.hosts[fullHost(node.config.Addr, node.config.Port)] = node
+	}
+
+	s.roundDuration = s.nodes[0].configRoundDuration()
+
+	// the peers are added directly in peers buffers, without add peer messages
+	for i, node := range s.nodes {
+		for _, j := range r.Perm(cfg.Nodes - 1)[:cfg.Peers] {
+			if j >= i {
+				j++
+			}
+
+			p, err := peer.NewPeer(s.nodes[j].config.Addr, s.nodes[j].config.Port)
+			if err != nil {
+				return nil, fmt.Errorf(newSimulationErrFmt, err)
+			}
+
+			if err := node.peerBuffer.AddPeer(p); err != nil {
+				return nil, fmt.Errorf(newSimulationErrFmt, err)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// spawn runs given func in background and keeps track of it until it returns.
+func (s *Simulation) spawn(f func()) {
+	s.inflight.Add(1)
+
+	go func() {
+		defer s.inflight.Done()
+		f()
+	}()
+}
+
+// Nodes returns the nodes of the simulation.
+func (s *Simulation) Nodes() []*BMMC {
+	return s.nodes
+}
+
+// Rounds returns the number of steps run by the simulation.
+func (s *Simulation) Rounds() int64 {
+	return s.rounds
+}
+
+// Elapsed returns the simulated time of the steps run by the simulation.
+func (s *Simulation) Elapsed() time.Duration {
+	return time.Duration(s.rounds) * s.roundDuration
+}
+
+// Step runs a gossip round on every node and waits until all the exchanges
+// of the round are handled.
+func (s *Simulation) Step() {
+	for _, node := range s.nodes {
+		node.runRound()
+	}
+
+	s.inflight.Wait()
+	s.rounds++
+}
+
+// Converged returns true if all nodes have the same messages.
+func (s *Simulation) Converged() bool {
+	digest := s.nodes[0].messageBuffer.Digest()
+
+	for _, node := range s.nodes[1:] {
+		if node.messageBuffer.Length() != len(digest) || !node.hasAll(digest) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RunUntilConverged runs steps until all nodes have the same messages, but at
+// most maxRounds steps. It returns true if the nodes converged.
+func (s *Simulation) RunUntilConverged(maxRounds int) bool {
+	for i := 0; i < maxRounds; i++ {
+		if s.Converged() {
+			return true
+		}
+
+		s.Step()
+	}
+
+	return s.Converged()
+}
+
+// hasAll returns true if the node has all the messages with given IDs.
+func (b *BMMC) hasAll(ids []string) bool {
+	for _, id := range ids {
+		if !b.HasMessage(id) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// simTransport sends the requests to the handlers of the simulation nodes.
+type simTransport struct {
+	sim *Simulation
+}
+
+// RoundTrip serves the request with the handler of its node.
+func (t simTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	node, ok := t.sim.hosts[req.URL.Host]
+	if !ok {
+		if req.Body != nil {
+			req.Body.Close() // nolint: errcheck
+		}
+
+		return nil, errUnknownSimNode
+	}
+
+	return serveInMemory(http.HandlerFunc(node.serveProtocol), req), nil
+}
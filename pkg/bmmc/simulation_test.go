@@ -0,0 +1,75 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Simulation", func() {
+	It("disseminates messages on the simulated clock", func() {
+		sim, err := NewSimulation(SimulationConfig{
+			Nodes:         20,
+			RoundDuration: time.Minute,
+		})
+		Expect(err).To(Succeed())
+		Expect(sim.Nodes()).To(HaveLen(20))
+
+		for _, node := range sim.Nodes() {
+			Expect(node.GetPeers()).To(HaveLen(19))
+		}
+
+		Expect(sim.Nodes()[0].AddMessage("simulated message", NOCALLBACK)).To(Succeed())
+		Expect(sim.Converged()).To(BeFalse())
+
+		start := time.Now()
+
+		Expect(sim.RunUntilConverged(50)).To(BeTrue())
+		Expect(sim.Rounds()).To(BeNumerically(">", 0))
+		Expect(sim.Elapsed()).To(Equal(time.Duration(sim.Rounds()) * time.Minute))
+		Expect(time.Since(start)).To(BeNumerically("<", sim.Elapsed()))
+	})
+
+	It("simulates large clusters with partial knowledge and loss", func() {
+		sim, err := NewSimulation(SimulationConfig{
+			Nodes: 1000,
+			Peers: 10,
+			Beta:  0.3,
+			Loss:  0.1,
+			Seed:  42,
+		})
+		Expect(err).To(Succeed())
+
+		for _, node := range sim.Nodes() {
+			Expect(node.GetPeers()).To(HaveLen(10))
+		}
+
+		Expect(sim.Nodes()[0].AddMessage("simulated message", NOCALLBACK)).To(Succeed())
+		Expect(sim.RunUntilConverged(100)).To(BeTrue())
+	})
+
+	It("returns error for invalid configs", func() {
+		_, err := NewSimulation(SimulationConfig{Nodes: 1})
+		Expect(err).NotTo(Succeed())
+
+		_, err = NewSimulation(SimulationConfig{Nodes: 2, Loss: 2})
+		Expect(err).NotTo(Succeed())
+	})
+})
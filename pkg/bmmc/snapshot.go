@@ -0,0 +1,138 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
+)
+
+const (
+	// snapshotVersion is the version of the snapshot format
+	snapshotVersion = 1
+
+	snapshotErrFmt = "error at taking snapshot: %w"
+	restoreErrFmt  = "error at restoring snapshot: %w"
+	restoreLogFmt  = "BMMC %s:%s restored %d messages and %d peers from snapshot of %s"
+)
+
+var errUnsupportedSnapshotVersion = errors.New("unsupported snapshot version")
+
+// snapshot is the state of a node, as it is written by Snapshot. Unlike the
+// exports of ExportMessages, it contains the buffer elements as they are
+// gossiped (fragments, tombstones, signatures and clocks included), so a
+// restored node serves them to its peers unchanged.
+type snapshot struct {
+	Version  int              `json:"version"`
+	NodeID   string           `json:"node_id"`
+	Taken    time.Time        `json:"taken"`
+	Messages []buffer.Element `json:"messages"`
+	// Peers are optional: only the messages of a snapshot without peers
+	// are restored
+	Peers []persistedPeer `json:"peers,omitempty"`
+}
+
+// Snapshot writes the messages buffer and the peers of the node in w, in a
+// versioned json format, e.g. to back up the node, to migrate it to another
+// host or to seed a new member of the cluster with the existing history.
+func (b *BMMC) Snapshot(w io.Writer) error {
+	s := snapshot{
+		Version:  snapshotVersion,
+		NodeID:   b.config.NodeID,
+		Taken:    time.Now().UTC(),
+		Messages: b.messageBuffer.All(),
+	}
+
+	for _, p := range b.peerBuffer.Peers() {
+		s.Peers = append(s.Peers, persistedPeer{Addr: p.Addr(), Port: p.Port()})
+	}
+
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		return fmt.Errorf(snapshotErrFmt, err)
+	}
+
+	return nil
+}
+
+// Restore adds the messages and the peers from a snapshot written by Snapshot
+// in the buffers of the node. The restored messages were delivered already, so
+// their callbacks don't run; the messages which are already known are skipped.
+func (b *BMMC) Restore(r io.Reader) error {
+	var s snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf(restoreErrFmt, err)
+	}
+
+	if s.Version != snapshotVersion {
+		return fmt.Errorf(restoreErrFmt, errUnsupportedSnapshotVersion)
+	}
+
+	messages := 0
+
+	for _, el := range s.Messages {
+		if b.knownMessage(el.ID) {
+			continue
+		}
+
+		err := b.addToBuffer(el)
+		if errors.Is(err, buffer.ErrStale) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf(restoreErrFmt, err)
+		}
+
+		b.seen.add(el.ID)
+
+		if el.Tombstone != "" {
+			b.tombstones.add(el.Tombstone, b.config.TombstoneTTL, b.config.MaxTombstones)
+		}
+
+		messages++
+	}
+
+	peers := 0
+
+	for _, sp := range s.Peers {
+		// a snapshot of a peer of this node contains this node
+		if fullHost(sp.Addr, sp.Port) == fullHost(b.config.Addr, b.config.Port) || b.isKnownPeer(sp.Addr, sp.Port) {
+			continue
+		}
+
+		p, err := peer.NewPeer(sp.Addr, sp.Port)
+		if err != nil {
+			return fmt.Errorf(restoreErrFmt, err)
+		}
+
+		if err := b.peerBuffer.AddPeer(p); err != nil {
+			return fmt.Errorf(restoreErrFmt, err)
+		}
+
+		peers++
+	}
+
+	b.logf(StoreComponent, InfoLevel, restoreLogFmt, b.config.Addr, b.config.Port, messages, peers, s.NodeID)
+
+	return nil
+}
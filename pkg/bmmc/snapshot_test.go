@@ -0,0 +1,86 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"log"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot", func() {
+	It("restores the messages and the peers of a snapshot", func() {
+		source := newTestNode("1")
+		Expect(source.AddMessage("first-message", NOCALLBACK)).To(Succeed())
+		Expect(source.AddKeyedMessage("a-key", "second-message", NOCALLBACK)).To(Succeed())
+		Expect(source.AddPeer("localhost", "2")).To(Succeed())
+		Expect(source.AddPeer("localhost", "3")).To(Succeed())
+
+		var raw bytes.Buffer
+		Expect(source.Snapshot(&raw)).To(Succeed())
+
+		calls := 0
+		target := newTestNode("2", func(cfg *Config) {
+			cfg.Callbacks = map[string]func(interface{}, *log.Logger) error{
+				NOCALLBACK: func(interface{}, *log.Logger) error {
+					calls++
+					return nil
+				},
+			}
+		})
+		Expect(target.Restore(bytes.NewReader(raw.Bytes()))).To(Succeed())
+
+		Expect(target.messageBuffer.Digest()).To(ConsistOf(source.messageBuffer.Digest()))
+		Expect(target.GetPeers()).To(ConsistOf("localhost/3"))
+		Expect(calls).To(BeZero())
+
+		for _, m := range source.GetMessagesByType(NOCALLBACK) {
+			restored, err := target.GetMessage(m.ID)
+			Expect(err).To(Succeed())
+			Expect(restored.Timestamp.Equal(m.Timestamp)).To(BeTrue())
+
+			// the monotonic clock reading is not written
+			restored.Timestamp = m.Timestamp
+			Expect(restored).To(Equal(m))
+		}
+
+		// the messages already in buffer are skipped
+		Expect(target.Restore(bytes.NewReader(raw.Bytes()))).To(Succeed())
+		Expect(target.BufferLength()).To(Equal(source.BufferLength()))
+	})
+
+	It("restores snapshots without peers", func() {
+		target := newTestNode("1")
+		Expect(target.Restore(strings.NewReader(`{"version": 1, "messages": [` +
+			`{"id": "an-id", "timestamp": "2020-01-01T00:00:00Z", "msg": "a message", "callback_type": "no-callback"}]}`,
+		))).To(Succeed())
+
+		m, err := target.GetMessage("an-id")
+		Expect(err).To(Succeed())
+		Expect(m.Payload).To(Equal("a message"))
+		Expect(target.GetPeers()).To(BeEmpty())
+	})
+
+	It("returns error for unsupported versions", func() {
+		target := newTestNode("1")
+		Expect(target.Restore(strings.NewReader(`{"version": 2, "messages": []}`))).To(
+			MatchError(ContainSubstring(errUnsupportedSnapshotVersion.Error())))
+	})
+})
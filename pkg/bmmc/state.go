@@ -0,0 +1,82 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// State is the lifecycle state of a node.
+type State int32
+
+const (
+	// CreatedState nodes were created, but they were not started yet.
+	CreatedState State = iota
+	// StartingState nodes are starting their http server.
+	StartingState
+	// RunningState nodes serve requests and run gossip rounds.
+	RunningState
+	// StoppingState nodes wait for their in-flight requests to finish.
+	StoppingState
+	// StoppedState nodes were stopped.
+	StoppedState
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case CreatedState:
+		return "created"
+	case StartingState:
+		return "starting"
+	case RunningState:
+		return "running"
+	case StoppingState:
+		return "stopping"
+	case StoppedState:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// State returns the lifecycle state of the node.
+func (b *BMMC) State() State {
+	return State(atomic.LoadInt32(&b.state))
+}
+
+// IsRunning returns true if the node serves requests and runs gossip rounds.
+func (b *BMMC) IsRunning() bool {
+	return b.State() == RunningState
+}
+
+// startTime returns the time when the node was started, or the zero time if
+// it was not started yet.
+func (b *BMMC) startTime() time.Time {
+	started := atomic.LoadInt64(&b.started)
+	if started == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, started)
+}
+
+// setState sets the lifecycle state of the node.
+func (b *BMMC) setState(s State) {
+	atomic.StoreInt32(&b.state, int32(s))
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("State", func() {
+	It("follows the lifecycle of the node", func() {
+		b, err := New(&Config{
+			Addr:       "localhost",
+			Port:       "1",
+			BufferSize: 16,
+			Transport:  NewMemoryTransport(),
+			Logger:     log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+		Expect(b.State()).To(Equal(CreatedState))
+		Expect(b.IsRunning()).To(BeFalse())
+
+		Expect(b.Start()).To(Succeed())
+		Expect(b.State()).To(Equal(RunningState))
+		Expect(b.IsRunning()).To(BeTrue())
+
+		Expect(b.Stop()).To(Succeed())
+		Expect(b.State()).To(Equal(StoppedState))
+		Expect(b.IsRunning()).To(BeFalse())
+	})
+
+	It("returns to created state when the node can't start", func() {
+		transport := NewMemoryTransport()
+		cfg := Config{
+			Addr:       "localhost",
+			Port:       "1",
+			BufferSize: 16,
+			Transport:  transport,
+			Logger:     log.New(ioutil.Discard, "", 0),
+		}
+
+		first, err := New(&cfg)
+		Expect(err).To(Succeed())
+		Expect(first.Start()).To(Succeed())
+
+		defer first.Stop() // nolint: errcheck
+
+		other := cfg
+		second, err := New(&other)
+		Expect(err).To(Succeed())
+		Expect(second.Start()).NotTo(Succeed())
+		Expect(second.State()).To(Equal(CreatedState))
+	})
+
+	It("has a name", func() {
+		Expect(StoppingState.String()).To(Equal("stopping"))
+		Expect(State(42).String()).To(Equal("unknown"))
+	})
+})
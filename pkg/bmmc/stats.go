@@ -0,0 +1,205 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Stats is a snapshot of the protocol counters.
+type Stats struct {
+	// MessagesAdded is the number of messages added with AddMessage
+	MessagesAdded int64
+	// MessagesDelivered is the number of messages received from peers
+	MessagesDelivered int64
+	// BytesSent is the number of bytes sent in requests to peers
+	BytesSent int64
+	// BytesReceived is the number of bytes received in requests from peers
+	// and in responses of peers
+	BytesReceived int64
+	// RequestsLimited is the number of protocol requests answered with 429
+	// Too Many Requests, because of RateLimit or MaxConcurrentCallbacks
+	RequestsLimited int64
+	// ConnectionsOpened is the number of connections opened to peers
+	ConnectionsOpened int64
+	// ConnectionsReused is the number of requests sent to peers on kept alive connections
+	ConnectionsReused int64
+	// Rounds is the number of gossip rounds run
+	Rounds int64
+	// CallbackSuccesses is the number of callbacks run successfully
+	CallbackSuccesses int64
+	// CallbackFailures is the number of callbacks which returned errors, after all retries
+	CallbackFailures int64
+	// CallbackRetries is the number of times failed callbacks were run again
+	CallbackRetries int64
+	// TombstonesCollected is the number of tombstones removed because they
+	// expired or because there were too many tombstones
+	TombstonesCollected int64
+	// MessagesExpired is the number of messages evicted from buffer because
+	// they were older than MessageTTL
+	MessagesExpired int64
+	// MessagesRejected is the number of messages received from peers which
+	// were rejected because they were not authenticated (see MessageKey and
+	// RequireSignedMessages)
+	MessagesRejected int64
+	// Tombstones is the current number of tombstones
+	Tombstones int
+	// Peers is the current number of peers
+	Peers int
+	// Messages is the current number of messages in buffer
+	Messages int
+	// BufferBytes is the approximate size of the messages in buffer, in bytes
+	BufferBytes int
+	// EstimatedLoss is the estimated rate of lost requests and messages,
+	// between 0 and 1
+	EstimatedLoss float64
+	// MissRate is the estimated number of solicitations received per round,
+	// when beta is adapted to the miss rate (see Config.MaxBeta)
+	MissRate float64
+	// Beta is the beta of the next round
+	Beta float64
+	// GossipsSent is the number of gossip messages, with digests, sent to peers
+	GossipsSent int64
+	// GossipsReceived is the number of gossip messages received from peers
+	GossipsReceived int64
+	// SolicitationsSent is the number of solicitations sent to peers
+	SolicitationsSent int64
+	// SolicitationsReceived is the number of solicitations received from peers
+	SolicitationsReceived int64
+	// SynchronizationsSent is the number of synchronizations sent to peers
+	SynchronizationsSent int64
+	// SynchronizationsReceived is the number of synchronizations received from peers
+	SynchronizationsReceived int64
+	// PartitionsHealed is the number of times an unreachable peer became
+	// reachable again and the messages buffers were reconciled with it
+	PartitionsHealed int64
+	// PeersQuarantined is the number of times a peer was put in quarantine
+	// (see QuarantineDuration)
+	PeersQuarantined int64
+	// MulticastsSent is the number of messages sent to the multicast group
+	MulticastsSent int64
+	// MulticastsReceived is the number of messages of peers received from
+	// the multicast group
+	MulticastsReceived int64
+	// RoundDurations is the distribution of the durations of gossip rounds
+	RoundDurations Histogram
+	// SyncLatencies is the distribution of the durations in which the
+	// synchronizations from peers were handled, including their callbacks
+	SyncLatencies Histogram
+}
+
+// counters keeps the protocol counters. All fields are updated atomically.
+type counters struct {
+	messagesAdded     int64
+	messagesDelivered int64
+	bytesSent         int64
+	bytesReceived     int64
+
+	requestsLimited   int64
+	connectionsOpened int64
+	connectionsReused int64
+	rounds            int64
+	callbackSuccesses int64
+	callbackFailures  int64
+	callbackRetries   int64
+
+	tombstonesCollected int64
+	messagesExpired     int64
+	messagesRejected    int64
+
+	gossipsSent              int64
+	gossipsReceived          int64
+	solicitationsSent        int64
+	solicitationsReceived    int64
+	synchronizationsSent     int64
+	synchronizationsReceived int64
+
+	partitionsHealed int64
+	peersQuarantined int64
+
+	multicastsSent     int64
+	multicastsReceived int64
+}
+
+// countingReader counts the bytes read from a reader.
+type countingReader struct {
+	io.ReadCloser
+	count *int64
+}
+
+// Read reads from the underlying reader and counts the read bytes.
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(r.count, int64(n))
+
+	return n, err
+}
+
+// countReads returns a reader which adds the read bytes to count.
+func countReads(r io.ReadCloser, count *int64) io.ReadCloser {
+	if r == nil {
+		return nil
+	}
+
+	return countingReader{ReadCloser: r, count: count}
+}
+
+// Stats returns a snapshot of the protocol counters.
+func (b *BMMC) Stats() Stats {
+	stats := Stats{
+		MessagesAdded:       atomic.LoadInt64(&b.counters.messagesAdded),
+		MessagesDelivered:   atomic.LoadInt64(&b.counters.messagesDelivered),
+		BytesSent:           atomic.LoadInt64(&b.counters.bytesSent),
+		BytesReceived:       atomic.LoadInt64(&b.counters.bytesReceived),
+		RequestsLimited:     atomic.LoadInt64(&b.counters.requestsLimited),
+		ConnectionsOpened:   atomic.LoadInt64(&b.counters.connectionsOpened),
+		ConnectionsReused:   atomic.LoadInt64(&b.counters.connectionsReused),
+		Rounds:              atomic.LoadInt64(&b.counters.rounds),
+		CallbackSuccesses:   atomic.LoadInt64(&b.counters.callbackSuccesses),
+		CallbackFailures:    atomic.LoadInt64(&b.counters.callbackFailures),
+		CallbackRetries:     atomic.LoadInt64(&b.counters.callbackRetries),
+		TombstonesCollected: atomic.LoadInt64(&b.counters.tombstonesCollected),
+		MessagesExpired:     atomic.LoadInt64(&b.counters.messagesExpired),
+		MessagesRejected:    atomic.LoadInt64(&b.counters.messagesRejected),
+		Tombstones:          b.tombstones.len(),
+		Peers:               b.peerBuffer.Length(),
+		Messages:            b.messageBuffer.Length(),
+		BufferBytes:         b.messageBuffer.Bytes(),
+		EstimatedLoss:       b.loss.estimate(),
+		Beta:                b.beta(),
+
+		GossipsSent:              atomic.LoadInt64(&b.counters.gossipsSent),
+		GossipsReceived:          atomic.LoadInt64(&b.counters.gossipsReceived),
+		SolicitationsSent:        atomic.LoadInt64(&b.counters.solicitationsSent),
+		SolicitationsReceived:    atomic.LoadInt64(&b.counters.solicitationsReceived),
+		SynchronizationsSent:     atomic.LoadInt64(&b.counters.synchronizationsSent),
+		SynchronizationsReceived: atomic.LoadInt64(&b.counters.synchronizationsReceived),
+		PartitionsHealed:         atomic.LoadInt64(&b.counters.partitionsHealed),
+		PeersQuarantined:         atomic.LoadInt64(&b.counters.peersQuarantined),
+		MulticastsSent:           atomic.LoadInt64(&b.counters.multicastsSent),
+		MulticastsReceived:       atomic.LoadInt64(&b.counters.multicastsReceived),
+		RoundDurations:           b.roundDurations.snapshot(),
+		SyncLatencies:            b.syncLatencies.snapshot(),
+	}
+
+	if b.miss != nil {
+		_, stats.MissRate = b.miss.estimate()
+	}
+
+	return stats
+}
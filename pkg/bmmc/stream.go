@@ -0,0 +1,221 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	streamRoute = "/stream"
+
+	// streamTypeParam filters the streamed messages by callback type. It can be repeated
+	streamTypeParam = "type"
+	// streamKeyParam filters the streamed messages by key prefix
+	streamKeyParam = "key"
+
+	// streamChanSize is the number of messages buffered for each stream
+	streamChanSize = 64
+
+	streamHandlerErrLogFmt = "Error in stream handler: %s"
+	droppedStreamLogFmt    = "BMMC %s:%s dropped message %s for a stream, because the client is too slow"
+)
+
+// streamFilter selects the messages sent to a stream.
+type streamFilter struct {
+	types     []string
+	keyPrefix string
+	// allowed returns true if the messages with given callback type may be streamed
+	allowed func(cbType string) bool
+}
+
+// match returns true if given message passes the filter.
+func (f streamFilter) match(m Message) bool {
+	if !strings.HasPrefix(m.Key, f.keyPrefix) {
+		return false
+	}
+
+	if f.allowed != nil && !f.allowed(m.CallbackType) {
+		return false
+	}
+
+	if len(f.types) == 0 {
+		return true
+	}
+
+	for _, t := range f.types {
+		if t == m.CallbackType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stream receives the delivered messages which pass its filter.
+type stream struct {
+	filter   streamFilter
+	messages chan Message
+}
+
+// streams keeps the streams of delivered messages.
+type streams struct {
+	streams map[*stream]struct{}
+	mux     sync.Mutex
+}
+
+// newStreams creates an empty streams.
+func newStreams() *streams {
+	return &streams{
+		streams: map[*stream]struct{}{},
+	}
+}
+
+// add adds a stream with given filter.
+func (s *streams) add(filter streamFilter) *stream {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	st := &stream{
+		filter:   filter,
+		messages: make(chan Message, streamChanSize),
+	}
+
+	s.streams[st] = struct{}{}
+
+	return st
+}
+
+// remove removes given stream.
+func (s *streams) remove(st *stream) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.streams, st)
+}
+
+// notify sends given message to the streams which it passes, without blocking.
+// It returns false if a stream was too slow and the message was dropped for it.
+func (s *streams) notify(m Message) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delivered := true
+
+	for st := range s.streams {
+		if !st.filter.match(m) {
+			continue
+		}
+
+		select {
+		case st.messages <- m:
+		default:
+			delivered = false
+		}
+	}
+
+	return delivered
+}
+
+// notifyStreams sends given delivered message to the streams.
+func (b *BMMC) notifyStreams(m Message) {
+	if !b.streams.notify(m) {
+		b.logf(ServerComponent, WarnLevel, droppedStreamLogFmt, b.config.Addr, b.config.Port, m.ID)
+	}
+}
+
+// streamHandler streams the delivered messages to WebSocket clients, as json
+// text frames, until the client disconnects or the protocol is stopped.
+func (b *BMMC) streamHandler(w http.ResponseWriter, r *http.Request) {
+	if !b.config.StreamMessages {
+		http.NotFound(w, r)
+		return
+	}
+
+	identity := b.config.SubscriberIdentity(r)
+
+	filter := streamFilter{
+		types:     r.URL.Query()[streamTypeParam],
+		keyPrefix: r.URL.Query().Get(streamKeyParam),
+		allowed: func(cbType string) bool {
+			return b.maySubscribe(identity, cbType)
+		},
+	}
+
+	for _, t := range filter.types {
+		if !b.maySubscribe(identity, t) {
+			b.logf(ServerComponent, WarnLevel, deniedSubscriberLogFmt, b.config.Addr, b.config.Port, identity, t)
+			http.Error(w, errDeniedSubscription.Error(), http.StatusForbidden)
+
+			return
+		}
+	}
+
+	ws, err := upgradeWebsocket(w, r, func(origin string) bool {
+		return b.allowedOrigin(origin) != ""
+	})
+	if err != nil {
+		b.logf(ServerComponent, ErrorLevel, streamHandlerErrLogFmt, err)
+		return
+	}
+
+	defer ws.close()
+
+	st := b.streams.add(filter)
+	defer b.streams.remove(st)
+
+	// the frames of the client are read until it closes the connection
+	closed := make(chan struct{})
+
+	go func() {
+		defer close(closed)
+
+		for {
+			opcode, payload, err := ws.readFrame()
+			if err != nil || opcode == wsOpClose {
+				return
+			}
+
+			if opcode == wsOpPing {
+				ws.writeFrame(wsOpPong, payload) // nolint: errcheck
+			}
+		}
+	}()
+
+	for {
+		select {
+		case m := <-st.messages:
+			raw, err := json.Marshal(m)
+			if err != nil {
+				b.logf(ServerComponent, ErrorLevel, streamHandlerErrLogFmt, err)
+				continue
+			}
+
+			if err := ws.writeFrame(wsOpText, raw); err != nil {
+				b.logf(ServerComponent, ErrorLevel, streamHandlerErrLogFmt, err)
+				return
+			}
+		case <-closed:
+			return
+		case <-b.stop:
+			return
+		}
+	}
+}
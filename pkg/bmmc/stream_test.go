@@ -0,0 +1,179 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream", func() {
+	DescribeTable("streamFilter match function", func(filter streamFilter, m Message, expected bool) {
+		Expect(filter.match(m)).To(Equal(expected))
+	},
+		Entry("matches all messages without filters", streamFilter{}, Message{CallbackType: "a"}, true),
+		Entry("matches given callback types", streamFilter{types: []string{"a", "b"}}, Message{CallbackType: "b"}, true),
+		Entry("skips other callback types", streamFilter{types: []string{"a"}}, Message{CallbackType: "b"}, false),
+		Entry("matches given key prefix", streamFilter{keyPrefix: "config/"}, Message{Key: "config/a"}, true),
+		Entry("skips other keys", streamFilter{keyPrefix: "config/"}, Message{Key: "other"}, false),
+		Entry("skips the callback types which are not allowed", streamFilter{
+			allowed: func(cbType string) bool { return cbType != "a" },
+		}, Message{CallbackType: "a"}, false),
+	)
+
+	It("reads the frames written by writeFrame", func() {
+		for _, size := range []int{0, 125, 126, 70000} {
+			buf := &bytes.Buffer{}
+			payload := bytes.Repeat([]byte("a"), size)
+
+			Expect(writeFrame(buf, wsOpText, payload)).To(Succeed())
+
+			if size > wsMaxFrameSize {
+				_, _, err := readFrame(buf)
+				Expect(err).To(MatchError(errFrameTooLarge))
+
+				continue
+			}
+
+			opcode, read, err := readFrame(buf)
+			Expect(err).To(Succeed())
+			Expect(opcode).To(Equal(byte(wsOpText)))
+			Expect(read).To(Equal(payload))
+		}
+	})
+
+	It("unmasks the frames of clients", func() {
+		mask := []byte{1, 2, 3, 4}
+		payload := []byte("ping")
+
+		frame := []byte{wsFinBit | wsOpPing, wsMaskBit | byte(len(payload))}
+		frame = append(frame, mask...)
+
+		for i, c := range payload {
+			frame = append(frame, c^mask[i%4])
+		}
+
+		opcode, read, err := readFrame(bytes.NewReader(frame))
+		Expect(err).To(Succeed())
+		Expect(opcode).To(Equal(byte(wsOpPing)))
+		Expect(read).To(Equal(payload))
+	})
+
+	It("computes the accept key of the handshake", func() {
+		// example from RFC 6455
+		Expect(websocketAccept("dGhlIHNhbXBsZSBub25jZQ==")).To(Equal("s3pPLMBiTxaQ9kYGzzhZRbK+xOo="))
+	})
+
+	It("streams the delivered messages to websocket clients", func() {
+		receiver := startTestNode("", overHTTP, func(cfg *Config) {
+			cfg.StreamMessages = true
+		})
+		defer receiver.Stop() // nolint: errcheck
+
+		sender := startTestNode("", overHTTP)
+		defer sender.Stop() // nolint: errcheck
+
+		conn, err := net.Dial("tcp", fullHost("localhost", receiver.config.Port))
+		Expect(err).To(Succeed())
+
+		defer conn.Close()
+
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/stream?type=streamed", nil)
+		Expect(err).To(Succeed())
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", websocketVersion)
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		Expect(req.Write(conn)).To(Succeed())
+
+		r := bufio.NewReader(conn)
+
+		res, err := http.ReadResponse(r, req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+		Expect(res.Header.Get("Sec-WebSocket-Accept")).To(Equal("s3pPLMBiTxaQ9kYGzzhZRbK+xOo="))
+
+		Expect(sender.AddPeer(receiver.config.Addr, receiver.config.Port)).To(Succeed())
+		Expect(sender.AddMessage("filtered message", NOCALLBACK)).To(Succeed())
+		Expect(sender.AddMessage("streamed message", "streamed")).To(Succeed())
+
+		Expect(conn.SetReadDeadline(time.Now().Add(time.Second * 5))).To(Succeed())
+
+		opcode, payload, err := readFrame(r)
+		Expect(err).To(Succeed())
+		Expect(opcode).To(Equal(byte(wsOpText)))
+
+		var m Message
+		Expect(json.Unmarshal(payload, &m)).To(Succeed())
+		Expect(m.Payload).To(Equal("streamed message"))
+		Expect(m.CallbackType).To(Equal("streamed"))
+	})
+
+	It("rejects the requests which are not websocket handshakes", func() {
+		b := startTestNode("1", func(cfg *Config) {
+			cfg.StreamMessages = true
+		})
+		defer b.Stop() // nolint: errcheck
+
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:1/stream", nil)
+		Expect(err).To(Succeed())
+
+		res, err := b.config.Transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("rejects the websocket handshakes from other origins", func() {
+		handshake := func(corsOrigins []string, origin string) int {
+			b := startTestNode("1", func(cfg *Config) {
+				cfg.StreamMessages = true
+				cfg.CORSOrigins = corsOrigins
+			})
+			defer b.Stop() // nolint: errcheck
+
+			req, err := http.NewRequest(http.MethodGet, "http://localhost:1/stream", nil)
+			Expect(err).To(Succeed())
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Sec-WebSocket-Version", websocketVersion)
+			req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			req.Header.Set("Origin", origin)
+
+			res, err := b.config.Transport.RoundTrip(req)
+			Expect(err).To(Succeed())
+
+			return res.StatusCode
+		}
+
+		allowed := []string{"http://dashboard.example.com"}
+
+		Expect(handshake(nil, "http://evil.example.com")).To(Equal(http.StatusForbidden))
+		Expect(handshake(allowed, "http://evil.example.com")).To(Equal(http.StatusForbidden))
+
+		// the memory transport can't hijack the connections of allowed handshakes
+		Expect(handshake(allowed, "http://dashboard.example.com")).To(Equal(http.StatusNotImplemented))
+		Expect(handshake(nil, "http://localhost:1")).To(Equal(http.StatusNotImplemented))
+	})
+})
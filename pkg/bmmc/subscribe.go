@@ -0,0 +1,198 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/callback"
+)
+
+const (
+	defaultSubscriptionBufferSize = 64
+
+	droppedDeliveryLogFmt = "BMMC %s:%s dropped message %s for a subscriber, because the subscriber is too slow"
+)
+
+// subscription is the channel of a subscriber and the topics it receives.
+type subscription struct {
+	messages chan Message
+	topics   []string
+}
+
+// accepts returns true if given message is sent to the subscriber.
+func (s subscription) accepts(m Message) bool {
+	if len(s.topics) == 0 {
+		return true
+	}
+
+	for _, t := range s.topics {
+		if t == m.CallbackType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subscribers keeps the channels of the subscribers to delivered messages.
+type subscribers struct {
+	subscriptions []subscription
+	size          int
+	policy        BufferFullPolicy
+	closed        bool
+	// done is closed when the subscribers are closed, to unblock the deliveries
+	done chan struct{}
+	mux  sync.Mutex
+}
+
+// newSubscribers creates an empty subscribers, whose channels have given size
+// and follow given policy when they are full.
+func newSubscribers(size int, policy BufferFullPolicy) *subscribers {
+	return &subscribers{
+		size:   size,
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+}
+
+// add adds a subscriber to the messages with given topics, or to all messages
+// if no topic is given.
+func (s *subscribers) add(topics ...string) <-chan Message {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	messages := make(chan Message, s.size)
+
+	if s.closed {
+		close(messages)
+		return messages
+	}
+
+	s.subscriptions = append(s.subscriptions, subscription{
+		messages: messages,
+		topics:   topics,
+	})
+
+	return messages
+}
+
+// notify sends given message to all subscribers, following the policy of
+// full channels. It returns false if the message or an older one was dropped.
+func (s *subscribers) notify(m Message) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delivered := true
+
+	for _, sub := range s.subscriptions {
+		if !sub.accepts(m) {
+			continue
+		}
+
+		ch := sub.messages
+
+		select {
+		case ch <- m:
+			continue
+		default:
+		}
+
+		switch s.policy {
+		case BlockPolicy:
+			select {
+			case ch <- m:
+			case <-s.done:
+				return false
+			}
+		case DropOldestPolicy:
+			delivered = false
+
+			// the subscriber may read the channel meanwhile
+			select {
+			case <-ch:
+			default:
+			}
+
+			select {
+			case ch <- m:
+			default:
+			}
+		default:
+			delivered = false
+		}
+	}
+
+	return delivered
+}
+
+// close closes the channels of all subscribers.
+func (s *subscribers) close() {
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return
+	}
+
+	s.closed = true
+	s.mux.Unlock()
+
+	// unblock the deliveries before waiting for the lock
+	close(s.done)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, sub := range s.subscriptions {
+		close(sub.messages)
+	}
+
+	s.subscriptions = nil
+}
+
+// deliver pushes given message received from a peer to OnDelivery and to the
+// subscribers. The messages of the protocol, e.g. the add peer messages, are
+// not pushed.
+func (b *BMMC) deliver(m Message) {
+	if callback.IsDefaultCallback(m.CallbackType) || m.CallbackType == keyRotationCallbackType {
+		return
+	}
+
+	if b.config.OnDelivery != nil {
+		b.config.OnDelivery(m)
+	}
+
+	b.notifyMessageDelivered(m)
+
+	if !b.subscribers.notify(m) {
+		b.logf(CallbackComponent, WarnLevel, droppedDeliveryLogFmt, b.config.Addr, b.config.Port, m.ID)
+	}
+}
+
+// Subscribe returns a channel with the messages delivered from peers, each
+// message once. The channel holds SubscriptionBufferSize messages and follows
+// SubscriptionFullPolicy when it is full. It is closed when the protocol is
+// stopped.
+func (b *BMMC) Subscribe() <-chan Message {
+	return b.subscribers.add()
+}
+
+// SubscribeTopics returns a channel with the messages delivered from peers
+// whose topic, i.e. callback type, is one of given topics. See Subscribe.
+func (b *BMMC) SubscribeTopics(topics ...string) <-chan Message {
+	return b.subscribers.add(topics...)
+}
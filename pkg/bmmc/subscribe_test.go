@@ -0,0 +1,130 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Subscriptions", func() {
+	It("pushes each delivered message once", func() {
+		transport := NewMemoryTransport()
+
+		var (
+			delivered []string
+			mux       sync.Mutex
+		)
+
+		sender, err := New(&Config{
+			Addr:          "localhost",
+			Port:          "1",
+			BufferSize:    16,
+			RoundDuration: time.Millisecond * 20,
+			Transport:     transport,
+			Logger:        log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+
+		receiver, err := New(&Config{
+			Addr:          "localhost",
+			Port:          "2",
+			BufferSize:    16,
+			RoundDuration: time.Millisecond * 20,
+			Transport:     transport,
+			Logger:        log.New(ioutil.Discard, "", 0),
+			OnDelivery: func(m Message) {
+				mux.Lock()
+				defer mux.Unlock()
+
+				delivered = append(delivered, m.Payload.(string))
+			},
+		})
+		Expect(err).To(Succeed())
+
+		messages := receiver.Subscribe()
+
+		Expect(sender.Start()).To(Succeed())
+		defer sender.Stop() // nolint: errcheck
+
+		Expect(receiver.Start()).To(Succeed())
+
+		Expect(sender.AddPeer("localhost", "2")).To(Succeed())
+		Expect(sender.AddMessage("pushed", NOCALLBACK)).To(Succeed())
+
+		Eventually(messages, time.Second*5).Should(Receive(WithTransform(func(m Message) interface{} {
+			return m.Payload
+		}, Equal("pushed"))))
+		Consistently(messages, time.Millisecond*200).ShouldNot(Receive())
+
+		mux.Lock()
+		Expect(delivered).To(Equal([]string{"pushed"}))
+		mux.Unlock()
+
+		Expect(receiver.Stop()).To(Succeed())
+		Eventually(messages).Should(BeClosed())
+	})
+
+	It("sends to topic subscribers only the messages of their topics", func() {
+		s := newSubscribers(4, RejectPolicy)
+		all := s.add()
+		orders := s.add("orders")
+
+		Expect(s.notify(Message{ID: "1", CallbackType: "orders"})).To(BeTrue())
+		Expect(s.notify(Message{ID: "2", CallbackType: "metrics"})).To(BeTrue())
+
+		Expect(all).To(HaveLen(2))
+		Expect(orders).To(HaveLen(1))
+		Expect((<-orders).ID).To(Equal("1"))
+	})
+
+	It("follows the policy of full channels", func() {
+		dropOldest := newSubscribers(1, DropOldestPolicy)
+		oldest := dropOldest.add()
+
+		Expect(dropOldest.notify(Message{ID: "1"})).To(BeTrue())
+		Expect(dropOldest.notify(Message{ID: "2"})).To(BeFalse())
+		Expect((<-oldest).ID).To(Equal("2"))
+
+		reject := newSubscribers(1, RejectPolicy)
+		newest := reject.add()
+
+		Expect(reject.notify(Message{ID: "1"})).To(BeTrue())
+		Expect(reject.notify(Message{ID: "2"})).To(BeFalse())
+		Expect((<-newest).ID).To(Equal("1"))
+
+		block := newSubscribers(1, BlockPolicy)
+		blocked := block.add()
+
+		Expect(block.notify(Message{ID: "1"})).To(BeTrue())
+
+		done := make(chan bool)
+		go func() { done <- block.notify(Message{ID: "2"}) }()
+
+		Consistently(done, time.Millisecond*50).ShouldNot(Receive())
+		Expect((<-blocked).ID).To(Equal("1"))
+		Eventually(done).Should(Receive(BeTrue()))
+
+		block.close()
+		Eventually(blocked).Should(BeClosed())
+	})
+})
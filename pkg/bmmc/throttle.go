@@ -0,0 +1,133 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits a rate of bytes per second. The bucket holds at most one
+// second of tokens, so short bursts are allowed.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	mux    sync.Mutex
+}
+
+// newTokenBucket creates a full tokenBucket with given rate.
+func newTokenBucket(rate int) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens accumulated since the last refill.
+func (t *tokenBucket) refill() {
+	now := time.Now()
+
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.rate {
+		t.tokens = t.rate
+	}
+
+	t.last = now
+}
+
+// reserve takes n tokens and returns how long the caller must wait before using them.
+func (t *tokenBucket) reserve(n int) time.Duration {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.refill()
+	t.tokens -= float64(n)
+
+	if t.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-t.tokens / t.rate * float64(time.Second))
+}
+
+// take takes n tokens if they are available. Otherwise it takes no token and
+// returns how long the caller must wait until they are available.
+func (t *tokenBucket) take(n int) time.Duration {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.refill()
+
+	if t.tokens >= float64(n) {
+		t.tokens -= float64(n)
+		return 0
+	}
+
+	return time.Duration((float64(n) - t.tokens) / t.rate * float64(time.Second))
+}
+
+// wait blocks until n tokens are available or ctx is done.
+func (t *tokenBucket) wait(ctx context.Context, n int) error {
+	d := t.reserve(n)
+	if d == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttledWriter is a writer which waits for tokens before each write.
+type throttledWriter struct {
+	ctx    context.Context
+	w      io.Writer
+	bucket *tokenBucket
+}
+
+// Write writes p after waiting for len(p) tokens.
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	if err := t.bucket.wait(t.ctx, len(p)); err != nil {
+		return 0, err
+	}
+
+	return t.w.Write(p)
+}
+
+// throttle returns a writer which limits the outbound synchronization traffic
+// written in w, if a limit is configured.
+func (b *BMMC) throttle(ctx context.Context, w io.Writer) io.Writer {
+	if b.syncBucket == nil {
+		return w
+	}
+
+	return &throttledWriter{
+		ctx:    ctx,
+		w:      w,
+		bucket: b.syncBucket,
+	}
+}
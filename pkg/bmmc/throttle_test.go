@@ -0,0 +1,63 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Throttle", func() {
+	It("allows a burst of one second of traffic", func() {
+		bucket := newTokenBucket(1000)
+		Expect(bucket.reserve(1000)).To(Equal(time.Duration(0)))
+	})
+
+	It("limits the traffic to the rate of the bucket", func() {
+		b := &BMMC{syncBucket: newTokenBucket(1000)}
+		buf := &bytes.Buffer{}
+		w := b.throttle(context.Background(), buf)
+
+		start := time.Now()
+
+		for i := 0; i < 3; i++ {
+			_, err := w.Write(make([]byte, 500))
+			Expect(err).To(Succeed())
+		}
+
+		Expect(buf.Len()).To(Equal(1500))
+		Expect(time.Since(start)).To(BeNumerically(">=", time.Millisecond*400))
+	})
+
+	It("stops waiting when the context is done", func() {
+		bucket := newTokenBucket(10)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		Expect(bucket.wait(ctx, 100)).To(MatchError(context.Canceled))
+	})
+
+	It("doesn't limit the traffic without a limit", func() {
+		buf := &bytes.Buffer{}
+		Expect((&BMMC{}).throttle(context.Background(), buf)).To(Equal(buf))
+	})
+})
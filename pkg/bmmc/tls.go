@@ -0,0 +1,111 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+const loadTLSErrFmt = "error at loading tls config: %w"
+
+var errInvalidCA = errors.New("ca file doesn't contain any pem certificate")
+
+// TLSConfig are the certificates with which nodes encrypt their traffic and
+// authenticate each other.
+type TLSConfig struct {
+	// CertFile is the pem certificate of the node, used both as server and
+	// as client certificate
+	CertFile string
+	// KeyFile is the pem private key of the certificate
+	KeyFile string
+	// CAFile is the pem bundle of the CAs which sign the certificates of the
+	// nodes. It verifies the server certificates of peers and, with
+	// RequireClientCert, their client certificates
+	// Optional (default: the system CAs verify the servers)
+	CAFile string
+	// RequireClientCert rejects the requests without a client certificate
+	// signed by CAFile
+	// Optional (default: false)
+	RequireClientCert bool
+}
+
+// load returns the tls configs of the server and of the client of the node.
+func (c *TLSConfig) load() (*tls.Config, *tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf(loadTLSErrFmt, err)
+	}
+
+	server := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	client := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.CAFile != "" {
+		raw, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf(loadTLSErrFmt, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, nil, fmt.Errorf(loadTLSErrFmt, errInvalidCA)
+		}
+
+		server.ClientCAs = pool
+		client.RootCAs = pool
+	}
+
+	if c.RequireClientCert {
+		server.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return server, client, nil
+}
+
+// httpsTransport sends the protocol requests over https.
+type httpsTransport struct {
+	next http.RoundTripper
+}
+
+// newHTTPSTransport creates a httpsTransport which sends the requests with
+// given transport and client tls config.
+func newHTTPSTransport(next *http.Transport, config *tls.Config) *httpsTransport {
+	next.TLSClientConfig = config
+
+	return &httpsTransport{
+		next: next,
+	}
+}
+
+// RoundTrip sends given request over https.
+func (t *httpsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = "https"
+
+	return t.next.RoundTrip(r)
+}
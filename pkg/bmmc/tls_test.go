@@ -0,0 +1,159 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// writePEM writes given pem block in a file with given path.
+func writePEM(path, blockType string, der []byte) {
+	Expect(ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)).To(Succeed())
+}
+
+// newTestCertificates writes a CA and a certificate for 127.0.0.1 signed by it
+// in given dir.
+func newTestCertificates(dir string) *TLSConfig {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(Succeed())
+
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "bmmc test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	Expect(err).To(Succeed())
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(Succeed())
+
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "bmmc test node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	Expect(err).To(Succeed())
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).To(Succeed())
+
+	cfg := &TLSConfig{
+		CertFile: filepath.Join(dir, "node.pem"),
+		KeyFile:  filepath.Join(dir, "node-key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+
+	writePEM(cfg.CAFile, "CERTIFICATE", caDER)
+	writePEM(cfg.CertFile, "CERTIFICATE", leafDER)
+	writePEM(cfg.KeyFile, "EC PRIVATE KEY", keyDER)
+
+	return cfg
+}
+
+var _ = Describe("TLS", func() {
+	var (
+		dir       string
+		tlsConfig *TLSConfig
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		dir, err = ioutil.TempDir("", "bmmc-tls")
+		Expect(err).To(Succeed())
+
+		tlsConfig = newTestCertificates(dir)
+		tlsConfig.RequireClientCert = true
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("disseminates messages between nodes which authenticate each other", func() {
+		nodes := []*BMMC{}
+
+		for i := 0; i < 2; i++ {
+			port, err := freePort()
+			Expect(err).To(Succeed())
+
+			node, err := New(&Config{
+				Addr:          "127.0.0.1",
+				Port:          port,
+				BufferSize:    16,
+				RoundDuration: time.Millisecond * 20,
+				TLSConfig:     tlsConfig,
+				Logger:        log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+			Expect(node.Start()).To(Succeed())
+
+			defer node.Stop() // nolint: errcheck
+
+			nodes = append(nodes, node)
+		}
+
+		Expect(nodes[0].AddPeer("127.0.0.1", nodes[1].config.Port)).To(Succeed())
+		Expect(nodes[0].AddMessage("over tls", NOCALLBACK)).To(Succeed())
+
+		Eventually(nodes[1].GetMessages, time.Second*5).Should(ContainElement("over tls"))
+
+		// clients without a certificate are rejected
+		_, client, err := (&TLSConfig{CertFile: tlsConfig.CertFile, KeyFile: tlsConfig.KeyFile, CAFile: tlsConfig.CAFile}).load()
+		Expect(err).To(Succeed())
+
+		client.Certificates = nil
+
+		_, err = (&http.Client{Transport: newHTTPSTransport(&http.Transport{}, client)}).Get(digestHTTPPath("127.0.0.1", nodes[1].config.Port))
+		Expect(err).NotTo(Succeed())
+	})
+
+	It("returns error for invalid certificates", func() {
+		Expect(ioutil.WriteFile(tlsConfig.CAFile, []byte("not a certificate"), 0600)).To(Succeed())
+
+		_, _, err := tlsConfig.load()
+		Expect(err).To(MatchError(ContainSubstring(errInvalidCA.Error())))
+	})
+})
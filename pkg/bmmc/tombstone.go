@@ -0,0 +1,198 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	defaultTombstoneTTL = time.Minute
+
+	tombstoneIDFmt = "%s-tombstone"
+
+	removeMessageErrFmt = "error at removing message %s: %w"
+	tombstoneLogFmt     = "BMMC %s:%s removed message %s in round %d"
+)
+
+// tombstones keeps the IDs of removed messages until their tombstones expire,
+// so removed messages are not synced again from peers which still have them.
+type tombstones struct {
+	until map[string]time.Time
+	mux   sync.Mutex
+}
+
+// newTombstones creates an empty tombstones.
+func newTombstones() *tombstones {
+	return &tombstones{
+		until: map[string]time.Time{},
+	}
+}
+
+// add adds a tombstone for the message with given ID. If there are more than
+// max tombstones, the ones which expire first are removed and their message IDs
+// are returned. A max lower or equal to 0 means no limit.
+func (t *tombstones) add(id string, ttl time.Duration, max int) []string {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.until[id] = time.Now().Add(ttl)
+
+	evicted := []string{}
+
+	for max > 0 && len(t.until) > max {
+		oldest := ""
+
+		for tid, until := range t.until {
+			if oldest == "" || until.Before(t.until[oldest]) {
+				oldest = tid
+			}
+		}
+
+		delete(t.until, oldest)
+		evicted = append(evicted, oldest)
+	}
+
+	return evicted
+}
+
+// len returns the number of tombstones.
+func (t *tombstones) len() int {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	return len(t.until)
+}
+
+// has returns true if the message with given ID, or the message of given
+// fragment ID, was removed.
+func (t *tombstones) has(id string) bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if _, ok := t.until[id]; ok {
+		return true
+	}
+
+	_, ok := t.until[fragmentGroup(id)]
+
+	return ok
+}
+
+// expired removes the expired tombstones and returns the IDs of their messages.
+func (t *tombstones) expired() []string {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	now := time.Now()
+	ids := []string{}
+
+	for id, until := range t.until {
+		if now.After(until) {
+			ids = append(ids, id)
+			delete(t.until, id)
+		}
+	}
+
+	return ids
+}
+
+// fragmentGroup returns the ID of the fragmented message, for fragment IDs.
+func fragmentGroup(id string) string {
+	if i := strings.LastIndex(id, fragmentIDSep); i >= 0 {
+		return id[:i]
+	}
+
+	return id
+}
+
+// newTombstone creates the tombstone of the message with given ID.
+func newTombstone(id string) buffer.Element {
+	return buffer.Element{
+		ID:           fmt.Sprintf(tombstoneIDFmt, id),
+		Timestamp:    time.Now(),
+		CallbackType: NOCALLBACK,
+		Tombstone:    id,
+	}
+}
+
+// missingFrom returns the IDs from given digest which are missing from the
+// messages buffer and which were neither removed nor recently delivered.
+func (b *BMMC) missingFrom(digest []string) []string {
+	missing := []string{}
+
+	for _, id := range b.messageBuffer.Missing(digest) {
+		if !b.tombstones.has(id) && !b.seen.has(id) {
+			missing = append(missing, id)
+		}
+	}
+
+	return missing
+}
+
+// applyTombstone removes the message of given tombstone from messages buffer
+// and keeps the tombstone, so it is disseminated to peers.
+func (b *BMMC) applyTombstone(tombstone buffer.Element) error {
+	evicted := b.tombstones.add(tombstone.Tombstone, b.config.TombstoneTTL, b.config.MaxTombstones)
+	b.removeTombstones(evicted)
+
+	if el, ok := b.messageBuffer.Get(tombstone.Tombstone); ok && el.Key != "" {
+		b.notifyKeyEvent(KeyDeleted, b.newMessage(el))
+	}
+
+	b.messageBuffer.Remove(tombstone.Tombstone)
+	b.messageBuffer.RemoveFragments(tombstone.Tombstone)
+
+	return b.addToBuffer(tombstone)
+}
+
+// removeExpiredTombstones removes the expired tombstones from messages buffer.
+func (b *BMMC) removeExpiredTombstones() {
+	b.removeTombstones(b.tombstones.expired())
+}
+
+// removeTombstones removes the tombstones of given message IDs from messages buffer.
+func (b *BMMC) removeTombstones(ids []string) {
+	for _, id := range ids {
+		b.messageBuffer.Remove(fmt.Sprintf(tombstoneIDFmt, id))
+	}
+
+	atomic.AddInt64(&b.counters.tombstonesCollected, int64(len(ids)))
+}
+
+// RemoveMessage removes the message with given ID from messages buffer.
+// A tombstone is disseminated in its place, so peers remove the message too,
+// instead of syncing it back. Tombstones are kept for TombstoneTTL.
+func (b *BMMC) RemoveMessage(id string) error {
+	if !b.HasMessage(id) {
+		return fmt.Errorf(removeMessageErrFmt, id, ErrMessageNotFound)
+	}
+
+	if err := b.applyTombstone(newTombstone(id)); err != nil {
+		return fmt.Errorf(removeMessageErrFmt, id, err)
+	}
+
+	b.logf(GossipComponent, DebugLevel, tombstoneLogFmt, b.config.Addr, b.config.Port, id, b.gossipRound.GetNumber())
+
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tombstones", func() {
+	var t *tombstones
+
+	BeforeEach(func() {
+		t = newTombstones()
+	})
+
+	It("knows removed messages and their fragments", func() {
+		t.add("removed", time.Minute, 0)
+
+		Expect(t.has("removed")).To(BeTrue())
+		Expect(t.has(fmt.Sprintf(fragmentIDFmt, "removed", 3))).To(BeTrue())
+		Expect(t.has("other")).To(BeFalse())
+	})
+
+	It("returns the expired tombstones only once", func() {
+		t.add("expired", -time.Second, 0)
+		t.add("alive", time.Minute, 0)
+
+		Expect(t.expired()).To(ConsistOf("expired"))
+		Expect(t.expired()).To(BeEmpty())
+		Expect(t.has("expired")).To(BeFalse())
+		Expect(t.has("alive")).To(BeTrue())
+	})
+
+	It("evicts the tombstones which expire first when there are too many", func() {
+		Expect(t.add("first", time.Minute, 2)).To(BeEmpty())
+		Expect(t.add("second", time.Minute*2, 2)).To(BeEmpty())
+		Expect(t.add("third", time.Minute*3, 2)).To(Equal([]string{"first"}))
+
+		Expect(t.len()).To(Equal(2))
+		Expect(t.has("first")).To(BeFalse())
+	})
+})
@@ -0,0 +1,94 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"sync"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/callback"
+)
+
+// peerTopics keeps the topics announced by peers in their gossip messages.
+type peerTopics struct {
+	topics map[string][]string
+	mux    sync.Mutex
+}
+
+// newPeerTopics creates a peerTopics.
+func newPeerTopics() *peerTopics {
+	return &peerTopics{
+		topics: map[string][]string{},
+	}
+}
+
+// set sets the topics of given peer.
+func (p *peerTopics) set(addr, port string, topics []string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if len(topics) == 0 {
+		delete(p.topics, fullHost(addr, port))
+		return
+	}
+
+	p.topics[fullHost(addr, port)] = topics
+}
+
+// get returns the topics of given peer, or nil if it receives all topics.
+func (p *peerTopics) get(addr, port string) []string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	return p.topics[fullHost(addr, port)]
+}
+
+// inTopics returns true if given element belongs to given topics. All topics
+// are accepted when no topic is given, and the elements of the protocol, e.g.
+// the add peer messages and the tombstones, belong to all topics.
+func inTopics(topics []string, el buffer.Element) bool {
+	if len(topics) == 0 || el.Tombstone != "" ||
+		callback.IsDefaultCallback(el.CallbackType) || el.CallbackType == keyRotationCallbackType {
+		return true
+	}
+
+	for _, t := range topics {
+		if t == el.CallbackType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subscribed returns true if the node receives the topic of given element.
+func (b *BMMC) subscribed(el buffer.Element) bool {
+	return inTopics(b.config.Topics, el)
+}
+
+// gossipDigest returns the digest gossiped to given peer, with the messages
+// of the topics it announced.
+func (b *BMMC) gossipDigest(addr, port string) []string {
+	topics := b.peerTopics.get(addr, port)
+	if len(topics) == 0 {
+		return b.messageBuffer.GossipDigest(b.config.MaxGossipCount)
+	}
+
+	return b.messageBuffer.GossipDigestFor(b.config.MaxGossipCount, func(el buffer.Element) bool {
+		return inTopics(topics, el)
+	})
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Topics", func() {
+	It("gossips to nodes only the messages of their topics", func() {
+		transport := NewMemoryTransport()
+
+		publisher := startTestNode("1", withTransport(transport))
+		defer publisher.Stop() // nolint: errcheck
+
+		subscriber := startTestNode("2", withTransport(transport), func(cfg *Config) {
+			cfg.Topics = []string{"orders"}
+		})
+		defer subscriber.Stop() // nolint: errcheck
+
+		Expect(publisher.AddPeer("localhost", "2")).To(Succeed())
+		Expect(subscriber.AddPeer("localhost", "1")).To(Succeed())
+
+		// the publisher knows the topics of subscriber once it gossiped
+		Eventually(func() []string {
+			return publisher.peerTopics.get("localhost", "2")
+		}, time.Second*5).Should(Equal([]string{"orders"}))
+
+		Expect(publisher.AddMessage("an order", "orders")).To(Succeed())
+		Expect(publisher.AddMessage("a metric", "metrics")).To(Succeed())
+
+		Expect(publisher.gossipDigest("localhost", "2")).To(HaveLen(len(publisher.messageBuffer.Digest()) - 1))
+
+		Eventually(subscriber.GetMessages, time.Second*5).Should(ContainElement("an order"))
+		Consistently(subscriber.GetMessages, time.Millisecond*200).ShouldNot(ContainElement("a metric"))
+	})
+})
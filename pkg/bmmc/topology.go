@@ -0,0 +1,185 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	errInvalidTopology = errors.New("topology must have a neighbours list for each node, with indexes of other nodes")
+	errUnreachablePeer = errors.New("peer is not reachable in topology")
+)
+
+// Topology is an adjacency list of a cluster: node i can send requests only
+// to the nodes in Topology[i]. The edges are directed, so two nodes reach each
+// other only if each of them is in the neighbours list of the other.
+type Topology [][]int
+
+// FullMeshTopology returns a topology in which all n nodes reach each other.
+func FullMeshTopology(n int) Topology {
+	t := make(Topology, n)
+
+	for i := range t {
+		for j := 0; j < n; j++ {
+			if i != j {
+				t[i] = append(t[i], j)
+			}
+		}
+	}
+
+	return t
+}
+
+// RingTopology returns a topology in which each of the n nodes reaches its
+// previous and its next node.
+func RingTopology(n int) Topology {
+	t := make(Topology, n)
+
+	for i := range t {
+		t.connect(i, (i+1)%n)
+	}
+
+	return t
+}
+
+// TreeTopology returns a topology in which the n nodes form a tree with given
+// degree, rooted in the first node. Each node reaches its parent and its children.
+func TreeTopology(n, degree int) Topology {
+	t := make(Topology, n)
+
+	if degree < 1 {
+		return t
+	}
+
+	for i := 1; i < n; i++ {
+		t.connect(i, (i-1)/degree)
+	}
+
+	return t
+}
+
+// ClusteredTopology returns a topology in which the n nodes are split in given
+// number of clusters. The nodes of a cluster reach each other and the first
+// nodes of all clusters form a ring.
+func ClusteredTopology(n, clusters int) Topology {
+	t := make(Topology, n)
+
+	if clusters < 1 {
+		return t
+	}
+
+	heads := []int{}
+
+	for c := 0; c < clusters; c++ {
+		members := []int{}
+		for i := c; i < n; i += clusters {
+			members = append(members, i)
+		}
+
+		for i, m := range members {
+			for _, o := range members[i+1:] {
+				t.connect(m, o)
+			}
+		}
+
+		if len(members) > 0 {
+			heads = append(heads, members[0])
+		}
+	}
+
+	if len(heads) > 1 {
+		for i := range heads {
+			t.connect(heads[i], heads[(i+1)%len(heads)])
+		}
+	}
+
+	return t
+}
+
+// connect adds an edge in both directions between given nodes, once.
+func (t Topology) connect(i, j int) {
+	if i == j {
+		return
+	}
+
+	if !t.reaches(i, j) {
+		t[i] = append(t[i], j)
+	}
+
+	if !t.reaches(j, i) {
+		t[j] = append(t[j], i)
+	}
+}
+
+// reaches returns true if node i can send requests to node j.
+func (t Topology) reaches(i, j int) bool {
+	for _, n := range t[i] {
+		if n == j {
+			return true
+		}
+	}
+
+	return false
+}
+
+// edges returns the number of edges of the topology.
+func (t Topology) edges() int {
+	n := 0
+	for _, neighbours := range t {
+		n += len(neighbours)
+	}
+
+	return n
+}
+
+// validate validates the topology for n nodes.
+func (t Topology) validate(n int) error {
+	if len(t) != n {
+		return errInvalidTopology
+	}
+
+	for i, neighbours := range t {
+		for _, j := range neighbours {
+			if j < 0 || j >= n || j == i {
+				return errInvalidTopology
+			}
+		}
+	}
+
+	return nil
+}
+
+// topologyTransport sends requests only to the reachable hosts.
+type topologyTransport struct {
+	next      http.RoundTripper
+	reachable map[string]bool
+}
+
+// RoundTrip sends the request if its host is reachable.
+func (t *topologyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.reachable[req.URL.Host] {
+		if req.Body != nil {
+			req.Body.Close() // nolint: errcheck
+		}
+
+		return nil, errUnreachablePeer
+	}
+
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// RoundSpan is the name of the span of a gossip round
+	RoundSpan = "bmmc.round"
+	// GossipSpan is the name of the span of a gossip sent to a peer
+	GossipSpan = "bmmc.gossip"
+	// SolicitationSpan is the name of the span of a solicitation sent to a peer
+	SolicitationSpan = "bmmc.solicitation"
+	// SynchronizationSpan is the name of the span of a synchronization sent to a peer
+	SynchronizationSpan = "bmmc.synchronization"
+
+	// nodeAttr, roundAttr, peerAddrAttr and peerPortAttr are the attributes of spans
+	nodeAttr     = "bmmc.node"
+	roundAttr    = "bmmc.round"
+	peerAddrAttr = "bmmc.peer.addr"
+	peerPortAttr = "bmmc.peer.port"
+)
+
+// Tracer creates the spans of gossip rounds and of the exchanges with peers,
+// and propagates the trace context in the headers of the http requests, so
+// the exchanges caused by a round are in its trace on all nodes. It is easily
+// implemented with an OpenTelemetry tracer and propagator.
+type Tracer interface {
+	// Start starts a span with given name and attributes, child of the span in ctx
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+	// Inject adds the trace context of ctx in given headers
+	Inject(ctx context.Context, header http.Header)
+	// Extract returns ctx with the trace context from given headers
+	Extract(ctx context.Context, header http.Header) context.Context
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span, with the error of the traced operation, if any
+	End(err error)
+}
+
+// noopSpan is the span used without Tracer.
+type noopSpan struct{}
+
+func (noopSpan) End(error) {}
+
+// startSpan starts a span with given name and attributes, if the node has a Tracer.
+func (b *BMMC) startSpan(ctx context.Context, name string, attrs map[string]string) (context.Context, Span) {
+	if b.config.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+
+	attrs[nodeAttr] = fullHost(b.config.Addr, b.config.Port)
+
+	return b.config.Tracer.Start(ctx, name, attrs)
+}
+
+// startRoundSpan starts the span of current gossip round.
+func (b *BMMC) startRoundSpan() (context.Context, Span) {
+	return b.startSpan(b.runContext(), RoundSpan, map[string]string{
+		roundAttr: strconv.FormatInt(b.gossipRound.GetNumber(), 10),
+	})
+}
+
+// startPeerSpan starts the span of an exchange with given peer.
+func (b *BMMC) startPeerSpan(ctx context.Context, name, addr, port string) (context.Context, Span) {
+	return b.startSpan(ctx, name, map[string]string{
+		peerAddrAttr: addr,
+		peerPortAttr: port,
+	})
+}
+
+// injectTrace adds the trace context of ctx in the headers of given request.
+func (b *BMMC) injectTrace(ctx context.Context, req *http.Request) {
+	if b.config.Tracer != nil {
+		b.config.Tracer.Inject(ctx, req.Header)
+	}
+}
+
+// traceContext returns the context of the exchanges caused by given request,
+// with the trace context of the peer which sent it.
+func (b *BMMC) traceContext(r *http.Request) context.Context {
+	if b.config.Tracer == nil {
+		return b.runContext()
+	}
+
+	return b.config.Tracer.Extract(b.runContext(), r.Header)
+}
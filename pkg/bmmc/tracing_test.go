@@ -0,0 +1,131 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type spanKey struct{}
+
+type testSpan struct {
+	id     string
+	parent string
+	name   string
+	attrs  map[string]string
+}
+
+func (s *testSpan) End(error) {}
+
+// testTracer keeps the started spans and propagates the span ID in a header.
+type testTracer struct {
+	spans []*testSpan
+	mux   sync.Mutex
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	parent, _ := ctx.Value(spanKey{}).(string)
+	s := &testSpan{id: fmt.Sprintf("span-%d", len(t.spans)), parent: parent, name: name, attrs: attrs}
+	t.spans = append(t.spans, s)
+
+	return context.WithValue(ctx, spanKey{}, s.id), s
+}
+
+func (t *testTracer) Inject(ctx context.Context, header http.Header) {
+	if id, ok := ctx.Value(spanKey{}).(string); ok {
+		header.Set("X-Test-Span", id)
+	}
+}
+
+func (t *testTracer) Extract(ctx context.Context, header http.Header) context.Context {
+	if id := header.Get("X-Test-Span"); id != "" {
+		return context.WithValue(ctx, spanKey{}, id)
+	}
+
+	return ctx
+}
+
+// child returns a span with given name, child of a span with given parent name.
+func (t *testTracer) child(name, parentName string) *testSpan {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	names := map[string]string{}
+	for _, s := range t.spans {
+		names[s.id] = s.name
+	}
+
+	for _, s := range t.spans {
+		if s.name == name && names[s.parent] == parentName {
+			return s
+		}
+	}
+
+	return nil
+}
+
+var _ = Describe("Tracing", func() {
+	It("traces the exchanges caused by a gossip round on all nodes", func() {
+		tracer := &testTracer{}
+		transport := NewMemoryTransport()
+
+		for port, peer := range map[string]string{"1": "2", "2": "1"} {
+			node, err := New(&Config{
+				Addr:          "localhost",
+				Port:          port,
+				BufferSize:    16,
+				RoundDuration: time.Millisecond * 20,
+				Tracer:        tracer,
+				Transport:     transport,
+				Logger:        log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+			Expect(node.AddPeer("localhost", peer)).To(Succeed())
+
+			if port == "1" {
+				Expect(node.AddMessage("traced", NOCALLBACK)).To(Succeed())
+			}
+
+			Expect(node.Start()).To(Succeed())
+
+			defer node.Stop() // nolint: errcheck
+		}
+
+		Eventually(func() *testSpan {
+			return tracer.child(SynchronizationSpan, SolicitationSpan)
+		}, time.Second*5).ShouldNot(BeNil())
+
+		Expect(tracer.child(SolicitationSpan, GossipSpan)).NotTo(BeNil())
+
+		gossip := tracer.child(GossipSpan, RoundSpan)
+		Expect(gossip).NotTo(BeNil())
+		Expect(gossip.attrs).To(HaveKey(peerAddrAttr))
+		Expect(gossip.attrs).To(HaveKey(nodeAttr))
+	})
+})
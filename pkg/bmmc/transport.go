@@ -0,0 +1,370 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// udpMaxDatagramSize is the maximum payload of an UDP datagram over IPv4
+	udpMaxDatagramSize = 65507
+	// udpMaxWorkers is the maximum number of datagrams served at once. The
+	// others wait in the buffer of the socket
+	udpMaxWorkers = 64
+)
+
+var (
+	errHostInUse        = errors.New("host is already served by transport")
+	errUnreachableHost  = errors.New("host is not served by transport")
+	errDatagramTooLarge = errors.New("request doesn't fit in a datagram")
+)
+
+// Transport carries the protocol requests between nodes.
+type Transport interface {
+	// RoundTrip sends a request to a node
+	http.RoundTripper
+	// Serve serves the requests sent to given host with given handler,
+	// until stop is closed. It doesn't block.
+	Serve(host string, handler http.Handler, stop <-chan struct{}) error
+}
+
+// MemoryTransport is a Transport which carries the requests in memory, so
+// the nodes which share it don't listen on sockets.
+type MemoryTransport struct {
+	handlers map[string]http.Handler
+	mux      sync.RWMutex
+}
+
+// NewMemoryTransport creates a MemoryTransport.
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		handlers: map[string]http.Handler{},
+	}
+}
+
+// Serve serves the requests sent to given host until stop is closed.
+func (t *MemoryTransport) Serve(host string, handler http.Handler, stop <-chan struct{}) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if _, ok := t.handlers[host]; ok {
+		return errHostInUse
+	}
+
+	t.handlers[host] = handler
+
+	go func() {
+		<-stop
+
+		t.mux.Lock()
+		delete(t.handlers, host)
+		t.mux.Unlock()
+	}()
+
+	return nil
+}
+
+// RoundTrip serves the request with the handler of its host.
+func (t *MemoryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mux.RLock()
+	handler, ok := t.handlers[req.URL.Host]
+	t.mux.RUnlock()
+
+	if !ok {
+		if req.Body != nil {
+			req.Body.Close() // nolint: errcheck
+		}
+
+		return nil, errUnreachableHost
+	}
+
+	return serveInMemory(handler, req), nil
+}
+
+// serveInMemory serves given request with given handler and returns the response.
+func serveInMemory(handler http.Handler, req *http.Request) *http.Response {
+	r := req.Clone(req.Context())
+	r.Host = req.URL.Host
+
+	w := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	handler.ServeHTTP(w, r)
+
+	if req.Body != nil {
+		req.Body.Close() // nolint: errcheck
+	}
+
+	return &http.Response{
+		Status:     http.StatusText(w.status),
+		StatusCode: w.status,
+		Header:     w.header,
+		Body:       ioutil.NopCloser(&w.body),
+		Request:    req,
+	}
+}
+
+// responseRecorder keeps the response written by a handler.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header returns the header of the response.
+func (w *responseRecorder) Header() http.Header {
+	return w.header
+}
+
+// Write writes given content in the body of the response.
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+// WriteHeader keeps given status.
+func (w *responseRecorder) WriteHeader(status int) {
+	w.status = status
+}
+
+// StreamNetwork is a network which connects its nodes with streams, e.g. a libp2p
+// host, whose peer IDs are used as addresses of the nodes.
+type StreamNetwork interface {
+	// Dial opens a stream to the node with given host.
+	Dial(ctx context.Context, host string) (net.Conn, error)
+	// Listen returns a listener for the streams opened to given host.
+	Listen(host string) (net.Listener, error)
+}
+
+// TCPNetwork is a StreamNetwork which connects its nodes with TCP connections.
+type TCPNetwork struct {
+	dialer net.Dialer
+}
+
+// NewTCPNetwork creates a TCPNetwork.
+func NewTCPNetwork() *TCPNetwork {
+	return &TCPNetwork{}
+}
+
+// Dial opens a TCP connection to given host.
+func (n *TCPNetwork) Dial(ctx context.Context, host string) (net.Conn, error) {
+	return n.dialer.DialContext(ctx, "tcp", host)
+}
+
+// Listen listens on given host for TCP connections.
+func (n *TCPNetwork) Listen(host string) (net.Listener, error) {
+	return net.Listen("tcp", host)
+}
+
+// StreamTransport is a Transport which carries the requests over the streams
+// of a StreamNetwork, so the network handles the addressing of peers, NAT
+// traversal and relays.
+type StreamTransport struct {
+	network StreamNetwork
+	client  *http.Transport
+}
+
+// NewStreamTransport creates a StreamTransport over given network.
+func NewStreamTransport(network StreamNetwork) *StreamTransport {
+	return &StreamTransport{
+		network: network,
+		client: &http.Transport{
+			DialContext: func(ctx context.Context, _, host string) (net.Conn, error) {
+				return network.Dial(ctx, host)
+			},
+		},
+	}
+}
+
+// Serve serves the streams opened to given host until stop is closed.
+func (t *StreamTransport) Serve(host string, handler http.Handler, stop <-chan struct{}) error {
+	ln, err := t.network.Listen(host)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: handler}
+
+	go server.Serve(ln) // nolint: errcheck
+
+	go func() {
+		<-stop
+		server.Close() // nolint: errcheck
+	}()
+
+	return nil
+}
+
+// RoundTrip sends the request over a stream to its host.
+func (t *StreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.client.RoundTrip(req)
+}
+
+// UDPTransport is a Transport which carries each request and its response in
+// a single UDP datagram, without the connection setup of HTTP. Requests and
+// responses larger than a datagram fail, so MaxSyncBytes should be set below
+// udpMaxDatagramSize. Lost datagrams fail the requests, as the protocol
+// already tolerates lost messages. The source addresses of datagrams can be
+// spoofed, so the nodes which use it must have a ClusterKey, and only the
+// protocol requests signed with it are served.
+type UDPTransport struct {
+	timeout time.Duration
+}
+
+// datagramKey is the context key which marks the requests received in datagrams.
+type datagramKey struct{}
+
+// fromDatagram returns true if given request was received in a datagram.
+func fromDatagram(r *http.Request) bool {
+	datagram, _ := r.Context().Value(datagramKey{}).(bool)
+
+	return datagram
+}
+
+// NewUDPTransport creates a UDPTransport whose requests time out after given
+// duration, if their context has no deadline.
+func NewUDPTransport(timeout time.Duration) *UDPTransport {
+	return &UDPTransport{timeout: timeout}
+}
+
+// Serve serves the datagrams sent to given host until stop is closed.
+func (t *UDPTransport) Serve(host string, handler http.Handler, stop <-chan struct{}) error {
+	conn, err := net.ListenPacket("udp", host)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-stop
+		conn.Close() // nolint: errcheck
+	}()
+
+	go func() {
+		buf := make([]byte, udpMaxDatagramSize)
+		workers := make(chan struct{}, udpMaxWorkers)
+
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			datagram := make([]byte, n)
+			copy(datagram, buf[:n])
+
+			workers <- struct{}{}
+
+			go func() {
+				defer func() { <-workers }()
+
+				serveDatagram(conn, addr, datagram, handler)
+			}()
+		}
+	}()
+
+	return nil
+}
+
+// serveDatagram serves the request in given datagram and sends its response to addr.
+func serveDatagram(conn net.PacketConn, addr net.Addr, datagram []byte, handler http.Handler) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(datagram)))
+	if err != nil {
+		return
+	}
+
+	req.RemoteAddr = addr.String()
+	req = req.WithContext(context.WithValue(req.Context(), datagramKey{}, true))
+
+	w := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	handler.ServeHTTP(w, req)
+
+	resp := &http.Response{
+		StatusCode:    w.status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header,
+		Body:          ioutil.NopCloser(&w.body),
+		ContentLength: int64(w.body.Len()),
+	}
+
+	var out bytes.Buffer
+	if err := resp.Write(&out); err != nil || out.Len() > udpMaxDatagramSize {
+		return
+	}
+
+	conn.WriteTo(out.Bytes(), addr) // nolint: errcheck
+}
+
+// RoundTrip sends the request in a datagram to its host and waits for the
+// datagram of its response.
+func (t *UDPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var out bytes.Buffer
+
+	err := req.Write(&out)
+
+	if req.Body != nil {
+		req.Body.Close() // nolint: errcheck
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if out.Len() > udpMaxDatagramSize {
+		return nil, errDatagramTooLarge
+	}
+
+	ctx := req.Context()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "udp", req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() // nolint: errcheck
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write(out.Bytes()); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, udpMaxDatagramSize)
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), req)
+}
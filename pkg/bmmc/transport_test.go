@@ -0,0 +1,278 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var errListenerClosed = errors.New("listener is closed")
+
+// pipeListener is a net.Listener which accepts the pipes opened by pipeNetwork.
+type pipeListener struct {
+	host  string
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.host, Net: "pipe"}
+}
+
+// pipeNetwork is a StreamNetwork which connects its nodes with in memory pipes.
+type pipeNetwork struct {
+	listeners map[string]*pipeListener
+	mux       sync.Mutex
+}
+
+func (n *pipeNetwork) Dial(ctx context.Context, host string) (net.Conn, error) {
+	n.mux.Lock()
+	l, ok := n.listeners[host]
+	n.mux.Unlock()
+
+	if !ok {
+		return nil, errUnreachableHost
+	}
+
+	client, server := net.Pipe()
+
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, errUnreachableHost
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (n *pipeNetwork) Listen(host string) (net.Listener, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	l := &pipeListener{host: host, conns: make(chan net.Conn), done: make(chan struct{})}
+	n.listeners[host] = l
+
+	return l, nil
+}
+
+var _ = Describe("StreamTransport", func() {
+	It("disseminates messages over the streams of a network", func() {
+		t := NewStreamTransport(&pipeNetwork{listeners: map[string]*pipeListener{}})
+		nodes := []*BMMC{}
+
+		for _, port := range []string{"1", "2"} {
+			node, err := New(&Config{
+				Addr:          "node",
+				Port:          port,
+				BufferSize:    16,
+				RoundDuration: time.Millisecond * 20,
+				Transport:     t,
+				Logger:        log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+			Expect(node.Start()).To(Succeed())
+
+			defer node.Stop()
+
+			nodes = append(nodes, node)
+		}
+
+		Expect(nodes[0].AddPeer("node", "2")).To(Succeed())
+		Expect(nodes[0].AddMessage("over streams", NOCALLBACK)).To(Succeed())
+
+		Eventually(nodes[1].GetMessages, time.Second*5).Should(ContainElement("over streams"))
+	})
+})
+
+var _ = Describe("UDPTransport", func() {
+	It("disseminates messages in datagrams", func() {
+		t := NewUDPTransport(time.Second)
+		nodes := []*BMMC{}
+
+		for i := 0; i < 2; i++ {
+			port, err := freePort()
+			Expect(err).To(Succeed())
+
+			node, err := New(&Config{
+				Addr:          "127.0.0.1",
+				Port:          port,
+				BufferSize:    16,
+				RoundDuration: time.Millisecond * 20,
+				Transport:     t,
+				Logger:        log.New(ioutil.Discard, "", 0),
+				ClusterKey:    []byte("secret"),
+			})
+			Expect(err).To(Succeed())
+			Expect(node.Start()).To(Succeed())
+
+			defer node.Stop()
+
+			nodes = append(nodes, node)
+		}
+
+		Expect(nodes[0].AddPeer("127.0.0.1", nodes[1].config.Port)).To(Succeed())
+		Expect(nodes[0].AddMessage("over udp", NOCALLBACK)).To(Succeed())
+
+		Eventually(nodes[1].GetMessages, time.Second*5).Should(ContainElement("over udp"))
+	})
+
+	It("requires a cluster key", func() {
+		_, err := New(&Config{
+			Addr:       "127.0.0.1",
+			Port:       "10000",
+			BufferSize: 16,
+			Transport:  NewUDPTransport(time.Second),
+		})
+		Expect(err).To(MatchError(errUnsignedUDP))
+	})
+
+	It("serves only the signed protocol requests", func() {
+		b := startTestNode("", func(cfg *Config) {
+			port, err := freePort()
+			Expect(err).To(Succeed())
+
+			cfg.Addr = "127.0.0.1"
+			cfg.Port = port
+			cfg.Transport = NewUDPTransport(time.Second)
+			cfg.ClusterKey = []byte("secret")
+		})
+		defer b.Stop() // nolint: errcheck
+
+		host := fullHost(b.config.Addr, b.config.Port)
+
+		// e.g. requests with a spoofed source, which would be answered with the dashboard
+		req, err := http.NewRequest(http.MethodGet, "http://"+host+dashboardRoute, nil)
+		Expect(err).To(Succeed())
+
+		res, err := b.config.Transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+
+		req, err = http.NewRequest(http.MethodGet, "http://"+host+pingRoute, nil)
+		Expect(err).To(Succeed())
+
+		res, err = b.config.Transport.RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("returns error for requests larger than a datagram", func() {
+		req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1:1/", strings.NewReader(strings.Repeat("x", udpMaxDatagramSize)))
+		Expect(err).To(Succeed())
+
+		_, err = NewUDPTransport(time.Second).RoundTrip(req)
+		Expect(err).To(MatchError(errDatagramTooLarge))
+	})
+})
+
+var _ = Describe("MemoryTransport", func() {
+	It("serves the requests with the handler of their host", func() {
+		t := NewMemoryTransport()
+		stop := make(chan struct{})
+
+		Expect(t.Serve("localhost:1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Host).To(Equal("localhost:1"))
+
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).To(Succeed())
+
+			w.WriteHeader(http.StatusAccepted)
+			w.Write(body) // nolint: errcheck
+		}), stop)).To(Succeed())
+
+		Expect(t.Serve("localhost:1", http.NotFoundHandler(), stop)).NotTo(Succeed())
+
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:1/gossip", strings.NewReader("hello"))
+		Expect(err).To(Succeed())
+
+		resp, err := t.RoundTrip(req)
+		Expect(err).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).To(Succeed())
+		Expect(string(body)).To(Equal("hello"))
+
+		close(stop)
+
+		Eventually(func() error {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost:1/gossip", http.NoBody)
+			Expect(err).To(Succeed())
+
+			_, err = t.RoundTrip(req)
+
+			return err
+		}).Should(MatchError(errUnreachableHost))
+	})
+
+	It("disseminates messages between nodes without sockets", func() {
+		t := NewMemoryTransport()
+		nodes := []*BMMC{}
+
+		for _, port := range []string{"1", "2", "3"} {
+			node, err := New(&Config{
+				Addr:          "node",
+				Port:          port,
+				BufferSize:    16,
+				RoundDuration: time.Millisecond * 20,
+				Transport:     t,
+				Logger:        log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+			Expect(node.Start()).To(Succeed())
+
+			defer node.Stop()
+
+			nodes = append(nodes, node)
+		}
+
+		Expect(nodes[0].AddPeer("node", "2")).To(Succeed())
+		Expect(nodes[0].AddPeer("node", "3")).To(Succeed())
+		Expect(nodes[0].AddMessage("in memory", NOCALLBACK)).To(Succeed())
+
+		for _, node := range nodes {
+			Eventually(node.GetMessages, time.Second*5).Should(ContainElement("in memory"))
+		}
+	})
+})
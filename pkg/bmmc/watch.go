@@ -0,0 +1,158 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	// watchChanSize is the number of events buffered for each watcher
+	watchChanSize = 64
+
+	droppedKeyEventLogFmt = "BMMC %s:%s dropped %s event for key %s, because the watcher is too slow"
+)
+
+// KeyEventType is the type of a change of a keyed message.
+type KeyEventType int
+
+const (
+	// KeyCreated is the type of events for new keys.
+	KeyCreated KeyEventType = iota
+	// KeyUpdated is the type of events for new versions of existing keys.
+	KeyUpdated
+	// KeyDeleted is the type of events for removed keys.
+	KeyDeleted
+)
+
+// String returns the name of the event type.
+func (t KeyEventType) String() string {
+	switch t {
+	case KeyCreated:
+		return "create"
+	case KeyUpdated:
+		return "update"
+	case KeyDeleted:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// KeyEvent is a change of a keyed message.
+type KeyEvent struct {
+	Type KeyEventType
+	Key  string
+	// Message is the new version, or the removed version for KeyDeleted events
+	Message Message
+}
+
+// watcher receives the events of keys with a prefix.
+type watcher struct {
+	prefix string
+	events chan KeyEvent
+}
+
+// watchers keeps the watchers of keyed messages.
+type watchers struct {
+	watchers []watcher
+	closed   bool
+	mux      sync.Mutex
+}
+
+// newWatchers creates an empty watchers.
+func newWatchers() *watchers {
+	return &watchers{}
+}
+
+// add adds a watcher for keys with given prefix.
+func (w *watchers) add(prefix string) <-chan KeyEvent {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	events := make(chan KeyEvent, watchChanSize)
+
+	if w.closed {
+		close(events)
+		return events
+	}
+
+	w.watchers = append(w.watchers, watcher{prefix: prefix, events: events})
+
+	return events
+}
+
+// notify sends given event to the watchers of its key, without blocking.
+// It returns false if a watcher was too slow and the event was dropped for it.
+func (w *watchers) notify(e KeyEvent) bool {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	delivered := true
+
+	for _, wt := range w.watchers {
+		if !strings.HasPrefix(e.Key, wt.prefix) {
+			continue
+		}
+
+		select {
+		case wt.events <- e:
+		default:
+			delivered = false
+		}
+	}
+
+	return delivered
+}
+
+// close closes the channels of all watchers.
+func (w *watchers) close() {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	for _, wt := range w.watchers {
+		close(wt.events)
+	}
+
+	w.watchers = nil
+	w.closed = true
+}
+
+// notifyKeyEvent notifies the watchers about a change of a keyed message.
+func (b *BMMC) notifyKeyEvent(t KeyEventType, m Message) {
+	e := KeyEvent{
+		Type:    t,
+		Key:     m.Key,
+		Message: m,
+	}
+
+	if !b.watchers.notify(e) {
+		b.logf(CallbackComponent, WarnLevel, droppedKeyEventLogFmt, b.config.Addr, b.config.Port, t, m.Key)
+	}
+}
+
+// Watch returns a channel with the changes of keyed messages whose keys have
+// given prefix. Events are dropped if the channel is full, so watchers must
+// read them promptly. The channel is closed when the protocol is stopped.
+func (b *BMMC) Watch(keyPrefix string) <-chan KeyEvent {
+	return b.watchers.add(keyPrefix)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Watchers", func() {
+	var w *watchers
+
+	BeforeEach(func() {
+		w = newWatchers()
+	})
+
+	It("notifies only the watchers of the key prefix", func() {
+		config := w.add("config/")
+		all := w.add("")
+
+		Expect(w.notify(KeyEvent{Type: KeyCreated, Key: "config/a"})).To(BeTrue())
+		Expect(w.notify(KeyEvent{Type: KeyCreated, Key: "other"})).To(BeTrue())
+
+		Expect(config).To(Receive(Equal(KeyEvent{Type: KeyCreated, Key: "config/a"})))
+		Expect(config).NotTo(Receive())
+		Expect(all).To(Receive())
+		Expect(all).To(Receive())
+	})
+
+	It("drops events for slow watchers", func() {
+		w.add("")
+
+		for i := 0; i < watchChanSize; i++ {
+			Expect(w.notify(KeyEvent{Key: "key"})).To(BeTrue())
+		}
+
+		Expect(w.notify(KeyEvent{Key: "key"})).To(BeFalse())
+	})
+
+	It("closes the channels", func() {
+		events := w.add("")
+		w.close()
+
+		Eventually(events).Should(BeClosed())
+		Eventually(w.add("")).Should(BeClosed())
+	})
+})
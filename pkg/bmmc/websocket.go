@@ -0,0 +1,259 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bufio"
+	"crypto/sha1" // nolint: gosec
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The minimal server side of the WebSocket protocol (RFC 6455) used to stream
+// messages: the server only sends text frames and answers the control frames.
+const (
+	websocketGUID    = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	websocketVersion = "13"
+
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+
+	wsFinBit  = 0x80
+	wsMaskBit = 0x80
+
+	// wsMaxFrameSize is the maximum size of frames read from clients
+	wsMaxFrameSize = 1 << 16
+
+	upgradeWebsocketErrFmt = "error at upgrading to websocket: %w"
+)
+
+var (
+	errNotWebsocket      = errors.New("not a websocket handshake")
+	errCrossOrigin       = errors.New("websocket handshake from another origin is not allowed")
+	errHijackUnsupported = errors.New("connection can't be hijacked")
+	errFrameTooLarge     = errors.New("websocket frame is too large")
+)
+
+// websocketConn is a server side WebSocket connection.
+type websocketConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	mux  sync.Mutex
+}
+
+// websocketAccept returns the value of Sec-WebSocket-Accept for given key.
+func websocketAccept(key string) string {
+	h := sha1.New()                      // nolint: gosec
+	h.Write([]byte(key + websocketGUID)) // nolint: errcheck
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContains returns true if given header contains given token.
+func headerContains(header http.Header, name, token string) bool {
+	for _, v := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// sameOrigin returns true if given request has no Origin header, e.g. it is
+// not sent by a browser, or if it is sent from the origin of the node.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// upgradeWebsocket answers the handshake of a WebSocket client and takes over
+// its connection. Invalid handshakes are answered with an error status. The
+// handshakes sent by browsers from other origins are rejected, unless
+// allowOrigin allows their origin, since browsers don't apply CORS to them.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request, allowOrigin func(origin string) bool) (*websocketConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != websocketVersion || key == "" {
+		http.Error(w, errNotWebsocket.Error(), http.StatusBadRequest)
+		return nil, fmt.Errorf(upgradeWebsocketErrFmt, errNotWebsocket)
+	}
+
+	if !sameOrigin(r) && !allowOrigin(r.Header.Get("Origin")) {
+		http.Error(w, errCrossOrigin.Error(), http.StatusForbidden)
+		return nil, fmt.Errorf(upgradeWebsocketErrFmt, errCrossOrigin)
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, errHijackUnsupported.Error(), http.StatusNotImplemented)
+		return nil, fmt.Errorf(upgradeWebsocketErrFmt, errHijackUnsupported)
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf(upgradeWebsocketErrFmt, err)
+	}
+
+	// the deadlines of the http server don't apply to streams
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, fmt.Errorf(upgradeWebsocketErrFmt, err)
+	}
+
+	ws := &websocketConn{conn: conn, rw: rw}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n"
+
+	if _, err := rw.WriteString(response); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, fmt.Errorf(upgradeWebsocketErrFmt, err)
+	}
+
+	if err := rw.Flush(); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, fmt.Errorf(upgradeWebsocketErrFmt, err)
+	}
+
+	return ws, nil
+}
+
+// writeFrame writes a frame with given opcode and payload. Server frames are not masked.
+func (ws *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	ws.mux.Lock()
+	defer ws.mux.Unlock()
+
+	if err := writeFrame(ws.rw.Writer, opcode, payload); err != nil {
+		return err
+	}
+
+	return ws.rw.Flush()
+}
+
+// readFrame reads the next frame sent by the client.
+func (ws *websocketConn) readFrame() (byte, []byte, error) {
+	return readFrame(ws.rw.Reader)
+}
+
+// close sends a close frame and closes the connection.
+func (ws *websocketConn) close() {
+	ws.writeFrame(wsOpClose, nil) // nolint: errcheck
+	ws.conn.Close()               // nolint: errcheck
+}
+
+// writeFrame writes an unmasked frame with given opcode and payload in w.
+func writeFrame(w io.Writer, opcode byte, payload []byte) error {
+	header := []byte{wsFinBit | opcode}
+
+	switch n := len(payload); {
+	case n < 126: // nolint: gomnd
+		header = append(header, byte(n))
+	case n <= 0xFFFF: // nolint: gomnd
+		header = append(header, 126, 0, 0) // nolint: gomnd
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0) // nolint: gomnd
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(payload)
+
+	return err
+}
+
+// readFrame reads a frame from r and unmasks its payload.
+func readFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 2) // nolint: gomnd
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	opcode := header[0] & 0x0F // nolint: gomnd
+	masked := header[1]&wsMaskBit != 0
+	size := uint64(header[1] & 0x7F) // nolint: gomnd
+
+	switch size {
+	case 126: // nolint: gomnd
+		ext := make([]byte, 2) // nolint: gomnd
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return 0, nil, err
+		}
+
+		size = uint64(binary.BigEndian.Uint16(ext))
+	case 127: // nolint: gomnd
+		ext := make([]byte, 8) // nolint: gomnd
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return 0, nil, err
+		}
+
+		size = binary.BigEndian.Uint64(ext)
+	}
+
+	if size > wsMaxFrameSize {
+		return 0, nil, errFrameTooLarge
+	}
+
+	mask := make([]byte, 4) // nolint: gomnd
+	if masked {
+		if _, err := io.ReadFull(r, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return opcode, payload, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// contentTypeMsgpack is the content type of the protocol messages encoded with msgpack
+const contentTypeMsgpack = "application/x-msgpack"
+
+// WireFormat is the encoding of the gossip and solicitation messages.
+type WireFormat int
+
+const (
+	// JSONWireFormat encodes the protocol messages in JSON
+	JSONWireFormat WireFormat = iota
+	// MsgpackWireFormat encodes the gossip and solicitation messages with
+	// msgpack, a binary encoding which is smaller and faster for large digests
+	// and which has decoders in most languages. The fields have the same names
+	// as in JSON. It is used only with the peers which negotiated it, JSON is
+	// used otherwise. Synchronizations are always streamed in JSON, since the
+	// payloads of messages can be any value
+	MsgpackWireFormat
+)
+
+// marshalMessage encodes given protocol message for given peer, returning the
+// encoded message and its content type.
+func (b *BMMC) marshalMessage(v interface{}, addr, port string) ([]byte, string, error) {
+	if b.config.WireFormat == MsgpackWireFormat && b.peerProtocols.get(addr, port).has(capCodecMsgpack) {
+		raw, err := marshalMsgpack(v)
+
+		return raw, contentTypeMsgpack, err
+	}
+
+	raw, err := json.Marshal(v)
+
+	return raw, contentTypeJSON, err
+}
+
+// decodeWireMessage decodes the protocol message from the body of given
+// request, given its content type. JSON messages are converted with given
+// shims from the version of their sender.
+func decodeWireMessage(r *http.Request, shims map[int]shim, v interface{}) error {
+	if r.Header.Get("Content-Type") == contentTypeMsgpack {
+		dec := msgpack.NewDecoder(r.Body)
+		dec.SetCustomStructTag("json")
+
+		return dec.Decode(v)
+	}
+
+	return decodeMessage(r.Body, shims, v)
+}
+
+// marshalMsgpack encodes given value with msgpack, naming the fields of
+// structs as in JSON.
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// EncodeMsgpack encodes the round number as in JSON, without its mutex.
+func (r *GossipRound) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.Encode(map[string]int64{"number": r.GetNumber()})
+}
+
+// DecodeMsgpack decodes the round number.
+func (r *GossipRound) DecodeMsgpack(dec *msgpack.Decoder) error {
+	var round struct {
+		Number int64 `json:"number"`
+	}
+
+	if err := dec.Decode(&round); err != nil {
+		return err
+	}
+
+	r.Number = round.Number
+	r.Mux = &sync.Mutex{}
+
+	return nil
+}
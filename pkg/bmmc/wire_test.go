@@ -0,0 +1,115 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var _ = Describe("Wire format", func() {
+	It("encodes with msgpack only the messages for peers which negotiated it", func() {
+		b := &BMMC{
+			config:        &Config{WireFormat: MsgpackWireFormat},
+			peerProtocols: newPeerProtocols(),
+		}
+		b.peerProtocols.set("localhost", "2", ProtocolVersion, localCapabilities)
+
+		round := NewGossipRound()
+		round.Increment()
+
+		gossipMsg := HTTPGossip{
+			Envelope:    newEnvelope(),
+			Addr:        "localhost",
+			Port:        "1",
+			RoundNumber: round,
+			Digest:      []string{"a", "b"},
+		}
+
+		raw, contentType, err := b.marshalMessage(gossipMsg, "localhost", "3")
+		Expect(err).To(Succeed())
+		Expect(contentType).To(Equal(contentTypeJSON))
+
+		raw, contentType, err = b.marshalMessage(gossipMsg, "localhost", "2")
+		Expect(err).To(Succeed())
+		Expect(contentType).To(Equal(contentTypeMsgpack))
+
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:2"+gossipRoute, bytes.NewReader(raw))
+		Expect(err).To(Succeed())
+		req.Header.Set("Content-Type", contentType)
+
+		var decoded HTTPGossip
+		Expect(decodeWireMessage(req, gossipShims, &decoded)).To(Succeed())
+		Expect(decoded.Digest).To(Equal(gossipMsg.Digest))
+		Expect(decoded.RoundNumber.GetNumber()).To(Equal(int64(1)))
+
+		// the fields are named as in JSON, so the messages can be decoded
+		// without the types of this package, e.g. in other languages
+		var fields map[string]interface{}
+		Expect(msgpack.Unmarshal(raw, &fields)).To(Succeed())
+		Expect(fields).To(HaveKeyWithValue("addr", "localhost"))
+		Expect(fields).To(HaveKeyWithValue("digest", ConsistOf("a", "b")))
+		Expect(fields).To(HaveKeyWithValue("roundNumber", HaveKeyWithValue("number", BeNumerically("==", 1))))
+		Expect(fields).To(HaveKeyWithValue("version", BeNumerically("==", ProtocolVersion)))
+	})
+
+	It("disseminates the messages in a cluster with mixed wire formats", func() {
+		transport := NewMemoryTransport()
+		nodes := []*BMMC{}
+
+		for port, format := range map[string]WireFormat{"1": MsgpackWireFormat, "2": MsgpackWireFormat, "3": JSONWireFormat} {
+			node, err := New(&Config{
+				Addr:          "localhost",
+				Port:          port,
+				BufferSize:    16,
+				RoundDuration: time.Millisecond * 20,
+				WireFormat:    format,
+				Transport:     transport,
+				Logger:        log.New(ioutil.Discard, "", 0),
+			})
+			Expect(err).To(Succeed())
+			Expect(node.Start()).To(Succeed())
+
+			defer node.Stop() // nolint: errcheck
+
+			nodes = append(nodes, node)
+		}
+
+		for _, node := range nodes {
+			for _, port := range []string{"1", "2", "3"} {
+				if port != node.config.Port {
+					Expect(node.AddPeer("localhost", port)).To(Succeed())
+				}
+			}
+		}
+
+		for _, node := range nodes {
+			Expect(node.AddMessage(node.config.Port, NOCALLBACK)).To(Succeed())
+		}
+
+		for _, node := range nodes {
+			Eventually(node.GetMessages, time.Second*5).Should(ContainElements("1", "2", "3"))
+		}
+	})
+})
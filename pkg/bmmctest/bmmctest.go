@@ -0,0 +1,280 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bmmctest provides helpers for testing applications which use the
+// bimodal multicast protocol: clusters of connected nodes which run in memory,
+// message injection, convergence assertions and failure simulation.
+package bmmctest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/bmmc"
+)
+
+const (
+	defaultBufferSize    = 64
+	defaultRoundDuration = time.Millisecond * 50
+	pollInterval         = time.Millisecond * 10
+)
+
+var (
+	errNodeDown = errors.New("node is down")
+)
+
+// T is the subset of testing.TB used by the helpers. GinkgoT() implements it too.
+type T interface {
+	Fatalf(format string, args ...interface{})
+}
+
+// helper marks the caller as a test helper, if t supports it.
+func helper(t T) {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+}
+
+// Cluster is a cluster of connected nodes which share an in-memory transport.
+type Cluster struct {
+	// Nodes are the nodes of the cluster
+	Nodes []*bmmc.BMMC
+	// Configs are the configs of the nodes
+	Configs []*bmmc.Config
+
+	t         T
+	transport *bmmc.MemoryTransport
+	down      map[string]bool
+	links     map[link]Link
+	rand      *rand.Rand
+	mux       sync.RWMutex
+}
+
+// NewCluster creates and starts a cluster with n nodes. The first node knows
+// all the other nodes and all the other nodes know the first node. configure, if not nil, is called with the config of
+// each node before the node is created. The nodes don't open sockets and the
+// links between them don't lose or delay requests until SetLink is called.
+func NewCluster(t T, n int, configure func(i int, cfg *bmmc.Config)) *Cluster {
+	helper(t)
+
+	c := &Cluster{
+		Nodes:     make([]*bmmc.BMMC, n),
+		Configs:   make([]*bmmc.Config, n),
+		t:         t,
+		transport: bmmc.NewMemoryTransport(),
+		down:      map[string]bool{},
+		links:     map[link]Link{},
+		rand:      rand.New(rand.NewSource(0)), // nolint: gosec
+	}
+
+	for i := range c.Nodes {
+		cfg := &bmmc.Config{
+			Addr:          "localhost",
+			Port:          strconv.Itoa(i + 1),
+			BufferSize:    defaultBufferSize,
+			RoundDuration: defaultRoundDuration,
+			Logger:        log.New(ioutil.Discard, "", 0),
+		}
+
+		if configure != nil {
+			configure(i, cfg)
+		}
+
+		cfg.Transport = &nodeTransport{
+			cluster: c,
+			host:    host(cfg.Addr, cfg.Port),
+		}
+
+		node, err := bmmc.New(cfg)
+		if err != nil {
+			t.Fatalf("error at creating node %d: %s", i, err)
+		}
+
+		if err := node.Start(); err != nil {
+			t.Fatalf("error at starting node %d: %s", i, err)
+		}
+
+		c.Nodes[i] = node
+		c.Configs[i] = cfg
+	}
+
+	first := c.Configs[0]
+
+	for i := range c.Nodes[1:] {
+		if err := c.Nodes[i+1].AddPeer(first.Addr, first.Port); err != nil {
+			t.Fatalf("error at adding peer %s: %s", host(first.Addr, first.Port), err)
+		}
+	}
+
+	for _, cfg := range c.Configs[1:] {
+		if err := c.Nodes[0].AddPeer(cfg.Addr, cfg.Port); err != nil {
+			t.Fatalf("error at adding peer %s: %s", host(cfg.Addr, cfg.Port), err)
+		}
+	}
+
+	return c
+}
+
+// Stop stops all the nodes of the cluster.
+func (c *Cluster) Stop() {
+	for _, node := range c.Nodes {
+		node.Stop() // nolint: errcheck
+	}
+}
+
+// AddMessage adds given message, without callback, in the buffer of node i.
+func (c *Cluster) AddMessage(i int, msg interface{}) {
+	helper(c.t)
+
+	if err := c.Nodes[i].AddMessage(msg, bmmc.NOCALLBACK); err != nil {
+		c.t.Fatalf("error at adding message in node %d: %s", i, err)
+	}
+}
+
+// Fail simulates the failure of node i: the requests sent by or to the node
+// are lost until the node is recovered.
+func (c *Cluster) Fail(i int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.down[host(c.Configs[i].Addr, c.Configs[i].Port)] = true
+}
+
+// Recover recovers node i after a simulated failure.
+func (c *Cluster) Recover(i int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	delete(c.down, host(c.Configs[i].Addr, c.Configs[i].Port))
+}
+
+// isDown returns true if the node with given host is failed.
+func (c *Cluster) isDown(host string) bool {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	return c.down[host]
+}
+
+// liveNodes returns the nodes which are not failed.
+func (c *Cluster) liveNodes() []*bmmc.BMMC {
+	nodes := []*bmmc.BMMC{}
+
+	for i, node := range c.Nodes {
+		if !c.isDown(host(c.Configs[i].Addr, c.Configs[i].Port)) {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes
+}
+
+// AssertConvergence fails the test if the nodes which are not failed don't
+// have the same messages within given timeout.
+func (c *Cluster) AssertConvergence(timeout time.Duration) {
+	helper(c.t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := bmmc.WaitForConvergence(ctx, c.liveNodes()...); err != nil {
+		c.t.Fatalf("cluster did not converge in %s: %s", timeout, err)
+	}
+}
+
+// AssertMessage fails the test if the nodes which are not failed don't all
+// have given message within given timeout.
+func (c *Cluster) AssertMessage(msg interface{}, timeout time.Duration) {
+	helper(c.t)
+
+	deadline := time.Now().Add(timeout)
+
+	for !c.allHave(msg) {
+		if time.Now().After(deadline) {
+			c.t.Fatalf("message %v was not delivered to all nodes in %s", msg, timeout)
+			return
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// allHave returns true if all the nodes which are not failed have given message.
+func (c *Cluster) allHave(msg interface{}) bool {
+	want := fmt.Sprint(msg)
+
+	for _, node := range c.liveNodes() {
+		found := false
+
+		for _, m := range node.GetMessages() {
+			if fmt.Sprint(m) == want {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// nodeTransport is the transport of a node, which loses the requests sent
+// by or to failed nodes and simulates the links of the node.
+type nodeTransport struct {
+	cluster *Cluster
+	host    string
+}
+
+// RoundTrip sends the request on its link if neither the node nor the peer
+// is failed.
+func (t *nodeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	err := errNodeDown
+	if !t.cluster.isDown(t.host) && !t.cluster.isDown(req.URL.Host) {
+		err = t.cluster.send(t.host, req)
+	}
+
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close() // nolint: errcheck
+		}
+
+		return nil, err
+	}
+
+	return t.cluster.transport.RoundTrip(req)
+}
+
+// Serve serves the requests sent to the node.
+func (t *nodeTransport) Serve(host string, handler http.Handler, stop <-chan struct{}) error {
+	return t.cluster.transport.Serve(host, handler, stop)
+}
+
+// host returns the host of given address and port.
+func host(addr, port string) string {
+	return net.JoinHostPort(addr, port)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmctest_test
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/bmmc"
+	"github.com/rstefan1/bimodal-multicast/pkg/bmmctest"
+)
+
+// fakeT records the failures of the helpers.
+type fakeT struct {
+	failures []string
+}
+
+func (t *fakeT) Fatalf(format string, args ...interface{}) {
+	t.failures = append(t.failures, fmt.Sprintf(format, args...))
+}
+
+var _ = Describe("Cluster", func() {
+	It("starts connected nodes which disseminate messages", func() {
+		c := bmmctest.NewCluster(GinkgoT(), 4, func(_ int, cfg *bmmc.Config) {
+			cfg.Beta = 0.5
+		})
+		defer c.Stop()
+
+		Expect(c.Nodes).To(HaveLen(4))
+		Expect(c.Configs[0].Beta).To(Equal(0.5))
+
+		c.AddMessage(2, "hello")
+		c.AssertMessage("hello", time.Second*5)
+		c.AssertConvergence(time.Second * 5)
+	})
+
+	It("simulates failures", func() {
+		c := bmmctest.NewCluster(GinkgoT(), 3, nil)
+		defer c.Stop()
+
+		c.AssertConvergence(time.Second * 5)
+		c.Fail(2)
+
+		c.AddMessage(0, "while down")
+		c.AssertMessage("while down", time.Second*5)
+		Expect(c.Nodes[2].GetMessages()).NotTo(ContainElement("while down"))
+
+		c.Recover(2)
+		c.AssertMessage("while down", time.Second*5)
+		Expect(c.Nodes[2].GetMessages()).To(ContainElement("while down"))
+	})
+
+	It("fails the test if the message is not delivered", func() {
+		t := &fakeT{}
+
+		c := bmmctest.NewCluster(t, 2, nil)
+		defer c.Stop()
+
+		c.AssertMessage("never added", time.Millisecond*100)
+		Expect(t.failures).To(HaveLen(1))
+	})
+})
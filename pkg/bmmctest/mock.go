@@ -0,0 +1,320 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmctest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/bmmc"
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	gossipRoute          = "/gossip"
+	solicitationRoute    = "/solicitation"
+	synchronizationRoute = "/synchronization"
+
+	mockPeerErrFmt = "mock peer %s: %w"
+)
+
+var (
+	errUnexpectedStatus = errors.New("unexpected status")
+)
+
+// SynchronizationFunc returns the synchronization sent by a mock peer in
+// response to given solicitation, and false if no synchronization is sent.
+type SynchronizationFunc func(solicitation bmmc.HTTPSolicitation) (bmmc.HTTPSynchronization, bool)
+
+// MockPeer is a peer which records the gossip, solicitation and
+// synchronization messages it receives, and answers solicitations with
+// scripted synchronizations. By default, it answers with the solicited
+// messages added with AddMessage.
+type MockPeer struct {
+	Addr string
+	Port string
+
+	transport bmmc.Transport
+	client    *http.Client
+	stop      chan struct{}
+	server    *http.Server
+
+	messages         []buffer.Element
+	gossips          []bmmc.HTTPGossip
+	solicitations    []bmmc.HTTPSolicitation
+	synchronizations []bmmc.HTTPSynchronization
+	synchronization  SynchronizationFunc
+	mux              sync.Mutex
+}
+
+// NewMockPeer creates and starts a mock peer with given address. The peer is
+// served by given transport or, if transport is nil, over HTTP on given port.
+func NewMockPeer(transport bmmc.Transport, addr, port string) (*MockPeer, error) {
+	m := &MockPeer{
+		Addr:      addr,
+		Port:      port,
+		transport: transport,
+		client:    &http.Client{},
+		stop:      make(chan struct{}),
+	}
+
+	m.synchronization = func(s bmmc.HTTPSolicitation) (bmmc.HTTPSynchronization, bool) {
+		return m.Synchronization(s.Digest...), true
+	}
+
+	if transport != nil {
+		m.client.Transport = transport
+
+		if err := transport.Serve(host(addr, port), m, m.stop); err != nil {
+			return nil, fmt.Errorf(mockPeerErrFmt, host(addr, port), err)
+		}
+
+		return m, nil
+	}
+
+	l, err := net.Listen("tcp", host(addr, port))
+	if err != nil {
+		return nil, fmt.Errorf(mockPeerErrFmt, host(addr, port), err)
+	}
+
+	m.server = &http.Server{Handler: m}
+
+	go m.server.Serve(l) // nolint: errcheck
+
+	return m, nil
+}
+
+// Stop stops the mock peer.
+func (m *MockPeer) Stop() {
+	close(m.stop)
+
+	if m.server != nil {
+		m.server.Close() // nolint: errcheck
+	}
+}
+
+// AddMessage adds a message which is announced with Gossip and served to
+// solicitations.
+func (m *MockPeer) AddMessage(msg interface{}, callbackType string) error {
+	el, err := buffer.NewElement(msg, callbackType)
+	if err != nil {
+		return fmt.Errorf(mockPeerErrFmt, host(m.Addr, m.Port), err)
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.messages = append(m.messages, el)
+
+	return nil
+}
+
+// SetSynchronization replaces the synchronizations sent to solicitations.
+func (m *MockPeer) SetSynchronization(fn SynchronizationFunc) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.synchronization = fn
+}
+
+// Gossips returns the gossip messages received by the mock peer.
+func (m *MockPeer) Gossips() []bmmc.HTTPGossip {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return append([]bmmc.HTTPGossip{}, m.gossips...)
+}
+
+// Solicitations returns the solicitation messages received by the mock peer.
+func (m *MockPeer) Solicitations() []bmmc.HTTPSolicitation {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return append([]bmmc.HTTPSolicitation{}, m.solicitations...)
+}
+
+// Synchronizations returns the synchronization messages received by the mock peer.
+func (m *MockPeer) Synchronizations() []bmmc.HTTPSynchronization {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return append([]bmmc.HTTPSynchronization{}, m.synchronizations...)
+}
+
+// Gossip sends a gossip message with the digest of the added messages to
+// the node with given address, so the node solicits the messages it misses.
+func (m *MockPeer) Gossip(ctx context.Context, addr, port string) error {
+	m.mux.Lock()
+	digest := make([]string, len(m.messages))
+	for i, el := range m.messages {
+		digest[i] = el.ID
+	}
+	m.mux.Unlock()
+
+	return m.post(ctx, addr, port, gossipRoute, bmmc.HTTPGossip{
+		Addr:        m.Addr,
+		Port:        m.Port,
+		RoundNumber: bmmc.NewGossipRound(),
+		Digest:      digest,
+	})
+}
+
+// Synchronization returns a synchronization from the mock peer with the added
+// messages which have given IDs.
+func (m *MockPeer) Synchronization(ids ...string) bmmc.HTTPSynchronization {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	elements := []buffer.Element{}
+
+	for _, el := range m.messages {
+		if wanted[el.ID] {
+			elements = append(elements, el)
+		}
+	}
+
+	return bmmc.HTTPSynchronization{
+		Addr:     m.Addr,
+		Port:     m.Port,
+		Elements: elements,
+	}
+}
+
+// ServeHTTP records the received message and answers solicitations.
+func (m *MockPeer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := r.Body
+
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body = gr
+	}
+
+	var err error
+
+	switch r.URL.Path {
+	case gossipRoute:
+		err = m.receiveGossip(body)
+	case solicitationRoute:
+		err = m.receiveSolicitation(body)
+	case synchronizationRoute:
+		err = m.receiveSynchronization(body)
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// receiveGossip records a gossip message.
+func (m *MockPeer) receiveGossip(r io.Reader) error {
+	var g bmmc.HTTPGossip
+	if err := json.NewDecoder(r).Decode(&g); err != nil {
+		return err
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.gossips = append(m.gossips, g)
+
+	return nil
+}
+
+// receiveSynchronization records a synchronization message.
+func (m *MockPeer) receiveSynchronization(r io.Reader) error {
+	var s bmmc.HTTPSynchronization
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return err
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.synchronizations = append(m.synchronizations, s)
+
+	return nil
+}
+
+// receiveSolicitation records a solicitation and sends the scripted synchronization.
+func (m *MockPeer) receiveSolicitation(r io.Reader) error {
+	var s bmmc.HTTPSolicitation
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return err
+	}
+
+	m.mux.Lock()
+	m.solicitations = append(m.solicitations, s)
+	script := m.synchronization
+	m.mux.Unlock()
+
+	synchronization, ok := script(s)
+
+	if !ok {
+		return nil
+	}
+
+	// the synchronization is sent after the solicitation is answered
+	go m.post(context.Background(), s.Addr, s.Port, synchronizationRoute, synchronization) // nolint: errcheck
+
+	return nil
+}
+
+// post sends given message to given node.
+func (m *MockPeer) post(ctx context.Context, addr, port, route string, msg interface{}) error {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf(mockPeerErrFmt, host(m.Addr, m.Port), err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("http://%s%s", host(addr, port), route), bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf(mockPeerErrFmt, host(m.Addr, m.Port), err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf(mockPeerErrFmt, host(m.Addr, m.Port), err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf(mockPeerErrFmt, host(m.Addr, m.Port), errUnexpectedStatus)
+	}
+
+	return nil
+}
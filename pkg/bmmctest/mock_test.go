@@ -0,0 +1,137 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmctest_test
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/bmmc"
+	"github.com/rstefan1/bimodal-multicast/pkg/bmmctest"
+)
+
+var _ = Describe("MockPeer", func() {
+	var (
+		transport *bmmc.MemoryTransport
+		node      *bmmc.BMMC
+		mock      *bmmctest.MockPeer
+	)
+
+	BeforeEach(func() {
+		transport = bmmc.NewMemoryTransport()
+
+		var err error
+
+		mock, err = bmmctest.NewMockPeer(transport, "localhost", "2")
+		Expect(err).To(Succeed())
+
+		node, err = bmmc.New(&bmmc.Config{
+			Addr:          "localhost",
+			Port:          "1",
+			BufferSize:    16,
+			RoundDuration: time.Millisecond * 20,
+			Transport:     transport,
+			Logger:        log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+		Expect(node.Start()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		node.Stop()
+		mock.Stop()
+	})
+
+	It("records the gossip messages of the node", func() {
+		Expect(node.AddPeer("localhost", "2")).To(Succeed())
+
+		Eventually(mock.Gossips, time.Second*5).ShouldNot(BeEmpty())
+		Expect(mock.Gossips()[0].Port).To(Equal("1"))
+	})
+
+	It("serves the solicited messages", func() {
+		Expect(mock.AddMessage("from mock", bmmc.NOCALLBACK)).To(Succeed())
+		Expect(mock.Gossip(context.Background(), "localhost", "1")).To(Succeed())
+
+		Eventually(node.GetMessages, time.Second*5).Should(ContainElement("from mock"))
+		Expect(mock.Solicitations()).To(HaveLen(1))
+	})
+
+	It("serves scripted synchronizations", func() {
+		Expect(mock.AddMessage("from mock", bmmc.NOCALLBACK)).To(Succeed())
+		Expect(mock.AddMessage("also from mock", bmmc.NOCALLBACK)).To(Succeed())
+
+		// serve only the first solicited message
+		mock.SetSynchronization(func(s bmmc.HTTPSolicitation) (bmmc.HTTPSynchronization, bool) {
+			return mock.Synchronization(s.Digest[0]), true
+		})
+
+		Expect(mock.Gossip(context.Background(), "localhost", "1")).To(Succeed())
+
+		Eventually(mock.Solicitations, time.Second*5).ShouldNot(BeEmpty())
+		Eventually(func() int { return len(node.GetMessages()) }, time.Second*5).Should(Equal(1))
+		Consistently(func() int { return len(node.GetMessages()) }, time.Millisecond*200).Should(Equal(1))
+	})
+
+	It("defers the messages over the synchronization limit of the node", func() {
+		limited, err := bmmc.New(&bmmc.Config{
+			Addr:            "localhost",
+			Port:            "3",
+			BufferSize:      16,
+			RoundDuration:   time.Millisecond * 20,
+			MaxSyncMessages: 1,
+			Transport:       transport,
+			Logger:          log.New(ioutil.Discard, "", 0),
+		})
+		Expect(err).To(Succeed())
+		Expect(limited.Start()).To(Succeed())
+
+		defer limited.Stop()
+
+		for _, msg := range []string{"first", "second", "third"} {
+			Expect(mock.AddMessage(msg, bmmc.NOCALLBACK)).To(Succeed())
+		}
+
+		Expect(mock.Gossip(context.Background(), "localhost", "3")).To(Succeed())
+
+		Eventually(func() int { return len(limited.GetMessages()) }, time.Second*5).Should(Equal(3))
+
+		digests := []int{}
+		for _, s := range mock.Solicitations() {
+			digests = append(digests, len(s.Digest))
+		}
+
+		Expect(digests).To(Equal([]int{3, 2, 1}))
+	})
+
+	It("records the synchronizations sent by the node", func() {
+		Expect(node.AddPeer("localhost", "2")).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		_, err := node.Broadcast(ctx, "pushed", bmmc.BroadcastOptions{})
+		Expect(err).To(Succeed())
+
+		Eventually(mock.Synchronizations, time.Second*5).ShouldNot(BeEmpty())
+	})
+})
@@ -0,0 +1,102 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmctest
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+var (
+	errLinkLoss = errors.New("request lost on link")
+)
+
+// Link describes the simulated network between two nodes of a cluster.
+type Link struct {
+	// Loss is the probability, between 0 and 1, that a request sent on the
+	// link is lost
+	Loss float64
+	// Latency is the delay of each request sent on the link
+	Latency time.Duration
+}
+
+// link is the key of a link from a host to another host.
+type link struct {
+	from string
+	to   string
+}
+
+// Seed reseeds the random choices of the simulated network, e.g. which
+// requests are lost, so a test which fails can be replayed. The clusters are
+// seeded with 0 when they are created.
+func (c *Cluster) Seed(seed int64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.rand = rand.New(rand.NewSource(seed)) // nolint: gosec
+}
+
+// SetLink sets the loss and the latency of the requests sent by node from to
+// node to. The link from node to to node from is not changed.
+func (c *Cluster) SetLink(from, to int, l Link) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.links[link{from: c.host(from), to: c.host(to)}] = l
+}
+
+// SetLinks sets the loss and the latency of the requests sent between all the
+// nodes of the cluster.
+func (c *Cluster) SetLinks(l Link) {
+	for from := range c.Nodes {
+		for to := range c.Nodes {
+			if from != to {
+				c.SetLink(from, to, l)
+			}
+		}
+	}
+}
+
+// host returns the host of node i.
+func (c *Cluster) host(i int) string {
+	return host(c.Configs[i].Addr, c.Configs[i].Port)
+}
+
+// send delays the request with the latency of its link and loses it with the
+// loss of its link.
+func (c *Cluster) send(from string, req *http.Request) error {
+	c.mux.Lock()
+	l := c.links[link{from: from, to: req.URL.Host}]
+	lost := l.Loss > 0 && c.rand.Float64() < l.Loss
+	c.mux.Unlock()
+
+	if l.Latency > 0 {
+		select {
+		case <-time.After(l.Latency):
+		case <-req.Context().Done():
+			return req.Context().Err()
+		}
+	}
+
+	if lost {
+		return errLinkLoss
+	}
+
+	return nil
+}
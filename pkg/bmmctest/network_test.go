@@ -0,0 +1,59 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmmctest_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/bmmctest"
+)
+
+var _ = Describe("Network", func() {
+	It("loses the requests sent on a link", func() {
+		c := bmmctest.NewCluster(GinkgoT(), 3, nil)
+		defer c.Stop()
+
+		c.AssertConvergence(time.Second * 5)
+
+		// the nodes learn about each other, so node 2 is cut from both nodes
+		for _, i := range []int{0, 1} {
+			c.SetLink(i, 2, bmmctest.Link{Loss: 1})
+			c.SetLink(2, i, bmmctest.Link{Loss: 1})
+		}
+
+		c.AddMessage(0, "cut")
+		Eventually(c.Nodes[1].GetMessages, time.Second*5).Should(ContainElement("cut"))
+		Consistently(c.Nodes[2].GetMessages, time.Millisecond*300).ShouldNot(ContainElement("cut"))
+
+		c.SetLinks(bmmctest.Link{})
+		c.AssertMessage("cut", time.Second*5)
+	})
+
+	It("converges over slow and lossy links", func() {
+		c := bmmctest.NewCluster(GinkgoT(), 4, nil)
+		defer c.Stop()
+
+		c.Seed(42)
+		c.SetLinks(bmmctest.Link{Loss: 0.3, Latency: time.Millisecond * 10})
+
+		c.AddMessage(1, "slow")
+		c.AssertMessage("slow", time.Second*10)
+	})
+})
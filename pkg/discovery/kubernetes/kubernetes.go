@@ -0,0 +1,406 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kubernetes discovers the peers of a bimodal multicast node from the
+// EndpointSlices of a Kubernetes service, e.g. the pods of a StatefulSet or of
+// a Deployment behind a headless service. It talks to the API server of the
+// cluster in which the node runs, with the service account of its pod, so it
+// doesn't depend on client-go.
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/bmmc"
+)
+
+const (
+	// serviceAccountDir is the directory in which the credentials of the
+	// service account are mounted in pods
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// serviceNameLabel is the label of the EndpointSlices of a service
+	serviceNameLabel = "kubernetes.io/service-name"
+
+	endpointSlicesPathFmt = "/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices"
+
+	defaultNamespace     = "default"
+	defaultRetryInterval = time.Second * 5
+
+	// PodIPEnv and PodNamespaceEnv are the environment variables in which the
+	// IP and the namespace of the pod are exposed through the downward API
+	PodIPEnv        = "POD_IP"
+	PodNamespaceEnv = "POD_NAMESPACE"
+
+	listErrFmt      = "error at listing the endpoints of service %s/%s: %w"
+	statusErrFmt    = "unexpected status %s"
+	readTokenErrFmt = "error at reading the token from %s: %w"
+	readCAErrFmt    = "error at reading the CA certificates from %s: %w"
+)
+
+var (
+	errNoService     = errors.New("service is required")
+	errNotInCluster  = errors.New("not running in a Kubernetes cluster, APIServer is required")
+	errInvalidCA     = errors.New("no CA certificates found")
+	errInvalidRetry  = errors.New("invalid retry interval")
+	errWatchFinished = errors.New("watch finished")
+)
+
+// Config is the configuration of a Discoverer. The defaults are the ones of a
+// pod which runs in the cluster.
+type Config struct {
+	// Service is the name of the service whose endpoints are the peers. The
+	// service should be headless, and should publish the not ready addresses
+	// when the nodes become ready only after they synced with a peer (see
+	// bmmc.Config.ReadyAfterSync)
+	Service string
+	// Namespace is the namespace of the service
+	// Optional (default: the POD_NAMESPACE environment variable, or the
+	// namespace of the service account)
+	Namespace string
+	// PortName is the name of the port of the service on which the nodes listen
+	// Optional (default: the first port of the endpoints)
+	PortName string
+	// ReadyOnly discovers only the endpoints which are ready
+	// Optional (default: all the endpoints which are not terminating)
+	ReadyOnly bool
+	// APIServer is the URL of the Kubernetes API server
+	// Optional (default: https://$KUBERNETES_SERVICE_HOST:$KUBERNETES_SERVICE_PORT)
+	APIServer string
+	// TokenFile is the file with the bearer token sent to the API server. It is
+	// read at each request, since the tokens of service accounts are rotated
+	// Optional (default: the token of the service account, if it exists)
+	TokenFile string
+	// Client is the HTTP client of the API server. It must not have a timeout,
+	// since the watches are long-running requests
+	// Optional (default: a client which trusts the CA of the service account)
+	Client *http.Client
+	// RetryInterval is the time after which a failed watch is restarted
+	// Optional (default: 5s)
+	RetryInterval time.Duration
+}
+
+// Discoverer discovers the endpoints of a Kubernetes service and watches their
+// changes. It implements bmmc.DiscoveryWatcher, so the peers buffer follows the
+// pods as they come and go when bmmc.Config.DiscoveryInterval is set.
+type Discoverer struct {
+	config Config
+}
+
+// endpointSliceList is a list of discovery.k8s.io/v1 EndpointSlices, with the
+// fields used by Discoverer.
+type endpointSliceList struct {
+	Items []endpointSlice `json:"items"`
+}
+
+type endpointSlice struct {
+	Endpoints []endpoint     `json:"endpoints"`
+	Ports     []endpointPort `json:"ports"`
+}
+
+type endpoint struct {
+	Addresses  []string           `json:"addresses"`
+	Conditions endpointConditions `json:"conditions"`
+}
+
+// endpointConditions are the conditions of an endpoint. Unknown conditions are
+// nil.
+type endpointConditions struct {
+	Ready       *bool `json:"ready"`
+	Terminating *bool `json:"terminating"`
+}
+
+type endpointPort struct {
+	Name string `json:"name"`
+	Port *int32 `json:"port"`
+}
+
+// watchEvent is an event of a watch of EndpointSlices.
+type watchEvent struct {
+	Type string `json:"type"`
+}
+
+// NewDiscoverer creates a Discoverer with given config.
+func NewDiscoverer(cfg *Config) (*Discoverer, error) {
+	c := *cfg
+
+	if c.Service == "" {
+		return nil, errNoService
+	}
+
+	if c.RetryInterval < 0 {
+		return nil, errInvalidRetry
+	}
+
+	if c.RetryInterval == 0 {
+		c.RetryInterval = defaultRetryInterval
+	}
+
+	if c.Namespace == "" {
+		c.Namespace = inClusterNamespace()
+	}
+
+	if c.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errNotInCluster
+		}
+
+		c.APIServer = "https://" + net.JoinHostPort(host, port)
+	}
+
+	c.APIServer = strings.TrimSuffix(c.APIServer, "/")
+
+	if c.TokenFile == "" {
+		if _, err := os.Stat(serviceAccountDir + "/token"); err == nil {
+			c.TokenFile = serviceAccountDir + "/token"
+		}
+	}
+
+	if c.Client == nil {
+		client, err := inClusterClient()
+		if err != nil {
+			return nil, err
+		}
+
+		c.Client = client
+	}
+
+	return &Discoverer{config: c}, nil
+}
+
+// inClusterNamespace returns the namespace of the pod in which the node runs.
+func inClusterNamespace() string {
+	if ns := os.Getenv(PodNamespaceEnv); ns != "" {
+		return ns
+	}
+
+	if ns, err := ioutil.ReadFile(serviceAccountDir + "/namespace"); err == nil && len(ns) > 0 {
+		return strings.TrimSpace(string(ns))
+	}
+
+	return defaultNamespace
+}
+
+// inClusterClient returns a client which trusts the CA of the service account,
+// if it exists, or the system CAs otherwise.
+func inClusterClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	caFile := serviceAccountDir + "/ca.crt"
+
+	ca, err := ioutil.ReadFile(caFile)
+	if os.IsNotExist(err) {
+		return &http.Client{Transport: transport}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf(readCAErrFmt, caFile, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf(readCAErrFmt, caFile, errInvalidCA)
+	}
+
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// PodIP returns the IP of the pod, exposed in the POD_IP environment variable
+// through the downward API. It is the address of the node (see bmmc.Config.Addr),
+// since the peers discover it by the IP of its endpoint.
+func PodIP() string {
+	return os.Getenv(PodIPEnv)
+}
+
+// endpointSlicesURL returns the URL of the EndpointSlices of the service, with
+// given extra query parameters.
+func (d *Discoverer) endpointSlicesURL(query url.Values) string {
+	query.Set("labelSelector", serviceNameLabel+"="+d.config.Service)
+
+	return d.config.APIServer + fmt.Sprintf(endpointSlicesPathFmt, url.PathEscape(d.config.Namespace)) + "?" + query.Encode()
+}
+
+// get sends a GET request to given URL of the API server and returns the
+// response, if its status is 200.
+func (d *Discoverer) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	if d.config.TokenFile != "" {
+		token, err := ioutil.ReadFile(d.config.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf(readTokenErrFmt, d.config.TokenFile, err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	res, err := d.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close() // nolint: errcheck
+
+		return nil, fmt.Errorf(statusErrFmt, res.Status) // nolint: goerr113
+	}
+
+	return res, nil
+}
+
+// Discover returns the endpoints of the service which are not terminating, or
+// which are ready with ReadyOnly, on the port with PortName.
+func (d *Discoverer) Discover(ctx context.Context) ([]bmmc.Peer, error) {
+	res, err := d.get(ctx, d.endpointSlicesURL(url.Values{}))
+	if err != nil {
+		return nil, fmt.Errorf(listErrFmt, d.config.Namespace, d.config.Service, err)
+	}
+	defer res.Body.Close() // nolint: errcheck
+
+	list := endpointSliceList{}
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf(listErrFmt, d.config.Namespace, d.config.Service, err)
+	}
+
+	peers := []bmmc.Peer{}
+
+	for _, slice := range list.Items {
+		port, ok := d.slicePort(slice)
+		if !ok {
+			continue
+		}
+
+		for _, e := range slice.Endpoints {
+			if !d.discoverable(e) {
+				continue
+			}
+
+			for _, addr := range e.Addresses {
+				peers = append(peers, bmmc.Peer{Addr: addr, Port: port})
+			}
+		}
+	}
+
+	return peers, nil
+}
+
+// slicePort returns the port with PortName of given EndpointSlice, or its first
+// port, and false if it has no such port.
+func (d *Discoverer) slicePort(slice endpointSlice) (string, bool) {
+	for _, p := range slice.Ports {
+		if p.Port == nil {
+			continue
+		}
+
+		if d.config.PortName == "" || p.Name == d.config.PortName {
+			return strconv.Itoa(int(*p.Port)), true
+		}
+	}
+
+	return "", false
+}
+
+// discoverable returns true if given endpoint is a peer. Unknown conditions
+// are considered true for ready and false for terminating, like Kubernetes
+// does.
+func (d *Discoverer) discoverable(e endpoint) bool {
+	if e.Conditions.Terminating != nil && *e.Conditions.Terminating {
+		return false
+	}
+
+	if d.config.ReadyOnly && e.Conditions.Ready != nil && !*e.Conditions.Ready {
+		return false
+	}
+
+	return true
+}
+
+// Watch watches the EndpointSlices of the service and returns a channel which
+// receives a value each time they change, until ctx is done. The watch is
+// restarted after RetryInterval when it fails or it is closed by the API
+// server.
+func (d *Discoverer) Watch(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		for {
+			// the errors are retried; the peers are still discovered at each
+			// DiscoveryInterval meanwhile
+			d.watch(ctx, changes) // nolint: errcheck
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.config.RetryInterval):
+			}
+		}
+	}()
+
+	return changes
+}
+
+// watch watches the EndpointSlices of the service until the watch fails or ctx
+// is done, and notifies each event in given channel. A watch starts with an
+// event for each existing EndpointSlice, so the changes made while it was not
+// running are notified too.
+func (d *Discoverer) watch(ctx context.Context, changes chan<- struct{}) error {
+	res, err := d.get(ctx, d.endpointSlicesURL(url.Values{"watch": {"true"}}))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close() // nolint: errcheck
+
+	dec := json.NewDecoder(res.Body)
+
+	for {
+		event := watchEvent{}
+		if err := dec.Decode(&event); err != nil {
+			return err
+		}
+
+		// e.g. the resource version is too old
+		if event.Type == "ERROR" {
+			return errWatchFinished
+		}
+
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/bmmc"
+	"github.com/rstefan1/bimodal-multicast/pkg/discovery/kubernetes"
+)
+
+const endpointSlices = `{
+  "kind": "EndpointSliceList",
+  "items": [
+    {
+      "addressType": "IPv4",
+      "endpoints": [
+        {"addresses": ["10.0.0.1"], "conditions": {"ready": true}},
+        {"addresses": ["10.0.0.2"], "conditions": {"ready": false}},
+        {"addresses": ["10.0.0.3"], "conditions": {"ready": false, "terminating": true}},
+        {"addresses": ["10.0.0.4"], "conditions": {}}
+      ],
+      "ports": [
+        {"name": "metrics", "port": 9090},
+        {"name": "gossip", "port": 14999}
+      ]
+    }
+  ]
+}`
+
+var _ = Describe("Kubernetes discovery", func() {
+	var (
+		server   *httptest.Server
+		requests chan *http.Request
+		events   chan string
+		token    string
+	)
+
+	BeforeEach(func() {
+		requests = make(chan *http.Request, 16)
+		events = make(chan string, 16)
+
+		dir, err := ioutil.TempDir("", "kubernetes")
+		Expect(err).To(Succeed())
+
+		token = filepath.Join(dir, "token")
+		Expect(ioutil.WriteFile(token, []byte("secret\n"), 0600)).To(Succeed())
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- r
+
+			if r.URL.Query().Get("watch") != "true" {
+				fmt.Fprint(w, endpointSlices)
+				return
+			}
+
+			w.(http.Flusher).Flush()
+
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case t := <-events:
+					if t == "" {
+						// closes the watch
+						return
+					}
+
+					fmt.Fprintf(w, `{"type": %q, "object": {"kind": "EndpointSlice"}}`+"\n", t)
+					w.(http.Flusher).Flush()
+				}
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(filepath.Dir(token)) // nolint: errcheck
+	})
+
+	newDiscoverer := func(cfg kubernetes.Config) *kubernetes.Discoverer {
+		cfg.Service = "bmmc"
+		cfg.Namespace = "cluster"
+		cfg.APIServer = server.URL
+		cfg.TokenFile = token
+		cfg.Client = server.Client()
+		cfg.RetryInterval = time.Millisecond * 50
+
+		d, err := kubernetes.NewDiscoverer(&cfg)
+		Expect(err).To(Succeed())
+
+		return d
+	}
+
+	It("discovers the endpoints of the service which are not terminating", func() {
+		peers, err := newDiscoverer(kubernetes.Config{PortName: "gossip"}).Discover(context.Background())
+		Expect(err).To(Succeed())
+		Expect(peers).To(ConsistOf(
+			bmmc.Peer{Addr: "10.0.0.1", Port: "14999"},
+			bmmc.Peer{Addr: "10.0.0.2", Port: "14999"},
+			bmmc.Peer{Addr: "10.0.0.4", Port: "14999"},
+		))
+
+		var r *http.Request
+		Expect(requests).To(Receive(&r))
+		Expect(r.URL.Path).To(Equal("/apis/discovery.k8s.io/v1/namespaces/cluster/endpointslices"))
+		Expect(r.URL.Query().Get("labelSelector")).To(Equal("kubernetes.io/service-name=bmmc"))
+		Expect(r.Header.Get("Authorization")).To(Equal("Bearer secret"))
+	})
+
+	It("discovers only the ready endpoints, with ReadyOnly", func() {
+		peers, err := newDiscoverer(kubernetes.Config{ReadyOnly: true}).Discover(context.Background())
+		Expect(err).To(Succeed())
+
+		// the first port is used without PortName
+		Expect(peers).To(ConsistOf(
+			bmmc.Peer{Addr: "10.0.0.1", Port: "9090"},
+			bmmc.Peer{Addr: "10.0.0.4", Port: "9090"},
+		))
+	})
+
+	It("returns the errors of the API server", func() {
+		forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}))
+		defer forbidden.Close()
+
+		d, err := kubernetes.NewDiscoverer(&kubernetes.Config{
+			Service:   "bmmc",
+			APIServer: forbidden.URL,
+			Client:    forbidden.Client(),
+		})
+		Expect(err).To(Succeed())
+
+		_, err = d.Discover(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("403")))
+	})
+
+	It("requires a service and an API server outside of a cluster", func() {
+		_, err := kubernetes.NewDiscoverer(&kubernetes.Config{APIServer: server.URL})
+		Expect(err).To(HaveOccurred())
+
+		if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+			_, err = kubernetes.NewDiscoverer(&kubernetes.Config{Service: "bmmc"})
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
+	It("notifies the changes of the endpoints and restarts the closed watches", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		changes := newDiscoverer(kubernetes.Config{}).Watch(ctx)
+
+		events <- "ADDED"
+		Eventually(changes, time.Second*5).Should(Receive())
+
+		// the watch is restarted after it is closed
+		events <- ""
+		events <- "MODIFIED"
+		Eventually(changes, time.Second*5).Should(Receive())
+		Expect(requests).To(HaveLen(2))
+
+		var r *http.Request
+		Expect(requests).To(Receive(&r))
+		Expect(r.URL.Query().Get("watch")).To(Equal("true"))
+		Expect(r.URL.Query().Get("labelSelector")).To(Equal("kubernetes.io/service-name=bmmc"))
+	})
+
+	It("implements DiscoveryWatcher", func() {
+		var _ bmmc.DiscoveryWatcher = newDiscoverer(kubernetes.Config{})
+	})
+})
@@ -19,34 +19,127 @@ package buffer
 import (
 	"errors"
 	"math"
+	"sort"
 	"sync"
+	"time"
 )
 
 var (
+	// ErrFull is returned when an element can not be added because the buffer is full.
+	ErrFull = errors.New("buffer is full")
+	// ErrStale is returned when an element loses against the element with the same key.
+	ErrStale = errors.New("a newer element with the same key exists")
+
 	errIndexOutOfRange = errors.New("index out of range")
 	errAlreadyExists   = errors.New("already exists")
 	errTooOldElement   = errors.New("element is too old and buffer is full")
+	errTooLargeElement = errors.New("element is larger than the buffer")
 )
 
 // Buffer is the buffer with messages.
 type Buffer struct {
-	Elements []Element   `json:"elements"`
-	Len      int         `json:"len"`
-	Mux      *sync.Mutex `json:"mux"`
+	Elements []Element     `json:"elements"`
+	Len      int           `json:"len"`
+	Mux      *sync.RWMutex `json:"mux"`
+
+	// freed is closed when elements are removed from buffer
+	freed chan struct{}
+	// index keeps the elements from buffer by ID, for constant time lookups
+	index map[string]Element
+	// keys keeps the IDs of the keyed messages from buffer, by key
+	keys map[string]string
+	// sequences keeps the IDs of the elements with sequence numbers, by
+	// origin and sequence number
+	sequences map[sequence]string
+	// digest caches the digest of buffer; it is nil when the buffer changed
+	digest []string
+	// sizes keeps the approximate size of each element from buffer, by ID
+	sizes map[string]int
+	// bytes is the approximate size of the elements from buffer
+	bytes int
+	// maxBytes is the maximum approximate size of the elements; 0 means no limit
+	maxBytes int
 }
 
 // NewBuffer creates new buffer.
 func NewBuffer(size int) *Buffer {
 	return &Buffer{
-		Elements: make([]Element, size),
-		Len:      0,
-		Mux:      &sync.Mutex{},
+		Elements:  make([]Element, size),
+		Len:       0,
+		Mux:       &sync.RWMutex{},
+		freed:     make(chan struct{}),
+		index:     map[string]Element{},
+		keys:      map[string]string{},
+		sequences: map[sequence]string{},
+	}
+}
+
+// sequence identifies an ordered message among the messages of its origin.
+type sequence struct {
+	origin string
+	epoch  int64
+	seq    uint64
+}
+
+// indexElement adds given element in the indexes of buffer.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) indexElement(el Element) {
+	if buf.index == nil {
+		return
+	}
+
+	buf.index[el.ID] = el
+
+	if el.Key != "" && el.IsMessage() {
+		buf.keys[el.Key] = el.ID
+	}
+
+	if el.Seq > 0 && el.Fragment == nil {
+		buf.sequences[sequence{origin: el.Origin, epoch: el.SeqEpoch, seq: el.Seq}] = el.ID
+	}
+}
+
+// unindexElement removes given element from the indexes of buffer.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) unindexElement(el Element) {
+	if buf.index == nil {
+		return
+	}
+
+	delete(buf.index, el.ID)
+
+	if buf.keys[el.Key] == el.ID {
+		delete(buf.keys, el.Key)
+	}
+
+	s := sequence{origin: el.Origin, epoch: el.SeqEpoch, seq: el.Seq}
+	if buf.sequences[s] == el.ID {
+		delete(buf.sequences, s)
 	}
 }
 
 // contains returns a boolean representing if given element already exists in buffer or not
 // and an int representing element position in buffer.
 func (buf *Buffer) contains(el Element) (bool, int) {
+	// with the index, the element is searched by its timestamp, since the
+	// elements are ordered from the newest to the oldest
+	if buf.index != nil {
+		indexed, ok := buf.index[el.ID]
+		if !ok {
+			return false, -1
+		}
+
+		first := sort.Search(buf.Len, func(i int) bool {
+			return !buf.Elements[i].Timestamp.After(indexed.Timestamp)
+		})
+
+		for i := first; i < buf.Len && buf.Elements[i].Timestamp.Equal(indexed.Timestamp); i++ {
+			if buf.Elements[i].ID == el.ID {
+				return true, i
+			}
+		}
+	}
+
 	for i := 0; i < buf.Len; i++ {
 		if buf.Elements[i].ID == el.ID {
 			return true, i
@@ -56,14 +149,54 @@ func (buf *Buffer) contains(el Element) (bool, int) {
 	return false, -1
 }
 
-// elementPosition gets the element position in buffer.
-func (buf *Buffer) elementPosition(el Element) (int, error) {
+// has returns true if the element with given ID is in buffer.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) has(id string) bool {
+	if buf.index != nil {
+		_, ok := buf.index[id]
+		return ok
+	}
+
+	found, _ := buf.contains(Element{ID: id})
+
+	return found
+}
+
+// hasSequence returns true if an element with the same sequence number from
+// the same origin as given element is in buffer, e.g. a retransmission of
+// the same message with another ID. The fragments have the sequence number
+// of their message, so they are not compared.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) hasSequence(el Element) bool {
+	if el.Seq == 0 || el.Fragment != nil {
+		return false
+	}
+
+	if buf.index != nil {
+		_, ok := buf.sequences[sequence{origin: el.Origin, epoch: el.SeqEpoch, seq: el.Seq}]
+		return ok
+	}
+
 	for i := 0; i < buf.Len; i++ {
-		if el.Timestamp.String() >= buf.Elements[i].Timestamp.String() {
-			return i, nil
+		if buf.Elements[i].Fragment == nil && buf.Elements[i].SameSequence(el) {
+			return true
 		}
 	}
 
+	return false
+}
+
+// elementPosition gets the element position in buffer, by binary search,
+// since the elements are ordered from the newest to the oldest.
+func (buf *Buffer) elementPosition(el Element) (int, error) {
+	pos := sort.Search(buf.Len, func(i int) bool {
+		return !el.Timestamp.Before(buf.Elements[i].Timestamp)
+	})
+
+	if pos < buf.Len {
+		return pos, nil
+	}
+
 	if buf.Len < len(buf.Elements) {
 		return buf.Len, nil
 	}
@@ -91,43 +224,454 @@ func (buf *Buffer) shiftElements(index int) error {
 }
 
 // Add adds the given element in buffer.
+// If the buffer is full, the oldest element is dropped.
 func (buf *Buffer) Add(el Element) error {
 	buf.Mux.Lock()
 	defer buf.Mux.Unlock()
 
-	if e, _ := buf.contains(el); e {
-		return errAlreadyExists
+	return buf.add(el)
+}
+
+// AddIfNotFull adds the given element in buffer.
+// It returns ErrFull if the buffer is full.
+func (buf *Buffer) AddIfNotFull(el Element) error {
+	buf.Mux.Lock()
+	defer buf.Mux.Unlock()
+
+	if buf.Len >= len(buf.Elements) || !buf.fits(el.Size()) {
+		return ErrFull
+	}
+
+	return buf.add(el)
+}
+
+// AddAll adds the given elements in buffer, under a single lock, so readers
+// see all of them or none. If the buffer is full, the oldest elements are
+// dropped. If an element can't be added, it returns its error and the buffer
+// is left unchanged: none of the elements is added and none is dropped.
+func (buf *Buffer) AddAll(els []Element) error {
+	buf.Mux.Lock()
+	defer buf.Mux.Unlock()
+
+	return buf.addAll(els)
+}
+
+// AddAllIfNotFull adds the given elements in buffer, under a single lock.
+// It returns ErrFull, without adding any element, if not all of them fit.
+func (buf *Buffer) AddAllIfNotFull(els []Element) error {
+	buf.Mux.Lock()
+	defer buf.Mux.Unlock()
+
+	size := 0
+	for _, el := range els {
+		size += el.Size()
+	}
+
+	if buf.Len+len(els) > len(buf.Elements) || !buf.fits(size) {
+		return ErrFull
+	}
+
+	return buf.addAll(els)
+}
+
+// addAll adds the given elements in buffer. If an element can't be added, the
+// elements added before it are removed and the elements dropped to make room
+// for them are restored.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) addAll(els []Element) error {
+	dropped := []Element{}
+
+	for i, el := range els {
+		evicted, err := buf.insert(el)
+		dropped = append(dropped, evicted...)
+
+		if err != nil {
+			buf.rollback(els[:i], dropped)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rollback removes given added elements from buffer and restores given dropped
+// elements, which were in buffer before the added ones.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) rollback(added, dropped []Element) {
+	ids := map[string]bool{}
+
+	for _, el := range added {
+		ids[el.ID] = true
+
+		if found, pos := buf.contains(el); found {
+			buf.remove(pos)
+		}
+	}
+
+	// the added elements can be dropped by the elements added after them, and
+	// the restored elements fit, since the added ones are removed
+	for _, el := range dropped {
+		if !ids[el.ID] {
+			_ = buf.add(el)
+		}
+	}
+}
+
+// add adds the given element in buffer.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) add(el Element) error {
+	_, err := buf.insert(el)
+
+	return err
+}
+
+// insert adds the given element in buffer. It returns the elements dropped to
+// make room for it, even if the element is not added.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) insert(el Element) ([]Element, error) {
+	if buf.has(el.ID) || buf.hasSequence(el) {
+		return nil, errAlreadyExists
+	}
+
+	size := el.Size()
+
+	dropped, err := buf.makeRoom(el, size)
+	if err != nil {
+		return dropped, err
 	}
 
 	pos, err := buf.elementPosition(el)
 	if err != nil {
-		return err
+		return dropped, err
+	}
+
+	// the oldest element is dropped when the buffer is full
+	oldest := buf.Elements[len(buf.Elements)-1]
+	if buf.Len == len(buf.Elements) {
+		buf.forgetSize(oldest.ID)
 	}
 
 	if err := buf.shiftElements(pos); err != nil {
-		return err
+		return dropped, err
 	}
 
 	buf.Elements[pos] = el
-	buf.Len++
+	buf.digest = nil
 
-	return nil
+	if buf.Len == len(buf.Elements) {
+		buf.unindexElement(oldest)
+
+		dropped = append(dropped, oldest)
+	}
+
+	buf.indexElement(el)
+
+	if buf.sizes == nil {
+		buf.sizes = map[string]int{}
+	}
+
+	buf.sizes[el.ID] = size
+	buf.bytes += size
+
+	if buf.Len < len(buf.Elements) {
+		buf.Len++
+	}
+
+	return dropped, nil
 }
 
-// Digest returns a slice with elements ids.
-func (buf *Buffer) Digest() []string {
+// SetMaxBytes sets the maximum approximate size of the elements from buffer.
+// When it is exceeded, the oldest elements are dropped. 0 means no limit.
+func (buf *Buffer) SetMaxBytes(maxBytes int) {
+	buf.Mux.Lock()
+	defer buf.Mux.Unlock()
+
+	buf.maxBytes = maxBytes
+}
+
+// Bytes returns the approximate size of the elements from buffer.
+func (buf *Buffer) Bytes() int {
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
+
+	return buf.bytes
+}
+
+// fits returns true if an element with given size fits in the byte limit.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) fits(size int) bool {
+	return buf.maxBytes <= 0 || buf.bytes+size <= buf.maxBytes
+}
+
+// forgetSize removes the size of the element with given ID from the size of buffer.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) forgetSize(id string) {
+	buf.bytes -= buf.sizes[id]
+	delete(buf.sizes, id)
+}
+
+// makeRoom drops the elements older than given element until it fits in the
+// byte limit, and returns the dropped elements. It returns errTooOldElement if
+// the element doesn't fit.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) makeRoom(el Element, size int) ([]Element, error) {
+	if buf.maxBytes <= 0 {
+		return nil, nil
+	}
+
+	if size > buf.maxBytes {
+		return nil, errTooLargeElement
+	}
+
+	dropped := []Element{}
+
+	for !buf.fits(size) {
+		oldest := buf.Len - 1
+		if oldest < 0 || el.Timestamp.Before(buf.Elements[oldest].Timestamp) {
+			return dropped, errTooOldElement
+		}
+
+		dropped = append(dropped, buf.Elements[oldest])
+		buf.remove(oldest)
+	}
+
+	return dropped, nil
+}
+
+// Upsert adds the given keyed element in buffer, replacing the message with the
+// same key if the given element wins against it. It returns the replaced element
+// and true, or ErrStale if the given element loses. Fragments are simply added.
+func (buf *Buffer) Upsert(el Element, wins func(el, existing Element) bool) (Element, bool, error) {
+	buf.Mux.Lock()
+	defer buf.Mux.Unlock()
+
+	if el.Key == "" || !el.IsMessage() {
+		return Element{}, false, buf.add(el)
+	}
+
+	if buf.has(el.ID) {
+		return Element{}, false, errAlreadyExists
+	}
+
+	if buf.index != nil {
+		return buf.upsertIndexed(el, wins)
+	}
+
+	for i := 0; i < buf.Len; i++ {
+		existing := buf.Elements[i]
+		if existing.Key != el.Key || !existing.IsMessage() {
+			continue
+		}
+
+		if !wins(el, existing) {
+			return existing, false, ErrStale
+		}
+
+		buf.remove(i)
+
+		return existing, true, buf.add(el)
+	}
+
+	return Element{}, false, buf.add(el)
+}
+
+// upsertIndexed is Upsert for buffers with index, which finds the message with
+// the same key in constant time.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) upsertIndexed(el Element, wins func(el, existing Element) bool) (Element, bool, error) {
+	id, ok := buf.keys[el.Key]
+	if !ok {
+		return Element{}, false, buf.add(el)
+	}
+
+	existing := buf.index[id]
+	if !wins(el, existing) {
+		return existing, false, ErrStale
+	}
+
+	if _, pos := buf.contains(existing); pos >= 0 {
+		buf.remove(pos)
+	}
+
+	return existing, true, buf.add(el)
+}
+
+// Remove removes the element with given ID from buffer.
+// It returns false if the buffer doesn't contain such element.
+func (buf *Buffer) Remove(id string) bool {
 	buf.Mux.Lock()
 	defer buf.Mux.Unlock()
 
-	d := make([]string, buf.Len)
+	found, pos := buf.contains(Element{ID: id})
+	if !found {
+		return false
+	}
+
+	buf.remove(pos)
+
+	return true
+}
+
+// RemoveFragments removes the fragments of the message with given ID from buffer.
+// It returns the number of removed fragments.
+func (buf *Buffer) RemoveFragments(id string) int {
+	buf.Mux.Lock()
+	defer buf.Mux.Unlock()
+
+	removed := 0
+
+	for i := buf.Len - 1; i >= 0; i-- {
+		if f := buf.Elements[i].Fragment; f != nil && f.Group == id {
+			buf.remove(i)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// RemoveOlderThan removes the elements added before given time from buffer.
+// Tombstones are kept, since they expire on their own. It returns the IDs of
+// the removed elements.
+func (buf *Buffer) RemoveOlderThan(t time.Time) []string {
+	buf.Mux.Lock()
+	defer buf.Mux.Unlock()
+
+	removed := []string{}
+
+	for i := buf.Len - 1; i >= 0; i-- {
+		if el := buf.Elements[i]; el.Tombstone == "" && el.Timestamp.Before(t) {
+			removed = append(removed, el.ID)
+			buf.remove(i)
+		}
+	}
+
+	return removed
+}
+
+// remove removes the element from given position.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) remove(pos int) {
+	buf.digest = nil
+	buf.forgetSize(buf.Elements[pos].ID)
+	buf.unindexElement(buf.Elements[pos])
+
+	copy(buf.Elements[pos:buf.Len], buf.Elements[pos+1:buf.Len])
+	buf.Elements[buf.Len-1] = Element{}
+	buf.Len--
+
+	// wake up whoever waits for free space
+	if buf.freed != nil {
+		close(buf.freed)
+	}
+
+	buf.freed = make(chan struct{})
+}
+
+// Freed returns a channel which is closed when elements are removed from buffer.
+func (buf *Buffer) Freed() <-chan struct{} {
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
+
+	return buf.freed
+}
+
+// Digest returns a slice with elements ids.
+// Reassembled elements are not part of digest, since their fragments are.
+func (buf *Buffer) Digest() []string {
+	buf.Mux.RLock()
+	d := buf.digest
+	buf.Mux.RUnlock()
+
+	if d == nil {
+		buf.Mux.Lock()
+		d = buf.cachedDigest()
+		buf.Mux.Unlock()
+	}
+
+	return append(make([]string, 0, len(d)), d...)
+}
+
+// GossipDigest returns the IDs of the elements which are still gossiped: the
+// elements gossiped in fewer rounds than their MaxGossipCount or, if they
+// don't have one, than given max gossip count. 0 means no limit.
+// Reassembled elements are not part of digest, since their fragments are.
+func (buf *Buffer) GossipDigest(maxGossipCount int64) []string {
+	return buf.GossipDigestFor(maxGossipCount, nil)
+}
+
+// GossipDigestFor returns the IDs of the elements which are still gossiped
+// and are accepted by given func. A nil func accepts all elements.
+func (buf *Buffer) GossipDigestFor(maxGossipCount int64, accept func(Element) bool) []string {
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
+
+	d := make([]string, 0, buf.Len)
 
 	for i := 0; i < buf.Len; i++ {
-		d[i] = buf.Elements[i].ID
+		el := buf.Elements[i]
+		if el.Reassembled || (accept != nil && !accept(el)) {
+			continue
+		}
+
+		limit := maxGossipCount
+		if el.MaxGossipCount > 0 {
+			limit = el.MaxGossipCount
+		}
+
+		if limit == 0 || el.GossipCount < limit {
+			d = append(d, el.ID)
+		}
 	}
 
 	return d
 }
 
+// cachedDigest returns the cached digest, computing it if the buffer changed.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) cachedDigest() []string {
+	if buf.digest == nil {
+		buf.digest = buf.ids()
+	}
+
+	return buf.digest
+}
+
+// ids returns the IDs of the elements from buffer, without the reassembled ones.
+// Important! Whoever calls this function must LOCK the buffer.
+func (buf *Buffer) ids() []string {
+	d := make([]string, 0, buf.Len)
+
+	for i := 0; i < buf.Len; i++ {
+		if !buf.Elements[i].Reassembled {
+			d = append(d, buf.Elements[i].ID)
+		}
+	}
+
+	return d
+}
+
+// Missing returns the IDs from given digest which are not in buffer.
+// It runs in linear time in the length of given digest.
+func (buf *Buffer) Missing(digest []string) []string {
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
+
+	if buf.index == nil {
+		return MissingStrings(digest, buf.ids())
+	}
+
+	missing := make([]string, 0, len(digest))
+
+	for _, id := range digest {
+		if el, ok := buf.index[id]; !ok || el.Reassembled {
+			missing = append(missing, id)
+		}
+	}
+
+	return missing
+}
+
 // IncrementGossipCount increments gossip count for each elements from buffer.
 func (buf *Buffer) IncrementGossipCount() {
 	buf.Mux.Lock()
@@ -137,42 +681,182 @@ func (buf *Buffer) IncrementGossipCount() {
 		if buf.Elements[i].GossipCount < math.MaxInt64 {
 			buf.Elements[i].GossipCount++
 		}
+
+		if buf.index != nil {
+			buf.index[buf.Elements[i].ID] = buf.Elements[i]
+		}
 	}
 }
 
 // Messages returns a slice with messages for each element in buffer.
+// Fragments and tombstones are skipped, since they are not whole messages.
 func (buf *Buffer) Messages() []interface{} {
-	buf.Mux.Lock()
-	defer buf.Mux.Unlock()
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
 
-	m := make([]interface{}, buf.Len)
+	m := make([]interface{}, 0, buf.Len)
 
 	for i := 0; i < buf.Len; i++ {
-		m[i] = buf.Elements[i].Msg
+		if buf.Elements[i].IsMessage() {
+			m = append(m, buf.Elements[i].Msg)
+		}
 	}
 
 	return m
 }
 
+// Get returns the element with given ID, in constant time.
+// It returns false if the buffer doesn't contain such element.
+func (buf *Buffer) Get(id string) (Element, bool) {
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
+
+	el, ok := buf.index[id]
+
+	return el, ok
+}
+
+// All returns a copy of all elements from buffer.
+func (buf *Buffer) All() []Element {
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
+
+	el := make([]Element, buf.Len)
+	copy(el, buf.Elements[:buf.Len])
+
+	return el
+}
+
+// ElementsByType returns a slice with elements of given callback type.
+// Fragments and tombstones are skipped, since they are not whole messages.
+func (buf *Buffer) ElementsByType(cbType string) []Element {
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
+
+	el := []Element{}
+
+	for i := 0; i < buf.Len; i++ {
+		if buf.Elements[i].IsMessage() && buf.Elements[i].CallbackType == cbType {
+			el = append(el, buf.Elements[i])
+		}
+	}
+
+	return el
+}
+
+// ElementsAfter returns at most limit elements, created after the element with given
+// timestamp and ID, ordered by timestamp and ID. Fragments and tombstones are skipped,
+// since they are not whole messages. It returns true if there are more such elements.
+func (buf *Buffer) ElementsAfter(t time.Time, id string, limit int) ([]Element, bool) {
+	buf.Mux.RLock()
+
+	el := []Element{}
+
+	for i := 0; i < buf.Len; i++ {
+		e := buf.Elements[i]
+		if !e.IsMessage() {
+			continue
+		}
+
+		if e.Timestamp.After(t) || (e.Timestamp.Equal(t) && e.ID > id) {
+			el = append(el, e)
+		}
+	}
+
+	buf.Mux.RUnlock()
+
+	sort.Slice(el, func(i, j int) bool {
+		if el[i].Timestamp.Equal(el[j].Timestamp) {
+			return el[i].ID < el[j].ID
+		}
+
+		return el[i].Timestamp.Before(el[j].Timestamp)
+	})
+
+	if len(el) > limit {
+		return el[:limit], true
+	}
+
+	return el, false
+}
+
+// ElementsSince returns the elements created after given time, ordered from
+// the oldest to the newest. Fragments and tombstones are skipped, since they
+// are not whole messages. Only the elements after given time are visited.
+func (buf *Buffer) ElementsSince(t time.Time) []Element {
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
+
+	// the elements are ordered from the newest to the oldest
+	end := sort.Search(buf.Len, func(i int) bool {
+		return !buf.Elements[i].Timestamp.After(t)
+	})
+
+	el := []Element{}
+
+	for i := end - 1; i >= 0; i-- {
+		if buf.Elements[i].IsMessage() {
+			el = append(el, buf.Elements[i])
+		}
+	}
+
+	return el
+}
+
+// ElementsPage returns at most limit elements, skipping the first offset
+// elements, ordered from the oldest to the newest. Fragments and tombstones
+// are skipped and not counted, since they are not whole messages.
+func (buf *Buffer) ElementsPage(offset, limit int) []Element {
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
+
+	el := []Element{}
+
+	for i := buf.Len - 1; i >= 0 && len(el) < limit; i-- {
+		if !buf.Elements[i].IsMessage() {
+			continue
+		}
+
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		el = append(el, buf.Elements[i])
+	}
+
+	return el
+}
+
 // Length returns number of elements in buffer.
 func (buf *Buffer) Length() int {
-	buf.Mux.Lock()
-	defer buf.Mux.Unlock()
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
 
 	l := buf.Len
 
 	return l
 }
 
-// ElementsFromIDs returns a slice with elements from given IDs list.
+// ElementsFromIDs returns a slice with elements from given IDs list, in the
+// order of buffer. IDs which are not in buffer are skipped and repeated IDs are
+// returned once, since the list is sent by peers.
 func (buf *Buffer) ElementsFromIDs(digest []string) []Element {
-	buf.Mux.Lock()
-	defer buf.Mux.Unlock()
+	buf.Mux.RLock()
+	defer buf.Mux.RUnlock()
+
+	wanted := make(map[string]struct{}, len(digest))
+
+	for _, id := range digest {
+		if buf.index == nil || buf.has(id) {
+			wanted[id] = struct{}{}
+		}
+	}
 
 	el := []Element{}
 
-	for i := 0; i < buf.Len; i++ {
-		if ContainsString(digest, buf.Elements[i].ID) {
+	for i := 0; i < buf.Len && len(el) < len(wanted); i++ {
+		if _, ok := wanted[buf.Elements[i].ID]; ok {
 			el = append(el, buf.Elements[i])
 		}
 	}
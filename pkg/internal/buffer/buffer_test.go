@@ -18,7 +18,10 @@ package buffer
 
 import (
 	"math"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -40,7 +43,7 @@ var _ = Describe("Buffer interface", func() {
 		fullBuf := &Buffer{
 			Elements: make([]Element, 4),
 			Len:      4,
-			Mux:      &sync.Mutex{},
+			Mux:      &sync.RWMutex{},
 		}
 		fullBuf.Elements[0] = Element{Timestamp: time.Date(2018, time.October, 29, 0, 0, 0, 0, time.UTC)}
 		fullBuf.Elements[1] = Element{Timestamp: time.Date(2016, time.October, 29, 0, 0, 0, 0, time.UTC)}
@@ -50,7 +53,7 @@ var _ = Describe("Buffer interface", func() {
 		halfBuf := &Buffer{
 			Elements: make([]Element, 4),
 			Len:      2,
-			Mux:      &sync.Mutex{},
+			Mux:      &sync.RWMutex{},
 		}
 		halfBuf.Elements[0] = Element{Timestamp: time.Date(2016, time.October, 29, 0, 0, 0, 0, time.UTC)}
 		halfBuf.Elements[1] = Element{Timestamp: time.Date(2014, time.October, 29, 0, 0, 0, 0, time.UTC)}
@@ -113,7 +116,7 @@ var _ = Describe("Buffer interface", func() {
 				buf = &Buffer{
 					Elements: make([]Element, 4),
 					Len:      4,
-					Mux:      &sync.Mutex{},
+					Mux:      &sync.RWMutex{},
 				}
 				buf.Elements[0] = Element{Timestamp: time.Date(2018, time.October, 29, 0, 0, 0, 0, time.UTC)}
 				buf.Elements[1] = Element{Timestamp: time.Date(2016, time.October, 29, 0, 0, 0, 0, time.UTC)}
@@ -173,7 +176,7 @@ var _ = Describe("Buffer interface", func() {
 				buf = &Buffer{
 					Elements: make([]Element, 4),
 					Len:      3,
-					Mux:      &sync.Mutex{},
+					Mux:      &sync.RWMutex{},
 				}
 				buf.Elements[0] = Element{Timestamp: time.Date(2018, time.October, 29, 0, 0, 0, 0, time.UTC)}
 				buf.Elements[1] = Element{Timestamp: time.Date(2016, time.October, 29, 0, 0, 0, 0, time.UTC)}
@@ -220,7 +223,7 @@ var _ = Describe("Buffer interface", func() {
 				buf = &Buffer{
 					Elements: make([]Element, 4),
 					Len:      1,
-					Mux:      &sync.Mutex{},
+					Mux:      &sync.RWMutex{},
 				}
 				buf.Elements[0] = Element{Timestamp: time.Date(2018, time.October, 29, 0, 0, 0, 0, time.UTC)}
 
@@ -243,7 +246,7 @@ var _ = Describe("Buffer interface", func() {
 			buf = &Buffer{
 				Elements: make([]Element, 4),
 				Len:      4,
-				Mux:      &sync.Mutex{},
+				Mux:      &sync.RWMutex{},
 			}
 			buf.Elements[0] = Element{
 				Timestamp: time.Date(2018, time.October, 29, 0, 0, 0, 0, time.UTC),
@@ -300,6 +303,157 @@ var _ = Describe("Buffer interface", func() {
 
 			Expect(buf.Add(el)).To(MatchError(errAlreadyExists))
 		})
+
+		It("returns error when buffer contains an element with the same sequence number", func() {
+			buf.Elements[1].Origin = "localhost:1"
+			buf.Elements[1].Seq = 7
+			buf.Elements[1].SeqEpoch = 1
+
+			el := Element{
+				Timestamp: time.Date(2017, time.October, 29, 0, 0, 0, 0, time.UTC),
+				ID:        "2017",
+				Origin:    "localhost:1",
+				Seq:       7,
+				SeqEpoch:  1,
+			}
+
+			Expect(buf.Add(el)).To(MatchError(errAlreadyExists))
+
+			el.SeqEpoch = 2
+			Expect(buf.Add(el)).To(Succeed())
+		})
+
+		It("doesn't increment the length when buffer is full", func() {
+			el := Element{
+				Timestamp: time.Date(2019, time.October, 29, 0, 0, 0, 0, time.UTC),
+				ID:        "2019",
+			}
+
+			Expect(buf.Add(el)).To(Succeed())
+			Expect(buf.Len).To(Equal(4))
+			Expect(buf.Digest()).To(Equal([]string{"2019", "2018", "2016", "2014"}))
+		})
+	})
+
+	Describe("AddIfNotFull function", func() {
+		It("returns error when buffer is full", func() {
+			buf := NewBuffer(1)
+			Expect(buf.AddIfNotFull(Element{ID: "first", Timestamp: time.Now()})).To(Succeed())
+			Expect(buf.AddIfNotFull(Element{ID: "second", Timestamp: time.Now()})).To(MatchError(ErrFull))
+			Expect(buf.Digest()).To(Equal([]string{"first"}))
+		})
+	})
+
+	Describe("AddAll function", func() {
+		It("adds all the elements and drops the oldest ones", func() {
+			now := time.Now()
+			buf := NewBuffer(2)
+
+			Expect(buf.AddAll([]Element{
+				{ID: "1", Timestamp: now},
+				{ID: "2", Timestamp: now.Add(time.Second)},
+				{ID: "3", Timestamp: now.Add(2 * time.Second)},
+			})).To(Succeed())
+			Expect(buf.Digest()).To(Equal([]string{"3", "2"}))
+		})
+
+		It("adds no element when one of them can't be added", func() {
+			now := time.Now()
+			buf := NewBuffer(4)
+			Expect(buf.Add(Element{ID: "1", Timestamp: now})).To(Succeed())
+
+			Expect(buf.AddAll([]Element{
+				{ID: "2", Timestamp: now.Add(time.Second)},
+				{ID: "1", Timestamp: now},
+			})).To(MatchError(errAlreadyExists))
+			Expect(buf.Digest()).To(Equal([]string{"1"}))
+
+			Expect(buf.AddAllIfNotFull([]Element{
+				{ID: "3", Timestamp: now.Add(time.Second)},
+				{ID: "3", Timestamp: now.Add(time.Second)},
+			})).To(MatchError(errAlreadyExists))
+			Expect(buf.Digest()).To(Equal([]string{"1"}))
+		})
+
+		It("restores the dropped elements when one of them can't be added", func() {
+			now := time.Now()
+			buf := NewBuffer(2)
+			Expect(buf.Add(Element{ID: "1", Timestamp: now})).To(Succeed())
+			Expect(buf.Add(Element{ID: "2", Timestamp: now.Add(time.Second)})).To(Succeed())
+
+			// the first elements of the batch drop the elements from the full
+			// buffer, and each other
+			Expect(buf.AddAll([]Element{
+				{ID: "3", Timestamp: now.Add(2 * time.Second)},
+				{ID: "4", Timestamp: now.Add(3 * time.Second)},
+				{ID: "5", Timestamp: now.Add(4 * time.Second)},
+				{ID: "5", Timestamp: now.Add(4 * time.Second)},
+			})).To(MatchError(errAlreadyExists))
+			Expect(buf.Digest()).To(Equal([]string{"2", "1"}))
+			Expect(buf.ElementsFromIDs([]string{"1", "2"})).To(HaveLen(2))
+		})
+
+		It("restores the elements dropped over the byte limit when one of them can't be added", func() {
+			now := time.Now()
+			first := Element{ID: "1", Timestamp: now, Msg: "first"}
+
+			buf := NewBuffer(4)
+			buf.SetMaxBytes(first.Size())
+			Expect(buf.Add(first)).To(Succeed())
+
+			Expect(buf.AddAll([]Element{
+				{ID: "2", Timestamp: now.Add(time.Second), Msg: "secnd"},
+				{ID: "2", Timestamp: now.Add(time.Second), Msg: "secnd"},
+			})).To(MatchError(errAlreadyExists))
+			Expect(buf.Digest()).To(Equal([]string{"1"}))
+			Expect(buf.Bytes()).To(Equal(first.Size()))
+		})
+	})
+
+	Describe("AddAllIfNotFull function", func() {
+		It("adds no element when not all of them fit", func() {
+			now := time.Now()
+			buf := NewBuffer(2)
+			Expect(buf.Add(Element{ID: "1", Timestamp: now})).To(Succeed())
+
+			Expect(buf.AddAllIfNotFull([]Element{
+				{ID: "2", Timestamp: now},
+				{ID: "3", Timestamp: now},
+			})).To(MatchError(ErrFull))
+			Expect(buf.Digest()).To(Equal([]string{"1"}))
+
+			Expect(buf.AddAllIfNotFull([]Element{{ID: "2", Timestamp: now}})).To(Succeed())
+			Expect(buf.Length()).To(Equal(2))
+		})
+	})
+
+	Describe("Remove function", func() {
+		var buf *Buffer
+
+		BeforeEach(func() {
+			buf = NewBuffer(4)
+			for _, id := range []string{"2012", "2014", "2016"} {
+				year, _ := strconv.Atoi(id)
+				Expect(buf.Add(Element{
+					ID:        id,
+					Timestamp: time.Date(year, time.October, 29, 0, 0, 0, 0, time.UTC),
+				})).To(Succeed())
+			}
+		})
+
+		It("removes the element from buffer and notifies waiters", func() {
+			freed := buf.Freed()
+			Expect(buf.Remove("2014")).To(BeTrue())
+			Expect(buf.Digest()).To(Equal([]string{"2016", "2012"}))
+			Expect(freed).To(BeClosed())
+		})
+
+		It("returns false when buffer doesn't contain the element", func() {
+			freed := buf.Freed()
+			Expect(buf.Remove("2010")).To(BeFalse())
+			Expect(buf.Length()).To(Equal(3))
+			Expect(freed).NotTo(BeClosed())
+		})
 	})
 
 	Describe("Digest function", func() {
@@ -307,7 +461,7 @@ var _ = Describe("Buffer interface", func() {
 			fullBuf := &Buffer{
 				Elements: make([]Element, 4),
 				Len:      4,
-				Mux:      &sync.Mutex{},
+				Mux:      &sync.RWMutex{},
 			}
 			fullBuf.Elements[0] = Element{ID: "100"}
 			fullBuf.Elements[1] = Element{ID: "110"}
@@ -323,7 +477,7 @@ var _ = Describe("Buffer interface", func() {
 			halfBuf := &Buffer{
 				Elements: make([]Element, 4),
 				Len:      2,
-				Mux:      &sync.Mutex{},
+				Mux:      &sync.RWMutex{},
 			}
 			halfBuf.Elements[0] = Element{ID: "204"}
 			halfBuf.Elements[1] = Element{ID: "201"}
@@ -332,13 +486,293 @@ var _ = Describe("Buffer interface", func() {
 
 			Expect(halfBuf.Digest()).To(ConsistOf(expectedDigest))
 		})
+
+		It("skips reassembled elements", func() {
+			buf := &Buffer{
+				Elements: make([]Element, 4),
+				Len:      3,
+				Mux:      &sync.RWMutex{},
+			}
+			buf.Elements[0] = Element{ID: "300", Reassembled: true}
+			buf.Elements[1] = Element{ID: "300-fragment-0", Fragment: &Fragment{Group: "300"}}
+			buf.Elements[2] = Element{ID: "301"}
+
+			Expect(buf.Digest()).To(Equal([]string{"300-fragment-0", "301"}))
+		})
+
+		It("returns the new digest after the buffer changed", func() {
+			buf := NewBuffer(4)
+			Expect(buf.Add(Element{ID: "400", Timestamp: time.Now()})).To(Succeed())
+			Expect(buf.Digest()).To(Equal([]string{"400"}))
+
+			digest := buf.Digest()
+			digest[0] = "changed by caller"
+			Expect(buf.Digest()).To(Equal([]string{"400"}))
+
+			Expect(buf.Add(Element{ID: "401", Timestamp: time.Now()})).To(Succeed())
+			Expect(buf.Digest()).To(ConsistOf("400", "401"))
+
+			Expect(buf.Remove("400")).To(BeTrue())
+			Expect(buf.Digest()).To(Equal([]string{"401"}))
+		})
+	})
+
+	Describe("GossipDigest function", func() {
+		It("skips the elements gossiped in too many rounds", func() {
+			buf := NewBuffer(4)
+			Expect(buf.Add(Element{ID: "old", Timestamp: time.Now(), GossipCount: 5})).To(Succeed())
+			Expect(buf.Add(Element{ID: "new", Timestamp: time.Now(), GossipCount: 1})).To(Succeed())
+			Expect(buf.Add(Element{ID: "ttl", Timestamp: time.Now(), GossipCount: 2, MaxGossipCount: 2})).To(Succeed())
+
+			Expect(buf.GossipDigest(3)).To(ConsistOf("new"))
+			Expect(buf.GossipDigest(0)).To(ConsistOf("old", "new"))
+		})
+	})
+
+	Describe("Missing function", func() {
+		It("returns the IDs which are not in buffer", func() {
+			buf := NewBuffer(4)
+			Expect(buf.Add(Element{ID: "500", Timestamp: time.Now()})).To(Succeed())
+			Expect(buf.Add(Element{ID: "501", Timestamp: time.Now(), Reassembled: true})).To(Succeed())
+
+			Expect(buf.Missing([]string{"500", "501", "502"})).To(Equal([]string{"501", "502"}))
+		})
+
+		It("returns the IDs which are not in buffer without index", func() {
+			buf := &Buffer{
+				Elements: make([]Element, 4),
+				Len:      1,
+				Mux:      &sync.RWMutex{},
+			}
+			buf.Elements[0] = Element{ID: "600"}
+
+			Expect(buf.Missing([]string{"600", "601"})).To(Equal([]string{"601"}))
+		})
+	})
+
+	Describe("Upsert function", func() {
+		newer := func(el, existing Element) bool {
+			return el.Timestamp.After(existing.Timestamp)
+		}
+
+		It("replaces the older element with the same key", func() {
+			now := time.Now()
+			buf := NewBuffer(4)
+			Expect(buf.Add(Element{ID: "other", Timestamp: now})).To(Succeed())
+
+			_, replaced, err := buf.Upsert(Element{ID: "v1", Key: "key", Timestamp: now}, newer)
+			Expect(err).To(Succeed())
+			Expect(replaced).To(BeFalse())
+
+			old, replaced, err := buf.Upsert(Element{ID: "v2", Key: "key", Timestamp: now.Add(time.Second)}, newer)
+			Expect(err).To(Succeed())
+			Expect(replaced).To(BeTrue())
+			Expect(old.ID).To(Equal("v1"))
+
+			Expect(buf.Digest()).To(ConsistOf("other", "v2"))
+		})
+
+		It("returns error when the element is older than the element with the same key", func() {
+			now := time.Now()
+			buf := NewBuffer(4)
+
+			_, _, err := buf.Upsert(Element{ID: "v2", Key: "key", Timestamp: now}, newer)
+			Expect(err).To(Succeed())
+
+			_, _, err = buf.Upsert(Element{ID: "v1", Key: "key", Timestamp: now.Add(-time.Second)}, newer)
+			Expect(err).To(MatchError(ErrStale))
+			Expect(buf.Digest()).To(ConsistOf("v2"))
+		})
+	})
+
+	Describe("indexes", func() {
+		It("finds the elements with the same timestamp", func() {
+			now := time.Now()
+			buf := NewBuffer(4)
+
+			for _, id := range []string{"a", "b", "c"} {
+				Expect(buf.Add(Element{ID: id, Timestamp: now})).To(Succeed())
+			}
+
+			Expect(buf.Remove("b")).To(BeTrue())
+			Expect(buf.Remove("b")).To(BeFalse())
+			Expect(buf.Digest()).To(ConsistOf("a", "c"))
+		})
+
+		It("forgets the keys and the sequences of the dropped elements", func() {
+			now := time.Now()
+			buf := NewBuffer(1)
+
+			Expect(buf.Add(Element{ID: "old", Timestamp: now, Key: "key", Origin: "o", Seq: 1})).To(Succeed())
+			Expect(buf.Add(Element{ID: "new", Timestamp: now.Add(time.Second)})).To(Succeed())
+			Expect(buf.Digest()).To(Equal([]string{"new"}))
+
+			Expect(buf.Add(Element{ID: "again", Timestamp: now.Add(2 * time.Second), Origin: "o", Seq: 1})).To(Succeed())
+
+			_, replaced, err := buf.Upsert(Element{ID: "v2", Key: "key", Timestamp: now.Add(3 * time.Second)},
+				func(el, existing Element) bool { return true })
+			Expect(err).To(Succeed())
+			Expect(replaced).To(BeFalse())
+		})
+	})
+
+	Describe("RemoveFragments function", func() {
+		It("removes only the fragments of given message", func() {
+			buf := NewBuffer(4)
+			Expect(buf.Add(Element{ID: "msg", Timestamp: time.Now()})).To(Succeed())
+			Expect(buf.Add(Element{ID: "msg-0", Timestamp: time.Now(), Fragment: &Fragment{Group: "msg"}})).To(Succeed())
+			Expect(buf.Add(Element{ID: "msg-1", Timestamp: time.Now(), Fragment: &Fragment{Group: "msg"}})).To(Succeed())
+			Expect(buf.Add(Element{ID: "other-0", Timestamp: time.Now(), Fragment: &Fragment{Group: "other"}})).To(Succeed())
+
+			Expect(buf.RemoveFragments("msg")).To(Equal(2))
+			Expect(buf.Digest()).To(ConsistOf("msg", "other-0"))
+		})
+	})
+
+	Describe("RemoveOlderThan function", func() {
+		It("removes the old elements, but not the tombstones", func() {
+			now := time.Now()
+			buf := NewBuffer(4)
+			Expect(buf.Add(Element{ID: "old", Timestamp: now.Add(-time.Hour)})).To(Succeed())
+			Expect(buf.Add(Element{ID: "tombstone", Timestamp: now.Add(-time.Hour), Tombstone: "msg"})).To(Succeed())
+			Expect(buf.Add(Element{ID: "new", Timestamp: now})).To(Succeed())
+
+			Expect(buf.RemoveOlderThan(now.Add(-time.Minute))).To(Equal([]string{"old"}))
+			Expect(buf.Digest()).To(ConsistOf("new", "tombstone"))
+		})
+	})
+
+	Describe("All function", func() {
+		It("returns a copy of all elements", func() {
+			buf := NewBuffer(4)
+			Expect(buf.Add(Element{ID: "first", Timestamp: time.Now()})).To(Succeed())
+
+			all := buf.All()
+			Expect(all).To(HaveLen(1))
+
+			all[0].ID = "changed"
+			Expect(buf.Digest()).To(Equal([]string{"first"}))
+		})
+	})
+
+	Describe("Get function", func() {
+		It("returns the elements from buffer", func() {
+			buf := NewBuffer(2)
+			Expect(buf.Add(Element{ID: "first", Timestamp: time.Now()})).To(Succeed())
+			Expect(buf.Add(Element{ID: "second", Timestamp: time.Now()})).To(Succeed())
+
+			buf.IncrementGossipCount()
+
+			el, ok := buf.Get("first")
+			Expect(ok).To(BeTrue())
+			Expect(el.GossipCount).To(Equal(int64(1)))
+
+			// the oldest element is dropped
+			Expect(buf.Add(Element{ID: "third", Timestamp: time.Now()})).To(Succeed())
+			_, ok = buf.Get("first")
+			Expect(ok).To(BeFalse())
+
+			Expect(buf.Remove("second")).To(BeTrue())
+			_, ok = buf.Get("second")
+			Expect(ok).To(BeFalse())
+
+			_, ok = buf.Get("third")
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	Describe("ElementsByType function", func() {
+		It("returns the elements with given callback type, without fragments", func() {
+			buf := &Buffer{
+				Elements: make([]Element, 4),
+				Len:      4,
+				Mux:      &sync.RWMutex{},
+			}
+			buf.Elements[0] = Element{ID: "400", CallbackType: "first"}
+			buf.Elements[1] = Element{ID: "401", CallbackType: "second"}
+			buf.Elements[2] = Element{ID: "402-fragment-0", CallbackType: "first", Fragment: &Fragment{Group: "402"}}
+			buf.Elements[3] = Element{ID: "403", CallbackType: "first"}
+
+			Expect(buf.ElementsByType("first")).To(Equal([]Element{buf.Elements[0], buf.Elements[3]}))
+			Expect(buf.ElementsByType("third")).To(BeEmpty())
+		})
+	})
+
+	Describe("ElementsAfter function", func() {
+		It("returns pages of elements ordered by timestamp", func() {
+			now := time.Now()
+			buf := &Buffer{
+				Elements: make([]Element, 4),
+				Len:      4,
+				Mux:      &sync.RWMutex{},
+			}
+			buf.Elements[0] = Element{ID: "503", Timestamp: now.Add(time.Second)}
+			buf.Elements[1] = Element{ID: "502", Timestamp: now}
+			buf.Elements[2] = Element{ID: "501", Timestamp: now}
+			buf.Elements[3] = Element{ID: "500-fragment-0", Timestamp: now, Fragment: &Fragment{Group: "500"}}
+
+			page, more := buf.ElementsAfter(time.Time{}, "", 2)
+			Expect(page).To(Equal([]Element{buf.Elements[2], buf.Elements[1]}))
+			Expect(more).To(BeTrue())
+
+			page, more = buf.ElementsAfter(now, "502", 2)
+			Expect(page).To(Equal([]Element{buf.Elements[0]}))
+			Expect(more).To(BeFalse())
+		})
+	})
+
+	Describe("ElementsSince function", func() {
+		It("returns the elements created after given time, from the oldest", func() {
+			now := time.Now()
+			buf := NewBuffer(8)
+
+			for i := 0; i < 4; i++ {
+				Expect(buf.Add(Element{ID: strconv.Itoa(i), Timestamp: now.Add(time.Duration(i) * time.Second)})).To(Succeed())
+			}
+
+			Expect(buf.Add(Element{ID: "fragment", Timestamp: now.Add(time.Minute), Fragment: &Fragment{}})).To(Succeed())
+
+			ids := []string{}
+			for _, el := range buf.ElementsSince(now.Add(time.Second)) {
+				ids = append(ids, el.ID)
+			}
+
+			Expect(ids).To(Equal([]string{"2", "3"}))
+		})
+	})
+
+	Describe("ElementsPage function", func() {
+		It("returns pages of elements, from the oldest", func() {
+			now := time.Now()
+			buf := NewBuffer(8)
+
+			for i := 0; i < 5; i++ {
+				Expect(buf.Add(Element{ID: strconv.Itoa(i), Timestamp: now.Add(time.Duration(i) * time.Second)})).To(Succeed())
+			}
+
+			Expect(buf.Add(Element{ID: "tombstone", Timestamp: now.Add(time.Millisecond), Tombstone: "x"})).To(Succeed())
+
+			ids := func(els []Element) []string {
+				s := []string{}
+				for _, el := range els {
+					s = append(s, el.ID)
+				}
+
+				return s
+			}
+
+			Expect(ids(buf.ElementsPage(0, 2))).To(Equal([]string{"0", "1"}))
+			Expect(ids(buf.ElementsPage(2, 2))).To(Equal([]string{"2", "3"}))
+			Expect(ids(buf.ElementsPage(4, 2))).To(Equal([]string{"4"}))
+			Expect(buf.ElementsPage(5, 2)).To(BeEmpty())
+		})
 	})
 
 	Describe("exists function", func() {
 		buf := &Buffer{
 			Elements: make([]Element, 4),
 			Len:      4,
-			Mux:      &sync.Mutex{},
+			Mux:      &sync.RWMutex{},
 		}
 		buf.Elements[0] = Element{ID: "100"}
 		buf.Elements[1] = Element{ID: "110"}
@@ -382,7 +816,7 @@ var _ = Describe("Buffer interface", func() {
 			buf := &Buffer{
 				Elements: make([]Element, 4),
 				Len:      3,
-				Mux:      &sync.Mutex{},
+				Mux:      &sync.RWMutex{},
 			}
 			buf.Elements[0] = Element{GossipCount: int64(100)}
 			buf.Elements[1] = Element{GossipCount: int64(200)}
@@ -405,7 +839,7 @@ var _ = Describe("Buffer interface", func() {
 					{GossipCount: int64(math.MaxInt64)},
 				},
 				Len: 3,
-				Mux: &sync.Mutex{},
+				Mux: &sync.RWMutex{},
 			}
 
 			expectedElements := []Element{
@@ -430,7 +864,7 @@ var _ = Describe("Buffer interface", func() {
 			buf := &Buffer{
 				Elements: make([]Element, 4),
 				Len:      4,
-				Mux:      &sync.Mutex{},
+				Mux:      &sync.RWMutex{},
 			}
 			buf.Elements[0] = Element{Msg: "string"}
 			buf.Elements[1] = Element{Msg: 100}
@@ -455,12 +889,27 @@ var _ = Describe("Buffer interface", func() {
 		})
 	})
 
+	Describe("Messages function with fragments", func() {
+		It("skips fragments", func() {
+			buf := &Buffer{
+				Elements: make([]Element, 4),
+				Len:      3,
+				Mux:      &sync.RWMutex{},
+			}
+			buf.Elements[0] = Element{ID: "300", Msg: "whole message", Reassembled: true}
+			buf.Elements[1] = Element{ID: "300-fragment-0", Fragment: &Fragment{Group: "300"}}
+			buf.Elements[2] = Element{ID: "301", Msg: "another message"}
+
+			Expect(buf.Messages()).To(Equal([]interface{}{"whole message", "another message"}))
+		})
+	})
+
 	Describe("Length function", func() {
 		It("returns number of elements in buffer", func() {
 			buf := &Buffer{
 				Elements: make([]Element, 4),
 				Len:      2,
-				Mux:      &sync.Mutex{},
+				Mux:      &sync.RWMutex{},
 			}
 
 			Expect(buf.Length()).To(Equal(2))
@@ -472,7 +921,7 @@ var _ = Describe("Buffer interface", func() {
 			buf := &Buffer{
 				Elements: make([]Element, 10),
 				Len:      10,
-				Mux:      &sync.Mutex{},
+				Mux:      &sync.RWMutex{},
 			}
 			buf.Elements[0] = Element{ID: "100"}
 			buf.Elements[1] = Element{ID: "101"}
@@ -495,6 +944,257 @@ var _ = Describe("Buffer interface", func() {
 			}
 
 			Expect(buf.ElementsFromIDs(digest)).To(Equal(expectedElements))
+			Expect(NewBuffer(4).ElementsFromIDs(digest)).To(BeEmpty())
+		})
+
+		It("returns elements from the index of buffer", func() {
+			buf := NewBuffer(4)
+			Expect(buf.Add(Element{ID: "700", Timestamp: time.Now()})).To(Succeed())
+			Expect(buf.Add(Element{ID: "701", Timestamp: time.Now()})).To(Succeed())
+
+			elements := buf.ElementsFromIDs([]string{"700", "702", "701"})
+			Expect(elements).To(HaveLen(2))
+			Expect(elements[0].ID).To(Equal("701"))
+			Expect(elements[1].ID).To(Equal("700"))
+		})
+
+		It("returns the elements of repeated IDs once", func() {
+			buf := NewBuffer(4)
+			Expect(buf.Add(Element{ID: "800", Timestamp: time.Now()})).To(Succeed())
+			Expect(buf.Add(Element{ID: "801", Timestamp: time.Now()})).To(Succeed())
+
+			digest := []string{}
+			for i := 0; i < 1000; i++ {
+				digest = append(digest, "800")
+			}
+
+			elements := buf.ElementsFromIDs(digest)
+			Expect(elements).To(HaveLen(1))
+			Expect(elements[0].ID).To(Equal("800"))
 		})
 	})
+
+	Describe("Bytes function", func() {
+		It("returns the size of the elements from buffer", func() {
+			buf := NewBuffer(4)
+			el1 := Element{ID: "800", Msg: "message 1", Timestamp: time.Now()}
+			el2 := Element{ID: "801", Msg: "message 2", Timestamp: time.Now()}
+
+			Expect(buf.Add(el1)).To(Succeed())
+			Expect(buf.Add(el2)).To(Succeed())
+			Expect(buf.Bytes()).To(Equal(el1.Size() + el2.Size()))
+
+			Expect(buf.Remove(el1.ID)).To(BeTrue())
+			Expect(buf.Bytes()).To(Equal(el2.Size()))
+		})
+
+		It("doesn't count the dropped elements", func() {
+			buf := NewBuffer(1)
+			el1 := Element{ID: "800", Msg: "message 1", Timestamp: time.Now()}
+			el2 := Element{ID: "801", Msg: "message 2", Timestamp: time.Now().Add(time.Second)}
+
+			Expect(buf.Add(el1)).To(Succeed())
+			Expect(buf.Add(el2)).To(Succeed())
+			Expect(buf.Bytes()).To(Equal(el2.Size()))
+		})
+	})
+
+	Describe("SetMaxBytes function", func() {
+		now := time.Now()
+		el1 := Element{ID: "900", Msg: "message 1", Timestamp: now}
+		el2 := Element{ID: "901", Msg: "message 2", Timestamp: now.Add(time.Second)}
+		el3 := Element{ID: "902", Msg: "message 3", Timestamp: now.Add(2 * time.Second)}
+
+		It("drops the oldest elements when the limit is exceeded", func() {
+			buf := NewBuffer(10)
+			buf.SetMaxBytes(el1.Size() + el2.Size())
+
+			Expect(buf.Add(el1)).To(Succeed())
+			Expect(buf.Add(el2)).To(Succeed())
+			Expect(buf.Add(el3)).To(Succeed())
+
+			Expect(buf.Digest()).To(ConsistOf(el2.ID, el3.ID))
+			Expect(buf.Bytes()).To(Equal(el2.Size() + el3.Size()))
+		})
+
+		It("returns error when the element is too old", func() {
+			buf := NewBuffer(10)
+			buf.SetMaxBytes(el2.Size() + el3.Size())
+
+			Expect(buf.Add(el2)).To(Succeed())
+			Expect(buf.Add(el3)).To(Succeed())
+			Expect(buf.Add(el1)).To(MatchError(errTooOldElement))
+		})
+
+		It("returns error when the element is larger than the limit", func() {
+			buf := NewBuffer(10)
+			buf.SetMaxBytes(el1.Size() - 1)
+
+			Expect(buf.Add(el1)).To(MatchError(errTooLargeElement))
+		})
+
+		It("reports full buffer when the element doesn't fit", func() {
+			buf := NewBuffer(10)
+			buf.SetMaxBytes(el1.Size())
+
+			Expect(buf.AddIfNotFull(el1)).To(Succeed())
+			Expect(buf.AddIfNotFull(el2)).To(MatchError(ErrFull))
+		})
+	})
+
+	It("is safe for concurrent use", func() {
+		buf := NewBuffer(1000)
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				for j := 0; j < 50; j++ {
+					el := Element{ID: strconv.Itoa(i*100 + j), Timestamp: time.Now()}
+					Expect(buf.Add(el)).To(Succeed())
+
+					buf.Digest()
+					buf.Messages()
+					buf.ElementsFromIDs([]string{el.ID})
+					buf.IncrementGossipCount()
+
+					if j%2 == 0 {
+						Expect(buf.Remove(el.ID)).To(BeTrue())
+					}
+				}
+			}(i)
+		}
+
+		wg.Wait()
+
+		Expect(buf.Length()).To(Equal(8 * 25))
+		Expect(buf.Digest()).To(HaveLen(8 * 25))
+	})
 })
+
+// newBenchmarkBuffer returns a full buffer with n elements, one second apart.
+func newBenchmarkBuffer(n int) (*Buffer, time.Time) {
+	buf := NewBuffer(n)
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < n; i++ {
+		el := Element{
+			ID:        strconv.Itoa(i),
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Key:       "key-" + strconv.Itoa(i),
+			Origin:    "localhost:1",
+			Seq:       uint64(i + 1),
+			SeqEpoch:  1,
+		}
+
+		if err := buf.Add(el); err != nil {
+			panic(err)
+		}
+	}
+
+	return buf, start.Add(time.Duration(n) * time.Second)
+}
+
+func BenchmarkAdd(b *testing.B) {
+	buf, next := newBenchmarkBuffer(10000)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		el := Element{
+			ID:        "new-" + strconv.Itoa(i),
+			Timestamp: next.Add(time.Duration(i) * time.Second),
+			Origin:    "localhost:2",
+			Seq:       uint64(i + 1),
+			SeqEpoch:  1,
+		}
+
+		if err := buf.Add(el); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRemove(b *testing.B) {
+	buf, next := newBenchmarkBuffer(10000)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		id := strconv.Itoa(i % 10000)
+		if !buf.Remove(id) {
+			b.Fatal("element not found")
+		}
+
+		b.StopTimer()
+
+		if err := buf.Add(Element{ID: id, Timestamp: next.Add(-time.Duration(i%10000) * time.Second)}); err != nil {
+			b.Fatal(err)
+		}
+
+		b.StartTimer()
+	}
+}
+
+func BenchmarkUpsert(b *testing.B) {
+	buf, next := newBenchmarkBuffer(10000)
+	newer := func(el, existing Element) bool { return el.Timestamp.After(existing.Timestamp) }
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		el := Element{
+			ID:        "new-" + strconv.Itoa(i),
+			Timestamp: next.Add(time.Duration(i) * time.Second),
+			Key:       "key-" + strconv.Itoa(i%10000),
+		}
+
+		if _, _, err := buf.Upsert(el, newer); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMissing(b *testing.B) {
+	buf, _ := newBenchmarkBuffer(10000)
+
+	digest := make([]string, 10000)
+	for i := range digest {
+		digest[i] = strconv.Itoa(i + 5000)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buf.Missing(digest)
+	}
+}
+
+func BenchmarkConcurrentAddAndMissing(b *testing.B) {
+	buf, next := newBenchmarkBuffer(10000)
+	digest := buf.Digest()
+
+	var n int64
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := atomic.AddInt64(&n, 1)
+
+			if i%2 == 0 {
+				buf.Missing(digest)
+				continue
+			}
+
+			el := Element{ID: "new-" + strconv.FormatInt(i, 10), Timestamp: next.Add(time.Duration(i) * time.Second)}
+			if err := buf.Add(el); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
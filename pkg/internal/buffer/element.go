@@ -19,6 +19,7 @@ package buffer
 import (
 	"crypto/sha1" // nolint: gosec
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"time"
@@ -26,11 +27,63 @@ import (
 
 // Element is an element from messages buffer.
 type Element struct {
-	ID           string      `json:"id"`
-	Timestamp    time.Time   `json:"timestamp"`
-	Msg          interface{} `json:"msg"`
-	CallbackType string      `json:"callback_type"`
-	GossipCount  int64       `json:"gossip_count"` // number of rounds since the element is in buffer
+	ID             string            `json:"id"`
+	Timestamp      time.Time         `json:"timestamp"`
+	Msg            interface{}       `json:"msg"`
+	CallbackType   string            `json:"callback_type"`
+	GossipCount    int64             `json:"gossip_count"`               // number of rounds since the element is in buffer
+	Blob           *BlobRef          `json:"blob,omitempty"`             // reference to the message, if it is sent out of band
+	Fragment       *Fragment         `json:"fragment,omitempty"`         // fragment of a message, if the message was fragmented
+	Reassembled    bool              `json:"reassembled,omitempty"`      // true if the message was reassembled from fragments
+	Tombstone      string            `json:"tombstone,omitempty"`        // ID of the removed message, if the element is a tombstone
+	Key            string            `json:"key,omitempty"`              // application key, if newer versions replace the message
+	Origin         string            `json:"origin,omitempty"`           // node which added the message
+	Signature      string            `json:"signature,omitempty"`        // hex encoded ed25519 signature of the message by its origin
+	MAC            string            `json:"mac,omitempty"`              // hex encoded HMAC-SHA256 of the message with the message key
+	HLC            uint64            `json:"hlc,omitempty"`              // hybrid logical clock timestamp of the message
+	Codec          string            `json:"codec,omitempty"`            // codec which encoded the message, if it is not embedded as json
+	MaxGossipCount int64             `json:"max_gossip_count,omitempty"` // number of rounds for which the message is gossiped, if it has a TTL
+	VectorClock    map[string]uint64 `json:"vector_clock,omitempty"`     // messages delivered to the origin from each node, with causal ordering
+	Seq            uint64            `json:"seq,omitempty"`              // sequence number of the message among the ordered messages of its origin
+	SeqEpoch       int64             `json:"seq_epoch,omitempty"`        // creation time of the origin, in unix nanoseconds, if the message has a sequence number
+	Priority       int               `json:"priority,omitempty"`         // priority of the message; urgent messages are pushed outside the rounds
+	Sender         string            `json:"-"`                          // origin of the message, if its signature was verified
+}
+
+// Size returns the approximate size of the element, in bytes: the size of its
+// json encoding.
+func (el Element) Size() int {
+	raw, err := json.Marshal(el)
+	if err != nil {
+		return 0
+	}
+
+	return len(raw)
+}
+
+// IsMessage returns true if the element is a whole message, not a fragment or a tombstone.
+func (el Element) IsMessage() bool {
+	return el.Fragment == nil && el.Tombstone == ""
+}
+
+// SameSequence returns true if both elements have the same sequence number
+// from the same origin.
+func (el Element) SameSequence(other Element) bool {
+	return el.Seq > 0 && el.Seq == other.Seq && el.SeqEpoch == other.SeqEpoch && el.Origin == other.Origin
+}
+
+// Fragment is a part of a fragmented message.
+type Fragment struct {
+	Group string `json:"group"` // ID of the fragmented message
+	Index int    `json:"index"` // index of the fragment
+	Total int    `json:"total"` // number of fragments
+	Data  []byte `json:"data"`  // part of the json encoded message
+}
+
+// BlobRef is a reference to a message which is fetched out of band.
+type BlobRef struct {
+	Hash string `json:"hash"` // hex encoded sha256 of the json encoded message
+	Size int    `json:"size"` // size of the json encoded message
 }
 
 // generateIDFromMsg returns an ID consisting of a hash of the original string,
@@ -0,0 +1,380 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package buffer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// storeFileMode is the mode of the log files of file stores
+	storeFileMode = 0600
+
+	// minCompactRecords is the number of records from which the log of a file store is compacted
+	minCompactRecords = 128
+
+	openStoreErrFmt = "error at opening store %s: %w"
+)
+
+var errStoreClosed = errors.New("store is closed")
+
+// Store keeps the elements of a messages buffer outside of it, so they can be
+// recovered after a restart.
+type Store interface {
+	// Put saves given element, replacing the saved element with the same ID.
+	Put(el Element) error
+	// Get returns the saved element with given ID.
+	// It returns false if the store doesn't contain such element.
+	Get(id string) (Element, bool, error)
+	// Digest returns the IDs of the saved elements, in the order they were put.
+	Digest() ([]string, error)
+	// Prune removes the elements with given IDs.
+	Prune(ids []string) error
+	// Close releases the resources of store.
+	Close() error
+}
+
+// MemoryStore is a Store which keeps the elements in memory.
+type MemoryStore struct {
+	elements map[string]Element
+	order    []string
+	mux      sync.RWMutex
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{elements: map[string]Element{}}
+}
+
+// Put saves given element, replacing the saved element with the same ID.
+func (s *MemoryStore) Put(el Element) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.put(el)
+
+	return nil
+}
+
+// put saves given element.
+// Important! Whoever calls this function must LOCK the store.
+func (s *MemoryStore) put(el Element) {
+	if _, ok := s.elements[el.ID]; !ok {
+		s.order = append(s.order, el.ID)
+	}
+
+	s.elements[el.ID] = el
+}
+
+// Get returns the saved element with given ID.
+func (s *MemoryStore) Get(id string) (Element, bool, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	el, ok := s.elements[id]
+
+	return el, ok, nil
+}
+
+// Digest returns the IDs of the saved elements, in the order they were put.
+func (s *MemoryStore) Digest() ([]string, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return append(make([]string, 0, len(s.order)), s.order...), nil
+}
+
+// Prune removes the elements with given IDs.
+func (s *MemoryStore) Prune(ids []string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.prune(ids)
+
+	return nil
+}
+
+// prune removes the elements with given IDs.
+// Important! Whoever calls this function must LOCK the store.
+func (s *MemoryStore) prune(ids []string) {
+	removed := 0
+
+	for _, id := range ids {
+		if _, ok := s.elements[id]; ok {
+			delete(s.elements, id)
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return
+	}
+
+	order := make([]string, 0, len(s.elements))
+
+	for _, id := range s.order {
+		if _, ok := s.elements[id]; ok {
+			order = append(order, id)
+		}
+	}
+
+	s.order = order
+}
+
+// Close does nothing, since the elements are kept in memory.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// storeRecord is a record from the log of a file store.
+type storeRecord struct {
+	Put   *Element `json:"put,omitempty"`
+	Prune []string `json:"prune,omitempty"`
+}
+
+// FileStore is a Store which appends its changes to a log file, so the
+// elements survive crashes. The log is replayed when the store is opened and
+// it is compacted when most of its records are obsolete.
+type FileStore struct {
+	path    string
+	file    *os.File
+	memory  *MemoryStore
+	records int
+	mux     sync.Mutex
+}
+
+// NewFileStore opens the file store with given log file, creating it if it
+// doesn't exist. A record truncated by a crash at the end of log is dropped.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:   path,
+		memory: NewMemoryStore(),
+	}
+
+	if err := s.replay(); err != nil {
+		return nil, fmt.Errorf(openStoreErrFmt, path, err)
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, fmt.Errorf(openStoreErrFmt, path, err)
+	}
+
+	return s, nil
+}
+
+// replay applies the records from log file on the elements kept in memory.
+func (s *FileStore) replay() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close() // nolint: errcheck
+
+	r := bufio.NewReader(f)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// the last record is incomplete if the node crashed while writing it
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var rec storeRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return err
+		}
+
+		s.apply(rec)
+	}
+}
+
+// apply applies given record on the elements kept in memory.
+func (s *FileStore) apply(rec storeRecord) {
+	if rec.Put != nil {
+		s.memory.put(*rec.Put)
+	}
+
+	if len(rec.Prune) > 0 {
+		s.memory.prune(rec.Prune)
+	}
+
+	s.records++
+}
+
+// compact rewrites the log file with a record for each saved element and
+// opens it for appending.
+func (s *FileStore) compact() error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+
+		s.file = nil
+	}
+
+	tmp := s.path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, storeFileMode)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+
+	for _, id := range s.memory.order {
+		el := s.memory.elements[id]
+
+		if err := writeRecord(w, storeRecord{Put: &el}); err != nil {
+			f.Close() // nolint: errcheck
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close() // nolint: errcheck
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close() // nolint: errcheck
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, storeFileMode)
+	if err != nil {
+		return err
+	}
+
+	s.records = len(s.memory.order)
+
+	return nil
+}
+
+// writeRecord writes given record as a line of json.
+func writeRecord(w io.Writer, rec storeRecord) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(raw, '\n'))
+
+	return err
+}
+
+// append appends given record in log file and applies it.
+// Important! Whoever calls this function must LOCK the store.
+func (s *FileStore) append(rec storeRecord) error {
+	if s.file == nil {
+		return errStoreClosed
+	}
+
+	if err := writeRecord(s.file, rec); err != nil {
+		return err
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	s.apply(rec)
+
+	return nil
+}
+
+// Put saves given element, replacing the saved element with the same ID.
+func (s *FileStore) Put(el Element) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.append(storeRecord{Put: &el})
+}
+
+// Get returns the saved element with given ID.
+func (s *FileStore) Get(id string) (Element, bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.memory.Get(id)
+}
+
+// Digest returns the IDs of the saved elements, in the order they were put.
+func (s *FileStore) Digest() ([]string, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.memory.Digest()
+}
+
+// Prune removes the elements with given IDs. The log is compacted when it
+// has more obsolete records than saved elements.
+func (s *FileStore) Prune(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if err := s.append(storeRecord{Prune: ids}); err != nil {
+		return err
+	}
+
+	if s.records >= minCompactRecords && s.records > 2*len(s.memory.order) {
+		return s.compact()
+	}
+
+	return nil
+}
+
+// Close closes the log file.
+func (s *FileStore) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package buffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store interface", func() {
+	Describe("MemoryStore", func() {
+		It("puts, gets and prunes elements", func() {
+			s := NewMemoryStore()
+
+			Expect(s.Put(Element{ID: "a", Msg: "first"})).To(Succeed())
+			Expect(s.Put(Element{ID: "b", Msg: "second"})).To(Succeed())
+			Expect(s.Put(Element{ID: "a", Msg: "replaced"})).To(Succeed())
+
+			el, ok, err := s.Get("a")
+			Expect(err).To(Succeed())
+			Expect(ok).To(BeTrue())
+			Expect(el.Msg).To(Equal("replaced"))
+
+			Expect(s.Digest()).To(Equal([]string{"a", "b"}))
+
+			Expect(s.Prune([]string{"a", "unknown"})).To(Succeed())
+			Expect(s.Digest()).To(Equal([]string{"b"}))
+
+			_, ok, err = s.Get("a")
+			Expect(err).To(Succeed())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("FileStore", func() {
+		var (
+			dir  string
+			path string
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "store")
+			Expect(err).To(Succeed())
+
+			path = filepath.Join(dir, "messages.log")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir) // nolint: errcheck
+		})
+
+		It("recovers the saved elements when it is reopened", func() {
+			s, err := NewFileStore(path)
+			Expect(err).To(Succeed())
+
+			Expect(s.Put(Element{ID: "a", Msg: "first", CallbackType: "type", GossipCount: 2})).To(Succeed())
+			Expect(s.Put(Element{ID: "b", Msg: "second"})).To(Succeed())
+			Expect(s.Prune([]string{"b"})).To(Succeed())
+			Expect(s.Close()).To(Succeed())
+
+			reopened, err := NewFileStore(path)
+			Expect(err).To(Succeed())
+			defer reopened.Close() // nolint: errcheck
+
+			Expect(reopened.Digest()).To(Equal([]string{"a"}))
+
+			el, ok, err := reopened.Get("a")
+			Expect(err).To(Succeed())
+			Expect(ok).To(BeTrue())
+			Expect(el).To(Equal(Element{ID: "a", Msg: "first", CallbackType: "type", GossipCount: 2}))
+		})
+
+		It("drops a record truncated by a crash", func() {
+			s, err := NewFileStore(path)
+			Expect(err).To(Succeed())
+			Expect(s.Put(Element{ID: "a"})).To(Succeed())
+			Expect(s.Close()).To(Succeed())
+
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+			Expect(err).To(Succeed())
+			_, err = f.WriteString(`{"put":{"id":"b"`)
+			Expect(err).To(Succeed())
+			Expect(f.Close()).To(Succeed())
+
+			reopened, err := NewFileStore(path)
+			Expect(err).To(Succeed())
+			defer reopened.Close() // nolint: errcheck
+
+			Expect(reopened.Digest()).To(Equal([]string{"a"}))
+			Expect(reopened.Put(Element{ID: "c"})).To(Succeed())
+			Expect(reopened.Digest()).To(Equal([]string{"a", "c"}))
+		})
+
+		It("compacts the log when most records are obsolete", func() {
+			s, err := NewFileStore(path)
+			Expect(err).To(Succeed())
+			defer s.Close() // nolint: errcheck
+
+			for i := 0; i < minCompactRecords; i++ {
+				id := strconv.Itoa(i)
+				Expect(s.Put(Element{ID: id})).To(Succeed())
+				Expect(s.Prune([]string{id})).To(Succeed())
+			}
+
+			Expect(s.Put(Element{ID: "kept"})).To(Succeed())
+
+			raw, err := ioutil.ReadFile(path)
+			Expect(err).To(Succeed())
+			Expect(strings.Count(string(raw), "\n")).To(Equal(1))
+		})
+
+		It("fails after it is closed", func() {
+			s, err := NewFileStore(path)
+			Expect(err).To(Succeed())
+			Expect(s.Close()).To(Succeed())
+
+			Expect(s.Put(Element{ID: "a"})).To(MatchError(errStoreClosed))
+		})
+	})
+})
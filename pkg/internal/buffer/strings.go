@@ -28,11 +28,17 @@ func ContainsString(a []string, x string) bool {
 }
 
 // MissingStrings returns the disjunction between given slices: a - b.
+// It runs in linear time, using a set with the strings of b.
 func MissingStrings(a []string, b []string) []string {
+	set := make(map[string]struct{}, len(b))
+	for _, x := range b {
+		set[x] = struct{}{}
+	}
+
 	s := []string{}
 
 	for i := range a {
-		if !ContainsString(b, a[i]) {
+		if _, ok := set[a[i]]; !ok {
 			s = append(s, a[i])
 		}
 	}
@@ -76,7 +76,7 @@ func (r *CustomRegistry) RunCallbacks(m buffer.Element, logger *log.Logger) erro
 func ValidateCustomCallbacks(customCallbacks map[string]func(interface{}, *log.Logger) error) error {
 	// don't allow to use default callbacks types as custom callback types
 	for customType := range customCallbacks {
-		if _, exists := defaultCallbacks[customType]; exists {
+		if IsDefaultCallback(customType) {
 			return errNotAlowedCallbackType
 		}
 	}
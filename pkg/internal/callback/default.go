@@ -38,14 +38,16 @@ const (
 
 var (
 	// nolint: gochecknoglobals
-	defaultCallbacks = map[string]func(buffer.Element, *peer.Buffer, *log.Logger) error{
-		ADDPEER:    addPeerCallback,
-		REMOVEPEER: removePeerCallback,
+	defaultCallbacks = map[string]func(buffer.Element, *DefaultContext) error{
+		ADDPEER:      addPeerCallback,
+		REMOVEPEER:   removePeerCallback,
+		CONFIGUPDATE: configUpdateCallback,
 	}
 
 	errInvalidAddPeerMsg         = errors.New("invalid add peer message")
 	errInvalidRemovePeerMsg      = errors.New("invalid remove peer message")
 	errInexistentDefaultCallback = errors.New("callback doesn't exist in the default registry")
+	errNoConfigUpdater           = errors.New("config updates are not supported")
 )
 
 // ComposeAddPeerMessage returns a `add peer` message with given addr and port.
@@ -92,9 +94,31 @@ func DecomposeRemovePeerMessage(msg string) (string, string, error) {
 	return addr, port, nil
 }
 
+// IsDefaultCallback returns true if given callback type is a default callback type.
+func IsDefaultCallback(t string) bool {
+	_, exists := defaultCallbacks[t]
+	return exists
+}
+
+// DefaultContext contains the node resources which default callbacks may use. All
+// default callbacks receive the same context, so new default callbacks don't
+// need changes in the code which runs them.
+type DefaultContext struct {
+	// Peers is the peers buffer of the node
+	Peers *peer.Buffer
+	// Messages is the messages buffer of the node
+	Messages *buffer.Buffer
+	// Round is the gossip round in which the callbacks run
+	Round int64
+	// Logger is the callbacks logger of the node
+	Logger *log.Logger
+	// UpdateConfig applies the config update from given message on the node
+	UpdateConfig func(buffer.Element) error
+}
+
 // DefaultRegistry is a default callbacks registry.
 type DefaultRegistry struct {
-	callbacks map[string]func(buffer.Element, *peer.Buffer, *log.Logger) error
+	callbacks map[string]func(buffer.Element, *DefaultContext) error
 }
 
 // NewDefaultRegistry creates a default callback registry.
@@ -107,7 +131,7 @@ func NewDefaultRegistry() (*DefaultRegistry, error) {
 }
 
 // GetCallback returns a default callback from registry.
-func (r *DefaultRegistry) GetCallback(t string) (func(buffer.Element, *peer.Buffer, *log.Logger) error, error) {
+func (r *DefaultRegistry) GetCallback(t string) (func(buffer.Element, *DefaultContext) error, error) {
 	if v, ok := r.callbacks[t]; ok {
 		return v, nil
 	}
@@ -115,8 +139,8 @@ func (r *DefaultRegistry) GetCallback(t string) (func(buffer.Element, *peer.Buff
 	return nil, errInexistentDefaultCallback
 }
 
-// RunCallbacks runs default callbacks.
-func (r *DefaultRegistry) RunCallbacks(m buffer.Element, peerBuf *peer.Buffer, logger *log.Logger) error {
+// RunCallbacks runs default callbacks with given context.
+func (r *DefaultRegistry) RunCallbacks(m buffer.Element, cbCtx *DefaultContext) error {
 	callbackFn, err := r.GetCallback(m.CallbackType)
 	if err != nil {
 		// dont't return err if default registry haven't given callback
@@ -124,16 +148,21 @@ func (r *DefaultRegistry) RunCallbacks(m buffer.Element, peerBuf *peer.Buffer, l
 	}
 
 	// run callback function
-	if err = callbackFn(m, peerBuf, logger); err != nil {
+	if err = callbackFn(m, cbCtx); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func addPeerCallback(msg buffer.Element, peersBuf *peer.Buffer, logger *log.Logger) error {
+func addPeerCallback(msg buffer.Element, cbCtx *DefaultContext) error {
+	var payload string
+	if err := Decode(msg.Msg, &payload); err != nil {
+		return errInvalidAddPeerMsg
+	}
+
 	// extract addr and peer from `add peer` message
-	addr, port, err := DecomposeAddPeerMessage(msg.Msg.(string))
+	addr, port, err := DecomposeAddPeerMessage(payload)
 	if err != nil {
 		return err
 	}
@@ -144,18 +173,23 @@ func addPeerCallback(msg buffer.Element, peersBuf *peer.Buffer, logger *log.Logg
 		return err
 	}
 
-	if err = peersBuf.AddPeer(p); err != nil {
+	if err = cbCtx.Peers.AddPeer(p); err != nil {
 		return err
 	}
 
-	logger.Printf(peerAddedLogFmt, addr, port)
+	cbCtx.Logger.Printf(peerAddedLogFmt, addr, port)
 
 	return nil
 }
 
-func removePeerCallback(msg buffer.Element, peersBuf *peer.Buffer, logger *log.Logger) error {
+func removePeerCallback(msg buffer.Element, cbCtx *DefaultContext) error {
+	var payload string
+	if err := Decode(msg.Msg, &payload); err != nil {
+		return errInvalidRemovePeerMsg
+	}
+
 	// extract addr and peer from `remove peer` message
-	addr, port, err := DecomposeRemovePeerMessage(msg.Msg.(string))
+	addr, port, err := DecomposeRemovePeerMessage(payload)
 	if err != nil {
 		return err
 	}
@@ -166,9 +200,17 @@ func removePeerCallback(msg buffer.Element, peersBuf *peer.Buffer, logger *log.L
 		return err
 	}
 
-	peersBuf.RemovePeer(p)
+	cbCtx.Peers.RemovePeer(p)
 
-	logger.Printf(peerRemovedLogFmt, addr, port)
+	cbCtx.Logger.Printf(peerRemovedLogFmt, addr, port)
 
 	return nil
 }
+
+func configUpdateCallback(msg buffer.Element, cbCtx *DefaultContext) error {
+	if cbCtx.UpdateConfig == nil {
+		return errNoConfigUpdater
+	}
+
+	return cbCtx.UpdateConfig(msg)
+}
@@ -17,9 +17,15 @@ limitations under the License.
 package callback
 
 import (
+	"io/ioutil"
+	"log"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/peer"
 )
 
 var _ = Describe("Default Callback interface", func() {
@@ -82,4 +88,54 @@ var _ = Describe("Default Callback interface", func() {
 		Entry("message is empty", ""),
 		Entry("message doesn't contain `remove` prefix", "localhost/19999"),
 	)
+
+	It("returns error when the payload of peer messages is not a string", func() {
+		r, err := NewDefaultRegistry()
+		Expect(err).To(Succeed())
+
+		cbCtx := &DefaultContext{Peers: peer.NewPeerBuffer(), Logger: log.New(ioutil.Discard, "", 0)}
+
+		Expect(r.RunCallbacks(buffer.Element{CallbackType: ADDPEER, Msg: 7.0}, cbCtx)).
+			To(MatchError(errInvalidAddPeerMsg))
+		Expect(r.RunCallbacks(buffer.Element{CallbackType: REMOVEPEER, Msg: 7.0}, cbCtx)).
+			To(MatchError(errInvalidRemovePeerMsg))
+	})
+
+	It("runs the config update callback with the updater from context", func() {
+		r, err := NewDefaultRegistry()
+		Expect(err).To(Succeed())
+
+		m := buffer.Element{CallbackType: CONFIGUPDATE, Msg: "patch"}
+		cbCtx := &DefaultContext{Peers: peer.NewPeerBuffer(), Logger: log.New(ioutil.Discard, "", 0)}
+
+		Expect(r.RunCallbacks(m, cbCtx)).To(MatchError(errNoConfigUpdater))
+
+		var updated []buffer.Element
+		cbCtx.UpdateConfig = func(el buffer.Element) error {
+			updated = append(updated, el)
+			return nil
+		}
+
+		Expect(r.RunCallbacks(m, cbCtx)).To(Succeed())
+		Expect(updated).To(ConsistOf(m))
+	})
+
+	It("runs the default callbacks with the resources from context", func() {
+		r, err := NewDefaultRegistry()
+		Expect(err).To(Succeed())
+
+		cbCtx := &DefaultContext{Peers: peer.NewPeerBuffer(), Logger: log.New(ioutil.Discard, "", 0)}
+
+		Expect(r.RunCallbacks(buffer.Element{
+			CallbackType: ADDPEER,
+			Msg:          ComposeAddPeerMessage("localhost", "9090"),
+		}, cbCtx)).To(Succeed())
+		Expect(cbCtx.Peers.Length()).To(Equal(1))
+
+		Expect(r.RunCallbacks(buffer.Element{
+			CallbackType: REMOVEPEER,
+			Msg:          ComposeRemovePeerMessage("localhost", "9090"),
+		}, cbCtx)).To(Succeed())
+		Expect(cbCtx.Peers.Length()).To(BeZero())
+	})
 })
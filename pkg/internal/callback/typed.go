@@ -0,0 +1,165 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package callback
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+const (
+	decodePayloadErrFmt        = "error at decoding payload as %s: %w"
+	invalidTypedCallbackErrFmt = "invalid typed callback %s: %w"
+)
+
+var (
+	errInvalidTypedCallback    = errors.New("typed callback must be a func(T, *log.Logger) error")
+	errInexistentTypedCallback = errors.New("callback doesn't exist in the typed registry")
+	errNilDecodeTarget         = errors.New("payload must be decoded in a non-nil pointer")
+	errorType                  = reflect.TypeOf((*error)(nil)).Elem()
+	loggerType                 = reflect.TypeOf((*log.Logger)(nil))
+)
+
+// Decode decodes given message payload in the value pointed by v. Payloads
+// added on this node keep their Go type; payloads received from peers are
+// decoded from their json encoding.
+func Decode(msg interface{}, v interface{}) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return errNilDecodeTarget
+	}
+
+	if msg != nil && reflect.TypeOf(msg).AssignableTo(target.Elem().Type()) {
+		target.Elem().Set(reflect.ValueOf(msg))
+		return nil
+	}
+
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf(decodePayloadErrFmt, target.Elem().Type(), err)
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf(decodePayloadErrFmt, target.Elem().Type(), err)
+	}
+
+	return nil
+}
+
+// TypedCallback is a callback whose payload is decoded to its declared Go type
+// before it runs.
+type TypedCallback struct {
+	payload reflect.Type
+	fn      reflect.Value
+}
+
+// NewTypedCallback creates a TypedCallback from given func(T, *log.Logger) error.
+// The payloads are decoded to T.
+func NewTypedCallback(fn interface{}) (*TypedCallback, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, errInvalidTypedCallback
+	}
+
+	t := v.Type()
+	if t.NumIn() != 2 || t.In(1) != loggerType || t.NumOut() != 1 || t.Out(0) != errorType { // nolint: gomnd
+		return nil, errInvalidTypedCallback
+	}
+
+	return &TypedCallback{payload: t.In(0), fn: v}, nil
+}
+
+// PayloadType returns the Go type of the payloads of the callback.
+func (c *TypedCallback) PayloadType() reflect.Type {
+	return c.payload
+}
+
+// Run decodes given payload and runs the callback with it.
+func (c *TypedCallback) Run(msg interface{}, logger *log.Logger) error {
+	return c.RunDecoded(func(v interface{}) error {
+		return Decode(msg, v)
+	}, logger)
+}
+
+// RunDecoded runs the callback with the payload decoded by given func in a
+// value of the payload type.
+func (c *TypedCallback) RunDecoded(decode func(interface{}) error, logger *log.Logger) error {
+	payload := reflect.New(c.payload)
+	if err := decode(payload.Interface()); err != nil {
+		return err
+	}
+
+	out := c.fn.Call([]reflect.Value{payload.Elem(), reflect.ValueOf(logger)})
+	if err, ok := out[0].Interface().(error); ok && err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// TypedRegistry is a registry of typed callbacks.
+type TypedRegistry struct {
+	callbacks map[string]*TypedCallback
+}
+
+// NewTypedRegistry creates a typed callback registry. Each callback must be a
+// func(T, *log.Logger) error, where T is the payload type of its callback type.
+func NewTypedRegistry(cb map[string]interface{}) (*TypedRegistry, error) {
+	r := &TypedRegistry{
+		callbacks: map[string]*TypedCallback{},
+	}
+
+	for t, fn := range cb {
+		if IsDefaultCallback(t) {
+			return nil, errNotAlowedCallbackType
+		}
+
+		typed, err := NewTypedCallback(fn)
+		if err != nil {
+			return nil, fmt.Errorf(invalidTypedCallbackErrFmt, t, err)
+		}
+
+		r.callbacks[t] = typed
+	}
+
+	return r, nil
+}
+
+// GetCallback returns a typed callback from registry.
+func (r *TypedRegistry) GetCallback(t string) (*TypedCallback, error) {
+	if v, ok := r.callbacks[t]; ok {
+		return v, nil
+	}
+
+	return nil, errInexistentTypedCallback
+}
+
+// RunCallbacks decodes the payload of given message and runs its typed callback.
+func (r *TypedRegistry) RunCallbacks(m buffer.Element, logger *log.Logger) error {
+	callbackFn, err := r.GetCallback(m.CallbackType)
+	if err != nil {
+		// dont't return err if typed registry haven't given callback
+		return nil
+	}
+
+	return callbackFn.Run(m.Msg, logger)
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package callback
+
+import (
+	"errors"
+	"log"
+	"reflect"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/rstefan1/bimodal-multicast/pkg/internal/buffer"
+)
+
+type point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+var _ = Describe("Typed Callback interface", func() {
+	DescribeTable("NewTypedCallback func returns error for invalid callbacks",
+		func(fn interface{}) {
+			_, err := NewTypedCallback(fn)
+			Expect(err).To(MatchError(errInvalidTypedCallback))
+		},
+		Entry("not a func", "callback"),
+		Entry("nil func", (func(point, *log.Logger) error)(nil)),
+		Entry("without logger", func(point) error { return nil }),
+		Entry("without error", func(point, *log.Logger) {}),
+		Entry("with a wrong second argument", func(point, string) error { return nil }),
+	)
+
+	It("decodes the payloads to the type of the callback", func() {
+		var got point
+
+		cb, err := NewTypedCallback(func(p point, _ *log.Logger) error {
+			got = p
+			return nil
+		})
+		Expect(err).To(Succeed())
+		Expect(cb.PayloadType()).To(Equal(reflect.TypeOf(point{})))
+
+		Expect(cb.Run(map[string]interface{}{"x": 1.0, "y": 2.0}, nil)).To(Succeed())
+		Expect(got).To(Equal(point{X: 1, Y: 2}))
+
+		Expect(cb.Run(point{X: 3}, nil)).To(Succeed())
+		Expect(got).To(Equal(point{X: 3}))
+
+		Expect(cb.Run("not a point", nil)).NotTo(Succeed())
+	})
+
+	It("returns the error of the callback", func() {
+		errCallback := errors.New("callback error")
+
+		cb, err := NewTypedCallback(func(string, *log.Logger) error { return errCallback })
+		Expect(err).To(Succeed())
+		Expect(cb.Run("msg", nil)).To(MatchError(errCallback))
+	})
+
+	Describe("TypedRegistry", func() {
+		It("returns error for default callback types", func() {
+			_, err := NewTypedRegistry(map[string]interface{}{
+				ADDPEER: func(string, *log.Logger) error { return nil },
+			})
+			Expect(err).To(MatchError(errNotAlowedCallbackType))
+		})
+
+		It("runs the callback of the message type", func() {
+			ran := false
+
+			r, err := NewTypedRegistry(map[string]interface{}{
+				"my-callback": func(p point, _ *log.Logger) error {
+					ran = p.X == 1
+					return nil
+				},
+			})
+			Expect(err).To(Succeed())
+
+			Expect(r.RunCallbacks(buffer.Element{CallbackType: "other", Msg: 1}, nil)).To(Succeed())
+			Expect(ran).To(BeFalse())
+
+			Expect(r.RunCallbacks(buffer.Element{CallbackType: "my-callback", Msg: point{X: 1}}, nil)).To(Succeed())
+			Expect(ran).To(BeTrue())
+		})
+	})
+})
@@ -24,4 +24,6 @@ const (
 	ADDPEER = "add-peer"
 	// REMOVEPEER is the type of messages used for deleting a peer from peers buffer
 	REMOVEPEER = "remove-peer"
+	// CONFIGUPDATE is the type of messages used for updating the config of all nodes
+	CONFIGUPDATE = "config-update"
 )
@@ -0,0 +1,131 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package detector
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// State is the state of a peer.
+type State int
+
+const (
+	// Alive peers answered the last request sent to them.
+	Alive State = iota
+	// Suspect peers failed the last request sent to them.
+	Suspect
+	// Dead peers were suspect for longer than the suspicion timeout.
+	Dead
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Alive:
+		return "alive"
+	case Suspect:
+		return "suspect"
+	case Dead:
+		return "dead"
+	default:
+		return "unknown"
+	}
+}
+
+// Detector detects the failed peers from the results of the requests sent to
+// them: a peer becomes suspect when a request to it fails, and it is dead if no
+// request succeeds and no request is received from it during the suspicion
+// timeout.
+type Detector struct {
+	suspicionTimeout time.Duration
+	// suspects are the times when the suspect peers failed first
+	suspects map[string]time.Time
+	mux      sync.Mutex
+}
+
+// New creates a Detector which declares dead the peers which are suspect for
+// longer than given timeout.
+func New(suspicionTimeout time.Duration) *Detector {
+	return &Detector{
+		suspicionTimeout: suspicionTimeout,
+		suspects:         map[string]time.Time{},
+	}
+}
+
+// Alive marks the peer with given host as alive, e.g. after it answered a
+// request or it sent a request.
+func (d *Detector) Alive(host string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	delete(d.suspects, host)
+}
+
+// Failed marks the peer with given host as suspect, if it is not suspect
+// already.
+func (d *Detector) Failed(host string, now time.Time) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.suspects[host]; !ok {
+		d.suspects[host] = now
+	}
+}
+
+// State returns the state of the peer with given host.
+func (d *Detector) State(host string, now time.Time) State {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	return d.state(host, now)
+}
+
+// state returns the state of the peer with given host. The caller must hold the lock.
+func (d *Detector) state(host string, now time.Time) State {
+	since, ok := d.suspects[host]
+
+	switch {
+	case !ok:
+		return Alive
+	case now.Sub(since) > d.suspicionTimeout:
+		return Dead
+	default:
+		return Suspect
+	}
+}
+
+// Dead returns the sorted hosts of the dead peers and forgets them, so each
+// dead peer is returned once.
+func (d *Detector) Dead(now time.Time) []string {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	dead := []string{}
+
+	for host := range d.suspects {
+		if d.state(host, now) == Dead {
+			dead = append(dead, host)
+			delete(d.suspects, host)
+		}
+	}
+
+	sort.Strings(dead)
+
+	return dead
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 Robert Andrei STEFAN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package detector
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Detector", func() {
+	var (
+		d   *Detector
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		d = New(time.Second)
+		now = time.Now()
+	})
+
+	It("keeps unknown peers alive", func() {
+		Expect(d.State("localhost:1", now)).To(Equal(Alive))
+		Expect(d.Dead(now)).To(BeEmpty())
+	})
+
+	It("suspects peers until the suspicion timeout", func() {
+		d.Failed("localhost:1", now)
+		d.Failed("localhost:1", now.Add(time.Second))
+
+		Expect(d.State("localhost:1", now.Add(time.Second))).To(Equal(Suspect))
+		Expect(d.State("localhost:1", now.Add(2*time.Second))).To(Equal(Dead))
+	})
+
+	It("clears the suspicion of peers which are alive", func() {
+		d.Failed("localhost:1", now)
+		d.Alive("localhost:1")
+
+		Expect(d.State("localhost:1", now.Add(time.Hour))).To(Equal(Alive))
+	})
+
+	It("returns each dead peer once", func() {
+		d.Failed("localhost:2", now)
+		d.Failed("localhost:1", now)
+		d.Failed("localhost:3", now.Add(time.Second))
+
+		Expect(d.Dead(now.Add(1500 * time.Millisecond))).To(Equal([]string{"localhost:1", "localhost:2"}))
+		Expect(d.Dead(now.Add(1500 * time.Millisecond))).To(BeEmpty())
+		Expect(d.State("localhost:3", now.Add(1500*time.Millisecond))).To(Equal(Suspect))
+	})
+})
@@ -18,8 +18,11 @@ package peer
 
 import (
 	"fmt"
-	"math/rand"
+	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/rstefan1/bimodal-multicast/pkg/internal/validators"
 )
@@ -36,7 +39,20 @@ type Peer struct {
 // Buffer is the buffer with peers.
 type Buffer struct {
 	peers []Peer
-	mux   *sync.Mutex
+	mux   *sync.RWMutex
+
+	// maxPeers is the maximum number of peers; when it is reached, the least
+	// recently seen peer is evicted. It is 0 if adding peers fails at MAXPEERS
+	maxPeers int
+	// lastSeen is the time when each peer was added or last seen, by key
+	lastSeen map[string]time.Time
+
+	// onChange is called after peers are added or removed
+	onChange func()
+	// onAdded and onRemoved are called with each added and removed peer,
+	// including the evicted peers
+	onAdded   func(Peer)
+	onRemoved func(Peer)
 }
 
 // NewPeer creates a Peer.
@@ -55,79 +71,251 @@ func NewPeer(addr, port string) (Peer, error) {
 	}, nil
 }
 
+// Addr returns the address of the peer.
+func (p Peer) Addr() string {
+	return p.addr
+}
+
+// Port returns the port of the peer.
+func (p Peer) Port() string {
+	return p.port
+}
+
 // NewPeerBuffer creates a PeerBuffer.
 func NewPeerBuffer() *Buffer {
 	return &Buffer{
 		peers: []Peer{},
-		mux:   &sync.Mutex{},
+		mux:   &sync.RWMutex{},
 	}
 }
 
 // Length returns length of peers buffer.
 func (peerBuffer *Buffer) Length() int {
-	peerBuffer.mux.Lock()
-	defer peerBuffer.mux.Unlock()
+	peerBuffer.mux.RLock()
+	defer peerBuffer.mux.RUnlock()
 
 	l := len(peerBuffer.peers)
 
 	return l
 }
 
+// Host returns the canonical host:port form of given address and port, so the
+// same host written differently (e.g. "LOCALHOST", "::0001" or "[::1]") has a
+// single form. IPv6 addresses are enclosed in brackets.
+func Host(addr, port string) string {
+	addr = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"))
+	if ip := net.ParseIP(addr); ip != nil {
+		addr = ip.String()
+	}
+
+	if n, err := strconv.Atoi(port); err == nil {
+		port = strconv.Itoa(n)
+	}
+
+	return net.JoinHostPort(addr, port)
+}
+
+// key returns the canonical form of the peer, so the same peer written
+// differently is not added twice.
+func (p Peer) key() string {
+	return Host(p.addr, p.port)
+}
+
 // alreadyExists return true if the peer already exists in peers buffer.
 func (peerBuffer *Buffer) alreadyExists(peer Peer) bool {
 	// Important! Whoever calls this function must LOCK the buffer
-	for _, p := range peerBuffer.peers {
-		if p.addr == peer.addr && p.port == peer.port {
-			return true
+	return peerBuffer.position(peer) >= 0
+}
+
+// position returns the position of the peer in peers buffer, or -1.
+func (peerBuffer *Buffer) position(peer Peer) int {
+	// Important! Whoever calls this function must LOCK the buffer
+	key := peer.key()
+
+	for i, p := range peerBuffer.peers {
+		if p.key() == key {
+			return i
 		}
 	}
 
-	return false
+	return -1
 }
 
-// AddPeer adds a peer in peers buffer.
-func (peerBuffer *Buffer) AddPeer(peer Peer) error {
+// SetMaxPeers sets the maximum number of peers. When it is reached, adding a
+// peer evicts the least recently seen peer. A max equal to 0 means MAXPEERS,
+// without eviction.
+func (peerBuffer *Buffer) SetMaxPeers(max int) {
 	peerBuffer.mux.Lock()
 	defer peerBuffer.mux.Unlock()
 
-	if len(peerBuffer.peers)+1 >= MAXPEERS {
-		return fmt.Errorf("the buffer is full. Can add up to %d peers", MAXPEERS) // nolint: goerr113
+	peerBuffer.maxPeers = max
+}
+
+// Touch marks the peer as seen now, if it is in peers buffer.
+func (peerBuffer *Buffer) Touch(peer Peer) {
+	peerBuffer.mux.Lock()
+	defer peerBuffer.mux.Unlock()
+
+	if peerBuffer.alreadyExists(peer) {
+		peerBuffer.touch(peer)
 	}
+}
+
+// LastSeen returns the time when the peer was added or last seen, or the zero
+// time if it is not in peers buffer.
+func (peerBuffer *Buffer) LastSeen(peer Peer) time.Time {
+	peerBuffer.mux.RLock()
+	defer peerBuffer.mux.RUnlock()
+
+	return peerBuffer.lastSeen[peer.key()]
+}
+
+// touch marks the peer as seen now.
+func (peerBuffer *Buffer) touch(peer Peer) {
+	// Important! Whoever calls this function must LOCK the buffer
+	if peerBuffer.lastSeen == nil {
+		peerBuffer.lastSeen = map[string]time.Time{}
+	}
+
+	peerBuffer.lastSeen[peer.key()] = time.Now()
+}
+
+// evictLeastRecentlySeen removes the peer which was seen the longest time ago
+// and returns it.
+func (peerBuffer *Buffer) evictLeastRecentlySeen() []Peer {
+	// Important! Whoever calls this function must LOCK the buffer
+	if len(peerBuffer.peers) == 0 {
+		return nil
+	}
+
+	oldest := 0
+
+	for i, p := range peerBuffer.peers {
+		if peerBuffer.lastSeen[p.key()].Before(peerBuffer.lastSeen[peerBuffer.peers[oldest].key()]) {
+			oldest = i
+		}
+	}
+
+	evicted := peerBuffer.peers[oldest]
+	peerBuffer.removeAt(oldest)
+
+	return []Peer{evicted}
+}
+
+// removeAt removes the peer at given position from peers buffer.
+func (peerBuffer *Buffer) removeAt(pos int) {
+	// Important! Whoever calls this function must LOCK the buffer
+	delete(peerBuffer.lastSeen, peerBuffer.peers[pos].key())
+
+	peerBuffer.peers[pos] = peerBuffer.peers[len(peerBuffer.peers)-1] // Copy last element to index pos.
+	peerBuffer.peers[len(peerBuffer.peers)-1] = Peer{}                // Erase last element (write zero value).
+	peerBuffer.peers = peerBuffer.peers[:len(peerBuffer.peers)-1]     // Truncate slice.
+}
+
+// OnChange sets the func which is called after peers are added or removed.
+// The func is called without holding the lock, so it can read the buffer.
+func (peerBuffer *Buffer) OnChange(fn func()) {
+	peerBuffer.mux.Lock()
+	defer peerBuffer.mux.Unlock()
+
+	peerBuffer.onChange = fn
+}
+
+// OnAdded sets the func which is called with each added peer. The func is
+// called without holding the lock, so it can read the buffer.
+func (peerBuffer *Buffer) OnAdded(fn func(Peer)) {
+	peerBuffer.mux.Lock()
+	defer peerBuffer.mux.Unlock()
+
+	peerBuffer.onAdded = fn
+}
+
+// OnRemoved sets the func which is called with each removed peer, including
+// the peers evicted when the buffer is full. The func is called without
+// holding the lock, so it can read the buffer.
+func (peerBuffer *Buffer) OnRemoved(fn func(Peer)) {
+	peerBuffer.mux.Lock()
+	defer peerBuffer.mux.Unlock()
+
+	peerBuffer.onRemoved = fn
+}
+
+// changed calls the change funcs, if any, with given added and removed peers.
+func (peerBuffer *Buffer) changed(added, removed []Peer) {
+	peerBuffer.mux.RLock()
+	onChange, onAdded, onRemoved := peerBuffer.onChange, peerBuffer.onAdded, peerBuffer.onRemoved
+	peerBuffer.mux.RUnlock()
+
+	if onRemoved != nil {
+		for _, p := range removed {
+			onRemoved(p)
+		}
+	}
+
+	if onAdded != nil {
+		for _, p := range added {
+			onAdded(p)
+		}
+	}
+
+	if onChange != nil {
+		onChange()
+	}
+}
+
+// AddPeer adds a peer in peers buffer.
+func (peerBuffer *Buffer) AddPeer(peer Peer) (err error) {
+	var evicted []Peer
+
+	defer func() {
+		if err == nil {
+			peerBuffer.changed([]Peer{peer}, evicted)
+		}
+	}()
+
+	peerBuffer.mux.Lock()
+	defer peerBuffer.mux.Unlock()
 
 	if peerBuffer.alreadyExists(peer) {
 		return fmt.Errorf("peer %s/%s already exists in peer buffer", peer.addr, peer.port) // nolint: goerr113
 	}
 
+	switch {
+	case peerBuffer.maxPeers > 0 && len(peerBuffer.peers) >= peerBuffer.maxPeers:
+		evicted = peerBuffer.evictLeastRecentlySeen()
+	case len(peerBuffer.peers)+1 >= MAXPEERS:
+		return fmt.Errorf("the buffer is full. Can add up to %d peers", MAXPEERS) // nolint: goerr113
+	}
+
 	peerBuffer.peers = append(peerBuffer.peers, peer)
+	peerBuffer.touch(peer)
 
 	return nil
 }
 
 // RemovePeer removes a peer from peers buffer.
 func (peerBuffer *Buffer) RemovePeer(peer Peer) {
-	peerBuffer.mux.Lock()
-	defer peerBuffer.mux.Unlock()
-
-	pos := -14
+	removed := false
 
-	for i, p := range peerBuffer.peers {
-		if p.addr == peer.addr && p.port == peer.port {
-			pos = i
-			break
+	defer func() {
+		if removed {
+			peerBuffer.changed(nil, []Peer{peer})
 		}
-	}
+	}()
+
+	peerBuffer.mux.Lock()
+	defer peerBuffer.mux.Unlock()
 
-	if pos >= 0 {
-		peerBuffer.peers[pos] = peerBuffer.peers[len(peerBuffer.peers)-1] // Copy last element to index pos.
-		peerBuffer.peers[len(peerBuffer.peers)-1] = Peer{}                // Erase last element (write zero value).
-		peerBuffer.peers = peerBuffer.peers[:len(peerBuffer.peers)-1]     // Truncate slice.
+	if pos := peerBuffer.position(peer); pos >= 0 {
+		peerBuffer.removeAt(pos)
+		removed = true
 	}
 }
 
 // GetPeers returns a list of strings that contains peers.
 func (peerBuffer *Buffer) GetPeers() []string {
-	peerBuffer.mux.Lock()
-	defer peerBuffer.mux.Unlock()
+	peerBuffer.mux.RLock()
+	defer peerBuffer.mux.RUnlock()
 
 	p := make([]string, len(peerBuffer.peers))
 	for i := range peerBuffer.peers {
@@ -137,12 +325,13 @@ func (peerBuffer *Buffer) GetPeers() []string {
 	return p
 }
 
-// GetRandom returns random peer from peers buffer.
-func (peerBuffer *Buffer) GetRandom() (string, string, int) {
-	peerBuffer.mux.Lock()
-	defer peerBuffer.mux.Unlock()
+// Peers returns a copy of the peers from peers buffer.
+func (peerBuffer *Buffer) Peers() []Peer {
+	peerBuffer.mux.RLock()
+	defer peerBuffer.mux.RUnlock()
 
-	r := rand.Intn(len(peerBuffer.peers))
+	p := make([]Peer, len(peerBuffer.peers))
+	copy(p, peerBuffer.peers)
 
-	return peerBuffer.peers[r].addr, peerBuffer.peers[r].port, r
+	return p
 }
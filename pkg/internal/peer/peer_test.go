@@ -17,7 +17,10 @@ limitations under the License.
 package peer
 
 import (
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
@@ -33,7 +36,7 @@ var _ = Describe("Peer Buffer Interface", func() {
 			}
 			pBuf := &Buffer{
 				peers: peers,
-				mux:   &sync.Mutex{},
+				mux:   &sync.RWMutex{},
 			}
 
 			Expect(pBuf.Length()).To(Equal(len(peers)))
@@ -44,7 +47,7 @@ var _ = Describe("Peer Buffer Interface", func() {
 		func(peers []Peer, p Peer, expected bool) {
 			pBuf := &Buffer{
 				peers: peers,
-				mux:   &sync.Mutex{},
+				mux:   &sync.RWMutex{},
 			}
 			Expect(pBuf.alreadyExists(p)).To(Equal(expected))
 		},
@@ -80,13 +83,30 @@ var _ = Describe("Peer Buffer Interface", func() {
 			},
 			Peer{addr: "localhost", port: "55555"},
 			false),
+		Entry("returns true if an ipv6 peer is written differently",
+			[]Peer{
+				{addr: "::0001", port: "55555"},
+			},
+			Peer{addr: "[::1]", port: "55555"},
+			true),
+	)
+
+	DescribeTable("Host returns the canonical host",
+		func(addr, port, expected string) {
+			Expect(Host(addr, port)).To(Equal(expected))
+		},
+		Entry("for an ipv4 address", "127.0.0.1", "8080", "127.0.0.1:8080"),
+		Entry("for a host name", "Node.Example.com", "8080", "node.example.com:8080"),
+		Entry("for an ipv6 address", "::0001", "8080", "[::1]:8080"),
+		Entry("for an ipv6 address in brackets", "[fe80::1]", "08080", "[fe80::1]:8080"),
+		Entry("for any address", "", "8080", ":8080"),
 	)
 
 	DescribeTable("when AddPeer() is called",
 		func(peers []Peer, p Peer, expectError bool, expectedPeers []Peer) {
 			pBuf := &Buffer{
 				peers: peers,
-				mux:   &sync.Mutex{},
+				mux:   &sync.RWMutex{},
 			}
 
 			err := pBuf.AddPeer(p)
@@ -123,8 +143,44 @@ var _ = Describe("Peer Buffer Interface", func() {
 				{addr: "localhost", port: "20000"},
 			},
 		),
+		Entry("doens't add peer in the peers buffer when it already exists written differently",
+			[]Peer{
+				{addr: "localhost", port: "10000"},
+				{addr: "::1", port: "20000"},
+			},
+			Peer{addr: "0:0::0001", port: "020000"},
+			false,
+			[]Peer{
+				{addr: "localhost", port: "10000"},
+				{addr: "::1", port: "20000"},
+			},
+		),
 	)
 
+	When("the peers buffer has a maximum size", func() {
+		It("evicts the least recently seen peer", func() {
+			pBuf := NewPeerBuffer()
+			pBuf.SetMaxPeers(2)
+
+			peers := make([]Peer, 3)
+			for i := range peers {
+				p, err := NewPeer("localhost", strconv.Itoa(10000+i))
+				Expect(err).To(Succeed())
+
+				peers[i] = p
+			}
+
+			Expect(pBuf.AddPeer(peers[0])).To(Succeed())
+			time.Sleep(time.Millisecond)
+			Expect(pBuf.AddPeer(peers[1])).To(Succeed())
+			time.Sleep(time.Millisecond)
+			pBuf.Touch(peers[0])
+
+			Expect(pBuf.AddPeer(peers[2])).To(Succeed())
+			Expect(pBuf.Peers()).To(ConsistOf(peers[0], peers[2]))
+		})
+	})
+
 	When("GetPeers() is called", func() {
 		It("returns a slice of strings with peers", func() {
 			peers := []Peer{
@@ -133,7 +189,7 @@ var _ = Describe("Peer Buffer Interface", func() {
 			}
 			pBuf := &Buffer{
 				peers: peers,
-				mux:   &sync.Mutex{},
+				mux:   &sync.RWMutex{},
 			}
 			expectedPeers := []string{
 				"localhost/10000",
@@ -144,11 +200,78 @@ var _ = Describe("Peer Buffer Interface", func() {
 		})
 	})
 
+	When("Peers() is called", func() {
+		It("returns a copy of peers", func() {
+			peers := []Peer{
+				{addr: "localhost", port: "10000"},
+				{addr: "localhost", port: "20000"},
+			}
+			pBuf := &Buffer{
+				peers: peers,
+				mux:   &sync.RWMutex{},
+			}
+
+			p := pBuf.Peers()
+			Expect(p).To(Equal(peers))
+
+			p[0] = Peer{}
+			Expect(pBuf.peers[0]).To(Equal(Peer{addr: "localhost", port: "10000"}))
+		})
+	})
+
+	When("peers are added or removed", func() {
+		It("calls the OnChange func", func() {
+			pBuf := NewPeerBuffer()
+
+			changes := 0
+			pBuf.OnChange(func() {
+				// the buffer can be read in OnChange func
+				Expect(pBuf.Peers()).NotTo(BeNil())
+				changes++
+			})
+
+			p, err := NewPeer("localhost", "10000")
+			Expect(err).To(Succeed())
+
+			Expect(pBuf.AddPeer(p)).To(Succeed())
+			Expect(pBuf.AddPeer(p)).NotTo(Succeed())
+			pBuf.RemovePeer(p)
+			pBuf.RemovePeer(p)
+
+			Expect(changes).To(Equal(2))
+		})
+
+		It("calls the OnAdded and OnRemoved funcs with the peers, including the evicted ones", func() {
+			pBuf := NewPeerBuffer()
+			pBuf.SetMaxPeers(1)
+
+			added := []Peer{}
+			removed := []Peer{}
+
+			pBuf.OnAdded(func(p Peer) { added = append(added, p) })
+			pBuf.OnRemoved(func(p Peer) { removed = append(removed, p) })
+
+			first, err := NewPeer("localhost", "10000")
+			Expect(err).To(Succeed())
+
+			second, err := NewPeer("localhost", "20000")
+			Expect(err).To(Succeed())
+
+			Expect(pBuf.AddPeer(first)).To(Succeed())
+			Expect(pBuf.AddPeer(second)).To(Succeed())
+			pBuf.RemovePeer(second)
+			pBuf.RemovePeer(second)
+
+			Expect(added).To(Equal([]Peer{first, second}))
+			Expect(removed).To(Equal([]Peer{first, second}))
+		})
+	})
+
 	DescribeTable("when RemovePeer() is called",
 		func(peers []Peer, p Peer, expectedPeers []Peer) {
 			pBuf := &Buffer{
 				peers: peers,
-				mux:   &sync.Mutex{},
+				mux:   &sync.RWMutex{},
 			}
 			pBuf.RemovePeer(p)
 			Expect(pBuf.peers).To(ConsistOf(expectedPeers))
@@ -198,4 +321,39 @@ var _ = Describe("Peer Buffer Interface", func() {
 				{addr: "localhost", port: "20000"},
 			}),
 	)
+	It("is safe for concurrent use", func() {
+		pBuf := NewPeerBuffer()
+		changes := int32(0)
+		pBuf.OnChange(func() {
+			atomic.AddInt32(&changes, 1)
+			pBuf.Peers()
+		})
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				for j := 0; j < 50; j++ {
+					p := Peer{addr: "localhost", port: strconv.Itoa(10000 + i*100 + j)}
+					Expect(pBuf.AddPeer(p)).To(Succeed())
+
+					pBuf.Length()
+					pBuf.GetPeers()
+
+					if j%2 == 0 {
+						pBuf.RemovePeer(p)
+					}
+				}
+			}(i)
+		}
+
+		wg.Wait()
+
+		Expect(pBuf.Length()).To(Equal(8 * 25))
+		Expect(atomic.LoadInt32(&changes)).To(Equal(int32(8 * 75)))
+	})
 })